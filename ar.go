@@ -0,0 +1,156 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unix ar archives: static libraries, and Debian packages, which hold a
+// debian-binary version file and control.tar.* and data.tar.* tarballs.
+// Both the GNU long-name table and BSD's "#1/" names are read.
+
+const (
+	arMagic     = "!<arch>\n"
+	arHeaderLen = 60
+)
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_AR,
+		detect:      func(header []byte) bool { return bytes.HasPrefix(header, []byte(arMagic)) },
+		load:        loadArArchive,
+		open:        openStoredEntry,
+	})
+}
+
+// For a Debian package, also list the entries of its control and data
+// tarballs, as WithNestedArchives would, so the package's files are there
+// in one call: see ArchiveInfo.PackageFiles, or reach them through
+// NestedFile as "data.tar.xz!/./usr/bin/tool".  No effect on other archives.
+func WithPackageContents() Option {
+	return func(o *options) { o.packageContents = true }
+}
+
+func loadArArchive(ar *ArchiveInfo) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	var longNames []byte // GNU's "//" member
+	head := make([]byte, arHeaderLen)
+	for pos, index := int64(len(arMagic)), 0; pos < src.size; {
+		if _, err = src.ReadAt(head, pos); err != nil {
+			return openError(ar.fullname, fmt.Errorf("member header at %d: %w", pos, err))
+		}
+		if string(head[58:60]) != "`\n" {
+			return openError(ar.fullname, fmt.Errorf("%w: bad member header at %d", ErrCorruptArchive, pos))
+		}
+		size, err := arField(head[48:58], 10)
+		if err != nil || size < 0 || pos+arHeaderLen+size > src.size {
+			return openError(ar.fullname, fmt.Errorf("%w: bad member size at %d", ErrCorruptArchive, pos))
+		}
+		data := pos + arHeaderLen
+		pos = data + size + size%2 // Members start on even offsets
+		name := strings.TrimRight(string(head[:16]), " ")
+		switch {
+		case name == "/" || name == "/SYM64/" || strings.HasPrefix(name, "__.SYMDEF"):
+			continue // Symbol table
+		case name == "//":
+			if longNames = make([]byte, size); size > 0 {
+				if _, err = src.ReadAt(longNames, data); err != nil {
+					return openError(ar.fullname, err)
+				}
+			}
+			continue
+		case strings.HasPrefix(name, "#1/"):
+			n, err := strconv.ParseInt(name[3:], 10, 64)
+			if err != nil || n < 0 || n > size {
+				return openError(ar.fullname, fmt.Errorf("%w: bad BSD name %q", ErrCorruptArchive, name))
+			}
+			buf := make([]byte, n)
+			if _, err = src.ReadAt(buf, data); err != nil {
+				return openError(ar.fullname, err)
+			}
+			name = strings.TrimRight(string(buf), "\x00")
+			data, size = data+n, size-n
+		case len(name) > 1 && name[0] == '/':
+			offset, err := strconv.Atoi(name[1:])
+			if err != nil || offset < 0 || offset >= len(longNames) {
+				return openError(ar.fullname, fmt.Errorf("%w: bad long name %q", ErrCorruptArchive, name))
+			}
+			name, _, _ = strings.Cut(string(longNames[offset:]), "\n")
+			name = strings.TrimSuffix(name, "/")
+		default:
+			name = strings.TrimSuffix(name, "/")
+		}
+		var mode fs.FileMode = 0o644
+		if m, err := arField(head[40:48], 8); err == nil && m != 0 {
+			mode = unixFileMode(uint32(m))
+		}
+		var modTime time.Time
+		if secs, err := arField(head[16:28], 10); err == nil && secs > 0 {
+			modTime = time.Unix(secs, 0).UTC()
+		}
+		err = ar.addFile(ArchivedFile{archivefile: ar.fullname, archivetype: ARCHIVE_AR, name: name, size: size,
+			mode: mode, modTime: modTime, method: "Store", packed: size, extents: []imageExtent{{data, size}}, index: index})
+		if err != nil {
+			return err
+		}
+		index++
+	}
+	return nil
+}
+
+// A space-padded number in base; 0 for an empty field.
+func arField(field []byte, base int) (int64, error) {
+	s := strings.TrimSpace(string(field))
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, base, 64)
+}
+
+// Reports whether an ar member is one of a Debian package's tarballs.
+func isDebTarball(name string) bool {
+	return strings.HasPrefix(name, "control.tar") || strings.HasPrefix(name, "data.tar")
+}
+
+// List the package tarballs' entries under WithPackageContents.  A member
+// that doesn't parse stays a plain file, with a warning, as with
+// WithNestedArchives.
+func (ar *ArchiveInfo) loadPackageContents() error {
+	for i := range ar.files {
+		af := &ar.files[i]
+		if !isDebTarball(af.name) || af.nested != nil {
+			continue
+		}
+		data, err := af.GetBytes()
+		if err == nil {
+			af.nested, err = ar.loadMember(af, data)
+		}
+		if err != nil {
+			if fatal := fatalNested(err); fatal != nil {
+				return fatal
+			}
+			ar.warn(&EntryError{Archive: ar.fullname, Name: af.name, Offset: -1, Err: err})
+		}
+	}
+	return nil
+}
+
+// The entries of a Debian package's data tarball, the files it installs,
+// as listed under WithPackageContents.  nil if there's no such tarball or
+// it wasn't listed.
+func (ai *ArchiveInfo) PackageFiles() []ArchivedFile {
+	for i := range ai.files {
+		if af := &ai.files[i]; strings.HasPrefix(af.name, "data.tar") && af.nested != nil {
+			return af.nested.files
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// An ar archive of members, each a name as the header holds it (with
+// "#1/" names taking theirs from the data) and content.
+func buildTestAr(members ...[2]string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(arMagic)
+	for _, m := range members {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", m[0], 1700000000, 0, 0, 0o100644, len(m[1]))
+		buf.WriteString(m[1])
+		if len(m[1])%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestArNames(t *testing.T) {
+	longNames := "a_rather_long_object_name.o/\nanother_long_object_name.o/\n"
+	img := buildTestAr([2]string{"/", "symbols"}, [2]string{"//", longNames},
+		[2]string{"short.o/", "one"}, [2]string{"/0", "two"}, [2]string{"/29", "three"},
+		[2]string{"#1/20", "bsd_long_name.o\x00\x00\x00\x00\x00four"})
+	name := filepath.Join(t.TempDir(), "libx.a")
+	if err := os.WriteFile(name, img, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := GetArchiveInfo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"short.o": "one", "a_rather_long_object_name.o": "two",
+		"another_long_object_name.o": "three", "bsd_long_name.o": "four"}
+	if ai.ArchiveType != ARCHIVE_AR || len(ai.Files()) != len(want) {
+		t.Fatalf("type %v, %d entries", ai.ArchiveType, len(ai.Files()))
+	}
+	for _, af := range ai.Files() {
+		data, err := af.GetBytes()
+		if err != nil || string(data) != want[af.Name()] {
+			t.Errorf("%s: %q, %v", af.Name(), data, err)
+		}
+		if af.Mode() != 0o644 || !af.ModTime().Equal(time.Unix(1700000000, 0)) {
+			t.Errorf("%s: mode %v, time %v", af.Name(), af.Mode(), af.ModTime())
+		}
+	}
+}
+
+func TestDebPackage(t *testing.T) {
+	dir := t.TempDir()
+	control, err := os.ReadFile(writeTestTgz(t, dir, "control.tar.gz", []testTarEntry{
+		{tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755}, ""},
+		{tar.Header{Name: "./control", Typeflag: tar.TypeReg, Mode: 0o644}, "Package: tool\nVersion: 1.0\n"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data bytes.Buffer
+	xw, _ := xz.NewWriter(&data)
+	tw := tar.NewWriter(xw)
+	for _, f := range [][2]string{{"./usr/bin/tool", "#!/bin/sh\n"}, {"./usr/share/doc/tool/README", "docs\n"}} {
+		tw.WriteHeader(&tar.Header{Name: f[0], Typeflag: tar.TypeReg, Mode: 0o755, Size: int64(len(f[1]))})
+		tw.Write([]byte(f[1]))
+	}
+	tw.Close()
+	xw.Close()
+	deb := filepath.Join(dir, "tool_1.0_all.deb")
+	img := buildTestAr([2]string{"debian-binary", "2.0\n"}, [2]string{"control.tar.gz", string(control)},
+		[2]string{"data.tar.xz", data.String()})
+	if err := os.WriteFile(deb, img, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := GetArchiveInfo(deb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.Files()) != 3 || plain.PackageFiles() != nil || !plain.ExtensionMatchesType() {
+		t.Errorf("without WithPackageContents: %d entries", len(plain.Files()))
+	}
+
+	ai, err := GetArchiveInfo(deb, WithPackageContents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, af := range ai.PackageFiles() {
+		names = append(names, af.Name())
+	}
+	if got := strings.Join(names, ","); got != "./usr/bin/tool,./usr/share/doc/tool/README" {
+		t.Errorf("PackageFiles = %s", got)
+	}
+	if got, err := ai.NestedFile("data.tar.xz!/./usr/bin/tool").GetBytes(); err != nil || string(got) != "#!/bin/sh\n" {
+		t.Errorf("tool: %q, %v", got, err)
+	}
+	if got, err := ai.NestedFile("control.tar.gz!/./control").GetBytes(); err != nil || !strings.HasPrefix(string(got), "Package: tool") {
+		t.Errorf("control: %q, %v", got, err)
+	}
+	if got, err := ai.File("debian-binary").GetBytes(); err != nil || string(got) != "2.0\n" {
+		t.Errorf("debian-binary: %q, %v", got, err)
+	}
+}
@@ -2,17 +2,19 @@ package archiver
 
 import (
 	"archive/tar"
-	"archive/zip"
-	"compress/gzip"
+	"context"
 	_ "embed"
-	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
+	"math"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"time"
 
@@ -28,6 +30,35 @@ const (
 	ARCHIVE_ZIP           // Zip
 	ARCHIVE_TGZ
 	ARCHIVE_7Z
+	ARCHIVE_SPARSE   // Android sparse image.  Needs the "sparse" build tag
+	ARCHIVE_GZ       // gzip of a single file.  Sniffs as ARCHIVE_TGZ until the content shows otherwise
+	ARCHIVE_RAR      // RAR 4 or 5, single volume
+	ARCHIVE_TAR      // Uncompressed tar
+	ARCHIVE_TBZ2     // bzip2-compressed tar
+	ARCHIVE_TXZ      // xz-compressed tar
+	ARCHIVE_TZST     // zstd-compressed tar
+	ARCHIVE_ISO      // ISO 9660 or UDF disc image
+	ARCHIVE_AR       // Unix ar archive, as Debian packages are
+	ARCHIVE_RPM      // RPM package; its entries are the cpio payload's
+	ARCHIVE_CPIO     // Uncompressed cpio, newc or odc
+	ARCHIVE_CAB      // Microsoft cabinet
+	ARCHIVE_BZ2      // bzip2 of a single file.  Sniffs as ARCHIVE_TBZ2 until the content shows otherwise
+	ARCHIVE_XZ       // xz of a single file.  Sniffs as ARCHIVE_TXZ until the content shows otherwise
+	ARCHIVE_ZST      // zstd of a single file.  Sniffs as ARCHIVE_TZST until the content shows otherwise
+	ARCHIVE_SQUASHFS // Squashfs 4.0 image
+	ARCHIVE_DMG      // Apple UDIF disk image; its entries are the partitions
+	ARCHIVE_XAR      // XAR archive, as macOS installer packages are
+	ARCHIVE_LHA      // LHA (LZH) archive, header levels 0 to 2
+	ARCHIVE_ARJ      // ARJ archive, single volume
+	ARCHIVE_WIM      // Windows Imaging Format; several images list under their numbers
+	ARCHIVE_TBR      // Brotli-compressed tar.  Brotli has no magic, so this goes by the extension
+	ARCHIVE_TLZ4     // LZ4-compressed tar
+	ARCHIVE_BR       // Brotli of a single file.  Claimed as ARCHIVE_TBR until the content shows otherwise
+	ARCHIVE_LZ4      // LZ4 of a single file.  Sniffs as ARCHIVE_TLZ4 until the content shows otherwise
+	ARCHIVE_TZ       // Unix compress (.Z) tar
+	ARCHIVE_TLZ      // lzip-compressed tar
+	ARCHIVE_Z        // Unix compress of a single file.  Sniffs as ARCHIVE_TZ until the content shows otherwise
+	ARCHIVE_LZ       // lzip of a single file.  Sniffs as ARCHIVE_TLZ until the content shows otherwise
 )
 
 type ArchiveInfo struct {
@@ -37,6 +68,24 @@ type ArchiveInfo struct {
 	size        int64       // File size.
 	ArchiveType ArchiveType // Type of archive (or na)
 	files       []ArchivedFile
+	opts        options
+	reader      io.ReaderAt // Source for GetArchiveInfoFromReader; nil means the file
+	fsys        fs.FS       // Holds fullname for GetArchiveInfoFSAt; nil means the OS
+	volumes     *volumeSet  // The pieces of a split archive; nil for one file
+	warnings    []error
+	index       *nameIndex // Lazily built; see lookup
+	indexOnce   sync.Once
+	handle      sharedFile         // Held open between reads under WithIdleTimeout
+	tree        map[string]*fsNode // Lazily built; see fsTree
+	treeOnce    sync.Once
+	kind        containerInfo // Lazily classified; see container
+	kindOnce    sync.Once
+	ctx         context.Context         // Only while GetArchiveInfoContext lists
+	lazyCtx     context.Context         // GetArchiveInfoContext's, for Entries to list with under WithLazyListing
+	owner       *ArchiveInfo            // For an Entries lister, the ArchiveInfo whose source it reads
+	unpacked    int64                   // Listed uncompressed bytes, for Limits
+	listed      *atomic.Int64           // Archive bytes read, while listing under WithProgress
+	visit       func(ArchivedFile) bool // Takes each entry instead of the listing, under Entries
 }
 
 func (ai *ArchiveInfo) Size() int64           { return ai.size }
@@ -46,14 +95,19 @@ func (ai *ArchiveInfo) Files() []ArchivedFile { return ai.files }
 
 // Return pointer to the named file.  Name must be exact.
 func (ai *ArchiveInfo) File(fname string) *ArchivedFile {
-	if len(ai.files) == 0 {
+	idx, found := ai.lookup().byName[fname]
+	if !found {
 		return nil
 	}
-	idx := slices.IndexFunc(ai.files, func(e ArchivedFile) bool { return e.name == fname })
-	if idx == -1 {
+	return &ai.files[idx]
+}
+
+// The i-th listed entry, or nil if i is out of range.
+func (ai *ArchiveInfo) FileAt(i int) *ArchivedFile {
+	if i < 0 || i >= len(ai.files) {
 		return nil
 	}
-	return &ai.files[idx]
+	return &ai.files[i]
 }
 
 // Same as os.fileStat, implements/extends fs.FileInfo
@@ -65,18 +119,103 @@ type ArchivedFile struct {
 	IsDir       bool
 	mode        fs.FileMode
 	modTime     time.Time
+	accessTime  time.Time         // Zero when the archive doesn't record it
+	createTime  time.Time         // Zero when the archive doesn't record it
+	changeTime  time.Time         // Inode change time; zero when the archive doesn't record it
+	method      string            // Compression codec(s), where known
+	linkname    string            // Target of a tar symlink or hardlink
+	hardlink    bool              // Tar hardlink to linkname; no data of its own
+	pax         map[string]string // Tar PAX records, global ones included
+	devMajor    int64             // Tar character and block devices
+	devMinor    int64             // Tar character and block devices
+	encrypted   bool              // Reading needs WithPassword
+	packed      int64             // Compressed size, where the format records it per entry
+	nested      *ArchiveInfo      // Listed content, under WithNestedArchives
+	crc         uint32            // Stored CRC-32 of the content, if hasCRC
+	hasCRC      bool
+	zip64       bool            // Zip entry whose sizes or offset needed a zip64 record
+	extents     []imageExtent   // Where a disc image or ar entry's data lies
+	stream      int             // 7z folder (solid block) holding the data; -1 for none
+	inode       uint64          // Squashfs inode reference, to find the data's blocks again
+	progress    ProgressFunc    // Set on the copy extraction reads through
+	extracted   *atomic.Int64   // Likewise, the extraction's bytes so far, under MaxTotalSize
+	ctx         context.Context // Set on the copy GetBytesContext reads through
+	index       int             // Position in the archive, counting filtered entries
+	implied     bool            // Directory made up by WithImpliedDirs; index is the entry under it
+	archive     *ArchiveInfo
+}
+
+func (fs *ArchivedFile) Path() string            { return fs.archivefile }
+func (fs *ArchivedFile) Name() string            { return fs.name }
+func (fs *ArchivedFile) Size() int64             { return fs.size }
+func (fs *ArchivedFile) Mode() fs.FileMode       { return fs.mode }
+func (fs *ArchivedFile) ModTime() time.Time      { return fs.modTime }
+func (fs *ArchivedFile) AccessTime() time.Time   { return fs.accessTime }
+func (fs *ArchivedFile) CreationTime() time.Time { return fs.createTime }
+func (fs *ArchivedFile) ChangeTime() time.Time   { return fs.changeTime }
+func (fs *ArchivedFile) Method() string          { return fs.method }
+func (fs *ArchivedFile) Encrypted() bool         { return fs.encrypted }
+func (fs *ArchivedFile) Sys() any                { return 0 }
+
+// The major and minor numbers of a tar character or block device entry,
+// which Mode marks with fs.ModeDevice.  Zero for anything else.
+func (fs *ArchivedFile) Device() (major, minor int64) { return fs.devMajor, fs.devMinor }
+
+// The entry's tar PAX extended header records, with those of any
+// pax_global_header before it: long names, high-resolution times, xattrs
+// ("SCHILY.xattr.*", "LIBARCHIVE.xattr.*") and the like.  The fields they
+// stand for are already applied to Name, ModTime and the rest.  nil for
+// entries without any, and for other formats.
+func (fs *ArchivedFile) PAXRecords() map[string]string { return maps.Clone(fs.pax) }
+
+func (fs *ArchivedFile) IsSymlink() bool  { return fs.mode&os.ModeSymlink != 0 }
+func (fs *ArchivedFile) IsHardlink() bool { return fs.hardlink }
+
+// The target of a symlink or tar hardlink entry; "" for anything else.  A
+// hardlink's target is another entry's name.  tar records targets in the
+// header; zip, 7z and RAR keep a symlink's target as its content, which
+// this reads, giving "" if that fails.
+func (fs *ArchivedFile) Linkname() string {
+	target, _ := fs.linkTarget()
+	return target
+}
+
+// The bytes the entry's data takes up in the archive, or -1 where that
+// isn't known: entries of a compressed tar or a solid 7z block share one
+// stream.  Encryption overhead counts.  A single-file gzip's or sparse
+// image's entry is the whole archive.
+func (fs *ArchivedFile) CompressedSize() int64 { return fs.packed }
+
+// The CRC-32 (IEEE) the archive stores for the entry's content, and
+// whether it stores one: zip entries other than WinZip AE-2 do, as do 7z
+// entries that carry a digest.  GetBytes and Verify check it.
+func (fs *ArchivedFile) CRC32() (crc uint32, ok bool) { return fs.crc, fs.hasCRC }
+
+// How many times smaller the entry is packed than its content: Size over
+// CompressedSize, so 4 means a quarter of the size.  0 where either size
+// is unknown or the entry is empty.
+func (fs *ArchivedFile) CompressionRatio() float64 {
+	if fs.packed <= 0 || fs.size <= 0 {
+		return 0
+	}
+	return float64(fs.size) / float64(fs.packed)
 }
 
-func (fs *ArchivedFile) Path() string       { return fs.archivefile }
-func (fs *ArchivedFile) Name() string       { return fs.name }
-func (fs *ArchivedFile) Size() int64        { return fs.size }
-func (fs *ArchivedFile) Mode() fs.FileMode  { return fs.mode }
-func (fs *ArchivedFile) ModTime() time.Time { return fs.modTime }
-func (fs *ArchivedFile) Sys() any           { return 0 }
+func GetArchiveInfo(path string, opts ...Option) (ar *ArchiveInfo, err error) {
+	return GetArchiveInfoContext(context.Background(), path, opts...)
+}
 
-func GetArchiveInfo(path string) (ar *ArchiveInfo, err error) {
+// GetArchiveInfo that gives up with ctx.Err() once ctx is done, for
+// listing huge archives inside a request handler.  Cancellation is noticed
+// on every read of the archive.  ctx only covers the listing, which under
+// WithLazyListing is Entries'; see ArchivedFile.GetBytesContext for reads.
+func GetArchiveInfoContext(ctx context.Context, path string, opts ...Option) (ar *ArchiveInfo, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
 	var arinstance ArchiveInfo
 	ar = &arinstance
+	ar.opts = buildOptions(opts)
 	if strings.Contains(path, string(os.PathSeparator)) { // Replace CWD with specified.
 		pathName := filepath.Dir(path)
 		if len(pathName) == 0 {
@@ -91,83 +230,184 @@ func GetArchiveInfo(path string) (ar *ArchiveInfo, err error) {
 	}
 	// Verify there's a file there.
 	ar.fullname = filepath.Join(ar.path, ar.name)
-	fs, err := os.Stat(ar.fullname)
-	if err == nil {
+	var fs os.FileInfo
+	if volumes := findVolumes(ar.fullname); volumes != nil {
+		err = ar.openVolumes(volumes)
+	} else if fs, err = os.Stat(ar.fullname); err == nil {
 		ar.size = fs.Size()
-		err = ar.getArchiveType()
 	}
 	if err == nil {
-		switch ar.ArchiveType {
-		case ARCHIVE_7Z:
-			err = ar.loadFilesIn7ZArchive()
-		case ARCHIVE_TGZ:
-			err = ar.loadFilesInTgzArchive()
-		case ARCHIVE_ZIP:
-			err = ar.loadFilesInZipArchive()
-		}
+		ar.ctx = ctx
+		err = ar.load()
+		ar.ctx = nil
+	}
+	if ar.opts.lazyListing {
+		ar.lazyCtx = ctx
 	}
 	return ar, err
 }
 
-// This will reset ai.ArchiveType.  Determined type by magic header bytes, not extension
-func (ar *ArchiveInfo) getArchiveType() error {
-	if ar.size < 5 {
-		ar.ArchiveType = ARCHIVE_NA
+// Detect the type and list the entries, whatever the source.
+func (ar *ArchiveInfo) load() error {
+	if ar.opts.progress != nil {
+		ar.listed = new(atomic.Int64)
+		defer func() { ar.listed = nil }()
+	}
+	err := ar.getArchiveType()
+	if err != nil || ar.opts.lazyListing {
+		return err
+	}
+	err = ar.listFiles()
+	if err == nil {
+		err = ar.checkArchiveLimits()
+	}
+	if err == nil && ar.opts.impliedDirs && (ar.ArchiveType == ARCHIVE_ZIP || isTarType(ar.ArchiveType)) {
+		ar.addImpliedDirs()
+	}
+	if err == nil && ar.opts.sortedListing {
+		slices.SortStableFunc(ar.files, func(a, b ArchivedFile) int { return strings.Compare(a.name, b.name) })
+	}
+	if err == nil && ar.opts.validateOnOpen {
+		err = ar.validate()
+	}
+	if err == nil && ar.opts.packageContents && ar.ArchiveType == ARCHIVE_AR {
+		err = ar.loadPackageContents()
+	}
+	if err == nil && ar.opts.nested > 0 {
+		err = ar.loadNested()
+	}
+	return err
+}
+
+// Read the entries' headers into the listing, or into visit under Entries.
+func (ar *ArchiveInfo) listFiles() error {
+	switch ar.ArchiveType {
+	case ARCHIVE_7Z:
+		return ar.loadFilesIn7ZArchive()
+	case ARCHIVE_TGZ, ARCHIVE_TAR, ARCHIVE_TBZ2, ARCHIVE_TXZ, ARCHIVE_TZST, ARCHIVE_TBR, ARCHIVE_TLZ4,
+		ARCHIVE_TZ, ARCHIVE_TLZ:
+		return ar.loadFilesInTarArchive()
+	case ARCHIVE_ZIP:
+		return ar.loadFilesInZipArchive()
+	case ARCHIVE_RAR:
+		return ar.loadFilesInRarArchive()
+	}
+	if h := optionalFormat(ar.ArchiveType); h != nil {
+		return h.load(ar)
+	}
+	return fmt.Errorf("%s: %w", ar.fullname, ErrNotAnArchive)
+}
+
+// Problems stepped over while reading the archive, oldest first.  Empty
+// unless WithBestEffort was given.
+func (ai *ArchiveInfo) Warnings() []error { return ai.warnings }
+
+// Record a warning, and pass it on to the WithWarnings channel if there's room.
+func (ar *ArchiveInfo) warn(err error) {
+	ar.warnings = append(ar.warnings, err)
+	if ar.opts.warnings != nil {
+		select {
+		case ar.opts.warnings <- err:
+		default:
+		}
+	}
+}
+
+// Add an entry to the listing, unless the options filter it out.  Names
+// are kept exactly as stored, trailing spaces included, so File() needs the
+// stored name.  Entries naming the root itself ("/", ".", "./") are listed
+// as directories whatever they claim to be, and extraction skips them.
+// Fails if the entry breaks WithLimits.
+func (ar *ArchiveInfo) addFile(af ArchivedFile) error {
+	if ar.opts.skipAppleMetadata && IsAppleMetadata(af.name) {
 		return nil
 	}
-	filebytes := make([]byte, 5)
-	file, err := os.Open(ar.fullname)
-	if err != nil {
+	if isRootName(af.name) {
+		af.IsDir, af.mode = true, fs.ModeDir|0o755
+	}
+	// A directory has no content, whatever size its header claims.
+	if af.isDir() {
+		af.size = 0
+	}
+	if err := ar.checkEntryLimits(&af); err != nil {
 		return err
 	}
-	defer file.Close()
-	_, err = file.Read(filebytes)
+	if !af.isDir() {
+		ar.unpacked += max(af.size, 0)
+	}
+	af.archive = ar
+	if ar.visit != nil {
+		if !ar.visit(af) {
+			return errStopListing
+		}
+		return nil
+	}
+	ar.files = append(ar.files, af)
+	ar.listProgress(&af)
+	return nil
+}
 
+// This will reset ai.ArchiveType.  Determined type by magic header bytes, not extension
+func (ar *ArchiveInfo) getArchiveType() error {
+	filebytes := make([]byte, min(ar.size, int64(headerLength())))
+	src, err := ar.openSource()
 	if err != nil {
 		return err
 	}
-	switch {
-	case (filebytes[0] == 0x50) && (filebytes[1] == 0x4B) && (filebytes[2] == 0x03) && (filebytes[3] == 0x04):
-		ar.ArchiveType = ARCHIVE_ZIP
-	case (filebytes[0] == 0x37) && (filebytes[1] == 0x7A) && (filebytes[2] == 0xBC) && (filebytes[3] == 0xAF):
-		ar.ArchiveType = ARCHIVE_7Z
-	case (filebytes[0] == 0x1F) && (filebytes[1] == 0x8B):
-		ar.ArchiveType = ARCHIVE_TGZ
-	default:
-		ar.ArchiveType = ARCHIVE_NA
+	defer src.Close()
+	if n, err := src.ReadAt(filebytes, 0); n < len(filebytes) {
+		return err
+	}
+	switch ar.ArchiveType = DetectType(filebytes); {
+	case isUDIF(src, src.size):
+		// The trailer is surer than whatever the first chunk looks like.
+		ar.ArchiveType = ARCHIVE_DMG
+	case ar.ArchiveType == ARCHIVE_NA && isDiscImage(src, src.size):
+		ar.ArchiveType = ARCHIVE_ISO
+	case ar.ArchiveType == ARCHIVE_NA:
+		ar.ArchiveType = claimedStreamType(ar.name)
 	}
 	return nil
 }
 
 func (af *ArchivedFile) extractZipFileBytes() ([]byte, error) {
 	var buffer = make([]byte, af.size)
-	zipReader, err := zip.OpenReader(af.archivefile)
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	defer src.Close()
+	zipReader, err := newZipReader(src)
 	if err != nil {
-		err2 := fmt.Errorf("Could not open %s.  %w", af.archivefile, err) //lint:ignore ST1005 Casing is good
-		return nil, err2
+		return nil, openError(af.archivefile, err)
 	}
-	defer zipReader.Close()
 
 	for _, fileInZip := range zipReader.File {
-		if fileInZip.Name != af.name {
+		if zipName(fileInZip, af.options().nameEncoding) != af.name {
 			continue
 		}
-		readCloser, err := fileInZip.Open()
+		readCloser, err := openZipFile(fileInZip, af.options().password)
 		if err != nil {
 			return nil, err
 		}
 		defer readCloser.Close()
-		readCloser.Read(buffer)
-		break
+		return buffer, readEntry(af.wrapReader(readCloser), af.name, buffer)
 	}
-	return buffer, err
+	return nil, fmt.Errorf("%s: %w", af.name, fs.ErrNotExist)
 }
 
 func (af *ArchivedFile) extract7ZFileBytes() ([]byte, error) {
-	zipReader, err := sevenzip.OpenReader(af.archivefile)
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	defer src.Close()
+	zipReader, err := sevenzip.NewReaderWithPassword(src, src.size, af.options().password)
 	if err != nil {
-		err2 := fmt.Errorf("Could not open %s.  %w", af.archivefile, err) //lint:ignore ST1005 Casing is good
-		return nil, err2
+		return nil, openError(af.archivefile, err)
+	}
+	if codec := unsupported7zCodec(af.method); af.method != "" && codec != "" {
+		return nil, fmt.Errorf("%s: %w: 7z codec %s", af.name, ErrUnsupportedFormat, codec)
 	}
 	var buffer = make([]byte, af.size)
 
@@ -177,32 +417,33 @@ func (af *ArchivedFile) extract7ZFileBytes() ([]byte, error) {
 		}
 		readCloser, err := fileInZip.Open()
 		if err != nil {
-			return nil, err
+			return nil, af.passwordError(err)
 		}
 		defer readCloser.Close()
-		readCloser.Read(buffer)
-		break
+		// A wrong key decrypts to garbage that only the CRC at the end is
+		// sure to catch, and readEntry reads up to it.
+		return buffer, readEntry(af.wrapReader(&passwordErrReader{af, readCloser}), af.name, buffer)
 	}
-	return buffer, err
+	return nil, fmt.Errorf("%s: %w", af.name, fs.ErrNotExist)
 }
 
-func (af *ArchivedFile) extractTgzFileBytes() ([]byte, error) {
-	var gzReader *gzip.Reader
-	var tarReader *tar.Reader
+func (af *ArchivedFile) extractTarFileBytes() ([]byte, error) {
+	var content io.Reader
+	var closer io.Closer
+	var tarReader *tarWalker
 	var buffer = make([]byte, af.size)
 
-	file, err := os.Open(af.archivefile)
+	src, err := af.openSource()
 	if err == nil {
-		defer file.Close()
-		gzReader, err = gzip.NewReader(file)
+		defer src.Close()
+		content, closer, err = tarStream(af.archivetype, src.stream())
 	}
 	if err == nil {
-		defer gzReader.Close()
-		tarReader = tar.NewReader(gzReader)
+		defer closer.Close()
+		tarReader = newTarWalker(content, af.options().bestEffort, nil)
 	}
 	if err != nil {
-		err2 := fmt.Errorf("Could not open %s.  %w", af.archivefile, err) //lint:ignore ST1005 Casing is good
-		return nil, err2
+		return nil, openError(af.archivefile, err)
 	}
 
 	// Locate file
@@ -214,85 +455,220 @@ func (af *ArchivedFile) extractTgzFileBytes() ([]byte, error) {
 		}
 		break
 	}
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: %w", af.name, fs.ErrNotExist)
+	}
 	// Pseudo-Seek done.  Uggah.  Read data
-	tarReader.Read(buffer)
+	if err == nil {
+		err = readEntry(af.wrapReader(tarReader), af.name, buffer)
+	}
 	return buffer, err
 }
 
 // To Do - Verify this gets directory-embedded files in the zip also
 func (ar *ArchiveInfo) loadFilesInZipArchive() error {
-	zipReader, err := zip.OpenReader(ar.fullname)
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	zipReader, err := newZipReader(src)
 	if err != nil {
-		err2 := fmt.Errorf("Could not open %s.  %w", ar.fullname, err) //lint:ignore ST1005 Casing is good
-		return err2
+		return openError(ar.fullname, err)
 	}
-	defer zipReader.Close()
 
-	for _, fileInZip := range zipReader.File {
-		var arFile ArchivedFile = ArchivedFile{ar.fullname, ARCHIVE_ZIP, fileInZip.Name, int64(fileInZip.UncompressedSize64),
-			fileInZip.FileInfo().IsDir(), fileInZip.Mode(), fileInZip.ModTime()}
-		ar.files = append(ar.files, arFile)
+	for i, fileInZip := range zipReader.File {
+		// Modified already prefers the extended/NTFS timestamps over DOS time.
+		var arFile ArchivedFile = ArchivedFile{archivefile: ar.fullname, archivetype: ARCHIVE_ZIP, name: zipName(fileInZip, ar.opts.nameEncoding),
+			size: int64(fileInZip.UncompressedSize64), IsDir: fileInZip.FileInfo().IsDir(), mode: fileInZip.Mode(),
+			modTime: fileInZip.Modified, encrypted: fileInZip.Flags&0x1 != 0, method: zipMethodName(fileInZip),
+			packed: int64(fileInZip.CompressedSize64), crc: fileInZip.CRC32, hasCRC: zipHasCRC(fileInZip),
+			zip64: hasZip64Extra(fileInZip.Extra), index: i}
+		if _, atime, ctime, ok := parseNTFSExtra(fileInZip.Extra); ok {
+			arFile.accessTime, arFile.createTime = atime, ctime
+		} else if _, atime, ctime, ok := parseExtTimeExtra(fileInZip.Extra); ok {
+			// The central record only flags what the local one holds.
+			if (atime.IsZero() || ctime.IsZero()) && hasExtTimeFlags(fileInZip.Extra, 0x6) {
+				_, atime, ctime, _ = parseExtTimeExtra(readZipLocalExtra(src, fileInZip))
+			}
+			arFile.accessTime, arFile.changeTime = atime, ctime
+		}
+		if err = ar.addFile(arFile); err != nil {
+			return err
+		}
 	}
 	return err
 }
 
 func (ar *ArchiveInfo) loadFilesIn7ZArchive() error {
-	zipReader, err := sevenzip.OpenReader(ar.fullname)
+	src, err := ar.openSource()
 	if err != nil {
-		//lint:ignore ST1005 Casing is good
-		err2 := fmt.Errorf("Could not open %s.  %w", ar.fullname, err)
-		return err2
+		return openError(ar.fullname, err)
 	}
-	defer zipReader.Close()
-
+	defer src.Close()
+	// Codec details are a nicety; an archive we can't parse them from still lists.
+	header, headerErr := readSevenZipHeader(src, src.size)
+	zipReader, err := sevenzip.NewReaderWithPassword(src, src.size, ar.opts.password)
+	if err != nil {
+		if headerErr == nil && header.headerEncrypted {
+			if ar.opts.password == "" {
+				return fmt.Errorf("%s: %w", ar.fullname, ErrEncrypted)
+			}
+			return fmt.Errorf("%s: %w: %w", ar.fullname, ErrWrongPassword, err)
+		}
+		return openError(ar.fullname, err)
+	}
+	var folders []szFolderInfo
+	if headerErr == nil {
+		folders = header.folders
+	}
+	// Files per folder: a folder's packed size is only one file's if it's
+	// not solid.
+	folderFiles := make(map[int]int)
 	for _, fileInZip := range zipReader.File {
-		var arFile ArchivedFile = ArchivedFile{ar.fullname, ARCHIVE_7Z, fileInZip.Name, int64(fileInZip.FileInfo().Size()),
-			fileInZip.FileInfo().IsDir(), fileInZip.Mode(), fileInZip.Modified}
-		ar.files = append(ar.files, arFile)
+		if fileInZip.FileInfo().Size() > 0 {
+			folderFiles[fileInZip.Stream]++
+		}
+	}
+
+	for i, fileInZip := range zipReader.File {
+		var arFile ArchivedFile = ArchivedFile{archivefile: ar.fullname, archivetype: ARCHIVE_7Z, name: fileInZip.Name,
+			size: int64(fileInZip.FileInfo().Size()), IsDir: fileInZip.FileInfo().IsDir(), mode: fileInZip.Mode(),
+			modTime: fileInZip.Modified, accessTime: fileInZip.Accessed, createTime: fileInZip.Created, packed: -1,
+			crc: fileInZip.CRC32, hasCRC: fileInZip.CRC32 != 0 || fileInZip.UncompressedSize == 0, stream: fileInZip.Stream, index: i}
+		// Empty files and directories have no stream.
+		if arFile.size == 0 {
+			arFile.packed, arFile.stream = 0, -1
+		} else if fileInZip.Stream < len(folders) {
+			arFile.method = folders[fileInZip.Stream].method()
+			if folderFiles[fileInZip.Stream] == 1 {
+				arFile.packed = folders[fileInZip.Stream].packedSize
+			}
+		}
+		// An encrypted header hides the coders; take it that the files are
+		// encrypted too, as 7-Zip's -mhe always does.
+		arFile.encrypted = arFile.size > 0 &&
+			(strings.Contains("+"+arFile.method+"+", "+7zAES+") || headerErr == nil && header.headerEncrypted)
+		if err = ar.addFile(arFile); err != nil {
+			return err
+		}
 	}
 	return err
 }
 
-func (ar *ArchiveInfo) loadFilesInTgzArchive() error {
-	var gzReader *gzip.Reader
-	var tarReader *tar.Reader
+// List the entries of a tar stream, of whichever compression.
+func (ar *ArchiveInfo) listTar(content io.Reader) error {
+	tarReader := newTarWalker(content, ar.opts.bestEffort, func(offset int64, err error) {
+		ar.warn(&EntryError{Archive: ar.fullname, Offset: offset, Err: fmt.Errorf("%w: %w", ErrCorruptArchive, err)})
+	})
+	head, err := tarReader.Next()
+	for i := 0; head != nil && err == nil; i++ {
+		if err = ar.addFile(ar.tarEntry(head, i)); err != nil {
+			return err
+		}
 
-	file, err := os.Open(ar.fullname)
-	if err == nil {
-		defer file.Close()
-		gzReader, err = gzip.NewReader(file)
+		head, err = tarReader.Next()
 	}
-	if err == nil {
-		defer gzReader.Close()
-		tarReader = tar.NewReader(gzReader)
+	if err == io.EOF && ar.opts.validateOnOpen && ar.visit == nil {
+		return ar.validateTarEnd(tarReader)
 	}
-	if err != nil {
-		//lint:ignore ST1005 Casing is good
-		err2 := fmt.Errorf("Could not open %s.  %w", ar.fullname, err)
-		return err2
+	if err == io.EOF {
+		return nil
+	}
+	if ar.opts.bestEffort {
+		// Keep what listed; the rest of the stream is unreadable.
+		ar.warn(&EntryError{Archive: ar.fullname, Offset: tarReader.src.n, Err: fmt.Errorf("%w: %w", ErrCorruptArchive, err)})
+		return nil
 	}
+	return openError(ar.fullname, err)
+}
 
-	head, err := tarReader.Next()
-	for head != nil && err == nil {
-		var arFile ArchivedFile = ArchivedFile{ar.fullname, ARCHIVE_TGZ, head.Name, head.Size, false, head.FileInfo().Mode(), head.ModTime}
-		ar.files = append(ar.files, arFile)
+// The listing entry for the index-th tar header.
+func (ar *ArchiveInfo) tarEntry(head *tar.Header, index int) ArchivedFile {
+	af := ArchivedFile{archivefile: ar.fullname, archivetype: ar.ArchiveType, name: head.Name,
+		size: head.Size, mode: head.FileInfo().Mode(), modTime: head.ModTime,
+		accessTime: head.AccessTime, changeTime: head.ChangeTime, linkname: head.Linkname,
+		hardlink: head.Typeflag == tar.TypeLink, devMajor: head.Devmajor, devMinor: head.Devminor,
+		method: tarMethods[ar.ArchiveType], packed: -1, pax: head.PAXRecords, index: index}
+	if ar.ArchiveType == ARCHIVE_TAR {
+		af.packed = af.size
+	}
+	return af
+}
 
-		head, err = tarReader.Next()
+// Fill buffer from r, reporting a short entry as ErrSizeMismatch.
+func readFull(r io.Reader, name string, buffer []byte) error {
+	_, err := io.ReadFull(r, buffer)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%s: %w: %w", name, ErrSizeMismatch, err)
+	}
+	return err
+}
+
+// Read a whole entry of len(buffer) bytes, as readFull, then make sure r
+// ends there.  Data past the recorded size is ErrSizeMismatch too, and
+// reaching the end lets the decoders check their CRCs, which they only
+// do at EOF.
+func readEntry(r io.Reader, name string, buffer []byte) error {
+	if err := readFull(r, name, buffer); err != nil {
+		return err
+	}
+	n, err := io.ReadFull(r, make([]byte, 1))
+	if n > 0 {
+		return fmt.Errorf("%s: %w: more than %d bytes", name, ErrSizeMismatch, len(buffer))
 	}
 	if err == io.EOF {
 		return nil
 	}
-	return err
+	return fmt.Errorf("%s: %w", name, err)
+}
+
+// Sizes come from uint64 headers, so an overflow shows up as negative.
+func (af *ArchivedFile) checkSize() error {
+	if af.size < 0 || af.size > math.MaxInt {
+		return fmt.Errorf("%s: %w", af.name, ErrArchiveTooLarge)
+	}
+	return nil
 }
 
 func (af *ArchivedFile) GetBytes() ([]byte, error) {
+	if err := af.checkSize(); err != nil {
+		return nil, err
+	}
+	if af.implied || af.isDir() {
+		return []byte{}, nil
+	}
 	switch af.archivetype {
 	case ARCHIVE_7Z:
 		return af.extract7ZFileBytes()
-	case ARCHIVE_TGZ:
-		return af.extractTgzFileBytes()
+	case ARCHIVE_TGZ, ARCHIVE_TAR, ARCHIVE_TBZ2, ARCHIVE_TXZ, ARCHIVE_TZST, ARCHIVE_TBR, ARCHIVE_TLZ4,
+		ARCHIVE_TZ, ARCHIVE_TLZ:
+		return af.extractTarFileBytes()
 	case ARCHIVE_ZIP:
 		return af.extractZipFileBytes()
+	case ARCHIVE_GZ, ARCHIVE_BZ2, ARCHIVE_XZ, ARCHIVE_ZST, ARCHIVE_BR, ARCHIVE_LZ4, ARCHIVE_Z, ARCHIVE_LZ:
+		return af.extractCompressedFileBytes()
+	}
+	if af.archivetype == ARCHIVE_RAR || optionalFormat(af.archivetype) != nil {
+		readCloser, err := af.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer readCloser.Close()
+		var buffer = make([]byte, af.size)
+		return buffer, readEntry(readCloser, af.name, buffer)
+	}
+	return nil, fmt.Errorf("%s: %w", af.name, ErrUnsupportedFormat)
+}
+
+// GetBytes that gives up with ctx.Err() once ctx is done.  Cancellation is
+// noticed on every read of the archive, so it doesn't wait for a big entry
+// to finish decompressing.
+func (af *ArchivedFile) GetBytesContext(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	return nil, errors.New("unsupported archive type")
+	reader := *af
+	reader.ctx = ctx
+	return reader.GetBytes()
 }
@@ -2,6 +2,7 @@ package archiver
 
 import (
 	_ "embed"
+	"io/fs"
 	"strings"
 	"testing"
 )
@@ -17,9 +18,10 @@ func TestGetArchiveInfo(t *testing.T) {
 		targettext    string
 	}{{"7zip", "testassets/sz_test.7z", ARCHIVE_7Z, 3, "random_text.txt", "vulputate"},
 		{"zip", "testassets/test.zip", ARCHIVE_ZIP, 2, "dirhelp.txt", "subdirectories"},
-		// tgz include metadata in pseudo-files for each file, so double the file count.
+		// The tgz holds a macOS "._" AppleDouble file beside each file, so double the file count.
 		{"gzip", "testassets/tgz_test.tgz", ARCHIVE_TGZ, 4, "random_text.txt", "vulputate"},
 		{"word", "testassets/Test Doc.docx", ARCHIVE_ZIP, -1, "", "Jubjub"},
+		{"rar", "testassets/test.rar", ARCHIVE_RAR, 3, "docs/readme.txt", "Read me first"},
 	}
 
 	for _, test := range testdata {
@@ -68,3 +70,87 @@ func TestGetArchiveInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestDeviceEntries(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/devices.tgz")
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	testdata := []struct {
+		name         string
+		char         bool
+		major, minor int64
+	}{{"dev/null", true, 1, 3}, {"dev/loop0", false, 7, 0}}
+	for _, test := range testdata {
+		af := ar.File(test.name)
+		if af == nil || af.Mode()&fs.ModeDevice == 0 || (af.Mode()&fs.ModeCharDevice != 0) != test.char {
+			t.Fatalf("%s mode = %v", test.name, af.Mode())
+		}
+		if major, minor := af.Device(); major != test.major || minor != test.minor {
+			t.Errorf("%s Device() = %d, %d, want %d, %d", test.name, major, minor, test.major, test.minor)
+		}
+	}
+	if major, minor := ar.File("dev/README").Device(); major != 0 || minor != 0 {
+		t.Errorf("regular file Device() = %d, %d", major, minor)
+	}
+
+	// Without CreateDevices only the regular file comes out.
+	dir := t.TempDir()
+	if err = ar.ExtractSubtree("", dir); err != nil {
+		t.Fatalf("ExtractSubtree() error = %v", err)
+	}
+	if got := listTree(t, dir); len(got) != 1 || got[0] != "dev/README" {
+		t.Errorf("extracted %v", got)
+	}
+}
+
+func TestCompressedSize(t *testing.T) {
+	testdata := []struct {
+		filename string
+		name     string
+		method   string
+		packed   int64 // 0 for "known and smaller than the content"
+	}{{"testassets/methods.zip", "bzip2.txt", "BZip2", 103},
+		{"testassets/methods.zip", "zstd.txt", "ZStandard", 66},
+		{"testassets/methods.zip", "deflate.txt", "Deflate", 48},
+		{"testassets/methods.zip", "unknown.txt", "method 97", 328},
+		{"testassets/aes.zip", "secret.txt", "Deflate", 79},
+		{"testassets/aes.zip", "public.txt", "Store", 21},
+		{"testassets/codecs.7z", "lzma2.txt", "LZMA2", 0},
+		{"testassets/tgz_test.tgz", "random_text.txt", "Deflate", -1},
+		{"testassets/test.tar.xz", "pkg/manifest.json", "LZMA2", -1},
+	}
+	for _, test := range testdata {
+		ar, err := GetArchiveInfo(test.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		af := ar.File(test.name)
+		if af == nil {
+			t.Fatalf("%s: no %s", test.filename, test.name)
+		}
+		if af.Method() != test.method {
+			t.Errorf("%s Method() = %q, want %q", test.name, af.Method(), test.method)
+		}
+		packed, ratio := af.CompressedSize(), af.CompressionRatio()
+		switch {
+		case test.packed == 0 && (packed <= 0 || packed >= af.Size() || ratio <= 1):
+			t.Errorf("%s CompressedSize() = %d, ratio %g, for %d bytes", test.name, packed, ratio, af.Size())
+		case test.packed != 0 && packed != test.packed:
+			t.Errorf("%s CompressedSize() = %d, want %d", test.name, packed, test.packed)
+		case test.packed == -1 && ratio != 0:
+			t.Errorf("%s CompressionRatio() = %g with no compressed size", test.name, ratio)
+		}
+	}
+
+	// Plain tar stores entries as they are.
+	ar, err := GetArchiveInfo("testassets/test.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, af := range ar.Files() {
+		if af.CompressedSize() != af.Size() || af.Method() != "Store" {
+			t.Errorf("tar %s: CompressedSize() = %d, Size() = %d, Method() = %q", af.Name(), af.CompressedSize(), af.Size(), af.Method())
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// ArchiveWriter writes a zip or tar archive to a stream an entry at a
+// time, so one can be sent as it's made, say as an HTTP response, without
+// a temporary file.  Entries are written as CreateZip and CreateTarGz write
+// them.  After an error the archive is incomplete and should be discarded.
+type ArchiveWriter struct {
+	co createOptions
+	zw *zip.Writer
+	tw *tar.Writer
+	tc io.WriteCloser // Compresses the tar; nil for a plain one
+}
+
+// Start an archive of type archiveType, written to w: ARCHIVE_ZIP,
+// ARCHIVE_TAR, or a tar compressed as for Convert, such as ARCHIVE_TGZ.  Of
+// the CreateOptions WithCompressionLevel, WithCompression and Reproducible
+// apply; entries are written in the order they're added.
+func NewArchiveWriter(w io.Writer, archiveType ArchiveType, opts ...CreateOption) (*ArchiveWriter, error) {
+	co, err := buildCreateOptions(opts)
+	if err == nil {
+		err = co.unencrypted("archive writer")
+	}
+	if err != nil {
+		return nil, err
+	}
+	aw := &ArchiveWriter{co: co}
+	switch compress := tarCompressors[archiveType]; {
+	case archiveType == ARCHIVE_ZIP:
+		aw.zw = newZipWriter(w, co.level)
+	case archiveType == ARCHIVE_TAR:
+		aw.tw = tar.NewWriter(w)
+	case compress != nil:
+		if aw.tc, err = compress(w, co); err != nil {
+			return nil, err
+		}
+		aw.tw = tar.NewWriter(aw.tc)
+	default:
+		return nil, fmt.Errorf("%w: can't stream archive type %d", ErrUnsupportedFormat, archiveType)
+	}
+	return aw, nil
+}
+
+// Add an entry called name, a slash-separated path, with the mode and
+// modification time fi gives, and content r reads.  r is read to the end
+// for a file, and for a symlink gives its target; it's not used for a
+// directory.  A tar records a file's size before its content, so there r
+// must read exactly fi.Size() bytes, or AddFile fails with
+// ErrSizeMismatch.  Other kinds of file are refused.
+func (aw *ArchiveWriter) AddFile(name string, fi fs.FileInfo, r io.Reader) error {
+	name = strings.TrimSuffix(name, "/")
+	if !fs.ValidPath(name) || name == "." {
+		return fmt.Errorf("%s: %w", name, fs.ErrInvalid)
+	}
+	mode := fi.Mode()
+	if !mode.IsRegular() && !mode.IsDir() && mode&fs.ModeSymlink == 0 {
+		return fmt.Errorf("%s: %w: can't add mode %v", name, ErrUnsupportedFormat, mode.Type())
+	}
+	if aw.zw != nil {
+		head, err := zipHeader(name, fi, aw.co)
+		if err != nil {
+			return err
+		}
+		w, err := aw.zw.CreateHeader(head)
+		if err != nil || mode.IsDir() {
+			return err
+		}
+		_, err = io.Copy(w, r)
+		return err
+	}
+
+	var link string
+	if mode&fs.ModeSymlink != 0 {
+		target, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		link = string(target)
+	}
+	head, err := tarHeader(name, fi, link, aw.co)
+	if err != nil {
+		return err
+	}
+	if err = aw.tw.WriteHeader(head); err != nil || !mode.IsRegular() {
+		return err
+	}
+	switch n, err := io.Copy(aw.tw, r); {
+	case errors.Is(err, tar.ErrWriteTooLong):
+		return fmt.Errorf("%s: %w: more than the %d bytes fi gives", name, ErrSizeMismatch, head.Size)
+	case err == nil && n != head.Size:
+		return fmt.Errorf("%s: %w: %d of the %d bytes fi gives", name, ErrSizeMismatch, n, head.Size)
+	default:
+		return err
+	}
+}
+
+// Add a symlink called name pointing at target, modified at modTime, as
+// AddFile adds one from an fs.FileInfo.  A tar stores the target in the
+// header, a zip as the entry's content with the Unix symlink mode bits,
+// which is how Info-ZIP and the Extract methods read it back.  Every format
+// NewArchiveWriter takes can store symlinks; those that can't are refused
+// there with ErrUnsupportedFormat.  An empty target is fs.ErrInvalid.
+func (aw *ArchiveWriter) AddSymlink(name, target string, modTime time.Time) error {
+	if target == "" {
+		return fmt.Errorf("%s: %w: empty symlink target", name, fs.ErrInvalid)
+	}
+	return aw.AddFile(name, symlinkInfo{path.Base(name), target, modTime}, strings.NewReader(target))
+}
+
+// The fs.FileInfo AddSymlink passes to AddFile.
+type symlinkInfo struct {
+	name, target string
+	mtime        time.Time
+}
+
+func (si symlinkInfo) Name() string       { return si.name }
+func (si symlinkInfo) Size() int64        { return int64(len(si.target)) }
+func (si symlinkInfo) Mode() fs.FileMode  { return fs.ModeSymlink | 0o777 }
+func (si symlinkInfo) ModTime() time.Time { return si.mtime }
+func (si symlinkInfo) IsDir() bool        { return false }
+func (si symlinkInfo) Sys() any           { return nil }
+
+// Finish the archive, writing the zip's central directory or the tar's
+// end and flushing any compression.  The io.Writer isn't closed.
+func (aw *ArchiveWriter) Close() error {
+	if aw.zw != nil {
+		return aw.zw.Close()
+	}
+	err := aw.tw.Close()
+	if aw.tc != nil {
+		err = errors.Join(err, aw.tc.Close())
+	}
+	return err
+}
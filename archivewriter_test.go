@@ -0,0 +1,147 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// An fs.FileInfo for AddFile.
+type entryInfo struct {
+	name  string
+	data  string
+	mode  fs.FileMode
+	mtime time.Time
+}
+
+func (ei entryInfo) Name() string       { return path.Base(ei.name) }
+func (ei entryInfo) Size() int64        { return int64(len(ei.data)) }
+func (ei entryInfo) Mode() fs.FileMode  { return ei.mode }
+func (ei entryInfo) ModTime() time.Time { return ei.mtime }
+func (ei entryInfo) IsDir() bool        { return ei.mode.IsDir() }
+func (ei entryInfo) Sys() any           { return nil }
+
+func TestArchiveWriter(t *testing.T) {
+	stamp := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	entries := []entryInfo{
+		{"docs", "", fs.ModeDir | 0o755, stamp},
+		{"docs/a.txt", "alpha\n", 0o644, stamp},
+		{"docs/latest", "a.txt", fs.ModeSymlink | 0o777, stamp},
+		{"docs/empty.md", "", 0o600, stamp},
+		{"bin/run", "#!/bin/sh\n", 0o755, stamp},
+	}
+
+	for _, archiveType := range []ArchiveType{ARCHIVE_ZIP, ARCHIVE_TAR, ARCHIVE_TGZ, ARCHIVE_TZST} {
+		var buf bytes.Buffer
+		aw, err := NewArchiveWriter(&buf, archiveType, WithCompressionLevel(9))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ei := range entries {
+			if err := aw.AddFile(ei.name, ei, strings.NewReader(ei.data)); err != nil {
+				t.Fatalf("type %d: %s: %v", archiveType, ei.name, err)
+			}
+		}
+		if err := aw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		ai, err := GetArchiveInfoFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ai.ArchiveType != archiveType || len(ai.Files()) != len(entries) {
+			t.Fatalf("type %d read back as %d with %q", archiveType, ai.ArchiveType, entryNames(ai))
+		}
+		for _, want := range entries {
+			af := ai.File(want.name)
+			if want.IsDir() {
+				af = ai.File(want.name + "/")
+			}
+			if af == nil || af.Mode() != want.mode || !af.ModTime().Equal(stamp) {
+				t.Errorf("type %d: %s is %+v", archiveType, want.name, af)
+				continue
+			}
+			if want.mode&fs.ModeSymlink != 0 {
+				if af.Linkname() != want.data {
+					t.Errorf("type %d: %s links to %q", archiveType, want.name, af.Linkname())
+				}
+			} else if data, err := af.GetBytes(); want.mode.IsRegular() && (err != nil || string(data) != want.data) {
+				t.Errorf("type %d: %s reads %q, %v", archiveType, want.name, data, err)
+			}
+		}
+	}
+
+	// A tar needs the size up front.
+	for _, c := range []struct {
+		name, content string
+		want          error
+	}{
+		{"short.txt", "al", ErrSizeMismatch},
+		{"long.txt", "alphabet soup\n", ErrSizeMismatch},
+		{"../escape", "alpha\n", fs.ErrInvalid},
+	} {
+		aw, err := NewArchiveWriter(&bytes.Buffer{}, ARCHIVE_TGZ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := aw.AddFile(c.name, entries[1], strings.NewReader(c.content)); !errors.Is(err, c.want) {
+			t.Errorf("%s: %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	for _, archiveType := range []ArchiveType{ARCHIVE_7Z, ARCHIVE_RAR} {
+		if _, err := NewArchiveWriter(&bytes.Buffer{}, archiveType); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("type %d: %v", archiveType, err)
+		}
+	}
+	if _, err := NewArchiveWriter(&bytes.Buffer{}, ARCHIVE_ZIP, WithEncryption("secret")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("zip with a password: %v", err)
+	}
+}
+
+func TestArchiveWriterAddSymlink(t *testing.T) {
+	stamp := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	for _, archiveType := range []ArchiveType{ARCHIVE_TGZ, ARCHIVE_ZIP} {
+		var buf bytes.Buffer
+		aw, err := NewArchiveWriter(&buf, archiveType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := entryInfo{"docs/a.txt", "alpha\n", 0o644, stamp}
+		if err := aw.AddFile(file.name, file, strings.NewReader(file.data)); err != nil {
+			t.Fatal(err)
+		}
+		if err := aw.AddSymlink("docs/latest", "a.txt", stamp); err != nil {
+			t.Fatal(err)
+		}
+		if err := aw.AddSymlink("docs/dangling", "", stamp); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("type %d: empty target: %v", archiveType, err)
+		}
+		if err := aw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		ai, err := GetArchiveInfoFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		link := ai.File("docs/latest")
+		if link == nil || !link.IsSymlink() || link.Linkname() != "a.txt" || !link.ModTime().Equal(stamp) {
+			t.Fatalf("type %d: docs/latest is %+v", archiveType, link)
+		}
+		dest := t.TempDir()
+		if err := ai.ExtractAll(dest, WithLinkPolicy(MaterializeLinks)); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := os.ReadFile(filepath.Join(dest, "docs/latest")); err != nil || string(data) != "alpha\n" {
+			t.Errorf("type %d: reading through the link: %q, %v", archiveType, data, err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// ARJ archives: a main header, then each entry a header and its data.
+// Every header starts with the same two-byte id and a size, and carries
+// a CRC-32 of itself.
+
+const (
+	arjMaxHeader  = 2600
+	arjHeaderBase = 30 // Fixed fields of a basic header, the least first_hdr_size gives
+)
+
+// Basic header flags and file types.
+const (
+	arjGarbled   = 0x01
+	arjExtFile   = 0x08 // Continued from the previous volume
+	arjMain      = 2
+	arjDirectory = 3
+	arjHostUnix  = 2
+	arjFastest   = 4 // Method 4, its own simpler coding
+)
+
+var arjMethods = []string{"Store", "ARJ-1", "ARJ-2", "ARJ-3", "ARJ-4"}
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_ARJ,
+		detect:      isArj,
+		load:        func(ar *ArchiveInfo) error { return loadWalked(ar, ARCHIVE_ARJ, walkArj) },
+		open:        func(af *ArchivedFile) (io.ReadCloser, error) { return openWalked(af, walkArj) },
+		each: func(ai *ArchiveInfo, fn func(*ArchivedFile, io.Reader) error) error {
+			return forEachWalked(ai, walkArj, fn)
+		},
+	})
+}
+
+// The id, then a main header: two bytes aren't much of a magic alone.
+func isArj(header []byte) bool {
+	return len(header) >= 4+arjHeaderBase && header[0] == 0x60 && header[1] == 0xEA &&
+		binary.LittleEndian.Uint16(header[2:]) <= arjMaxHeader && header[4+6] == arjMain
+}
+
+// An entry's header, past the main header.
+type arjEntry struct {
+	af     ArchivedFile
+	method byte
+	dataAt int64
+	crc    uint32
+}
+
+// Walk the headers from the start, handing each entry to fn.
+func walkArj(src source, enc encoding.Encoding, fn walkFunc) error {
+	_, offset, err := readArjHeader(src, 0, enc)
+	if err != nil {
+		return err
+	}
+	for i := 0; offset < src.size; i++ {
+		e, next, err := readArjHeader(src, offset, enc)
+		if err != nil || e == nil {
+			return err
+		}
+		e.af.index = i
+		if err := fn(&e.af, func() (io.Reader, error) { return e.reader(src) }); err != nil {
+			return err
+		}
+		offset = next
+	}
+	return nil
+}
+
+// The header at offset, and where the next one starts; a nil entry at the
+// end marker.
+func readArjHeader(src source, offset int64, enc encoding.Encoding) (*arjEntry, int64, error) {
+	id := make([]byte, 4)
+	if _, err := src.ReadAt(id, offset); err != nil {
+		return nil, 0, fmt.Errorf("ARJ header at %d: %w", offset, noEOF(err))
+	}
+	le := binary.LittleEndian
+	size := int64(le.Uint16(id[2:]))
+	switch {
+	case id[0] != 0x60 || id[1] != 0xEA:
+		return nil, 0, fmt.Errorf("%w: no ARJ header at %d", ErrCorruptArchive, offset)
+	case size == 0:
+		return nil, 0, nil
+	case size > arjMaxHeader || size < arjHeaderBase:
+		return nil, 0, fmt.Errorf("%w: ARJ header at %d of %d bytes", ErrCorruptArchive, offset, size)
+	}
+	head := make([]byte, size+4)
+	if _, err := src.ReadAt(head, offset+4); err != nil {
+		return nil, 0, fmt.Errorf("ARJ header at %d: %w", offset, noEOF(err))
+	}
+	if crc32.ChecksumIEEE(head[:size]) != le.Uint32(head[size:]) {
+		return nil, 0, fmt.Errorf("%w: ARJ header at %d fails its CRC", ErrCorruptArchive, offset)
+	}
+	head = head[:size]
+	// Extended headers, each a size, its data and a CRC, until a size of
+	// zero.  None are defined that matter here.
+	next := offset + 4 + size + 4
+	for {
+		ext := make([]byte, 2)
+		if _, err := src.ReadAt(ext, next); err != nil {
+			return nil, 0, fmt.Errorf("ARJ header at %d: %w", offset, noEOF(err))
+		}
+		next += 2
+		n := int64(le.Uint16(ext))
+		if n == 0 {
+			break
+		}
+		next += n + 4
+	}
+	first := int(head[0])
+	if first > len(head) || first < arjHeaderBase {
+		return nil, 0, fmt.Errorf("%w: ARJ header at %d", ErrCorruptArchive, offset)
+	}
+	name, _, _ := bytes.Cut(head[first:], []byte{0})
+	e := &arjEntry{method: head[5], dataAt: next, crc: le.Uint32(head[20:])}
+	e.af.name = strings.TrimSuffix(strings.ReplaceAll(legacyName(string(name), enc, charmap.CodePage437), "\\", "/"), "/")
+	e.af.modTime = dosTime(le.Uint16(head[10:]), le.Uint16(head[8:]))
+	e.af.packed, e.af.size = int64(le.Uint32(head[12:])), int64(le.Uint32(head[16:]))
+	e.af.encrypted = head[4]&arjGarbled != 0
+	if int(e.method) < len(arjMethods) {
+		e.af.method = arjMethods[e.method]
+	} else {
+		e.af.method = fmt.Sprintf("ARJ-%d", e.method)
+	}
+	attr := uint32(le.Uint16(head[26:]))
+	switch {
+	case head[3] == arjHostUnix && attr != 0:
+		e.af.mode = unixFileMode(attr)
+	case head[6] == arjDirectory:
+		e.af.mode = 0o755
+	case attr&0x01 != 0: // DOS read-only
+		e.af.mode = 0o444
+	default:
+		e.af.mode = 0o644
+	}
+	if head[6] == arjDirectory {
+		e.af.IsDir, e.af.mode, e.af.size, e.af.packed = true, fs.ModeDir|e.af.mode.Perm(), 0, 0
+	}
+	if head[4]&arjExtFile != 0 {
+		return nil, 0, fmt.Errorf("%s: %w: continued from another volume", e.af.name, ErrUnsupportedFormat)
+	}
+	return e, next + max(e.af.packed, 0), nil
+}
+
+// The entry's content, checked against its CRC at the end.
+func (e *arjEntry) reader(src source) (io.Reader, error) {
+	if e.af.IsDir {
+		return bytes.NewReader(nil), nil
+	}
+	if e.af.encrypted {
+		return nil, fmt.Errorf("%s: %w", e.af.name, ErrEncrypted)
+	}
+	data := io.NewSectionReader(src, e.dataAt, e.af.packed)
+	var r io.Reader
+	switch {
+	case e.method == 0:
+		r = data
+	case e.method < arjFastest:
+		r = newLZHDecoder(data, 16, e.af.size)
+	case e.method == arjFastest:
+		r = &arjFastestDecoder{bits: msbBits{r: bufio.NewReader(data)}, left: e.af.size}
+	default:
+		return nil, fmt.Errorf("%s: %w: ARJ method %d", e.af.name, ErrUnsupportedFormat, e.method)
+	}
+	return &sumReader{r: r, update: func(sum uint32, p []byte) uint32 { return crc32.Update(sum, crc32.IEEETable, p) },
+		want: e.crc, name: e.af.name}, nil
+}
+
+// Method 4: LZSS without Huffman coding, lengths and distances in a
+// unary prefix of how many bits follow.
+type arjFastestDecoder struct {
+	bits     msbBits
+	window   [1 << 15]byte
+	pos      int
+	copyLeft int
+	copyFrom int
+	left     int64
+}
+
+func (d *arjFastestDecoder) Read(p []byte) (int, error) {
+	const mask = len(d.window) - 1
+	n := 0
+	for n < len(p) && d.left > 0 {
+		var b byte
+		if d.copyLeft == 0 {
+			if l := d.number(0, 7); l == 0 {
+				b = byte(d.bits.read(8))
+			} else {
+				d.copyLeft = l - 1 + lzhThreshold
+				d.copyFrom = d.pos - d.number(9, 13) - 1
+			}
+		}
+		if d.copyLeft > 0 {
+			b = d.window[d.copyFrom&mask]
+			d.copyFrom++
+			d.copyLeft--
+		}
+		d.window[d.pos&mask] = b
+		p[n] = b
+		n++
+		d.pos++
+		d.left--
+	}
+	if d.bits.err != nil {
+		return n, d.bits.err
+	}
+	if d.bits.past > lzhMaxPast {
+		return n, lzhCorrupt("stream runs past its data")
+	}
+	if n == 0 && d.left == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// A value as a unary count of set bits, from start to stop, giving how
+// many bits of it follow and the sum of the ranges below them.
+func (d *arjFastestDecoder) number(start, stop uint) int {
+	plus, width := 0, start
+	for ; width < stop && d.bits.read(1) == 1; width++ {
+		plus += 1 << width
+	}
+	return plus + int(d.bits.read(width))
+}
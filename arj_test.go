@@ -0,0 +1,133 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Method 4's coding of v: a unary count from start to stop of how many
+// bits follow, then those bits.
+func arjFastestNumber(w *msbBitWriter, v int, start, stop uint) {
+	plus, width := 0, start
+	for ; width < stop && v >= plus+1<<width; width++ {
+		w.write(1, 1)
+		plus += 1 << width
+	}
+	if width < stop {
+		w.write(0, 1)
+	}
+	w.write(uint32(v-plus), width)
+}
+
+func arjFastestEncode(data []byte) []byte {
+	var w msbBitWriter
+	for _, t := range lzTokens(data, 1<<14, 256) {
+		if t.length == 0 {
+			arjFastestNumber(&w, 0, 0, 7)
+			w.write(uint32(t.lit), 8)
+			continue
+		}
+		arjFastestNumber(&w, t.length-lzhThreshold+1, 0, 7)
+		arjFastestNumber(&w, t.dist, 9, 13)
+	}
+	return w.out
+}
+
+// An ARJ header: the id, size, basic header, its CRC, and an extended
+// header.
+func buildTestArjHeader(host, flags, method, kind byte, attr uint16, name string, data, packed []byte) []byte {
+	h := []byte{arjHeaderBase, 11, 1, host, flags, method, kind, 0}
+	h = binary.LittleEndian.AppendUint32(h, 0x5745<<16|0x6000) // 2023-10-05 12:00:00
+	h = binary.LittleEndian.AppendUint32(h, uint32(len(packed)))
+	h = binary.LittleEndian.AppendUint32(h, uint32(len(data)))
+	h = binary.LittleEndian.AppendUint32(h, crc32.ChecksumIEEE(data))
+	h = binary.LittleEndian.AppendUint16(h, 0)
+	h = binary.LittleEndian.AppendUint16(h, attr)
+	h = binary.LittleEndian.AppendUint16(h, 0)
+	h = append(h, name+"\x00\x00"...)
+	b := []byte{0x60, 0xEA}
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(h)))
+	b = append(b, h...)
+	b = binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(h))
+	b = binary.LittleEndian.AppendUint16(b, 3)
+	b = append(b, "ext"...)
+	b = binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE([]byte("ext")))
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	return append(b, packed...)
+}
+
+func buildTestArj() ([]byte, map[string]string) {
+	hello := []byte("hello\n")
+	text := testLZHData()
+	b := buildTestArjHeader(0, 0, 0, arjMain, 0, "old.arj", nil, nil)
+	b = append(b, buildTestArjHeader(0, 0, 0, 0, 0x01, "HELLO.TXT", hello, hello)...)
+	b = append(b, buildTestArjHeader(2, 0, 0, arjDirectory, 0o40750, "docs", nil, nil)...)
+	b = append(b, buildTestArjHeader(2, 0x10, 1, 0, 0o100755, "docs/caf\x82.txt", text, lzhEncode(text, 16, 1<<16))...)
+	b = append(b, buildTestArjHeader(0, 0, 4, 0, 0x20, "DOCS\\FAST.TXT", text, arjFastestEncode(text))...)
+	b = append(b, buildTestArjHeader(0, arjGarbled, 0, 0, 0x20, "SECRET.TXT", hello, hello)...)
+	b = append(b, 0x60, 0xEA, 0, 0)
+	return b, map[string]string{"HELLO.TXT": string(hello), "docs/café.txt": string(text), "DOCS/FAST.TXT": string(text)}
+}
+
+func TestArj(t *testing.T) {
+	archive, want := buildTestArj()
+	name := filepath.Join(t.TempDir(), "old.arj")
+	if err := os.WriteFile(name, archive, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := GetArchiveInfo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, af := range ai.Files() {
+		names = append(names, af.Name())
+	}
+	if got := strings.Join(names, ","); ai.ArchiveType != ARCHIVE_ARJ ||
+		got != "HELLO.TXT,docs,docs/café.txt,DOCS/FAST.TXT,SECRET.TXT" {
+		t.Fatalf("type %v, entries %s", ai.ArchiveType, got)
+	}
+	for name, content := range want {
+		if got, err := ai.File(name).GetBytes(); err != nil || string(got) != content {
+			t.Errorf("%s: %d bytes, %v; want %d", name, len(got), err, len(content))
+		}
+	}
+	hello := ai.File("HELLO.TXT")
+	if hello.Mode() != 0o444 || hello.Method() != "Store" || !hello.ModTime().Equal(time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("HELLO.TXT: mode %v, method %q, time %v", hello.Mode(), hello.Method(), hello.ModTime())
+	}
+	if af := ai.File("docs/café.txt"); af.Mode() != 0o755 || af.Method() != "ARJ-1" {
+		t.Errorf("café.txt: mode %v, method %q", af.Mode(), af.Method())
+	}
+	if af := ai.File("docs"); !af.IsDir || af.Mode().Perm() != 0o750 {
+		t.Errorf("docs: directory %v, mode %v", af.IsDir, af.Mode())
+	}
+	secret := ai.File("SECRET.TXT")
+	if _, err := secret.GetBytes(); !secret.Encrypted() || !errors.Is(err, ErrEncrypted) {
+		t.Errorf("SECRET.TXT: encrypted %v, %v", secret.Encrypted(), err)
+	}
+
+	// A flipped bit in the stored data fails the CRC, and one in a header
+	// fails that header's.
+	bad := bytes.Clone(archive)
+	bad[bytes.Index(bad, []byte("hello\n"))] ^= 1
+	ai, err = GetArchiveInfoFromReader(bytes.NewReader(bad), int64(len(bad)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ai.File("HELLO.TXT").GetBytes(); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("bad CRC: %v", err)
+	}
+	bad = bytes.Clone(archive)
+	bad[bytes.Index(bad, []byte("docs\x00"))] ^= 1
+	if _, err := GetArchiveInfoFromReader(bytes.NewReader(bad), int64(len(bad))); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("bad header CRC: %v", err)
+	}
+}
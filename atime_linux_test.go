@@ -0,0 +1,43 @@
+package archiver
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Stat's atime, which os.FileInfo doesn't expose portably.
+func fileAccessTime(t *testing.T, path string) time.Time {
+	t.Helper()
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		t.Fatal(err)
+	}
+	return time.Unix(st.Atim.Unix())
+}
+
+func TestWithAccessTimes(t *testing.T) {
+	for _, restore := range []bool{false, true} {
+		var opts []Option
+		if restore {
+			opts = append(opts, WithAccessTimes())
+		}
+		ar, err := GetArchiveInfo("testassets/pax_times.tgz", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		if err = ar.ExtractSubtree("", dir); err != nil {
+			t.Fatal(err)
+		}
+		af := ar.File("log.txt")
+		want := af.ModTime()
+		if restore {
+			want = af.AccessTime()
+		}
+		if got := fileAccessTime(t, filepath.Join(dir, "log.txt")); !got.Equal(want) {
+			t.Errorf("restore=%v atime = %v, want %v", restore, got, want)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Microsoft cabinet files.  Their files are laid end to end in folders,
+// each compressed as one stream in blocks of up to 32K: stored, MSZIP or
+// LZX.  Quantum folders are listed but can't be read.  A file continued
+// from or into another cabinet of a set is left out, with a warning.
+
+const (
+	cabMagic        = "MSCF\x00\x00\x00\x00"
+	cabHeaderLen    = 36
+	cabFlagPrev     = 0x0001
+	cabFlagNext     = 0x0002
+	cabFlagReserve  = 0x0004
+	cabAttrReadOnly = 0x01
+	cabAttrExec     = 0x40
+	cabAttrUTF8     = 0x80
+	cabFolderPrev   = 0xFFFD // The first of the special iFolder values
+	cabMSZIPWindow  = 32768
+)
+
+// Compression types, from the low 4 bits of typeCompress.
+const (
+	cabStore   = 0
+	cabMSZIP   = 1
+	cabQuantum = 2
+	cabLZX     = 3
+)
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_CAB,
+		detect:      func(header []byte) bool { return bytes.HasPrefix(header, []byte(cabMagic)) },
+		load:        loadCab,
+		open:        openCabEntry,
+		each:        forEachCab,
+	})
+}
+
+type cabFolder struct {
+	offset   int64 // Of the first data block
+	blocks   int
+	compress uint16
+}
+
+func (f cabFolder) method() string {
+	switch f.compress & 0x0F {
+	case cabStore:
+		return "Store"
+	case cabMSZIP:
+		return "MSZIP"
+	case cabQuantum:
+		return "Quantum"
+	case cabLZX:
+		return "LZX"
+	}
+	return fmt.Sprintf("Unknown (%d)", f.compress&0x0F)
+}
+
+type cabFile struct {
+	name    string
+	size    int64
+	folder  int
+	offset  int64 // In the folder's uncompressed content
+	modTime time.Time
+	attribs uint16
+}
+
+type cabinet struct {
+	folders     []cabFolder
+	files       []cabFile
+	dataReserve int // Bytes each data block's header reserves
+}
+
+// Read the cabinet's header, folders and files, decoding legacy names
+// from enc as WithNameEncoding describes.
+func readCabinet(src source, enc encoding.Encoding) (*cabinet, error) {
+	head := make([]byte, cabHeaderLen)
+	if _, err := src.ReadAt(head, 0); err != nil {
+		return nil, noEOF(err)
+	}
+	filesAt := int64(binary.LittleEndian.Uint32(head[16:]))
+	numFolders := int(binary.LittleEndian.Uint16(head[26:]))
+	numFiles := int(binary.LittleEndian.Uint16(head[28:]))
+	flags := binary.LittleEndian.Uint16(head[30:])
+	pos := int64(cabHeaderLen)
+	cab := &cabinet{}
+	folderReserve := 0
+	if flags&cabFlagReserve != 0 {
+		reserve := make([]byte, 4)
+		if _, err := src.ReadAt(reserve, pos); err != nil {
+			return nil, noEOF(err)
+		}
+		folderReserve, cab.dataReserve = int(reserve[2]), int(reserve[3])
+		pos += 4 + int64(binary.LittleEndian.Uint16(reserve))
+	}
+	for _, flag := range []uint16{cabFlagPrev, cabFlagNext} {
+		if flags&flag == 0 {
+			continue
+		}
+		for i := 0; i < 2; i++ { // The cabinet's name and its disk's
+			s, err := readCString(src, pos)
+			if err != nil {
+				return nil, err
+			}
+			pos += int64(len(s)) + 1
+		}
+	}
+	entry := make([]byte, 8+folderReserve)
+	for i := 0; i < numFolders; i++ {
+		if _, err := src.ReadAt(entry, pos); err != nil {
+			return nil, noEOF(err)
+		}
+		cab.folders = append(cab.folders, cabFolder{offset: int64(binary.LittleEndian.Uint32(entry)),
+			blocks: int(binary.LittleEndian.Uint16(entry[4:])), compress: binary.LittleEndian.Uint16(entry[6:])})
+		pos += int64(len(entry))
+	}
+	entry = make([]byte, 16)
+	for pos, i := filesAt, 0; i < numFiles; i++ {
+		if _, err := src.ReadAt(entry, pos); err != nil {
+			return nil, noEOF(err)
+		}
+		raw, err := readCString(src, pos+16)
+		if err != nil {
+			return nil, err
+		}
+		pos += 16 + int64(len(raw)) + 1
+		attribs := binary.LittleEndian.Uint16(entry[14:])
+		name := raw
+		if attribs&cabAttrUTF8 == 0 {
+			name = legacyName(raw, enc, charmap.Windows1252)
+		}
+		cab.files = append(cab.files, cabFile{name: strings.ReplaceAll(name, "\\", "/"),
+			size: int64(binary.LittleEndian.Uint32(entry)), offset: int64(binary.LittleEndian.Uint32(entry[4:])),
+			folder:  int(binary.LittleEndian.Uint16(entry[8:])),
+			modTime: dosTime(binary.LittleEndian.Uint16(entry[10:]), binary.LittleEndian.Uint16(entry[12:])),
+			attribs: attribs})
+	}
+	return cab, nil
+}
+
+// A NUL-terminated string at offset, of up to 256 bytes as CAB allows.
+func readCString(src source, offset int64) (string, error) {
+	buf := make([]byte, min(257, max(src.size-offset, 0)))
+	n, err := src.ReadAt(buf, offset)
+	if s, _, found := bytes.Cut(buf[:n], []byte{0}); found {
+		return string(s), nil
+	}
+	if err == nil || err == io.EOF {
+		err = fmt.Errorf("%w: unterminated name at %d", ErrCorruptArchive, offset)
+	}
+	return "", err
+}
+
+// An MS-DOS date and time, taken as UTC as archive/zip does.
+func dosTime(date, clock uint16) time.Time {
+	return time.Date(int(date>>9)+1980, time.Month(date>>5&0xF), int(date&0x1F),
+		int(clock>>11), int(clock>>5&0x3F), int(clock&0x1F)*2, 0, time.UTC)
+}
+
+func loadCab(ar *ArchiveInfo) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	cab, err := readCabinet(src, ar.opts.nameEncoding)
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	for i, f := range cab.files {
+		if f.folder >= cabFolderPrev {
+			ar.warn(&EntryError{Archive: ar.fullname, Name: f.name, Offset: -1,
+				Err: fmt.Errorf("%w: continued across cabinets", ErrUnsupportedFormat)})
+			continue
+		}
+		if f.folder >= len(cab.folders) {
+			return openError(ar.fullname, fmt.Errorf("%w: %s: no folder %d", ErrCorruptArchive, f.name, f.folder))
+		}
+		var mode fs.FileMode = 0o644
+		if f.attribs&cabAttrReadOnly != 0 {
+			mode = 0o444
+		}
+		if f.attribs&cabAttrExec != 0 {
+			mode |= 0o111
+		}
+		err = ar.addFile(ArchivedFile{archivefile: ar.fullname, archivetype: ARCHIVE_CAB, name: f.name, size: f.size,
+			mode: mode, modTime: f.modTime, method: cab.folders[f.folder].method(), packed: -1, index: i})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func openCabEntry(af *ArchivedFile) (io.ReadCloser, error) {
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	cab, err := readCabinet(src, nil)
+	if err == nil && af.index >= len(cab.files) {
+		err = fmt.Errorf("%w: entry %d", ErrCorruptArchive, af.index)
+	}
+	if err != nil {
+		src.Close()
+		return nil, openError(af.archivefile, err)
+	}
+	f := cab.files[af.index]
+	folder, err := cab.openFolder(src, f.folder)
+	if err == nil {
+		_, err = io.CopyN(io.Discard, folder, f.offset)
+	}
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("%s: %w", af.name, noEOF(err))
+	}
+	return &entryReader{io.LimitReader(folder, f.size), []io.Closer{src}}, nil
+}
+
+// Each folder is decompressed once, passing the files along as it goes,
+// unless they're out of order within it.
+func forEachCab(ai *ArchiveInfo, fn func(*ArchivedFile, io.Reader) error) error {
+	src, err := ai.openSource()
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	defer src.Close()
+	cab, err := readCabinet(src, nil)
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	var folder *cabFolderReader
+	current, pos := -1, int64(0)
+	for _, af := range ai.archiveOrder() {
+		if af.index >= len(cab.files) {
+			return openError(ai.fullname, fmt.Errorf("%w: entry %d", ErrCorruptArchive, af.index))
+		}
+		f := cab.files[af.index]
+		if f.folder != current || f.offset < pos {
+			if folder, err = cab.openFolder(src, f.folder); err != nil {
+				return fmt.Errorf("%s: %w", af.name, err)
+			}
+			current, pos = f.folder, 0
+		}
+		if _, err = io.CopyN(io.Discard, folder, f.offset-pos); err != nil {
+			return fmt.Errorf("%s: %w", af.name, noEOF(err))
+		}
+		content := &io.LimitedReader{R: folder, N: f.size}
+		if err = fn(af, af.wrapReader(content)); err != nil {
+			return err
+		}
+		pos = f.offset + f.size - content.N
+	}
+	return nil
+}
+
+// The uncompressed content of folder i.
+func (cab *cabinet) openFolder(src source, i int) (*cabFolderReader, error) {
+	f := cab.folders[i]
+	fr := &cabFolderReader{src: src, pos: f.offset, left: f.blocks, reserve: cab.dataReserve}
+	switch f.compress & 0x0F {
+	case cabStore:
+		fr.decode = func(in []byte, size int) ([]byte, error) {
+			if len(in) != size {
+				return nil, fmt.Errorf("%w: stored block of %d bytes holds %d", ErrCorruptArchive, size, len(in))
+			}
+			return in, nil
+		}
+	case cabMSZIP:
+		fr.decode = mszipDecoder()
+	case cabLZX:
+		lzx, err := newLZXDecoder(int(f.compress >> 8 & 0x1F))
+		if err != nil {
+			return nil, err
+		}
+		fr.decode = lzx.decodeFrame
+	default:
+		return nil, fmt.Errorf("%w: CAB %s compression", ErrUnsupportedFormat, f.method())
+	}
+	return fr, nil
+}
+
+// MSZIP: each block a deflate stream of its own, but for the window,
+// which carries over from the blocks before.
+func mszipDecoder() func(in []byte, size int) ([]byte, error) {
+	var history []byte
+	return func(in []byte, size int) ([]byte, error) {
+		if !bytes.HasPrefix(in, []byte("CK")) {
+			return nil, fmt.Errorf("%w: MSZIP block without its signature", ErrCorruptArchive)
+		}
+		inflater := flate.NewReaderDict(bytes.NewReader(in[2:]), history)
+		out := make([]byte, size)
+		_, err := io.ReadFull(inflater, out)
+		if err != nil {
+			return nil, fmt.Errorf("%w: MSZIP block: %w", ErrCorruptArchive, noEOF(err))
+		}
+		history = append(history, out...)
+		history = history[max(len(history)-cabMSZIPWindow, 0):]
+		return out, nil
+	}
+}
+
+// Reads a folder's data blocks in turn, checking their checksums.
+type cabFolderReader struct {
+	src     source
+	pos     int64 // Of the next data block
+	left    int   // Blocks not yet read
+	reserve int
+	decode  func(in []byte, size int) ([]byte, error)
+	out     []byte // Decoded and not yet read
+}
+
+func (fr *cabFolderReader) Read(p []byte) (int, error) {
+	for len(fr.out) == 0 {
+		if fr.left == 0 {
+			return 0, io.EOF
+		}
+		if err := fr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, fr.out)
+	fr.out = fr.out[n:]
+	return n, nil
+}
+
+func (fr *cabFolderReader) next() error {
+	head := make([]byte, 8)
+	if _, err := fr.src.ReadAt(head, fr.pos); err != nil {
+		return noEOF(err)
+	}
+	sum := binary.LittleEndian.Uint32(head)
+	packed, size := int(binary.LittleEndian.Uint16(head[4:])), int(binary.LittleEndian.Uint16(head[6:]))
+	in := make([]byte, packed)
+	if _, err := fr.src.ReadAt(in, fr.pos+8+int64(fr.reserve)); err != nil {
+		return noEOF(err)
+	}
+	if sum != 0 && cabChecksum(head[4:], cabChecksum(in, 0)) != sum {
+		return fmt.Errorf("%w: checksum mismatch in the data block at %d", ErrCorruptArchive, fr.pos)
+	}
+	if size == 0 {
+		return fmt.Errorf("%w: folder continued in the next cabinet", ErrUnsupportedFormat)
+	}
+	out, err := fr.decode(in, size)
+	if err != nil {
+		return err
+	}
+	fr.pos += 8 + int64(fr.reserve+packed)
+	fr.left--
+	fr.out = out
+	return nil
+}
+
+// The CAB checksum: the XOR of the little-endian 32-bit words of data,
+// its last partial word taken big-endian.
+func cabChecksum(data []byte, seed uint32) uint32 {
+	sum := seed
+	for ; len(data) >= 4; data = data[4:] {
+		sum ^= binary.LittleEndian.Uint32(data)
+	}
+	var last uint32
+	for _, b := range data {
+		last = last<<8 | uint32(b)
+	}
+	return sum ^ last
+}
@@ -0,0 +1,182 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCabFile struct {
+	name    string
+	folder  uint16
+	offset  int
+	size    int
+	attribs uint16
+}
+
+type testCabFolder struct {
+	compress uint16
+	blocks   [][]byte
+	sizes    []int // Uncompressed, of each block
+}
+
+// A cabinet with reserved space in the header, each folder and each block.
+func buildTestCab(folders []testCabFolder, files []testCabFile) []byte {
+	const headerReserve, folderReserve, dataReserve = 4, 2, 3
+	filesAt := cabHeaderLen + 4 + headerReserve + len(folders)*(8+folderReserve)
+	var fileTable []byte
+	for _, f := range files {
+		fileTable = binary.LittleEndian.AppendUint32(fileTable, uint32(f.size))
+		fileTable = binary.LittleEndian.AppendUint32(fileTable, uint32(f.offset))
+		fileTable = binary.LittleEndian.AppendUint16(fileTable, f.folder)
+		fileTable = binary.LittleEndian.AppendUint16(fileTable, 0x5745) // 2023-10-05
+		fileTable = binary.LittleEndian.AppendUint16(fileTable, 0x6000) // 12:00:00
+		fileTable = binary.LittleEndian.AppendUint16(fileTable, f.attribs)
+		fileTable = append(fileTable, f.name+"\x00"...)
+	}
+	dataAt := filesAt + len(fileTable)
+	var folderTable, data []byte
+	for _, folder := range folders {
+		folderTable = binary.LittleEndian.AppendUint32(folderTable, uint32(dataAt+len(data)))
+		folderTable = binary.LittleEndian.AppendUint16(folderTable, uint16(len(folder.blocks)))
+		folderTable = binary.LittleEndian.AppendUint16(folderTable, folder.compress)
+		folderTable = append(folderTable, make([]byte, folderReserve)...)
+		for i, in := range folder.blocks {
+			sizes := binary.LittleEndian.AppendUint16(nil, uint16(len(in)))
+			sizes = binary.LittleEndian.AppendUint16(sizes, uint16(folder.sizes[i]))
+			data = binary.LittleEndian.AppendUint32(data, cabChecksum(sizes, cabChecksum(in, 0)))
+			data = append(data, sizes...)
+			data = append(data, make([]byte, dataReserve)...)
+			data = append(data, in...)
+		}
+	}
+	head := make([]byte, cabHeaderLen, dataAt)
+	copy(head, cabMagic)
+	binary.LittleEndian.PutUint32(head[8:], uint32(dataAt+len(data)))
+	binary.LittleEndian.PutUint32(head[16:], uint32(filesAt))
+	head[24], head[25] = 3, 1
+	binary.LittleEndian.PutUint16(head[26:], uint16(len(folders)))
+	binary.LittleEndian.PutUint16(head[28:], uint16(len(files)))
+	binary.LittleEndian.PutUint16(head[30:], cabFlagReserve)
+	head = append(head, headerReserve, 0, folderReserve, dataReserve)
+	head = append(head, make([]byte, headerReserve)...)
+	head = append(head, folderTable...)
+	head = append(head, fileTable...)
+	return append(head, data...)
+}
+
+// MSZIP blocks of content, 32K at a time, each using what came before as
+// its dictionary.
+func mszipBlocks(content string) ([][]byte, []int) {
+	var blocks [][]byte
+	var sizes []int
+	for done := 0; done < len(content); done += cabMSZIPWindow {
+		chunk := content[done:min(done+cabMSZIPWindow, len(content))]
+		var buf bytes.Buffer
+		buf.WriteString("CK")
+		fw, _ := flate.NewWriterDict(&buf, flate.BestCompression, []byte(content[max(done-cabMSZIPWindow, 0):done]))
+		fw.Write([]byte(chunk))
+		fw.Close()
+		blocks, sizes = append(blocks, buf.Bytes()), append(sizes, len(chunk))
+	}
+	return blocks, sizes
+}
+
+func writeTestCab(t *testing.T) (string, map[string]string) {
+	readme, cafe, naive := "hello from the cabinet\r\n", "café\r\n", "naïve\r\n"
+	big := strings.Repeat("The quick brown fox jumps over the lazy dog.  ", 1000)[:40000]
+	small := "small file\n"
+	mszip, mszipSizes := mszipBlocks(big + small)
+	frames, tool := buildTestLZX()
+	lzxSizes := []int{lzxFrameSize, len(tool) - lzxFrameSize}
+	stored := readme + cafe + naive
+	img := buildTestCab([]testCabFolder{
+		{cabStore, [][]byte{[]byte(stored)}, []int{len(stored)}},
+		{cabMSZIP, mszip, mszipSizes},
+		{cabLZX | 15<<8, frames, lzxSizes},
+	}, []testCabFile{
+		{"README.TXT", 0, 0, len(readme), cabAttrReadOnly},
+		{"caf\xe9.txt", 0, len(readme), len(cafe), 0},
+		{"sub\\naïve.txt", 0, len(readme) + len(cafe), len(naive), cabAttrUTF8},
+		{"sub\\big.txt", 1, 0, len(big), 0},
+		{"sub\\small.txt", 1, len(big), len(small), 0},
+		{"tool.exe", 2, 0, len(tool), cabAttrExec},
+		{"continued.bin", cabFolderPrev, 0, 10, 0},
+	})
+	name := filepath.Join(t.TempDir(), "driver.cab")
+	if err := os.WriteFile(name, img, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name, map[string]string{"README.TXT": readme, "café.txt": cafe, "sub/naïve.txt": naive,
+		"sub/big.txt": big, "sub/small.txt": small, "tool.exe": string(tool)}
+}
+
+func TestCab(t *testing.T) {
+	name, want := writeTestCab(t)
+	ai, err := GetArchiveInfo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, af := range ai.Files() {
+		names = append(names, af.Name())
+	}
+	if got := strings.Join(names, ","); ai.ArchiveType != ARCHIVE_CAB || got != "README.TXT,café.txt,sub/naïve.txt,sub/big.txt,sub/small.txt,tool.exe" {
+		t.Fatalf("type %v, entries %s", ai.ArchiveType, got)
+	}
+	if warnings := ai.Warnings(); len(warnings) != 1 || !errors.Is(warnings[0], ErrUnsupportedFormat) {
+		t.Errorf("warnings %v", warnings)
+	}
+	for _, af := range ai.Files() {
+		if data, err := af.GetBytes(); err != nil || string(data) != want[af.Name()] {
+			t.Errorf("%s: %d bytes, %v", af.Name(), len(data), err)
+		}
+	}
+	readme, tool := ai.File("README.TXT"), ai.File("tool.exe")
+	if readme.Mode() != 0o444 || !readme.ModTime().Equal(time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("README.TXT: mode %v, time %v", readme.Mode(), readme.ModTime())
+	}
+	if tool.Mode() != 0o755 || tool.Method() != "LZX" || ai.File("sub/big.txt").Method() != "MSZIP" {
+		t.Errorf("tool.exe: mode %v, method %s", tool.Mode(), tool.Method())
+	}
+
+	got := make(map[string]string)
+	err = ai.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		if af.Name() == "sub/big.txt" {
+			return nil // Left unread, for small.txt to skip
+		}
+		data, err := io.ReadAll(r)
+		got[af.Name()] = string(data)
+		return err
+	})
+	if err != nil || len(got) != 5 || got["sub/small.txt"] != want["sub/small.txt"] || got["tool.exe"] != want["tool.exe"] {
+		t.Errorf("ForEach: %d entries, %v", len(got), err)
+	}
+}
+
+func TestCabChecksum(t *testing.T) {
+	name, _ := writeTestCab(t)
+	img, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := bytes.Index(img, []byte("hello from the cabinet"))
+	img[at] = 'j'
+	ai, err := GetArchiveInfoFromReader(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ai.File("README.TXT").GetBytes(); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("damaged block: %v", err)
+	}
+	if data, err := ai.File("tool.exe").GetBytes(); err != nil || len(data) == 0 {
+		t.Errorf("undamaged folder: %d bytes, %v", len(data), err)
+	}
+}
@@ -0,0 +1,139 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path"
+	"strings"
+)
+
+// Single compressed files: a gzip, bzip2, xz, zstd, brotli, LZ4, compress
+// or lzip stream that turns out not to hold a tarball.  Each sniffs as the compressed tar
+// type sharing its codec until the content shows otherwise.
+var singleFileTypes = map[ArchiveType]ArchiveType{
+	ARCHIVE_TGZ: ARCHIVE_GZ, ARCHIVE_TBZ2: ARCHIVE_BZ2, ARCHIVE_TXZ: ARCHIVE_XZ, ARCHIVE_TZST: ARCHIVE_ZST,
+	ARCHIVE_TBR: ARCHIVE_BR, ARCHIVE_TLZ4: ARCHIVE_LZ4, ARCHIVE_TZ: ARCHIVE_Z, ARCHIVE_TLZ: ARCHIVE_LZ,
+}
+
+// The extensions each drops to restore the file's name, as gunzip and the
+// like do.
+var singleFileExtensions = map[ArchiveType][]string{
+	ARCHIVE_GZ: {".gz", ".gzip", ".z"}, ARCHIVE_BZ2: {".bz2", ".bz"}, ARCHIVE_XZ: {".xz"},
+	ARCHIVE_ZST: {".zst", ".zstd"}, ARCHIVE_BR: {".br"}, ARCHIVE_LZ4: {".lz4"}, ARCHIVE_Z: {".z"},
+	ARCHIVE_LZ: {".lz"},
+}
+
+// Reports whether t is a single compressed file.
+func isSingleFileType(t ArchiveType) bool {
+	_, ok := singleFileExtensions[t]
+	return ok
+}
+
+// The type of a stream with no magic to know it by, going by the
+// extension name claims: brotli, which only its extension gives away.
+// ARCHIVE_NA for anything else.
+func claimedStreamType(name string) ArchiveType {
+	if t := TypeFromExtension(name); t == ARCHIVE_TBR || t == ARCHIVE_BR {
+		return ARCHIVE_TBR
+	}
+	return ARCHIVE_NA
+}
+
+// The compressed tar type whose codec single-file type t uses.
+func codecType(t ArchiveType) ArchiveType {
+	for tarType, single := range singleFileTypes {
+		if single == t {
+			return tarType
+		}
+	}
+	return t
+}
+
+// Look at the start of a decompressed stream to tell a tarball from a
+// single compressed file.  For a tarball, the returned reader replays the
+// whole stream for the tar walk.  Otherwise the archive becomes the
+// single-file type, with one entry for the decompressed file, and the
+// stream is read to the end to size it.
+func (ar *ArchiveInfo) settleCompressed(content io.Reader) (io.Reader, error) {
+	block := make([]byte, tarBlockSize)
+	n, err := io.ReadFull(content, block)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, openError(ar.fullname, err)
+	}
+	if n == tarBlockSize && (isTarHeader(block) || bytes.Count(block, []byte{0}) == tarBlockSize) {
+		return io.MultiReader(bytes.NewReader(block), content), nil
+	}
+	// The size is only known by decompressing, so a bomb is stopped by
+	// counting rather than by its header.  A stream that has already ended
+	// isn't read again; not every decompressor takes that kindly.
+	var rest int64
+	if n < tarBlockSize {
+		err = nil
+	} else if max := ar.opts.limits.sizeCap(); max >= 0 {
+		rest, err = io.CopyN(io.Discard, content, max-int64(n)+1)
+		if err == io.EOF {
+			err = nil
+		}
+	} else {
+		rest, err = io.Copy(io.Discard, content)
+	}
+	if err != nil {
+		return nil, openError(ar.fullname, err)
+	}
+	ar.ArchiveType = singleFileTypes[ar.ArchiveType]
+	return nil, ar.addFile(ar.singleFileEntry(content, int64(n)+rest))
+}
+
+// The one entry of a single compressed file of size bytes, content being
+// its decompressor.  Only gzip keeps the original name and time.
+func (ar *ArchiveInfo) singleFileEntry(content io.Reader, size int64) ArchivedFile {
+	af := ArchivedFile{archivefile: ar.fullname, archivetype: ar.ArchiveType,
+		name: singleFileName("", ar.name, ar.ArchiveType), size: size, mode: 0o644,
+		method: tarMethods[codecType(ar.ArchiveType)], packed: ar.size}
+	if gzReader, ok := content.(*gzip.Reader); ok {
+		af.name, af.modTime = singleFileName(gzReader.Header.Name, ar.name, ar.ArchiveType), gzReader.Header.ModTime
+	}
+	return af
+}
+
+// Name for the file inside a single compressed file of type t: the
+// original name if the header kept it, else the archive's name without its
+// extension, as gunzip would restore it.
+func singleFileName(stored, archiveName string, t ArchiveType) string {
+	if base := path.Base(strings.ReplaceAll(stored, "\\", "/")); stored != "" && base != "." && base != "/" && base != ".." {
+		return base
+	}
+	for _, ext := range singleFileExtensions[t] {
+		if len(archiveName) > len(ext) && strings.EqualFold(archiveName[len(archiveName)-len(ext):], ext) {
+			return archiveName[:len(archiveName)-len(ext)]
+		}
+	}
+	if archiveName == "" {
+		return "data"
+	}
+	return archiveName
+}
+
+func (af *ArchivedFile) openCompressed() (io.ReadCloser, error) {
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	content, closer, err := tarStream(codecType(af.archivetype), src.stream())
+	if err != nil {
+		src.Close()
+		return nil, openError(af.archivefile, err)
+	}
+	return &entryReader{af.wrapReader(content), []io.Closer{closer, src}}, nil
+}
+
+func (af *ArchivedFile) extractCompressedFileBytes() ([]byte, error) {
+	readCloser, err := af.openCompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer readCloser.Close()
+	var buffer = make([]byte, af.size)
+	return buffer, readEntry(readCloser, af.name, buffer)
+}
@@ -0,0 +1,104 @@
+package archiver
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+const testCompressedContent = "id,total\n1,42\n"
+
+// testCompressedContent compressed by each codec that isn't gzip, which
+// source_test covers.  Go has no bzip2 writer, so that one is canned.
+func testCompressedFiles(t *testing.T) map[string][]byte {
+	files := map[string][]byte{"report.csv.bz2": []byte("BZh91AY&SY2\x8d\x82(\x00\x00\x04\xd9\x80\x00\x10\x00\x044\x00$$\x84\x00 " +
+		"\x001\x00\xd3M\x04\x06\x83'\x01\xa31\x10i_\x8b\xb9\"\x9c(H\x19F\xc1\x14\x00")}
+	var xzBuf bytes.Buffer
+	xw, err := xz.NewWriter(&xzBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xw.Write([]byte(testCompressedContent))
+	xw.Close()
+	files["report.csv.xz"] = xzBuf.Bytes()
+	var zstdBuf bytes.Buffer
+	zw, err := zstd.NewWriter(&zstdBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write([]byte(testCompressedContent))
+	zw.Close()
+	files["report.csv.zst"] = zstdBuf.Bytes()
+	files["report.csv.br"] = testCompress(brotli.NewWriter, []byte(testCompressedContent))
+	files["report.csv.lz4"] = testCompress(lz4.NewWriter, []byte(testCompressedContent))
+	files["report.csv.Z"] = lzwEncode([]byte(testCompressedContent), 16, true)
+	files["report.csv.lz"] = lzipMember(t, []byte(testCompressedContent))
+	return files
+}
+
+// data through a codec whose writer can't fail to start.
+func testCompress[W io.WriteCloser](newWriter func(io.Writer) W, data []byte) []byte {
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestSingleCompressedFile(t *testing.T) {
+	dir := t.TempDir()
+	want := map[string]ArchiveType{"report.csv.bz2": ARCHIVE_BZ2, "report.csv.xz": ARCHIVE_XZ, "report.csv.zst": ARCHIVE_ZST,
+		"report.csv.br": ARCHIVE_BR, "report.csv.lz4": ARCHIVE_LZ4, "report.csv.Z": ARCHIVE_Z, "report.csv.lz": ARCHIVE_LZ}
+	for name, data := range testCompressedFiles(t) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ai, err := GetArchiveInfo(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if ai.ArchiveType != want[name] || len(ai.Files()) != 1 || !ai.ExtensionMatchesType() {
+			t.Fatalf("%s: type %v with %d entries", name, ai.ArchiveType, len(ai.Files()))
+		}
+		af := ai.FileAt(0)
+		if af.Name() != "report.csv" || af.Size() != int64(len(testCompressedContent)) || af.Method() == "" {
+			t.Errorf("%s: entry %q size %d method %q", name, af.Name(), af.Size(), af.Method())
+		}
+		if got, err := af.GetString(); got != testCompressedContent || err != nil {
+			t.Errorf("%s: GetString() = %q, %v", name, got, err)
+		}
+		if errs := ai.VerifyAll(2); len(errs) != 0 {
+			t.Errorf("%s: VerifyAll() = %v", name, errs)
+		}
+
+		err = ForEachFromReader(bytes.NewBuffer(data), func(af *ArchivedFile, r io.Reader) error {
+			got, err := io.ReadAll(r)
+			if af.Name() != "report.csv" || string(got) != testCompressedContent {
+				t.Errorf("%s: streamed %s, content %q", name, af.Name(), got)
+			}
+			return err
+		}, WithNameHint(name))
+		if err != nil {
+			t.Errorf("%s: ForEachFromReader() error = %v", name, err)
+		}
+	}
+
+	// The compressed tarballs still list as tar.
+	for _, name := range []string{"testassets/test.tar.bz2", "testassets/test.tar.xz", "testassets/test.tar.zst"} {
+		ai, err := GetArchiveInfo(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isTarType(ai.ArchiveType) || len(ai.Files()) < 2 {
+			t.Errorf("%s: type %v with %d entries", name, ai.ArchiveType, len(ai.Files()))
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package archiver
+
+import (
+	"encoding/xml"
+	"path"
+	"strings"
+)
+
+// What a zip is for, going by the structure its format requires rather
+// than by its extension: a .zip that's really a Word document is a DOCX,
+// and a .docx that isn't one is a plain zip.
+type ContainerKind int
+
+const (
+	CONTAINER_NONE  ContainerKind = iota // A plain zip, or not a zip at all
+	CONTAINER_DOCX                       // Word document, Office Open XML
+	CONTAINER_XLSX                       // Excel workbook, Office Open XML
+	CONTAINER_PPTX                       // PowerPoint presentation, Office Open XML
+	CONTAINER_ODT                        // OpenDocument text
+	CONTAINER_ODS                        // OpenDocument spreadsheet
+	CONTAINER_ODP                        // OpenDocument presentation
+	CONTAINER_EPUB                       // EPUB e-book
+	CONTAINER_JAR                        // Java archive, or anything else with a JAR manifest
+	CONTAINER_APK                        // Android package
+	CONTAINER_NUPKG                      // NuGet package
+	CONTAINER_WHL                        // Python wheel
+)
+
+// The classification, made on first use.
+type containerInfo struct {
+	kind ContainerKind
+	main string // The main document's entry name; "" for none
+}
+
+// Largest metadata entry read to classify a zip.  Anything bigger isn't
+// what it claims to be.
+const containerMetaMax = 1 << 20
+
+// The OpenDocument kinds, by the mimetype entry that starts the zip.
+var odfKinds = map[string]ContainerKind{
+	"application/vnd.oasis.opendocument.text":         CONTAINER_ODT,
+	"application/vnd.oasis.opendocument.spreadsheet":  CONTAINER_ODS,
+	"application/vnd.oasis.opendocument.presentation": CONTAINER_ODP,
+}
+
+// The Office Open XML kinds, by the folder holding the main part.
+var ooxmlKinds = map[string]ContainerKind{"word": CONTAINER_DOCX, "xl": CONTAINER_XLSX, "ppt": CONTAINER_PPTX}
+
+// What kind of container the zip is.  CONTAINER_NONE for other archive
+// types, and for zips that are just zips.
+func (ai *ArchiveInfo) ContainerKind() ContainerKind { return ai.container().kind }
+
+// The entry holding an office document's or e-book's content: the main
+// part an Office Open XML package's relationships point to, an
+// OpenDocument's content.xml, or an EPUB's package document.  nil for
+// other kinds, or if the entry is missing.
+func (ai *ArchiveInfo) MainDocument() *ArchivedFile {
+	if main := ai.container().main; main != "" {
+		return ai.File(main)
+	}
+	return nil
+}
+
+func (ai *ArchiveInfo) container() containerInfo {
+	ai.kindOnce.Do(func() {
+		if ai.ArchiveType == ARCHIVE_ZIP {
+			ai.kind = ai.classifyContainer()
+		}
+	})
+	return ai.kind
+}
+
+func (ai *ArchiveInfo) classifyContainer() containerInfo {
+	// EPUB and OpenDocument say what they are in a mimetype entry.
+	switch mimetype := strings.TrimSpace(string(ai.metaEntry("mimetype"))); {
+	case mimetype == "application/epub+zip":
+		return containerInfo{CONTAINER_EPUB, epubRootFile(ai.metaEntry("META-INF/container.xml"))}
+	case odfKinds[mimetype] != CONTAINER_NONE:
+		return containerInfo{odfKinds[mimetype], "content.xml"}
+	}
+	for i := range ai.files {
+		dir, file := path.Split(ai.files[i].name)
+		switch {
+		case dir == "" && strings.HasSuffix(strings.ToLower(file), ".nuspec"):
+			return containerInfo{kind: CONTAINER_NUPKG}
+		case file == "WHEEL" && strings.HasSuffix(dir, ".dist-info/") && strings.Count(dir, "/") == 1:
+			return containerInfo{kind: CONTAINER_WHL}
+		}
+	}
+	if main := ooxmlMainPart(ai.metaEntry("_rels/.rels")); main != "" {
+		folder, _, _ := strings.Cut(main, "/")
+		if kind := ooxmlKinds[folder]; kind != CONTAINER_NONE {
+			return containerInfo{kind, main}
+		}
+	}
+	// APKs are signed as JARs are, so check for one first.
+	switch {
+	case ai.File("AndroidManifest.xml") != nil && (ai.File("classes.dex") != nil || ai.File("resources.arsc") != nil):
+		return containerInfo{kind: CONTAINER_APK}
+	case ai.File("META-INF/MANIFEST.MF") != nil:
+		return containerInfo{kind: CONTAINER_JAR}
+	}
+	return containerInfo{}
+}
+
+// The content of a small entry, or nil if there's no such entry or it
+// can't be read.
+func (ai *ArchiveInfo) metaEntry(name string) []byte {
+	af := ai.File(name)
+	if af == nil || af.isDir() || af.size > containerMetaMax {
+		return nil
+	}
+	data, err := af.GetBytes()
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// The main part named by an Office Open XML package's relationships, as
+// an entry name, or "" if there isn't one.
+func ooxmlMainPart(rels []byte) string {
+	var doc struct {
+		Relationships []struct {
+			Type   string `xml:"Type,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if xml.Unmarshal(rels, &doc) != nil {
+		return ""
+	}
+	for _, rel := range doc.Relationships {
+		// Transitional and Strict use different namespaces for the type.
+		if strings.HasSuffix(rel.Type, "/officeDocument") && rel.Target != "" {
+			return strings.TrimPrefix(path.Clean("/"+rel.Target), "/")
+		}
+	}
+	return ""
+}
+
+// The package document named by an EPUB's container.xml, or "".
+func epubRootFile(container []byte) string {
+	var doc struct {
+		RootFiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if xml.Unmarshal(container, &doc) != nil || len(doc.RootFiles) == 0 {
+		return ""
+	}
+	return doc.RootFiles[0].FullPath
+}
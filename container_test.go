@@ -0,0 +1,64 @@
+package archiver
+
+import "testing"
+
+const testOOXMLRels = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" ` +
+	`Target="/xl/workbook.xml"/></Relationships>`
+
+func TestContainerKind(t *testing.T) {
+	ai, err := GetArchiveInfo("testassets/Test Doc.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ai.ContainerKind() != CONTAINER_DOCX || ai.MainDocument() == nil || ai.MainDocument().Name() != "word/document.xml" {
+		t.Errorf("Test Doc.docx: kind %v, main document %v", ai.ContainerKind(), ai.MainDocument())
+	}
+
+	// Each named .zip, so it's the content that counts.
+	dir := t.TempDir()
+	for _, c := range []struct {
+		name    string
+		entries [][2]string
+		kind    ContainerKind
+		main    string
+	}{
+		{"xlsx", [][2]string{{"[Content_Types].xml", "<Types/>"}, {"_rels/.rels", testOOXMLRels},
+			{"xl/workbook.xml", "<workbook/>"}}, CONTAINER_XLSX, "xl/workbook.xml"},
+		{"odt", [][2]string{{"mimetype", "application/vnd.oasis.opendocument.text"}, {"content.xml", "<office/>"}},
+			CONTAINER_ODT, "content.xml"},
+		{"epub", [][2]string{{"mimetype", "application/epub+zip"}, {"META-INF/container.xml",
+			`<container><rootfiles><rootfile full-path="OEBPS/book.opf"/></rootfiles></container>`},
+			{"OEBPS/book.opf", "<package/>"}}, CONTAINER_EPUB, "OEBPS/book.opf"},
+		{"jar", [][2]string{{"META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n"}, {"a/Main.class", "\xCA\xFE\xBA\xBE"}},
+			CONTAINER_JAR, ""},
+		{"apk", [][2]string{{"META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n"}, {"AndroidManifest.xml", "\x03\x00"},
+			{"classes.dex", "dex\n035"}}, CONTAINER_APK, ""},
+		{"nupkg", [][2]string{{"[Content_Types].xml", "<Types/>"}, {"_rels/.rels", "<Relationships/>"},
+			{"Demo.nuspec", "<package/>"}}, CONTAINER_NUPKG, ""},
+		{"whl", [][2]string{{"demo/__init__.py", ""}, {"demo-1.0.dist-info/WHEEL", "Wheel-Version: 1.0\n"}},
+			CONTAINER_WHL, ""},
+		{"plain", [][2]string{{"readme.txt", "hi"}, {"mimetype", "text/plain"}}, CONTAINER_NONE, ""},
+	} {
+		ai, err := GetArchiveInfo(writeTestZip(t, dir, c.name+".zip", c.entries))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		main := ""
+		if af := ai.MainDocument(); af != nil {
+			main = af.Name()
+		}
+		if ai.ContainerKind() != c.kind || main != c.main {
+			t.Errorf("%s: kind %v, main document %q", c.name, ai.ContainerKind(), main)
+		}
+	}
+
+	ai, err = GetArchiveInfo("testassets/test.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ai.ContainerKind() != CONTAINER_NONE {
+		t.Errorf("test.tar: kind %v", ai.ContainerKind())
+	}
+}
@@ -0,0 +1,130 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// Repack src's entries into a new archive of type destType at destPath:
+// ARCHIVE_ZIP, ARCHIVE_TAR, or a tar compressed as ARCHIVE_TGZ,
+// ARCHIVE_TXZ, ARCHIVE_TZST, ARCHIVE_TLZ4 or ARCHIVE_TBR.  Entries are
+// read once, in ForEach's order, and keep their names, modes and
+// modification times; tar keeps access and change times too.  Going to a
+// zip, a tar hard link becomes a copy of what it links to and devices are
+// left out; going to a tar, everything ExtractAllToTarWriter writes is
+// kept.  Of the CreateOptions only WithCompressionLevel and
+// WithCompression apply.  A failed conversion leaves nothing at destPath.
+func Convert(src *ArchiveInfo, destPath string, destType ArchiveType, opts ...CreateOption) (err error) {
+	co, err := buildCreateOptions(opts)
+	if err == nil {
+		err = co.unencrypted(destPath)
+	}
+	if err != nil {
+		return err
+	}
+	if destType != ARCHIVE_ZIP && destType != ARCHIVE_TAR && tarCompressors[destType] == nil {
+		return fmt.Errorf("%s: %w: can't write archive type %d", destPath, ErrUnsupportedFormat, destType)
+	}
+	if src.reader == nil && src.fsys == nil {
+		srcInfo, srcErr := os.Stat(src.fullname)
+		destInfo, destErr := os.Stat(destPath)
+		if srcErr == nil && destErr == nil && os.SameFile(srcInfo, destInfo) {
+			return fmt.Errorf("%s: can't convert an archive onto itself", destPath)
+		}
+	}
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, out.Close())
+		if err != nil {
+			os.Remove(destPath)
+		}
+	}()
+
+	if destType == ARCHIVE_ZIP {
+		zw := newZipWriter(out, co.level)
+		err = src.ForEach(func(af *ArchivedFile, r io.Reader) error { return src.addToZip(zw, af, r, co) })
+		return errors.Join(err, zw.Close())
+	}
+	var w io.WriteCloser = nopWriteCloser{out}
+	if compress := tarCompressors[destType]; compress != nil {
+		if w, err = compress(out, co); err != nil {
+			return err
+		}
+	}
+	tw := tar.NewWriter(w)
+	err = src.ForEach(func(af *ArchivedFile, r io.Reader) error { return af.writeTarEntry(tw, af.name, r, extractOptions{}) })
+	return errors.Join(err, tw.Close(), w.Close())
+}
+
+// The writers for compressed tars.
+var tarCompressors = map[ArchiveType]func(w io.Writer, co createOptions) (io.WriteCloser, error){
+	ARCHIVE_TGZ: func(w io.Writer, co createOptions) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, co.level) },
+	ARCHIVE_TXZ: func(w io.Writer, co createOptions) (io.WriteCloser, error) { return xz.NewWriter(w) },
+	ARCHIVE_TZST: func(w io.Writer, co createOptions) (io.WriteCloser, error) {
+		if co.zstdLevel == 0 {
+			return zstd.NewWriter(w)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(co.zstdLevel)))
+	},
+	ARCHIVE_TLZ4: func(w io.Writer, co createOptions) (io.WriteCloser, error) { return lz4.NewWriter(w), nil },
+	ARCHIVE_TBR:  func(w io.Writer, co createOptions) (io.WriteCloser, error) { return brotli.NewWriter(w), nil },
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// Write af, with content r, to zw as writeTarEntry would to a tar.  Zip
+// keeps a symlink's target as its content.  A hard link's content is read
+// from the entry it links to.
+func (ai *ArchiveInfo) addToZip(zw *zip.Writer, af *ArchivedFile, r io.Reader, co createOptions) error {
+	head := &zip.FileHeader{Name: af.name, Modified: af.modTime, Method: zip.Store}
+	head.SetMode(af.mode)
+	switch {
+	case af.isDir():
+		head.SetMode(af.mode | fs.ModeDir)
+		if !strings.HasSuffix(head.Name, "/") {
+			head.Name += "/"
+		}
+		r = strings.NewReader("")
+	case af.mode&fs.ModeSymlink != 0:
+		if af.linkname != "" { // tar keeps it in the header
+			r = strings.NewReader(af.linkname)
+		}
+	case af.hardlink:
+		target := ai.File(af.linkname)
+		if target == nil {
+			return fmt.Errorf("%s: hard link to missing %s", af.name, af.linkname)
+		}
+		content, err := target.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", af.name, err)
+		}
+		defer content.Close()
+		head.SetMode(target.mode)
+		head.Method, r = co.zipMethod(af.name), content
+	case af.mode.IsRegular():
+		head.Method = co.zipMethod(af.name)
+	default:
+		return nil
+	}
+	if err := writeZipEntry(zw, head, r); err != nil {
+		return fmt.Errorf("%s: %w", af.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		asset string
+		to    ArchiveType
+		ext   string
+	}{
+		{"tgz_test.tgz", ARCHIVE_ZIP, ".zip"},
+		{"test.tar", ARCHIVE_ZIP, ".zip"},
+		{"tree.zip", ARCHIVE_TGZ, ".tgz"},
+		{"test.zip", ARCHIVE_TXZ, ".tar.xz"},
+		{"test.tar", ARCHIVE_TZST, ".tar.zst"},
+		{"tree.zip", ARCHIVE_TLZ4, ".tar.lz4"},
+		{"test.zip", ARCHIVE_TBR, ".tar.br"},
+		{"sz_test.7z", ARCHIVE_TAR, ".tar"},
+	} {
+		src, err := GetArchiveInfo(filepath.Join("testassets", c.asset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest := filepath.Join(dir, c.asset+c.ext)
+		if err := Convert(src, dest, c.to, WithCompressionLevel(9)); err != nil {
+			t.Fatalf("%s to %s: %v", c.asset, c.ext, err)
+		}
+		out, err := GetArchiveInfo(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.ArchiveType != c.to || len(out.Files()) != len(src.Files()) {
+			t.Fatalf("%s to %s: type %d with %d entries", c.asset, c.ext, out.ArchiveType, len(out.Files()))
+		}
+		for i := range src.Files() {
+			want := &src.Files()[i]
+			got := out.File(want.Name())
+			if want.IsDir && got == nil {
+				got = out.File(want.Name() + "/")
+			}
+			if got == nil {
+				t.Errorf("%s to %s: %s missing", c.asset, c.ext, want.Name())
+				continue
+			}
+			// Zip keeps times to the second.
+			if got.Mode() != want.Mode() || got.ModTime().Truncate(time.Second).Unix() != want.ModTime().Unix() {
+				t.Errorf("%s to %s: %s is %v %v, want %v %v", c.asset, c.ext, got.Name(), got.Mode(), got.ModTime(),
+					want.Mode(), want.ModTime())
+			}
+			if got.Mode()&fs.ModeSymlink != 0 && got.Linkname() != want.Linkname() {
+				t.Errorf("%s to %s: %s links to %q, want %q", c.asset, c.ext, got.Name(), got.Linkname(), want.Linkname())
+			}
+			if !want.Mode().IsRegular() {
+				continue
+			}
+			wantData, err := want.GetBytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotData, err := got.GetBytes(); err != nil || !bytes.Equal(gotData, wantData) {
+				t.Errorf("%s to %s: %s reads %d bytes, %v; want %d", c.asset, c.ext, got.Name(), len(gotData), err, len(wantData))
+			}
+		}
+	}
+
+	// A hard link becomes a copy in a zip.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "bin/tool", Mode: 0o755, Size: 4, ModTime: time.Unix(1700000000, 0)})
+	tw.Write([]byte("tool"))
+	tw.WriteHeader(&tar.Header{Name: "bin/alias", Typeflag: tar.TypeLink, Linkname: "bin/tool", ModTime: time.Unix(1700000000, 0)})
+	tw.Close()
+	linked, err := GetArchiveInfoFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(dir, "linked.zip")
+	if err := Convert(linked, dest, ARCHIVE_ZIP); err != nil {
+		t.Fatal(err)
+	}
+	out, err := GetArchiveInfo(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if af := out.File("bin/alias"); af == nil || af.Mode() != 0o755 {
+		t.Errorf("hard link converted to %+v", af)
+	} else if data, err := af.GetBytes(); err != nil || string(data) != "tool" {
+		t.Errorf("hard link reads %q, %v", data, err)
+	}
+
+	src, err := GetArchiveInfo("testassets/test.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest = filepath.Join(dir, "test.rar")
+	if err := Convert(src, dest, ARCHIVE_RAR); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Convert to RAR: %v", err)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		t.Error("Convert to RAR left a file")
+	}
+	if err := Convert(src, "testassets/test.zip", ARCHIVE_ZIP); err == nil {
+		t.Error("Convert onto the source succeeded")
+	}
+}
@@ -0,0 +1,341 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// cpio archives, standalone as in initramfs images or as RPM payloads:
+// SVR4 "newc" headers, with or without their checksum, and POSIX "odc"
+// ones.
+
+const (
+	cpioNewcMagic  = "070701"
+	cpioCRCMagic   = "070702" // newc with a checksum of the data
+	cpioOdcMagic   = "070707"
+	cpioTrailer    = "TRAILER!!!"
+	cpioMaxNameLen = 1 << 16
+)
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_CPIO,
+		detect:      isCpio,
+		load:        loadCpioArchive,
+		open:        openStoredEntry,
+		each:        forEachCpioArchive,
+	})
+}
+
+func isCpio(header []byte) bool {
+	return bytes.HasPrefix(header, []byte(cpioNewcMagic)) || bytes.HasPrefix(header, []byte(cpioCRCMagic)) ||
+		bytes.HasPrefix(header, []byte(cpioOdcMagic))
+}
+
+func loadCpioArchive(ar *ArchiveInfo) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	return ar.listCpio(ARCHIVE_CPIO, src.stream())
+}
+
+func forEachCpioArchive(ai *ArchiveInfo, fn func(*ArchivedFile, io.Reader) error) error {
+	src, err := ai.openSource()
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	defer src.Close()
+	return ai.forEachCpio(src.stream(), fn)
+}
+
+// One cpio header.
+type cpioHeader struct {
+	name   string
+	ino    int64
+	mode   uint32
+	nlink  int64
+	mtime  int64
+	size   int64
+	dev    [2]int64 // Device holding the file, which scopes ino
+	rdev   [2]int64 // Major and minor of a device node
+	offset int64    // Of the data in the stream
+}
+
+// Reads a cpio stream entry by entry, as tar.Reader does: Next moves to
+// the next header, and Read gives that entry's data.
+type cpioReader struct {
+	r    io.Reader
+	n    int64 // Bytes consumed, since padding aligns to the stream's start
+	left int64 // Unread data of the current entry
+	newc bool  // The current entry's data is padded to 4 bytes
+}
+
+func newCpioReader(r io.Reader) *cpioReader {
+	return &cpioReader{r: r}
+}
+
+func (cr *cpioReader) Read(p []byte) (int, error) {
+	if cr.left <= 0 {
+		return 0, io.EOF
+	}
+	n, err := cr.r.Read(p[:min(int64(len(p)), cr.left)])
+	cr.n += int64(n)
+	cr.left -= int64(n)
+	if err == io.EOF && cr.left > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Consume n bytes, failing at a short stream.
+func (cr *cpioReader) skip(n int64) error {
+	copied, err := io.CopyN(io.Discard, cr.r, n)
+	cr.n += copied
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (cr *cpioReader) readFull(buf []byte) error {
+	n, err := io.ReadFull(cr.r, buf)
+	cr.n += int64(n)
+	return err
+}
+
+// Skip to the next 4-byte boundary, where newc pads to.
+func (cr *cpioReader) align() error {
+	if !cr.newc {
+		return nil
+	}
+	return cr.skip(-cr.n & 3)
+}
+
+// The next entry's header, or io.EOF at the trailer.
+func (cr *cpioReader) Next() (*cpioHeader, error) {
+	if err := cr.skip(cr.left); err != nil {
+		return nil, err
+	}
+	cr.left = 0
+	if err := cr.align(); err != nil {
+		return nil, err
+	}
+	at := cr.n
+	magic := make([]byte, 6)
+	if err := cr.readFull(magic); err != nil {
+		return nil, noEOF(err) // No trailer
+	}
+	var h *cpioHeader
+	var nameSize int64
+	var err error
+	switch string(magic) {
+	case cpioNewcMagic, cpioCRCMagic:
+		h, nameSize, err = cr.newcHeader()
+	case cpioOdcMagic:
+		h, nameSize, err = cr.odcHeader()
+	default:
+		return nil, fmt.Errorf("%w: bad cpio header magic %q at %d", ErrCorruptArchive, magic, at)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cpio header at %d: %w", at, err)
+	}
+	if nameSize < 1 || nameSize > cpioMaxNameLen {
+		return nil, fmt.Errorf("%w: bad cpio name size %d", ErrCorruptArchive, nameSize)
+	}
+	name := make([]byte, nameSize)
+	if err := cr.readFull(name); err != nil {
+		return nil, noEOF(err)
+	}
+	h.name = string(bytes.TrimRight(name, "\x00"))
+	if h.name == cpioTrailer {
+		return nil, io.EOF
+	}
+	if err := cr.align(); err != nil {
+		return nil, err
+	}
+	h.offset, cr.left = cr.n, h.size
+	return h, nil
+}
+
+// The rest of a newc header, after the magic, and its name's size.
+func (cr *cpioReader) newcHeader() (*cpioHeader, int64, error) {
+	field, err := cr.fields(13, 8, 16)
+	if err != nil {
+		return nil, 0, err
+	}
+	cr.newc = true
+	return &cpioHeader{ino: field[0], mode: uint32(field[1]), nlink: field[4], mtime: field[5], size: field[6],
+		dev: [2]int64{field[7], field[8]}, rdev: [2]int64{field[9], field[10]}}, field[11], nil
+}
+
+// The rest of an odc header, whose device numbers hold the old 8-bit
+// major and minor.
+func (cr *cpioReader) odcHeader() (*cpioHeader, int64, error) {
+	small, err := cr.fields(7, 6, 8) // dev, ino, mode, uid, gid, nlink, rdev
+	if err != nil {
+		return nil, 0, err
+	}
+	mtime, err := cr.fields(1, 11, 8)
+	if err != nil {
+		return nil, 0, err
+	}
+	nameSize, err := cr.fields(1, 6, 8)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := cr.fields(1, 11, 8)
+	if err != nil {
+		return nil, 0, err
+	}
+	cr.newc = false
+	return &cpioHeader{ino: small[1], mode: uint32(small[2]), nlink: small[5], mtime: mtime[0], size: size[0],
+		dev: [2]int64{small[0] >> 8, small[0] & 0xff}, rdev: [2]int64{small[6] >> 8, small[6] & 0xff}}, nameSize[0], nil
+}
+
+// Read n numbers of width digits in base.
+func (cr *cpioReader) fields(n, width, base int) ([]int64, error) {
+	buf := make([]byte, n*width)
+	if err := cr.readFull(buf); err != nil {
+		return nil, noEOF(err)
+	}
+	field := make([]int64, n)
+	for i := range field {
+		digits := string(buf[i*width : (i+1)*width])
+		v, err := strconv.ParseInt(digits, base, 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%w: bad field %q", ErrCorruptArchive, digits)
+		}
+		field[i] = v
+	}
+	return field, nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Identifies a file across its hardlinked names.
+type cpioInode struct {
+	dev [2]int64
+	ino int64
+}
+
+// List the cpio stream payload as entries of type t: the archive itself
+// for ARCHIVE_CPIO, or a package's decompressed payload.  newc stores a
+// hardlinked file's data with its last name, and the ones before it
+// empty; those are listed after it, as hardlinks to it, the way tar has
+// them.  Symlinks' targets are read from their data.
+func (ar *ArchiveInfo) listCpio(t ArchiveType, payload io.Reader) error {
+	cr := newCpioReader(payload)
+	pending := make(map[cpioInode][]ArchivedFile) // Empty names of a linked file so far
+	var head *cpioHeader
+	var err error
+	for i := 0; ; i++ {
+		if head, err = cr.Next(); err != nil {
+			break
+		}
+		af := ArchivedFile{archivefile: ar.fullname, archivetype: t, name: head.name, size: head.size,
+			mode: unixFileMode(head.mode), packed: -1, index: i}
+		if t == ARCHIVE_CPIO && af.mode.IsRegular() {
+			// Stored as is, so the data can be read in place.
+			af.method, af.packed, af.extents = "Store", af.size, []imageExtent{{head.offset, af.size}}
+		}
+		af.IsDir = af.mode.IsDir()
+		if head.mtime > 0 {
+			af.modTime = time.Unix(head.mtime, 0).UTC()
+		}
+		switch {
+		case af.mode&fs.ModeSymlink != 0:
+			target := make([]byte, min(head.size, cpioMaxNameLen))
+			if _, err = io.ReadFull(cr, target); err != nil {
+				return openError(ar.fullname, noEOF(err))
+			}
+			af.linkname, af.size = string(target), 0
+		case af.mode&fs.ModeDevice != 0:
+			af.devMajor, af.devMinor = head.rdev[0], head.rdev[1]
+		}
+		inode := cpioInode{head.dev, head.ino}
+		if af.mode.IsRegular() && head.nlink > 1 && head.size == 0 {
+			pending[inode] = append(pending[inode], af)
+			continue
+		}
+		if err = ar.addFile(af); err != nil {
+			return err
+		}
+		if links := pending[inode]; af.mode.IsRegular() && len(links) > 0 {
+			delete(pending, inode)
+			for _, link := range links {
+				link.hardlink, link.linkname = true, af.name
+				if err = ar.addFile(link); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err != io.EOF {
+		return openError(ar.fullname, err)
+	}
+	// Names left over were empty files after all.
+	var rest []ArchivedFile
+	for _, links := range pending {
+		rest = append(rest, links...)
+	}
+	slices.SortFunc(rest, func(a, b ArchivedFile) int { return a.index - b.index })
+	for _, af := range rest {
+		if err = ar.addFile(af); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stream payload's entries to fn in one pass, as forEachTar does.
+func (ai *ArchiveInfo) forEachCpio(payload io.Reader, fn func(*ArchivedFile, io.Reader) error) error {
+	cr := newCpioReader(payload)
+	order := ai.archiveOrder()
+	next := 0
+	for i := 0; next < len(order); i++ {
+		if _, err := cr.Next(); err != nil {
+			return openError(ai.fullname, noEOF(err))
+		}
+		af := order[next]
+		if af.index != i {
+			continue
+		}
+		next++
+		if err := fn(af, af.wrapReader(cpioBody(af, cr))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Skip to af in payload and return its content.
+func openCpioEntry(af *ArchivedFile, payload io.Reader) (io.Reader, error) {
+	cr := newCpioReader(payload)
+	for i := 0; i <= af.index; i++ {
+		if _, err := cr.Next(); err != nil {
+			return nil, openError(af.archivefile, noEOF(err))
+		}
+	}
+	return cpioBody(af, cr), nil
+}
+
+// The data of the entry cr is at, if af has any of its own: a symlink's
+// is its target, and a hardlink's is with the name it links to.
+func cpioBody(af *ArchivedFile, cr *cpioReader) io.Reader {
+	if !af.mode.IsRegular() || af.hardlink {
+		return bytes.NewReader(nil)
+	}
+	return cr
+}
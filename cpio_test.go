@@ -0,0 +1,149 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCpioEntry struct {
+	name             string
+	mode             uint32
+	ino, nlink, rdev int
+	body             string
+}
+
+// A cpio stream of entries, with its trailer, in newc or with magic
+// cpioOdcMagic in odc.
+func buildTestCpio(magic string, entries ...testCpioEntry) []byte {
+	var buf bytes.Buffer
+	write := func(e testCpioEntry) {
+		if magic == cpioOdcMagic {
+			fmt.Fprintf(&buf, "%s%06o%06o%06o%06o%06o%06o%06o%011o%06o%011o%s\x00%s", magic, 0o401, e.ino, e.mode, 0, 0,
+				max(e.nlink, 1), e.rdev, 1700000000, len(e.name)+1, len(e.body), e.name, e.body)
+			return
+		}
+		fmt.Fprintf(&buf, "%s%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X", magic,
+			e.ino, e.mode, 0, 0, max(e.nlink, 1), 1700000000, len(e.body), 4, 1, e.rdev>>8, e.rdev&0xff, len(e.name)+1, 0)
+		buf.WriteString(e.name + "\x00")
+		buf.Write(make([]byte, -buf.Len()&3))
+		buf.WriteString(e.body)
+		buf.Write(make([]byte, -buf.Len()&3))
+	}
+	for _, e := range entries {
+		write(e)
+	}
+	write(testCpioEntry{name: cpioTrailer})
+	return buf.Bytes()
+}
+
+func TestCpioReader(t *testing.T) {
+	stream := buildTestCpio(cpioCRCMagic, testCpioEntry{name: "a", mode: 0o100644, ino: 1, body: "one"},
+		testCpioEntry{name: "dir", mode: 0o040755, ino: 2},
+		testCpioEntry{name: "dir/long name", mode: 0o100600, ino: 3, body: "hello, cpio\n"})
+	cr := newCpioReader(bytes.NewReader(stream))
+	var got []string
+	for {
+		head, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(cr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s %o %q", head.name, head.mode, data))
+	}
+	want := []string{`a 100644 "one"`, `dir 40755 ""`, `dir/long name 100600 "hello, cpio\n"`}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("entries %q, want %q", got, want)
+	}
+
+	cr = newCpioReader(bytes.NewReader(stream[:len(stream)-20]))
+	var err error
+	for err == nil {
+		_, err = cr.Next()
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated stream: %v", err)
+	}
+}
+
+var testCpioEntries = []testCpioEntry{
+	{name: ".", mode: 0o040755, ino: 1},
+	{name: "init", mode: 0o100755, ino: 2, body: "#!/bin/sh\nexec /bin/sh\n"},
+	{name: "bin", mode: 0o040755, ino: 3},
+	{name: "bin/sh", mode: 0o120777, ino: 4, body: "busybox"},
+	{name: "bin/ls", mode: 0o100755, ino: 5, nlink: 2},
+	{name: "bin/busybox", mode: 0o100755, ino: 5, nlink: 2, body: "ELF"},
+	{name: "dev/console", mode: 0o020600, ino: 6, rdev: 5<<8 | 1},
+}
+
+func TestCpioArchive(t *testing.T) {
+	for _, magic := range []string{cpioNewcMagic, cpioOdcMagic} {
+		name := filepath.Join(t.TempDir(), "initramfs.cpio")
+		entries := slices.Clone(testCpioEntries)
+		if magic == cpioOdcMagic {
+			entries[4].body = "ELF" // odc stores every name's data; newc only the last's
+		}
+		img := buildTestCpio(magic, entries...)
+		if err := os.WriteFile(name, img, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ai, err := GetArchiveInfo(name)
+		if err != nil {
+			t.Fatalf("%s: %v", magic, err)
+		}
+		var names []string
+		for _, af := range ai.Files() {
+			names = append(names, af.Name())
+		}
+		want := ".,init,bin,bin/sh,bin/busybox,bin/ls,dev/console" // A linked name follows its data
+		if magic == cpioOdcMagic {
+			want = ".,init,bin,bin/sh,bin/ls,bin/busybox,dev/console"
+		}
+		if got := strings.Join(names, ","); ai.ArchiveType != ARCHIVE_CPIO || got != want {
+			t.Fatalf("%s: type %v, entries %s; want %s", magic, ai.ArchiveType, got, want)
+		}
+		init := ai.File("init")
+		if data, err := init.GetBytes(); err != nil || string(data) != "#!/bin/sh\nexec /bin/sh\n" {
+			t.Errorf("%s: init: %q, %v", magic, data, err)
+		}
+		if offset, err := init.DataOffset(); err != nil || string(img[offset:offset+9]) != "#!/bin/sh" {
+			t.Errorf("%s: init: offset %d, %v", magic, offset, err)
+		}
+		if !init.ModTime().Equal(time.Unix(1700000000, 0)) || init.Mode() != 0o755 {
+			t.Errorf("%s: init: mode %v, time %v", magic, init.Mode(), init.ModTime())
+		}
+		if sh := ai.File("bin/sh"); sh.Linkname() != "busybox" {
+			t.Errorf("%s: bin/sh: target %q", magic, sh.Linkname())
+		}
+		if ls := ai.File("bin/ls"); ls.IsHardlink() != (magic == cpioNewcMagic) {
+			t.Errorf("%s: bin/ls: hardlink %v to %q", magic, ls.IsHardlink(), ls.Linkname())
+		}
+		if console := ai.File("dev/console"); console.Mode()&fs.ModeCharDevice == 0 {
+			t.Errorf("%s: dev/console: mode %v", magic, console.Mode())
+		} else if major, minor := console.Device(); major != 5 || minor != 1 {
+			t.Errorf("%s: dev/console: device %d,%d", magic, major, minor)
+		}
+
+		dest := t.TempDir()
+		if err := ai.ExtractAll(dest, WithLinkPolicy(MaterializeLinks)); err != nil {
+			t.Fatalf("%s: %v", magic, err)
+		}
+		if data, err := os.ReadFile(filepath.Join(dest, "bin", "sh")); err != nil || string(data) != "ELF" {
+			t.Errorf("%s: extracted bin/sh: %q, %v", magic, data, err)
+		}
+	}
+}
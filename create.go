@@ -0,0 +1,502 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CreateOption adjusts how an archive is built.  Pass any number to the
+// Create functions.
+type CreateOption func(*createOptions)
+
+type createOptions struct {
+	include      []string               // path.Match patterns files must match; none means all
+	exclude      []string               // path.Match patterns for files and directories to leave out
+	level        int                    // Deflate / gzip level
+	symlinks     SymlinkPolicy          // What to do on meeting a symlink
+	reproducible bool                   // Normalize what the entries record; see Reproducible
+	epoch        time.Time              // SOURCE_DATE_EPOCH, read under Reproducible; zero if unset
+	zstdLevel    int                    // zstd's own 1 to 22; 0 for the encoder's default
+	store        func(name string) bool // Zip entries to store rather than deflate; nil for none
+	solid        bool                   // One 7z folder for all the files
+	password     string                 // Encrypt with this; 7z only
+}
+
+func buildCreateOptions(opts []CreateOption) (createOptions, error) {
+	co := createOptions{level: flate.DefaultCompression}
+	for _, opt := range opts {
+		opt(&co)
+	}
+	if co.reproducible {
+		epoch, err := sourceDateEpoch()
+		if err != nil {
+			return co, err
+		}
+		co.epoch = epoch
+	}
+	if co.level < flate.HuffmanOnly || co.level > flate.BestCompression {
+		return co, fmt.Errorf("archiver: invalid compression level %d", co.level)
+	}
+	if co.zstdLevel < 0 || co.zstdLevel > 22 {
+		return co, fmt.Errorf("archiver: invalid zstd level %d", co.zstdLevel)
+	}
+	for _, pattern := range append(co.include, co.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return co, fmt.Errorf("%q: %w", pattern, err)
+		}
+	}
+	return co, nil
+}
+
+// Only add files matching one of patterns.  A pattern, in the syntax of
+// path.Match, can match the entry's whole name ("src/*.go") or just its
+// last element ("*.go").  Directories are always walked, and only written
+// when they hold something that was added.
+func Include(patterns ...string) CreateOption {
+	return func(co *createOptions) { co.include = append(co.include, patterns...) }
+}
+
+// Leave out files and directories matching one of patterns, matched as for
+// Include.  An excluded directory isn't walked at all.  Exclude wins over
+// Include.
+func Exclude(patterns ...string) CreateOption {
+	return func(co *createOptions) { co.exclude = append(co.exclude, patterns...) }
+}
+
+// Compress at level, from flate.NoCompression (0) through
+// flate.BestCompression (9), rather than flate.DefaultCompression.  Applies
+// to zip's deflated entries and to tar.gz.
+func WithCompressionLevel(level int) CreateOption {
+	return func(co *createOptions) { co.level = level }
+}
+
+// How archives are compressed, for WithCompression.  Zero fields keep the
+// defaults.
+type Compression struct {
+	// Deflate and gzip level, flate.HuffmanOnly (-2) through
+	// flate.BestCompression (9).  Zero keeps WithCompressionLevel's, or
+	// flate.DefaultCompression; use WithCompressionLevel for
+	// flate.NoCompression.
+	Level int
+	// zstd level, on zstd's own scale of 1 (fastest) to 22 (smallest),
+	// mapped to the nearest the encoder has.
+	ZstdLevel int
+	// Reports whether a zip entry should be stored rather than deflated,
+	// given its name.  AlreadyCompressed stores images, video, audio and
+	// archives, which deflate gains next to nothing on.  nil deflates
+	// every file.
+	Store func(name string) bool
+}
+
+// Compress as c says.  Applies to CreateZip, CreateTarGz, Convert and Add.
+func WithCompression(c Compression) CreateOption {
+	return func(co *createOptions) {
+		if c.Level != 0 {
+			co.level = c.Level
+		}
+		co.zstdLevel, co.store = c.ZstdLevel, c.Store
+	}
+}
+
+// Extensions of formats that are compressed already.
+var compressedExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".avif": true, ".heic": true,
+	".mp4": true, ".m4v": true, ".mov": true, ".mkv": true, ".webm": true, ".avi": true,
+	".mp3": true, ".m4a": true, ".aac": true, ".ogg": true, ".opus": true, ".flac": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".lz4": true, ".br": true, ".jar": true, ".apk": true, ".docx": true, ".xlsx": true, ".pptx": true,
+	".epub": true, ".woff": true, ".woff2": true, ".pdf": true,
+}
+
+// Reports whether name's extension is one of a format that's compressed
+// already, such as .png, .mp4 or .zip.  For Compression.Store.
+func AlreadyCompressed(name string) bool {
+	return compressedExtensions[strings.ToLower(path.Ext(name))]
+}
+
+// The zip method for a file entry called name.
+func (co createOptions) zipMethod(name string) uint16 {
+	if co.store != nil && co.store(name) {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// What the Create functions do on meeting a symlink.
+type SymlinkPolicy int
+
+const (
+	StoreSymlinks  SymlinkPolicy = iota // Add the link itself (the default)
+	FollowSymlinks                      // Add what it points to, under the link's name
+	SkipSymlinks                        // Leave it out
+)
+
+// Choose how symlinks are added.  See SymlinkPolicy.
+func WithSymlinks(policy SymlinkPolicy) CreateOption {
+	return func(co *createOptions) { co.symlinks = policy }
+}
+
+// Reports whether name or its last element matches any of patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, path.Base(name)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Called for each file or directory to add, under its entry name.
+type addFunc func(name, osPath string, info fs.FileInfo) error
+
+type walkedPath struct {
+	name   string
+	osPath string
+	info   fs.FileInfo
+}
+
+// Walks sources for the Create functions.
+type walker struct {
+	co       createOptions
+	skipInfo fs.FileInfo // The archive being written
+	add      addFunc
+	// With Include, directories wait here until a file under them is
+	// added.  The walk is depth first, so these are always ancestors of
+	// the current path, outermost first.
+	pending []walkedPath
+	roots   []string // Real paths of the trees being walked, for FollowSymlinks
+}
+
+// Walk sources in lexical order, calling add for what the options let
+// through.  A directory source's own name is the top of its entries, as
+// with "zip -r"; "." and "/" put their contents at the top instead.  skip
+// is left out wherever it turns up, so an archive written inside a source
+// doesn't swallow itself.
+func walkSources(sources []string, skip string, co createOptions, add addFunc) error {
+	var found []walkedPath
+	w := &walker{co: co, add: add}
+	if co.reproducible {
+		w.add = func(name, osPath string, info fs.FileInfo) error {
+			found = append(found, walkedPath{name, osPath, info})
+			return nil
+		}
+	}
+	w.skipInfo, _ = os.Stat(skip)
+	for _, src := range sources {
+		src = filepath.Clean(src)
+		if _, err := os.Lstat(src); err != nil {
+			return err
+		}
+		prefix := filepath.Base(src)
+		if prefix == "." || !fs.ValidPath(prefix) {
+			prefix = ""
+		}
+		w.pending = w.pending[:0]
+		if err := w.walkRoot(src, prefix); err != nil {
+			return err
+		}
+	}
+	return addSorted(found, add)
+}
+
+// Walk the tree at src, naming its entries under prefix.
+func (w *walker) walkRoot(src, prefix string) error {
+	resolved, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	w.roots = append(w.roots, resolved)
+	defer func() { w.roots = w.roots[:len(w.roots)-1] }()
+	return filepath.WalkDir(src, func(osPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, osPath)
+		if err != nil {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		if name == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if w.skipInfo != nil && os.SameFile(info, w.skipInfo) {
+			return nil
+		}
+		if matchesAny(w.co.exclude, name) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&fs.ModeSymlink != 0 && w.co.symlinks != StoreSymlinks {
+			return w.symlink(name, osPath)
+		}
+		w.leave(name)
+		if d.IsDir() {
+			if len(w.co.include) == 0 {
+				return w.add(name, osPath, info)
+			}
+			w.pending = append(w.pending, walkedPath{name, osPath, info})
+			return nil
+		}
+		return w.file(name, osPath, info)
+	})
+}
+
+// Drop waiting directories that name isn't under.
+func (w *walker) leave(name string) {
+	for len(w.pending) > 0 && !strings.HasPrefix(name, w.pending[len(w.pending)-1].name+"/") {
+		w.pending = w.pending[:len(w.pending)-1]
+	}
+}
+
+// Add a file or symlink that Include lets through, after any directories
+// waiting on it.
+func (w *walker) file(name, osPath string, info fs.FileInfo) error {
+	if len(w.co.include) > 0 && !matchesAny(w.co.include, name) {
+		return nil
+	}
+	for _, dir := range w.pending {
+		if err := w.add(dir.name, dir.osPath, dir.info); err != nil {
+			return err
+		}
+	}
+	w.pending = w.pending[:0]
+	return w.add(name, osPath, info)
+}
+
+// Skip or follow a symlink.  A followed link to a directory is walked as
+// if the directory were there, unless it leads back to one of its own
+// ancestors or to a tree already being walked, in which case it's skipped
+// rather than walked forever.
+func (w *walker) symlink(name, osPath string) error {
+	if w.co.symlinks == SkipSymlinks {
+		return nil
+	}
+	target, err := filepath.EvalSymlinks(osPath)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		w.leave(name)
+		return w.file(name, target, info)
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(osPath))
+	if err != nil {
+		return err
+	}
+	for _, dir := range append(w.roots, parent) {
+		if dir == target || strings.HasPrefix(dir, target+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return w.walkRoot(target, name)
+}
+
+// Write a zip archive at destPath holding sources, each a file or a
+// directory to walk.  Modes and modification times are kept, unless
+// Reproducible normalizes them.  Files are deflated; symlinks are stored
+// as links, with the target as content, as Info-ZIP does with -y, unless
+// WithSymlinks says otherwise.  Devices, pipes and sockets are left out.
+// If anything fails, destPath is removed.
+func CreateZip(destPath string, sources []string, opts ...CreateOption) (err error) {
+	co, err := buildCreateOptions(opts)
+	if err == nil {
+		err = co.unencrypted(destPath)
+	}
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	zw := newZipWriter(out, co.level)
+	defer func() {
+		err = errors.Join(err, zw.Close(), out.Close())
+		if err != nil {
+			os.Remove(destPath)
+		}
+	}()
+	return walkSources(sources, destPath, co, func(name, osPath string, info fs.FileInfo) error {
+		if err := addZipEntry(zw, name, osPath, info, co); err != nil {
+			return fmt.Errorf("%s: %w", osPath, err)
+		}
+		return nil
+	})
+}
+
+// A zip.Writer that deflates at level.
+func newZipWriter(w io.Writer, level int) *zip.Writer {
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	})
+	return zw
+}
+
+func addZipEntry(zw *zip.Writer, name, osPath string, info fs.FileInfo, co createOptions) error {
+	mode := info.Mode()
+	if !mode.IsRegular() && !mode.IsDir() && mode&fs.ModeSymlink == 0 {
+		return nil
+	}
+	head, err := zipHeader(name, info, co)
+	if err != nil {
+		return err
+	}
+	w, err := zw.CreateHeader(head)
+	if err != nil || mode.IsDir() {
+		return err
+	}
+	if mode&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(osPath)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, target)
+		return err
+	}
+	f, err := os.Open(osPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// The header CreateZip writes for an entry called name.
+func zipHeader(name string, info fs.FileInfo, co createOptions) (*zip.FileHeader, error) {
+	head, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	head.Name = name
+	if co.reproducible {
+		normal, mtime := co.entryMeta(info)
+		head.SetMode(normal)
+		setZipDOSTime(head, mtime)
+	}
+	switch mode := info.Mode(); {
+	case mode.IsDir():
+		head.Name += "/"
+		head.Method = zip.Store
+	case mode&fs.ModeSymlink != 0:
+		head.Method = zip.Store
+	default:
+		head.Method = co.zipMethod(name)
+	}
+	return head, nil
+}
+
+// Write a gzip-compressed tar archive at destPath holding sources, as
+// CreateZip does, with the gzip level from WithCompressionLevel.  The
+// output is reproducible: entries go in the same order for the same tree
+// (each source in turn, walked in lexical order), owners are written as
+// uid and gid 0 with no names, access and change times are left out, and
+// the gzip header carries no name or time.  Modification times are kept,
+// so the content and mtimes are all that decide the bytes; Reproducible
+// fixes the mtimes too.
+func CreateTarGz(destPath string, sources []string, opts ...CreateOption) (err error) {
+	co, err := buildCreateOptions(opts)
+	if err == nil {
+		err = co.unencrypted(destPath)
+	}
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	gw, err := gzip.NewWriterLevel(out, co.level)
+	if err != nil {
+		out.Close()
+		os.Remove(destPath)
+		return err
+	}
+	tw := tar.NewWriter(gw)
+	defer func() {
+		err = errors.Join(err, tw.Close(), gw.Close(), out.Close())
+		if err != nil {
+			os.Remove(destPath)
+		}
+	}()
+	return walkSources(sources, destPath, co, func(name, osPath string, info fs.FileInfo) error {
+		if err := addTarEntry(tw, name, osPath, info, co); err != nil {
+			return fmt.Errorf("%s: %w", osPath, err)
+		}
+		return nil
+	})
+}
+
+func addTarEntry(tw *tar.Writer, name, osPath string, info fs.FileInfo, co createOptions) error {
+	mode := info.Mode()
+	if !mode.IsRegular() && !mode.IsDir() && mode&fs.ModeSymlink == 0 {
+		return nil
+	}
+	var link string
+	if mode&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(osPath)
+		if err != nil {
+			return err
+		}
+		link = target
+	}
+	head, err := tarHeader(name, info, link, co)
+	if err != nil {
+		return err
+	}
+	if err = tw.WriteHeader(head); err != nil || !mode.IsRegular() {
+		return err
+	}
+	f, err := os.Open(osPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// The header CreateTarGz writes for an entry called name, linking to link
+// if it's a symlink.
+func tarHeader(name string, info fs.FileInfo, link string, co createOptions) (*tar.Header, error) {
+	head, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, err
+	}
+	head.Name = name
+	if info.IsDir() {
+		head.Name += "/"
+	}
+	head.Uid, head.Gid, head.Uname, head.Gname = 0, 0, "", ""
+	if co.reproducible {
+		normal, mtime := co.entryMeta(info)
+		head.Mode, head.ModTime = int64(normal.Perm()), mtime
+	}
+	head.AccessTime, head.ChangeTime = time.Time{}, time.Time{}
+	return head, nil
+}
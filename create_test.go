@@ -0,0 +1,227 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Lay out a small source tree under dir and return its root.
+func writeTestTree(t *testing.T, dir string) string {
+	t.Helper()
+	root := filepath.Join(dir, "project")
+	files := map[string]string{
+		"README.md":        "# Project\n",
+		"src/main.go":      "package main\n",
+		"src/util/util.go": "package util\n",
+		"src/notes.txt":    "todo\n",
+		".git/HEAD":        "ref: refs/heads/main\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Chmod(filepath.Join(root, "src/main.go"), 0o755)
+	os.Mkdir(filepath.Join(root, "empty"), 0o755)
+	if err := os.Symlink("README.md", filepath.Join(root, "LINK")); err != nil {
+		t.Fatal(err)
+	}
+	stamp := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	os.Chtimes(filepath.Join(root, "README.md"), stamp, stamp)
+	return root
+}
+
+func entryNames(ar *ArchiveInfo) []string {
+	var names []string
+	for _, af := range ar.Files() {
+		names = append(names, af.Name())
+	}
+	return names
+}
+
+func TestCreateZip(t *testing.T) {
+	dir := t.TempDir()
+	root := writeTestTree(t, dir)
+	dest := filepath.Join(dir, "out.zip")
+	if err := CreateZip(dest, []string{root}, Exclude(".git")); err != nil {
+		t.Fatalf("CreateZip() error = %v", err)
+	}
+	ar, err := GetArchiveInfo(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"project/", "project/LINK", "project/README.md", "project/empty/", "project/src/",
+		"project/src/main.go", "project/src/notes.txt", "project/src/util/", "project/src/util/util.go"}
+	if got := entryNames(ar); !slices.Equal(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	readme := ar.File("project/README.md")
+	if data, _ := readme.GetBytes(); string(data) != "# Project\n" {
+		t.Errorf("README.md = %q", data)
+	}
+	if !readme.ModTime().Equal(time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)) {
+		t.Errorf("README.md mtime = %v", readme.ModTime())
+	}
+	if mode := ar.File("project/src/main.go").Mode(); mode.Perm() != 0o755 {
+		t.Errorf("main.go mode = %v", mode)
+	}
+	link := ar.File("project/LINK")
+	if target, _ := link.GetBytes(); link.Mode()&os.ModeSymlink == 0 || string(target) != "README.md" {
+		t.Errorf("LINK = %v -> %q, want a symlink to README.md", link.Mode(), target)
+	}
+}
+
+func TestCreateZipInclude(t *testing.T) {
+	dir := t.TempDir()
+	root := writeTestTree(t, dir)
+	dest := filepath.Join(root, "go.zip") // Inside the source; must not be added to itself
+	if err := CreateZip(dest, []string{root}, Include("*.go"), Exclude("util")); err != nil {
+		t.Fatalf("CreateZip() error = %v", err)
+	}
+	ar, err := GetArchiveInfo(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := entryNames(ar), []string{"project/", "project/src/", "project/src/main.go"}; !slices.Equal(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+
+	if err = CreateZip(filepath.Join(dir, "bad.zip"), []string{root}, Include("[")); err == nil {
+		t.Error("CreateZip() accepted a bad pattern")
+	}
+	if _, err = os.Stat(filepath.Join(dir, "bad.zip")); !os.IsNotExist(err) {
+		t.Error("CreateZip() left bad.zip behind")
+	}
+}
+
+func TestCreateTarGz(t *testing.T) {
+	dir := t.TempDir()
+	root := writeTestTree(t, dir)
+	first, second := filepath.Join(dir, "a.tgz"), filepath.Join(dir, "b.tgz")
+	for _, dest := range []string{first, second} {
+		if err := CreateTarGz(dest, []string{root}, Exclude(".git")); err != nil {
+			t.Fatalf("CreateTarGz() error = %v", err)
+		}
+	}
+	a, _ := os.ReadFile(first)
+	b, _ := os.ReadFile(second)
+	if !bytes.Equal(a, b) {
+		t.Error("two runs over the same tree differ")
+	}
+	ar, err := GetArchiveInfo(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"project/", "project/LINK", "project/README.md", "project/empty/", "project/src/",
+		"project/src/main.go", "project/src/notes.txt", "project/src/util/", "project/src/util/util.go"}
+	if got := entryNames(ar); !slices.Equal(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	if data, _ := ar.File("project/src/notes.txt").GetBytes(); string(data) != "todo\n" {
+		t.Errorf("notes.txt = %q", data)
+	}
+	if mode := ar.File("project/src/main.go").Mode(); mode.Perm() != 0o755 {
+		t.Errorf("main.go mode = %v", mode)
+	}
+	if link := ar.File("project/LINK"); link.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("LINK mode = %v, want a symlink", link.Mode())
+	}
+
+	stored := filepath.Join(dir, "stored.tgz")
+	if err = CreateTarGz(stored, []string{root}, WithCompressionLevel(flate.NoCompression)); err != nil {
+		t.Fatalf("CreateTarGz(NoCompression) error = %v", err)
+	}
+	if info, _ := os.Stat(stored); info.Size() <= int64(len(a)) {
+		t.Errorf("uncompressed size %d <= compressed %d", info.Size(), len(a))
+	}
+	if err = CreateTarGz(filepath.Join(dir, "bad.tgz"), []string{root}, WithCompressionLevel(12)); err == nil {
+		t.Error("CreateTarGz() accepted level 12")
+	}
+}
+
+func TestCreateSymlinkPolicy(t *testing.T) {
+	dir := t.TempDir()
+	root := writeTestTree(t, dir)
+	// Following this would walk forever.
+	if err := os.Symlink("..", filepath.Join(root, "src/up")); err != nil {
+		t.Fatal(err)
+	}
+	followed := filepath.Join(dir, "followed.zip")
+	if err := CreateZip(followed, []string{root}, WithSymlinks(FollowSymlinks), Exclude(".git")); err != nil {
+		t.Fatalf("CreateZip(FollowSymlinks) error = %v", err)
+	}
+	ar, err := GetArchiveInfo(followed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := ar.File("project/LINK")
+	if data, _ := link.GetBytes(); !link.Mode().IsRegular() || string(data) != "# Project\n" {
+		t.Errorf("LINK = %v %q, want README.md's content", link.Mode(), data)
+	}
+	if ar.File("project/src/up/") != nil {
+		t.Error("followed a link back to its own ancestor")
+	}
+
+	skipped := filepath.Join(dir, "skipped.tgz")
+	if err = CreateTarGz(skipped, []string{root}, WithSymlinks(SkipSymlinks)); err != nil {
+		t.Fatalf("CreateTarGz(SkipSymlinks) error = %v", err)
+	}
+	if ar, err = GetArchiveInfo(skipped); err != nil {
+		t.Fatal(err)
+	}
+	if ar.File("project/LINK") != nil || ar.File("project/src/up") != nil {
+		t.Error("SkipSymlinks added a symlink")
+	}
+}
+
+func TestWithCompression(t *testing.T) {
+	dir := t.TempDir()
+	root := writeTestTree(t, dir)
+	png := bytes.Repeat([]byte("not really a png "), 100)
+	if err := os.WriteFile(filepath.Join(root, "logo.PNG"), png, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(dir, "out.zip")
+	if err := CreateZip(dest, []string{root}, WithCompression(Compression{Level: 9, Store: AlreadyCompressed})); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		want := zip.Deflate
+		if f.Name == "project/logo.PNG" || f.Mode()&(os.ModeDir|os.ModeSymlink) != 0 {
+			want = zip.Store
+		}
+		if f.Method != want {
+			t.Errorf("%s: method %d, want %d", f.Name, f.Method, want)
+		}
+	}
+
+	src, err := GetArchiveInfo(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tzst := filepath.Join(dir, "out.tar.zst")
+	if err := Convert(src, tzst, ARCHIVE_TZST, WithCompression(Compression{ZstdLevel: 19})); err != nil {
+		t.Fatal(err)
+	}
+	if ai, err := GetArchiveInfo(tzst); err != nil || len(ai.Files()) != len(src.Files()) {
+		t.Errorf("zstd level 19: %v", err)
+	}
+	if err := CreateZip(filepath.Join(dir, "bad.zip"), []string{root}, WithCompression(Compression{ZstdLevel: 23})); err == nil {
+		t.Error("CreateZip accepted zstd level 23")
+	}
+}
@@ -0,0 +1,132 @@
+package archiver
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Number of leading bytes DetectType wants to see: enough to reach the
+// ustar magic in a tar header.
+const sniffLength = 262
+
+// Classify data by its leading magic bytes.  header should hold at least
+// sniffLength bytes, more for a longer signature given to RegisterMagic;
+// shorter input only matches signatures that fit.
+func DetectType(header []byte) ArchiveType {
+	switch {
+	case bytes.HasPrefix(header, []byte{0x50, 0x4B, 0x03, 0x04}):
+		return ARCHIVE_ZIP
+	case bytes.HasPrefix(header, []byte{0x37, 0x7A, 0xBC, 0xAF}):
+		return ARCHIVE_7Z
+	case bytes.HasPrefix(header, []byte{0x1F, 0x8B}):
+		return ARCHIVE_TGZ
+	case bytes.HasPrefix(header, rar4Magic), bytes.HasPrefix(header, rar5Magic):
+		return ARCHIVE_RAR
+	case len(header) >= 10 && bytes.HasPrefix(header, []byte("BZh")) && header[3] >= '1' && header[3] <= '9' &&
+		bytes.Equal(header[4:10], []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}):
+		return ARCHIVE_TBZ2
+	case bytes.HasPrefix(header, []byte{0xFD, 0x37, 0x7A, 0x58, 0x5A, 0x00}):
+		return ARCHIVE_TXZ
+	case bytes.HasPrefix(header, []byte{0x28, 0xB5, 0x2F, 0xFD}):
+		return ARCHIVE_TZST
+	case bytes.HasPrefix(header, []byte{0x04, 0x22, 0x4D, 0x18}):
+		return ARCHIVE_TLZ4
+	case bytes.HasPrefix(header, []byte{0x1F, 0x9D}):
+		return ARCHIVE_TZ
+	case bytes.HasPrefix(header, []byte("LZIP\x01")):
+		return ARCHIVE_TLZ
+	case len(header) >= sniffLength && bytes.Equal(header[257:262], []byte("ustar")):
+		return ARCHIVE_TAR
+	}
+	return detectOptional(header)
+}
+
+// Sniff the type of a stream without losing data.  The returned reader
+// replays the bytes consumed for detection followed by the rest of r, so
+// it can be handed on as if r had never been touched.  A stream shorter
+// than the sniff length is not an error; it's classified on what there is.
+func PeekType(r io.Reader) (ArchiveType, io.Reader, error) {
+	header := make([]byte, headerLength())
+	n, err := io.ReadFull(r, header)
+	replay := io.MultiReader(bytes.NewReader(header[:n]), r)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err != nil {
+		return ARCHIVE_UNINIT, replay, err
+	}
+	return DetectType(header[:n]), replay, nil
+}
+
+// Sniff the start of the entry's content to predict whether it's an
+// archive itself, without decompressing more than the first few bytes.
+// Directories, empty entries and entries that can't be read report false.
+// A nested archive can then be opened with GetArchiveInfoFromReader over
+// its GetBytes.
+func (af *ArchivedFile) LooksLikeArchive() (bool, ArchiveType) {
+	if af.IsDir || af.size == 0 {
+		return false, ARCHIVE_NA
+	}
+	readCloser, err := af.Open()
+	if err != nil {
+		return false, ARCHIVE_NA
+	}
+	defer readCloser.Close()
+	header := make([]byte, headerLength())
+	n, err := io.ReadFull(readCloser, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, ARCHIVE_NA
+	}
+	t := DetectType(header[:n])
+	return t != ARCHIVE_NA, t
+}
+
+// Extensions, longest first where one is a suffix of another, and the type
+// a file carrying them claims to be.  Zip-based container formats count as
+// zip.
+var extensionTypes = []struct {
+	ext         string
+	archiveType ArchiveType
+}{
+	{".tar.gz", ARCHIVE_TGZ}, {".tgz", ARCHIVE_TGZ}, {".gz", ARCHIVE_GZ},
+	{".tar.bz2", ARCHIVE_TBZ2}, {".tbz2", ARCHIVE_TBZ2}, {".tbz", ARCHIVE_TBZ2}, {".bz2", ARCHIVE_BZ2},
+	{".tar.xz", ARCHIVE_TXZ}, {".txz", ARCHIVE_TXZ}, {".xz", ARCHIVE_XZ},
+	{".tar.zst", ARCHIVE_TZST}, {".tzst", ARCHIVE_TZST}, {".zst", ARCHIVE_ZST},
+	{".tar.br", ARCHIVE_TBR}, {".tbr", ARCHIVE_TBR}, {".br", ARCHIVE_BR},
+	{".tar.lz4", ARCHIVE_TLZ4}, {".tlz4", ARCHIVE_TLZ4}, {".lz4", ARCHIVE_LZ4},
+	{".tar.z", ARCHIVE_TZ}, {".taz", ARCHIVE_TZ}, {".z", ARCHIVE_Z},
+	{".tar.lz", ARCHIVE_TLZ}, {".tlz", ARCHIVE_TLZ}, {".lz", ARCHIVE_LZ},
+	{".tar", ARCHIVE_TAR}, {".7z", ARCHIVE_7Z}, {".rar", ARCHIVE_RAR},
+	{".zip", ARCHIVE_ZIP}, {".docx", ARCHIVE_ZIP}, {".xlsx", ARCHIVE_ZIP}, {".pptx", ARCHIVE_ZIP},
+	{".odt", ARCHIVE_ZIP}, {".ods", ARCHIVE_ZIP}, {".odp", ARCHIVE_ZIP}, {".epub", ARCHIVE_ZIP},
+	{".jar", ARCHIVE_ZIP}, {".war", ARCHIVE_ZIP}, {".ear", ARCHIVE_ZIP}, {".apk", ARCHIVE_ZIP},
+	{".aar", ARCHIVE_ZIP}, {".ipa", ARCHIVE_ZIP}, {".xpi", ARCHIVE_ZIP}, {".nupkg", ARCHIVE_ZIP},
+	{".whl", ARCHIVE_ZIP}, {".iso", ARCHIVE_ISO}, {".deb", ARCHIVE_AR}, {".udeb", ARCHIVE_AR},
+	{".a", ARCHIVE_AR}, {".rpm", ARCHIVE_RPM}, {".cpio", ARCHIVE_CPIO},
+	{".cab", ARCHIVE_CAB}, {".squashfs", ARCHIVE_SQUASHFS}, {".sqfs", ARCHIVE_SQUASHFS}, {".sqsh", ARCHIVE_SQUASHFS},
+	{".snap", ARCHIVE_SQUASHFS}, {".dmg", ARCHIVE_DMG}, {".xar", ARCHIVE_XAR}, {".pkg", ARCHIVE_XAR}, {".xip", ARCHIVE_XAR},
+	{".lzh", ARCHIVE_LHA}, {".lha", ARCHIVE_LHA}, {".arj", ARCHIVE_ARJ},
+	{".wim", ARCHIVE_WIM}, {".esd", ARCHIVE_WIM},
+}
+
+// The archive type a file name claims by its extension (case-insensitive),
+// or ARCHIVE_NA if the extension isn't one we know.
+func TypeFromExtension(name string) ArchiveType {
+	name = strings.ToLower(name)
+	for _, et := range extensionTypes {
+		if strings.HasSuffix(name, et.ext) {
+			return et.archiveType
+		}
+	}
+	return ARCHIVE_NA
+}
+
+// The type the archive's file name claims, as opposed to ArchiveType, which
+// comes from its content.
+func (ai *ArchiveInfo) ClaimedType() ArchiveType { return TypeFromExtension(ai.name) }
+
+// Reports whether the file extension agrees with the detected type, for
+// warning about e.g. a .zip that is really a 7z.  Non-archives with
+// non-archive extensions match.
+func (ai *ArchiveInfo) ExtensionMatchesType() bool { return ai.ClaimedType() == ai.ArchiveType }
@@ -0,0 +1,106 @@
+package archiver
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPeekType(t *testing.T) {
+	file, err := os.Open("testassets/test.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	archiveType, replay, err := PeekType(file)
+	if err != nil {
+		t.Fatalf("PeekType() error = %v", err)
+	}
+	if archiveType != ARCHIVE_ZIP {
+		t.Errorf("PeekType() type = %v, want ARCHIVE_ZIP", archiveType)
+	}
+
+	// The replayed stream has to be the whole archive, magic included.
+	copyPath := filepath.Join(t.TempDir(), "replayed.zip")
+	out, _ := os.Create(copyPath)
+	if _, err = io.Copy(out, replay); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	ar, err := GetArchiveInfo(copyPath)
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() on replayed stream error = %v", err)
+	}
+	if len(ar.Files()) != 2 || ar.File("dirhelp.txt") == nil {
+		t.Errorf("replayed stream lists %d files", len(ar.Files()))
+	}
+
+	// Short streams are classified, not rejected.
+	archiveType, replay, err = PeekType(strings.NewReader("hi"))
+	if err != nil || archiveType != ARCHIVE_NA {
+		t.Errorf("PeekType(short) = %v, %v", archiveType, err)
+	}
+	if rest, _ := io.ReadAll(replay); string(rest) != "hi" {
+		t.Errorf("short replay = %q", rest)
+	}
+}
+
+func TestExtensionMatchesType(t *testing.T) {
+	dir := t.TempDir()
+	zipBytes, _ := os.ReadFile("testassets/test.zip")
+	disguised := filepath.Join(dir, "really_a_zip.7Z")
+	os.WriteFile(disguised, zipBytes, 0o644)
+
+	testdata := []struct {
+		filename string
+		claimed  ArchiveType
+		matches  bool
+	}{{"testassets/test.zip", ARCHIVE_ZIP, true},
+		{"testassets/Test Doc.docx", ARCHIVE_ZIP, true},
+		{"testassets/tgz_test.tgz", ARCHIVE_TGZ, true},
+		{"testassets/sz_test.7z", ARCHIVE_7Z, true},
+		{disguised, ARCHIVE_7Z, false},
+	}
+	for _, test := range testdata {
+		ar, err := GetArchiveInfo(test.filename)
+		if err != nil {
+			t.Fatalf("%s error = %v", test.filename, err)
+		}
+		if ar.ClaimedType() != test.claimed {
+			t.Errorf("%s ClaimedType() = %v, want %v", test.filename, ar.ClaimedType(), test.claimed)
+		}
+		if ar.ExtensionMatchesType() != test.matches {
+			t.Errorf("%s ExtensionMatchesType() = %v", test.filename, !test.matches)
+		}
+	}
+	if TypeFromExtension("release.TAR.GZ") != ARCHIVE_TGZ || TypeFromExtension("notes.txt") != ARCHIVE_NA {
+		t.Error("TypeFromExtension() mismatch")
+	}
+}
+
+func TestLooksLikeArchive(t *testing.T) {
+	nested, err := os.ReadFile("testassets/tgz_test.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestZip(t, t.TempDir(), "outer.zip", [][2]string{
+		{"inner.tgz", string(nested)},
+		{"readme.txt", "not an archive"},
+		{"empty.bin", ""},
+	})
+	ar, err := GetArchiveInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, kind := ar.File("inner.tgz").LooksLikeArchive(); !ok || kind != ARCHIVE_TGZ {
+		t.Errorf("inner.tgz LooksLikeArchive() = %v, %v", ok, kind)
+	}
+	for _, name := range []string{"readme.txt", "empty.bin"} {
+		if ok, kind := ar.File(name).LooksLikeArchive(); ok || kind != ARCHIVE_NA {
+			t.Errorf("%s LooksLikeArchive() = %v, %v", name, ok, kind)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package archiver
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// mknod the device entry at target, if running as root.
+func (af *ArchivedFile) makeDevice(destDir, target string, eo extractOptions) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	if err := mkdirUnder(destDir, filepath.Dir(target)); err != nil {
+		return err
+	}
+	mode := uint32(af.mode.Perm())
+	if af.mode&fs.ModeCharDevice != 0 {
+		mode |= syscall.S_IFCHR
+	} else {
+		mode |= syscall.S_IFBLK
+	}
+	if err := syscall.Mknod(target, mode, mkdev(af.devMajor, af.devMinor)); err != nil {
+		return &os.PathError{Op: "mknod", Path: target, Err: err}
+	}
+	if atime, mtime := af.extractTimes(eo); !mtime.IsZero() {
+		return os.Chtimes(target, atime, mtime)
+	}
+	return nil
+}
+
+// glibc's makedev encoding.
+func mkdev(major, minor int64) int {
+	return int(minor&0xff | (major&0xfff)<<8 | (minor&^0xff)<<12 | (major&^0xfff)<<32)
+}
@@ -0,0 +1,33 @@
+package archiver
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCreateDevices(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("mknod needs root")
+	}
+	ar, err := GetArchiveInfo("testassets/devices.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err = ar.ExtractSubtree("", dir, CreateDevices()); err != nil {
+		t.Fatalf("ExtractSubtree() error = %v", err)
+	}
+	info, err := os.Lstat(filepath.Join(dir, "dev/null"))
+	if err != nil || info.Mode()&fs.ModeCharDevice == 0 {
+		t.Fatalf("dev/null = %v, %v", info, err)
+	}
+	if rdev := info.Sys().(*syscall.Stat_t).Rdev; rdev != uint64(mkdev(1, 3)) {
+		t.Errorf("dev/null rdev = %#x, want 1,3", rdev)
+	}
+	if info, err = os.Lstat(filepath.Join(dir, "dev/loop0")); err != nil || info.Mode()&fs.ModeDevice == 0 || info.Mode()&fs.ModeCharDevice != 0 {
+		t.Errorf("dev/loop0 = %v, %v", info, err)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package archiver
+
+// Device entries are only recreated on Linux.
+func (af *ArchivedFile) makeDevice(destDir, target string, eo extractOptions) error { return nil }
@@ -0,0 +1,335 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Apple disk images in UDIF, the .dmg format: the data fork holds the
+// partitions' sectors in chunks, each stored, compressed or left out as
+// zeros, and an XML property list after it maps them, behind a "koly"
+// trailer at the very end.  The entries listed are the partitions, whose
+// content is a raw filesystem or partition map, as hdiutil would attach.
+
+const (
+	dmgTrailerMagic = "koly"
+	dmgTrailerLen   = 512
+	dmgSectorSize   = 512
+	dmgMishLen      = 204 // The block table's header, before its chunks
+	dmgChunkLen     = 40
+	dmgMaxPlist     = 64 << 20
+	dmgMaxSectors   = 1 << 50 // Sector counts past this are taken as corrupt
+)
+
+// Chunk types.
+const (
+	dmgChunkZero    = 0x00000000
+	dmgChunkRaw     = 0x00000001
+	dmgChunkIgnore  = 0x00000002 // Reads as zeros too
+	dmgChunkADC     = 0x80000004
+	dmgChunkZlib    = 0x80000005
+	dmgChunkBzip2   = 0x80000006
+	dmgChunkLZFSE   = 0x80000007
+	dmgChunkLZMA    = 0x80000008
+	dmgChunkComment = 0x7FFFFFFE
+	dmgChunkEnd     = 0xFFFFFFFF
+)
+
+var dmgMethods = map[uint32]string{dmgChunkRaw: "Store", dmgChunkADC: "ADC", dmgChunkZlib: "Deflate",
+	dmgChunkBzip2: "BZip2", dmgChunkLZFSE: "LZFSE", dmgChunkLZMA: "LZMA"}
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_DMG,
+		detect:      func(header []byte) bool { return false }, // See isUDIF
+		load:        loadDMG,
+		open:        openDMGEntry,
+	})
+}
+
+// Reports whether r ends in a UDIF trailer.  It's at the end rather than
+// the start, so getArchiveType probes for it, as it does for disc images.
+func isUDIF(r io.ReaderAt, size int64) bool {
+	if size < dmgTrailerLen {
+		return false
+	}
+	trailer := make([]byte, 12)
+	if _, err := r.ReadAt(trailer, size-dmgTrailerLen); err != nil {
+		return false
+	}
+	return string(trailer[:4]) == dmgTrailerMagic && binary.BigEndian.Uint32(trailer[8:]) == dmgTrailerLen
+}
+
+// A partition's block table.
+type dmgPartition struct {
+	name    string
+	sectors int64
+	chunks  []dmgChunk
+}
+
+// A run of a partition's sectors, and where its data is in the image.
+type dmgChunk struct {
+	kind    uint32
+	sector  int64 // First, within the partition
+	sectors int64
+	offset  int64
+	length  int64
+}
+
+// Read the trailer and property list for the partitions' block tables.
+func readDMG(src source) ([]dmgPartition, error) {
+	trailer := make([]byte, dmgTrailerLen)
+	if _, err := src.ReadAt(trailer, src.size-dmgTrailerLen); err != nil {
+		return nil, fmt.Errorf("dmg trailer: %w", noEOF(err))
+	}
+	be := binary.BigEndian
+	dataFork := int64(be.Uint64(trailer[24:]))
+	plistAt, plistLen := int64(be.Uint64(trailer[216:])), int64(be.Uint64(trailer[224:]))
+	if plistLen == 0 {
+		return nil, fmt.Errorf("%w: dmg without a property list", ErrUnsupportedFormat)
+	}
+	if plistAt < 0 || plistLen < 0 || plistLen > dmgMaxPlist || plistAt+plistLen > src.size {
+		return nil, fmt.Errorf("%w: dmg property list outside the image", ErrCorruptArchive)
+	}
+	data := make([]byte, plistLen)
+	if _, err := src.ReadAt(data, plistAt); err != nil {
+		return nil, fmt.Errorf("dmg property list: %w", noEOF(err))
+	}
+	plist, err := parsePlist(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: dmg property list: %w", ErrCorruptArchive, err)
+	}
+	root, ok := plist.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: dmg property list isn't a dict", ErrCorruptArchive)
+	}
+	fork, _ := root["resource-fork"].(map[string]any)
+	blkx, _ := fork["blkx"].([]any)
+	var parts []dmgPartition
+	for i, entry := range blkx {
+		dict, _ := entry.(map[string]any)
+		table, _ := dict["Data"].([]byte)
+		part, err := readMish(table, dataFork)
+		if err != nil {
+			return nil, fmt.Errorf("dmg partition %d: %w", i, err)
+		}
+		part.name, _ = dict["Name"].(string)
+		if part.name == "" {
+			part.name, _ = dict["CFName"].(string)
+		}
+		part.name = strings.ReplaceAll(part.name, "/", "_")
+		if part.name == "" {
+			part.name = fmt.Sprintf("partition %d", i)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// Parse a "mish" block table, whose chunks' offsets are from dataFork.
+func readMish(table []byte, dataFork int64) (dmgPartition, error) {
+	if len(table) < dmgMishLen || string(table[:4]) != "mish" {
+		return dmgPartition{}, fmt.Errorf("%w: bad block table", ErrCorruptArchive)
+	}
+	be := binary.BigEndian
+	part := dmgPartition{sectors: int64(be.Uint64(table[16:]))}
+	base := dataFork + int64(be.Uint64(table[24:]))
+	count := int(be.Uint32(table[200:]))
+	if part.sectors > dmgMaxSectors || count > (len(table)-dmgMishLen)/dmgChunkLen {
+		return dmgPartition{}, fmt.Errorf("%w: bad block table", ErrCorruptArchive)
+	}
+	for c := table[dmgMishLen:][:count*dmgChunkLen]; len(c) > 0; c = c[dmgChunkLen:] {
+		chunk := dmgChunk{kind: be.Uint32(c), sector: int64(be.Uint64(c[8:])), sectors: int64(be.Uint64(c[16:])),
+			offset: base + int64(be.Uint64(c[24:])), length: int64(be.Uint64(c[32:]))}
+		switch {
+		case chunk.kind == dmgChunkComment, chunk.kind == dmgChunkEnd:
+			continue
+		case chunk.sector < 0 || chunk.sectors < 0 || chunk.sector > part.sectors ||
+			chunk.sectors > part.sectors-chunk.sector || chunk.offset < 0 || chunk.length < 0:
+			return dmgPartition{}, fmt.Errorf("%w: bad chunk", ErrCorruptArchive)
+		}
+		part.chunks = append(part.chunks, chunk)
+	}
+	return part, nil
+}
+
+// Parse an XML property list: dicts become maps, arrays slices, data
+// []byte and everything else its text.
+func parsePlist(data []byte) (any, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return plistValue(d, start, 0)
+		}
+	}
+}
+
+func plistValue(d *xml.Decoder, start xml.StartElement, depth int) (any, error) {
+	if depth > isoMaxDepth {
+		return nil, fmt.Errorf("property list nested over %d deep", isoMaxDepth)
+	}
+	switch start.Name.Local {
+	case "dict", "array":
+		dict, array := make(map[string]any), []any{}
+		var key string
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err := d.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				v, err := plistValue(d, t, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				dict[key], array = v, append(array, v)
+			case xml.EndElement:
+				if start.Name.Local == "dict" {
+					return dict, nil
+				}
+				return array, nil
+			}
+		}
+	}
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	if start.Name.Local == "data" {
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	}
+	return text, nil
+}
+
+func loadDMG(ar *ArchiveInfo) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	parts, err := readDMG(src)
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	for i, part := range parts {
+		af := ArchivedFile{archivefile: ar.fullname, archivetype: ARCHIVE_DMG, name: part.name,
+			size: part.sectors * dmgSectorSize, mode: 0o644, index: i}
+		var methods []string
+		for _, c := range part.chunks {
+			if m := dmgMethods[c.kind]; m != "" && !strings.Contains("+"+af.method+"+", "+"+m+"+") {
+				methods = append(methods, m)
+				af.method = strings.Join(methods, "+")
+			}
+			af.packed += c.length
+		}
+		if err = ar.addFile(af); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func openDMGEntry(af *ArchivedFile) (io.ReadCloser, error) {
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	parts, err := readDMG(src)
+	if err == nil && af.index >= len(parts) {
+		err = fmt.Errorf("%w: partition %d", ErrCorruptArchive, af.index)
+	}
+	if err != nil {
+		src.Close()
+		return nil, openError(af.archivefile, err)
+	}
+	part := parts[af.index]
+	return &entryReader{&dmgReader{src: src, chunks: part.chunks, sectors: part.sectors}, []io.Closer{src}}, nil
+}
+
+// Reads a partition's chunks in turn, with zeros for sectors no chunk
+// covers.
+type dmgReader struct {
+	src     source
+	chunks  []dmgChunk
+	sectors int64 // In the partition
+	pos     int64 // Sectors read so far, counting the current chunk's
+	cur     io.Reader
+	left    int64 // Of the current chunk
+}
+
+func (dr *dmgReader) Read(p []byte) (int, error) {
+	for dr.left == 0 {
+		if dr.pos >= dr.sectors {
+			return 0, io.EOF
+		}
+		if err := dr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := dr.cur.Read(p[:min(int64(len(p)), dr.left)])
+	dr.left -= int64(n)
+	if err == io.EOF {
+		if dr.left > 0 {
+			return n, fmt.Errorf("%w: short dmg chunk", ErrCorruptArchive)
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// Move on to the next chunk, or the gap before it.
+func (dr *dmgReader) next() error {
+	if len(dr.chunks) == 0 || dr.chunks[0].sector > dr.pos {
+		end := dr.sectors
+		if len(dr.chunks) > 0 {
+			end = dr.chunks[0].sector
+		}
+		dr.cur, dr.left, dr.pos = zeroReader{}, (end-dr.pos)*dmgSectorSize, end
+		return nil
+	}
+	c := dr.chunks[0]
+	dr.chunks = dr.chunks[1:]
+	if c.sector < dr.pos {
+		return fmt.Errorf("%w: overlapping dmg chunks", ErrCorruptArchive)
+	}
+	data := io.NewSectionReader(dr.src, c.offset, c.length)
+	dr.left, dr.pos = c.sectors*dmgSectorSize, c.sector+c.sectors
+	switch c.kind {
+	case dmgChunkZero, dmgChunkIgnore:
+		dr.cur = zeroReader{}
+	case dmgChunkRaw:
+		dr.cur = data
+	case dmgChunkZlib:
+		zr, err := zlib.NewReader(data)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrCorruptArchive, err)
+		}
+		dr.cur = zr
+	case dmgChunkBzip2:
+		dr.cur = bzip2.NewReader(data)
+	default:
+		if m := dmgMethods[c.kind]; m != "" {
+			return fmt.Errorf("%w: dmg %s chunks", ErrUnsupportedFormat, m)
+		}
+		return fmt.Errorf("%w: dmg chunk type %#x", ErrUnsupportedFormat, c.kind)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A "mish" block table of chunks, each type, first sector, sector count,
+// offset and length.
+func buildTestMish(sectors uint64, chunks ...[5]uint64) []byte {
+	table := []byte("mish")
+	table = binary.BigEndian.AppendUint32(table, 1)
+	table = binary.BigEndian.AppendUint64(table, 0)
+	table = binary.BigEndian.AppendUint64(table, sectors)
+	table = append(table, make([]byte, dmgMishLen-len(table)-4)...)
+	table = binary.BigEndian.AppendUint32(table, uint32(len(chunks)))
+	for _, c := range chunks {
+		table = binary.BigEndian.AppendUint32(table, uint32(c[0]))
+		table = binary.BigEndian.AppendUint32(table, 0)
+		for _, v := range c[1:] {
+			table = binary.BigEndian.AppendUint64(table, v)
+		}
+	}
+	return table
+}
+
+// A UDIF image of two partitions: a stored partition map, and a volume
+// of a stored sector, a hole, a zlib chunk and a bzip2 one.
+func buildTestDMG() ([]byte, map[string]string) {
+	sector := func(s string) string { return s + strings.Repeat("\x00", dmgSectorSize-len(s)) }
+	// Go has no bzip2 writer: this is the last sector, canned.
+	bz2 := "BZh91AY&SY\x13\r\xad\xf2\x00\x00\x08\xd9\x81\xc0\x10\x00\x044\x00$$\x84\x00\x00\x00\x80\x08 " +
+		"\x001\x00\x00\x06\xa3G\xa4\xd0\xf28\x81\x83\xe9\xe9\xaa_kL\xa1b\xeeH\xa7\n\x12\x02a\xb5\xbe@"
+	mapSector := sector("ER partition map")
+	volume := sector("H+ volume header") + strings.Repeat("\x00", 2*dmgSectorSize) +
+		strings.Repeat("hfs data", 2*dmgSectorSize/8) + sector(testCompressedContent)
+	zlibbed := zlibBytes([]byte(volume[3*dmgSectorSize : 5*dmgSectorSize]))
+
+	var img []byte
+	img = append(img, mapSector...)
+	volAt := len(img)
+	img = append(img, volume[:dmgSectorSize]...)
+	zlibAt := len(img)
+	img = append(img, zlibbed...)
+	bz2At := len(img)
+	img = append(img, bz2...)
+	tables := [][]byte{
+		buildTestMish(1, [5]uint64{dmgChunkRaw, 0, 1, 0, dmgSectorSize}, [5]uint64{dmgChunkEnd, 1, 0, 0, 0}),
+		buildTestMish(6, [5]uint64{dmgChunkRaw, 0, 1, uint64(volAt), dmgSectorSize},
+			[5]uint64{dmgChunkComment, 1, 0, 0, 0}, [5]uint64{dmgChunkZlib, 3, 2, uint64(zlibAt), uint64(len(zlibbed))},
+			[5]uint64{dmgChunkBzip2, 5, 1, uint64(bz2At), uint64(len(bz2))}, [5]uint64{dmgChunkEnd, 6, 0, 0, 0}),
+	}
+	names := []string{"Driver Descriptor Map (DDM : 0)", "disk image (Apple_HFS : 1)"}
+	plist := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0"><dict><key>resource-fork</key><dict><key>blkx</key><array>`
+	for i, table := range tables {
+		plist += fmt.Sprintf("<dict><key>Attributes</key><string>0x0050</string><key>Data</key><data>\n\t%s\n</data>"+
+			"<key>ID</key><string>%d</string><key>Name</key><string>%s</string></dict>",
+			base64.StdEncoding.EncodeToString(table), i-1, names[i])
+	}
+	plist += `</array><key>plst</key><array><dict><key>Data</key><data>AAAA</data></dict></array></dict></dict></plist>`
+	plistAt := len(img)
+	img = append(img, plist...)
+
+	trailer := make([]byte, dmgTrailerLen)
+	copy(trailer, dmgTrailerMagic)
+	binary.BigEndian.PutUint32(trailer[4:], 4)
+	binary.BigEndian.PutUint32(trailer[8:], dmgTrailerLen)
+	binary.BigEndian.PutUint64(trailer[32:], uint64(plistAt))
+	binary.BigEndian.PutUint64(trailer[216:], uint64(plistAt))
+	binary.BigEndian.PutUint64(trailer[224:], uint64(len(plist)))
+	return append(img, trailer...), map[string]string{names[0]: mapSector, names[1]: volume}
+}
+
+func TestDMG(t *testing.T) {
+	img, want := buildTestDMG()
+	name := filepath.Join(t.TempDir(), "tool.dmg")
+	if err := os.WriteFile(name, img, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := GetArchiveInfo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ai.ArchiveType != ARCHIVE_DMG || len(ai.Files()) != 2 || !ai.ExtensionMatchesType() {
+		t.Fatalf("type %v, %d entries", ai.ArchiveType, len(ai.Files()))
+	}
+	for name, content := range want {
+		af := ai.File(name)
+		if af == nil {
+			t.Fatalf("no %s", name)
+		}
+		if got, err := af.GetBytes(); err != nil || string(got) != content {
+			t.Errorf("%s: %d bytes, %v; want %d", name, len(got), err, len(content))
+		}
+	}
+	if af := ai.FileAt(1); af.Method() != "Store+Deflate+BZip2" || af.Size() != 6*dmgSectorSize {
+		t.Errorf("volume: method %q, size %d", af.Method(), af.Size())
+	}
+
+	// A chunk type there's no decoder for.
+	lzfse := bytes.Clone(img)
+	at := bytes.Index(lzfse, []byte(base64.StdEncoding.EncodeToString(buildTestMish(1,
+		[5]uint64{dmgChunkRaw, 0, 1, 0, dmgSectorSize}, [5]uint64{dmgChunkEnd, 1, 0, 0, 0}))))
+	table := buildTestMish(1, [5]uint64{dmgChunkLZFSE, 0, 1, 0, dmgSectorSize}, [5]uint64{dmgChunkEnd, 1, 0, 0, 0})
+	copy(lzfse[at:], base64.StdEncoding.EncodeToString(table))
+	ai, err = GetArchiveInfoFromReader(bytes.NewReader(lzfse), int64(len(lzfse)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ai.FileAt(0).GetBytes(); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("LZFSE chunk: %v", err)
+	}
+}
+
+func TestDMGPlistRoot(t *testing.T) {
+	img, _ := buildTestDMG()
+	trailer := img[len(img)-dmgTrailerLen:]
+	plistAt := binary.BigEndian.Uint64(trailer[216:])
+	for _, root := range []string{"<array><dict/></array>", "<string>blkx</string>"} {
+		bad := bytes.Clone(img)
+		plist := `<?xml version="1.0" encoding="UTF-8"?><plist version="1.0">` + root + `</plist>`
+		copy(bad[plistAt:], plist)
+		binary.BigEndian.PutUint64(bad[len(bad)-dmgTrailerLen+224:], uint64(len(plist)))
+		if _, err := GetArchiveInfoFromReader(bytes.NewReader(bad), int64(len(bad))); !errors.Is(err, ErrCorruptArchive) {
+			t.Errorf("%s at the root: %v, want ErrCorruptArchive", root, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package archiver
+
+import "errors"
+
+// Returned by addFile when the Entries caller has stopped.
+var errStopListing = errors.New("listing stopped")
+
+// Have GetArchiveInfo identify the archive without listing it: Files is
+// empty and File finds nothing, and Entries reads the headers as it's
+// ranged over instead.  For archives of hundreds of thousands of entries
+// where the caller wants a few, or wants to start before the end.
+// WithSortedListing, WithValidateOnOpen and WithNestedArchives need the
+// whole listing, so they don't apply.
+func WithLazyListing() Option {
+	return func(o *options) { o.lazyListing = true }
+}
+
+// The entries in listing order, as an iterator: the shape of
+// iter.Seq2[ArchivedFile, error], so with Go 1.23 or later
+//
+//	for af, err := range ai.Entries() { ... }
+//
+// Under WithLazyListing each pass reads the headers afresh as it goes, and
+// stopping early stops reading: a tar or RAR stream is only decompressed
+// as far as the last entry taken.  zip and 7z keep their directory in one
+// place, so it's read whole, but entries still come one at a time.  A
+// failure is yielded with a zero ArchivedFile and ends the sequence.
+// Without WithLazyListing this runs over Files.  Yielded entries read as
+// listed ones do.
+//
+// This isn't an iter.Seq[ArchivedFile], on purpose: the module stays on Go
+// 1.21, which has no iter package, and a listing that fails partway needs
+// its error yielded too.  A plain func of Seq2's shape ranges the same.
+func (ai *ArchiveInfo) Entries() func(yield func(ArchivedFile, error) bool) {
+	return func(yield func(ArchivedFile, error) bool) {
+		if !ai.opts.lazyListing {
+			for _, af := range ai.files {
+				if !yield(af, nil) {
+					return
+				}
+			}
+			return
+		}
+		// A lister of its own, so passes can run at once, reading through ai
+		// for its volumes, shared handle and context.
+		lister := &ArchiveInfo{path: ai.path, name: ai.name, fullname: ai.fullname, size: ai.size,
+			ArchiveType: ai.ArchiveType, opts: ai.opts, reader: ai.reader, fsys: ai.fsys, volumes: ai.volumes,
+			ctx: ai.lazyCtx, owner: ai}
+		stopped := false
+		lister.visit = func(af ArchivedFile) bool {
+			af.archive = ai // So reads don't go through the listing's context
+			stopped = stopped || !yield(af, nil)
+			return !stopped
+		}
+		if err := lister.listFiles(); err != nil && !stopped {
+			yield(ArchivedFile{}, err)
+		}
+	}
+}
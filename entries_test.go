@@ -0,0 +1,149 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Counts the bytes read from an archive held in memory.
+type countingReaderAt struct {
+	r *bytes.Reader
+	n int64
+}
+
+func (cr *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := cr.r.ReadAt(p, off)
+	cr.n += int64(n)
+	return n, err
+}
+
+// Collect up to limit entries from seq; 0 for all.
+func takeEntries(seq func(func(ArchivedFile, error) bool), limit int) ([]ArchivedFile, error) {
+	var entries []ArchivedFile
+	var failure error
+	seq(func(af ArchivedFile, err error) bool {
+		if err != nil {
+			failure = err
+			return false
+		}
+		entries = append(entries, af)
+		return limit == 0 || len(entries) < limit
+	})
+	return entries, failure
+}
+
+func TestEntries(t *testing.T) {
+	for _, filename := range []string{"testassets/tree.zip", "testassets/sz_test.7z", "testassets/tgz_test.tgz", "testassets/test.rar"} {
+		full, err := GetArchiveInfo(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lazy, err := GetArchiveInfo(filename, WithLazyListing())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lazy.Files()) != 0 {
+			t.Errorf("%s: lazy listing holds %d files", filename, len(lazy.Files()))
+		}
+		for _, ar := range []*ArchiveInfo{full, lazy} {
+			entries, err := takeEntries(ar.Entries(), 0)
+			if err != nil || len(entries) != len(full.Files()) {
+				t.Fatalf("%s: Entries() = %d entries, %v; want %d", filename, len(entries), err, len(full.Files()))
+			}
+			for i, af := range entries {
+				want := full.Files()[i]
+				if af.Name() != want.Name() || af.Size() != want.Size() {
+					t.Errorf("%s: entry %d = %s (%d bytes), want %s (%d)", filename, i, af.Name(), af.Size(), want.Name(), want.Size())
+				}
+				if af.isDir() {
+					continue
+				}
+				got, err := af.GetBytes()
+				wantBytes, _ := want.GetBytes()
+				if err != nil || !bytes.Equal(got, wantBytes) {
+					t.Errorf("%s: %s GetBytes() = %d bytes, %v", filename, af.Name(), len(got), err)
+				}
+			}
+		}
+	}
+
+	// Stopping early stops reading the stream.
+	dir := t.TempDir()
+	var entries []testTarEntry
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 64; i++ {
+		body := make([]byte, 64<<10)
+		random.Read(body)
+		entries = append(entries, testTarEntry{tar.Header{Name: fmt.Sprintf("f%02d.bin", i), Mode: 0o644, Size: int64(len(body))}, string(body)})
+	}
+	data, err := os.ReadFile(writeTestTgz(t, dir, "many.tgz", entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := &countingReaderAt{r: bytes.NewReader(data)}
+	ar, err := GetArchiveInfoFromReader(counter, int64(len(data)), WithLazyListing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := takeEntries(ar.Entries(), 2)
+	if err != nil || len(first) != 2 || first[1].Name() != "f01.bin" {
+		t.Fatalf("first two entries = %v, %v", first, err)
+	}
+	if counter.n > int64(len(data))/4 {
+		t.Errorf("taking 2 of 64 entries read %d of %d bytes", counter.n, len(data))
+	}
+}
+
+func TestEntriesLazyVolumes(t *testing.T) {
+	dir := t.TempDir()
+	writeSZVolumes(t, dir)
+	want, err := GetArchiveInfo("testassets/sz_test.7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := GetArchiveInfo(filepath.Join(dir, "sz.7z.001"), WithLazyListing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := takeEntries(lazy.Entries(), 0)
+	if err != nil || len(entries) != len(want.Files()) {
+		t.Fatalf("Entries() = %d entries, %v; want %d", len(entries), err, len(want.Files()))
+	}
+	for i, af := range entries {
+		if af.isDir() {
+			continue
+		}
+		got, err := af.GetBytes()
+		wantBytes, _ := want.Files()[i].GetBytes()
+		if err != nil || !bytes.Equal(got, wantBytes) {
+			t.Errorf("%s: GetBytes() = %d bytes, %v", af.Name(), len(got), err)
+		}
+	}
+
+	// The listing's context carries over to Entries, but not to reads.
+	ctx, cancel := context.WithCancel(context.Background())
+	lazy, err = GetArchiveInfoContext(ctx, "testassets/tgz_test.tgz", WithLazyListing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = takeEntries(lazy.Entries(), 1)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("before cancelling: %d entries, %v", len(entries), err)
+	}
+	cancel()
+	if _, err := takeEntries(lazy.Entries(), 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("after cancelling: %v, want context.Canceled", err)
+	}
+	for _, af := range entries {
+		if _, err := af.GetBytes(); err != nil {
+			t.Errorf("%s: GetBytes() after cancelling: %v", af.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// Sentinel errors returned by the package.  Errors are wrapped with the
+// underlying cause where there is one, so test with errors.Is / errors.As.
+var (
+	ErrNotAnArchive      = errors.New("archiver: not an archive")          // No recognised magic header
+	ErrUnsupportedFormat = errors.New("archiver: unsupported format")      // Recognised, but can't be read
+	ErrCorruptArchive    = errors.New("archiver: corrupt archive")         // Structure could not be parsed
+	ErrEncrypted         = errors.New("archiver: entry is encrypted")      // Password needed
+	ErrWrongPassword     = errors.New("archiver: wrong password")          // Password supplied but rejected
+	ErrUnsafePath        = errors.New("archiver: unsafe entry path")       // Entry would escape the destination
+	ErrSizeMismatch      = errors.New("archiver: entry size mismatch")     // Data doesn't match the header size
+	ErrArchiveTooLarge   = errors.New("archiver: archive entry too large") // Can't be held in memory
+	ErrReadTimeout       = errors.New("archiver: read timed out")          // See WithReadTimeout
+	ErrLimitExceeded     = errors.New("archiver: limit exceeded")          // See WithLimits
+	ErrLinkEntry         = errors.New("archiver: entry is a link")         // Refused under RejectLinks
+	ErrBadSignature      = errors.New("archiver: bad signature")           // A signature or digest doesn't match
+)
+
+// Wrap a failure to open or parse the host archive.  Missing files and
+// permission problems are passed through as-is, as is cancellation;
+// anything else is reported as ErrCorruptArchive.
+func openError(path string, err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("Could not open %s.  %w", path, err) //lint:ignore ST1005 Casing is good
+	}
+	return fmt.Errorf("Could not open %s.  %w: %w", path, ErrCorruptArchive, err) //lint:ignore ST1005 Casing is good
+}
+
+// A problem with one entry that didn't stop the archive from being read.
+// See WithBestEffort.
+type EntryError struct {
+	Archive string // Host archive path
+	Name    string // Entry name, when the damage left one to read
+	Offset  int64  // Position in the (decompressed) archive stream, or -1
+	Err     error
+}
+
+func (e *EntryError) Error() string {
+	name := e.Name
+	if name == "" {
+		name = fmt.Sprintf("entry at offset %d", e.Offset)
+	}
+	return fmt.Sprintf("%s: %s: %v", e.Archive, name, e.Err)
+}
+
+func (e *EntryError) Unwrap() error { return e.Err }
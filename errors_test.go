@@ -0,0 +1,171 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	// Plain text isn't an archive, but the ArchiveInfo still comes back typed.
+	textPath := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(textPath, []byte("just some text, nothing to see"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ar, err := GetArchiveInfo(textPath)
+	if !errors.Is(err, ErrNotAnArchive) {
+		t.Errorf("text file error = %v, want ErrNotAnArchive", err)
+	}
+	if ar.ArchiveType != ARCHIVE_NA {
+		t.Errorf("text file typed %v", ar.ArchiveType)
+	}
+
+	// Zip magic with the central directory chopped off.
+	zipBytes, err := os.ReadFile("testassets/test.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncPath := filepath.Join(dir, "truncated.zip")
+	if err := os.WriteFile(truncPath, zipBytes[:len(zipBytes)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetArchiveInfo(truncPath); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("truncated zip error = %v, want ErrCorruptArchive", err)
+	}
+
+	// Missing files are reported as such, not as corruption.
+	if _, err = GetArchiveInfo(filepath.Join(dir, "nope.zip")); !errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("missing file error = %v, want ErrNotExist", err)
+	}
+
+	ar, err = GetArchiveInfo("testassets/encrypted.zip")
+	if err != nil {
+		t.Fatalf("encrypted zip listing error = %v", err)
+	}
+	if _, err = ar.File("secret.txt").GetBytes(); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("encrypted entry error = %v, want ErrEncrypted", err)
+	}
+	ar, err = GetArchiveInfo("testassets/encrypted.zip", WithPassword("not the password"))
+	if err != nil {
+		t.Fatalf("encrypted zip listing error = %v", err)
+	}
+	if _, err = ar.File("secret.txt").GetBytes(); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("wrong password error = %v, want ErrWrongPassword", err)
+	}
+
+	ar, err = GetArchiveInfo(writeTestZip(t, dir, "evil.zip", [][2]string{{"../escaped.txt", "gotcha"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ar.ExtractAll(filepath.Join(dir, "out")); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("escaping entry error = %v, want ErrUnsafePath", err)
+	}
+
+	ar, err = GetArchiveInfo(writeLinkTgz(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ar.ExtractAll(filepath.Join(dir, "links"), WithLinkPolicy(RejectLinks)); !errors.Is(err, ErrLinkEntry) {
+		t.Errorf("rejected link error = %v, want ErrLinkEntry", err)
+	}
+
+	if _, err = GetArchiveInfo("testassets/test.zip", WithLimits(Limits{MaxEntryCount: 1})); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("entry count error = %v, want ErrLimitExceeded", err)
+	}
+
+	tgzBytes, err := os.ReadFile("testassets/tgz_test.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := &slowReader{bytes.NewReader(tgzBytes), 200 * time.Millisecond}
+	err = ForEachFromReader(slow, func(*ArchivedFile, io.Reader) error { return nil }, WithReadTimeout(10*time.Millisecond))
+	if !errors.Is(err, ErrReadTimeout) {
+		t.Errorf("stalled read error = %v, want ErrReadTimeout", err)
+	}
+
+	// Signed, but with no signature block.
+	jar := testZipBytes(t, map[string]string{"META-INF/MANIFEST.MF": "Manifest-Version: 1.0\r\n\r\n",
+		"META-INF/SIGNER.SF": "Signature-Version: 1.0\r\n\r\n"})
+	if ar, err = GetArchiveInfoFromReader(bytes.NewReader(jar), int64(len(jar))); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = ar.VerifyJarSignatures(); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("missing signature block error = %v, want ErrBadSignature", err)
+	}
+
+	// Header claims more data than the entry holds.
+	ar, _ = GetArchiveInfo("testassets/test.zip")
+	short := *ar.File("dirhelp.txt")
+	short.size += 10
+	if _, err = short.GetBytes(); !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("oversized header error = %v, want ErrSizeMismatch", err)
+	}
+
+	// A uint64 size that overflowed int64.
+	huge := *ar.File("dirhelp.txt")
+	huge.size = -1
+	if _, err = huge.GetBytes(); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("overflowed size error = %v, want ErrArchiveTooLarge", err)
+	}
+
+	unknown := ArchivedFile{name: "mystery", archivetype: ARCHIVE_NA}
+	if _, err = unknown.GetBytes(); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("unknown type error = %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestGetBytesWholeEntry(t *testing.T) {
+	// Big enough that every decoder hands it over in many reads.
+	big := strings.Repeat("chunked stream data ", 1<<16)
+	dir := t.TempDir()
+	paths := []string{
+		writeTestZip(t, dir, "big.zip", [][2]string{{"big.txt", big}}),
+		writeTestTgz(t, dir, "big.tgz", []testTarEntry{
+			{tar.Header{Name: "big.txt", Typeflag: tar.TypeReg, Mode: 0o644}, big}}),
+	}
+	for _, path := range paths {
+		ar, err := GetArchiveInfo(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err := ar.File("big.txt").GetBytes(); err != nil || string(data) != big {
+			t.Errorf("%s GetBytes() = %d bytes, %v, want %d", path, len(data), err, len(big))
+		}
+		// A header that undercounts is caught, not silently truncated.
+		short := *ar.File("big.txt")
+		short.size -= 10
+		if _, err = short.GetBytes(); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("%s undersized header error = %v, want ErrSizeMismatch", path, err)
+		}
+		missing := *ar.File("big.txt")
+		missing.name = "gone.txt"
+		if _, err = missing.GetBytes(); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s missing entry error = %v, want fs.ErrNotExist", path, err)
+		}
+	}
+
+	// Reading to the end lets archive/zip check the CRC.
+	ar, err := GetArchiveInfo("testassets/corrupt_entry.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failed int
+	for _, af := range ar.Files() {
+		if _, err := af.GetBytes(); errors.Is(err, zip.ErrChecksum) {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("%d entries failed the CRC, want 1", failed)
+	}
+}
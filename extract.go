@@ -0,0 +1,313 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/text/encoding"
+)
+
+// ExtractOption adjusts how entries are written out.  Pass any number to the
+// Extract methods.
+type ExtractOption func(*extractOptions)
+
+type extractOptions struct {
+	modTime time.Time         // Fixed mtime for everything written; zero keeps the recorded ones
+	devices bool              // mknod character and block devices
+	sorted  bool              // Write in name order rather than listing order
+	from    encoding.Encoding // Transcode text entries from this...
+	to      encoding.Encoding // ...to this; nil for neither
+	paths   PathPolicy        // What to do with names that would escape
+	links   LinkPolicy        // What to do with symlinks and hardlinks
+	strip   int               // Leading path elements to drop
+	total   *atomic.Int64     // Bytes decompressed so far, across entries
+}
+
+func buildExtractOptions(opts []ExtractOption) extractOptions {
+	eo := extractOptions{total: new(atomic.Int64)}
+	for _, opt := range opts {
+		opt(&eo)
+	}
+	return eo
+}
+
+// Give every extracted file and directory the modification time t instead
+// of the one recorded in the archive, so the output hashes and caches the
+// same whatever the archive's timestamps.  Access times are set to t too,
+// unless the archive was opened WithAccessTimes.
+func SetModTime(t time.Time) ExtractOption {
+	return func(eo *extractOptions) { eo.modTime = t }
+}
+
+// Write entries in name order, whatever order the archive holds them in,
+// so repacking the same content always gives the same output.  For
+// ExtractAllToTarWriter; tar sources are then read entry by entry, which
+// decompresses the stream up to each entry again.
+func SortEntries() ExtractOption {
+	return func(eo *extractOptions) { eo.sorted = true }
+}
+
+// Recreate tar character and block device entries with mknod.  This only
+// happens on Linux when running as root; elsewhere, and without this
+// option, device entries are skipped.
+func CreateDevices() ExtractOption {
+	return func(eo *extractOptions) { eo.devices = true }
+}
+
+// Transcode text entries from one character set to another as they're
+// written, e.g. japanese.ShiftJIS to unicode.UTF8 for archives made on a
+// legacy-locale system.  Entries with a NUL byte near the start are taken
+// to be binary and written untouched, which also rules out UTF-16 sources.
+// Text that to can't represent fails the entry.
+func WithContentEncoding(from, to encoding.Encoding) ExtractOption {
+	return func(eo *extractOptions) { eo.from, eo.to = from, to }
+}
+
+// Extract the entries under a directory prefix into destDir, with the prefix
+// stripped so that it becomes destDir itself.  "docs" and "docs/" are the
+// same; an empty prefix extracts everything.  Entries that would land outside
+// destDir fail with ErrUnsafePath, unless WithPathPolicy says otherwise.
+// Failures don't stop the extraction; they are joined into the returned
+// error.
+func (ai *ArchiveInfo) ExtractSubtree(prefix, destDir string, opts ...ExtractOption) error {
+	prefix = strings.Trim(prefix, "/")
+	return ai.extract(destDir, func(name string) (string, bool) {
+		if prefix == "" {
+			return name, true
+		}
+		rest, found := strings.CutPrefix(name, prefix+"/")
+		return rest, found
+	}, buildExtractOptions(opts))
+}
+
+// Extract the whole archive under destDir, creating directories as needed
+// and keeping file modes and modification times.  Symlinks and hardlinks
+// are skipped unless WithLinkPolicy says otherwise.  Every entry is tried;
+// the returned error joins one "name: cause" error per entry that failed,
+// so a bad entry doesn't cost the rest.
+func (ai *ArchiveInfo) ExtractAll(destDir string, opts ...ExtractOption) error {
+	return ai.ExtractSubtree("", destDir, opts...)
+}
+
+// Extract the entries matching any of include and none of exclude under
+// destDir, as ExtractAll does.  Patterns are FilesMatching's, so
+// "bin/**" pulls in everything under bin and "**/*.md" every Markdown file;
+// an empty include means every entry.  A pattern matching a directory
+// matches everything under it too, and exclude wins over include.
+// Directories holding a matched entry are created whether or not they
+// match.  A bad pattern fails with path.ErrBadPattern before anything is
+// written.
+func (ai *ArchiveInfo) ExtractMatching(destDir string, include, exclude []string, opts ...ExtractOption) error {
+	includes, err := globPatterns(include)
+	if err != nil {
+		return err
+	}
+	excludes, err := globPatterns(exclude)
+	if err != nil {
+		return err
+	}
+	return ai.extract(destDir, func(name string) (string, bool) {
+		elems := strings.Split(fsName(name), "/")
+		return name, (len(includes) == 0 || globMatchDir(includes, elems)) && !globMatchDir(excludes, elems)
+	}, buildExtractOptions(opts))
+}
+
+// patterns split into elements for globMatchDir.
+func globPatterns(patterns []string) ([][]string, error) {
+	split := make([][]string, len(patterns))
+	for i, pattern := range patterns {
+		elems, err := globElements(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", pattern, err)
+		}
+		split[i] = elems
+	}
+	return split, nil
+}
+
+// Reports whether any of patterns matches name, given as elements, or a
+// directory it's under.
+func globMatchDir(patterns [][]string, name []string) bool {
+	for _, pattern := range patterns {
+		for n := 1; n <= len(name); n++ {
+			if globMatch(pattern, name[:n]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Creates the destination for one extracted file.  name is the entry's
+// path, cleaned and checked to stay relative, with "/" separators; mode
+// holds its permissions.
+type CreateFunc func(name string, mode fs.FileMode) (io.WriteCloser, error)
+
+// Extract every regular file through create instead of onto the local
+// filesystem, so output can go to object storage, an in-memory fs or
+// transformed paths.  Directories aren't passed on; they're implied by the
+// names.  Entries that would escape the destination fail with
+// ErrUnsafePath without reaching create, unless WithPathPolicy says
+// otherwise.  Failures don't stop the extraction; they are joined into the
+// returned error.
+func (ai *ArchiveInfo) ExtractAllWith(create CreateFunc, opts ...ExtractOption) error {
+	eo := buildExtractOptions(opts)
+	var errs []error
+	err := ai.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		if af.isLink() && eo.links == RejectLinks {
+			errs = append(errs, fmt.Errorf("%s: %w", af.name, ErrLinkEntry))
+		}
+		if !af.mode.IsRegular() || af.isDir() || af.isLink() || isRootName(af.name) {
+			return nil
+		}
+		if err := af.writeTo(create, af.tracked(eo).withTracking(r), eo); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", af.name, err))
+		}
+		return nil
+	})
+	return errors.Join(append(errs, err)...)
+}
+
+func (af *ArchivedFile) writeTo(create CreateFunc, r io.Reader, eo extractOptions) error {
+	name, ok := eo.stripped(af.name)
+	if !ok {
+		return nil
+	}
+	name, err := SanitizePath(name, eo.paths)
+	if err != nil {
+		return err
+	}
+	perm := af.mode.Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+	w, err := create(name, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return errors.Join(err, w.Close())
+}
+
+// Write entries to destDir.  rename maps an entry name to its path relative
+// to destDir, or returns false to skip the entry.
+func (ai *ArchiveInfo) extract(destDir string, rename func(name string) (string, bool), eo extractOptions) error {
+	var errs []error
+	var dirs []*ArchivedFile
+	var dirPaths []string
+	for i := range ai.files {
+		af := &ai.files[i]
+		rel, ok := rename(af.name)
+		if ok {
+			rel, ok = eo.stripped(rel)
+		}
+		if !ok || isRootName(rel) {
+			continue
+		}
+		target, err := safeJoin(destDir, rel, eo.paths)
+		if err == nil {
+			if af.isDir() {
+				err = mkdirUnder(destDir, target)
+				dirs, dirPaths = append(dirs, af), append(dirPaths, target)
+			} else if af.isLink() {
+				err = af.writeLink(destDir, target, rename, eo)
+			} else if af.mode.IsRegular() {
+				err = af.writeFile(destDir, target, eo)
+			} else if af.mode&fs.ModeDevice != 0 && eo.devices {
+				err = af.makeDevice(destDir, target, eo)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", af.name, err))
+		}
+	}
+	// Directory times last; writing their contents would have bumped them.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if atime, mtime := dirs[i].extractTimes(eo); !mtime.IsZero() {
+			os.Chtimes(dirPaths[i], atime, mtime)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// The rename for extracting entries under their own names.
+func sameName(name string) (string, bool) { return name, true }
+
+func (af *ArchivedFile) isDir() bool { return af.IsDir || af.mode.IsDir() }
+
+func (af *ArchivedFile) writeFile(destDir, target string, eo extractOptions) error {
+	data, err := af.tracked(eo).GetBytes()
+	if err != nil {
+		return err
+	}
+	return af.writeData(destDir, target, data, eo)
+}
+
+// Write the entry's content, read already, to target under destDir.  A
+// symlink already at target is replaced rather than written through.
+func (af *ArchivedFile) writeData(destDir, target string, data []byte, eo extractOptions) (err error) {
+	if eo.from != nil && eo.to != nil && !looksBinary(data) {
+		if data, err = transcode(data, eo.from, eo.to); err != nil {
+			return err
+		}
+	}
+	if err = mkdirUnder(destDir, filepath.Dir(target)); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(target); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		os.Remove(target)
+	}
+	perm := af.mode.Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+	if err = os.WriteFile(target, data, perm); err != nil {
+		return err
+	}
+	if atime, mtime := af.extractTimes(eo); !mtime.IsZero() {
+		return os.Chtimes(target, atime, mtime)
+	}
+	return nil
+}
+
+// Decode data from one character set and encode it in another, by way of
+// UTF-8.
+func transcode(data []byte, from, to encoding.Encoding) ([]byte, error) {
+	decoded, err := from.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return to.NewEncoder().Bytes(decoded)
+}
+
+// The times to give an extracted entry.  mtime is the recorded one unless
+// SetModTime overrides it; atime is the entry's own under WithAccessTimes,
+// otherwise the same as mtime.
+func (af *ArchivedFile) extractTimes(eo extractOptions) (atime, mtime time.Time) {
+	mtime = af.modTime
+	if !eo.modTime.IsZero() {
+		mtime = eo.modTime
+	}
+	if af.options().restoreAccessTime && !af.accessTime.IsZero() {
+		return af.accessTime, mtime
+	}
+	return mtime, mtime
+}
+
+// Reports whether an entry name refers to the archive root: empty, or made
+// only of "/" and "." segments.
+func isRootName(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if segment != "" && segment != "." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,363 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Write a zip of name -> content into dir, for tests that need odd archives.
+func writeTestZip(t *testing.T, dir, name string, entries [][2]string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	for _, e := range entries {
+		w, err := zw.Create(e[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e[1]))
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	return path
+}
+
+// Write a tgz of the given headers into dir; regular entries get body as
+// their content.
+func writeTestTgz(t *testing.T, dir, name string, entries []testTarEntry) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		head := e.head
+		if head.Typeflag == tar.TypeReg {
+			head.Size = int64(len(e.body))
+		}
+		if err = tw.WriteHeader(&head); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.body))
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gw.Close()
+	out.Close()
+	return path
+}
+
+type testTarEntry struct {
+	head tar.Header
+	body string
+}
+
+// Relative paths of the regular files under dir.
+func listTree(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(dir, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	sort.Strings(files)
+	return files
+}
+
+func TestExtractSubtree(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err = ar.ExtractSubtree("docs/", dest); err != nil {
+		t.Fatalf("ExtractSubtree() error = %v", err)
+	}
+	got := listTree(t, dest)
+	want := []string{"api/index.md", "guide.md"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("extracted %v, want %v", got, want)
+	}
+	data, _ := os.ReadFile(filepath.Join(dest, "guide.md"))
+	if string(data) != "# Guide\n\nStart with the install section.\n" {
+		t.Errorf("guide.md = %q", data)
+	}
+	info, _ := os.Stat(filepath.Join(dest, "guide.md"))
+	if want := ar.File("docs/guide.md").ModTime(); !info.ModTime().Equal(want) {
+		t.Errorf("guide.md mtime = %v, want %v", info.ModTime(), want)
+	}
+
+	// Everything, prefix and all.
+	dest = t.TempDir()
+	if err = ar.ExtractSubtree("", dest); err != nil {
+		t.Fatalf("ExtractSubtree(\"\") error = %v", err)
+	}
+	if got = listTree(t, dest); len(got) != 6 {
+		t.Errorf("full extract = %v", got)
+	}
+}
+
+func TestExtractUnsafePaths(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestZip(t, dir, "evil.zip", [][2]string{
+		{"ok.txt", "fine"},
+		{"../escaped.txt", "gotcha"},
+		{"/abs.txt", "gotcha"},
+		{"C:/drive.txt", "gotcha"},
+	})
+	ar, err := GetArchiveInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(dir, "out")
+	err = ar.ExtractSubtree("", dest)
+	if !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("ExtractSubtree() error = %v, want ErrUnsafePath", err)
+	}
+	if got := listTree(t, dir); len(got) != 2 || got[0] != "evil.zip" || got[1] != "out/ok.txt" {
+		t.Errorf("files after unsafe extract = %v", got)
+	}
+}
+
+func TestDegenerateNames(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/degenerate.zip")
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	if len(ar.Files()) != 6 {
+		t.Fatalf("%d entries, want 6", len(ar.Files()))
+	}
+	// Root entries become directories, even "." stored as a file.
+	for _, name := range []string{"/", ".", "./"} {
+		if af := ar.File(name); af == nil || !af.IsDir || !af.Mode().IsDir() {
+			t.Errorf("File(%q) = %v, want a directory", name, af)
+		}
+	}
+	// Trailing spaces are preserved, so only the stored name finds the entry.
+	if ar.File("notes.txt ") == nil || ar.File("notes.txt") != nil {
+		t.Error("File() didn't preserve the trailing space")
+	}
+
+	dir := t.TempDir()
+	if err = ar.ExtractSubtree("", dir); err != nil {
+		t.Fatalf("ExtractSubtree() error = %v", err)
+	}
+	got := listTree(t, dir)
+	want := []string{"dir /inner.txt", "notes.txt ", "ok.txt"}
+	if !slices.Equal(got, want) {
+		t.Errorf("extracted %q, want %q", got, want)
+	}
+}
+
+func TestExtractSetModTime(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixed := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	dest := t.TempDir()
+	if err = ar.ExtractSubtree("", dest, SetModTime(fixed)); err != nil {
+		t.Fatalf("ExtractSubtree() error = %v", err)
+	}
+	filepath.WalkDir(dest, func(p string, d os.DirEntry, err error) error {
+		if err != nil || p == dest {
+			return err
+		}
+		info, _ := d.Info()
+		if !info.ModTime().Equal(fixed) {
+			t.Errorf("%s mtime = %v, want %v", p, info.ModTime(), fixed)
+		}
+		return nil
+	})
+}
+
+// An in-memory destination for ExtractAllWith.
+type memFile struct {
+	bytes.Buffer
+	mode   fs.FileMode
+	closed bool
+}
+
+func (mf *memFile) Close() error { mf.closed = true; return nil }
+
+func TestExtractAllWith(t *testing.T) {
+	path := writeTestZip(t, t.TempDir(), "mixed.zip", [][2]string{
+		{"a.txt", "alpha"},
+		{"sub/", ""},
+		{"sub/b.txt", "bravo"},
+		{"./sub/../c.txt", "charlie"},
+		{"../escaped.txt", "gotcha"},
+	})
+	ar, err := GetArchiveInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*memFile{}
+	err = ar.ExtractAllWith(func(name string, mode fs.FileMode) (io.WriteCloser, error) {
+		mf := &memFile{mode: mode}
+		files[name] = mf
+		return mf, nil
+	})
+	if !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("ExtractAllWith() error = %v, want ErrUnsafePath", err)
+	}
+	want := map[string]string{"a.txt": "alpha", "sub/b.txt": "bravo", "c.txt": "charlie"}
+	if len(files) != len(want) {
+		t.Errorf("created %d files, want %d", len(files), len(want))
+	}
+	for name, content := range want {
+		mf := files[name]
+		if mf == nil || mf.String() != content || !mf.closed || mf.mode.Perm() == 0 {
+			t.Errorf("%s = %+v, want %q written and closed", name, mf, content)
+		}
+	}
+}
+
+func TestWithContentEncoding(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/shiftjis.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := ar.File("readme.txt").GetBytes()
+	if utf8.Valid(raw) {
+		t.Fatal("sample readme.txt is already UTF-8")
+	}
+	binary, _ := ar.File("logo.bin").GetBytes()
+
+	dir := t.TempDir()
+	if err = ar.ExtractSubtree("", dir, WithContentEncoding(japanese.ShiftJIS, unicode.UTF8)); err != nil {
+		t.Fatalf("ExtractSubtree() error = %v", err)
+	}
+	text, _ := os.ReadFile(filepath.Join(dir, "readme.txt"))
+	if !utf8.Valid(text) || !strings.HasPrefix(string(text), "お読みください。") {
+		t.Errorf("readme.txt = %q, want UTF-8", text)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "logo.bin")); !bytes.Equal(got, binary) {
+		t.Errorf("logo.bin = %x, want %x untouched", got, binary)
+	}
+}
+
+func TestExtractAll(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/test.tar.xz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err = ar.ExtractAll(dest); err != nil {
+		t.Fatalf("ExtractAll() error = %v", err)
+	}
+	got := listTree(t, dest)
+	if want := []string{"pkg/bin/run.sh", "pkg/manifest.json"}; !slices.Equal(got, want) {
+		t.Errorf("extracted %v, want %v", got, want)
+	}
+	info, err := os.Stat(filepath.Join(dest, "pkg/bin/run.sh"))
+	if err != nil || info.Mode().Perm() != 0o755 {
+		t.Errorf("run.sh = %v, %v, want mode 0755", info, err)
+	}
+	info, _ = os.Stat(filepath.Join(dest, "pkg/manifest.json"))
+	if want := ar.File("pkg/manifest.json").ModTime(); info == nil || !info.ModTime().Equal(want) {
+		t.Errorf("manifest.json = %v, want mtime %v", info, want)
+	}
+
+	// One bad entry is reported by name and doesn't stop the others.
+	path := writeTestZip(t, t.TempDir(), "mixed.zip", [][2]string{
+		{"a.txt", "alpha"},
+		{"../escaped.txt", "gotcha"},
+		{"b.txt", "bravo"},
+	})
+	if ar, err = GetArchiveInfo(path); err != nil {
+		t.Fatal(err)
+	}
+	dest = t.TempDir()
+	err = ar.ExtractAll(dest)
+	if !errors.Is(err, ErrUnsafePath) || !strings.Contains(err.Error(), "../escaped.txt") {
+		t.Errorf("ExtractAll() error = %v, want ErrUnsafePath naming the entry", err)
+	}
+	if got = listTree(t, dest); !slices.Equal(got, []string{"a.txt", "b.txt"}) {
+		t.Errorf("extracted %v", got)
+	}
+}
+
+func TestExtractMatching(t *testing.T) {
+	dir := t.TempDir()
+	ai, err := GetArchiveInfo(writeTestZip(t, dir, "release.zip", [][2]string{
+		{"bin/", ""},
+		{"bin/tool", "tool"},
+		{"bin/lib/helper.so", "helper"},
+		{"docs/", ""},
+		{"docs/guide.md", "guide"},
+		{"docs/api/index.md", "index"},
+		{"README.md", "readme"},
+		{"LICENSE", "license"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		include, exclude []string
+		want             []string
+	}{
+		{[]string{"bin/**"}, nil, []string{"bin/lib/helper.so", "bin/tool"}},
+		{[]string{"bin"}, []string{"bin/lib"}, []string{"bin/tool"}},
+		{[]string{"**/*.md"}, []string{"docs/api"}, []string{"README.md", "docs/guide.md"}},
+		{nil, []string{"docs/**", "*.md"}, []string{"LICENSE", "bin/lib/helper.so", "bin/tool"}},
+		{[]string{"docs/**"}, []string{"docs"}, nil},
+	} {
+		dest := t.TempDir()
+		if err := ai.ExtractMatching(dest, c.include, c.exclude); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				rel, _ := filepath.Rel(dest, p)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			return err
+		})
+		if !slices.Equal(got, c.want) {
+			t.Errorf("include %q, exclude %q: extracted %q, want %q", c.include, c.exclude, got, c.want)
+		}
+	}
+
+	dest := t.TempDir()
+	if err := ai.ExtractMatching(dest, []string{"bin/**"}, nil, StripComponents(1)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "tool")); err != nil || string(data) != "tool" {
+		t.Errorf("stripped tool: %q, %v", data, err)
+	}
+	if err := ai.ExtractMatching(t.TempDir(), []string{"bin/["}, nil); !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("bad pattern: %v", err)
+	}
+}
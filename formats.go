@@ -0,0 +1,151 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// A format beyond the built-in ones, compiled in by build tag or added
+// with RegisterMagic.  Detection runs after the built-ins, so an optional
+// format can't shadow them.
+type formatHandler struct {
+	archiveType ArchiveType
+	magicLength int                                           // Header bytes detect needs, when more than sniffLength
+	detect      func(header []byte) bool                      // Given up to headerLength() leading bytes
+	load        func(ar *ArchiveInfo) error                   // Fill the listing via ar.addFile
+	open        func(af *ArchivedFile) (io.ReadCloser, error) // Stream one entry's content
+	// One pass over the entries for ForEach, where opening each in turn
+	// would reread the archive from the start; nil to open each in turn.
+	each func(ai *ArchiveInfo, fn func(*ArchivedFile, io.Reader) error) error
+}
+
+var (
+	formatsMu       sync.RWMutex
+	optionalFormats []formatHandler
+	nextCustomType  ArchiveType = archiveCustomBase
+)
+
+// RegisterMagic hands out types from here up, clear of the built-ins.
+const archiveCustomBase = 1000
+
+// Called from the init of a tagged format's file, and by RegisterMagic.
+func registerFormat(h formatHandler) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	optionalFormats = append(optionalFormats, h)
+}
+
+// The handler for an optional format, or nil if it isn't compiled in.
+func optionalFormat(t ArchiveType) *formatHandler {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for i := range optionalFormats {
+		if optionalFormats[i].archiveType == t {
+			return &optionalFormats[i]
+		}
+	}
+	return nil
+}
+
+// The optional format whose signature header carries, if any.
+func detectOptional(header []byte) ArchiveType {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, h := range optionalFormats {
+		if h.detect(header) {
+			return h.archiveType
+		}
+	}
+	return ARCHIVE_NA
+}
+
+// Leading bytes needed to recognise every registered format.
+func headerLength() int {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	n := sniffLength
+	for _, h := range optionalFormats {
+		n = max(n, h.magicLength)
+	}
+	return n
+}
+
+// A format the package doesn't read itself, registered with RegisterMagic.
+// Both methods are given the whole archive; they may be called
+// concurrently, and should not hold on to r after returning (List) or
+// after the reader is closed (Open).
+type FormatHandler interface {
+	// The entries, in archive order.
+	List(r io.ReaderAt, size int64) ([]FormatEntry, error)
+	// The content of the index'th entry of List's result.
+	Open(r io.ReaderAt, size int64, index int) (io.ReadCloser, error)
+}
+
+// One entry, as listed by a FormatHandler.  Directories are marked in Mode.
+type FormatEntry struct {
+	Name    string
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+}
+
+// Route archives starting with magic to handler, and return the type they
+// will be given.  Built-in formats are always checked first, then
+// registered ones in the order they were added.  Typically called from an
+// init function.
+func RegisterMagic(magic []byte, handler FormatHandler) ArchiveType {
+	if len(magic) == 0 {
+		panic("archiver: RegisterMagic with an empty magic")
+	}
+	magic = bytes.Clone(magic)
+	formatsMu.Lock()
+	t := nextCustomType
+	nextCustomType++
+	formatsMu.Unlock()
+
+	registerFormat(formatHandler{
+		archiveType: t,
+		magicLength: len(magic),
+		detect:      func(header []byte) bool { return bytes.HasPrefix(header, magic) },
+		load:        func(ar *ArchiveInfo) error { return ar.loadCustom(t, handler) },
+		open:        func(af *ArchivedFile) (io.ReadCloser, error) { return af.openCustom(handler) },
+	})
+	return t
+}
+
+func (ar *ArchiveInfo) loadCustom(t ArchiveType, handler FormatHandler) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	entries, err := handler.List(src, src.size)
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	for i, e := range entries {
+		err = ar.addFile(ArchivedFile{archivefile: ar.fullname, archivetype: t, name: e.Name, size: e.Size,
+			IsDir: e.Mode.IsDir(), mode: e.Mode, modTime: e.ModTime, packed: -1, index: i})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (af *ArchivedFile) openCustom(handler FormatHandler) (io.ReadCloser, error) {
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	readCloser, err := handler.Open(src, src.size, af.index)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("%s: %w", af.name, err)
+	}
+	return &entryReader{readCloser, []io.Closer{readCloser, src}}, nil
+}
@@ -0,0 +1,84 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A made-up format: a magic line followed by a plain tar.
+var tarWrapMagic = []byte("TARWRAP1\n")
+
+type tarWrapHandler struct{}
+
+func (tarWrapHandler) body(r io.ReaderAt, size int64) *tar.Reader {
+	return tar.NewReader(io.NewSectionReader(r, int64(len(tarWrapMagic)), size-int64(len(tarWrapMagic))))
+}
+
+func (h tarWrapHandler) List(r io.ReaderAt, size int64) ([]FormatEntry, error) {
+	var entries []FormatEntry
+	tr := h.body(r, size)
+	for {
+		head, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, FormatEntry{Name: head.Name, Size: head.Size, Mode: head.FileInfo().Mode(), ModTime: head.ModTime})
+	}
+}
+
+func (h tarWrapHandler) Open(r io.ReaderAt, size int64, index int) (io.ReadCloser, error) {
+	tr := h.body(r, size)
+	for i := 0; i <= index; i++ {
+		if _, err := tr.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(tr), nil
+}
+
+var tarWrapType = RegisterMagic(tarWrapMagic, tarWrapHandler{})
+
+func TestRegisterMagic(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(tarWrapMagic)
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0o755})
+	tw.WriteHeader(&tar.Header{Name: "sub/hello.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 6})
+	tw.Write([]byte("hello\n"))
+	tw.Close()
+	path := filepath.Join(t.TempDir(), "custom.twr")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ar, err := GetArchiveInfo(path)
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	if ar.ArchiveType != tarWrapType || tarWrapType < archiveCustomBase {
+		t.Errorf("ArchiveType = %v, want %v", ar.ArchiveType, tarWrapType)
+	}
+	if len(ar.Files()) != 2 || !ar.Files()[0].IsDir {
+		t.Fatalf("listing = %v", ar.Files())
+	}
+	data, err := ar.File("sub/hello.txt").GetBytes()
+	if err != nil || string(data) != "hello\n" {
+		t.Errorf("GetBytes() = %q, %v", data, err)
+	}
+
+	// A signature longer than sniffLength is still seen by PeekType.
+	if got, _, _ := PeekType(bytes.NewReader(buf.Bytes())); got != tarWrapType {
+		t.Errorf("PeekType() = %v, want %v", got, tarWrapType)
+	}
+	// Built-ins win over a registered magic that shadows them.
+	RegisterMagic([]byte{0x50, 0x4B, 0x03, 0x04}, tarWrapHandler{})
+	if got := DetectType([]byte{0x50, 0x4B, 0x03, 0x04, 0x00}); got != ARCHIVE_ZIP {
+		t.Errorf("DetectType(zip) = %v, want ARCHIVE_ZIP", got)
+	}
+}
@@ -0,0 +1,314 @@
+package archiver
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ArchiveInfo is a read-only fs.FS over the archive's entries, so it can be
+// handed to fs.WalkDir, http.FS, template.ParseFS and the like.  Paths are
+// the entry names with any "./" prefix and trailing "/" dropped.  Parent
+// directories the archive doesn't list are made up, and entries whose
+// names fs.ValidPath rejects (absolute, "..", empty elements) are left out.
+// Where a name repeats, the first entry wins, as with File.
+var (
+	_ fs.FS         = (*ArchiveInfo)(nil)
+	_ fs.ReadDirFS  = (*ArchiveInfo)(nil)
+	_ fs.ReadFileFS = (*ArchiveInfo)(nil)
+	_ fs.StatFS     = (*ArchiveInfo)(nil)
+	_ fs.GlobFS     = (*ArchiveInfo)(nil)
+)
+
+// One path in the fs.FS view.
+type fsNode struct {
+	name     string        // Full path; "." for the root
+	af       *ArchivedFile // nil for a directory only implied by its contents
+	dir      bool
+	children []*fsNode // Sorted by name
+}
+
+func (n *fsNode) info() fs.FileInfo { return fsInfo{n} }
+
+// The fs.FS paths, built on first use.
+func (ai *ArchiveInfo) fsTree() map[string]*fsNode {
+	ai.treeOnce.Do(func() {
+		tree := map[string]*fsNode{".": {name: ".", dir: true}}
+		// Add name and its parents; nil if a file is in the way.
+		var addDir func(name string) *fsNode
+		addDir = func(name string) *fsNode {
+			if n, found := tree[name]; found {
+				if !n.dir {
+					return nil
+				}
+				return n
+			}
+			parent := addDir(path.Dir(name))
+			if parent == nil {
+				return nil
+			}
+			n := &fsNode{name: name, dir: true}
+			tree[name] = n
+			parent.children = append(parent.children, n)
+			return n
+		}
+		for i := range ai.files {
+			af := &ai.files[i]
+			name := fsName(af.name)
+			if !fs.ValidPath(name) || name == "." {
+				continue
+			}
+			if n, found := tree[name]; found {
+				if n.af == nil && af.isDir() {
+					n.af = af
+				}
+				continue
+			}
+			if af.isDir() {
+				if n := addDir(name); n != nil {
+					n.af = af
+				}
+			} else if parent := addDir(path.Dir(name)); parent != nil {
+				n := &fsNode{name: name, af: af}
+				tree[name] = n
+				parent.children = append(parent.children, n)
+			}
+		}
+		for _, n := range tree {
+			slices.SortFunc(n.children, func(a, b *fsNode) int { return strings.Compare(a.name, b.name) })
+		}
+		ai.tree = tree
+	})
+	return ai.tree
+}
+
+// An entry name as an fs.FS path.
+func fsName(name string) string {
+	for strings.HasPrefix(name, "./") {
+		name = name[2:]
+	}
+	name = strings.TrimSuffix(name, "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (ai *ArchiveInfo) node(op, name string) (*fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	n, found := ai.fsTree()[name]
+	if !found {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return n, nil
+}
+
+// Open the named file or directory, as fs.FS.  Files stream their content;
+// seeking backwards starts the entry over.
+func (ai *ArchiveInfo) Open(name string) (fs.File, error) {
+	n, err := ai.node("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.dir {
+		return &fsDir{node: n}, nil
+	}
+	return &fsFile{node: n}, nil
+}
+
+// The named directory's contents, sorted by name, as fs.ReadDirFS.
+func (ai *ArchiveInfo) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := ai.node("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries := make([]fs.DirEntry, len(n.children))
+	for i, child := range n.children {
+		entries[i] = fs.FileInfoToDirEntry(child.info())
+	}
+	return entries, nil
+}
+
+// The named file's content, as fs.ReadFileFS.
+func (ai *ArchiveInfo) ReadFile(name string) ([]byte, error) {
+	n, err := ai.node("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.dir {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	data, err := n.af.GetBytes()
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// As fs.StatFS.
+func (ai *ArchiveInfo) Stat(name string) (fs.FileInfo, error) {
+	n, err := ai.node("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(), nil
+}
+
+// The paths matching pattern, in the syntax of path.Match, as fs.GlobFS.
+func (ai *ArchiveInfo) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var matches []string
+	for name := range ai.fsTree() {
+		if matched, _ := path.Match(pattern, name); matched && name != "." {
+			matches = append(matches, name)
+		}
+	}
+	slices.Sort(matches)
+	return matches, nil
+}
+
+// fs.FileInfo for an fs.FS path.  Name is the last element, unlike
+// ArchivedFile's.
+type fsInfo struct{ n *fsNode }
+
+func (fi fsInfo) Name() string { return path.Base(fi.n.name) }
+func (fi fsInfo) IsDir() bool  { return fi.n.dir }
+
+func (fi fsInfo) Sys() any {
+	if fi.n.af == nil {
+		return nil
+	}
+	return fi.n.af
+}
+
+func (fi fsInfo) Size() int64 {
+	if fi.n.dir {
+		return 0
+	}
+	return fi.n.af.size
+}
+
+func (fi fsInfo) Mode() fs.FileMode {
+	if fi.n.af == nil {
+		return fs.ModeDir | 0o755
+	}
+	if fi.n.dir {
+		return fs.ModeDir | fi.n.af.mode.Perm()
+	}
+	return fi.n.af.mode
+}
+
+func (fi fsInfo) ModTime() time.Time {
+	if fi.n.af == nil {
+		return time.Time{}
+	}
+	return fi.n.af.modTime
+}
+
+type fsDir struct {
+	node *fsNode
+	next int // Children already returned by ReadDir
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.node.info(), nil }
+func (d *fsDir) Close() error               { return nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.node.children[d.next:]
+	if count > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		rest = rest[:min(count, len(rest))]
+	}
+	d.next += len(rest)
+	entries := make([]fs.DirEntry, len(rest))
+	for i, child := range rest {
+		entries[i] = fs.FileInfoToDirEntry(child.info())
+	}
+	return entries, nil
+}
+
+// A file opened through the fs.FS view.  The entry is opened on the first
+// Read and read through in order; Seek only moves pos, and the next Read
+// skips forward or starts over to catch up.
+type fsFile struct {
+	node   *fsNode
+	rc     io.ReadCloser
+	pos    int64 // Where the caller is
+	rcPos  int64 // Where rc is
+	closed bool
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.node.info(), nil }
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.node.name, Err: fs.ErrClosed}
+	}
+	if f.rc != nil && f.rcPos > f.pos {
+		f.rc.Close()
+		f.rc = nil
+	}
+	if f.rc == nil {
+		rc, err := f.node.af.Open()
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.node.name, Err: err}
+		}
+		f.rc, f.rcPos = rc, 0
+	}
+	if f.rcPos < f.pos {
+		skipped, err := io.CopyN(io.Discard, f.rc, f.pos-f.rcPos)
+		f.rcPos += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.rc.Read(p)
+	f.rcPos += int64(n)
+	f.pos = f.rcPos
+	return n, err
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.node.name, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.node.af.size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.node.name, Err: fs.ErrInvalid}
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *fsFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.node.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	if f.rc != nil {
+		return f.rc.Close()
+	}
+	return nil
+}
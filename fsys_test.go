@@ -0,0 +1,63 @@
+package archiver
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestArchiveFS(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fstest.TestFS(ar, "README.md", "docs/guide.md", "docs/api/index.md", "src/main.go"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(ar, "docs/guide.md")
+	if err != nil || string(data) != "# Guide\n\nStart with the install section.\n" {
+		t.Errorf("ReadFile() = %q, %v", data, err)
+	}
+	matches, err := fs.Glob(ar, "docs/*.md")
+	if err != nil || !slices.Equal(matches, []string{"docs/guide.md"}) {
+		t.Errorf("Glob() = %v, %v", matches, err)
+	}
+	if _, err = ar.Open("../README.md"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open(\"../README.md\") error = %v, want fs.ErrInvalid", err)
+	}
+
+	// Seeking back starts the entry over.
+	f, err := ar.Open("src/notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	first, _ := io.ReadAll(f)
+	f.(io.Seeker).Seek(2, io.SeekStart)
+	if rest, _ := io.ReadAll(f); string(rest) != string(first[2:]) {
+		t.Errorf("read %q after Seek(2), want %q", rest, first[2:])
+	}
+}
+
+func TestArchiveFSImpliedDirs(t *testing.T) {
+	// test.tar.xz lists pkg/ but not pkg/bin/.
+	ar, err := GetArchiveInfo("testassets/test.tar.xz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var walked []string
+	err = fs.WalkDir(ar, ".", func(name string, d fs.DirEntry, err error) error {
+		walked = append(walked, name)
+		return err
+	})
+	want := []string{".", "pkg", "pkg/bin", "pkg/bin/run.sh", "pkg/manifest.json"}
+	if err != nil || !slices.Equal(walked, want) {
+		t.Errorf("WalkDir() visited %v, %v, want %v", walked, err, want)
+	}
+	if info, err := fs.Stat(ar, "pkg/bin"); err != nil || !info.IsDir() || info.Name() != "bin" {
+		t.Errorf("Stat(\"pkg/bin\") = %v, %v", info, err)
+	}
+}
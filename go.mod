@@ -2,17 +2,20 @@ module github.com/robomac/archiver
 
 go 1.21.5
 
-require github.com/bodgit/sevenzip v1.5.0
+require (
+	github.com/andybalholm/brotli v1.1.0
+	github.com/bodgit/sevenzip v1.5.0
+	github.com/klauspost/compress v1.17.6
+	github.com/nwaples/rardecode/v2 v2.2.0
+	github.com/pierrec/lz4/v4 v4.1.21
+	github.com/ulikunitz/xz v0.5.11
+	golang.org/x/text v0.14.0
+)
 
 require (
-	github.com/andybalholm/brotli v1.1.0 // indirect
 	github.com/bodgit/plumbing v1.3.0 // indirect
 	github.com/bodgit/windows v1.0.1 // indirect
 	github.com/hashicorp/errwrap v1.0.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
-	github.com/klauspost/compress v1.17.6 // indirect
-	github.com/pierrec/lz4/v4 v4.1.21 // indirect
-	github.com/ulikunitz/xz v0.5.11 // indirect
 	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
-	golang.org/x/text v0.14.0 // indirect
 )
@@ -0,0 +1,28 @@
+package archiver
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Serve ai's entries over HTTP, at their fs.FS paths under the handler's
+// root; use http.StripPrefix to mount it elsewhere.  Files are served as
+// http.FileServer serves them: Content-Type from the extension or sniffed,
+// Content-Length, Last-Modified, and Range and conditional requests.
+// Entries with a CRC-32 get an ETag made from it and the size, so
+// If-None-Match works for zip, 7z and RAR.  Directories are listed, or
+// serve their index.html.
+func NewArchiveHandler(ai *ArchiveInfo) http.Handler {
+	files := http.FileServer(http.FS(ai))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := fsName(strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/"))
+		if n, found := ai.fsTree()[name]; found && !n.dir {
+			if crc, ok := n.af.CRC32(); ok {
+				w.Header().Set("ETag", fmt.Sprintf(`"%08x-%x"`, crc, n.af.size))
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,71 @@
+package archiver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveHandler(t *testing.T) {
+	ai, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.StripPrefix("/tree", NewArchiveHandler(ai)))
+	defer server.Close()
+	get := func(path string, header ...string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	af := ai.File("src/main.go")
+	want, err := af.GetString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, body := get("/tree/src/main.go")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || body != want || etag == "" ||
+		resp.Header.Get("Content-Length") != "29" || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/") ||
+		resp.Header.Get("Last-Modified") != af.ModTime().UTC().Format(http.TimeFormat) {
+		t.Fatalf("GET main.go: %s %v %q", resp.Status, resp.Header, body)
+	}
+	if resp, _ := get("/tree/src/main.go", "If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match: %s", resp.Status)
+	}
+	if resp, _ := get("/tree/src/notes.txt", "If-None-Match", etag); resp.StatusCode != http.StatusOK {
+		t.Errorf("another file's ETag: %s", resp.Status)
+	}
+	since := af.ModTime().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if resp, _ := get("/tree/src/main.go", "If-Modified-Since", since); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: %s", resp.Status)
+	}
+	if resp, body := get("/tree/src/main.go", "Range", "bytes=8-11"); resp.StatusCode != http.StatusPartialContent || body != want[8:12] {
+		t.Errorf("Range: %s %q", resp.Status, body)
+	}
+	if resp, body := get("/tree/docs/"); resp.StatusCode != http.StatusOK || !strings.Contains(body, "guide.md") {
+		t.Errorf("GET docs/: %s %q", resp.Status, body)
+	}
+	if resp, _ := get("/tree/docs/missing.md"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing file: %s", resp.Status)
+	}
+}
@@ -0,0 +1,49 @@
+package archiver
+
+import "fmt"
+
+// A canonical Huffman code as a table indexed by the next bits: each
+// entry is a symbol shifted left 5, or'd with its code length.
+type huffTable struct {
+	table []uint16
+	bits  uint // Longest code; 0 for an empty tree
+}
+
+func (t *huffTable) build(lens []byte) error {
+	var maxLen byte
+	for _, l := range lens {
+		maxLen = max(maxLen, l)
+	}
+	if maxLen > 16 {
+		return fmt.Errorf("%w: Huffman code over 16 bits", ErrCorruptArchive)
+	}
+	t.bits = uint(maxLen)
+	if maxLen == 0 {
+		return nil
+	}
+	if size := 1 << maxLen; cap(t.table) >= size {
+		t.table = t.table[:size]
+		clear(t.table)
+	} else {
+		t.table = make([]uint16, size)
+	}
+	code := 0
+	for l := byte(1); l <= maxLen; l++ {
+		for sym, symLen := range lens {
+			if symLen != l {
+				continue
+			}
+			span := 1 << (maxLen - l)
+			first := code * span
+			if first+span > len(t.table) {
+				return fmt.Errorf("%w: oversubscribed Huffman tree", ErrCorruptArchive)
+			}
+			for i := first; i < first+span; i++ {
+				t.table[i] = uint16(sym)<<5 | uint16(l)
+			}
+			code++
+		}
+		code <<= 1
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package archiver
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// List a directory entry for every parent directory that a zip's or tar's
+// entries imply but the archive leaves out, as zip tools often do, so the
+// listing, ForEach and extraction see the directories a 7z or an ISO would
+// give.  Each made-up entry is named as the entries under it are, with a
+// trailing "/", and goes just before the first of them.  It has mode 0755,
+// no modification time and no content; IsImplied reports it.  Off by
+// default.
+func WithImpliedDirs() Option {
+	return func(o *options) { o.impliedDirs = true }
+}
+
+// Reports whether WithImpliedDirs made the entry up.
+func (af *ArchivedFile) IsImplied() bool { return af.implied }
+
+func (ar *ArchiveInfo) addImpliedDirs() {
+	listed := make(map[string]bool, len(ar.files))
+	for i := range ar.files {
+		listed[fsName(ar.files[i].name)] = true
+	}
+	files := make([]ArchivedFile, 0, len(ar.files))
+	for _, af := range ar.files {
+		name := strings.TrimSuffix(af.name, "/")
+		for i, c := range name {
+			if c != '/' {
+				continue
+			}
+			dir := fsName(name[:i])
+			if dir == "." || !fs.ValidPath(dir) || listed[dir] {
+				continue
+			}
+			listed[dir] = true
+			files = append(files, ArchivedFile{archivefile: ar.fullname, archivetype: ar.ArchiveType, name: name[:i+1],
+				IsDir: true, mode: fs.ModeDir | 0o755, stream: -1, index: af.index, implied: true, archive: ar})
+		}
+		files = append(files, af)
+	}
+	ar.files = files
+}
+
+// fn, with the directories WithImpliedDirs made up passed to it, empty,
+// just before the entry that implied each.  For ForEach, whose passes over
+// the archive only know its own entries.
+func (ai *ArchiveInfo) impliedFirst(fn func(*ArchivedFile, io.Reader) error) func(*ArchivedFile, io.Reader) error {
+	before := make(map[int][]*ArchivedFile)
+	for i := range ai.files {
+		if af := &ai.files[i]; af.implied {
+			before[af.index] = append(before[af.index], af)
+		}
+	}
+	if len(before) == 0 {
+		return fn
+	}
+	return func(af *ArchivedFile, r io.Reader) error {
+		for _, dir := range before[af.index] {
+			if err := fn(dir, bytes.NewReader(nil)); err != nil {
+				return err
+			}
+		}
+		delete(before, af.index)
+		return fn(af, r)
+	}
+}
@@ -0,0 +1,99 @@
+package archiver
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestImpliedDirs(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := writeTestZip(t, dir, "flat.zip", [][2]string{
+		{"a/b/c.txt", "ccc"},
+		{"a/d.txt", "dddd"},
+		{"e/", ""},
+		{"e/f/g.txt", "g"},
+		{"h.txt", "h"},
+	})
+	tgzPath := writeTestTgz(t, dir, "flat.tgz", []testTarEntry{
+		{tar.Header{Name: "./a/b/c.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "ccc"},
+		{tar.Header{Name: "./a/d.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "dddd"},
+		{tar.Header{Name: "./e/", Typeflag: tar.TypeDir, Mode: 0o755}, ""},
+		{tar.Header{Name: "./e/f/g.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "g"},
+		{tar.Header{Name: "./h.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "h"},
+	})
+	for _, c := range []struct {
+		path string
+		want []string
+	}{
+		{zipPath, []string{"a/", "a/b/", "a/b/c.txt", "a/d.txt", "e/", "e/f/", "e/f/g.txt", "h.txt"}},
+		{tgzPath, []string{"./a/", "./a/b/", "./a/b/c.txt", "./a/d.txt", "./e/", "./e/f/", "./e/f/g.txt", "./h.txt"}},
+	} {
+		plain, err := GetArchiveInfo(c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plain.Files()) != 5 {
+			t.Errorf("%s: %d entries without WithImpliedDirs", c.path, len(plain.Files()))
+		}
+
+		ai, err := GetArchiveInfo(c.path, WithImpliedDirs())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names := entryNames(ai); !slices.Equal(names, c.want) {
+			t.Fatalf("%s: listed %q, want %q", c.path, names, c.want)
+		}
+		for _, i := range []int{0, 1, 5} {
+			af := ai.FileAt(i)
+			if !af.IsImplied() || !af.IsDir || af.Mode() != fs.ModeDir|0o755 || !af.ModTime().IsZero() {
+				t.Errorf("%s: %s is %+v", c.path, af.Name(), af)
+			}
+			if data, err := af.GetBytes(); err != nil || len(data) != 0 {
+				t.Errorf("%s: %s reads %q, %v", c.path, af.Name(), data, err)
+			}
+		}
+		if ai.FileAt(4).IsImplied() || ai.FileAt(2).IsImplied() {
+			t.Errorf("%s: listed entries marked implied", c.path)
+		}
+
+		var visited []string
+		err = ai.ForEach(func(af *ArchivedFile, r io.Reader) error {
+			data, err := io.ReadAll(r)
+			if err == nil && af.IsImplied() && len(data) > 0 {
+				t.Errorf("%s: %s has content", c.path, af.Name())
+			}
+			visited = append(visited, af.Name())
+			return err
+		})
+		if err != nil || !slices.Equal(visited, c.want) {
+			t.Errorf("%s: ForEach visited %q, %v", c.path, visited, err)
+		}
+		if got, err := ai.FileAt(2).GetBytes(); err != nil || string(got) != "ccc" {
+			t.Errorf("%s: c.txt reads %q, %v", c.path, got, err)
+		}
+
+		dest := filepath.Join(dir, filepath.Base(c.path)+".out")
+		if err := ai.ExtractAll(dest); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(filepath.Join(dest, "a/b")); err != nil || !info.IsDir() {
+			t.Errorf("%s: extracted a/b: %v", c.path, err)
+		}
+		if root := ai.Tree(); root.Lookup("a/b").File != ai.FileAt(1) || root.Size != 9 {
+			t.Errorf("%s: tree is %+v", c.path, root)
+		}
+	}
+
+	sorted, err := GetArchiveInfo(zipPath, WithImpliedDirs(), WithSortedListing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := entryNames(sorted); !slices.IsSorted(names) || len(names) != 8 {
+		t.Errorf("sorted listing: %q", names)
+	}
+}
@@ -0,0 +1,193 @@
+package archiver
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Lookups over the listing, built on first use.  The listing doesn't change
+// once GetArchiveInfo returns, so neither does this.
+type nameIndex struct {
+	byName map[string]int   // First entry with each exact name
+	byFold map[string]int   // First entry with each foldName
+	byExt  map[string][]int // Lower-cased ".ext" of non-directories, in listing order
+	total  int64            // Uncompressed bytes in non-directories
+}
+
+func (ai *ArchiveInfo) lookup() *nameIndex {
+	ai.indexOnce.Do(func() {
+		idx := &nameIndex{byName: make(map[string]int, len(ai.files)), byFold: make(map[string]int, len(ai.files)),
+			byExt: make(map[string][]int)}
+		for i := range ai.files {
+			af := &ai.files[i]
+			if _, dup := idx.byName[af.name]; !dup {
+				idx.byName[af.name] = i
+			}
+			if _, dup := idx.byFold[foldName(af.name)]; !dup {
+				idx.byFold[foldName(af.name)] = i
+			}
+			if ext := strings.ToLower(path.Ext(af.name)); ext != "" && !af.isDir() {
+				idx.byExt[ext] = append(idx.byExt[ext], i)
+			}
+			if !af.isDir() {
+				idx.total += max(af.size, 0)
+			}
+		}
+		ai.index = idx
+	})
+	return ai.index
+}
+
+// The entry called name, give or take case and separators, for archives
+// made on Windows: "Docs/readme.txt" finds "docs\README.TXT".
+// Backslashes count as "/", and a leading "./" or trailing "/" is ignored.
+// Where several entries fold to the same name, the first wins.  nil if
+// there's none.
+func (ai *ArchiveInfo) FileFold(name string) *ArchivedFile {
+	idx, found := ai.lookup().byFold[foldName(name)]
+	if !found {
+		return nil
+	}
+	return &ai.files[idx]
+}
+
+// A name with separators and case evened out, for FileFold.
+func foldName(name string) string {
+	return strings.ToLower(fsName(strings.ReplaceAll(name, "\\", "/")))
+}
+
+// Entries, not directories, whose extension is any of exts, in listing
+// order.  Matching ignores case, and ".txt" and "txt" are the same.
+func (ai *ArchiveInfo) FilesWithExt(exts ...string) []*ArchivedFile {
+	idx := ai.lookup()
+	var positions []int
+	for _, ext := range exts {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		positions = append(positions, idx.byExt[ext]...)
+	}
+	slices.Sort(positions)
+	positions = slices.Compact(positions)
+	matches := make([]*ArchivedFile, len(positions))
+	for i, pos := range positions {
+		matches[i] = &ai.files[pos]
+	}
+	return matches
+}
+
+// Entries whose name matches pattern, in listing order.  The syntax is
+// path.Match's, plus "**" as a whole element, which matches any number of
+// directories, none included: "**/*.dll" finds DLLs at any depth, and
+// "docs/**" everything under docs.  Names are matched without a leading
+// "./" or trailing "/", so patterns find directories too.  The only error
+// is path.ErrBadPattern.
+func (ai *ArchiveInfo) FilesMatching(pattern string) ([]*ArchivedFile, error) {
+	elems, err := globElements(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*ArchivedFile
+	for i := range ai.files {
+		if name := fsName(ai.files[i].name); name != "." && globMatch(elems, strings.Split(name, "/")) {
+			matches = append(matches, &ai.files[i])
+		}
+	}
+	return matches, nil
+}
+
+// pattern split into elements for globMatch, each checked by path.Match.
+func globElements(pattern string) ([]string, error) {
+	elems := strings.Split(pattern, "/")
+	for _, elem := range elems {
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, err
+		}
+	}
+	return elems, nil
+}
+
+// Reports whether the name elements match the pattern elements, with "**"
+// standing for any number of them.
+func globMatch(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(name); skip++ {
+				if globMatch(pattern[1:], name[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Entries whose stored name re matches, in listing order.  As usual for
+// regexp, a match anywhere in the name counts; anchor re with ^ and $ to
+// match whole names.
+func (ai *ArchiveInfo) FilesMatchingRegexp(re *regexp.Regexp) []*ArchivedFile {
+	var matches []*ArchivedFile
+	for i := range ai.files {
+		if re.MatchString(ai.files[i].name) {
+			matches = append(matches, &ai.files[i])
+		}
+	}
+	return matches
+}
+
+// The uncompressed size of every non-directory entry added together, for
+// sizing a progress bar over ForEach or extraction.  It's worked out once,
+// from the listing.  Every built-in format records exact sizes; an entry
+// from a RegisterMagic handler that reports a negative size counts as 0,
+// so the total is a lower bound there.
+func (ai *ArchiveInfo) ProgressTotalBytes() int64 {
+	return ai.lookup().total
+}
+
+// The entries to extract so that names come out whole: the named entries
+// themselves, the directory entries above them, so their paths are created
+// with the recorded modes and times, and for tar hardlinks the entries
+// they link to, with those entries' own dependencies.  The result is in
+// listing order, each entry once.  Names not in the archive are ignored.
+func (ai *ArchiveInfo) Closure(names []string) []*ArchivedFile {
+	need := make(map[*ArchivedFile]bool)
+	var add func(name string)
+	add = func(name string) {
+		af := ai.File(name)
+		if af == nil || need[af] {
+			return
+		}
+		need[af] = true
+		for dir := path.Dir(strings.TrimSuffix(name, "/")); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if d := ai.File(dir + "/"); d != nil {
+				need[d] = true
+			} else if d = ai.File(dir); d != nil && d.isDir() {
+				need[d] = true
+			}
+		}
+		if af.hardlink {
+			add(af.linkname)
+		}
+	}
+	for _, name := range names {
+		add(name)
+	}
+	var closure []*ArchivedFile
+	for i := range ai.files {
+		if need[&ai.files[i]] {
+			closure = append(closure, &ai.files[i])
+		}
+	}
+	return closure
+}
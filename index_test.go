@@ -0,0 +1,157 @@
+package archiver
+
+import (
+	"archive/tar"
+	"path"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestFilesWithExt(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testdata := []struct {
+		exts []string
+		want []string
+	}{{[]string{".txt", ".md"}, []string{"README.md", "docs/guide.md", "docs/api/index.md", "docsextra.txt", "src/notes.txt"}},
+		{[]string{"GO"}, []string{"src/main.go"}},
+		{[]string{"txt", ".TXT"}, []string{"docsextra.txt", "src/notes.txt"}},
+		{[]string{".png"}, nil},
+	}
+	for _, test := range testdata {
+		got := ar.FilesWithExt(test.exts...)
+		if len(got) != len(test.want) {
+			t.Errorf("FilesWithExt(%q) returned %d entries, want %d", test.exts, len(got), len(test.want))
+			continue
+		}
+		for i, af := range got {
+			if af.Name() != test.want[i] {
+				t.Errorf("FilesWithExt(%q)[%d] = %s, want %s", test.exts, i, af.Name(), test.want[i])
+			}
+		}
+	}
+}
+
+func TestFilesMatching(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testdata := []struct {
+		pattern string
+		want    []string
+	}{{"**/*.md", []string{"README.md", "docs/guide.md", "docs/api/index.md"}},
+		{"*.md", []string{"README.md"}},
+		{"docs/**", []string{"docs/", "docs/guide.md", "docs/api/", "docs/api/index.md"}},
+		{"docs/**/*.md", []string{"docs/guide.md", "docs/api/index.md"}},
+		{"docs*", []string{"docs/", "docsextra.txt"}},
+		{"src/[mn]*", []string{"src/main.go", "src/notes.txt"}},
+		{"**/*.dll", nil},
+	}
+	for _, test := range testdata {
+		got, err := ar.FilesMatching(test.pattern)
+		if err != nil {
+			t.Errorf("FilesMatching(%q) error = %v", test.pattern, err)
+		}
+		var names []string
+		for _, af := range got {
+			names = append(names, af.Name())
+		}
+		if !slices.Equal(names, test.want) {
+			t.Errorf("FilesMatching(%q) = %q, want %q", test.pattern, names, test.want)
+		}
+	}
+	if _, err = ar.FilesMatching("src/[m"); err != path.ErrBadPattern {
+		t.Errorf("FilesMatching(bad) error = %v, want path.ErrBadPattern", err)
+	}
+
+	var names []string
+	for _, af := range ar.FilesMatchingRegexp(regexp.MustCompile(`^docs/.*\.md$`)) {
+		names = append(names, af.Name())
+	}
+	if want := []string{"docs/guide.md", "docs/api/index.md"}; !slices.Equal(names, want) {
+		t.Errorf("FilesMatchingRegexp() = %q, want %q", names, want)
+	}
+}
+
+func TestFileFold(t *testing.T) {
+	ar, err := GetArchiveInfo(writeTestZip(t, t.TempDir(), "windows.zip", [][2]string{
+		{"docs\\README.TXT", "readme"},
+		{"Docs\\Readme.txt", "shadowed"},
+		{".\\Setup\\", ""},
+		{"setup/Install.EXE", "exe"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testdata := []struct {
+		name string
+		want string // Stored name; "" for not found
+	}{{"Docs/readme.txt", "docs\\README.TXT"},
+		{"DOCS\\README.TXT", "docs\\README.TXT"},
+		{"./docs/readme.txt", "docs\\README.TXT"},
+		{"setup", ".\\Setup\\"},
+		{"SETUP/install.exe", "setup/Install.EXE"},
+		{"docs/readme", ""},
+	}
+	for _, test := range testdata {
+		af := ar.FileFold(test.name)
+		switch {
+		case af == nil && test.want != "":
+			t.Errorf("FileFold(%q) found nothing, want %q", test.name, test.want)
+		case af != nil && af.Name() != test.want:
+			t.Errorf("FileFold(%q) = %q, want %q", test.name, af.Name(), test.want)
+		}
+	}
+	if ar.File("Docs/readme.txt") != nil {
+		t.Error("File() folded the name")
+	}
+}
+
+func TestProgressTotalBytes(t *testing.T) {
+	for _, filename := range []string{"testassets/tree.zip", "testassets/sz_test.7z", "testassets/tgz_test.tgz"} {
+		ar, err := GetArchiveInfo(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want int64
+		for _, af := range ar.Files() {
+			if !af.IsDir {
+				want += af.Size()
+			}
+		}
+		if got := ar.ProgressTotalBytes(); got != want || got == 0 {
+			t.Errorf("%s ProgressTotalBytes() = %d, want %d", filename, got, want)
+		}
+	}
+}
+
+func TestClosure(t *testing.T) {
+	dir := func(name string) testTarEntry {
+		return testTarEntry{tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0o755}, ""}
+	}
+	file := func(name string) testTarEntry {
+		return testTarEntry{tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644}, name}
+	}
+	path := writeTestTgz(t, t.TempDir(), "deps.tgz", []testTarEntry{
+		dir("a/"), dir("a/b/"), dir("a/b/c/"), file("a/b/c/deep.txt"), file("a/other.txt"),
+		dir("lib/"), file("lib/real.so"),
+		{tar.Header{Name: "a/b/link.so", Typeflag: tar.TypeLink, Linkname: "lib/real.so"}, ""},
+		dir("unrelated/"),
+	})
+	ar, err := GetArchiveInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, af := range ar.Closure([]string{"a/b/c/deep.txt", "a/b/link.so", "missing.txt"}) {
+		got = append(got, af.Name())
+	}
+	want := []string{"a/", "a/b/", "a/b/c/", "a/b/c/deep.txt", "lib/", "lib/real.so", "a/b/link.so"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Closure() = %v, want %v", got, want)
+	}
+}
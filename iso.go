@@ -0,0 +1,552 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// ISO 9660 disc images, with the Rock Ridge and Joliet extensions for long
+// names, and UDF, which DVD and installer images carry alongside ISO 9660
+// or instead of it.  Where an image has both, the UDF tree is listed: on
+// bridge discs the ISO 9660 side may be a stub.  Rock Ridge is preferred
+// to Joliet, as it carries modes and symlinks too.
+
+const (
+	isoSectorSize      = 2048
+	isoDescriptorStart = 16 * isoSectorSize
+	isoMaxDepth        = 64 // Deeper directory trees are taken to loop
+)
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_ISO,
+		detect:      isISOHeader,
+		load:        loadDiscImage,
+		open:        openStoredEntry,
+	})
+}
+
+// Reports whether header, if it's long enough to reach the first volume
+// descriptor, carries an ISO 9660 or UDF signature there.  The descriptor
+// is 32K in, further than DetectType is usually given, so getArchiveType
+// also probes for it with isDiscImage.
+func isISOHeader(header []byte) bool {
+	if len(header) < isoDescriptorStart+6 {
+		return false
+	}
+	id := string(header[isoDescriptorStart+1 : isoDescriptorStart+6])
+	return id == "CD001" || id == "BEA01"
+}
+
+func isDiscImage(r io.ReaderAt, size int64) bool {
+	if size < isoDescriptorStart+isoSectorSize {
+		return false
+	}
+	id := make([]byte, 6)
+	if _, err := r.ReadAt(id, isoDescriptorStart); err != nil {
+		return false
+	}
+	return isISOHeader(append(make([]byte, isoDescriptorStart), id...))
+}
+
+// A run of an image entry's data.  offset -1 is a hole, reading as zeros.
+type imageExtent struct {
+	offset, length int64
+}
+
+func loadDiscImage(ar *ArchiveInfo) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	if hasUDF(src) {
+		return ar.loadUDF(src, src.size)
+	}
+	return ar.loadISO9660(src, src.size)
+}
+
+// Stream an entry kept uncompressed in the archive, as its extents say.
+func openStoredEntry(af *ArchivedFile) (io.ReadCloser, error) {
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	var pieces []io.Reader
+	for _, e := range af.extents {
+		if e.offset < 0 {
+			pieces = append(pieces, io.LimitReader(zeroReader{}, e.length))
+		} else {
+			pieces = append(pieces, io.NewSectionReader(src, e.offset, e.length))
+		}
+	}
+	return &entryReader{io.MultiReader(pieces...), []io.Closer{src}}, nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// One of the image's directory trees: the primary volume descriptor's, or
+// a Joliet supplementary one's.
+type isoVolume struct {
+	root      []byte // Root directory record
+	blockSize int64
+	joliet    bool
+}
+
+// Find the volumes, then walk Rock Ridge, Joliet or plain ISO 9660 names
+// in that order of preference.
+func (ar *ArchiveInfo) loadISO9660(r io.ReaderAt, size int64) error {
+	var primary, joliet *isoVolume
+	desc := make([]byte, isoSectorSize)
+	for sector := int64(16); desc[0] != 255; sector++ { // 255 ends the set
+		if _, err := r.ReadAt(desc, sector*isoSectorSize); err != nil {
+			return openError(ar.fullname, err)
+		}
+		if string(desc[1:6]) != "CD001" {
+			return openError(ar.fullname, fmt.Errorf("%w: bad volume descriptor at sector %d", ErrCorruptArchive, sector))
+		}
+		vol := &isoVolume{root: bytes.Clone(desc[156:190]), blockSize: int64(binary.LittleEndian.Uint16(desc[128:]))}
+		if vol.blockSize == 0 {
+			vol.blockSize = isoSectorSize
+		}
+		switch desc[0] {
+		case 1:
+			if primary == nil {
+				primary = vol
+			}
+		case 2:
+			// UCS-2 level 1, 2 or 3.
+			if esc := string(desc[88:91]); esc == "%/@" || esc == "%/C" || esc == "%/E" {
+				vol.joliet = true
+				if joliet == nil {
+					joliet = vol
+				}
+			}
+		}
+	}
+	if primary == nil {
+		return openError(ar.fullname, fmt.Errorf("%w: no primary volume descriptor", ErrCorruptArchive))
+	}
+	w := &isoWalker{ar: ar, r: r, size: size, vol: primary, visited: make(map[int64]bool)}
+	if err := w.findRockRidge(); err != nil {
+		return openError(ar.fullname, err)
+	}
+	if !w.rockRidge && joliet != nil {
+		w.vol = joliet
+	}
+	root, ok := parseISORecord(w.vol.root)
+	if !ok {
+		return openError(ar.fullname, fmt.Errorf("%w: bad root directory record", ErrCorruptArchive))
+	}
+	return w.walkDir(root, "", 0)
+}
+
+type isoWalker struct {
+	ar        *ArchiveInfo
+	r         io.ReaderAt
+	size      int64 // Of the image
+	vol       *isoVolume
+	rockRidge bool
+	skip      int            // System use bytes to skip, from Rock Ridge's SP
+	visited   map[int64]bool // Directory extents walked, against loops
+	count     int            // Entries listed so far
+}
+
+// A directory record's fields.
+type isoRecord struct {
+	extent    int64 // Block
+	size      int64
+	flags     byte
+	name      string
+	modTime   time.Time
+	systemUse []byte
+}
+
+const (
+	isoFlagDir         = 0x02
+	isoFlagMultiExtent = 0x80
+)
+
+func parseISORecord(rec []byte) (isoRecord, bool) {
+	if len(rec) < 34 || int(rec[0]) > len(rec) || 33+int(rec[32]) > int(rec[0]) {
+		return isoRecord{}, false
+	}
+	rec = rec[:rec[0]]
+	nameLen := int(rec[32])
+	r := isoRecord{extent: int64(binary.LittleEndian.Uint32(rec[2:])), size: int64(binary.LittleEndian.Uint32(rec[10:])),
+		flags: rec[25], name: string(rec[33 : 33+nameLen]), modTime: isoRecordTime(rec[18:25])}
+	if end := 33 + nameLen + 1 - nameLen%2; end < len(rec) {
+		r.systemUse = rec[end:]
+	}
+	return r, true
+}
+
+// The 7-byte directory record date: years since 1900, month, day, hour,
+// minute, second, and the zone in quarter hours east of UTC.
+func isoRecordTime(b []byte) time.Time {
+	if b[1] == 0 {
+		return time.Time{}
+	}
+	zone := time.FixedZone("", int(int8(b[6]))*15*60)
+	return time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, zone)
+}
+
+// The 17-byte volume descriptor date: digits to the hundredth of a
+// second, then the zone as above.
+func isoDigitTime(b []byte) time.Time {
+	var fields [7]int
+	for i, width := range []int{4, 2, 2, 2, 2, 2, 2} {
+		for _, c := range b[:width] {
+			if c < '0' || c > '9' {
+				return time.Time{}
+			}
+			fields[i] = fields[i]*10 + int(c-'0')
+		}
+		b = b[width:]
+	}
+	if fields[0] == 0 {
+		return time.Time{}
+	}
+	zone := time.FixedZone("", int(int8(b[0]))*15*60)
+	return time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5], fields[6]*1e7, zone)
+}
+
+// Read a directory's records, calling fn with each but "." and "..".
+func (w *isoWalker) records(dir isoRecord, fn func(rec isoRecord) error) error {
+	if dir.extent*w.vol.blockSize+dir.size > w.size {
+		return fmt.Errorf("%w: directory at block %d runs past the end", ErrCorruptArchive, dir.extent)
+	}
+	data := make([]byte, dir.size)
+	if _, err := w.r.ReadAt(data, dir.extent*w.vol.blockSize); err != nil {
+		return fmt.Errorf("directory at block %d: %w", dir.extent, err)
+	}
+	for pos := 0; pos < len(data); {
+		if data[pos] == 0 { // Records don't cross sectors; the rest is padding
+			pos = (pos/isoSectorSize + 1) * isoSectorSize
+			continue
+		}
+		rec, ok := parseISORecord(data[pos:])
+		if !ok {
+			return fmt.Errorf("%w: bad directory record at block %d", ErrCorruptArchive, dir.extent)
+		}
+		pos += int(data[pos])
+		if rec.name == "\x00" || rec.name == "\x01" {
+			continue
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Look for Rock Ridge's SP entry in the root's "." record.
+func (w *isoWalker) findRockRidge() error {
+	root, ok := parseISORecord(w.vol.root)
+	if !ok {
+		return fmt.Errorf("%w: bad root directory record", ErrCorruptArchive)
+	}
+	data := make([]byte, min(root.size, isoSectorSize))
+	if _, err := w.r.ReadAt(data, root.extent*w.vol.blockSize); err != nil {
+		return err
+	}
+	dot, ok := parseISORecord(data)
+	if !ok {
+		return nil
+	}
+	su := dot.systemUse
+	if len(su) >= 7 && string(su[:2]) == "SP" && su[4] == 0xBE && su[5] == 0xEF {
+		w.rockRidge, w.skip = true, int(su[6])
+	}
+	return nil
+}
+
+// What Rock Ridge says of an entry.
+type rockRidgeInfo struct {
+	name       string
+	hasName    bool
+	mode       fs.FileMode
+	hasMode    bool
+	linkname   string
+	modTime    time.Time
+	accessTime time.Time
+	createTime time.Time
+	changeTime time.Time
+	childLink  int64 // Relocated directory's block, from CL; -1 for none
+	relocated  bool  // RE: the directory's real place is under a CL
+}
+
+// Gather the SUSP entries of a record's system use area, following
+// continuation areas.
+func (w *isoWalker) rockRidgeInfo(su []byte) rockRidgeInfo {
+	info := rockRidgeInfo{childLink: -1}
+	if w.skip < len(su) {
+		su = su[w.skip:]
+	} else {
+		su = nil
+	}
+	var link []string
+	var linkOpen bool // Last SL component continues
+	for hops := 0; len(su) >= 4; {
+		sig, size := string(su[:2]), int(su[2])
+		if size < 4 || size > len(su) {
+			break
+		}
+		body := su[4:size]
+		su = su[size:]
+		switch sig {
+		case "NM":
+			if len(body) >= 1 && body[0]&0x06 == 0 {
+				info.name += string(body[1:])
+				info.hasName = true
+			}
+		case "PX":
+			if len(body) >= 4 {
+				info.mode, info.hasMode = unixFileMode(binary.LittleEndian.Uint32(body)), true
+			}
+		case "SL":
+			if len(body) >= 1 {
+				link, linkOpen = appendSLComponents(link, linkOpen, body[1:])
+			}
+		case "TF":
+			info.setTimes(body)
+		case "CL":
+			if len(body) >= 4 {
+				info.childLink = int64(binary.LittleEndian.Uint32(body))
+			}
+		case "RE":
+			info.relocated = true
+		case "CE":
+			if len(body) < 24 || hops >= 16 {
+				break
+			}
+			hops++
+			block, offset := int64(binary.LittleEndian.Uint32(body)), int64(binary.LittleEndian.Uint32(body[8:]))
+			length := min(int64(binary.LittleEndian.Uint32(body[16:])), isoSectorSize)
+			area := make([]byte, length)
+			if _, err := w.r.ReadAt(area, block*w.vol.blockSize+offset); err == nil {
+				su = area
+			}
+		case "ST":
+			su = nil
+		}
+	}
+	if link != nil {
+		info.linkname = strings.Join(link, "/")
+		if info.linkname == "" {
+			info.linkname = "/"
+		}
+	}
+	return info
+}
+
+// Add an SL entry's components to link.  A component flagged to continue
+// is joined to the next without a separator.
+func appendSLComponents(link []string, open bool, comps []byte) ([]string, bool) {
+	for len(comps) >= 2 && 2+int(comps[1]) <= len(comps) {
+		flags, text := comps[0], string(comps[2:2+int(comps[1])])
+		comps = comps[2+int(comps[1]):]
+		switch {
+		case flags&0x02 != 0:
+			text = "."
+		case flags&0x04 != 0:
+			text = ".."
+		case flags&0x08 != 0:
+			text = ""
+		}
+		if open && len(link) > 0 {
+			link[len(link)-1] += text
+		} else {
+			link = append(link, text)
+		}
+		open = flags&0x01 != 0
+	}
+	return link, open
+}
+
+// TF: the flagged times in order (creation, modification, access,
+// attribute change, ...), each in the 7-byte or, with flag 0x80, 17-byte
+// form.
+func (info *rockRidgeInfo) setTimes(body []byte) {
+	if len(body) < 1 {
+		return
+	}
+	flags, stamps := body[0], body[1:]
+	width := 7
+	if flags&0x80 != 0 {
+		width = 17
+	}
+	for bit, dst := range []*time.Time{&info.createTime, &info.modTime, &info.accessTime, &info.changeTime} {
+		if flags&(1<<bit) == 0 {
+			continue
+		}
+		if len(stamps) < width {
+			return
+		}
+		if width == 7 {
+			*dst = isoRecordTime(stamps)
+		} else {
+			*dst = isoDigitTime(stamps)
+		}
+		stamps = stamps[width:]
+	}
+}
+
+// The file type and permission bits of a POSIX st_mode.
+func unixFileMode(mode uint32) fs.FileMode {
+	m := fs.FileMode(mode & 0o777)
+	switch mode & 0o170000 {
+	case 0o040000:
+		m |= fs.ModeDir
+	case 0o120000:
+		m |= fs.ModeSymlink
+	case 0o020000:
+		m |= fs.ModeDevice | fs.ModeCharDevice
+	case 0o060000:
+		m |= fs.ModeDevice
+	case 0o010000:
+		m |= fs.ModeNamedPipe
+	case 0o140000:
+		m |= fs.ModeSocket
+	}
+	if mode&0o4000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
+
+// A plain ISO 9660 name without its ";1" version, or a trailing "." left
+// by an empty extension.
+func isoPlainName(name string) string {
+	if i := strings.LastIndexByte(name, ';'); i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimSuffix(name, ".")
+}
+
+// A Joliet name: UCS-2, big-endian, with a version as plain names have.
+func isoJolietName(name string) string {
+	units := make([]uint16, len(name)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16([]byte(name[2*i:]))
+	}
+	return isoPlainName(string(utf16.Decode(units)))
+}
+
+// List the directory under prefix, then each subdirectory in turn.
+func (w *isoWalker) walkDir(dir isoRecord, prefix string, depth int) error {
+	if depth > isoMaxDepth || w.visited[dir.extent] {
+		return nil
+	}
+	w.visited[dir.extent] = true
+	var pending *ArchivedFile // A multi-extent file, gathering its extents
+	var subdirs []isoRecord
+	var subnames []string
+	err := w.records(dir, func(rec isoRecord) error {
+		var rr rockRidgeInfo
+		if w.rockRidge {
+			rr = w.rockRidgeInfo(rec.systemUse)
+			if rr.relocated {
+				return nil
+			}
+			if rr.childLink >= 0 {
+				rec.flags |= isoFlagDir
+				rec.extent = rr.childLink
+				rec.size = isoSectorSize
+				if sizes, ok := w.dotRecord(rec.extent); ok {
+					rec.size = sizes.size
+				}
+			}
+		}
+		name := isoPlainName(rec.name)
+		switch {
+		case rr.hasName:
+			name = rr.name
+		case w.vol.joliet:
+			name = isoJolietName(rec.name)
+		}
+		offset := rec.extent * w.vol.blockSize
+		if pending != nil {
+			pending.extents = append(pending.extents, imageExtent{offset, rec.size})
+			pending.size += rec.size
+			if rec.flags&isoFlagMultiExtent == 0 {
+				af := *pending
+				pending = nil
+				af.packed = af.size
+				return w.add(af)
+			}
+			return nil
+		}
+		af := ArchivedFile{archivefile: w.ar.fullname, archivetype: ARCHIVE_ISO, name: path.Join(prefix, name),
+			modTime: rec.modTime, mode: 0o444}
+		if w.rockRidge {
+			af.accessTime, af.createTime, af.changeTime = rr.accessTime, rr.createTime, rr.changeTime
+			if !rr.modTime.IsZero() {
+				af.modTime = rr.modTime
+			}
+			if rr.hasMode {
+				af.mode = rr.mode
+			}
+		}
+		switch {
+		case rec.flags&isoFlagDir != 0:
+			af.IsDir = true
+			if !rr.hasMode {
+				af.mode = fs.ModeDir | 0o555
+			}
+			subdirs, subnames = append(subdirs, rec), append(subnames, af.name)
+		case rr.linkname != "":
+			af.mode, af.linkname = fs.ModeSymlink|af.mode.Perm(), rr.linkname
+		default:
+			af.size, af.packed = rec.size, rec.size
+			af.extents = []imageExtent{{offset, rec.size}}
+			if rec.flags&isoFlagMultiExtent != 0 {
+				pending = &af
+				return nil
+			}
+		}
+		return w.add(af)
+	})
+	if err != nil {
+		return openError(w.ar.fullname, err)
+	}
+	for i, sub := range subdirs {
+		if err := w.walkDir(sub, subnames[i], depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *isoWalker) add(af ArchivedFile) error {
+	af.index = w.count
+	w.count++
+	return w.ar.addFile(af)
+}
+
+// The "." record of the directory at block, for its size.
+func (w *isoWalker) dotRecord(block int64) (isoRecord, bool) {
+	data := make([]byte, 34+255)
+	if n, _ := w.r.ReadAt(data, block*w.vol.blockSize); n < 34 {
+		return isoRecord{}, false
+	}
+	return parseISORecord(data)
+}
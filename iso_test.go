@@ -0,0 +1,219 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// An ISO 9660 image of 28 sectors: readme.txt, a long-named file spanning
+// two sectors, sub/deep.txt and, with Rock Ridge, a symlink to readme.txt.
+// Joliet adds a second tree of the same files but the link.
+func buildTestISO(t *testing.T, rockRidge, joliet bool) []byte {
+	t.Helper()
+	const (
+		rootSector, subSector         = 20, 21
+		jolietRoot, jolietSub         = 22, 23
+		readmeSector, longSector      = 24, 25
+		deepSector, totalSectors      = 27, 28
+		readme, deep                  = "hello from the disc\n", "deep\n"
+		readmeMode, longMode, dirMode = 0o100640, 0o100644, 0o040755
+	)
+	long := strings.Repeat("0123456789", 300)
+	img := make([]byte, totalSectors*isoSectorSize)
+	sector := func(n int) []byte { return img[n*isoSectorSize : (n+1)*isoSectorSize] }
+	copy(sector(readmeSector), readme)
+	copy(img[longSector*isoSectorSize:], long)
+	copy(sector(deepSector), deep)
+
+	both32 := func(b []byte, v uint32) {
+		binary.LittleEndian.PutUint32(b, v)
+		binary.BigEndian.PutUint32(b[4:], v)
+	}
+	record := func(extent, size int, flags byte, name string, su []byte) []byte {
+		n := 33 + len(name) + 1 - len(name)%2
+		rec := make([]byte, n, n+len(su)+1)
+		rec = append(rec, su...)
+		if len(rec)%2 == 1 {
+			rec = append(rec, 0)
+		}
+		rec[0] = byte(len(rec))
+		both32(rec[2:], uint32(extent))
+		both32(rec[10:], uint32(size))
+		copy(rec[18:], []byte{124, 5, 6, 7, 8, 9, 4}) // 2024-05-06 07:08:09 +01:00
+		rec[25] = flags
+		rec[28], rec[31] = 1, 1
+		rec[32] = byte(len(name))
+		copy(rec[33:], name)
+		return rec
+	}
+	susp := func(sig string, body ...byte) []byte {
+		return append([]byte{sig[0], sig[1], byte(4 + len(body)), 1}, body...)
+	}
+	rr := func(name string, mode uint32) []byte {
+		if !rockRidge {
+			return nil
+		}
+		px := make([]byte, 40)
+		both32(px, mode)
+		both32(px[8:], 1)
+		su := susp("PX", px...)
+		su = append(su, susp("TF", 0x02, 123, 1, 2, 3, 4, 5, 0)...) // 2023-01-02 03:04:05 UTC
+		return append(su, susp("NM", append([]byte{0}, name...)...)...)
+	}
+	ucs2 := func(s string) string {
+		var b []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = binary.BigEndian.AppendUint16(b, u)
+		}
+		return string(b)
+	}
+	writeDir := func(at, parent int, dotSU []byte, entries ...[]byte) {
+		dir := record(at, isoSectorSize, isoFlagDir, "\x00", dotSU)
+		dir = append(dir, record(parent, isoSectorSize, isoFlagDir, "\x01", nil)...)
+		for _, e := range entries {
+			dir = append(dir, e...)
+		}
+		copy(sector(at), dir)
+	}
+
+	var rootSU []byte
+	if rockRidge {
+		rootSU = susp("SP", 0xBE, 0xEF, 0)
+	}
+	link := susp("SL", append([]byte{0, 0, byte(len("readme.txt"))}, "readme.txt"...)...)
+	linkSU := append(rr("link", 0o120777), link...)
+	writeDir(rootSector, rootSector, rootSU,
+		record(longSector, len(long), 0, "LONG_MIX.DAT;1", rr("Long Mixed Name.data", longMode)),
+		record(readmeSector, len(readme), 0, "README.TXT;1", rr("readme.txt", readmeMode)),
+		record(subSector, isoSectorSize, isoFlagDir, "SUB", rr("sub", dirMode)),
+		record(0, 0, 0, "LINK.;1", linkSU))
+	writeDir(subSector, rootSector, nil, record(deepSector, len(deep), 0, "DEEP.TXT;1", rr("deep.txt", readmeMode)))
+	writeDir(jolietRoot, jolietRoot, nil,
+		record(longSector, len(long), 0, ucs2("Long Mixed Name.data;1"), nil),
+		record(readmeSector, len(readme), 0, ucs2("readme.txt;1"), nil),
+		record(jolietSub, isoSectorSize, isoFlagDir, ucs2("sub"), nil))
+	writeDir(jolietSub, jolietRoot, nil, record(deepSector, len(deep), 0, ucs2("deep.txt;1"), nil))
+
+	descriptor := func(n int, kind byte, root int) []byte {
+		d := sector(n)
+		d[0], d[6] = kind, 1
+		copy(d[1:], "CD001")
+		if kind != 255 {
+			both32(d[80:], totalSectors)
+			binary.LittleEndian.PutUint16(d[128:], isoSectorSize)
+			binary.BigEndian.PutUint16(d[130:], isoSectorSize)
+			copy(d[156:], record(root, isoSectorSize, isoFlagDir, "\x00", nil))
+		}
+		return d
+	}
+	descriptor(16, 1, rootSector)
+	next := 17
+	if joliet {
+		copy(descriptor(next, 2, jolietRoot)[88:], "%/E")
+		next++
+	}
+	descriptor(next, 255, 0)
+	return img
+}
+
+func writeTestISO(t *testing.T, rockRidge, joliet bool) string {
+	name := filepath.Join(t.TempDir(), "disc.iso")
+	if err := os.WriteFile(name, buildTestISO(t, rockRidge, joliet), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestISO9660Names(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		rockRidge, joliet bool
+		want              []string
+	}{
+		{"plain", false, false, []string{"LONG_MIX.DAT", "README.TXT", "SUB", "LINK", "SUB/DEEP.TXT"}},
+		{"joliet", false, true, []string{"Long Mixed Name.data", "readme.txt", "sub", "sub/deep.txt"}},
+		{"rock ridge", true, false, []string{"Long Mixed Name.data", "readme.txt", "sub", "link", "sub/deep.txt"}},
+		{"both", true, true, []string{"Long Mixed Name.data", "readme.txt", "sub", "link", "sub/deep.txt"}},
+	} {
+		ai, err := GetArchiveInfo(writeTestISO(t, tc.rockRidge, tc.joliet))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if ai.ArchiveType != ARCHIVE_ISO || !ai.ExtensionMatchesType() {
+			t.Errorf("%s: type %v", tc.name, ai.ArchiveType)
+		}
+		var got []string
+		for _, af := range ai.Files() {
+			got = append(got, af.Name())
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: entries %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestISO9660Content(t *testing.T) {
+	ai, err := GetArchiveInfo(writeTestISO(t, true, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readme := ai.File("readme.txt")
+	if data, err := readme.GetBytes(); err != nil || string(data) != "hello from the disc\n" {
+		t.Errorf("readme.txt: %q, %v", data, err)
+	}
+	if readme.Mode() != 0o640 || !readme.ModTime().Equal(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("readme.txt: mode %v, time %v", readme.Mode(), readme.ModTime())
+	}
+	if offset, err := readme.DataOffset(); err != nil || offset != 24*isoSectorSize {
+		t.Errorf("readme.txt: offset %d, %v", offset, err)
+	}
+	if data, err := ai.ReadFile("Long Mixed Name.data"); err != nil || len(data) != 3000 || !bytes.HasSuffix(data, []byte("789")) {
+		t.Errorf("long file: %d bytes, %v", len(data), err)
+	}
+	if data, err := ai.ReadFile("sub/deep.txt"); err != nil || string(data) != "deep\n" {
+		t.Errorf("sub/deep.txt: %q, %v", data, err)
+	}
+	if sub := ai.File("sub"); !sub.IsDir || sub.Mode() != fs.ModeDir|0o755 {
+		t.Errorf("sub: %v", sub.Mode())
+	}
+	if link := ai.File("link"); !link.IsSymlink() || link.Linkname() != "readme.txt" {
+		t.Errorf("link: mode %v, target %q", link.Mode(), link.Linkname())
+	}
+
+	plain, err := GetArchiveInfo(writeTestISO(t, false, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	af := plain.File("README.TXT")
+	want := time.Date(2024, 5, 6, 7, 8, 9, 0, time.FixedZone("", 3600))
+	if af.Mode() != 0o444 || !af.ModTime().Equal(want) {
+		t.Errorf("README.TXT: mode %v, time %v", af.Mode(), af.ModTime())
+	}
+}
+
+func TestISO9660Detect(t *testing.T) {
+	img := buildTestISO(t, false, false)
+	if got := DetectType(img); got != ARCHIVE_ISO {
+		t.Errorf("DetectType = %v", got)
+	}
+	if got := DetectType(img[:sniffLength]); got != ARCHIVE_NA {
+		t.Errorf("DetectType of the first sectors = %v", got)
+	}
+	ai, err := GetArchiveInfoFromReader(bytes.NewReader(img), int64(len(img)))
+	if err != nil || ai.ArchiveType != ARCHIVE_ISO || len(ai.Files()) != 5 {
+		t.Fatalf("from reader: %v, %v", ai, err)
+	}
+	// Cut off in the middle of the last file's data.
+	cut := img[:27*isoSectorSize+2]
+	if _, err := GetArchiveInfoFromReader(bytes.NewReader(cut), int64(len(cut)), WithValidateOnOpen()); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("truncated image: %v", err)
+	}
+}
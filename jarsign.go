@@ -0,0 +1,343 @@
+package archiver
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+const jarManifestName = "META-INF/MANIFEST.MF"
+
+// A JAR manifest, as APKs carry too.  Continuation lines are joined.
+type JarManifest struct {
+	Main    map[string]string            // The main section, e.g. "Main-Class"
+	Entries map[string]map[string]string // Each entry's section, by its Name
+}
+
+// A section of a manifest or signature file: its attributes, and its
+// bytes as they stand in the file, with the blank line ending it, for the
+// digests over it.
+type manifestSection struct {
+	attrs map[string]string
+	raw   []byte
+}
+
+// Read META-INF/MANIFEST.MF.  fs.ErrNotExist if there isn't one.
+func (ai *ArchiveInfo) JarManifest() (*JarManifest, error) {
+	af := ai.File(jarManifestName)
+	if af == nil {
+		return nil, fmt.Errorf("%s: %s: %w", ai.fullname, jarManifestName, fs.ErrNotExist)
+	}
+	data, err := af.GetBytes()
+	if err != nil {
+		return nil, err
+	}
+	sections := parseManifest(data)
+	m := &JarManifest{Main: sections[0].attrs, Entries: make(map[string]map[string]string)}
+	for _, s := range sections[1:] {
+		if name := s.attrs["Name"]; name != "" {
+			m.Entries[name] = s.attrs
+		}
+	}
+	return m, nil
+}
+
+// Split a manifest into its sections, the main one first.  Lines end in
+// CR, LF or both, and one starting with a space continues the last.
+func parseManifest(data []byte) []manifestSection {
+	sections := []manifestSection{}
+	section, start, last := manifestSection{attrs: map[string]string{}}, 0, ""
+	for pos := 0; pos < len(data); {
+		end := bytes.IndexAny(data[pos:], "\r\n")
+		next := len(data)
+		if end < 0 {
+			end = len(data)
+		} else {
+			end += pos
+			next = end + 1
+			if data[end] == '\r' && next < len(data) && data[next] == '\n' {
+				next++
+			}
+		}
+		switch line := string(data[pos:end]); {
+		case line == "":
+			if len(section.attrs) > 0 || len(sections) == 0 {
+				section.raw = data[start:next]
+				sections = append(sections, section)
+			}
+			section, start, last = manifestSection{attrs: map[string]string{}}, next, ""
+		case line[0] == ' ' && last != "":
+			section.attrs[last] += line[1:]
+		default:
+			if name, value, ok := strings.Cut(line, ":"); ok {
+				last = name
+				section.attrs[name] = strings.TrimPrefix(value, " ")
+			}
+		}
+		pos = next
+	}
+	if len(section.attrs) > 0 || len(sections) == 0 {
+		section.raw = data[start:]
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+// The digests manifests and signature files name, by the prefix of their
+// attributes, e.g. "SHA-256-Digest".
+var jarDigests = map[string]func() hash.Hash{
+	"sha1": sha1.New, "sha-1": sha1.New, "sha-256": sha256.New, "sha-384": sha512.New384, "sha-512": sha512.New,
+}
+
+// Check r against every digest attrs gives under suffix, e.g. "-Digest",
+// that's in an algorithm we know.  Reports whether there was one.
+func checkJarDigests(attrs map[string]string, suffix string, r io.Reader) (bool, error) {
+	var hashes []hash.Hash
+	var wants []string
+	for name, value := range attrs {
+		lower := strings.ToLower(name)
+		if newHash := jarDigests[strings.TrimSuffix(lower, suffix)]; strings.HasSuffix(lower, suffix) && newHash != nil {
+			hashes = append(hashes, newHash())
+			wants = append(wants, value)
+		}
+	}
+	if len(hashes) == 0 {
+		return false, nil
+	}
+	writers := make([]io.Writer, len(hashes))
+	for i, h := range hashes {
+		writers[i] = h
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		return true, err
+	}
+	for i, h := range hashes {
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) != strings.TrimSpace(wants[i]) {
+			return true, ErrBadSignature
+		}
+	}
+	return true, nil
+}
+
+// A v1 signer whose signature checked out.
+type JarSigner struct {
+	Name         string              // The signature file's, less META-INF/ and .SF
+	Certificates []*x509.Certificate // From the signature block, the signer's first
+}
+
+// Reports whether name is one of the files signing makes, which the
+// signatures don't cover.
+func isJarSigningFile(name string) bool {
+	dir, file := path.Split(name)
+	if dir != "META-INF/" {
+		return false
+	}
+	upper := strings.ToUpper(file)
+	switch path.Ext(upper) {
+	case ".SF", ".RSA", ".DSA", ".EC":
+		return true
+	}
+	return upper == "MANIFEST.MF" || strings.HasPrefix(upper, "SIG-")
+}
+
+// Check the v1 (JAR) signatures: each signature block against its
+// signature file, the signature file against the manifest, and the
+// manifest's digests against the entries' content.  Whether the
+// certificates are to be trusted is left to the caller.  unsigned lists
+// the files no signature covers, which a signed JAR can still hold.  A
+// JAR with no signature files has no signers and every file unsigned.  A
+// mismatch anywhere is ErrBadSignature.
+func (ai *ArchiveInfo) VerifyJarSignatures() (signers []JarSigner, unsigned []string, err error) {
+	var manifest []byte
+	if af := ai.File(jarManifestName); af != nil {
+		if manifest, err = af.GetBytes(); err != nil {
+			return nil, nil, err
+		}
+	}
+	sections := map[string]manifestSection{}
+	for _, s := range parseManifest(manifest)[1:] {
+		sections[s.attrs["Name"]] = s
+	}
+	covered := map[string]bool{}
+	for i := range ai.files {
+		sf := &ai.files[i]
+		dir, file := path.Split(sf.name)
+		if dir != "META-INF/" || !strings.EqualFold(path.Ext(file), ".SF") || manifest == nil {
+			continue
+		}
+		signer, names, err := ai.verifyJarSigner(sf, manifest, sections)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s: %w", ai.fullname, sf.name, err)
+		}
+		signers = append(signers, signer)
+		for _, name := range names {
+			covered[name] = true
+		}
+	}
+
+	// Each covered entry has to match its digests in the manifest.
+	for i := range ai.files {
+		af := &ai.files[i]
+		if af.isDir() || isJarSigningFile(af.name) {
+			continue
+		}
+		if !covered[af.name] {
+			unsigned = append(unsigned, af.name)
+			continue
+		}
+		r, err := af.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		checked, err := checkJarDigests(sections[af.name].attrs, "-digest", r)
+		r.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s: %w", ai.fullname, af.name, err)
+		}
+		if !checked {
+			unsigned = append(unsigned, af.name)
+		}
+	}
+	return signers, unsigned, nil
+}
+
+// Check one signature file and its block, returning the entries whose
+// manifest sections it vouches for.
+func (ai *ArchiveInfo) verifyJarSigner(sf *ArchivedFile, manifest []byte, sections map[string]manifestSection) (JarSigner, []string, error) {
+	signer := JarSigner{Name: strings.TrimSuffix(path.Base(sf.name), path.Ext(sf.name))}
+	var block *ArchivedFile
+	for _, ext := range []string{".RSA", ".EC", ".DSA", ".rsa", ".ec", ".dsa"} {
+		if block = ai.File("META-INF/" + signer.Name + ext); block != nil {
+			break
+		}
+	}
+	if block == nil {
+		return signer, nil, fmt.Errorf("%w: no signature block", ErrBadSignature)
+	}
+	content, err := sf.GetBytes()
+	if err != nil {
+		return signer, nil, err
+	}
+	blockData, err := block.GetBytes()
+	if err != nil {
+		return signer, nil, err
+	}
+	if signer.Certificates, err = verifyPKCS7(blockData, content); err != nil {
+		return signer, nil, err
+	}
+
+	// A digest of the whole manifest covers every section; failing that,
+	// each section the signature file names must match its own digest.
+	sfSections := parseManifest(content)
+	var names []string
+	if ok, err := checkJarDigests(sfSections[0].attrs, "-digest-manifest", bytes.NewReader(manifest)); ok && err == nil {
+		for name := range sections {
+			names = append(names, name)
+		}
+		return signer, names, nil
+	}
+	for _, s := range sfSections[1:] {
+		name := s.attrs["Name"]
+		section, found := sections[name]
+		if !found {
+			return signer, nil, fmt.Errorf("%w: %s isn't in the manifest", ErrBadSignature, name)
+		}
+		checked, err := checkJarDigests(s.attrs, "-digest", bytes.NewReader(section.raw))
+		if err != nil {
+			return signer, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if checked {
+			names = append(names, name)
+		}
+	}
+	return signer, names, nil
+}
+
+// The signature schemes an APK is signed with.  v2 and v3 are only
+// reported, not checked.
+type APKSigning struct {
+	V1 bool // JAR signature files under META-INF
+	V2 bool // An APK Signature Scheme v2 block
+	V3 bool // A v3 or v3.1 block
+}
+
+const (
+	apkSigBlockMagic = "APK Sig Block 42"
+	apkSigV2         = 0x7109871a
+	apkSigV3         = 0xf05368c0
+	apkSigV31        = 0x1b93ad61
+)
+
+// Find the signing schemes of an APK.  The v2 and v3 signatures sit in
+// the APK Signing Block, between the last entry and the central directory.
+func (ai *ArchiveInfo) APKSigning() (APKSigning, error) {
+	var signing APKSigning
+	if ai.ArchiveType != ARCHIVE_ZIP {
+		return signing, fmt.Errorf("%s: %w: not a zip", ai.fullname, ErrUnsupportedFormat)
+	}
+	for i := range ai.files {
+		if name := ai.files[i].name; isJarSigningFile(name) && strings.EqualFold(path.Ext(name), ".SF") {
+			signing.V1 = true
+		}
+	}
+	src, err := ai.openSource()
+	if err != nil {
+		return signing, openError(ai.fullname, err)
+	}
+	defer src.Close()
+	end, err := readZipEnd(src)
+	if err != nil {
+		return signing, openError(ai.fullname, err)
+	}
+	cdAt := end.cdAt
+	// The block ends in its size, less the size before it, and the magic.
+	var tail [24]byte
+	if cdAt < int64(len(tail)) {
+		return signing, nil
+	}
+	if _, err := src.ReadAt(tail[:], cdAt-int64(len(tail))); err != nil {
+		return signing, openError(ai.fullname, err)
+	}
+	size := binary.LittleEndian.Uint64(tail[:])
+	if string(tail[8:]) != apkSigBlockMagic {
+		return signing, nil
+	}
+	if size < uint64(len(tail)) || size > uint64(cdAt-8) {
+		return signing, openError(ai.fullname, fmt.Errorf("APK signing block of %d bytes", size))
+	}
+	block := make([]byte, size+8)
+	if _, err := src.ReadAt(block, cdAt-int64(len(block))); err != nil {
+		return signing, openError(ai.fullname, err)
+	}
+	if binary.LittleEndian.Uint64(block) != size {
+		return signing, openError(ai.fullname, fmt.Errorf("APK signing block sizes differ"))
+	}
+	// Length-prefixed pairs of an ID and its value.
+	for pairs := block[8 : len(block)-len(tail)]; len(pairs) > 0; {
+		if len(pairs) < 12 {
+			return signing, openError(ai.fullname, fmt.Errorf("truncated APK signing block"))
+		}
+		n := binary.LittleEndian.Uint64(pairs)
+		if n < 4 || n > uint64(len(pairs)-8) {
+			return signing, openError(ai.fullname, fmt.Errorf("APK signing block pair of %d bytes", n))
+		}
+		switch binary.LittleEndian.Uint32(pairs[8:]) {
+		case apkSigV2:
+			signing.V2 = true
+		case apkSigV3, apkSigV31:
+			signing.V3 = true
+		}
+		pairs = pairs[8+n:]
+	}
+	return signing, nil
+}
@@ -0,0 +1,228 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The encoding side of pkcs7.go's structures, with the [0]s spelled out.
+type testPKCS7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+	Certificates     asn1.RawValue
+	SignerInfos      []testPKCS7SignerInfo `asn1:"set"`
+}
+
+type testPKCS7SignerInfo struct {
+	Version                   int
+	IssuerAndSerial           pkcs7IssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+func testContextTag(b []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}
+}
+
+// A signature block over content, by a fresh self-signed key: RSA signing
+// the content itself, or ECDSA signing attributes that hold its digest.
+func testPKCS7(t *testing.T, content []byte, useECDSA bool) []byte {
+	var key crypto.Signer
+	var err error
+	keyOID := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	if useECDSA {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		keyOID = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	} else {
+		key, err = rsa.GenerateKey(rand.Reader, 1024)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(42), Subject: pkix.Name{CommonName: "Test Signer"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	sha256OID := pkix.AlgorithmIdentifier{Algorithm: pkcs7Digests[1].oid}
+	info := testPKCS7SignerInfo{Version: 1, IssuerAndSerial: pkcs7IssuerAndSerial{asn1.RawValue{FullBytes: cert.RawIssuer},
+		cert.SerialNumber}, DigestAlgorithm: sha256OID, DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: keyOID}}
+	signed := content
+	if useECDSA {
+		sum := sha256.Sum256(content)
+		digest, _ := asn1.Marshal(sum[:])
+		attrs, _ := asn1.Marshal([]pkcs7Attribute{{oidMessageDigest, asn1.RawValue{FullBytes: append([]byte{0x31,
+			byte(len(digest))}, digest...)}}})
+		// Marshalled as a SEQUENCE OF, short enough for a one-byte length;
+		// signed as the SET OF it stands for.
+		attrs[0] = 0x31
+		signed = attrs
+		info.AuthenticatedAttributes = testContextTag(attrs[2:])
+	}
+	sum := sha256.Sum256(signed)
+	if info.EncryptedDigest, err = key.Sign(rand.Reader, sum[:], crypto.SHA256); err != nil {
+		t.Fatal(err)
+	}
+	data, err := asn1.Marshal(testPKCS7SignedData{Version: 1, DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256OID},
+		ContentInfo:  struct{ ContentType asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}},
+		Certificates: testContextTag(der), SignerInfos: []testPKCS7SignerInfo{info}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidSignedData, testContextTag(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func testSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// A JAR with one signed class, a file added after signing, and a
+// signature file that either digests the whole manifest or just the
+// class's section.
+func buildTestJar(t *testing.T, wholeManifest, useECDSA bool) map[string]string {
+	class := "\xCA\xFE\xBA\xBE class"
+	section := "Name: com/example/Main.class\r\nSHA-256-Digest: " + testSHA256([]byte(class)) + "\r\n\r\n"
+	manifest := "Manifest-Version: 1.0\r\nMain-Class: com.example.Main\r\nImplementation-Title: A title long enough t\r\n o wrap\r\n\r\n" + section
+	sf := "Signature-Version: 1.0\r\n"
+	if wholeManifest {
+		sf += "SHA-256-Digest-Manifest: " + testSHA256([]byte(manifest)) + "\r\n\r\n"
+	} else {
+		sf += "\r\nName: com/example/Main.class\r\nSHA-256-Digest: " + testSHA256([]byte(section)) + "\r\n\r\n"
+	}
+	return map[string]string{jarManifestName: manifest, "META-INF/SIGNER.SF": sf,
+		"META-INF/SIGNER.RSA": string(testPKCS7(t, []byte(sf), useECDSA)), "com/example/Main.class": class,
+		"added.txt": "not signed"}
+}
+
+func testZipBytes(t *testing.T, entries map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		w, _ := zw.Create(name)
+		w.Write([]byte(entries[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJarSignatures(t *testing.T) {
+	for _, c := range []struct{ whole, ecdsa bool }{{true, false}, {false, true}} {
+		entries := buildTestJar(t, c.whole, c.ecdsa)
+		data := testZipBytes(t, entries)
+		ai, err := GetArchiveInfoFromReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := ai.JarManifest()
+		if err != nil || m.Main["Main-Class"] != "com.example.Main" || m.Main["Implementation-Title"] != "A title long enough to wrap" ||
+			m.Entries["com/example/Main.class"]["SHA-256-Digest"] == "" {
+			t.Fatalf("JarManifest() = %+v, %v", m, err)
+		}
+		signers, unsigned, err := ai.VerifyJarSignatures()
+		if err != nil || len(signers) != 1 || signers[0].Name != "SIGNER" ||
+			signers[0].Certificates[0].Subject.CommonName != "Test Signer" || strings.Join(unsigned, ",") != "added.txt" {
+			t.Errorf("whole manifest %v: %+v, unsigned %v, %v", c.whole, signers, unsigned, err)
+		}
+
+		// Changing the class breaks its digest; changing the signature
+		// file breaks the signature.
+		for name, change := range map[string]string{"com/example/Main.class": "\xCA\xFE\xBA\xBE clasS",
+			"META-INF/SIGNER.SF": strings.Replace(entries["META-INF/SIGNER.SF"], "1.0", "1.1", 1)} {
+			bad := map[string]string{}
+			for k, v := range entries {
+				bad[k] = v
+			}
+			bad[name] = change
+			data := testZipBytes(t, bad)
+			ai, err := GetArchiveInfoFromReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := ai.VerifyJarSignatures(); !errors.Is(err, ErrBadSignature) {
+				t.Errorf("whole manifest %v, changed %s: %v", c.whole, name, err)
+			}
+		}
+	}
+
+	ai, err := GetArchiveInfo("testassets/test.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signers, unsigned, err := ai.VerifyJarSignatures(); err != nil || signers != nil || len(unsigned) == 0 {
+		t.Errorf("unsigned zip: %v, %v, %v", signers, unsigned, err)
+	}
+	if _, err := ai.JarManifest(); err == nil {
+		t.Error("JarManifest() of a plain zip succeeded")
+	}
+}
+
+func TestAPKSigning(t *testing.T) {
+	data := testZipBytes(t, buildTestJar(t, true, false))
+	// Slip a signing block with a v2 and a v3 signature in before the
+	// central directory, and move the end record's offset past it.
+	end := bytes.LastIndex(data, []byte("PK\x05\x06"))
+	cdAt := binary.LittleEndian.Uint32(data[end+16:])
+	var pairs []byte
+	for _, id := range []uint32{apkSigV2, apkSigV3} {
+		pairs = binary.LittleEndian.AppendUint64(pairs, 4+3)
+		pairs = binary.LittleEndian.AppendUint32(pairs, id)
+		pairs = append(pairs, "sig"...)
+	}
+	size := uint64(len(pairs) + 8 + len(apkSigBlockMagic))
+	block := binary.LittleEndian.AppendUint64(nil, size)
+	block = append(block, pairs...)
+	block = binary.LittleEndian.AppendUint64(block, size)
+	block = append(block, apkSigBlockMagic...)
+	apk := append(append(bytes.Clone(data[:cdAt]), block...), data[cdAt:]...)
+	binary.LittleEndian.PutUint32(apk[end+len(block)+16:], cdAt+uint32(len(block)))
+
+	for _, c := range []struct {
+		data []byte
+		want APKSigning
+	}{{data, APKSigning{V1: true}}, {apk, APKSigning{true, true, true}}} {
+		ai, err := GetArchiveInfoFromReader(bytes.NewReader(c.data), int64(len(c.data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ai.APKSigning(); got != c.want || err != nil {
+			t.Errorf("APKSigning() = %+v, %v; want %+v", got, err, c.want)
+		}
+	}
+}
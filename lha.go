@@ -0,0 +1,352 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// LHA archives (.lzh, .lha): each entry a header, at level 0, 1 or 2,
+// then its data.  Level 0 and 1 headers keep DOS times and names in the
+// base header; level 2 ones keep Unix times, and names in the extended
+// headers that level 1 began.
+
+const (
+	lhaMinHeader = 22
+	lhaMaxPath   = 1 << 12
+)
+
+// Window bits of each compressed method; the rest are stored or
+// directories.
+var lhaDictBits = map[string]uint{"-lh4-": 12, "-lh5-": 13, "-lh6-": 15, "-lh7-": 16}
+
+// Extended header types.
+const (
+	lhaExtName      = 0x01
+	lhaExtDir       = 0x02
+	lhaExtUnixMode  = 0x50
+	lhaExtUnixMtime = 0x54
+)
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_LHA,
+		detect:      isLha,
+		load:        func(ar *ArchiveInfo) error { return loadWalked(ar, ARCHIVE_LHA, walkLha) },
+		open:        func(af *ArchivedFile) (io.ReadCloser, error) { return openWalked(af, walkLha) },
+		each: func(ai *ArchiveInfo, fn func(*ArchivedFile, io.Reader) error) error {
+			return forEachWalked(ai, walkLha, fn)
+		},
+	})
+}
+
+// The method id, "-lh5-" and so on, is the nearest LHA has to a magic.
+func isLha(header []byte) bool {
+	return len(header) >= lhaMinHeader && header[2] == '-' && header[3] == 'l' &&
+		(header[4] == 'h' || header[4] == 'z') && header[6] == '-' && header[20] <= 2
+}
+
+// An entry's header: the listing, and where its data is.
+type lhaEntry struct {
+	af     ArchivedFile
+	method string
+	dataAt int64
+	packed int64
+	crc    uint16
+}
+
+// Walk the headers from the start, handing each entry to fn.
+func walkLha(src source, enc encoding.Encoding, fn walkFunc) error {
+	for offset, i := int64(0), 0; offset < src.size; i++ {
+		e, next, err := readLhaHeader(src, offset, enc)
+		if err != nil || e == nil {
+			return err
+		}
+		e.af.index = i
+		if err := fn(&e.af, func() (io.Reader, error) { return e.reader(src) }); err != nil {
+			return err
+		}
+		offset = next
+	}
+	return nil
+}
+
+// The header at offset, and where the next one starts; a nil entry at the
+// end marker.
+func readLhaHeader(src source, offset int64, enc encoding.Encoding) (*lhaEntry, int64, error) {
+	base := make([]byte, lhaMinHeader)
+	if n, err := src.ReadAt(base, offset); n == 0 || base[0] == 0 {
+		return nil, 0, nil // End marker, or a missing one
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("LHA header at %d: %w", offset, noEOF(err))
+	}
+	le := binary.LittleEndian
+	level := base[20]
+	var size, least int64
+	switch level {
+	case 0, 1:
+		size, least = int64(base[0])+2, lhaMinHeader
+	case 2:
+		size, least = int64(le.Uint16(base)), 26
+	default:
+		return nil, 0, fmt.Errorf("%w: LHA header level %d", ErrUnsupportedFormat, level)
+	}
+	if size < least {
+		return nil, 0, fmt.Errorf("%w: LHA header at %d too short", ErrCorruptArchive, offset)
+	}
+	head := make([]byte, size)
+	if _, err := src.ReadAt(head, offset); err != nil {
+		return nil, 0, fmt.Errorf("LHA header at %d: %w", offset, noEOF(err))
+	}
+	e := &lhaEntry{method: string(head[2:7]), packed: int64(le.Uint32(head[7:]))}
+	e.af.size = int64(le.Uint32(head[11:]))
+	var name, dir string
+	var mode uint32
+	var extAt int64 // Of the first extended header's size
+	switch level {
+	case 0, 1:
+		nameLen := int(head[21])
+		if 24+nameLen > len(head) || level == 1 && 27+nameLen > len(head) {
+			return nil, 0, fmt.Errorf("%w: LHA header at %d too short", ErrCorruptArchive, offset)
+		}
+		e.af.modTime = dosTime(le.Uint16(head[17:]), le.Uint16(head[15:]))
+		name = strings.ReplaceAll(string(head[22:22+nameLen]), "\\", "/")
+		e.crc = le.Uint16(head[22+nameLen:])
+		if level == 1 {
+			extAt = offset + int64(25+nameLen)
+		} else if ext := head[24+nameLen:]; len(ext) >= 8 && ext[0] == 'U' {
+			// LHa for UNIX's extension to level 0: a version, then time
+			// and mode.
+			e.af.modTime = time.Unix(int64(le.Uint32(ext[2:])), 0).UTC()
+			mode = uint32(le.Uint16(ext[6:]))
+		}
+	case 2:
+		e.af.modTime = time.Unix(int64(le.Uint32(head[15:])), 0).UTC()
+		e.crc = le.Uint16(head[21:])
+		extAt = offset + 24
+	}
+	next := offset + size
+	if extAt > 0 {
+		// A chain of extended headers, each a type, its data and the next
+		// one's size.  Level 1 counts them in the packed size; level 2 in
+		// the header's.
+		at := extAt
+		ext := make([]byte, 2)
+		if _, err := src.ReadAt(ext, at); err != nil {
+			return nil, 0, fmt.Errorf("LHA header at %d: %w", offset, noEOF(err))
+		}
+		for n := int64(le.Uint16(ext)); n != 0; n = int64(le.Uint16(ext[n-2:])) {
+			if n < 3 || n > lhaMaxPath+3 {
+				return nil, 0, fmt.Errorf("%w: LHA extended header at %d", ErrCorruptArchive, at+2)
+			}
+			ext = make([]byte, n)
+			if _, err := src.ReadAt(ext, at+2); err != nil {
+				return nil, 0, fmt.Errorf("LHA header at %d: %w", offset, noEOF(err))
+			}
+			body := ext[1 : n-2]
+			switch ext[0] {
+			case lhaExtName:
+				name = string(body)
+			case lhaExtDir:
+				dir = strings.TrimSuffix(string(bytes.ReplaceAll(body, []byte{0xFF}, []byte("/"))), "/")
+			case lhaExtUnixMode:
+				if len(body) >= 2 {
+					mode = uint32(le.Uint16(body))
+				}
+			case lhaExtUnixMtime:
+				if len(body) >= 4 {
+					e.af.modTime = time.Unix(int64(le.Uint32(body)), 0).UTC()
+				}
+			}
+			at += n
+			if level == 1 {
+				e.packed -= n
+				next += n
+			}
+		}
+	}
+	if e.packed < 0 {
+		return nil, 0, fmt.Errorf("%w: LHA packed size at %d", ErrCorruptArchive, offset)
+	}
+	e.dataAt = next
+	next += e.packed
+	if dir != "" {
+		name = dir + "/" + name
+	}
+	e.af.name = strings.TrimSuffix(legacyName(name, enc, japanese.ShiftJIS), "/")
+	e.af.packed = e.packed
+	switch {
+	case e.method == "-lhd-":
+		// LHa for UNIX keeps a symlink as a directory named
+		// "name|target".
+		e.af.packed = 0
+		if link, target, ok := strings.Cut(e.af.name, "|"); ok {
+			e.af.name, e.af.linkname = link, target
+			e.af.mode = fs.ModeSymlink | 0o777
+		} else {
+			e.af.IsDir, e.af.mode = true, fs.ModeDir|0o755
+		}
+		e.af.size = 0
+	case e.method == "-lh0-" || e.method == "-lz4-":
+		e.af.method, e.af.mode = "Store", 0o644
+	default:
+		e.af.method, e.af.mode = strings.Trim(e.method, "-"), 0o644
+	}
+	if mode != 0 {
+		perm := unixFileMode(mode)
+		e.af.mode = e.af.mode.Type() | perm.Perm() | perm&(fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)
+	}
+	return e, next, nil
+}
+
+// Formats of headers one after another, each followed by its entry's
+// data, as LHA and ARJ are, walk them with one of these, which hands fn
+// each entry and a way to read its content.  fn may stop the walk with
+// errStopListing.
+type walkFunc func(af *ArchivedFile, content func() (io.Reader, error)) error
+
+func loadWalked(ar *ArchiveInfo, t ArchiveType, walk func(source, encoding.Encoding, walkFunc) error) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	var addErr error
+	err = walk(src, ar.opts.nameEncoding, func(af *ArchivedFile, _ func() (io.Reader, error)) error {
+		af.archivefile, af.archivetype = ar.fullname, t
+		addErr = ar.addFile(*af)
+		return addErr
+	})
+	if err != nil && addErr == nil {
+		return openError(ar.fullname, err)
+	}
+	return err
+}
+
+// Walk up to the entry, rather than keeping where each one's header is.
+func openWalked(af *ArchivedFile, walk func(source, encoding.Encoding, walkFunc) error) (io.ReadCloser, error) {
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	var r io.Reader
+	err = walk(src, nil, func(e *ArchivedFile, content func() (io.Reader, error)) error {
+		if e.index != af.index {
+			return nil
+		}
+		if r, err = content(); err == nil {
+			err = errStopListing
+		}
+		return err
+	})
+	if err == nil {
+		err = fmt.Errorf("%w: entry %d", ErrCorruptArchive, af.index)
+	}
+	if err != errStopListing {
+		src.Close()
+		return nil, openError(af.archivefile, err)
+	}
+	return &entryReader{r, []io.Closer{src}}, nil
+}
+
+// One walk, matching the listing up as it goes.
+func forEachWalked(ai *ArchiveInfo, walk func(source, encoding.Encoding, walkFunc) error,
+	fn func(*ArchivedFile, io.Reader) error) error {
+	src, err := ai.openSource()
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	defer src.Close()
+	order := ai.archiveOrder()
+	next := 0
+	err = walk(src, nil, func(e *ArchivedFile, content func() (io.Reader, error)) error {
+		if next == len(order) {
+			return errStopListing
+		}
+		af := order[next]
+		if af.index != e.index {
+			return nil
+		}
+		next++
+		r, err := content()
+		if err != nil {
+			return err
+		}
+		return fn(af, af.wrapReader(r))
+	})
+	if err == errStopListing {
+		err = nil
+	}
+	if err == nil && next < len(order) {
+		err = fmt.Errorf("%w: entry %d", ErrCorruptArchive, order[next].index)
+	}
+	return err
+}
+
+// The entry's content, checked against its CRC at the end.
+func (e *lhaEntry) reader(src source) (io.Reader, error) {
+	if !e.af.mode.IsRegular() {
+		return bytes.NewReader(nil), nil
+	}
+	data := io.NewSectionReader(src, e.dataAt, e.packed)
+	var r io.Reader
+	switch dictBits, ok := lhaDictBits[e.method]; {
+	case e.af.method == "Store":
+		r = data
+	case ok:
+		r = newLZHDecoder(data, dictBits, e.af.size)
+	default:
+		return nil, fmt.Errorf("%s: %w: LHA method %s", e.af.name, ErrUnsupportedFormat, e.method)
+	}
+	return &sumReader{r: r, update: crc16, want: uint32(e.crc), name: e.af.name}, nil
+}
+
+// Fails with ErrCorruptArchive at EOF unless update, run over the data,
+// comes to want.
+type sumReader struct {
+	r      io.Reader
+	update func(sum uint32, p []byte) uint32
+	sum    uint32
+	want   uint32
+	name   string
+}
+
+func (sr *sumReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	sr.sum = sr.update(sr.sum, p[:n])
+	if err == io.EOF && sr.sum != sr.want {
+		err = fmt.Errorf("%s: %w: checksum mismatch", sr.name, ErrCorruptArchive)
+	}
+	return n, err
+}
+
+// The CRC-16 of ARC and LHA, reflected, with polynomial 0x8005.
+var crc16Table = func() (table [256]uint16) {
+	for i := range table {
+		c := uint16(i)
+		for k := 0; k < 8; k++ {
+			if c&1 != 0 {
+				c = c>>1 ^ 0xA001
+			} else {
+				c >>= 1
+			}
+		}
+		table[i] = c
+	}
+	return table
+}()
+
+func crc16(sum uint32, p []byte) uint32 {
+	crc := uint16(sum)
+	for _, b := range p {
+		crc = crc16Table[byte(crc)^b] ^ crc>>8
+	}
+	return uint32(crc)
+}
@@ -0,0 +1,176 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLhaTime = 1700000000
+
+// An extended header's type and data.
+type testLhaExt struct {
+	kind byte
+	data string
+}
+
+// An LHA entry's header and data, at the given level.
+func buildTestLhaEntry(level byte, method, name string, data, packed []byte, exts []testLhaExt) []byte {
+	le := binary.LittleEndian
+	crc := uint16(crc16(0, data))
+	var extBytes []byte
+	var sizes []uint16
+	for _, e := range exts {
+		sizes = append(sizes, uint16(1+len(e.data)+2))
+		extBytes = append(extBytes, e.kind)
+		extBytes = append(extBytes, e.data...)
+		extBytes = le.AppendUint16(extBytes, 0)
+	}
+	// Each extended header ends in the next one's size.
+	for i, at := 0, 0; i < len(exts); i++ {
+		at += int(sizes[i])
+		if i+1 < len(exts) {
+			le.PutUint16(extBytes[at-2:], sizes[i+1])
+		}
+	}
+	var first uint16
+	if len(sizes) > 0 {
+		first = sizes[0]
+	}
+	h := []byte{0, 0} // Header size, and checksum or its high byte
+	h = append(h, method...)
+	switch level {
+	case 0, 1:
+		packedSize := len(packed)
+		if level == 1 {
+			packedSize += len(extBytes)
+		}
+		h = le.AppendUint32(h, uint32(packedSize))
+		h = le.AppendUint32(h, uint32(len(data)))
+		h = le.AppendUint32(h, 0x5745<<16|0x6000) // 2023-10-05 12:00:00
+		h = append(h, 0x20, level, byte(len(name)))
+		h = append(h, name...)
+		h = le.AppendUint16(h, crc)
+		if level == 0 {
+			// LHa for UNIX's extension: version, time, mode, uid and gid.
+			h = append(h, 'U', 0)
+			h = le.AppendUint32(h, testLhaTime)
+			h = le.AppendUint16(h, 0o100600)
+			h = le.AppendUint16(h, 0)
+			h = le.AppendUint16(h, 0)
+		} else {
+			h = append(h, 'U')
+			h = le.AppendUint16(h, first)
+		}
+		h[0] = byte(len(h) - 2)
+		h = append(h, extBytes...)
+	case 2:
+		h = le.AppendUint32(h, uint32(len(packed)))
+		h = le.AppendUint32(h, uint32(len(data)))
+		h = le.AppendUint32(h, testLhaTime)
+		h = append(h, 0x20, 2)
+		h = le.AppendUint16(h, crc)
+		h = append(h, 'U')
+		h = le.AppendUint16(h, first)
+		h = append(h, extBytes...)
+		le.PutUint16(h, uint16(len(h)))
+	}
+	return append(h, packed...)
+}
+
+func buildTestLha() ([]byte, map[string]string) {
+	hello := []byte("hello\n")
+	text := testLZHData()
+	var b []byte
+	b = append(b, buildTestLhaEntry(0, "-lh0-", "hello.txt", hello, hello, nil)...)
+	b = append(b, buildTestLhaEntry(1, "-lh5-", "notes.txt", text, lzhEncode(text, 13, 1<<16),
+		[]testLhaExt{{lhaExtDir, "docs\xff"}})...)
+	b = append(b, buildTestLhaEntry(2, "-lhd-", "", nil, nil, []testLhaExt{{lhaExtName, ""}, {lhaExtDir, "docs\xffsub\xff"}})...)
+	b = append(b, buildTestLhaEntry(2, "-lh7-", "", text, lzhEncode(text, 16, 100),
+		[]testLhaExt{{lhaExtName, "\x93\xfa\x96\x7b.txt"}, {lhaExtDir, "docs\xffsub"}, {lhaExtUnixMode, "\xed\x81"}})...)
+	b = append(b, buildTestLhaEntry(2, "-lhd-", "", nil, nil, []testLhaExt{{lhaExtName, "link|hello.txt"}})...)
+	b = append(b, 0)
+	return b, map[string]string{"hello.txt": string(hello), "docs/notes.txt": string(text), "docs/sub/日本.txt": string(text)}
+}
+
+func TestLha(t *testing.T) {
+	archive, want := buildTestLha()
+	name := filepath.Join(t.TempDir(), "old.lzh")
+	if err := os.WriteFile(name, archive, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := GetArchiveInfo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, af := range ai.Files() {
+		names = append(names, af.Name())
+	}
+	if got := strings.Join(names, ","); ai.ArchiveType != ARCHIVE_LHA ||
+		got != "hello.txt,docs/notes.txt,docs/sub,docs/sub/日本.txt,link" {
+		t.Fatalf("type %v, entries %s", ai.ArchiveType, got)
+	}
+	for name, content := range want {
+		if got, err := ai.File(name).GetBytes(); err != nil || string(got) != content {
+			t.Errorf("%s: %d bytes, %v; want %d", name, len(got), err, len(content))
+		}
+	}
+	hello := ai.File("hello.txt")
+	if hello.Mode() != 0o600 || hello.Method() != "Store" || !hello.ModTime().Equal(time.Unix(testLhaTime, 0)) {
+		t.Errorf("hello.txt: mode %v, method %q, time %v", hello.Mode(), hello.Method(), hello.ModTime())
+	}
+	notes := ai.File("docs/notes.txt")
+	if notes.Method() != "lh5" || !notes.ModTime().Equal(time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("notes.txt: method %q, time %v", notes.Method(), notes.ModTime())
+	}
+	if af := ai.File("docs/sub/日本.txt"); af.Mode() != 0o755 || af.Method() != "lh7" {
+		t.Errorf("日本.txt: mode %v, method %q", af.Mode(), af.Method())
+	}
+	if !ai.File("docs/sub").IsDir {
+		t.Error("docs/sub isn't a directory")
+	}
+	if af := ai.File("link"); af.Mode()&fs.ModeSymlink == 0 || af.linkname != "hello.txt" {
+		t.Errorf("link: mode %v, target %q", af.Mode(), af.linkname)
+	}
+
+	got := make(map[string]string)
+	err = ai.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		got[af.Name()] = string(data)
+		return err
+	})
+	if err != nil || got["docs/sub/日本.txt"] != want["docs/sub/日本.txt"] || len(got) != len(names) {
+		t.Errorf("ForEach: %d entries, %v", len(got), err)
+	}
+
+	// A flipped bit in the stored data fails the CRC.
+	bad := bytes.Clone(archive)
+	bad[bytes.Index(bad, []byte("hello\n"))] ^= 1
+	ai, err = GetArchiveInfoFromReader(bytes.NewReader(bad), int64(len(bad)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ai.File("hello.txt").GetBytes(); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("bad CRC: %v", err)
+	}
+}
+
+func TestLhaShortHeader(t *testing.T) {
+	hello := []byte("hello\n")
+	for level, size := range map[byte][]byte{0: {1, 0}, 1: {19, 0}, 2: {10, 0}} {
+		entry := buildTestLhaEntry(level, "-lh0-", "hello.txt", hello, hello, nil)
+		copy(entry, size)
+		entry = append(entry, 0)
+		if _, err := GetArchiveInfoFromReader(bytes.NewReader(entry), int64(len(entry))); !errors.Is(err, ErrCorruptArchive) {
+			t.Errorf("level %d header of %d bytes: %v, want ErrCorruptArchive", level, size[0], err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package archiver
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Caps on what an archive may hold, so a decompression bomb such as
+// 42.zip fails early instead of filling memory or disk.  Zero fields are
+// unlimited.  See WithLimits.
+type Limits struct {
+	MaxFileSize         int64   // Uncompressed bytes in any one entry
+	MaxTotalSize        int64   // Uncompressed bytes in all entries together
+	MaxCompressionRatio float64 // Uncompressed over compressed size, for the archive and for each entry where the format records both
+	MaxEntryCount       int     // Entries in the listing
+}
+
+// Enforce limits.  Listing checks each entry's recorded size, the running
+// total, the entry count and compression ratios as entries are found, and
+// stops at the first violation.  Headers can lie, so reads also stop once
+// more data comes out of an entry than its recorded size or the size limits
+// allow, and the Extract methods stop once their entries together come to
+// more than MaxTotalSize.  Violations are ErrLimitExceeded.
+func WithLimits(limits Limits) Option {
+	return func(o *options) { o.limits = limits }
+}
+
+// The most bytes any one entry may decompress to, or -1 for no limit.
+func (l Limits) sizeCap() int64 {
+	switch {
+	case l.MaxFileSize > 0 && l.MaxTotalSize > 0:
+		return min(l.MaxFileSize, l.MaxTotalSize)
+	case l.MaxFileSize > 0:
+		return l.MaxFileSize
+	case l.MaxTotalSize > 0:
+		return l.MaxTotalSize
+	}
+	return -1
+}
+
+func limitError(name, format string, args ...any) error {
+	return fmt.Errorf("%s: %w: %s", name, ErrLimitExceeded, fmt.Sprintf(format, args...))
+}
+
+// Check an entry about to be listed against the limits.
+func (ar *ArchiveInfo) checkEntryLimits(af *ArchivedFile) error {
+	l := ar.opts.limits
+	if l.MaxEntryCount > 0 && len(ar.files) >= l.MaxEntryCount {
+		return limitError(ar.fullname, "more than %d entries", l.MaxEntryCount)
+	}
+	if af.size <= 0 {
+		return nil
+	}
+	if l.MaxFileSize > 0 && af.size > l.MaxFileSize {
+		return limitError(af.name, "%d bytes, over %d", af.size, l.MaxFileSize)
+	}
+	if l.MaxTotalSize > 0 && ar.unpacked+af.size > l.MaxTotalSize {
+		return limitError(ar.fullname, "entries total over %d bytes", l.MaxTotalSize)
+	}
+	if ratio := float64(af.size) / float64(af.packed); l.MaxCompressionRatio > 0 && af.packed > 0 && ratio > l.MaxCompressionRatio {
+		return limitError(af.name, "compression ratio %.0f, over %g", ratio, l.MaxCompressionRatio)
+	}
+	return nil
+}
+
+// Check the whole listing's compression ratio, for formats that don't
+// record compressed sizes per entry.
+func (ar *ArchiveInfo) checkArchiveLimits() error {
+	l := ar.opts.limits
+	if ratio := float64(ar.unpacked) / float64(ar.size); l.MaxCompressionRatio > 0 && ar.size > 0 && ratio > l.MaxCompressionRatio {
+		return limitError(ar.fullname, "compression ratio %.0f, over %g", ratio, l.MaxCompressionRatio)
+	}
+	return nil
+}
+
+// Fails with ErrLimitExceeded once the entries of an extraction have
+// together given more than max bytes, whatever their headers claimed.
+type totalReader struct {
+	r     io.Reader
+	name  string
+	total *atomic.Int64 // Shared by the extraction's entries
+	max   int64
+}
+
+func (tr *totalReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	if over := tr.total.Add(int64(n)) - tr.max; over > 0 {
+		return n - int(min(over, int64(n))), limitError(tr.name, "extraction over %d bytes", tr.max)
+	}
+	return n, err
+}
+
+// Fails with ErrLimitExceeded once more than max bytes have been read.
+type limitReader struct {
+	r    io.Reader
+	name string
+	left int64
+	max  int64
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	if lr.left < 0 {
+		return 0, limitError(lr.name, "more than %d bytes", lr.max)
+	}
+	if int64(len(p)) > lr.left+1 {
+		p = p[:lr.left+1]
+	}
+	n, err := lr.r.Read(p)
+	if lr.left -= int64(n); lr.left < 0 {
+		return n - 1, limitError(lr.name, "more than %d bytes", lr.max)
+	}
+	return n, err
+}
@@ -0,0 +1,145 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithLimits(t *testing.T) {
+	dir := t.TempDir()
+	zeros := strings.Repeat("\x00", 1<<20)
+	bombZip := writeTestZip(t, dir, "bomb.zip", [][2]string{{"small.txt", "hello"}, {"zeros.bin", zeros}})
+	bombTgz := writeTestTgz(t, dir, "bomb.tgz", []testTarEntry{
+		{tar.Header{Name: "a.bin", Mode: 0o644, Size: int64(len(zeros))}, zeros},
+		{tar.Header{Name: "b.bin", Mode: 0o644, Size: int64(len(zeros))}, zeros},
+	})
+	// Not zeros: a gzip opening with an empty block reads as a tarball.
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(strings.Repeat("a", 1<<20)))
+	gw.Close()
+	bombGz := filepath.Join(dir, "letters.txt.gz")
+	os.WriteFile(bombGz, gz.Bytes(), 0o644)
+
+	testdata := []struct {
+		name   string
+		path   string
+		limits Limits
+		ok     bool
+	}{{"no limits", bombZip, Limits{}, true},
+		{"roomy limits", bombZip, Limits{MaxFileSize: 2 << 20, MaxTotalSize: 4 << 20, MaxEntryCount: 2}, true},
+		{"entry count", "testassets/tree.zip", Limits{MaxEntryCount: 5}, false},
+		{"file size", bombZip, Limits{MaxFileSize: 1000}, false},
+		{"total size", bombTgz, Limits{MaxFileSize: 2 << 20, MaxTotalSize: 1500000}, false},
+		{"entry ratio", bombZip, Limits{MaxCompressionRatio: 100}, false},
+		{"archive ratio", bombTgz, Limits{MaxCompressionRatio: 100}, false},
+		{"gzip size", bombGz, Limits{MaxFileSize: 1000}, false},
+		{"gzip ratio", bombGz, Limits{MaxCompressionRatio: 100}, false},
+	}
+	for _, test := range testdata {
+		_, err := GetArchiveInfo(test.path, WithLimits(test.limits))
+		if test.ok && err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+		} else if !test.ok && !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s: error = %v, want ErrLimitExceeded", test.name, err)
+		}
+	}
+}
+
+// An entry whose data runs past what its header claims stops at its
+// recorded size when read, or at the limit if its size isn't known.
+func TestLimitReader(t *testing.T) {
+	ar := &ArchiveInfo{opts: buildOptions([]Option{WithLimits(Limits{MaxFileSize: 100})})}
+	for _, c := range []struct {
+		size, want int64
+	}{{10, 10}, {-1, 100}, {500, 100}} {
+		af := &ArchivedFile{name: "liar.bin", size: c.size, archive: ar}
+		data, err := io.ReadAll(af.wrapReader(strings.NewReader(strings.Repeat("x", 1000))))
+		if !errors.Is(err, ErrLimitExceeded) || int64(len(data)) != c.want {
+			t.Errorf("size %d: read %d bytes, error = %v; want %d and ErrLimitExceeded", c.size, len(data), err, c.want)
+		}
+		data, err = io.ReadAll(af.wrapReader(strings.NewReader(strings.Repeat("x", int(c.want)))))
+		if err != nil || int64(len(data)) != c.want {
+			t.Errorf("size %d: read %d bytes at the limit, error = %v", c.size, len(data), err)
+		}
+	}
+}
+
+// Entries that decompress to more than their listing claimed are stopped
+// by the extraction's running total, not just each on its own.
+func TestExtractTotalLimit(t *testing.T) {
+	path := writeTestTgz(t, t.TempDir(), "three.tgz", []testTarEntry{
+		{tar.Header{Name: "a.bin", Mode: 0o644, Size: 1000}, strings.Repeat("a", 1000)},
+		{tar.Header{Name: "b.bin", Mode: 0o644, Size: 1000}, strings.Repeat("b", 1000)},
+		{tar.Header{Name: "c.bin", Mode: 0o644, Size: 1000}, strings.Repeat("c", 1000)},
+	})
+	ai, err := GetArchiveInfo(path, WithLimits(Limits{MaxTotalSize: 3000}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As if the headers had understated the sizes.
+	ai.opts.limits.MaxTotalSize = 2500
+	discard := func(name string, mode fs.FileMode) (io.WriteCloser, error) { return &memFile{mode: mode}, nil }
+	extracts := map[string]func() error{
+		"ExtractAll":     func() error { return ai.ExtractAll(t.TempDir()) },
+		"ExtractAllWith": func() error { return ai.ExtractAllWith(discard) },
+		"ExtractFiles":   func() error { return ai.ExtractFiles([]string{"a.bin", "b.bin", "c.bin"}, t.TempDir(), 2) },
+		"ExtractAllToTarWriter": func() error {
+			return ai.ExtractAllToTarWriter(tar.NewWriter(io.Discard))
+		},
+	}
+	for name, extract := range extracts {
+		if err := extract(); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s: error = %v, want ErrLimitExceeded", name, err)
+		}
+	}
+	// The total is per extraction, so each may take the lot.
+	ai.opts.limits.MaxTotalSize = 3000
+	for name, extract := range extracts {
+		for i := 0; i < 2; i++ {
+			if err := extract(); err != nil {
+				t.Errorf("%s, pass %d: %v", name, i, err)
+			}
+		}
+	}
+}
+
+func TestDirectorySizeIgnored(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"./", "docs/"} {
+		if _, err := zw.CreateRaw(&zip.FileHeader{Name: name, Method: zip.Store, UncompressedSize64: 4278124286}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+	ai, err := GetArchiveInfoFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), WithLimits(Limits{MaxFileSize: 16 << 20}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, af := range ai.Files() {
+		if af.Size() != 0 {
+			t.Errorf("%s: size %d", af.Name(), af.Size())
+		}
+		if data, err := af.GetBytes(); err != nil || len(data) != 0 {
+			t.Errorf("%s: GetBytes gave %d bytes, %v", af.Name(), len(data), err)
+		}
+		r, err := af.Open()
+		if err != nil {
+			t.Fatalf("%s: %v", af.Name(), err)
+		}
+		if data, err := io.ReadAll(r); err != nil || len(data) != 0 {
+			t.Errorf("%s: Open gave %d bytes, %v", af.Name(), len(data), err)
+		}
+		r.Close()
+	}
+}
@@ -0,0 +1,189 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// What the Extract methods do with symlink and hardlink entries.
+type LinkPolicy int
+
+const (
+	SkipLinks        LinkPolicy = iota // Leave them out (the default)
+	MaterializeLinks                   // Create them on disk; see WithLinkPolicy
+	RejectLinks                        // Fail the entry with ErrLinkEntry
+)
+
+// Choose how the Extract methods treat symlinks and tar hardlinks.  Under
+// MaterializeLinks a symlink is created as one, provided its target stays
+// inside the destination once any links already extracted are followed;
+// an absolute or escaping target fails with ErrUnsafePath.  A hardlink is
+// linked to its target entry, which has to be extracted before it, as tar
+// writers arrange.  Nothing is written through a symlink already
+// extracted: an entry under one, or a hardlink to one, fails with
+// ErrUnsafePath.  ExtractAllWith can't make links, so it skips them
+// unless they're rejected.
+func WithLinkPolicy(policy LinkPolicy) ExtractOption {
+	return func(eo *extractOptions) { eo.links = policy }
+}
+
+func (af *ArchivedFile) isLink() bool { return af.hardlink || af.mode&fs.ModeSymlink != 0 }
+
+// The link's target: from the tar header, or the content for formats that
+// store a symlink's target that way.
+func (af *ArchivedFile) linkTarget() (string, error) {
+	if af.linkname != "" || !af.isLink() {
+		return af.linkname, nil
+	}
+	if af.size > 4096 {
+		return "", fmt.Errorf("%w: %d-byte symlink target", ErrCorruptArchive, af.size)
+	}
+	target, err := af.GetBytes()
+	return string(target), err
+}
+
+// Write the link entry at target, under destDir, as eo says.  A hardlink's
+// target is an entry name, so it goes through rename and the stripping as
+// the entry names did.
+func (af *ArchivedFile) writeLink(destDir, target string, rename func(name string) (string, bool), eo extractOptions) error {
+	switch eo.links {
+	case SkipLinks:
+		return nil
+	case RejectLinks:
+		return ErrLinkEntry
+	}
+	link, err := af.linkTarget()
+	if err != nil {
+		return err
+	}
+	if af.hardlink {
+		rel, ok := rename(link)
+		if ok {
+			rel, ok = eo.stripped(rel)
+		}
+		if !ok {
+			return fmt.Errorf("hardlink to %s, which isn't extracted: %w", link, fs.ErrNotExist)
+		}
+		link = rel
+	}
+	if link == "" {
+		return fmt.Errorf("%w: link with no target", ErrCorruptArchive)
+	}
+	if err = mkdirUnder(destDir, filepath.Dir(target)); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+		os.Remove(target)
+	}
+	if af.hardlink {
+		source, err := safeJoin(destDir, link, eo.paths)
+		if err != nil {
+			return err
+		}
+		if err = checkNoLinks(destDir, source); err != nil {
+			return err
+		}
+		return os.Link(source, target)
+	}
+	if err = checkLinkTarget(destDir, target, link); err != nil {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(link), target)
+}
+
+// Fail with ErrUnsafePath unless a symlink at linkPath pointing to link
+// would resolve inside destDir.
+func checkLinkTarget(destDir, linkPath, link string) error {
+	unsafe := fmt.Errorf("%w: link to %s", ErrUnsafePath, link)
+	if filepath.IsAbs(link) || strings.HasPrefix(link, "/") || filepath.VolumeName(link) != "" {
+		return unsafe
+	}
+	root, err := filepath.Abs(destDir)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(filepath.Dir(linkPath))
+	if err != nil {
+		return err
+	}
+	root = realPath(root)
+	// Not filepath.Join, which would take ".." before following links.
+	resolved := realPath(dir + string(filepath.Separator) + filepath.FromSlash(link))
+	if root == "" || resolved != root && !strings.HasPrefix(resolved, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+		return unsafe
+	}
+	return nil
+}
+
+// Fail with ErrUnsafePath if target, or a directory it's under, is a
+// symlink below destDir.  Link targets are checked as each link is made,
+// but a later link can change where an earlier one leads, so nothing is
+// written through one.  Parts that don't exist yet are fine.
+func checkNoLinks(destDir, target string) error {
+	rel, err := filepath.Rel(destDir, target)
+	if err != nil || rel == "." {
+		return err
+	}
+	var part string
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		part = filepath.Join(part, elem)
+		info, err := os.Lstat(filepath.Join(destDir, part))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s is a symlink", ErrUnsafePath, filepath.ToSlash(part))
+		}
+	}
+	return nil
+}
+
+// os.MkdirAll for dir under destDir, unless checkNoLinks objects.
+func mkdirUnder(destDir, dir string) error {
+	if err := checkNoLinks(destDir, dir); err != nil {
+		return err
+	}
+	return os.MkdirAll(dir, 0o755)
+}
+
+// The absolute path p with symlinks followed in the parts of it that
+// exist, and each ".." taken where the walk has got to, as the kernel
+// resolves it.  "" for a loop of links.
+func realPath(p string) string {
+	vol := filepath.VolumeName(p)
+	real := vol + string(filepath.Separator)
+	rest := strings.Split(filepath.ToSlash(p[len(vol):]), "/")
+	for hops := 0; len(rest) > 0; {
+		elem := rest[0]
+		rest = rest[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			real = filepath.Dir(real)
+			continue
+		}
+		next := filepath.Join(real, elem)
+		link, err := os.Readlink(next)
+		if err != nil { // Not a link, or not there yet
+			real = next
+			continue
+		}
+		if hops++; hops > 255 {
+			return ""
+		}
+		if filepath.IsAbs(link) {
+			vol = filepath.VolumeName(link)
+			real, link = vol+string(filepath.Separator), link[len(vol):]
+		}
+		rest = append(strings.Split(filepath.ToSlash(link), "/"), rest...)
+	}
+	return real
+}
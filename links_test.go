@@ -0,0 +1,173 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeLinkTgz(t *testing.T, dir string) string {
+	return writeTestTgz(t, dir, "links.tgz", []testTarEntry{
+		{tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "content"},
+		{tar.Header{Name: "sub/s", Typeflag: tar.TypeSymlink, Linkname: "../a.txt", Mode: 0o777}, ""},
+		{tar.Header{Name: "h", Typeflag: tar.TypeLink, Linkname: "a.txt", Mode: 0o644}, ""},
+		{tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: "../outside", Mode: 0o777}, ""},
+		{tar.Header{Name: "abs", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd", Mode: 0o777}, ""},
+		// Inside lexically, but "d" is the destination, so "d/.." is its parent.
+		{tar.Header{Name: "d", Typeflag: tar.TypeSymlink, Linkname: ".", Mode: 0o777}, ""},
+		{tar.Header{Name: "e", Typeflag: tar.TypeSymlink, Linkname: "d/..", Mode: 0o777}, ""},
+	})
+}
+
+func TestLinkEntries(t *testing.T) {
+	ar, err := GetArchiveInfo(writeLinkTgz(t, t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := ar.File("sub/s"); !s.IsSymlink() || s.IsHardlink() || s.Linkname() != "../a.txt" {
+		t.Errorf("sub/s: symlink %v, hardlink %v, -> %q", s.IsSymlink(), s.IsHardlink(), s.Linkname())
+	}
+	if h := ar.File("h"); h.IsSymlink() || !h.IsHardlink() || h.Linkname() != "a.txt" {
+		t.Errorf("h: symlink %v, hardlink %v, -> %q", h.IsSymlink(), h.IsHardlink(), h.Linkname())
+	}
+	if a := ar.File("a.txt"); a.IsSymlink() || a.IsHardlink() || a.Linkname() != "" {
+		t.Errorf("a.txt: symlink %v, hardlink %v, -> %q", a.IsSymlink(), a.IsHardlink(), a.Linkname())
+	}
+
+	dest := t.TempDir()
+	if err = ar.ExtractAll(dest); err != nil {
+		t.Fatalf("ExtractAll() error = %v", err)
+	}
+	if got := listTree(t, dest); len(got) != 1 || got[0] != "a.txt" {
+		t.Errorf("SkipLinks extracted %v, want [a.txt]", got)
+	}
+
+	err = ar.ExtractAll(t.TempDir(), WithLinkPolicy(RejectLinks))
+	if !errors.Is(err, ErrLinkEntry) {
+		t.Errorf("RejectLinks error = %v, want ErrLinkEntry", err)
+	}
+
+	for _, extract := range []func(dest string) error{
+		func(dest string) error { return ar.ExtractAll(dest, WithLinkPolicy(MaterializeLinks)) },
+		func(dest string) error {
+			return ar.ExtractFiles([]string{"h", "sub/s", "evil", "abs", "d", "e", "a.txt"}, dest, 2, WithLinkPolicy(MaterializeLinks))
+		},
+	} {
+		dest := filepath.Join(t.TempDir(), "out")
+		err = extract(dest)
+		for _, name := range []string{"evil", "abs", "e"} {
+			if _, statErr := os.Lstat(filepath.Join(dest, name)); statErr == nil {
+				t.Errorf("escaping link %s was created", name)
+			}
+		}
+		if !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("escaping links error = %v, want ErrUnsafePath", err)
+		}
+		if target, err := os.Readlink(filepath.Join(dest, "sub/s")); err != nil || target != "../a.txt" {
+			t.Errorf("sub/s -> %q, %v", target, err)
+		}
+		if data, err := os.ReadFile(filepath.Join(dest, "sub/s")); string(data) != "content" || err != nil {
+			t.Errorf("reading through sub/s = %q, %v", data, err)
+		}
+		a, _ := os.Stat(filepath.Join(dest, "a.txt"))
+		h, err := os.Lstat(filepath.Join(dest, "h"))
+		if err != nil || !os.SameFile(a, h) {
+			t.Errorf("h isn't a hardlink to a.txt: %v", err)
+		}
+	}
+}
+
+// Links that are each safe when made, but together lead out of the
+// destination, mustn't be written through.
+func TestLinkChainEscape(t *testing.T) {
+	ar, err := GetArchiveInfo(writeTestTgz(t, t.TempDir(), "chain.tgz", []testTarEntry{
+		{tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "x/y/../..", Mode: 0o777}, ""},
+		{tar.Header{Name: "x", Typeflag: tar.TypeSymlink, Linkname: ".", Mode: 0o777}, ""},
+		{tar.Header{Name: "y", Typeflag: tar.TypeSymlink, Linkname: ".", Mode: 0o777}, ""},
+		{tar.Header{Name: "a/pwned.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "pwned"},
+		{tar.Header{Name: "a/sub/", Typeflag: tar.TypeDir, Mode: 0o755}, ""},
+		{tar.Header{Name: "real.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "real"},
+		{tar.Header{Name: "h", Typeflag: tar.TypeLink, Linkname: "x/real.txt", Mode: 0o644}, ""},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, extract := range []func(dest string) error{
+		func(dest string) error { return ar.ExtractAll(dest, WithLinkPolicy(MaterializeLinks)) },
+		func(dest string) error {
+			return ar.ExtractFiles([]string{"a", "x", "y", "a/pwned.txt", "a/sub/", "real.txt", "h"}, dest, 2, WithLinkPolicy(MaterializeLinks))
+		},
+	} {
+		top := t.TempDir()
+		dest := filepath.Join(top, "one", "two")
+		if err := extract(dest); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("error = %v, want ErrUnsafePath", err)
+		}
+		for _, dir := range []string{top, filepath.Join(top, "one"), dest} {
+			if _, err := os.Lstat(filepath.Join(dir, "pwned.txt")); err == nil {
+				t.Errorf("pwned.txt written in %s", dir)
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "sub")); err == nil {
+				t.Errorf("sub made in %s", dir)
+			}
+		}
+		if _, err := os.Lstat(filepath.Join(dest, "h")); err == nil {
+			t.Error("hardlink made through a symlink")
+		}
+		if data, err := os.ReadFile(filepath.Join(dest, "real.txt")); err != nil || string(data) != "real" {
+			t.Errorf("real.txt: %q, %v", data, err)
+		}
+	}
+}
+
+func TestZipSymlinkLinkname(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "link.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	head := &zip.FileHeader{Name: "link", Method: zip.Store}
+	head.SetMode(os.ModeSymlink | 0o777)
+	w, err := zw.CreateHeader(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("target/file"))
+	zw.Close()
+	out.Close()
+
+	ar, err := GetArchiveInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link := ar.File("link"); !link.IsSymlink() || link.Linkname() != "target/file" {
+		t.Errorf("zip symlink: %v -> %q", link.IsSymlink(), link.Linkname())
+	}
+}
+
+func TestSubtreeHardlink(t *testing.T) {
+	ar, err := GetArchiveInfo(writeTestTgz(t, t.TempDir(), "docs.tgz", []testTarEntry{
+		{tar.Header{Name: "docs/a.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "docs"},
+		{tar.Header{Name: "docs/b.txt", Typeflag: tar.TypeLink, Linkname: "docs/a.txt", Mode: 0o644}, ""},
+		{tar.Header{Name: "top.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "top"},
+		{tar.Header{Name: "docs/c.txt", Typeflag: tar.TypeLink, Linkname: "top.txt", Mode: 0o644}, ""},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	err = ar.ExtractSubtree("docs", dest, WithLinkPolicy(MaterializeLinks))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("hardlink out of the subtree: error = %v, want fs.ErrNotExist", err)
+	}
+	a, _ := os.Stat(filepath.Join(dest, "a.txt"))
+	b, err := os.Lstat(filepath.Join(dest, "b.txt"))
+	if err != nil || !os.SameFile(a, b) {
+		t.Errorf("b.txt isn't a hardlink to a.txt: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package archiver
+
+// Compare this listing with one captured earlier, by name, size and mod
+// time only; content isn't read.  added and modified are in the current
+// listing's order, removed in prev's order.
+func (ai *ArchiveInfo) DiffListing(prev []ArchivedFile) (added, removed, modified []ArchivedFile) {
+	before := make(map[string]*ArchivedFile, len(prev))
+	for i := range prev {
+		before[prev[i].name] = &prev[i]
+	}
+	now := make(map[string]bool, len(ai.files))
+	for _, af := range ai.files {
+		now[af.name] = true
+		old, ok := before[af.name]
+		switch {
+		case !ok:
+			added = append(added, af)
+		case old.size != af.size || !old.modTime.Equal(af.modTime):
+			modified = append(modified, af)
+		}
+	}
+	for _, af := range prev {
+		if !now[af.name] {
+			removed = append(removed, af)
+		}
+	}
+	return added, removed, modified
+}
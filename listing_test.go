@@ -0,0 +1,51 @@
+package archiver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffListing(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fake an earlier scan: src/main.go didn't exist, README.md was smaller,
+	// guide.md was older, and there used to be a CHANGELOG.
+	var prev []ArchivedFile
+	for _, af := range ar.Files() {
+		switch af.Name() {
+		case "src/main.go":
+			continue
+		case "README.md":
+			af.size -= 5
+		case "docs/guide.md":
+			af.modTime = af.modTime.Add(-time.Hour)
+		}
+		prev = append(prev, af)
+	}
+	prev = append(prev, ArchivedFile{name: "CHANGELOG.md", size: 10})
+
+	added, removed, modified := ar.DiffListing(prev)
+	names := func(files []ArchivedFile) []string {
+		var out []string
+		for _, f := range files {
+			out = append(out, f.Name())
+		}
+		return out
+	}
+	if got := names(added); len(got) != 1 || got[0] != "src/main.go" {
+		t.Errorf("added = %v", got)
+	}
+	if got := names(removed); len(got) != 1 || got[0] != "CHANGELOG.md" {
+		t.Errorf("removed = %v", got)
+	}
+	if got := names(modified); len(got) != 2 || got[0] != "README.md" || got[1] != "docs/guide.md" {
+		t.Errorf("modified = %v", got)
+	}
+
+	added, removed, modified = ar.DiffListing(ar.Files())
+	if len(added)+len(removed)+len(modified) != 0 {
+		t.Errorf("self diff = %v %v %v", added, removed, modified)
+	}
+}
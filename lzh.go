@@ -0,0 +1,263 @@
+package archiver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// The LZSS and static Huffman coding of LHA's -lh4- to -lh7- methods, and
+// of ARJ's methods 1 to 3, which differ only in their window: blocks of
+// symbols under three codes, one for literals and match lengths, one for
+// match distances, and one for the first's code lengths.
+
+const (
+	lzhNC        = 256 + 256 + 2 - 3 // Literals, and match lengths of 3 to 256
+	lzhNT        = 16 + 3            // Code lengths, and three ways of skipping
+	lzhCBits     = 9
+	lzhTBits     = 5
+	lzhThreshold = 3 // Shortest match
+	lzhMaxPast   = 4 // Bytes read past the end before giving up on a stream
+)
+
+// A Huffman code, or just one symbol, sent in no bits.
+type lzhCode struct {
+	huffTable
+	only int // The symbol, or -1 for a real code
+}
+
+func lzhCorrupt(what string) error {
+	return fmt.Errorf("%w: LZH %s", ErrCorruptArchive, what)
+}
+
+// Decodes size bytes of a stream with a window of 1<<dictBits.
+type lzhDecoder struct {
+	bits      msbBits
+	window    []byte
+	pos       int
+	np        int // Distance code's symbols
+	pBits     uint
+	blockLeft int
+	c, t, p   lzhCode
+	copyLeft  int // Of a match
+	copyFrom  int
+	left      int64
+}
+
+// dictBits sets the window and with it the distance code: 12 to 16 bits,
+// for -lh4- to -lh7-, and ARJ's 16.
+func newLZHDecoder(r io.Reader, dictBits uint, size int64) *lzhDecoder {
+	np, pBits := int(dictBits)+1, uint(5)
+	if dictBits <= 13 {
+		np, pBits = 14, 4
+	}
+	return &lzhDecoder{bits: msbBits{r: bufio.NewReader(r)}, window: make([]byte, 1<<dictBits), np: np,
+		pBits: pBits, left: size}
+}
+
+func (d *lzhDecoder) Read(p []byte) (int, error) {
+	n := 0
+	mask := len(d.window) - 1
+	for n < len(p) && d.left > 0 {
+		if d.copyLeft == 0 {
+			c, err := d.symbol()
+			if err != nil {
+				return n, err
+			}
+			if c < 256 {
+				d.window[d.pos&mask] = byte(c)
+				p[n] = byte(c)
+				n++
+				d.pos++
+				d.left--
+				continue
+			}
+			dist, err := d.distance()
+			if err != nil {
+				return n, err
+			}
+			d.copyLeft, d.copyFrom = c-256+lzhThreshold, d.pos-dist-1
+		}
+		b := d.window[d.copyFrom&mask]
+		d.window[d.pos&mask] = b
+		p[n] = b
+		n++
+		d.pos++
+		d.copyFrom++
+		d.copyLeft--
+		d.left--
+	}
+	if d.bits.err != nil {
+		return n, d.bits.err
+	}
+	if d.bits.past > lzhMaxPast {
+		return n, lzhCorrupt("stream runs past its data")
+	}
+	if n == 0 && d.left == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// The next literal or match length, reading a block's codes at its
+// start.
+func (d *lzhDecoder) symbol() (int, error) {
+	if d.blockLeft == 0 {
+		d.blockLeft = int(d.bits.read(16))
+		if d.blockLeft == 0 {
+			d.blockLeft = 1 << 16
+		}
+		if err := d.readLengths(&d.t, lzhNT, lzhTBits, 3); err != nil {
+			return 0, err
+		}
+		if err := d.readCLengths(); err != nil {
+			return 0, err
+		}
+		if err := d.readLengths(&d.p, d.np, d.pBits, -1); err != nil {
+			return 0, err
+		}
+	}
+	d.blockLeft--
+	return d.bits.decode(&d.c)
+}
+
+// A match's distance back, less one.
+func (d *lzhDecoder) distance() (int, error) {
+	j, err := d.bits.decode(&d.p)
+	if err != nil || j == 0 {
+		return 0, err
+	}
+	return 1<<(j-1) + int(d.bits.read(uint(j-1))), nil
+}
+
+// Read the lengths of code, of up to n symbols, given as a count in
+// countBits and then each in unary past 6.  After the special'th, two
+// bits skip up to three zero lengths.
+func (d *lzhDecoder) readLengths(code *lzhCode, n int, countBits uint, special int) error {
+	count := int(d.bits.read(countBits))
+	if count == 0 {
+		code.only = int(d.bits.read(countBits))
+		if code.only >= n {
+			return lzhCorrupt("code's only symbol")
+		}
+		return nil
+	}
+	if count > n {
+		return lzhCorrupt("code size")
+	}
+	lens := make([]byte, n)
+	for i := 0; i < count; {
+		l := d.bits.read(3)
+		if l == 7 {
+			for d.bits.read(1) == 1 {
+				if l++; l > 16 {
+					return lzhCorrupt("code length")
+				}
+			}
+		}
+		lens[i] = byte(l)
+		i++
+		if i == special {
+			if i += int(d.bits.read(2)); i > n {
+				return lzhCorrupt("run of zero lengths")
+			}
+		}
+	}
+	code.only = -1
+	return code.build(lens)
+}
+
+// Read the literal and length code's lengths, given in the code read
+// before it, whose symbols 0 to 2 are runs of zeros.
+func (d *lzhDecoder) readCLengths() error {
+	count := int(d.bits.read(lzhCBits))
+	if count == 0 {
+		d.c.only = int(d.bits.read(lzhCBits))
+		if d.c.only >= lzhNC {
+			return lzhCorrupt("code's only symbol")
+		}
+		return nil
+	}
+	if count > lzhNC {
+		return lzhCorrupt("code size")
+	}
+	lens := make([]byte, lzhNC)
+	for i := 0; i < count; {
+		c, err := d.bits.decode(&d.t)
+		if err != nil {
+			return err
+		}
+		zeros := 0
+		switch c {
+		case 0:
+			zeros = 1
+		case 1:
+			zeros = int(d.bits.read(4)) + 3
+		case 2:
+			zeros = int(d.bits.read(lzhCBits)) + 20
+		default:
+			lens[i] = byte(c - 2)
+			i++
+			continue
+		}
+		if i += zeros; i > count {
+			return lzhCorrupt("run of zero lengths")
+		}
+	}
+	d.c.only = -1
+	return d.c.build(lens)
+}
+
+// A bit stream read from the top bit of each byte.  Past the end of the
+// input, or a read error, it reads zeros, counting them so the decoder
+// can give up.
+type msbBits struct {
+	r    io.ByteReader
+	buf  uint64 // Bits not yet read, from the top
+	n    uint
+	past int
+	err  error // Other than io.EOF
+}
+
+func (b *msbBits) fill(n uint) {
+	for b.n < n {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			b.past++
+			if err != io.EOF && b.err == nil {
+				b.err = err
+			}
+		}
+		b.buf |= uint64(c) << (56 - b.n)
+		b.n += 8
+	}
+}
+
+func (b *msbBits) read(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+	b.fill(n)
+	v := uint32(b.buf >> (64 - n))
+	b.buf <<= n
+	b.n -= n
+	return v
+}
+
+func (b *msbBits) decode(code *lzhCode) (int, error) {
+	if code.only >= 0 {
+		return code.only, nil
+	}
+	if code.bits == 0 {
+		return 0, lzhCorrupt("use of an empty Huffman tree")
+	}
+	b.fill(code.bits)
+	e := code.table[b.buf>>(64-code.bits)]
+	n := uint(e & 31)
+	if n == 0 {
+		return 0, lzhCorrupt("bad Huffman code")
+	}
+	b.buf <<= n
+	b.n -= n
+	return int(e >> 5), nil
+}
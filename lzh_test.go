@@ -0,0 +1,140 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+// Writes bits from the top of each byte, as msbBits reads them.
+type msbBitWriter struct {
+	out []byte
+	n   uint
+}
+
+func (w *msbBitWriter) write(v uint32, n uint) {
+	for i := n; i > 0; i-- {
+		if w.n%8 == 0 {
+			w.out = append(w.out, 0)
+		}
+		w.out[len(w.out)-1] |= byte(v>>(i-1)&1) << (7 - w.n%8)
+		w.n++
+	}
+}
+
+// A match or a literal, as a test encoder found it.
+type lzToken struct {
+	length int // 0 for a literal
+	dist   int // Back from the current position, less one
+	lit    byte
+}
+
+// Greedy LZSS over data, the longest match within window.
+func lzTokens(data []byte, window, maxLen int) []lzToken {
+	var tokens []lzToken
+	for pos := 0; pos < len(data); {
+		best := lzToken{lit: data[pos]}
+		for from := max(0, pos-window); from < pos; from++ {
+			l := 0
+			for l < maxLen && pos+l < len(data) && data[from+l] == data[pos+l] {
+				l++
+			}
+			if l >= lzhThreshold && l > best.length {
+				best = lzToken{length: l, dist: pos - from - 1}
+			}
+		}
+		tokens = append(tokens, best)
+		pos += max(best.length, 1)
+	}
+	return tokens
+}
+
+// A minimal -lh4- to -lh7- encoder with fixed codes: every code length
+// symbol 5 bits, every literal and length 9 and every distance symbol 5,
+// so each code is the symbol itself.  Blocks are of up to blockSize
+// symbols.
+func lzhEncode(data []byte, dictBits uint, blockSize int) []byte {
+	np, pBits := int(dictBits)+1, uint(5)
+	if dictBits <= 13 {
+		np, pBits = 14, 4
+	}
+	var w msbBitWriter
+	tokens := lzTokens(data, 1<<dictBits, 256)
+	for len(tokens) > 0 {
+		block := tokens[:min(blockSize, len(tokens))]
+		tokens = tokens[len(block):]
+		w.write(uint32(len(block)), 16)
+		w.write(lzhNT, lzhTBits)
+		for i := 0; i < lzhNT; i++ {
+			w.write(5, 3)
+			if i == 2 {
+				w.write(0, 2) // No zero lengths to skip
+			}
+		}
+		w.write(lzhNC, lzhCBits)
+		for i := 0; i < lzhNC; i++ {
+			w.write(9+2, 5)
+		}
+		w.write(uint32(np), pBits)
+		for i := 0; i < np; i++ {
+			w.write(5, 3)
+		}
+		for _, t := range block {
+			if t.length == 0 {
+				w.write(uint32(t.lit), 9)
+				continue
+			}
+			w.write(uint32(t.length-lzhThreshold+256), 9)
+			j := uint(bits.Len(uint(t.dist)))
+			w.write(uint32(j), 5)
+			if j > 1 {
+				w.write(uint32(t.dist), j-1)
+			}
+		}
+	}
+	return w.out
+}
+
+func testLZHData() []byte {
+	var b strings.Builder
+	for i := 0; i < 40; i++ {
+		b.WriteString("Lempel-Ziv with static Huffman codes, block by block. ")
+		b.WriteByte(byte(i * 7))
+	}
+	return []byte(b.String())
+}
+
+func TestLZHDecoder(t *testing.T) {
+	data := testLZHData()
+	for _, dictBits := range []uint{12, 13, 15, 16} {
+		for _, blockSize := range []int{1 << 16, 50} {
+			r := newLZHDecoder(bytes.NewReader(lzhEncode(data, dictBits, blockSize)), dictBits, int64(len(data)))
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%d bits, blocks of %d: %d bytes, %v", dictBits, blockSize, len(got), err)
+			}
+		}
+	}
+
+	// A block whose codes each have only the one symbol: 'x' again and
+	// again.
+	var w msbBitWriter
+	w.write(5, 16)
+	w.write(0, lzhTBits)
+	w.write(0, lzhTBits)
+	w.write(0, lzhCBits)
+	w.write('x', lzhCBits)
+	w.write(0, 4)
+	w.write(0, 4)
+	if got, err := io.ReadAll(newLZHDecoder(bytes.NewReader(w.out), 13, 5)); err != nil || string(got) != "xxxxx" {
+		t.Errorf("single symbols: %q, %v", got, err)
+	}
+
+	truncated := lzhEncode(data, 13, 1<<16)[:100]
+	if _, err := io.ReadAll(newLZHDecoder(bytes.NewReader(truncated), 13, int64(len(data)))); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("truncated: %v", err)
+	}
+}
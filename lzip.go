@@ -0,0 +1,105 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// lzip: one or more members, each a six-byte header (LZIP, version 1, a
+// coded dictionary size), an LZMA stream with an end marker, and a trailer
+// giving the data's CRC32, its size and the member's size.
+
+const (
+	lzipMagic      = "LZIP"
+	lzipHeaderLen  = 6
+	lzipTrailerLen = 20
+)
+
+type lzipReader struct {
+	r      *bufio.Reader
+	member io.Reader       // The current member's LZMA stream; nil after the last
+	packed *countingReader // Under member, to size it
+	crc    uint32
+	size   int64
+}
+
+// Read the first member's header from r and return a reader of what all
+// the members decompress to.
+func newLzipReader(r io.Reader) (*lzipReader, error) {
+	l := &lzipReader{r: bufio.NewReader(r)}
+	return l, l.start()
+}
+
+// Begin the member whose header is next.
+func (l *lzipReader) start() error {
+	var head [lzipHeaderLen]byte
+	if _, err := io.ReadFull(l.r, head[:]); err != nil {
+		return noEOF(err)
+	}
+	if string(head[:4]) != lzipMagic {
+		return fmt.Errorf("%w: lzip magic", ErrCorruptArchive)
+	}
+	if head[4] != 1 {
+		return fmt.Errorf("%w: lzip version %d", ErrUnsupportedFormat, head[4])
+	}
+	// A power of two, less up to seven sixteenths of it.
+	exp := head[5] & 0x1F
+	if exp < 12 || exp > 29 {
+		return fmt.Errorf("%w: lzip dictionary size", ErrCorruptArchive)
+	}
+	dict := uint32(1)<<exp - uint32(head[5]>>5)*(uint32(1)<<exp/16)
+	// Rebuild the classic .lzma header: lc 3, lp 0, pb 2, the dictionary,
+	// and the size left to the end marker.  lzma reads the stream a byte
+	// at a time through the MultiReader, leaving the trailer unread.
+	classic := append([]byte{0x5D}, binary.LittleEndian.AppendUint32(nil, dict)...)
+	classic = append(classic, bytes.Repeat([]byte{0xFF}, 8)...)
+	l.packed = &countingReader{r: l.r}
+	member, err := lzma.NewReader(io.MultiReader(bytes.NewReader(classic), l.packed))
+	if err != nil {
+		return err
+	}
+	l.member, l.crc, l.size = member, 0, 0
+	return nil
+}
+
+func (l *lzipReader) Read(p []byte) (int, error) {
+	for l.member != nil {
+		n, err := l.member.Read(p)
+		l.crc = crc32.Update(l.crc, crc32.IEEETable, p[:n])
+		l.size += int64(n)
+		if err == io.EOF {
+			err = l.next()
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, io.EOF
+}
+
+// Check the finished member's trailer, and start the next member if there
+// is one.  io.EOF after the last.
+func (l *lzipReader) next() error {
+	var trailer [lzipTrailerLen]byte
+	if _, err := io.ReadFull(l.r, trailer[:]); err != nil {
+		return noEOF(err)
+	}
+	switch {
+	case binary.LittleEndian.Uint32(trailer[:]) != l.crc:
+		return fmt.Errorf("%w: lzip CRC mismatch", ErrCorruptArchive)
+	case binary.LittleEndian.Uint64(trailer[4:]) != uint64(l.size),
+		binary.LittleEndian.Uint64(trailer[12:]) != uint64(lzipHeaderLen+l.packed.n+lzipTrailerLen):
+		return fmt.Errorf("%w: lzip size mismatch", ErrCorruptArchive)
+	}
+	if magic, _ := l.r.Peek(len(lzipMagic)); string(magic) != lzipMagic {
+		l.member = nil
+		return io.EOF
+	}
+	return l.start()
+}
@@ -0,0 +1,80 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// An lzip member of data: lzma's stream with an end marker, between the
+// lzip header and trailer.
+func lzipMember(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := lzma.WriterConfig{DictCap: 1 << 16, EOSMarker: true}.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+	stream := buf.Bytes()[lzma.HeaderLen:]
+	member := append([]byte(lzipMagic), 1, 16) // A 64 KiB dictionary
+	member = append(member, stream...)
+	member = binary.LittleEndian.AppendUint32(member, crc32.ChecksumIEEE(data))
+	member = binary.LittleEndian.AppendUint64(member, uint64(len(data)))
+	return binary.LittleEndian.AppendUint64(member, uint64(len(member)+8))
+}
+
+func TestLzip(t *testing.T) {
+	one, two := testLZHData(), []byte("a second member\n")
+	data := append(lzipMember(t, one), lzipMember(t, two)...)
+	r, err := newLzipReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, append(bytes.Clone(one), two...)) {
+		t.Errorf("%d bytes, %v", len(got), err)
+	}
+
+	// A wrong CRC or size in the trailer is caught.
+	for _, at := range []int{len(data) - 20, len(data) - 16, len(data) - 8} {
+		bad := bytes.Clone(data)
+		bad[at] ^= 1
+		r, err := newLzipReader(bytes.NewReader(bad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(r); !errors.Is(err, ErrCorruptArchive) {
+			t.Errorf("trailer byte %d: %v", at, err)
+		}
+	}
+	if _, err := newLzipReader(bytes.NewReader(append([]byte(lzipMagic), 2, 16))); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("version 2: %v", err)
+	}
+}
+
+// An lzip tarball lists as tar.
+func TestTarLzip(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "configure", Typeflag: tar.TypeReg, Mode: 0o755, Size: 10})
+	tw.Write([]byte("#!/bin/sh\n"))
+	tw.Close()
+	data := lzipMember(t, buf.Bytes())
+	ai, err := GetArchiveInfoFromReader(bytes.NewReader(data), int64(len(data)), WithNameHint("pkg-1.0.tar.lz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ai.ArchiveType != ARCHIVE_TLZ || len(ai.Files()) != 1 || !ai.ExtensionMatchesType() {
+		t.Fatalf("type %v with %d entries", ai.ArchiveType, len(ai.Files()))
+	}
+	af := ai.FileAt(0)
+	if got, err := af.GetString(); got != "#!/bin/sh\n" || err != nil || af.Method() != "LZMA" || af.Mode() != 0o755 {
+		t.Errorf("GetString() = %q, %v, method %q, mode %v", got, err, af.Method(), af.Mode())
+	}
+}
@@ -0,0 +1,188 @@
+package archiver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Unix compress's .Z format: 1F 9D, a byte giving the widest code and
+// whether there's a clear code, then LZW codes packed low bit first.  Codes
+// start 9 bits wide and widen as the table fills.  compress read codes in
+// groups of eight, and threw away the rest of a group whenever the width
+// changed or the table was cleared, so the decoder does too.
+
+const (
+	lzwMinBits   = 9
+	lzwMaxBits   = 16
+	lzwClear     = 256 // In block mode, empties the table
+	lzwBlockMode = 0x80
+)
+
+type lzwReader struct {
+	r       io.ByteReader
+	maxBits uint
+	block   bool
+	bits    uint32 // Read but not yet used, low first
+	nbits   uint
+	width   uint
+	maxCode int // Widen once the table passes this
+	codes   int // Read at this width since the group last started over
+	free    int // Next table entry
+	old     int // The last code, -1 before the first
+	first   byte
+	prefix  []uint16
+	suffix  []byte
+	stack   []byte // Decoded but not yet returned, last byte first
+}
+
+func lzwCorrupt(what string) error {
+	return fmt.Errorf("%w: compress %s", ErrCorruptArchive, what)
+}
+
+// Read the header from r and return a reader of what it decompresses to.
+func newLZWReader(r io.Reader) (*lzwReader, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	var head [3]byte
+	for i := range head {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		head[i] = b
+	}
+	if head[0] != 0x1F || head[1] != 0x9D {
+		return nil, lzwCorrupt("magic")
+	}
+	z := &lzwReader{r: br, maxBits: uint(head[2] & 0x1F), block: head[2]&lzwBlockMode != 0,
+		free: 256, old: -1}
+	if z.maxBits < lzwMinBits || z.maxBits > lzwMaxBits {
+		return nil, fmt.Errorf("%w: compress with %d-bit codes", ErrUnsupportedFormat, z.maxBits)
+	}
+	z.setWidth(lzwMinBits)
+	if z.block {
+		z.free = 257
+	}
+	z.prefix = make([]uint16, 1<<z.maxBits)
+	z.suffix = make([]byte, 1<<z.maxBits)
+	return z, nil
+}
+
+func (z *lzwReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(z.stack) == 0 {
+			if err := z.decode(); err != nil {
+				return n, err
+			}
+			continue
+		}
+		p[n] = z.stack[len(z.stack)-1]
+		z.stack = z.stack[:len(z.stack)-1]
+		n++
+	}
+	return n, nil
+}
+
+// Decode the next code onto the stack.
+func (z *lzwReader) decode() error {
+	if z.free > z.maxCode {
+		if err := z.skipGroup(); err != nil {
+			return err
+		}
+		z.setWidth(z.width + 1)
+	}
+	code, err := z.readCode()
+	if err != nil {
+		return err
+	}
+	if code == lzwClear && z.block {
+		// The next code makes an entry at 256 that's never used, as it
+		// did in compress.
+		if err := z.skipGroup(); err != nil {
+			return err
+		}
+		z.setWidth(lzwMinBits)
+		z.free = 256
+		return nil
+	}
+	if z.old < 0 {
+		if code > 255 {
+			return lzwCorrupt("first code")
+		}
+		z.old, z.first = code, byte(code)
+		z.stack = append(z.stack, z.first)
+		return nil
+	}
+	in := code
+	switch {
+	case code > z.free:
+		return lzwCorrupt("code past the table")
+	case code == z.free:
+		z.stack = append(z.stack, z.first)
+		code = z.old
+	}
+	for code > 255 {
+		z.stack = append(z.stack, z.suffix[code])
+		code = int(z.prefix[code])
+	}
+	z.first = byte(code)
+	z.stack = append(z.stack, z.first)
+	if z.free < 1<<z.maxBits {
+		z.prefix[z.free], z.suffix[z.free] = uint16(z.old), z.first
+		z.free++
+	}
+	z.old = in
+	return nil
+}
+
+// Codes are width bits from here.  At the widest the table can fill
+// without widening any further.  compress only checked for that after
+// widening, so 9-bit files go on to 10-bit codes once the table is full,
+// and so must we.
+func (z *lzwReader) setWidth(width uint) {
+	z.width, z.maxCode = width, 1<<width-1
+	if width == z.maxBits && width > lzwMinBits {
+		z.maxCode = 1 << width
+	}
+}
+
+// The next code, or io.EOF if the input ends before one.
+func (z *lzwReader) readCode() (int, error) {
+	for z.nbits < z.width {
+		b, err := z.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		z.bits |= uint32(b) << z.nbits
+		z.nbits += 8
+	}
+	code := int(z.bits & (1<<z.width - 1))
+	z.bits >>= z.width
+	z.nbits -= z.width
+	z.codes++
+	return code, nil
+}
+
+// Skip to the end of the group of eight codes.  Groups are whole bytes, so
+// this leaves the reader on a byte boundary.
+func (z *lzwReader) skipGroup() error {
+	skip := (8 - z.codes%8) % 8 * int(z.width)
+	z.codes = 0
+	if skip <= int(z.nbits) {
+		z.bits >>= skip
+		z.nbits -= uint(skip)
+		return nil
+	}
+	skip -= int(z.nbits)
+	z.bits, z.nbits = 0, 0
+	for ; skip > 0; skip -= 8 {
+		if _, err := z.r.ReadByte(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// Writes bits low first, as compress packs its codes.
+type lsbBitWriter struct {
+	out []byte
+	n   uint
+}
+
+func (w *lsbBitWriter) write(v uint32, n uint) {
+	for i := uint(0); i < n; i++ {
+		if w.n%8 == 0 {
+			w.out = append(w.out, 0)
+		}
+		w.out[len(w.out)-1] |= byte(v>>i&1) << (w.n % 8)
+		w.n++
+	}
+}
+
+// compress's output with codes up to maxBits wide, clearing the table when
+// it fills if block, else carrying on with it full.  It keeps track of the
+// decoder's table to know when the width changes.
+func lzwEncode(data []byte, maxBits uint, block bool) []byte {
+	w := &lsbBitWriter{out: []byte{0x1F, 0x9D, byte(maxBits)}}
+	z := &lzwReader{maxBits: maxBits}
+	z.setWidth(lzwMinBits)
+	free, codes, first := 256, 0, true
+	if block {
+		w.out[2] |= lzwBlockMode
+		free = 257
+	}
+	pad := func() {
+		w.write(0, uint((8-codes%8)%8)*z.width)
+		codes = 0
+	}
+	emit := func(code int) {
+		if free > z.maxCode {
+			pad()
+			z.setWidth(z.width + 1)
+		}
+		w.write(uint32(code), z.width)
+		codes++
+		if !first && free < 1<<maxBits {
+			free++
+		}
+		first = false
+	}
+	table, next := map[[2]int]int{}, free
+	prefix := int(data[0])
+	for _, c := range data[1:] {
+		if code, ok := table[[2]int{prefix, int(c)}]; ok {
+			prefix = code
+			continue
+		}
+		emit(prefix)
+		if next < 1<<maxBits {
+			table[[2]int{prefix, int(c)}] = next
+			next++
+		} else if block {
+			emit(lzwClear) // The table is full, so this makes no entry
+			pad()
+			z.setWidth(lzwMinBits)
+			free = 256
+			table, next = map[[2]int]int{}, 257
+		}
+		prefix = int(c)
+	}
+	emit(prefix)
+	return w.out
+}
+
+func testLZWData() []byte {
+	rng := rand.New(rand.NewSource(9))
+	var b bytes.Buffer
+	for b.Len() < 200000 {
+		if rng.Intn(3) == 0 {
+			b.WriteString("compress(1) was the standard Unix compressor. ")
+		} else {
+			b.WriteByte(byte(rng.Intn(256)))
+		}
+	}
+	return b.Bytes()
+}
+
+func TestLZW(t *testing.T) {
+	data := testLZWData()
+	for _, c := range []struct {
+		bits  uint
+		block bool
+	}{{9, true}, {12, true}, {16, true}, {12, false}} {
+		r, err := newLZWReader(bytes.NewReader(lzwEncode(data, c.bits, c.block)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%d bits, block %v: %d bytes, %v", c.bits, c.block, len(got), err)
+		}
+	}
+
+	if _, err := newLZWReader(bytes.NewReader([]byte{0x1F, 0x9D, 0x80 | 20})); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("20-bit codes: %v", err)
+	}
+	bad := lzwEncode([]byte("abc"), 16, true)
+	bad[3] |= 0xFF // A first code that isn't a byte
+	bad[4] |= 0x01
+	r, err := newLZWReader(bytes.NewReader(bad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("bad first code: %v", err)
+	}
+}
+
+// A compressed tarball lists as tar.
+func TestTarZ(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "src/main.c", Typeflag: tar.TypeReg, Mode: 0o644, Size: 13})
+	tw.Write([]byte("int main();\n\n"))
+	tw.Close()
+	data := lzwEncode(buf.Bytes(), 16, true)
+	ai, err := GetArchiveInfoFromReader(bytes.NewReader(data), int64(len(data)), WithNameHint("src.tar.Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ai.ArchiveType != ARCHIVE_TZ || len(ai.Files()) != 1 || !ai.ExtensionMatchesType() {
+		t.Fatalf("type %v with %d entries", ai.ArchiveType, len(ai.Files()))
+	}
+	af := ai.FileAt(0)
+	if got, err := af.GetString(); got != "int main();\n\n" || err != nil || af.Method() != "LZW" {
+		t.Errorf("GetString() = %q, %v, method %q", got, err, af.Method())
+	}
+}
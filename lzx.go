@@ -0,0 +1,419 @@
+package archiver
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// LZX decompression, as CAB folders use it: LZ77 over a 32K to 2M window
+// with Huffman-coded literals, lengths and offsets, in frames of 32K of
+// output.  The decoder keeps its window, trees and block state from frame
+// to frame; the bit stream starts afresh on a 16-bit boundary with each.
+// WIM's variant compresses each chunk as a stream of its own, in one
+// frame the size of the window.
+
+const (
+	lzxFrameSize     = 32768
+	lzxMinMatch      = 2
+	lzxNumChars      = 256
+	lzxPretreeSize   = 20
+	lzxLengthSize    = 249
+	lzxAlignedSize   = 8
+	lzxMaxSlots      = 50
+	lzxBlockVerbatim = 1
+	lzxBlockAligned  = 2
+	lzxBlockStored   = 3
+	lzxWIMFileSize   = 12000000 // WIM's E8 translation size, there being no header to give one
+)
+
+// Footer bits, and the offset each position slot starts at.
+var lzxExtraBits, lzxPositionBase = lzxSlotTables()
+
+func lzxSlotTables() (extra, base [lzxMaxSlots + 1]uint32) {
+	for i, j := 0, uint32(0); i <= lzxMaxSlots; i += 2 {
+		extra[i] = j
+		if i+1 <= lzxMaxSlots {
+			extra[i+1] = j
+		}
+		if i != 0 && j < 17 {
+			j++
+		}
+	}
+	for i, j := 0, uint32(0); i <= lzxMaxSlots; i++ {
+		base[i] = j
+		j += 1 << extra[i]
+	}
+	return extra, base
+}
+
+type lzxDecoder struct {
+	window     []byte
+	pos        int       // Next byte of the window to fill
+	total      int64     // Bytes decoded so far, which matches can't reach past
+	r          [3]uint32 // Most recent match offsets
+	slots      int
+	mainLens   []byte // Kept from block to block: each tree is sent as deltas
+	lengthLens []byte
+	main       huffTable
+	length     huffTable
+	aligned    huffTable
+	blockType  int
+	blockLen   int
+	blockLeft  int
+	started    bool  // The stream header has been read
+	e8Size     int32 // Translation size for E8 call offsets; 0 for none
+	e8Seen     bool  // Some block may have E8 bytes
+	e8Pos      int32 // Stream position of the current frame
+	frame      int
+	wim        bool
+	bits       lzxBits
+}
+
+// A decoder for a window of 1<<windowBits bytes, 15 to 21.
+func newLZXDecoder(windowBits int) (*lzxDecoder, error) {
+	if windowBits < 15 || windowBits > 21 {
+		return nil, fmt.Errorf("%w: LZX window of 2^%d bytes", ErrUnsupportedFormat, windowBits)
+	}
+	slots := windowBits * 2
+	switch windowBits {
+	case 20:
+		slots = 42
+	case 21:
+		slots = 50
+	}
+	return &lzxDecoder{window: make([]byte, 1<<windowBits), r: [3]uint32{1, 1, 1}, slots: slots,
+		mainLens: make([]byte, lzxNumChars+slots*8), lengthLens: make([]byte, lzxLengthSize)}, nil
+}
+
+// A decoder for one chunk of a WIM resource: no stream header, E8 calls
+// always translated, and block sizes coded differently.
+func newWIMLZXDecoder(windowBits int) (*lzxDecoder, error) {
+	d, err := newLZXDecoder(windowBits)
+	if err == nil {
+		d.wim, d.started, d.e8Size = true, true, lzxWIMFileSize
+	}
+	return d, err
+}
+
+func lzxCorrupt(what string) error {
+	return fmt.Errorf("%w: LZX %s", ErrCorruptArchive, what)
+}
+
+// Decode the next frame, of size bytes (32K but for a stream's last), from
+// in.  The result is the decoder's to reuse on the next call.
+func (d *lzxDecoder) decodeFrame(in []byte, size int) ([]byte, error) {
+	if size <= 0 || size > lzxFrameSize && !d.wim || size > len(d.window) {
+		return nil, lzxCorrupt("frame size")
+	}
+	d.bits = lzxBits{in: in}
+	if !d.started {
+		if d.bits.read(1) == 1 {
+			hi, lo := d.bits.read(16), d.bits.read(16)
+			d.e8Size = int32(hi<<16 | lo)
+		}
+		d.started = true
+	}
+	start := d.pos
+	end := start + size
+	for d.pos < end {
+		if d.blockLeft == 0 {
+			if d.blockType == lzxBlockStored && d.blockLen&1 == 1 {
+				d.bits.pos++ // Padding after an odd-sized stored block
+			}
+			if err := d.readBlockHeader(); err != nil {
+				return nil, err
+			}
+		}
+		run := min(d.blockLeft, end-d.pos)
+		d.blockLeft -= run
+		var err error
+		if d.blockType == lzxBlockStored {
+			err = d.copyStored(run)
+		} else {
+			var over int
+			over, err = d.decodeRun(run, start, end)
+			if over > d.blockLeft {
+				return nil, lzxCorrupt("match past the end of its block")
+			}
+			d.blockLeft -= over
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if d.bits.pos > len(in)+2 {
+		return nil, lzxCorrupt("frame runs past its input")
+	}
+	out := d.window[start:end]
+	d.total += int64(size)
+	if d.pos == len(d.window) {
+		d.pos = 0
+	}
+	if d.e8Seen && d.e8Size != 0 && d.frame < 32768 && size > 10 {
+		out = d.translateE8(out)
+	}
+	d.e8Pos += int32(size)
+	d.frame++
+	return out, nil
+}
+
+func (d *lzxDecoder) readBlockHeader() error {
+	d.blockType = int(d.bits.read(3))
+	switch {
+	case !d.wim:
+		hi, lo := d.bits.read(16), d.bits.read(8)
+		d.blockLen = int(hi<<8 | lo)
+	case d.bits.read(1) == 1:
+		d.blockLen = lzxFrameSize
+	default:
+		d.blockLen = int(d.bits.read(16))
+		if len(d.window) >= 1<<16 {
+			d.blockLen = d.blockLen<<8 | int(d.bits.read(8))
+		}
+	}
+	d.blockLeft = d.blockLen
+	switch d.blockType {
+	case lzxBlockAligned:
+		var lens [lzxAlignedSize]byte
+		for i := range lens {
+			lens[i] = byte(d.bits.read(3))
+		}
+		if err := d.aligned.build(lens[:]); err != nil {
+			return err
+		}
+		fallthrough
+	case lzxBlockVerbatim:
+		if err := d.readLengths(d.mainLens[:lzxNumChars]); err != nil {
+			return err
+		}
+		if err := d.readLengths(d.mainLens[lzxNumChars:]); err != nil {
+			return err
+		}
+		if err := d.main.build(d.mainLens); err != nil {
+			return err
+		}
+		if d.mainLens[0xE8] != 0 {
+			d.e8Seen = true
+		}
+		if err := d.readLengths(d.lengthLens); err != nil {
+			return err
+		}
+		return d.length.build(d.lengthLens)
+	case lzxBlockStored:
+		d.e8Seen = true
+		// Realign to a byte boundary, which always takes 1 to 16 bits.
+		if d.bits.n == 0 {
+			d.bits.pos += 2
+		}
+		d.bits.buf, d.bits.n = 0, 0
+		if d.bits.pos+12 > len(d.bits.in) {
+			return lzxCorrupt("stored block header")
+		}
+		for i := range d.r {
+			d.r[i] = binary.LittleEndian.Uint32(d.bits.in[d.bits.pos+4*i:])
+		}
+		d.bits.pos += 12
+		return nil
+	}
+	return lzxCorrupt(fmt.Sprintf("block type %d", d.blockType))
+}
+
+// Update lens by the deltas sent through a pretree.
+func (d *lzxDecoder) readLengths(lens []byte) error {
+	var preLens [lzxPretreeSize]byte
+	for i := range preLens {
+		preLens[i] = byte(d.bits.read(4))
+	}
+	var pretree huffTable
+	if err := pretree.build(preLens[:]); err != nil {
+		return err
+	}
+	for x := 0; x < len(lens); {
+		code, err := d.bits.decode(&pretree)
+		if err != nil {
+			return err
+		}
+		var n int
+		value := byte(0)
+		switch code {
+		case 17:
+			n = int(d.bits.read(4)) + 4
+		case 18:
+			n = int(d.bits.read(5)) + 20
+		case 19:
+			n = int(d.bits.read(1)) + 4
+			if code, err = d.bits.decode(&pretree); err != nil {
+				return err
+			}
+			value = byte((int(lens[x]) - code + 17) % 17)
+		default:
+			n, value = 1, byte((int(lens[x])-code+17)%17)
+		}
+		for n = min(n, len(lens)-x); n > 0; n-- {
+			lens[x] = value
+			x++
+		}
+	}
+	return nil
+}
+
+// Copy run bytes of a stored block.
+func (d *lzxDecoder) copyStored(run int) error {
+	if d.bits.pos+run > len(d.bits.in) {
+		return lzxCorrupt("stored block runs past its input")
+	}
+	copy(d.window[d.pos:], d.bits.in[d.bits.pos:d.bits.pos+run])
+	d.bits.pos += run
+	d.pos += run
+	return nil
+}
+
+// Decode at least run bytes of a verbatim or aligned block into the
+// window, within the frame from start to end.  A match may carry on into
+// the next block; how far is returned.
+func (d *lzxDecoder) decodeRun(run, start, end int) (int, error) {
+	for run > 0 {
+		sym, err := d.bits.decode(&d.main)
+		if err != nil {
+			return 0, err
+		}
+		if sym < lzxNumChars {
+			d.window[d.pos] = byte(sym)
+			d.pos++
+			run--
+			continue
+		}
+		sym -= lzxNumChars
+		length := sym & 7
+		if length == 7 {
+			extra, err := d.bits.decode(&d.length)
+			if err != nil {
+				return 0, err
+			}
+			length += extra
+		}
+		length += lzxMinMatch
+		slot := sym >> 3
+		var offset uint32
+		switch slot {
+		case 0:
+			offset = d.r[0]
+		case 1:
+			offset = d.r[1]
+			d.r[1], d.r[0] = d.r[0], offset
+		case 2:
+			offset = d.r[2]
+			d.r[2], d.r[0] = d.r[0], offset
+		default:
+			extra := lzxExtraBits[slot]
+			offset = lzxPositionBase[slot] - 2
+			switch {
+			case d.blockType == lzxBlockAligned && extra >= 3:
+				offset += d.bits.read(uint(extra-3)) << 3
+				aligned, err := d.bits.decode(&d.aligned)
+				if err != nil {
+					return 0, err
+				}
+				offset += uint32(aligned)
+			default:
+				offset += d.bits.read(uint(extra))
+			}
+			d.r[2], d.r[1], d.r[0] = d.r[1], d.r[0], offset
+		}
+		if d.pos+length > end {
+			return 0, lzxCorrupt("match past the end of the frame")
+		}
+		if offset == 0 || int64(offset) > d.total+int64(d.pos-start) || int(offset) > len(d.window) {
+			return 0, lzxCorrupt("match offset before the start of the stream")
+		}
+		src := d.pos - int(offset)
+		if src < 0 {
+			src += len(d.window)
+		}
+		for i := 0; i < length; i++ {
+			d.window[d.pos] = d.window[src]
+			d.pos++
+			if src++; src == len(d.window) {
+				src = 0
+			}
+		}
+		run -= length
+	}
+	return -run, nil
+}
+
+// Undo the encoder's conversion of x86 CALL targets, E8 followed by a
+// relative offset, to absolute ones.
+func (d *lzxDecoder) translateE8(frame []byte) []byte {
+	out := make([]byte, len(frame))
+	copy(out, frame)
+	pos := d.e8Pos
+	for i := 0; i < len(out)-10; {
+		if out[i] != 0xE8 {
+			i++
+			pos++
+			continue
+		}
+		abs := int32(binary.LittleEndian.Uint32(out[i+1:]))
+		if abs >= -pos && abs < d.e8Size {
+			rel := abs - pos
+			if abs < 0 {
+				rel = abs + d.e8Size
+			}
+			binary.LittleEndian.PutUint32(out[i+1:], uint32(rel))
+		}
+		i += 5
+		pos += 5
+	}
+	return out
+}
+
+// LZX's bit stream: 16-bit little-endian words, read from the top bit.
+// Past the end of the input it reads zeros, leaving decodeFrame to notice.
+type lzxBits struct {
+	in  []byte
+	pos int
+	buf uint64 // Bits not yet read, from the top
+	n   uint
+}
+
+func (b *lzxBits) fill(n uint) {
+	for b.n < n {
+		var w uint64
+		if b.pos < len(b.in) {
+			w = uint64(b.in[b.pos])
+		}
+		if b.pos+1 < len(b.in) {
+			w |= uint64(b.in[b.pos+1]) << 8
+		}
+		b.pos += 2
+		b.buf |= w << (48 - b.n)
+		b.n += 16
+	}
+}
+
+func (b *lzxBits) read(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+	b.fill(n)
+	v := uint32(b.buf >> (64 - n))
+	b.buf <<= n
+	b.n -= n
+	return v
+}
+
+func (b *lzxBits) decode(t *huffTable) (int, error) {
+	if t.bits == 0 {
+		return 0, lzxCorrupt("use of an empty Huffman tree")
+	}
+	b.fill(t.bits)
+	e := t.table[b.buf>>(64-t.bits)]
+	n := uint(e & 31)
+	if n == 0 {
+		return 0, lzxCorrupt("bad Huffman code")
+	}
+	b.buf <<= n
+	b.n -= n
+	return int(e >> 5), nil
+}
@@ -0,0 +1,277 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// Writes LZX as the decoder reads it: bits from the top of 16-bit
+// little-endian words.
+type lzxBitWriter struct {
+	out []byte
+	buf uint16
+	n   uint
+}
+
+func (w *lzxBitWriter) write(v uint32, n uint) {
+	for i := n; i > 0; i-- {
+		w.buf = w.buf<<1 | uint16(v>>(i-1)&1)
+		if w.n++; w.n == 16 {
+			w.out = binary.LittleEndian.AppendUint16(w.out, w.buf)
+			w.buf, w.n = 0, 0
+		}
+	}
+}
+
+func (w *lzxBitWriter) align() {
+	if w.n > 0 {
+		w.write(0, 16-w.n)
+	}
+}
+
+// A minimal LZX encoder for a 32K window, with fixed trees: every main
+// symbol 9 bits, every length symbol 8 and every aligned symbol 3, so each
+// code is the symbol itself.  The caller lays out blocks and tokens, and
+// keeps matches within frames; plain records what it all decodes to.
+type testLZX struct {
+	frames   [][]byte
+	plain    []byte
+	w        lzxBitWriter
+	r        [3]int
+	aligned  bool
+	lensSent bool
+	wim      bool
+}
+
+const testLZXMainSize = lzxNumChars + 30*8
+
+func newTestLZX(e8Size uint32) *testLZX {
+	e := &testLZX{r: [3]int{1, 1, 1}}
+	if e8Size == 0 {
+		e.w.write(0, 1)
+	} else {
+		e.w.write(1, 1)
+		e.w.write(e8Size>>16, 16)
+		e.w.write(e8Size&0xFFFF, 16)
+	}
+	return e
+}
+
+func (e *testLZX) header(kind, size int) {
+	e.w.write(uint32(kind), 3)
+	switch {
+	case !e.wim:
+		e.w.write(uint32(size>>8), 16)
+		e.w.write(uint32(size&0xFF), 8)
+	case size == lzxFrameSize:
+		e.w.write(1, 1)
+	default:
+		e.w.write(0, 1)
+		e.w.write(uint32(size), 16)
+	}
+}
+
+// One WIM chunk of data, as a verbatim block of greedy matches.
+func lzxWIMEncode(data []byte) []byte {
+	e := &testLZX{r: [3]int{1, 1, 1}, wim: true}
+	e.block(lzxBlockVerbatim, len(data))
+	for _, t := range lzTokens(data, lzxFrameSize, 257) {
+		if t.length == 0 {
+			e.literal(string([]byte{t.lit}))
+		} else {
+			e.match(t.dist+1, t.length)
+		}
+	}
+	e.endFrame()
+	return e.frames[0]
+}
+
+// Send tree lengths through a pretree of 5-bit codes: each is the delta
+// from the lengths the trees had.
+func (e *testLZX) lengths(n int, length byte, prev byte) {
+	for i := 0; i < lzxPretreeSize; i++ {
+		e.w.write(5, 4)
+	}
+	for i := 0; i < n; i++ {
+		e.w.write(uint32((int(prev)-int(length)+17)%17), 5)
+	}
+}
+
+func (e *testLZX) block(kind, size int) {
+	e.header(kind, size)
+	if e.aligned = kind == lzxBlockAligned; e.aligned {
+		for i := 0; i < lzxAlignedSize; i++ {
+			e.w.write(3, 3)
+		}
+	}
+	var prev byte
+	if e.lensSent {
+		prev = 9
+	}
+	e.lengths(lzxNumChars, 9, prev)
+	e.lengths(testLZXMainSize-lzxNumChars, 9, prev)
+	if e.lensSent {
+		prev = 8
+	}
+	e.lengths(lzxLengthSize, 8, prev)
+	e.lensSent = true
+}
+
+func (e *testLZX) literal(s string) {
+	for i := 0; i < len(s); i++ {
+		e.w.write(uint32(s[i]), 9)
+		e.emit(s[i])
+	}
+}
+
+// A match at a new offset, or with offset 0 at the last one.
+func (e *testLZX) match(offset, length int) {
+	slot := 0
+	if offset == 0 {
+		offset = e.r[0]
+	} else {
+		for slot = 3; lzxPositionBase[slot+1] <= uint32(offset+2); slot++ {
+		}
+	}
+	head := min(length-lzxMinMatch, 7)
+	e.w.write(uint32(lzxNumChars+slot*8+head), 9)
+	if head == 7 {
+		e.w.write(uint32(length-lzxMinMatch-7), 8)
+	}
+	if slot > 0 {
+		footer, extra := uint32(offset+2)-lzxPositionBase[slot], uint(lzxExtraBits[slot])
+		if e.aligned && extra >= 3 {
+			e.w.write(footer>>3, extra-3)
+			e.w.write(footer&7, 3)
+		} else {
+			e.w.write(footer, extra)
+		}
+		e.r = [3]int{offset, e.r[0], e.r[1]}
+	}
+	for i := 0; i < length; i++ {
+		e.emit(e.plain[len(e.plain)-offset])
+	}
+}
+
+// A whole stored block, setting the repeated offsets to r.
+func (e *testLZX) stored(data string, r [3]int) {
+	e.header(lzxBlockStored, len(data))
+	if e.w.n == 0 {
+		e.w.write(0, 16)
+	}
+	e.w.align()
+	for _, v := range r {
+		e.w.out = binary.LittleEndian.AppendUint32(e.w.out, uint32(v))
+	}
+	e.r = r
+	for i := 0; i < len(data); i++ {
+		e.w.out = append(e.w.out, data[i])
+		e.emit(data[i])
+	}
+	if len(data)%2 == 1 {
+		e.w.out = append(e.w.out, 0)
+	}
+}
+
+// Record b as output, ending the frame at each 32K.
+func (e *testLZX) emit(b byte) {
+	e.plain = append(e.plain, b)
+	if len(e.plain)%lzxFrameSize == 0 {
+		e.endFrame()
+	}
+}
+
+func (e *testLZX) endFrame() {
+	e.w.align()
+	e.frames = append(e.frames, e.w.out)
+	e.w.out = nil
+}
+
+// An LZX stream of two frames with each kind of block, the verbatim one
+// spanning the frame boundary, and an E8 call to translate.  Returns the
+// frames and what they decode to.
+func buildTestLZX() (frames [][]byte, plain []byte) {
+	e := newTestLZX(1000)
+	greeting := "hello, cab world! "
+	e.block(lzxBlockVerbatim, lzxFrameSize+100)
+	e.literal(greeting)
+	e.match(len(greeting), 100) // Through the length tree
+	for len(e.plain) < lzxFrameSize-300 {
+		e.match(0, 257)
+	}
+	call := len(e.plain)
+	e.literal("\xe8\x64\x00\x00\x00")
+	e.literal(strings.Repeat("z", lzxFrameSize-len(e.plain)))
+	e.match(lzxFrameSize-5, 100) // From the previous frame
+	e.block(lzxBlockAligned, 500)
+	e.match(20000, 50)
+	e.literal("aligned")
+	e.match(7, 257)
+	e.match(0, 186)
+	e.stored("stored, and odd-sized", [3]int{3, 2, 1})
+	e.block(lzxBlockVerbatim, 30)
+	e.match(0, 30) // R0 as the stored block left it
+	e.endFrame()
+	// The call's absolute target, 100, is made relative to it again.
+	plain = bytes.Clone(e.plain)
+	rel := int32(100 - call)
+	binary.LittleEndian.PutUint32(plain[call+1:], uint32(rel))
+	return e.frames, plain
+}
+
+func TestLZX(t *testing.T) {
+	frames, want := buildTestLZX()
+	d, err := newLZXDecoder(15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	for i, frame := range frames {
+		size := min(len(want)-len(got), lzxFrameSize)
+		out, err := d.decodeFrame(frame, size)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		got = append(got, out...)
+	}
+	if !bytes.Equal(got, want) {
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("output differs from %d: % x, want % x", i, got[i:min(i+16, len(got))], want[i:min(i+16, len(want))])
+			}
+		}
+		t.Fatalf("%d bytes, want %d", len(got), len(want))
+	}
+
+	d, _ = newLZXDecoder(15)
+	if _, err := d.decodeFrame(frames[0][:len(frames[0])/2], lzxFrameSize); err == nil {
+		t.Error("truncated frame decoded")
+	}
+	if _, err := newLZXDecoder(22); err == nil {
+		t.Error("window of 2^22 accepted")
+	}
+}
+
+func TestWIMLZX(t *testing.T) {
+	data := bytes.Repeat([]byte("chunk by chunk, "), 2048)
+	d, err := newWIMLZXDecoder(15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.decodeFrame(lzxWIMEncode(data), len(data)); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("32K chunk: %d bytes, %v", len(got), err)
+	}
+
+	// A short chunk, whose block gives its size, with an E8 call whose
+	// target is made relative against the chunk's start.
+	short := []byte("call \xe8\x10\x00\x00\x00 and more besides")
+	d, _ = newWIMLZXDecoder(15)
+	got, err := d.decodeFrame(lzxWIMEncode(short), len(short))
+	want := bytes.Clone(short)
+	binary.LittleEndian.PutUint32(want[6:], uint32(0x10-5))
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("short chunk: %q, %v", got, err)
+	}
+}
@@ -0,0 +1,38 @@
+package archiver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Hex SHA-256 of every regular file, by entry name, for attesting what a
+// bundle holds.  Entries are streamed, not held in memory.  Directories
+// and links are left out.  An entry whose data doesn't match its recorded
+// size fails with ErrSizeMismatch.
+func (ai *ArchiveInfo) Manifest256() (map[string]string, error) {
+	manifest := make(map[string]string)
+	err := ai.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		if af.isDir() || !af.mode.IsRegular() || af.hardlink {
+			return nil
+		}
+		if err := af.checkSize(); err != nil {
+			return err
+		}
+		hash := sha256.New()
+		n, err := io.Copy(hash, r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", af.name, err)
+		}
+		if n != af.size {
+			return fmt.Errorf("%s: %w: read %d of %d bytes", af.name, ErrSizeMismatch, n, af.size)
+		}
+		manifest[af.name] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
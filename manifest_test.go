@@ -0,0 +1,31 @@
+package archiver
+
+import "testing"
+
+func TestManifest256(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := ar.Manifest256()
+	if err != nil {
+		t.Fatalf("Manifest256() error = %v", err)
+	}
+	// From sha256sum over the unzipped sample.
+	want := map[string]string{
+		"README.md":         "0c34260ca30d2cb0c257773f797496bc0cb97e9486e83f593413a43734121d58",
+		"docs/api/index.md": "26068872729640ca2ca51084c4bb97adb6b470fb9006d3d45a8722a7d92e345a",
+		"docs/guide.md":     "40bbe93271e64c5d5ff5eb4bdece74b45d64529eec866496851750c1d2b8997c",
+		"docsextra.txt":     "812843c6cd4ca95576f74fd2bc2dfcc011c22dede4aa32b2ad3a5723405b8ab6",
+		"src/main.go":       "55a60bb97151b2b4b680462447ce60ec34511b14fa10d77440c97b9777101566",
+		"src/notes.txt":     "5bc987a691932e8840e116b9154466beb640d54a206891ac6d67e9993d789e5e",
+	}
+	if len(manifest) != len(want) {
+		t.Errorf("Manifest256() has %d entries, want %d: %v", len(manifest), len(want), manifest)
+	}
+	for name, digest := range want {
+		if manifest[name] != digest {
+			t.Errorf("Manifest256()[%s] = %q, want %q", name, manifest[name], digest)
+		}
+	}
+}
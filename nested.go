@@ -0,0 +1,111 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// List archives held inside the archive too, up to depth levels down, so a
+// tarball of zips lists the zips' entries as well.  Entries whose content
+// starts like an archive are read into memory and listed with the same
+// options; see ArchivedFile.Nested and ArchiveInfo.NestedFile.  A member
+// that turns out not to parse stays a plain file, with a warning in
+// Warnings.  Pair it with WithLimits, which applies at every level.
+func WithNestedArchives(depth int) Option {
+	return func(o *options) { o.nested = depth }
+}
+
+// Separates an archive from a path inside it, as in
+// "bundle.tgz!/plugins/extra.zip!/README".
+const NestedSeparator = "!/"
+
+// List the archives inside ar, in one pass over its entries.
+func (ar *ArchiveInfo) loadNested() error {
+	err := ar.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		if af.isDir() || !af.mode.IsRegular() || af.size == 0 || af.nested != nil {
+			return nil
+		}
+		t, replay, err := PeekType(r)
+		if err == nil && t == ARCHIVE_NA {
+			return nil
+		}
+		var data []byte
+		if err == nil {
+			data, err = io.ReadAll(replay)
+		}
+		if err == nil {
+			af.nested, err = ar.loadMember(af, data)
+		}
+		if err != nil {
+			if fatal := fatalNested(err); fatal != nil {
+				return fatal
+			}
+			ar.warn(&EntryError{Archive: ar.fullname, Name: af.name, Offset: -1, Err: err})
+		}
+		return nil
+	})
+	if fatal := fatalNested(err); fatal != nil || err == nil {
+		return fatal
+	}
+	// Whatever stopped the walk, what's listed so far stands.
+	ar.warn(&EntryError{Archive: ar.fullname, Offset: -1, Err: err})
+	return nil
+}
+
+// List a member archive held in data.
+func (ar *ArchiveInfo) loadMember(af *ArchivedFile, data []byte) (*ArchiveInfo, error) {
+	member := &ArchiveInfo{reader: bytes.NewReader(data), size: int64(len(data)), opts: ar.opts, ctx: ar.ctx}
+	member.opts.nested--
+	member.opts.progress = nil // Progress is the outer archive's
+	member.opts.nameHint = path.Base(af.name)
+	member.name = member.opts.nameHint
+	member.fullname = ar.fullname + NestedSeparator + af.name
+	err := member.load()
+	member.ctx = nil
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// Errors that fail the whole listing rather than one member: limits and
+// cancellation.
+func fatalNested(err error) error {
+	if errors.Is(err, ErrLimitExceeded) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return nil
+}
+
+// The archive this entry holds, listed under WithNestedArchives, or nil.
+// Its entries read like any others; their Path is this entry's path
+// inside the outer archive, e.g. "bundle.tgz!/plugins/extra.zip".
+func (af *ArchivedFile) Nested() *ArchiveInfo { return af.nested }
+
+// The entries of the archive this entry holds, or nil.  See Nested.
+func (af *ArchivedFile) Children() []ArchivedFile {
+	if af.nested == nil {
+		return nil
+	}
+	return af.nested.files
+}
+
+// Find an entry by a path that may lead into nested archives, with
+// NestedSeparator after each archive's entry name:
+// "plugins/extra.zip!/README".  Names must be exact, as with File.  nil if
+// any step isn't there.
+func (ai *ArchiveInfo) NestedFile(vpath string) *ArchivedFile {
+	name, rest, inside := strings.Cut(vpath, NestedSeparator)
+	af := ai.File(name)
+	if !inside || af == nil {
+		return af
+	}
+	if af.nested == nil {
+		return nil
+	}
+	return af.nested.NestedFile(rest)
+}
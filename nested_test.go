@@ -0,0 +1,79 @@
+package archiver
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithNestedArchives(t *testing.T) {
+	dir := t.TempDir()
+	deep, _ := os.ReadFile(writeTestZip(t, dir, "deep.zip", [][2]string{{"bottom.txt", "all the way down"}}))
+	inner, _ := os.ReadFile(writeTestZip(t, dir, "inner.zip", [][2]string{{"docs/readme.txt", "inner readme"}, {"deep.zip", string(deep)}, {"zeros.bin", strings.Repeat("\x00", 1<<20)}}))
+	bundle := writeTestTgz(t, dir, "bundle.tgz", []testTarEntry{
+		{tar.Header{Name: "release/", Typeflag: tar.TypeDir, Mode: 0o755}, ""},
+		{tar.Header{Name: "release/inner.zip", Mode: 0o644, Size: int64(len(inner))}, string(inner)},
+		{tar.Header{Name: "release/bogus.zip", Mode: 0o644, Size: 12}, "PK\x03\x04garbage!"},
+		{tar.Header{Name: "release/notes.txt", Mode: 0o644, Size: 5}, "notes"},
+	})
+
+	// Off by default.
+	ar, err := GetArchiveInfo(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar.File("release/inner.zip").Nested() != nil || ar.NestedFile("release/inner.zip!/docs/readme.txt") != nil {
+		t.Error("nested archive listed without WithNestedArchives")
+	}
+
+	ar, err = GetArchiveInfo(bundle, WithNestedArchives(1))
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	innerEntry := ar.File("release/inner.zip")
+	if children := innerEntry.Children(); len(children) != 3 || children[0].Name() != "docs/readme.txt" {
+		t.Errorf("Children() = %v", children)
+	}
+	af := ar.NestedFile("release/inner.zip!/docs/readme.txt")
+	if af == nil {
+		t.Fatal("NestedFile() found nothing")
+	}
+	if data, err := af.GetBytes(); string(data) != "inner readme" || err != nil {
+		t.Errorf("nested GetBytes() = %q, %v", data, err)
+	}
+	if want := filepath.Join(dir, "bundle.tgz") + "!/release/inner.zip"; af.Path() != want {
+		t.Errorf("nested Path() = %q, want %q", af.Path(), want)
+	}
+	// One level only: deep.zip stays a plain file.
+	if ar.NestedFile("release/inner.zip!/deep.zip").Nested() != nil {
+		t.Error("WithNestedArchives(1) went two levels down")
+	}
+	// A member that only looks like an archive stays a file, with a warning.
+	if ar.File("release/bogus.zip").Nested() != nil || len(ar.Warnings()) != 1 {
+		t.Errorf("bogus member: nested %v, warnings %v", ar.File("release/bogus.zip").Nested(), ar.Warnings())
+	}
+	if ar.File("release/notes.txt").Children() != nil {
+		t.Error("plain file has children")
+	}
+
+	ar, err = GetArchiveInfo(bundle, WithNestedArchives(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if af = ar.NestedFile("release/inner.zip!/deep.zip!/bottom.txt"); af == nil {
+		t.Fatal("NestedFile() didn't reach two levels down")
+	}
+	if data, _ := af.GetBytes(); string(data) != "all the way down" {
+		t.Errorf("two levels down GetBytes() = %q", data)
+	}
+
+	// Limits hold inside members too: inner.zip is small, but zeros.bin
+	// inside it isn't.
+	_, err = GetArchiveInfo(bundle, WithNestedArchives(1), WithLimits(Limits{MaxFileSize: 100000}))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("nested with limits error = %v, want ErrLimitExceeded", err)
+	}
+}
@@ -0,0 +1,139 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/bodgit/sevenzip"
+)
+
+// Stream the i-th listed entry, for positional access alongside FileAt.
+// See ArchivedFile.Open.
+func (ai *ArchiveInfo) OpenAt(i int) (io.ReadCloser, error) {
+	af := ai.FileAt(i)
+	if af == nil {
+		return nil, fmt.Errorf("%s: entry %d of %d: %w", ai.fullname, i, len(ai.files), fs.ErrNotExist)
+	}
+	return af.Open()
+}
+
+// A reader over an entry that owns the handles beneath it.
+type entryReader struct {
+	io.Reader
+	closers []io.Closer // Innermost first
+}
+
+func (er *entryReader) Close() error {
+	var errs []error
+	for _, c := range er.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Stream the entry's decompressed content, for entries too big for
+// GetBytes.  Only the read buffers are held in memory, so the content can
+// be io.Copy'd to disk or a socket.  The caller must Close the reader,
+// which also closes the archive.  tar and RAR entries are reached by
+// reading through the ones before them.
+func (af *ArchivedFile) Open() (io.ReadCloser, error) {
+	if af.implied || af.isDir() {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	switch af.archivetype {
+	case ARCHIVE_ZIP:
+		return af.openZip()
+	case ARCHIVE_7Z:
+		return af.open7Z()
+	case ARCHIVE_TGZ, ARCHIVE_TAR, ARCHIVE_TBZ2, ARCHIVE_TXZ, ARCHIVE_TZST, ARCHIVE_TBR, ARCHIVE_TLZ4,
+		ARCHIVE_TZ, ARCHIVE_TLZ:
+		return af.openTar()
+	case ARCHIVE_GZ, ARCHIVE_BZ2, ARCHIVE_XZ, ARCHIVE_ZST, ARCHIVE_BR, ARCHIVE_LZ4, ARCHIVE_Z, ARCHIVE_LZ:
+		return af.openCompressed()
+	case ARCHIVE_RAR:
+		return af.openRar()
+	}
+	if h := optionalFormat(af.archivetype); h != nil {
+		readCloser, err := h.open(af)
+		if err != nil {
+			return nil, err
+		}
+		return &entryReader{af.wrapReader(readCloser), []io.Closer{readCloser}}, nil
+	}
+	return nil, fmt.Errorf("%s: %w", af.name, ErrUnsupportedFormat)
+}
+
+func (af *ArchivedFile) openZip() (io.ReadCloser, error) {
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	zipReader, err := newZipReader(src)
+	if err != nil {
+		src.Close()
+		return nil, openError(af.archivefile, err)
+	}
+	if af.index >= len(zipReader.File) {
+		src.Close()
+		return nil, fmt.Errorf("%s: %w", af.name, fs.ErrNotExist)
+	}
+	readCloser, err := openZipFile(zipReader.File[af.index], af.options().password)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return &entryReader{af.wrapReader(readCloser), []io.Closer{readCloser, src}}, nil
+}
+
+func (af *ArchivedFile) open7Z() (io.ReadCloser, error) {
+	if codec := unsupported7zCodec(af.method); af.method != "" && codec != "" {
+		return nil, fmt.Errorf("%s: %w: 7z codec %s", af.name, ErrUnsupportedFormat, codec)
+	}
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	zipReader, err := sevenzip.NewReaderWithPassword(src, src.size, af.options().password)
+	if err != nil {
+		src.Close()
+		return nil, openError(af.archivefile, err)
+	}
+	if af.index >= len(zipReader.File) {
+		src.Close()
+		return nil, fmt.Errorf("%s: %w", af.name, fs.ErrNotExist)
+	}
+	readCloser, err := zipReader.File[af.index].Open()
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("%s: %w", af.name, af.passwordError(err))
+	}
+	return &entryReader{af.wrapReader(&passwordErrReader{af, readCloser}), []io.Closer{readCloser, src}}, nil
+}
+
+func (af *ArchivedFile) openTar() (io.ReadCloser, error) {
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	content, closer, err := tarStream(af.archivetype, src.stream())
+	if err != nil {
+		src.Close()
+		return nil, openError(af.archivefile, err)
+	}
+	tarReader := newTarWalker(content, af.options().bestEffort, nil)
+	for i := 0; i <= af.index; i++ {
+		if _, err = tarReader.Next(); err != nil {
+			closer.Close()
+			src.Close()
+			return nil, openError(af.archivefile, err)
+		}
+	}
+	var body io.Reader = tarReader
+	if !af.mode.IsRegular() {
+		body = bytes.NewReader(nil)
+	}
+	return &entryReader{af.wrapReader(body), []io.Closer{closer, src}}, nil
+}
@@ -0,0 +1,81 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenAt(t *testing.T) {
+	for _, filename := range []string{"testassets/test.zip", "testassets/sz_test.7z", "testassets/tgz_test.tgz"} {
+		ar, err := GetArchiveInfo(filename)
+		if err != nil {
+			t.Fatalf("%s error = %v", filename, err)
+		}
+		for i := range ar.Files() {
+			af := ar.FileAt(i)
+			rc, err := ar.OpenAt(i)
+			if err != nil {
+				t.Fatalf("%s OpenAt(%d) error = %v", filename, i, err)
+			}
+			got, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("%s OpenAt(%d) read error = %v", filename, i, err)
+			}
+			if !af.mode.IsRegular() {
+				continue
+			}
+			want, err := ar.File(af.Name()).GetBytes()
+			if err != nil {
+				t.Fatalf("%s GetBytes(%s) error = %v", filename, af.Name(), err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s OpenAt(%d) content differs from GetBytes(%s)", filename, i, af.Name())
+			}
+		}
+		for _, i := range []int{-1, len(ar.Files())} {
+			if ar.FileAt(i) != nil {
+				t.Errorf("%s FileAt(%d) != nil", filename, i)
+			}
+			if _, err := ar.OpenAt(i); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s OpenAt(%d) error = %v, want fs.ErrNotExist", filename, i, err)
+			}
+		}
+	}
+}
+
+func TestArchivedFileOpen(t *testing.T) {
+	dir := t.TempDir()
+	big := strings.Repeat("0123456789abcdef", 1<<18) // 4 MiB
+	path := writeTestTgz(t, dir, "big.tgz", []testTarEntry{
+		{tar.Header{Name: "small.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "tiny"},
+		{tar.Header{Name: "big.bin", Typeflag: tar.TypeReg, Mode: 0o644}, big},
+	})
+	ar, err := GetArchiveInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := ar.File("big.bin").Open()
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	out, err := os.Create(filepath.Join(dir, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := io.Copy(out, rc)
+	out.Close()
+	if cerr := rc.Close(); err != nil || cerr != nil || n != int64(len(big)) {
+		t.Fatalf("io.Copy() = %d, %v, Close() = %v", n, err, cerr)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "big.bin")); string(got) != big {
+		t.Error("copied content differs")
+	}
+}
@@ -0,0 +1,145 @@
+package archiver
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+)
+
+// Option adjusts how an archive is read.  Pass any number to GetArchiveInfo.
+type Option func(*options)
+
+type options struct {
+	skipAppleMetadata bool              // Drop __MACOSX/ and AppleDouble "._" entries
+	validateOnOpen    bool              // Structural check during GetArchiveInfo
+	readTimeout       time.Duration     // Stall limit on each read of the archive, 0 = none
+	restoreAccessTime bool              // Extraction sets atime from the archive
+	stripBOM          bool              // GetString drops a leading UTF-8 BOM
+	bestEffort        bool              // List past damaged entries instead of failing
+	warnings          chan<- error      // Also receives what ArchiveInfo.Warnings collects
+	nameHint          string            // Archive name for GetArchiveInfoFromReader
+	idleTimeout       time.Duration     // Keep the file open between reads until idle this long, 0 = don't
+	sortedListing     bool              // Files sorted by name instead of archive order
+	password          string            // For encrypted entries; "" = none
+	limits            Limits            // Decompression bomb caps; zero = none
+	nested            int               // Levels of archives within archives to list
+	httpClient        *http.Client      // For OpenRemoteArchive; nil = http.DefaultClient
+	progress          ProgressFunc      // Listing and extraction progress; nil = none
+	lazyListing       bool              // Leave listing to Entries
+	nameEncoding      encoding.Encoding // Zip names not flagged UTF-8; nil = guess
+	packageContents   bool              // List a .deb's control and data tarballs too
+	impliedDirs       bool              // List the directories zip and tar entries imply
+}
+
+func buildOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Leave macOS Finder metadata out of the listing: anything under __MACOSX/
+// and AppleDouble "._name" resource-fork files.  Since extraction works from
+// the listing, they're skipped there too.  Off by default.
+func WithoutAppleMetadata() Option {
+	return func(o *options) { o.skipAppleMetadata = true }
+}
+
+// Reports whether an entry name is macOS metadata that WithoutAppleMetadata
+// would drop, for callers who want to keep the entries but filter themselves.
+func IsAppleMetadata(name string) bool {
+	name = strings.TrimSuffix(name, "/")
+	if name == "__MACOSX" || strings.HasPrefix(name, "__MACOSX/") {
+		return true
+	}
+	return strings.HasPrefix(path.Base(name), "._")
+}
+
+// Do a quick structural check while opening, so a damaged archive fails
+// GetArchiveInfo with ErrCorruptArchive instead of failing later in GetBytes.
+// Costs an extra pass over the headers, bar tar, which is checked as it's
+// listed, so it's off by default.
+func WithValidateOnOpen() Option {
+	return func(o *options) { o.validateOnOpen = true }
+}
+
+// Fail reads of the archive that bring nothing back for d with
+// ErrReadTimeout, so a stalled source, such as a hung network mount, a
+// remote archive whose server stops answering or a ForEachFromReader stream
+// that stops arriving, can't hold a caller forever.  Listing and entry
+// reads both count.  The stalled read itself can't be interrupted: it's
+// abandoned on a goroutine of its own, reads of that opening of the
+// archive fail from then on, and the file is only closed once the read
+// finishes.  A ForEachFromReader stream may still be in that read after the
+// call returns.
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) { o.readTimeout = d }
+}
+
+// Keep the archive file open between reads instead of reopening it for
+// each one, and close it once nothing has read from it for d.  The next
+// read opens it again, so a server holding many ArchiveInfos only pays for
+// the handles in use.  Off by default; ArchiveInfo.Close releases the
+// handle early.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) { o.idleTimeout = d }
+}
+
+// Set extracted files' access times from the archive where it records them,
+// rather than to the modification time.  Off by default, since restoring
+// an old atime can confuse tools that look for recently read files.
+func WithAccessTimes() Option {
+	return func(o *options) { o.restoreAccessTime = true }
+}
+
+// Have GetString drop a leading UTF-8 byte-order mark, as left by Windows
+// editors, so text compares and parses cleanly.  GetBytes is unaffected.
+func WithStripBOM() Option {
+	return func(o *options) { o.stripBOM = true }
+}
+
+// List what can be listed from a damaged archive instead of failing.  A tar
+// header that fails its checksum is skipped, and listing resumes at the
+// next good header; a stream that breaks off keeps the entries before the
+// break.  Each problem is recorded as an *EntryError in Warnings.  zip and
+// 7z list from a central directory that either parses or doesn't, so they
+// are unaffected.
+func WithBestEffort() Option {
+	return func(o *options) { o.bestEffort = true }
+}
+
+// Send warnings to ch as well as collecting them in Warnings, for callers
+// that want to report them as they happen.  Sends never block; if ch is
+// full the warning is only collected.
+func WithWarnings(ch chan<- error) Option {
+	return func(o *options) { o.warnings = ch }
+}
+
+// Name the archive for GetArchiveInfoFromReader, which has no file name to
+// go on, e.g. "upload.tar.gz" from a form field.  A brotli stream is only
+// recognised by its extension, so it needs one.  GetArchiveInfo ignores it.
+func WithNameHint(name string) Option {
+	return func(o *options) { o.nameHint = name }
+}
+
+// List entries sorted by name instead of in archive order (central
+// directory order for zip and 7z, stream order for tar), so tools that
+// handle several formats see the same order for the same content.  This
+// changes what Files, FileAt and OpenAt's positions refer to.  Entries
+// with the same name keep their archive order.  Off by default.
+func WithSortedListing() Option {
+	return func(o *options) { o.sortedListing = true }
+}
+
+// Decrypt encrypted entries with password: zip's traditional ZipCrypto and
+// WinZip AES, and 7z's AES.  Without it, reading an encrypted entry fails
+// with ErrEncrypted; with the wrong one, ErrWrongPassword.  Listing only
+// needs it for a 7z archive with an encrypted header (7-Zip's -mhe), and
+// ArchivedFile.Encrypted tells which entries will.
+func WithPassword(password string) Option {
+	return func(o *options) { o.password = password }
+}
@@ -0,0 +1,87 @@
+package archiver
+
+import (
+	"archive/tar"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestWithoutAppleMetadata(t *testing.T) {
+	testdata := []struct {
+		filename string
+		all      int
+		filtered int
+	}{{"testassets/macos.zip", 7, 3},
+		{"testassets/tgz_test.tgz", 4, 2},
+	}
+	for _, test := range testdata {
+		ar, err := GetArchiveInfo(test.filename)
+		if err != nil {
+			t.Fatalf("%s error = %v", test.filename, err)
+		}
+		if len(ar.Files()) != test.all {
+			t.Errorf("%s lists %d entries by default, want %d", test.filename, len(ar.Files()), test.all)
+		}
+		ar, err = GetArchiveInfo(test.filename, WithoutAppleMetadata())
+		if err != nil {
+			t.Fatalf("%s filtered error = %v", test.filename, err)
+		}
+		if len(ar.Files()) != test.filtered {
+			t.Errorf("%s lists %d entries filtered, want %d", test.filename, len(ar.Files()), test.filtered)
+		}
+		for _, f := range ar.Files() {
+			if IsAppleMetadata(f.Name()) {
+				t.Errorf("%s kept %s", test.filename, f.Name())
+			}
+		}
+	}
+
+	ar, _ := GetArchiveInfo("testassets/macos.zip", WithoutAppleMetadata())
+	if ar.File("photos/notes.txt") == nil || ar.File("photos/._index.txt") != nil {
+		t.Error("wrong entries filtered from macos.zip")
+	}
+}
+
+func TestWithSortedListing(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := writeTestZip(t, dir, "same.zip", [][2]string{
+		{"b/2.txt", "two"}, {"a.txt", "one"}, {"c.txt", "three"}, {"b/1.txt", "four"},
+	})
+	tgzPath := writeTestTgz(t, dir, "same.tgz", []testTarEntry{
+		{tar.Header{Name: "c.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "three"},
+		{tar.Header{Name: "b/1.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "four"},
+		{tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "one"},
+		{tar.Header{Name: "b/2.txt", Typeflag: tar.TypeReg, Mode: 0o644}, "two"},
+	})
+	want := []string{"a.txt", "b/1.txt", "b/2.txt", "c.txt"}
+	for _, path := range []string{zipPath, tgzPath} {
+		ar, err := GetArchiveInfo(path, WithSortedListing())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, af := range ar.Files() {
+			got = append(got, af.Name())
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s listing = %v, want %v", path, got, want)
+		}
+		// Content still comes from the right entry.
+		if data, err := ar.FileAt(1).GetBytes(); err != nil || string(data) != "four" {
+			t.Errorf("%s FileAt(1) = %q, %v", path, data, err)
+		}
+		seen := 0
+		err = ar.ForEach(func(af *ArchivedFile, r io.Reader) error {
+			data, err := io.ReadAll(r)
+			if want, _ := af.GetBytes(); string(data) != string(want) {
+				t.Errorf("%s ForEach(%s) = %q, want %q", path, af.Name(), data, want)
+			}
+			seen++
+			return err
+		})
+		if err != nil || seen != len(want) {
+			t.Errorf("%s ForEach() saw %d, error = %v", path, seen, err)
+		}
+	}
+}
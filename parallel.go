@@ -0,0 +1,160 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// An entry for ExtractFiles, with its place in the names asked for and its
+// name once stripped.
+type extractJob struct {
+	pos int
+	af  *ArchivedFile
+	rel string
+}
+
+// Extract the named entries under destDir, as ExtractAll does, with up to
+// concurrency of them decompressing at once (GOMAXPROCS if 0 or less).
+// Each zip entry is a job of its own.  A 7z solid block has to be
+// decompressed from its start to reach any file in it, so a block's files
+// go to one worker, in order, while blocks run in parallel; tar and RAR are
+// a single stream, read by a single worker.  Each worker reads through its
+// own Session.  Links are made after the rest, as WithLinkPolicy says.
+// Names are as File takes them; one that isn't in the archive fails with
+// fs.ErrNotExist.  Failures don't stop the rest; they are joined into the
+// returned error in the order of names.
+func (ai *ArchiveInfo) ExtractFiles(names []string, destDir string, concurrency int, opts ...ExtractOption) error {
+	eo := buildExtractOptions(opts)
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	errs := make([]error, len(names))
+	var jobs [][]extractJob
+	shared := make(map[int]int) // 7z folder, or -1 for a whole stream, to its job
+	var dirs, links []extractJob
+	var dirPaths []string
+	for i, name := range names {
+		af := ai.File(name)
+		if af == nil {
+			errs[i] = fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+			continue
+		}
+		rel, ok := eo.stripped(af.name)
+		if !ok || isRootName(rel) {
+			continue
+		}
+		if af.isDir() {
+			target, err := safeJoin(destDir, rel, eo.paths)
+			if err == nil {
+				err = mkdirUnder(destDir, target)
+				dirs, dirPaths = append(dirs, extractJob{i, af, rel}), append(dirPaths, target)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", af.name, err)
+			}
+			continue
+		}
+		if af.isLink() { // After the rest, so hardlink targets are there
+			links = append(links, extractJob{i, af, rel})
+			continue
+		}
+		key, grouped := af.streamKey()
+		if n, found := shared[key]; grouped && found {
+			jobs[n] = append(jobs[n], extractJob{i, af, rel})
+			continue
+		} else if grouped {
+			shared[key] = len(jobs)
+		}
+		jobs = append(jobs, []extractJob{{i, af, rel}})
+	}
+	for _, job := range jobs {
+		slices.SortFunc(job, func(a, b extractJob) int { return a.af.index - b.af.index })
+	}
+
+	work := make(chan []extractJob)
+	var wg sync.WaitGroup
+	for w := 0; w < min(concurrency, len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var s *Session
+			var openErr error
+			for job := range work {
+				if s == nil && openErr == nil {
+					s, openErr = ai.OpenSession()
+				}
+				for _, j := range job {
+					err := openErr
+					if err == nil {
+						err = s.extractEntry(j.af, destDir, j.rel, eo)
+					}
+					if err != nil {
+						errs[j.pos] = fmt.Errorf("%s: %w", j.af.name, err)
+					}
+				}
+			}
+			if s != nil {
+				s.Close()
+			}
+		}()
+	}
+	for _, job := range jobs {
+		work <- job
+	}
+	close(work)
+	wg.Wait()
+
+	for _, j := range links {
+		target, err := safeJoin(destDir, j.rel, eo.paths)
+		if err == nil {
+			err = j.af.writeLink(destDir, target, sameName, eo)
+		}
+		if err != nil {
+			errs[j.pos] = fmt.Errorf("%s: %w", j.af.name, err)
+		}
+	}
+
+	// Directory times last, as in ExtractAll.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if atime, mtime := dirs[i].af.extractTimes(eo); !mtime.IsZero() {
+			os.Chtimes(dirPaths[i], atime, mtime)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Which shared stream the entry's data is in, if it's in one: its 7z
+// solid block, or the whole archive for tar and RAR.
+func (af *ArchivedFile) streamKey() (int, bool) {
+	switch {
+	case af.archivetype == ARCHIVE_7Z:
+		return af.stream, af.stream >= 0
+	case isTarType(af.archivetype), af.archivetype == ARCHIVE_RAR:
+		return -1, true
+	}
+	return 0, false
+}
+
+// Write one non-directory entry at rel under destDir, read through s.
+func (s *Session) extractEntry(af *ArchivedFile, destDir, rel string, eo extractOptions) error {
+	target, err := safeJoin(destDir, rel, eo.paths)
+	if err != nil {
+		return err
+	}
+	switch {
+	case af.mode.IsRegular():
+		data, err := s.GetBytes(af.tracked(eo))
+		if err != nil {
+			return err
+		}
+		return af.writeData(destDir, target, data, eo)
+	case af.mode&fs.ModeDevice != 0 && eo.devices:
+		return af.makeDevice(destDir, target, eo)
+	}
+	return nil
+}
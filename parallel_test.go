@@ -0,0 +1,54 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractFiles(t *testing.T) {
+	for _, filename := range []string{"testassets/tree.zip", "testassets/sz_test.7z", "testassets/tgz_test.tgz", "testassets/test.rar"} {
+		t.Run(filepath.Base(filename), func(t *testing.T) {
+			ar, err := GetArchiveInfo(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, af := range ar.Files() {
+				if !af.isDir() && af.mode.IsRegular() {
+					names = append(names, af.Name())
+				}
+			}
+			dest := t.TempDir()
+			if err = ar.ExtractFiles(names, dest, 4); err != nil {
+				t.Fatalf("ExtractFiles() error = %v", err)
+			}
+			for _, name := range names {
+				want, err := ar.File(name).GetBytes()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+				if err != nil || !bytes.Equal(got, want) {
+					t.Errorf("%s: extracted %d bytes, %v; want %d", name, len(got), err, len(want))
+				}
+			}
+		})
+	}
+
+	ar, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	err = ar.ExtractFiles([]string{"missing.txt", "docs/guide.md"}, dest, 0)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ExtractFiles(missing) error = %v, want fs.ErrNotExist", err)
+	}
+	if got := listTree(t, dest); len(got) != 1 || got[0] != "docs/guide.md" {
+		t.Errorf("extracted %v, want [docs/guide.md]", got)
+	}
+}
@@ -0,0 +1,156 @@
+package archiver
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+// Just enough PKCS #7 to check a JAR signature block: SignedData with the
+// content detached, signed by one of its own certificates.
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+// The digests a signature can be over, by their OIDs.
+var pkcs7Digests = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, crypto.SHA1},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, crypto.SHA384},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, crypto.SHA512},
+}
+
+// The x509 algorithms a certificate's key signs a digest with.
+var pkcs7Algorithms = map[x509.PublicKeyAlgorithm]map[crypto.Hash]x509.SignatureAlgorithm{
+	x509.RSA: {crypto.SHA1: x509.SHA1WithRSA, crypto.SHA256: x509.SHA256WithRSA, crypto.SHA384: x509.SHA384WithRSA,
+		crypto.SHA512: x509.SHA512WithRSA},
+	x509.ECDSA: {crypto.SHA1: x509.ECDSAWithSHA1, crypto.SHA256: x509.ECDSAWithSHA256,
+		crypto.SHA384: x509.ECDSAWithSHA384, crypto.SHA512: x509.ECDSAWithSHA512},
+}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue     `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue     `asn1:"optional,tag:1"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	IssuerAndSerial           pkcs7IssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// Check that block signs content, returning the certificates it carries
+// with the signer's first.  Only the signature is checked, not whether
+// the certificate is to be trusted.
+func verifyPKCS7(block, content []byte) ([]*x509.Certificate, error) {
+	var info pkcs7ContentInfo
+	if rest, err := asn1.Unmarshal(block, &info); err != nil || len(rest) > 0 || !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("%w: signature block isn't PKCS #7 signed data", ErrCorruptArchive)
+	}
+	var signed pkcs7SignedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &signed); err != nil {
+		return nil, fmt.Errorf("%w: signature block: %w", ErrCorruptArchive, err)
+	}
+	certs, err := x509.ParseCertificates(signed.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature block certificates: %w", ErrCorruptArchive, err)
+	}
+	if len(signed.SignerInfos) == 0 {
+		return nil, fmt.Errorf("%w: signature block has no signer", ErrBadSignature)
+	}
+	signer := signed.SignerInfos[0]
+	var cert *x509.Certificate
+	for i, c := range certs {
+		if bytes.Equal(c.RawIssuer, signer.IssuerAndSerial.Issuer.FullBytes) && c.SerialNumber.Cmp(signer.IssuerAndSerial.Serial) == 0 {
+			cert = c
+			certs[0], certs[i] = certs[i], certs[0]
+			break
+		}
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("%w: signer's certificate isn't in the signature block", ErrBadSignature)
+	}
+	var digest crypto.Hash
+	for _, d := range pkcs7Digests {
+		if d.oid.Equal(signer.DigestAlgorithm.Algorithm) {
+			digest = d.hash
+		}
+	}
+	algorithm, ok := pkcs7Algorithms[cert.PublicKeyAlgorithm][digest]
+	if !ok {
+		return nil, fmt.Errorf("%w: signature algorithm %v with digest %v", ErrUnsupportedFormat,
+			cert.PublicKeyAlgorithm, signer.DigestAlgorithm.Algorithm)
+	}
+
+	// With attributes, the signature is over them, and they hold the
+	// content's digest.  They're signed as a SET, not with the [0] they're
+	// tagged with here.
+	if attrs := signer.AuthenticatedAttributes.FullBytes; len(attrs) > 0 {
+		want, err := pkcs7MessageDigest(signer.AuthenticatedAttributes.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		h := digest.New()
+		h.Write(content)
+		if !bytes.Equal(h.Sum(nil), want) {
+			return nil, fmt.Errorf("%w: signed digest doesn't match the signature file", ErrBadSignature)
+		}
+		content = append([]byte{0x31}, attrs[1:]...)
+	}
+	if err := cert.CheckSignature(algorithm, content, signer.EncryptedDigest); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadSignature, err)
+	}
+	return certs, nil
+}
+
+// The messageDigest among a signer's attributes.
+func pkcs7MessageDigest(attrs []byte) ([]byte, error) {
+	for len(attrs) > 0 {
+		var attr pkcs7Attribute
+		rest, err := asn1.Unmarshal(attrs, &attr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: signed attributes: %w", ErrCorruptArchive, err)
+		}
+		if attr.Type.Equal(oidMessageDigest) {
+			var digest []byte
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &digest); err != nil {
+				return nil, fmt.Errorf("%w: message digest: %w", ErrCorruptArchive, err)
+			}
+			return digest, nil
+		}
+		attrs = rest
+	}
+	return nil, fmt.Errorf("%w: signed attributes have no message digest", ErrBadSignature)
+}
@@ -0,0 +1,65 @@
+package archiver
+
+import "strings"
+
+// The top-level directory every entry is under, with a trailing "/", as in
+// "project-1.2.3/" for a source tarball; "" if the entries don't share one.
+// A leading "./" or "/" isn't part of it, and entries naming the root don't
+// count.  An archive holding a single file has no common prefix.
+func (ai *ArchiveInfo) CommonPrefix() string {
+	prefix, nested := "", false
+	for i := range ai.files {
+		elems := nameElements(ai.files[i].name)
+		if len(elems) == 0 {
+			continue
+		}
+		if prefix != "" && elems[0] != prefix {
+			return ""
+		}
+		prefix = elems[0]
+		nested = nested || len(elems) > 1 || ai.files[i].isDir()
+	}
+	if !nested {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// Drop the first n elements of each entry's path as it's extracted, as tar
+// --strip-components does, so StripComponents(1) unpacks
+// "project-1.2.3/src/main.go" as "src/main.go".  "." elements don't count.
+// Entries with n elements or fewer, such as the "project-1.2.3/" directory
+// itself, are skipped, and hardlink targets are stripped the same way.  For
+// ExtractAll, ExtractSubtree (after the prefix comes off), ExtractMatching,
+// ExtractAllWith, ExtractFiles and ExtractAllToTarWriter.
+func StripComponents(n int) ExtractOption {
+	return func(eo *extractOptions) { eo.strip = max(n, 0) }
+}
+
+// name with eo.strip leading elements taken off, or false if that leaves
+// nothing.
+func (eo extractOptions) stripped(name string) (string, bool) {
+	if eo.strip == 0 {
+		return name, true
+	}
+	elems := nameElements(name)
+	if len(elems) <= eo.strip {
+		return "", false
+	}
+	rest := strings.Join(elems[eo.strip:], "/")
+	if strings.HasSuffix(name, "/") {
+		rest += "/"
+	}
+	return rest, true
+}
+
+// The path elements of an entry name, leaving out empty and "." ones.
+func nameElements(name string) []string {
+	var elems []string
+	for _, elem := range strings.Split(name, "/") {
+		if elem != "" && elem != "." {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
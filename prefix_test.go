@@ -0,0 +1,139 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommonPrefix(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"project-1.2.3/", "project-1.2.3/src/main.go", "project-1.2.3/README"}, "project-1.2.3/"},
+		{[]string{"./", "./project/a.txt", "./project/b/c.txt"}, "project/"},
+		{[]string{"project/a.txt", "project/b/c.txt"}, "project/"},
+		{[]string{"empty/"}, "empty/"},
+		{[]string{"project/a.txt", "other/b.txt"}, ""},
+		{[]string{"project/a.txt", "README"}, ""},
+		{[]string{"README"}, ""},
+		{nil, ""},
+	} {
+		var entries []testTarEntry
+		for _, name := range c.names {
+			head := tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644}
+			if strings.HasSuffix(name, "/") {
+				head.Typeflag, head.Mode = tar.TypeDir, 0o755
+			}
+			entries = append(entries, testTarEntry{head, ""})
+		}
+		ai, err := GetArchiveInfo(writeTestTgz(t, dir, "prefix.tgz", entries))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ai.CommonPrefix(); got != c.want {
+			t.Errorf("%q: CommonPrefix is %q, want %q", c.names, got, c.want)
+		}
+	}
+}
+
+func TestStripComponents(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestTgz(t, dir, "project.tgz", []testTarEntry{
+		{tar.Header{Name: "./project-1.2.3/", Typeflag: tar.TypeDir, Mode: 0o755}, ""},
+		{tar.Header{Name: "./project-1.2.3/README", Typeflag: tar.TypeReg, Mode: 0o644}, "readme"},
+		{tar.Header{Name: "./project-1.2.3/src/", Typeflag: tar.TypeDir, Mode: 0o755}, ""},
+		{tar.Header{Name: "./project-1.2.3/src/main.go", Typeflag: tar.TypeReg, Mode: 0o644}, "package main"},
+		{tar.Header{Name: "./project-1.2.3/src/link.go", Typeflag: tar.TypeLink, Linkname: "./project-1.2.3/src/main.go"}, ""},
+	})
+	ai, err := GetArchiveInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(dir, "one")
+	if err := ai.ExtractAll(dest, StripComponents(1), WithLinkPolicy(MaterializeLinks)); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"README": "readme", "src/main.go": "package main", "src/link.go": "package main"} {
+		if got, err := os.ReadFile(filepath.Join(dest, name)); err != nil || string(got) != want {
+			t.Errorf("%s: read %q, %v", name, got, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "project-1.2.3")); !os.IsNotExist(err) {
+		t.Errorf("wrapper directory extracted: %v", err)
+	}
+
+	dest = filepath.Join(dir, "two")
+	if err := ai.ExtractAll(dest, StripComponents(2)); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := os.ReadDir(dest); err != nil || len(entries) != 1 || entries[0].Name() != "main.go" {
+		t.Errorf("stripping two left %v, %v", entries, err)
+	}
+
+	dest = filepath.Join(dir, "subtree")
+	if err := ai.ExtractSubtree("./project-1.2.3", dest, StripComponents(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "main.go")); err != nil {
+		t.Errorf("subtree: %v", err)
+	}
+
+	var created []string
+	err = ai.ExtractAllWith(func(name string, mode fs.FileMode) (io.WriteCloser, error) {
+		created = append(created, name)
+		return &memFile{mode: mode}, nil
+	}, StripComponents(1))
+	if err != nil || strings.Join(created, " ") != "README src/main.go" {
+		t.Errorf("ExtractAllWith created %q, %v", created, err)
+	}
+}
+
+func TestStripComponentsFilesAndTar(t *testing.T) {
+	ai, err := GetArchiveInfo(writeTestTgz(t, t.TempDir(), "project.tgz", []testTarEntry{
+		{tar.Header{Name: "project-1.2.3/", Typeflag: tar.TypeDir, Mode: 0o755}, ""},
+		{tar.Header{Name: "project-1.2.3/README", Typeflag: tar.TypeReg, Mode: 0o644}, "readme"},
+		{tar.Header{Name: "project-1.2.3/src/", Typeflag: tar.TypeDir, Mode: 0o755}, ""},
+		{tar.Header{Name: "project-1.2.3/src/main.go", Typeflag: tar.TypeReg, Mode: 0o644}, "package main"},
+		{tar.Header{Name: "project-1.2.3/src/link.go", Typeflag: tar.TypeLink, Linkname: "project-1.2.3/src/main.go"}, ""},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	names := []string{"project-1.2.3/", "project-1.2.3/README", "project-1.2.3/src/", "project-1.2.3/src/main.go", "project-1.2.3/src/link.go"}
+	if err := ai.ExtractFiles(names, dest, 2, StripComponents(1), WithLinkPolicy(MaterializeLinks)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(listTree(t, dest), " "); got != "README src/link.go src/main.go" {
+		t.Errorf("ExtractFiles extracted %q", got)
+	}
+	main, _ := os.Stat(filepath.Join(dest, "src/main.go"))
+	if link, err := os.Lstat(filepath.Join(dest, "src/link.go")); err != nil || !os.SameFile(main, link) {
+		t.Errorf("src/link.go isn't a hardlink to src/main.go: %v", err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := ai.ExtractAllToTarWriter(tw, StripComponents(1)); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	var got []string
+	tr := tar.NewReader(&buf)
+	for head, err := tr.Next(); err == nil; head, err = tr.Next() {
+		got = append(got, head.Name+">"+head.Linkname)
+	}
+	if strings.Join(got, " ") != "README> src/> src/main.go> src/link.go>src/main.go" {
+		t.Errorf("ExtractAllToTarWriter wrote %q", got)
+	}
+}
@@ -0,0 +1,97 @@
+package archiver
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Told how far a listing or an extraction has got.  See WithProgress.
+type ProgressFunc func(entry string, bytesDone, bytesTotal int64)
+
+// Call fn as the archive is listed and as it's extracted, for progress
+// bars.  While GetArchiveInfo lists, fn gets each entry as it's found,
+// with the archive bytes read so far and the archive's size: for tar, RAR
+// and gzip that's how far through the stream the listing is, while zip and
+// 7z read their directory in one go near the end.  ExtractAll,
+// ExtractSubtree, ExtractAllWith, ExtractFiles and ExtractAllToTarWriter
+// call it for each file as they start on it, with 0 done, then as its data
+// is read, ending with bytesDone at bytesTotal, the entry's size (-1 for a
+// gzip member whose size isn't known).  fn runs on the goroutine doing the
+// work, several at once under ExtractFiles, and should return quickly.
+func WithProgress(fn ProgressFunc) Option {
+	return func(o *options) { o.progress = fn }
+}
+
+// Furthest offset read from the archive while listing.
+type readTracker struct {
+	src      io.ReaderAt
+	furthest *atomic.Int64
+}
+
+func (rt readTracker) ReadAt(p []byte, off int64) (int, error) {
+	n, err := rt.src.ReadAt(p, off)
+	for end := off + int64(n); ; {
+		seen := rt.furthest.Load()
+		if end <= seen || rt.furthest.CompareAndSwap(seen, end) {
+			break
+		}
+	}
+	return n, err
+}
+
+// Report a newly listed entry.
+func (ar *ArchiveInfo) listProgress(af *ArchivedFile) {
+	if ar.opts.progress != nil && ar.listed != nil {
+		ar.opts.progress(af.name, ar.listed.Load(), ar.size)
+	}
+}
+
+// The entry, set for the extraction eo belongs to: to report its reads
+// under WithProgress, having reported that it's starting, and to count them
+// into the extraction's total under MaxTotalSize.  af itself if there's
+// neither.
+func (af *ArchivedFile) tracked(eo extractOptions) *ArchivedFile {
+	fn := af.options().progress
+	limited := af.options().limits.MaxTotalSize > 0 && eo.total != nil
+	if fn == nil && !limited {
+		return af
+	}
+	if fn != nil {
+		fn(af.name, 0, af.size)
+	}
+	reader := *af
+	reader.progress = fn
+	if limited {
+		reader.extracted = eo.total
+	}
+	return &reader
+}
+
+// r, reporting to the entry's progress callback and counting into its
+// extraction's total, as tracked set them.
+func (af *ArchivedFile) withTracking(r io.Reader) io.Reader {
+	if af.extracted != nil {
+		r = &totalReader{r: r, name: af.name, total: af.extracted, max: af.options().limits.MaxTotalSize}
+	}
+	if af.progress == nil {
+		return r
+	}
+	return &progressReader{r: r, fn: af.progress, name: af.name, total: af.size}
+}
+
+type progressReader struct {
+	r     io.Reader
+	fn    ProgressFunc
+	name  string
+	done  int64
+	total int64
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.done += int64(n)
+		pr.fn(pr.name, pr.done, pr.total)
+	}
+	return n, err
+}
@@ -0,0 +1,81 @@
+package archiver
+
+import (
+	"sync"
+	"testing"
+)
+
+type progressEvent struct {
+	entry       string
+	done, total int64
+}
+
+type progressLog struct {
+	mu     sync.Mutex
+	events []progressEvent
+}
+
+func (pl *progressLog) record(entry string, done, total int64) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.events = append(pl.events, progressEvent{entry, done, total})
+}
+
+// The last event for each entry.
+func (pl *progressLog) last() map[string]progressEvent {
+	last := make(map[string]progressEvent)
+	for _, e := range pl.events {
+		last[e.entry] = e
+	}
+	return last
+}
+
+func TestWithProgress(t *testing.T) {
+	for _, filename := range []string{"testassets/tgz_test.tgz", "testassets/test.zip", "testassets/sz_test.7z"} {
+		t.Run(filename, func(t *testing.T) {
+			log := &progressLog{}
+			ar, err := GetArchiveInfo(filename, WithProgress(log.record))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(log.events) != len(ar.Files()) {
+				t.Errorf("listing reported %d entries, want %d", len(log.events), len(ar.Files()))
+			}
+			var prev int64
+			for _, e := range log.events {
+				if e.total != ar.Size() || e.done < prev || e.done > e.total || e.done == 0 {
+					t.Errorf("listing event %+v after %d, archive size %d", e, prev, ar.Size())
+				}
+				prev = e.done
+			}
+
+			for _, extract := range []struct {
+				name string
+				run  func(dest string) error
+			}{
+				{"ExtractAll", func(dest string) error { return ar.ExtractAll(dest) }},
+				{"ExtractFiles", func(dest string) error {
+					var names []string
+					for _, af := range ar.Files() {
+						names = append(names, af.Name())
+					}
+					return ar.ExtractFiles(names, dest, 4)
+				}},
+			} {
+				log.events = nil
+				if err = extract.run(t.TempDir()); err != nil {
+					t.Fatalf("%s() error = %v", extract.name, err)
+				}
+				last := log.last()
+				for _, af := range ar.Files() {
+					if af.isDir() || !af.mode.IsRegular() {
+						continue
+					}
+					if e, found := last[af.Name()]; !found || e.done != af.Size() || e.total != af.Size() {
+						t.Errorf("%s: %s last reported %+v, want %d of %d", extract.name, af.Name(), e, af.Size(), af.Size())
+					}
+				}
+			}
+		})
+	}
+}
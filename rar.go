@@ -0,0 +1,126 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/nwaples/rardecode/v2"
+)
+
+// RAR 4 and RAR 5 archives, single-volume.  Like tar, the entries follow
+// one another in a single stream, so reaching one means reading through
+// those before it.
+
+var (
+	rar4Magic = []byte{0x52, 0x61, 0x72, 0x21, 0x1A, 0x07, 0x00}
+	rar5Magic = []byte{0x52, 0x61, 0x72, 0x21, 0x1A, 0x07, 0x01, 0x00}
+)
+
+// Map rardecode's failures onto the package's sentinels.
+func rarError(path string, err error) error {
+	switch {
+	case errors.Is(err, rardecode.ErrArchiveEncrypted), errors.Is(err, rardecode.ErrArchivedFileEncrypted):
+		return fmt.Errorf("%s: %w", path, ErrEncrypted)
+	case errors.Is(err, rardecode.ErrMultiVolume):
+		return fmt.Errorf("%s: %w: multi-volume rar", path, ErrUnsupportedFormat)
+	}
+	return openError(path, err)
+}
+
+func (ar *ArchiveInfo) loadFilesInRarArchive() error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	rarReader, err := rardecode.NewReader(src.stream())
+	if err != nil {
+		return rarError(ar.fullname, err)
+	}
+	for i := 0; ; i++ {
+		head, err := rarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return rarError(ar.fullname, err)
+		}
+		if err = ar.addFile(ar.rarEntry(head, i)); err != nil {
+			return err
+		}
+	}
+}
+
+// The listing entry for the index-th RAR header.
+func (ar *ArchiveInfo) rarEntry(head *rardecode.FileHeader, index int) ArchivedFile {
+	return ArchivedFile{archivefile: ar.fullname, archivetype: ARCHIVE_RAR, name: head.Name,
+		size: head.UnPackedSize, IsDir: head.IsDir, mode: head.Mode(), modTime: head.ModificationTime,
+		accessTime: head.AccessTime, createTime: head.CreationTime, packed: head.PackedSize, index: index}
+}
+
+func (af *ArchivedFile) openRar() (io.ReadCloser, error) {
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	rarReader, err := rardecode.NewReader(src.stream())
+	if err != nil {
+		src.Close()
+		return nil, rarError(af.archivefile, err)
+	}
+	for i := 0; i <= af.index; i++ {
+		if _, err = rarReader.Next(); err == io.EOF {
+			src.Close()
+			return nil, fmt.Errorf("%s: %w", af.name, fs.ErrNotExist)
+		} else if err != nil {
+			src.Close()
+			return nil, rarError(af.archivefile, err)
+		}
+	}
+	return &entryReader{af.wrapReader(&rarEntryReader{rarReader, af.archivefile}), []io.Closer{src}}, nil
+}
+
+// Reports encrypted content as ErrEncrypted, which rardecode only finds
+// out on the first Read.
+type rarEntryReader struct {
+	r    io.Reader
+	path string
+}
+
+func (rr *rarEntryReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if errors.Is(err, rardecode.ErrArchivedFileEncrypted) {
+		err = rarError(rr.path, err)
+	}
+	return n, err
+}
+
+func (ai *ArchiveInfo) forEachRar(fn func(*ArchivedFile, io.Reader) error) error {
+	src, err := ai.openSource()
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	defer src.Close()
+	rarReader, err := rardecode.NewReader(src.stream())
+	if err != nil {
+		return rarError(ai.fullname, err)
+	}
+	order := ai.archiveOrder()
+	next := 0
+	for i := 0; next < len(order); i++ {
+		if _, err = rarReader.Next(); err != nil {
+			return rarError(ai.fullname, err)
+		}
+		af := order[next]
+		if af.index != i {
+			continue
+		}
+		next++
+		if err = fn(af, af.wrapReader(&rarEntryReader{rarReader, ai.fullname})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package archiver
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRarArchive(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/test.rar")
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	if !ar.ExtensionMatchesType() {
+		t.Error("ExtensionMatchesType() = false")
+	}
+	if af := ar.File("docs"); af == nil || !af.IsDir || !af.Mode().IsDir() {
+		t.Errorf("docs = %v, want a directory", af)
+	}
+	af := ar.File("notes.txt")
+	if af.Size() != 10 || af.Mode().Perm() != 0o600 {
+		t.Errorf("notes.txt size %d mode %v", af.Size(), af.Mode())
+	}
+	// RAR 4 keeps DOS times, in no particular zone.
+	if want := time.Date(2023, 12, 24, 18, 30, 10, 0, time.Local); !af.ModTime().Equal(want) {
+		t.Errorf("notes.txt ModTime() = %v, want %v", af.ModTime(), want)
+	}
+
+	// Positional opens read through the earlier entries.
+	rc, err := ar.OpenAt(2)
+	if err != nil {
+		t.Fatalf("OpenAt(2) error = %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "RAR notes\n" {
+		t.Errorf("OpenAt(2) = %q", data)
+	}
+	contents := map[string]string{}
+	err = ar.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		contents[af.Name()] = string(data)
+		return err
+	})
+	if err != nil || len(contents) != 3 || contents["docs/readme.txt"] != "Read me first.\nThen the rest.\n" {
+		t.Errorf("ForEach() = %q, %v", contents, err)
+	}
+	if errs := ar.VerifyAll(2); len(errs) != 0 {
+		t.Errorf("VerifyAll() = %v", errs)
+	}
+
+	// RAR 5 is recognised by its own signature.
+	if got := DetectType([]byte("Rar!\x1A\x07\x01\x00")); got != ARCHIVE_RAR {
+		t.Errorf("DetectType(RAR 5) = %v", got)
+	}
+}
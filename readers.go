@@ -0,0 +1,180 @@
+package archiver
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// Options the entry belongs to.  Hand-built entries have none.
+func (af *ArchivedFile) options() options {
+	if af.archive == nil {
+		return options{}
+	}
+	return af.archive.opts
+}
+
+// Apply the per-read options to an entry's data stream.
+func (af *ArchivedFile) wrapReader(r io.Reader) io.Reader {
+	if max := af.options().limits.sizeCap(); max >= 0 {
+		if af.size >= 0 {
+			max = min(max, af.size)
+		}
+		r = &limitReader{r: r, name: af.name, left: max, max: max}
+	}
+	return af.withTracking(r)
+}
+
+// Makes reads on a goroutine of its own, into a buffer of its own, and
+// gives up on one that brings nothing back within timeout.  The stalled
+// read can't be interrupted, so it's left to finish there while the caller
+// gets ErrReadTimeout, as does every read after it.  Only the reader the
+// guard wraps is touched by that goroutine: whatever was decoding its
+// output, on the caller's side, is left alone.
+type stallGuard struct {
+	timeout time.Duration
+	mu      sync.Mutex  // One read at a time
+	reads   chan func() // To the goroutine; nil until the first read
+	exited  chan error  // What closer gave, as the goroutine exits
+	closer  io.Closer   // For the goroutine to close once stopped
+	buf     []byte
+	err     error // Sticky once timed out
+	stopped bool
+}
+
+type timedRead struct {
+	n   int
+	err error
+}
+
+// Read into p with read, on the guard's goroutine.
+func (g *stallGuard) do(p []byte, read func(buf []byte) (int, error)) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return 0, g.err
+	}
+	if g.stopped {
+		return 0, fs.ErrClosed
+	}
+	if g.reads == nil {
+		g.reads, g.exited = make(chan func()), make(chan error, 1)
+		go g.run()
+	}
+	if cap(g.buf) < len(p) {
+		g.buf = make([]byte, len(p))
+	}
+	buf := g.buf[:len(p)]
+	done := make(chan timedRead, 1)
+	g.reads <- func() {
+		n, err := read(buf)
+		done <- timedRead{n, err}
+	}
+	timer := time.NewTimer(g.timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		copy(p, buf[:res.n])
+		return res.n, res.err
+	case <-timer.C:
+		g.buf = nil // Still owned by the stalled read
+		g.err = fmt.Errorf("%w: no data for %v", ErrReadTimeout, g.timeout)
+		return 0, g.err
+	}
+}
+
+// The guard's goroutine: reads as they come, then the close stop asked for.
+func (g *stallGuard) run() {
+	for read := range g.reads {
+		read()
+	}
+	g.exited <- closeIf(g.closer)
+}
+
+// Stop the goroutine, then close closer, which may be nil, once no read is
+// running.  closer's error comes back unless a read had stalled; then the
+// close waits for it to finish, and stop returns nil at once.
+func (g *stallGuard) stop(closer io.Closer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stopped {
+		return nil
+	}
+	g.stopped = true
+	if g.reads == nil {
+		return closeIf(closer)
+	}
+	g.closer = closer
+	close(g.reads)
+	if g.err != nil {
+		return nil
+	}
+	return <-g.exited
+}
+
+func closeIf(closer io.Closer) error {
+	if closer == nil {
+		return nil
+	}
+	return closer.Close()
+}
+
+// Explain a failure reading an encrypted 7z entry: ErrEncrypted with no
+// password, ErrWrongPassword with one.  sevenzip can't tell a wrong key
+// from damage, so any failure counts.
+func (af *ArchivedFile) passwordError(err error) error {
+	if err == nil || err == io.EOF || !af.encrypted || af.archivetype != ARCHIVE_7Z {
+		return err
+	}
+	if af.options().password == "" {
+		return fmt.Errorf("%w: %w", ErrEncrypted, err)
+	}
+	return fmt.Errorf("%w: %w", ErrWrongPassword, err)
+}
+
+// Applies passwordError to every Read.
+type passwordErrReader struct {
+	af *ArchivedFile
+	r  io.Reader
+}
+
+func (pr *passwordErrReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	return n, pr.af.passwordError(err)
+}
+
+// An io.Reader under WithReadTimeout, for a stream such as
+// ForEachFromReader's.  stop it when done with it.
+type timeoutReader struct {
+	r io.Reader
+	stallGuard
+}
+
+func newTimeoutReader(r io.Reader, timeout time.Duration) *timeoutReader {
+	return &timeoutReader{r: r, stallGuard: stallGuard{timeout: timeout}}
+}
+
+func (tr *timeoutReader) Read(p []byte) (int, error) { return tr.do(p, tr.r.Read) }
+
+// An archive's source under WithReadTimeout.  Closing it closes the
+// underlying source once no read of it is running.
+type timeoutReaderAt struct {
+	r      io.ReaderAt
+	closer io.Closer
+	stallGuard
+}
+
+func (tr *timeoutReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return tr.do(p, func(buf []byte) (int, error) { return tr.r.ReadAt(buf, off) })
+}
+
+func (tr *timeoutReaderAt) Close() error { return tr.stop(tr.closer) }
+
+// The source with reads that fail with ErrReadTimeout once one stalls for
+// timeout.
+func (s source) withTimeout(timeout time.Duration) source {
+	tr := &timeoutReaderAt{r: s.ReaderAt, closer: s.Closer, stallGuard: stallGuard{timeout: timeout}}
+	return source{tr, tr, s.size}
+}
@@ -0,0 +1,153 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Hands out one byte per Read, after a delay.
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.r.Read(p[:min(len(p), 1)])
+}
+
+func TestTimeoutReader(t *testing.T) {
+	slow := &slowReader{strings.NewReader("stalled"), 500 * time.Millisecond}
+	tr := newTimeoutReader(slow, 20*time.Millisecond)
+	defer tr.stop(nil)
+	start := time.Now()
+	_, err := io.ReadAll(tr)
+	if !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("slow read error = %v, want ErrReadTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("timeout took %v", elapsed)
+	}
+	if _, err = tr.Read(make([]byte, 4)); !errors.Is(err, ErrReadTimeout) {
+		t.Errorf("read after timeout = %v, want sticky ErrReadTimeout", err)
+	}
+
+	// Steady progress never trips it, however long the whole read takes.
+	steady := &slowReader{strings.NewReader("steady"), 5 * time.Millisecond}
+	steadyReader := newTimeoutReader(steady, 200*time.Millisecond)
+	data, err := io.ReadAll(steadyReader)
+	if err != nil || string(data) != "steady" {
+		t.Errorf("steady read = %q, %v", data, err)
+	}
+	if err := steadyReader.stop(nil); err != nil {
+		t.Errorf("stop: %v", err)
+	}
+
+	ar, err := GetArchiveInfo("testassets/tgz_test.tgz", WithReadTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = ar.File("random_text.txt").GetBytes(); err != nil || !strings.Contains(string(data), "vulputate") {
+		t.Errorf("GetBytes() with timeout = %v", err)
+	}
+}
+
+// An archive in memory whose reads hang once stall is set, until release
+// is closed.  Counts closes, and reads running when it's closed.
+type stallingReaderAt struct {
+	r       *bytes.Reader
+	stall   atomic.Bool
+	release chan struct{}
+	running atomic.Int32
+	closes  atomic.Int32
+	racing  atomic.Bool
+}
+
+func (sr *stallingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	sr.running.Add(1)
+	defer sr.running.Add(-1)
+	if sr.stall.Load() {
+		<-sr.release
+	}
+	return sr.r.ReadAt(p, off)
+}
+
+func (sr *stallingReaderAt) Close() error {
+	sr.racing.Store(sr.racing.Load() || sr.running.Load() > 0)
+	sr.closes.Add(1)
+	return nil
+}
+
+// A stalled read of the source times out without the decompressor or the
+// source being closed under it.
+func TestReadTimeoutSource(t *testing.T) {
+	for _, name := range []string{"testassets/tgz_test.tgz", "testassets/tree.zip"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sr := &stallingReaderAt{r: bytes.NewReader(data), release: make(chan struct{})}
+		ai, err := GetArchiveInfoFromReader(sr, int64(len(data)), WithReadTimeout(50*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sr.stall.Store(true)
+		var entry *ArchivedFile
+		for i := range ai.Files() {
+			if af := &ai.Files()[i]; !af.IsDir && af.Size() > 0 {
+				entry = af
+				break
+			}
+		}
+		start := time.Now()
+		if _, err := entry.GetBytes(); !errors.Is(err, ErrReadTimeout) {
+			t.Errorf("%s: GetBytes() = %v, want ErrReadTimeout", name, err)
+		}
+		err = ai.ForEach(func(af *ArchivedFile, r io.Reader) error {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		})
+		if !errors.Is(err, ErrReadTimeout) {
+			t.Errorf("%s: ForEach() = %v, want ErrReadTimeout", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: timeouts took %v", name, elapsed)
+		}
+		close(sr.release)
+	}
+
+	// The source is closed once the stalled read is done, not under it.
+	sr := &stallingReaderAt{r: bytes.NewReader([]byte("data")), release: make(chan struct{})}
+	src := source{sr, sr, 4}.withTimeout(20 * time.Millisecond)
+	if _, err := src.ReadAt(make([]byte, 4), 0); err != nil {
+		t.Fatal(err)
+	}
+	sr.stall.Store(true)
+	if _, err := src.ReadAt(make([]byte, 4), 0); !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("stalled ReadAt = %v, want ErrReadTimeout", err)
+	}
+	if err := src.Close(); err != nil || sr.closes.Load() != 0 {
+		t.Fatalf("Close() = %v with %d closes while stalled", err, sr.closes.Load())
+	}
+	close(sr.release)
+	for deadline := time.Now().Add(time.Second); sr.closes.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if sr.closes.Load() != 1 || sr.racing.Load() {
+		t.Errorf("%d closes, racing %v", sr.closes.Load(), sr.racing.Load())
+	}
+	unstalled := &stallingReaderAt{r: bytes.NewReader([]byte("data"))}
+	src = source{unstalled, unstalled, 4}.withTimeout(time.Second)
+	if _, err := src.ReadAt(make([]byte, 4), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Close(); err != nil || unstalled.closes.Load() != 1 {
+		t.Errorf("unstalled Close() = %v, %d closes", err, unstalled.closes.Load())
+	}
+}
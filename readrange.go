@@ -0,0 +1,66 @@
+package archiver
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+)
+
+// Read length bytes of the entry's content from off, for previewing part
+// of a large file.  A range running past the end of the entry is cut
+// short.  Stored zip entries are read in place, but anything compressed is
+// decompressed from the start and thrown away up to off, so the cost
+// grows with off as well as length.
+func (af *ArchivedFile) ReadRange(off, length int64) ([]byte, error) {
+	if off < 0 || length < 0 {
+		return nil, fmt.Errorf("%s: invalid range %d+%d", af.name, off, length)
+	}
+	if err := af.checkSize(); err != nil {
+		return nil, err
+	}
+	off = min(off, af.size)
+	length = min(length, af.size-off)
+	buffer := make([]byte, length)
+	if af.archivetype == ARCHIVE_ZIP {
+		if done, err := af.readStoredZipRange(off, buffer); done {
+			return buffer, err
+		}
+	}
+	readCloser, err := af.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer readCloser.Close()
+	if _, err = io.CopyN(io.Discard, readCloser, off); err == io.EOF {
+		return nil, fmt.Errorf("%s: %w: %w", af.name, ErrSizeMismatch, err)
+	} else if err != nil {
+		return nil, err
+	}
+	return buffer, readFull(readCloser, af.name, buffer)
+}
+
+// Read straight from the archive if the entry is stored and unencrypted.
+// done is false if it isn't, and the caller must decompress instead.
+func (af *ArchivedFile) readStoredZipRange(off int64, buffer []byte) (done bool, err error) {
+	src, err := af.openSource()
+	if err != nil {
+		return true, openError(af.archivefile, err)
+	}
+	defer src.Close()
+	zipReader, err := newZipReader(src)
+	if err != nil {
+		return true, openError(af.archivefile, err)
+	}
+	if af.index >= len(zipReader.File) {
+		return false, nil
+	}
+	f := zipReader.File[af.index]
+	if f.Method != zip.Store || f.Flags&0x1 != 0 || int64(f.UncompressedSize64) != af.size {
+		return false, nil
+	}
+	start, err := f.DataOffset()
+	if err != nil {
+		return true, openError(af.archivefile, err)
+	}
+	return true, readFull(io.NewSectionReader(src, start+off, int64(len(buffer))), af.name, buffer)
+}
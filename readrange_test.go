@@ -0,0 +1,49 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadRange(t *testing.T) {
+	// A stored entry, read in place.
+	path := filepath.Join(t.TempDir(), "stored.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "plain.txt", Method: zip.Store})
+	w.Write([]byte(strings.Repeat("0123456789", 100)))
+	zw.Close()
+	out.Close()
+
+	for _, filename := range []string{path, "testassets/test.zip", "testassets/tgz_test.tgz", "testassets/sz_test.7z"} {
+		ar, err := GetArchiveInfo(filename)
+		if err != nil {
+			t.Fatalf("%s error = %v", filename, err)
+		}
+		for _, af := range ar.Files() {
+			if !af.Mode().IsRegular() || af.Size() < 10 {
+				continue
+			}
+			whole, err := af.GetBytes()
+			if err != nil {
+				t.Fatalf("%s GetBytes(%s) error = %v", filename, af.Name(), err)
+			}
+			off, length := af.Size()/3, af.Size()/4
+			got, err := af.ReadRange(off, length)
+			if err != nil || !bytes.Equal(got, whole[off:off+length]) {
+				t.Errorf("%s ReadRange(%s, %d, %d) = %q, %v", filename, af.Name(), off, length, got, err)
+			}
+			// Running off the end is cut short.
+			if got, err = af.ReadRange(af.Size()-3, 10); err != nil || !bytes.Equal(got, whole[af.Size()-3:]) {
+				t.Errorf("%s ReadRange(%s) past end = %q, %v", filename, af.Name(), got, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Read an archive over HTTP without downloading it: the archive is read
+// through Range requests, so listing a zip or 7z only fetches its
+// directory, and GetBytes only the entry asked for.  tar and RAR have no
+// directory, so listing them reads the whole stream.  The server must
+// answer Range requests with 206; one that doesn't fails with
+// ErrUnsupportedFormat.  Reads go through http.DefaultClient unless
+// WithHTTPClient says otherwise.  The URL's last path element names the
+// archive, as WithNameHint would.
+func OpenRemoteArchive(rawURL string, opts ...Option) (*ArchiveInfo, error) {
+	o := buildOptions(opts)
+	client := o.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r := &httpReaderAt{client: client, url: rawURL, blocks: make(map[int64][]byte)}
+	size, err := r.fetchSize()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rawURL, err)
+	}
+	name := rawURL
+	if u, err := url.Parse(rawURL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		name = path.Base(u.Path)
+	}
+	return GetArchiveInfoFromReader(r, size, append([]Option{WithNameHint(name)}, opts...)...)
+}
+
+// Use client for OpenRemoteArchive's requests, e.g. for timeouts or
+// authentication.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) { o.httpClient = client }
+}
+
+// Blocks are fetched whole and the most recent few kept, so the small
+// reads the zip and 7z readers make don't each cost a round trip.
+const (
+	remoteBlockSize    = 64 << 10
+	remoteCachedBlocks = 16
+)
+
+// A BlobSource over Range requests.
+type httpReaderAt struct {
+	client *http.Client
+	url    string
+	sign   func(*http.Request) // Adds credentials, if the store needs them
+	size   int64
+	mu     sync.Mutex
+	blocks map[int64][]byte // By block number
+	order  []int64          // Cached block numbers, oldest first
+}
+
+var errNoRanges = fmt.Errorf("%w: server doesn't support range requests", ErrUnsupportedFormat)
+
+// Fetch bytes [start, end) of the archive.
+func (hr *httpReaderAt) fetch(start, end int64) ([]byte, *http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, hr.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	if hr.sign != nil {
+		hr.sign(req)
+	}
+	resp, err := hr.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return nil, nil, errNoRanges
+	default:
+		return nil, nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, end-start))
+	return data, resp, err
+}
+
+// The archive's size, from the Content-Range of a one-byte request.
+func (hr *httpReaderAt) fetchSize() (int64, error) {
+	_, resp, err := hr.fetch(0, 1)
+	if err != nil {
+		return 0, err
+	}
+	_, total, found := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	size, err := strconv.ParseInt(total, 10, 64)
+	if !found || err != nil {
+		return 0, errors.New("no size in Content-Range")
+	}
+	hr.size = size
+	return size, nil
+}
+
+func (hr *httpReaderAt) Size() int64 { return hr.size }
+
+func (hr *httpReaderAt) block(n int64) ([]byte, error) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	if data, found := hr.blocks[n]; found {
+		return data, nil
+	}
+	data, _, err := hr.fetch(n*remoteBlockSize, min((n+1)*remoteBlockSize, hr.size))
+	if err != nil {
+		return nil, err
+	}
+	if len(hr.order) == remoteCachedBlocks {
+		delete(hr.blocks, hr.order[0])
+		hr.order = hr.order[1:]
+	}
+	hr.blocks[n] = data
+	hr.order = append(hr.order, n)
+	return data, nil
+}
+
+func (hr *httpReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	read := 0
+	for read < len(p) {
+		pos := off + int64(read)
+		if pos >= hr.size {
+			return read, io.EOF
+		}
+		data, err := hr.block(pos / remoteBlockSize)
+		if err != nil {
+			return read, err
+		}
+		within := pos % remoteBlockSize
+		if within >= int64(len(data)) {
+			return read, io.ErrUnexpectedEOF
+		}
+		read += copy(p[read:], data[within:])
+	}
+	return read, nil
+}
@@ -0,0 +1,79 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Serves files from dir with range support, counting the bytes sent.
+func rangeServer(t *testing.T, dir string, ranges bool) (*httptest.Server, *atomic.Int64) {
+	var sent atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := os.ReadFile(dir + r.URL.Path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if !ranges {
+			r.Header.Del("Range")
+		}
+		cw := &countingWriter{ResponseWriter: w, n: &sent}
+		http.ServeContent(cw, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(server.Close)
+	return server, &sent
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n.Add(int64(len(p)))
+	return cw.ResponseWriter.Write(p)
+}
+
+func TestOpenRemoteArchive(t *testing.T) {
+	dir := t.TempDir()
+	random := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(random)
+	writeTestZip(t, dir, "big.zip", [][2]string{{"blob.bin", string(random)}, {"notes.txt", "remote notes"}})
+
+	server, sent := rangeServer(t, dir, true)
+	ar, err := OpenRemoteArchive(server.URL + "/big.zip")
+	if err != nil {
+		t.Fatalf("OpenRemoteArchive() error = %v", err)
+	}
+	if ar.Name() != "big.zip" || len(ar.Files()) != 2 {
+		t.Errorf("remote listing: %s, %d entries", ar.Name(), len(ar.Files()))
+	}
+	if n := sent.Load(); n > 1<<20 {
+		t.Errorf("listing fetched %d bytes of a %d-byte archive", n, len(random))
+	}
+	data, err := ar.File("notes.txt").GetBytes()
+	if string(data) != "remote notes" || err != nil {
+		t.Errorf("remote GetBytes() = %q, %v", data, err)
+	}
+	if n := sent.Load(); n > 1<<20 {
+		t.Errorf("reading a small entry fetched %d bytes", n)
+	}
+	if data, err = ar.File("blob.bin").GetBytes(); !bytes.Equal(data, random) || err != nil {
+		t.Errorf("remote GetBytes(blob.bin) = %d bytes, %v", len(data), err)
+	}
+
+	plain, _ := rangeServer(t, dir, false)
+	if _, err = OpenRemoteArchive(plain.URL + "/big.zip"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("no-range server error = %v, want ErrUnsupportedFormat", err)
+	}
+	if _, err = OpenRemoteArchive(server.URL + "/missing.zip"); err == nil {
+		t.Error("missing remote archive opened")
+	}
+}
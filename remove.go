@@ -0,0 +1,124 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// Remove the named entries from a zip, tar or tar.gz on disk, and anything
+// under those that are directories.  The archive is written again without
+// them to a temp file beside it, which is renamed over it: zip entries are
+// copied without decompressing them, and a tar.gz is compressed again at
+// the default level.  fs.ErrNotExist, with nothing removed, if one of
+// names matches no entry.  A tar hard link to a removed entry is left
+// pointing at nothing.  The archive is listed again afterwards.
+func (ai *ArchiveInfo) Remove(names ...string) error {
+	if err := ai.checkEditable(ARCHIVE_ZIP, ARCHIVE_TAR, ARCHIVE_TGZ); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	rm := &removal{archive: ai.fullname, hit: make([]bool, len(names))}
+	for _, name := range names {
+		rm.names = append(rm.names, strings.TrimSuffix(name, "/"))
+	}
+	if ai.ArchiveType != ARCHIVE_ZIP {
+		return ai.rewriteTar(rm)
+	}
+	co, err := buildCreateOptions(nil)
+	if err != nil {
+		return err
+	}
+	return ai.rewriteZip(co, func(zw *zip.Writer, zr *zip.Reader) error {
+		for _, f := range zr.File {
+			if !rm.keep(zipName(f, ai.opts.nameEncoding)) {
+				continue
+			}
+			if err := copyZipEntry(zw, f); err != nil {
+				return err
+			}
+		}
+		return rm.missing()
+	})
+}
+
+// The names being removed, and which have matched an entry.
+type removal struct {
+	archive string
+	names   []string
+	hit     []bool
+}
+
+// Whether the entry called name stays: it isn't one of the names, or
+// under one.
+func (rm *removal) keep(name string) bool {
+	name = strings.TrimSuffix(name, "/")
+	kept := true
+	for i, n := range rm.names {
+		if name == n || strings.HasPrefix(name, n+"/") {
+			rm.hit[i], kept = true, false
+		}
+	}
+	return kept
+}
+
+// fs.ErrNotExist for the first name that matched nothing.
+func (rm *removal) missing() error {
+	for i, hit := range rm.hit {
+		if !hit {
+			return fmt.Errorf("%s: %s: %w", rm.archive, rm.names[i], fs.ErrNotExist)
+		}
+	}
+	return nil
+}
+
+// Copy the tar's headers and content across, compressed as it was, leaving
+// out what rm removes.
+func (ai *ArchiveInfo) rewriteTar(rm *removal) error {
+	return ai.replaceArchive(func(w io.Writer, src source) error {
+		in, out := io.Reader(src.stream()), w
+		var gzWriter *gzip.Writer
+		if ai.ArchiveType == ARCHIVE_TGZ {
+			gzReader, err := gzip.NewReader(in)
+			if err != nil {
+				return openError(ai.fullname, err)
+			}
+			defer gzReader.Close()
+			gzWriter = gzip.NewWriter(w)
+			gzWriter.Header = gzReader.Header
+			in, out = gzReader, gzWriter
+		}
+		tarReader, tarWriter := tar.NewReader(in), tar.NewWriter(out)
+		for {
+			head, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return openError(ai.fullname, err)
+			}
+			if !rm.keep(head.Name) {
+				continue
+			}
+			if err := tarWriter.WriteHeader(head); err != nil {
+				return fmt.Errorf("%s: %w", head.Name, err)
+			}
+			if _, err := io.Copy(tarWriter, tarReader); err != nil {
+				return fmt.Errorf("%s: %w", head.Name, err)
+			}
+		}
+		if err := rm.missing(); err != nil {
+			return err
+		}
+		if err := tarWriter.Close(); err != nil || gzWriter == nil {
+			return err
+		}
+		return gzWriter.Close()
+	})
+}
@@ -0,0 +1,76 @@
+package archiver
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRemove(t *testing.T) {
+	for _, c := range []struct {
+		asset  string
+		remove []string
+		want   []string
+	}{
+		{"tree.zip", []string{"docs", "src/notes.txt"}, []string{"README.md", "docsextra.txt", "src/", "src/main.go"}},
+		{"tgz_test.tgz", []string{"._Test File for Dir2.docx", "._random_text.txt"}, []string{"Test File for Dir2.docx", "random_text.txt"}},
+		{"test.tar", []string{"conf/"}, []string{"VERSION"}},
+	} {
+		data, err := os.ReadFile(filepath.Join("testassets", c.asset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), c.asset)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		ai, err := GetArchiveInfo(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept := ai.File(c.want[len(c.want)-1])
+		content, err := kept.GetBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Nothing goes if any name is missing.
+		if err := ai.Remove(append(c.remove, "missing")...); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: Remove with a missing name: %v", c.asset, err)
+		}
+		if after, _ := os.ReadFile(path); !slices.Equal(after, data) {
+			t.Errorf("%s: failed Remove changed the archive", c.asset)
+		}
+
+		if err := ai.Remove(c.remove...); err != nil {
+			t.Fatalf("%s: %v", c.asset, err)
+		}
+		var names []string
+		for _, af := range ai.Files() {
+			names = append(names, af.Name())
+		}
+		if !slices.Equal(names, c.want) || (c.asset == "tree.zip" && !ai.File("src/").IsDir) {
+			t.Errorf("%s: left %q, want %q", c.asset, names, c.want)
+		}
+		if got, err := ai.File(c.want[len(c.want)-1]).GetBytes(); err != nil || !slices.Equal(got, content) {
+			t.Errorf("%s: kept entry reads %q, %v", c.asset, got, err)
+		}
+		if ai2, err := GetArchiveInfo(path); err != nil || ai2.ArchiveType != ai.ArchiveType || len(ai2.Files()) != len(c.want) {
+			t.Errorf("%s: reopened: %v", c.asset, err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+			t.Errorf("%s: stat after Remove: %v, %v", c.asset, info, err)
+		}
+	}
+
+	ai, err := GetArchiveInfo("testassets/sz_test.7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ai.Remove(ai.Files()[0].Name()); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Remove from a 7z: %v", err)
+	}
+}
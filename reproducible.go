@@ -0,0 +1,88 @@
+package archiver
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The modification time every entry gets under Reproducible when
+// SOURCE_DATE_EPOCH isn't set: the earliest a zip can record.
+var reproducibleTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Write the same bytes for the same content, wherever and whenever the
+// archive is made.  Entries go in name order across all the sources.
+// Modification times are clamped to SOURCE_DATE_EPOCH if it's set, as
+// reproducible-builds.org describes, and are all 1980-01-01 if not.  Files
+// are written 0644, or 0755 if anyone could execute them, and directories
+// 0755.  Owners are uid and gid 0 with no names.  Zip entries carry no
+// extra fields, so their times are the DOS ones, to two seconds, in UTC.
+func Reproducible() CreateOption {
+	return func(co *createOptions) { co.reproducible = true }
+}
+
+// SOURCE_DATE_EPOCH as a time, or zero if it isn't set.
+func sourceDateEpoch() (time.Time, error) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	secs, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || secs < 0 {
+		return time.Time{}, fmt.Errorf("archiver: invalid SOURCE_DATE_EPOCH %q", value)
+	}
+	return time.Unix(secs, 0).UTC(), nil
+}
+
+// The mode and modification time to write an entry with.
+func (co createOptions) entryMeta(info fs.FileInfo) (fs.FileMode, time.Time) {
+	mode, mtime := info.Mode(), info.ModTime()
+	if !co.reproducible {
+		return mode, mtime
+	}
+	switch {
+	case mode.IsDir():
+		mode = fs.ModeDir | 0o755
+	case mode&fs.ModeSymlink != 0:
+		mode = fs.ModeSymlink | 0o777
+	case mode&0o111 != 0:
+		mode = 0o755
+	default:
+		mode = 0o644
+	}
+	switch {
+	case co.epoch.IsZero():
+		mtime = reproducibleTime
+	case mtime.After(co.epoch):
+		mtime = co.epoch
+	}
+	return mode, mtime.UTC().Truncate(time.Second)
+}
+
+// Set a zip header's DOS time from mtime and nothing else, so no extended
+// timestamp is written for it.
+func setZipDOSTime(head *zip.FileHeader, mtime time.Time) {
+	mtime = mtime.UTC()
+	if mtime.Before(reproducibleTime) {
+		mtime = reproducibleTime
+	}
+	head.Modified = time.Time{}
+	head.ModifiedDate = uint16(mtime.Year()-1980)<<9 | uint16(mtime.Month())<<5 | uint16(mtime.Day())
+	head.ModifiedTime = uint16(mtime.Hour())<<11 | uint16(mtime.Minute())<<5 | uint16(mtime.Second()/2)
+}
+
+// Add what the walk found in name order.
+func addSorted(found []walkedPath, add addFunc) error {
+	slices.SortStableFunc(found, func(a, b walkedPath) int { return strings.Compare(a.name, b.name) })
+	for _, p := range found {
+		if err := add(p.name, p.osPath, p.info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
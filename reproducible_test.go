@@ -0,0 +1,103 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReproducible(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	dir := t.TempDir()
+	root := writeTestTree(t, dir)
+	other := filepath.Join(dir, "other.txt")
+	if err := os.WriteFile(other, []byte("other\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Touching the tree and giving the sources in another order changes
+	// nothing.
+	create := func(name string, sources []string) ([]byte, []byte) {
+		zipPath, tgzPath := filepath.Join(dir, name+".zip"), filepath.Join(dir, name+".tgz")
+		if err := CreateZip(zipPath, sources, Reproducible()); err != nil {
+			t.Fatal(err)
+		}
+		if err := CreateTarGz(tgzPath, sources, Reproducible()); err != nil {
+			t.Fatal(err)
+		}
+		z, _ := os.ReadFile(zipPath)
+		g, _ := os.ReadFile(tgzPath)
+		return z, g
+	}
+	zip1, tgz1 := create("a", []string{root, other})
+	now := time.Now()
+	os.Chtimes(filepath.Join(root, "src/notes.txt"), now, now)
+	os.Chmod(filepath.Join(root, "src/notes.txt"), 0o600)
+	zip2, tgz2 := create("b", []string{other, root})
+	if !bytes.Equal(zip1, zip2) || !bytes.Equal(tgz1, tgz2) {
+		t.Error("reproducible archives differ")
+	}
+
+	for _, name := range []string{"a.zip", "a.tgz"} {
+		ai, err := GetArchiveInfo(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names := entryNames(ai); !slices.IsSorted(names) {
+			t.Errorf("%s: entries not in name order: %v", name, names)
+		}
+		for _, want := range []struct {
+			name string
+			mode os.FileMode
+		}{{"other.txt", 0o644}, {"project/src/main.go", 0o755}, {"project/src/", os.ModeDir | 0o755}} {
+			af := ai.File(want.name)
+			if af == nil || af.Mode() != want.mode || !af.ModTime().Equal(reproducibleTime) {
+				t.Errorf("%s: %s is %v", name, want.name, af)
+			}
+		}
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zip1), int64(len(zip1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if len(f.Extra) > 0 {
+			t.Errorf("%s has extra fields % x", f.Name, f.Extra)
+		}
+	}
+
+	// SOURCE_DATE_EPOCH clamps later times and leaves earlier ones.
+	epoch := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	t.Setenv("SOURCE_DATE_EPOCH", "1717200000")
+	for _, name := range []string{"c.zip", "c.tgz"} {
+		path := filepath.Join(dir, name)
+		var err error
+		if filepath.Ext(name) == ".zip" {
+			err = CreateZip(path, []string{root}, Reproducible())
+		} else {
+			err = CreateTarGz(path, []string{root}, Reproducible())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ai, err := GetArchiveInfo(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ai.File("project/src/notes.txt").ModTime(); !got.Equal(epoch) {
+			t.Errorf("%s: later file at %v, want %v", name, got, epoch)
+		}
+		if got := ai.File("project/README.md").ModTime(); !got.Equal(time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)) {
+			t.Errorf("%s: earlier file at %v", name, got)
+		}
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if err := CreateZip(filepath.Join(dir, "d.zip"), []string{root}, Reproducible()); err == nil {
+		t.Error("CreateZip accepted a bad SOURCE_DATE_EPOCH")
+	}
+}
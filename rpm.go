@@ -0,0 +1,155 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// RPM packages: a lead, a signature header and the main header, then the
+// compressed cpio payload holding the files.  The entries listed are the
+// payload's.
+
+const (
+	rpmLeadMagic            = "\xed\xab\xee\xdb"
+	rpmHeaderMagic          = "\x8e\xad\xe8\x01"
+	rpmLeadLen              = 96
+	rpmTagPayloadCompressor = 1125
+	rpmTypeString           = 6
+)
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_RPM,
+		detect:      func(header []byte) bool { return bytes.HasPrefix(header, []byte(rpmLeadMagic)) },
+		load:        loadRPM,
+		open:        openRPMEntry,
+		each:        forEachRPM,
+	})
+}
+
+func loadRPM(ar *ArchiveInfo) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	payload, closer, err := rpmPayload(src)
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer closer.Close()
+	return ar.listCpio(ARCHIVE_RPM, payload)
+}
+
+func openRPMEntry(af *ArchivedFile) (io.ReadCloser, error) {
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	payload, closer, err := rpmPayload(src)
+	if err != nil {
+		src.Close()
+		return nil, openError(af.archivefile, err)
+	}
+	body, err := openCpioEntry(af, payload)
+	if err != nil {
+		closer.Close()
+		src.Close()
+		return nil, err
+	}
+	return &entryReader{body, []io.Closer{closer, src}}, nil
+}
+
+func forEachRPM(ai *ArchiveInfo, fn func(*ArchivedFile, io.Reader) error) error {
+	src, err := ai.openSource()
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	defer src.Close()
+	payload, closer, err := rpmPayload(src)
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	defer closer.Close()
+	return ai.forEachCpio(payload, fn)
+}
+
+// The decompressed payload, past the headers.  The compressor is sniffed
+// from the payload's magic, as the main header's name for it isn't always
+// right; only the headerless legacy lzma relies on the name.
+func rpmPayload(src source) (io.Reader, io.Closer, error) {
+	if src.size < rpmLeadLen {
+		return nil, nil, fmt.Errorf("%w: short RPM lead", ErrCorruptArchive)
+	}
+	_, end, err := readRPMHeader(src, rpmLeadLen) // Signature
+	if err != nil {
+		return nil, nil, err
+	}
+	main, end, err := readRPMHeader(src, (end+7)&^7)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReader(io.NewSectionReader(src, end, src.size-end))
+	magic, _ := r.Peek(sniffLength)
+	switch t := DetectType(magic); t {
+	case ARCHIVE_TGZ, ARCHIVE_TBZ2, ARCHIVE_TXZ, ARCHIVE_TZST:
+		return tarStream(t, r)
+	}
+	if main.str(rpmTagPayloadCompressor) == "lzma" {
+		lzmaReader, err := lzma.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return lzmaReader, nopCloser{}, nil
+	}
+	return r, nopCloser{}, nil
+}
+
+// A header structure: index entries of tag, type, offset and count, and
+// the data they point into.
+type rpmHeader struct {
+	index []byte
+	data  []byte
+}
+
+// Read the header at offset, returning it and where it ends.
+func readRPMHeader(src source, offset int64) (rpmHeader, int64, error) {
+	intro := make([]byte, 16)
+	if _, err := src.ReadAt(intro, offset); err != nil {
+		return rpmHeader{}, 0, fmt.Errorf("RPM header at %d: %w", offset, noEOF(err))
+	}
+	if string(intro[:4]) != rpmHeaderMagic {
+		return rpmHeader{}, 0, fmt.Errorf("%w: bad RPM header magic at %d", ErrCorruptArchive, offset)
+	}
+	count, size := int64(binary.BigEndian.Uint32(intro[8:])), int64(binary.BigEndian.Uint32(intro[12:]))
+	end := offset + 16 + 16*count + size
+	if end > src.size {
+		return rpmHeader{}, 0, fmt.Errorf("%w: RPM header at %d runs past the end", ErrCorruptArchive, offset)
+	}
+	body := make([]byte, end-offset-16)
+	if _, err := src.ReadAt(body, offset+16); err != nil {
+		return rpmHeader{}, 0, err
+	}
+	return rpmHeader{body[:16*count], body[16*count:]}, end, nil
+}
+
+// The string tag holds; "" if there's no such string tag.
+func (h rpmHeader) str(tag uint32) string {
+	for e := h.index; len(e) >= 16; e = e[16:] {
+		if binary.BigEndian.Uint32(e) != tag || binary.BigEndian.Uint32(e[4:]) != rpmTypeString {
+			continue
+		}
+		offset := binary.BigEndian.Uint32(e[8:])
+		if int64(offset) >= int64(len(h.data)) {
+			return ""
+		}
+		s, _, _ := bytes.Cut(h.data[offset:], []byte{0})
+		return string(s)
+	}
+	return ""
+}
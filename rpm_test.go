@@ -0,0 +1,144 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// An RPM whose main header names compressor and whose payload is the
+// already compressed payload.
+func buildTestRPM(compressor string, payload []byte) []byte {
+	var buf bytes.Buffer
+	lead := make([]byte, rpmLeadLen)
+	copy(lead, rpmLeadMagic)
+	lead[4] = 3
+	copy(lead[10:], "tool-1.0-1")
+	buf.Write(lead)
+	header := func(tags map[uint32]string) {
+		var index, data []byte
+		for tag, value := range tags {
+			index = binary.BigEndian.AppendUint32(index, tag)
+			index = binary.BigEndian.AppendUint32(index, rpmTypeString)
+			index = binary.BigEndian.AppendUint32(index, uint32(len(data)))
+			index = binary.BigEndian.AppendUint32(index, 1)
+			data = append(data, value+"\x00"...)
+		}
+		buf.WriteString(rpmHeaderMagic + "\x00\x00\x00\x00")
+		binary.Write(&buf, binary.BigEndian, []uint32{uint32(len(tags)), uint32(len(data))})
+		buf.Write(index)
+		buf.Write(data)
+	}
+	header(map[uint32]string{1007: "0123456789abcdef"}) // A digest, leaving the signature unaligned
+	buf.Write(make([]byte, -buf.Len()&7))
+	header(map[uint32]string{1000: "tool", rpmTagPayloadCompressor: compressor})
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+var testRPMPayload = buildTestCpio(cpioNewcMagic,
+	testCpioEntry{name: "./usr/bin", mode: 0o040755, ino: 1},
+	testCpioEntry{name: "./usr/bin/tool", mode: 0o100755, ino: 2, body: "#!/bin/sh\necho tool\n"},
+	testCpioEntry{name: "./usr/bin/t", mode: 0o120777, ino: 3, body: "tool"},
+	testCpioEntry{name: "./usr/share/a", mode: 0o100644, ino: 4, nlink: 2},
+	testCpioEntry{name: "./usr/share/b", mode: 0o100644, ino: 4, nlink: 2, body: "shared\n"},
+	testCpioEntry{name: "./usr/share/empty", mode: 0o100644, ino: 5})
+
+func writeTestRPM(t *testing.T, compressor string, payload []byte) string {
+	name := filepath.Join(t.TempDir(), "tool-1.0-1.noarch.rpm")
+	if err := os.WriteFile(name, buildTestRPM(compressor, payload), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestRPM(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(testRPMPayload)
+	gw.Close()
+	ai, err := GetArchiveInfo(writeTestRPM(t, "gzip", gz.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, af := range ai.Files() {
+		names = append(names, af.Name())
+	}
+	want := "./usr/bin,./usr/bin/tool,./usr/bin/t,./usr/share/b,./usr/share/a,./usr/share/empty"
+	if got := strings.Join(names, ","); ai.ArchiveType != ARCHIVE_RPM || got != want {
+		t.Fatalf("type %v, entries %s; want %s", ai.ArchiveType, got, want)
+	}
+	if !ai.ExtensionMatchesType() {
+		t.Error("ExtensionMatchesType = false")
+	}
+	tool := ai.File("./usr/bin/tool")
+	if data, err := tool.GetBytes(); err != nil || string(data) != "#!/bin/sh\necho tool\n" || tool.Mode() != 0o755 {
+		t.Errorf("tool: %q, mode %v, %v", data, tool.Mode(), err)
+	}
+	if link := ai.File("./usr/bin/t"); !link.IsSymlink() || link.Linkname() != "tool" {
+		t.Errorf("t: mode %v, target %q", link.Mode(), link.Linkname())
+	}
+	if a := ai.File("./usr/share/a"); !a.IsHardlink() || a.Linkname() != "./usr/share/b" {
+		t.Errorf("a: hardlink %v to %q", a.IsHardlink(), a.Linkname())
+	}
+	if data, err := ai.ReadFile("usr/share/b"); err != nil || string(data) != "shared\n" {
+		t.Errorf("b: %q, %v", data, err)
+	}
+	if empty := ai.File("./usr/share/empty"); empty.IsHardlink() || empty.Size() != 0 {
+		t.Errorf("empty: hardlink %v, size %d", empty.IsHardlink(), empty.Size())
+	}
+
+	contents := make(map[string]string)
+	err = ai.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		contents[af.Name()] = string(data)
+		return err
+	})
+	if err != nil || len(contents) != 6 || contents["./usr/share/b"] != "shared\n" || contents["./usr/bin/t"] != "" {
+		t.Errorf("ForEach: %q, %v", contents, err)
+	}
+	dest := t.TempDir()
+	if err := ai.ExtractAll(dest, WithLinkPolicy(MaterializeLinks)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "usr/share/a")); err != nil || string(data) != "shared\n" {
+		t.Errorf("extracted a: %q, %v", data, err)
+	}
+}
+
+func TestRPMPayloadCompressors(t *testing.T) {
+	var xzPayload, lzmaPayload bytes.Buffer
+	xw, _ := xz.NewWriter(&xzPayload)
+	xw.Write(testRPMPayload)
+	xw.Close()
+	lw, _ := lzma.NewWriter(&lzmaPayload)
+	lw.Write(testRPMPayload)
+	lw.Close()
+	for _, tc := range []struct {
+		compressor string
+		payload    []byte
+	}{
+		{"xz", xzPayload.Bytes()},
+		{"gzip", xzPayload.Bytes()}, // Mislabelled
+		{"lzma", lzmaPayload.Bytes()},
+		{"", testRPMPayload},
+	} {
+		ai, err := GetArchiveInfo(writeTestRPM(t, tc.compressor, tc.payload))
+		if err != nil {
+			t.Errorf("%q: %v", tc.compressor, err)
+			continue
+		}
+		if data, err := ai.ReadFile("usr/share/b"); err != nil || len(ai.Files()) != 6 || string(data) != "shared\n" {
+			t.Errorf("%q: %d entries, %q, %v", tc.compressor, len(ai.Files()), data, err)
+		}
+	}
+}
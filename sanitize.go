@@ -0,0 +1,89 @@
+package archiver
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// What extraction does with an entry name that would escape the
+// destination ("zip slip"): one with ".." elements that climb out, an
+// absolute path or a drive letter.
+type PathPolicy int
+
+const (
+	RejectUnsafePaths PathPolicy = iota // Fail the entry with ErrUnsafePath (the default)
+	StripUnsafePaths                    // Drop the escaping parts: "../../etc/x" becomes "etc/x"
+	RenameUnsafePaths                   // Keep them visible but harmless: "../../etc/x" becomes "__/__/etc/x"
+)
+
+// Choose how the Extract methods treat names that would escape the
+// destination.  See PathPolicy.
+func WithPathPolicy(policy PathPolicy) ExtractOption {
+	return func(eo *extractOptions) { eo.paths = policy }
+}
+
+// Clean an archive entry name into a relative slash path that stays inside
+// whatever directory it's joined onto.  Backslashes count as separators.
+// Names that would escape fail with ErrUnsafePath under RejectUnsafePaths;
+// the other policies rewrite them: StripUnsafePaths drops leading "/", a
+// drive letter and ".." elements, and RenameUnsafePaths drops leading "/"
+// and turns each ".." into "__" and a drive "C:" into "C_".  An escaping
+// name that comes to nothing, such as "/" or "..", is ErrUnsafePath
+// whatever the policy.
+func SanitizePath(name string, policy PathPolicy) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	var drive string
+	if isDrive(clean) {
+		drive, clean = clean[:1], clean[2:]
+	}
+	escapes := drive != "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../")
+	switch {
+	case !escapes:
+		return clean, nil
+	case escapes && policy != StripUnsafePaths && policy != RenameUnsafePaths:
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	var elems []string
+	if drive != "" && policy == RenameUnsafePaths {
+		elems = append(elems, drive+"_")
+	}
+	for _, elem := range strings.Split(clean, "/") {
+		switch {
+		case elem == ".." && policy == RenameUnsafePaths:
+			elems = append(elems, "__")
+		case elem != "" && elem != "." && elem != "..":
+			elems = append(elems, elem)
+		}
+	}
+	if len(elems) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	return path.Join(elems...), nil
+}
+
+// Reports whether name starts with a drive, as in "C:" or "C:/x"; "a:b.txt"
+// is a name of its own.
+func isDrive(name string) bool {
+	if len(name) < 2 || name[1] != ':' || (len(name) > 2 && name[2] != '/') {
+		return false
+	}
+	c := name[0] | 0x20
+	return c >= 'a' && c <= 'z'
+}
+
+// The entry's name, cleaned and checked as SanitizePath does under
+// RejectUnsafePaths, for callers joining it onto a directory of their own.
+func (af *ArchivedFile) SafeName() (string, error) {
+	return SanitizePath(af.name, RejectUnsafePaths)
+}
+
+// Join an archive entry name onto destDir under policy.
+func safeJoin(destDir, name string, policy PathPolicy) (string, error) {
+	clean, err := SanitizePath(name, policy)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(destDir, filepath.FromSlash(clean)), nil
+}
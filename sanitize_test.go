@@ -0,0 +1,90 @@
+package archiver
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSanitizePath(t *testing.T) {
+	testdata := []struct {
+		name   string
+		reject string // "" for ErrUnsafePath
+		strip  string
+		rename string
+	}{{"docs/readme.txt", "docs/readme.txt", "docs/readme.txt", "docs/readme.txt"},
+		{"./a/b/../c", "a/c", "a/c", "a/c"},
+		{"a\\b.txt", "a/b.txt", "a/b.txt", "a/b.txt"},
+		{"../escaped.txt", "", "escaped.txt", "__/escaped.txt"},
+		{"a/../../../etc/passwd", "", "etc/passwd", "__/__/etc/passwd"},
+		{"/etc/passwd", "", "etc/passwd", "etc/passwd"},
+		{"C:\\Windows\\win.ini", "", "Windows/win.ini", "C_/Windows/win.ini"},
+		{"d:", "", "", "d_"},
+		{"a:b.txt", "a:b.txt", "a:b.txt", "a:b.txt"},
+		{"1:x", "1:x", "1:x", "1:x"},
+		{"c:../x", "c:../x", "c:../x", "c:../x"},
+		{"..", "", "", "__"},
+		{"/", "", "", ""},
+	}
+	for _, test := range testdata {
+		for _, policy := range []struct {
+			policy PathPolicy
+			want   string
+		}{{RejectUnsafePaths, test.reject}, {StripUnsafePaths, test.strip}, {RenameUnsafePaths, test.rename}} {
+			got, err := SanitizePath(test.name, policy.policy)
+			if policy.want == "" {
+				if !errors.Is(err, ErrUnsafePath) {
+					t.Errorf("SanitizePath(%q, %d) = %q, %v; want ErrUnsafePath", test.name, policy.policy, got, err)
+				}
+			} else if got != policy.want || err != nil {
+				t.Errorf("SanitizePath(%q, %d) = %q, %v; want %q", test.name, policy.policy, got, err, policy.want)
+			}
+		}
+	}
+}
+
+func TestExtractPathPolicy(t *testing.T) {
+	dir := t.TempDir()
+	ar, err := GetArchiveInfo(writeTestZip(t, dir, "evil.zip", [][2]string{
+		{"ok.txt", "fine"},
+		{"../escaped.txt", "gotcha"},
+		{"/abs.txt", "gotcha"},
+		{"C:/drive.txt", "gotcha"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := ar.File("../escaped.txt").SafeName(); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("SafeName() = %q, %v; want ErrUnsafePath", name, err)
+	}
+	if name, err := ar.File("ok.txt").SafeName(); name != "ok.txt" || err != nil {
+		t.Errorf("SafeName() = %q, %v", name, err)
+	}
+
+	for _, test := range []struct {
+		policy PathPolicy
+		want   []string
+	}{{StripUnsafePaths, []string{"abs.txt", "drive.txt", "escaped.txt", "ok.txt"}},
+		{RenameUnsafePaths, []string{"C_/drive.txt", "__/escaped.txt", "abs.txt", "ok.txt"}},
+	} {
+		dest := filepath.Join(t.TempDir(), "out")
+		if err = ar.ExtractAll(dest, WithPathPolicy(test.policy)); err != nil {
+			t.Errorf("ExtractAll(%d) error = %v", test.policy, err)
+		}
+		if got := listTree(t, dest); !slices.Equal(got, test.want) {
+			t.Errorf("ExtractAll(%d) wrote %q, want %q", test.policy, got, test.want)
+		}
+	}
+
+	var created []string
+	err = ar.ExtractAllWith(func(name string, mode fs.FileMode) (io.WriteCloser, error) {
+		created = append(created, name)
+		return &memFile{}, nil
+	}, WithPathPolicy(RenameUnsafePaths))
+	if err != nil || !slices.Equal(created, []string{"ok.txt", "__/escaped.txt", "abs.txt", "C_/drive.txt"}) {
+		t.Errorf("ExtractAllWith() created %q, error = %v", created, err)
+	}
+}
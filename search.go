@@ -0,0 +1,91 @@
+package archiver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// Longest line Search will look at.  A longer line ends the search of that
+// entry, keeping the matches before it.
+const maxSearchLine = 1 << 20
+
+// A line that matched a Search.
+type SearchResult struct {
+	File *ArchivedFile
+	Line int    // 1-based
+	Text string // The whole line, without its newline
+}
+
+// Find every line matching the regular expression pattern in the text
+// entries, in archive order.  As for ContainsText, UTF-16 entries with a
+// byte-order mark are decoded and other entries that look binary are
+// skipped.
+func (ai *ArchiveInfo) Search(pattern string) ([]SearchResult, error) {
+	return ai.SearchContext(context.Background(), pattern)
+}
+
+// Search that gives up with ctx.Err() once ctx is done.  Cancellation is
+// noticed between entries and on every read within one, so a huge entry
+// doesn't hold it up.  Results found before the cancellation are returned
+// with the error.
+func (ai *ArchiveInfo) SearchContext(ctx context.Context, pattern string) ([]SearchResult, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var results []SearchResult
+	err = ai.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if af.isDir() {
+			return nil
+		}
+		found, err := searchReader(&ctxReader{ctx, r}, re)
+		for _, res := range found {
+			res.File = af
+			results = append(results, res)
+		}
+		if err != nil && ctx.Err() == nil {
+			err = fmt.Errorf("%s: %w", af.name, err)
+		}
+		return err
+	})
+	return results, err
+}
+
+func searchReader(r io.Reader, re *regexp.Regexp) ([]SearchResult, error) {
+	text, ok, err := textReader(r)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var results []SearchResult
+	scanner := bufio.NewScanner(text)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSearchLine)
+	for line := 1; scanner.Scan(); line++ {
+		if re.Match(scanner.Bytes()) {
+			results = append(results, SearchResult{Line: line, Text: scanner.Text()})
+		}
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return results, nil
+	}
+	return results, scanner.Err()
+}
+
+// Reader that fails with the context's error once it's done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
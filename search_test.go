@@ -0,0 +1,97 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := ar.Search(`(?i)^#+ guide`)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) != 1 || results[0].File.Name() != "docs/guide.md" || results[0].Line != 1 || results[0].Text != "# Guide" {
+		t.Errorf("Search() = %+v", results)
+	}
+	if _, err = ar.Search(`(`); err == nil {
+		t.Error("Search() accepted a bad pattern")
+	}
+}
+
+// A context that reports itself cancelled after a set number of checks.
+type countdownContext struct {
+	context.Context
+	left  atomic.Int64
+	polls atomic.Int64
+}
+
+func (c *countdownContext) Err() error {
+	c.polls.Add(1)
+	if c.left.Add(-1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestSearchContextCancel(t *testing.T) {
+	var entries [][2]string
+	for i := 0; i < 20; i++ {
+		entries = append(entries, [2]string{fmt.Sprintf("log%02d.txt", i), strings.Repeat("line without a match\n", 20000)})
+	}
+	ar, err := GetArchiveInfo(writeTestZip(t, t.TempDir(), "logs.zip", entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = ar.SearchContext(ctx, "match"); !errors.Is(err, context.Canceled) {
+		t.Errorf("SearchContext(cancelled) error = %v", err)
+	}
+
+	// A full search polls the context some 360 times.  Cancel about a third
+	// of the way in, mid-entry; the search must stop there rather than
+	// finish the archive.
+	countdown := &countdownContext{Context: context.Background()}
+	countdown.left.Store(110)
+	if _, err = ar.SearchContext(countdown, "never"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SearchContext() error = %v, want context.Canceled", err)
+	}
+	if polls := countdown.polls.Load(); polls > 112 {
+		t.Errorf("context polled %d times after cancelling at 110", polls)
+	}
+}
+
+func TestSearchUTF16(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/utf16.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testdata := []struct {
+		pattern string
+		file    string
+		text    string
+	}{{"certificate", "notes_le.txt", "Action: renew the certificate"},
+		{"keyboard", "notes_be.txt", "Spare keyboard in cupboard"},
+	}
+	for _, test := range testdata {
+		results, err := ar.Search(test.pattern)
+		if err != nil || len(results) != 1 {
+			t.Fatalf("Search(%q) = %+v, %v", test.pattern, results, err)
+		}
+		if r := results[0]; r.File.Name() != test.file || r.Line != 2 || r.Text != test.text {
+			t.Errorf("Search(%q) = %+v", test.pattern, r)
+		}
+		if found, af, err := ar.ContainsText(test.pattern); !found || err != nil || af.Name() != test.file {
+			t.Errorf("ContainsText(%q) = %v, %v, %v", test.pattern, found, af, err)
+		}
+	}
+}
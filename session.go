@@ -0,0 +1,159 @@
+package archiver
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/nwaples/rardecode/v2"
+)
+
+// A Session holds an archive open across many reads, so pulling hundreds
+// of entries out of it doesn't reopen and reparse it for each one.  zip
+// and 7z keep their parsed directory.  tar (of any compression) and RAR
+// keep their stream where the last read left it: reading entries in
+// listing order is one pass, and only going back starts the stream over.
+// Other formats read as ArchivedFile.GetBytes does.  A Session is safe for
+// concurrent use, though reads are taken one at a time.  Close it when
+// done.
+type Session struct {
+	mu  sync.Mutex
+	ai  *ArchiveInfo
+	src source
+	zip *zip.Reader
+	sz  *sevenzip.Reader
+	// The forward-only formats' stream, and the position of the entry
+	// whose header it reads next.
+	tar    *tarWalker
+	rar    *rardecode.Reader
+	closer io.Closer // Decompressor under tar
+	next   int
+}
+
+// Open the archive for a run of reads.  See Session.
+func (ai *ArchiveInfo) OpenSession() (*Session, error) {
+	src, err := ai.openSource()
+	if err != nil {
+		return nil, openError(ai.fullname, err)
+	}
+	s := &Session{ai: ai, src: src}
+	switch ai.ArchiveType {
+	case ARCHIVE_ZIP:
+		s.zip, err = newZipReader(src)
+	case ARCHIVE_7Z:
+		s.sz, err = sevenzip.NewReaderWithPassword(src, src.size, ai.opts.password)
+	}
+	if err != nil {
+		src.Close()
+		return nil, openError(ai.fullname, err)
+	}
+	return s, nil
+}
+
+// Release the archive.  The Session can't be used afterwards.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if s.closer != nil {
+		err = s.closer.Close()
+	}
+	s.tar, s.rar, s.closer = nil, nil, nil
+	return errors.Join(err, s.src.Close())
+}
+
+// The entry's content, as ArchivedFile.GetBytes, read through the
+// Session's open archive.  af must be from the Session's ArchiveInfo.
+func (s *Session) GetBytes(af *ArchivedFile) ([]byte, error) {
+	if af.archive != s.ai {
+		return nil, fmt.Errorf("%s: not an entry of %s", af.name, s.ai.fullname)
+	}
+	if err := af.checkSize(); err != nil || af.implied || af.isDir() {
+		return af.GetBytes()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var r io.Reader
+	switch {
+	case s.zip != nil:
+		readCloser, err := openZipFile(s.zip.File[af.index], af.options().password)
+		if err != nil {
+			return nil, err
+		}
+		defer readCloser.Close()
+		r = readCloser
+	case s.sz != nil:
+		if codec := unsupported7zCodec(af.method); af.method != "" && codec != "" {
+			return nil, fmt.Errorf("%s: %w: 7z codec %s", af.name, ErrUnsupportedFormat, codec)
+		}
+		readCloser, err := s.sz.File[af.index].Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", af.name, af.passwordError(err))
+		}
+		defer readCloser.Close()
+		r = &passwordErrReader{af, readCloser}
+	case isTarType(af.archivetype):
+		if err := s.seekTar(af.index); err != nil {
+			return nil, err
+		}
+		r = s.tar
+	case af.archivetype == ARCHIVE_RAR:
+		if err := s.seekRar(af.index); err != nil {
+			return nil, err
+		}
+		r = &rarEntryReader{s.rar, s.ai.fullname}
+	default:
+		return af.GetBytes()
+	}
+	buffer := make([]byte, af.size)
+	return buffer, readEntry(af.wrapReader(r), af.name, buffer)
+}
+
+// Move the tar stream to the data of the index-th entry, starting over if
+// it's already gone past.
+func (s *Session) seekTar(index int) error {
+	if s.tar == nil || index < s.next {
+		if s.closer != nil {
+			s.closer.Close()
+		}
+		content, closer, err := tarStream(s.ai.ArchiveType, s.src.stream())
+		if err != nil {
+			s.tar, s.closer = nil, nil
+			return openError(s.ai.fullname, err)
+		}
+		s.tar, s.closer, s.next = newTarWalker(content, s.ai.opts.bestEffort, nil), closer, 0
+	}
+	for ; s.next <= index; s.next++ {
+		if _, err := s.tar.Next(); err == io.EOF {
+			return fmt.Errorf("entry %d: %w", index, fs.ErrNotExist)
+		} else if err != nil {
+			s.tar = nil
+			return openError(s.ai.fullname, err)
+		}
+	}
+	return nil
+}
+
+// As seekTar, for RAR.
+func (s *Session) seekRar(index int) error {
+	if s.rar == nil || index < s.next {
+		rarReader, err := rardecode.NewReader(s.src.stream())
+		if err != nil {
+			return rarError(s.ai.fullname, err)
+		}
+		s.rar, s.next = rarReader, 0
+	}
+	for ; s.next <= index; s.next++ {
+		if _, err := s.rar.Next(); err == io.EOF {
+			return fmt.Errorf("entry %d: %w", index, fs.ErrNotExist)
+		} else if err != nil {
+			s.rar = nil
+			return rarError(s.ai.fullname, err)
+		}
+	}
+	return nil
+}
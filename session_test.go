@@ -0,0 +1,59 @@
+package archiver
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	for _, filename := range []string{"tree.zip", "sz_test.7z", "tgz_test.tgz", "test.tar.xz", "test.rar"} {
+		fsys := &countingFS{FS: os.DirFS("testassets")}
+		ar, err := GetArchiveInfoFSAt(fsys, filename)
+		if err != nil {
+			t.Fatalf("%s error = %v", filename, err)
+		}
+		want := make([][]byte, len(ar.Files()))
+		for i := range want {
+			if want[i], err = ar.FileAt(i).GetBytes(); err != nil {
+				t.Fatalf("%s GetBytes(%s) error = %v", filename, ar.FileAt(i).Name(), err)
+			}
+		}
+
+		session, err := ar.OpenSession()
+		if err != nil {
+			t.Fatalf("%s OpenSession() error = %v", filename, err)
+		}
+		opens := fsys.opens
+		// Forwards, then backwards, which starts a stream over.
+		for pass := 0; pass < 2; pass++ {
+			for j := range want {
+				i := j
+				if pass == 1 {
+					i = len(want) - 1 - j
+				}
+				got, err := session.GetBytes(ar.FileAt(i))
+				if err != nil || !bytes.Equal(got, want[i]) {
+					t.Errorf("%s session GetBytes(%s) = %q, %v, want %q", filename, ar.FileAt(i).Name(), got, err, want[i])
+				}
+			}
+		}
+		if fsys.opens != opens {
+			t.Errorf("%s: session reads opened the archive %d more times", filename, fsys.opens-opens)
+		}
+		if err = session.Close(); err != nil {
+			t.Errorf("%s Close() error = %v", filename, err)
+		}
+	}
+
+	other, _ := GetArchiveInfo("testassets/test.zip")
+	ar, _ := GetArchiveInfo("testassets/tree.zip")
+	session, err := ar.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if _, err = session.GetBytes(other.FileAt(0)); err == nil {
+		t.Error("GetBytes() accepted another archive's entry")
+	}
+}
@@ -0,0 +1,530 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// sevenzip doesn't expose the coders used for each folder (stream), so we
+// read just enough of the 7z header ourselves to get at them.
+
+// 7z header property IDs
+const (
+	szEnd               = 0x00
+	szHeader            = 0x01
+	szArchiveProperties = 0x02
+	szAdditionalStreams = 0x03
+	szMainStreamsInfo   = 0x04
+	szFilesInfo         = 0x05
+	szPackInfo          = 0x06
+	szUnpackInfo        = 0x07
+	szSubStreamsInfo    = 0x08
+	szSize              = 0x09
+	szCRC               = 0x0a
+	szFolder            = 0x0b
+	szCodersUnpackSize  = 0x0c
+	szNumUnpackStream   = 0x0d
+	szEmptyStream       = 0x0e
+	szEmptyFile         = 0x0f
+	szName              = 0x11
+	szMTime             = 0x14
+	szWinAttributes     = 0x15
+	szEncodedHeader     = 0x17
+)
+
+var szSignature = []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}
+
+// Codec names by 7z method ID (hex), and whether sevenzip can decode them.
+var sevenZipCodecs = map[string]struct {
+	name      string
+	supported bool
+}{
+	"00":       {"Copy", true},
+	"03":       {"Delta", true},
+	"030101":   {"LZMA", true},
+	"03030103": {"BCJ", true},
+	"0303011b": {"BCJ2", true},
+	"03030205": {"PPC", true},
+	"03030401": {"IA64", false},
+	"03030501": {"ARM", true},
+	"03030701": {"ARMT", false},
+	"03030805": {"SPARC", true},
+	"030401":   {"PPMd", false},
+	"040108":   {"Deflate", true},
+	"040109":   {"Deflate64", false},
+	"040202":   {"BZip2", true},
+	"04f71101": {"ZStandard", true},
+	"04f71102": {"Brotli", true},
+	"04f71104": {"LZ4", true},
+	"06f10701": {"7zAES", true},
+	"0a":       {"ARM64", false},
+	"21":       {"LZMA2", true},
+}
+
+type szCoder struct {
+	id    []byte
+	props []byte
+}
+
+func (c szCoder) name() string {
+	if codec, ok := sevenZipCodecs[hex.EncodeToString(c.id)]; ok {
+		return codec.name
+	}
+	return "0x" + hex.EncodeToString(c.id)
+}
+
+type szFolderInfo struct {
+	coders        []szCoder
+	packedStreams int   // Packed input streams
+	packedSize    int64 // Their sizes added up; main streams only
+}
+
+// Coder names joined with "+", in folder order.
+func (f szFolderInfo) method() string {
+	names := make([]string, len(f.coders))
+	for i, c := range f.coders {
+		names[i] = c.name()
+	}
+	return strings.Join(names, "+")
+}
+
+type szStreamsInfo struct {
+	packPos     uint64
+	packSizes   []uint64
+	folders     []szFolderInfo
+	unpackSizes [][]uint64 // Per folder, per coder output
+}
+
+// What we learned from the 7z header.
+type szHeaderInfo struct {
+	headerEncrypted bool           // Encoded header is behind 7zAES
+	folders         []szFolderInfo // Main streams, indexed like sevenzip's File.Stream
+}
+
+// Reports the first codec in a method string that sevenzip can't decode, or "".
+func unsupported7zCodec(method string) string {
+	for _, name := range strings.Split(method, "+") {
+		for _, codec := range sevenZipCodecs {
+			if codec.name == name && codec.supported {
+				name = ""
+				break
+			}
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func readSevenZipHeader(r io.ReaderAt, size int64) (*szHeaderInfo, error) {
+	sig := make([]byte, 32)
+	if _, err := r.ReadAt(sig, 0); err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(sig, szSignature) {
+		return nil, errors.New("7z: bad signature")
+	}
+	nextOffset := binary.LittleEndian.Uint64(sig[12:20])
+	nextSize := binary.LittleEndian.Uint64(sig[20:28])
+	if nextOffset > uint64(size) || nextSize > uint64(size)-nextOffset || 32+nextOffset+nextSize > uint64(size) {
+		return nil, errors.New("7z: header out of range")
+	}
+	br := bufio.NewReader(io.NewSectionReader(r, int64(32+nextOffset), int64(nextSize)))
+
+	info := &szHeaderInfo{}
+	id, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if id == szEncodedHeader {
+		si, err := readSZStreamsInfo(br)
+		if err != nil {
+			return nil, err
+		}
+		if len(si.folders) != 1 || len(si.packSizes) < 1 {
+			return nil, errors.New("7z: unexpected encoded header layout")
+		}
+		for _, c := range si.folders[0].coders {
+			if c.name() == "7zAES" {
+				info.headerEncrypted = true
+				return info, nil
+			}
+		}
+		packed := io.NewSectionReader(r, int64(32+si.packPos), int64(si.packSizes[0]))
+		decoded, err := decodeSZHeader(packed, si.folders[0], si.unpackSizes[0])
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(decoded)
+		if id, err = br.ReadByte(); err != nil {
+			return nil, err
+		}
+	}
+	if id != szHeader {
+		return nil, fmt.Errorf("7z: unexpected header id 0x%02x", id)
+	}
+
+	for {
+		if id, err = br.ReadByte(); err != nil {
+			return nil, err
+		}
+		switch id {
+		case szArchiveProperties:
+			if err = skipSZProperties(br); err != nil {
+				return nil, err
+			}
+		case szAdditionalStreams:
+			if _, err = readSZStreamsInfo(br); err != nil {
+				return nil, err
+			}
+		case szMainStreamsInfo:
+			si, err := readSZStreamsInfo(br)
+			if err != nil {
+				return nil, err
+			}
+			// Pack streams are listed in folder order.
+			next := 0
+			for i := range si.folders {
+				for j := 0; j < si.folders[i].packedStreams && next < len(si.packSizes); j++ {
+					si.folders[i].packedSize += int64(si.packSizes[next])
+					next++
+				}
+			}
+			info.folders = si.folders
+			return info, nil
+		default: // Files only, or the end; nothing we need.
+			return info, nil
+		}
+	}
+}
+
+// Decode a packed header.  7-Zip only ever uses a single LZMA/LZMA2/Copy coder here.
+func decodeSZHeader(packed io.Reader, folder szFolderInfo, unpackSizes []uint64) (io.Reader, error) {
+	if len(folder.coders) != 1 || len(unpackSizes) != 1 {
+		return nil, fmt.Errorf("7z: unsupported header coders %s", folder.method())
+	}
+	c := folder.coders[0]
+	switch c.name() {
+	case "Copy":
+		return packed, nil
+	case "LZMA":
+		if len(c.props) != 5 {
+			return nil, errors.New("7z: bad LZMA properties")
+		}
+		// Rebuild the classic .lzma header: properties, dictionary, size.
+		head := make([]byte, 13)
+		copy(head, c.props)
+		binary.LittleEndian.PutUint64(head[5:], unpackSizes[0])
+		lr, err := lzma.NewReader(io.MultiReader(bytes.NewReader(head), packed))
+		if err != nil {
+			return nil, err
+		}
+		return io.LimitReader(lr, int64(unpackSizes[0])), nil
+	case "LZMA2":
+		if len(c.props) != 1 || c.props[0] > 40 {
+			return nil, errors.New("7z: bad LZMA2 properties")
+		}
+		p := c.props[0]
+		dictCap := int64(2|p&1) << (p/2 + 11)
+		if p == 40 {
+			dictCap = lzma.MaxDictCap
+		}
+		// int64 and clamped, as the larger sizes don't fit a 32-bit int.
+		lr, err := lzma.Reader2Config{DictCap: int(max(min(dictCap, math.MaxInt), lzma.MinDictCap))}.NewReader2(packed)
+		if err != nil {
+			return nil, err
+		}
+		return io.LimitReader(lr, int64(unpackSizes[0])), nil
+	}
+	return nil, fmt.Errorf("7z: unsupported header coder %s", c.name())
+}
+
+// 7z variable length integer: leading one bits in the first byte say how
+// many little-endian bytes follow.
+func readSZNumber(r io.ByteReader) (uint64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	var value uint64
+	mask := byte(0x80)
+	for i := 0; i < 8; i++ {
+		if first&mask == 0 {
+			high := uint64(first & (mask - 1))
+			return value | high<<(8*i), nil
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint64(b) << (8 * i)
+		mask >>= 1
+	}
+	return value, nil
+}
+
+func skipSZBytes(r *bufio.Reader, n uint64) error {
+	_, err := io.CopyN(io.Discard, r, int64(n))
+	return err
+}
+
+func skipSZProperties(r *bufio.Reader) error {
+	for {
+		id, err := r.ReadByte()
+		if err != nil || id == szEnd {
+			return err
+		}
+		size, err := readSZNumber(r)
+		if err == nil {
+			err = skipSZBytes(r, size)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Digests: an all-defined flag or bit vector, then a CRC for each defined item.
+func skipSZDigests(r *bufio.Reader, count uint64) error {
+	allDefined, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	defined := count
+	if allDefined == 0 {
+		defined = 0
+		for i := uint64(0); i < (count+7)/8; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			for ; b != 0; b &= b - 1 {
+				defined++
+			}
+		}
+	}
+	return skipSZBytes(r, defined*4)
+}
+
+// Reads pack and unpack info.  Substreams are skipped; we stop reading there.
+func readSZStreamsInfo(r *bufio.Reader) (*szStreamsInfo, error) {
+	si := &szStreamsInfo{}
+	for {
+		id, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case szEnd:
+			return si, nil
+		case szPackInfo:
+			if err = readSZPackInfo(r, si); err != nil {
+				return nil, err
+			}
+		case szUnpackInfo:
+			if err = readSZUnpackInfo(r, si); err != nil {
+				return nil, err
+			}
+		default:
+			return si, nil
+		}
+	}
+}
+
+func readSZPackInfo(r *bufio.Reader, si *szStreamsInfo) error {
+	var err error
+	if si.packPos, err = readSZNumber(r); err != nil {
+		return err
+	}
+	count, err := readSZNumber(r)
+	if err != nil {
+		return err
+	}
+	for {
+		id, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch id {
+		case szEnd:
+			return nil
+		case szSize:
+			si.packSizes = make([]uint64, 0, min(count, 1024))
+			for i := uint64(0); i < count; i++ {
+				size, err := readSZNumber(r)
+				if err != nil {
+					return err
+				}
+				si.packSizes = append(si.packSizes, size)
+			}
+		case szCRC:
+			if err = skipSZDigests(r, count); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("7z: unexpected pack info id 0x%02x", id)
+		}
+	}
+}
+
+func readSZUnpackInfo(r *bufio.Reader, si *szStreamsInfo) error {
+	if id, err := r.ReadByte(); err != nil || id != szFolder {
+		return errors.New("7z: expected folder list")
+	}
+	count, err := readSZNumber(r)
+	if err != nil {
+		return err
+	}
+	if external, err := r.ReadByte(); err != nil || external != 0 {
+		return errors.New("7z: external folders not supported")
+	}
+	outStreams := make([]uint64, 0, min(count, 1024))
+	for i := uint64(0); i < count; i++ {
+		folder, outs, err := readSZFolder(r)
+		if err != nil {
+			return err
+		}
+		si.folders = append(si.folders, folder)
+		outStreams = append(outStreams, outs)
+	}
+	if id, err := r.ReadByte(); err != nil || id != szCodersUnpackSize {
+		return errors.New("7z: expected unpack sizes")
+	}
+	for _, outs := range outStreams {
+		sizes := make([]uint64, 0, min(outs, 64))
+		for j := uint64(0); j < outs; j++ {
+			size, err := readSZNumber(r)
+			if err != nil {
+				return err
+			}
+			sizes = append(sizes, size)
+		}
+		si.unpackSizes = append(si.unpackSizes, sizes)
+	}
+	for {
+		id, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch id {
+		case szEnd:
+			return nil
+		case szCRC:
+			if err = skipSZDigests(r, count); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("7z: unexpected unpack info id 0x%02x", id)
+		}
+	}
+}
+
+// Returns the folder's coders and its total number of output streams.
+func readSZFolder(r *bufio.Reader) (szFolderInfo, uint64, error) {
+	var folder szFolderInfo
+	numCoders, err := readSZNumber(r)
+	if err != nil {
+		return folder, 0, err
+	}
+	if numCoders == 0 || numCoders > 64 {
+		return folder, 0, errors.New("7z: bad coder count")
+	}
+	var totalIn, totalOut uint64
+	for i := uint64(0); i < numCoders; i++ {
+		flags, err := r.ReadByte()
+		if err != nil {
+			return folder, 0, err
+		}
+		if flags&0x80 != 0 {
+			return folder, 0, errors.New("7z: alternative coders not supported")
+		}
+		c := szCoder{id: make([]byte, flags&0x0f)}
+		if _, err = io.ReadFull(r, c.id); err != nil {
+			return folder, 0, err
+		}
+		in, out := uint64(1), uint64(1)
+		if flags&0x10 != 0 {
+			if in, err = readSZNumber(r); err != nil {
+				return folder, 0, err
+			}
+			if out, err = readSZNumber(r); err != nil {
+				return folder, 0, err
+			}
+		}
+		if flags&0x20 != 0 {
+			size, err := readSZNumber(r)
+			if err != nil {
+				return folder, 0, err
+			}
+			if size > 1<<16 {
+				return folder, 0, errors.New("7z: coder properties too large")
+			}
+			c.props = make([]byte, size)
+			if _, err = io.ReadFull(r, c.props); err != nil {
+				return folder, 0, err
+			}
+		}
+		totalIn += in
+		totalOut += out
+		folder.coders = append(folder.coders, c)
+	}
+	if totalOut == 0 || totalIn > 64 || totalOut > 64 {
+		return folder, 0, errors.New("7z: bad stream count")
+	}
+	// Bind pairs, then packed stream indexes; we only need to skip them.
+	bindPairs := totalOut - 1
+	for i := uint64(0); i < bindPairs*2; i++ {
+		if _, err = readSZNumber(r); err != nil {
+			return folder, 0, err
+		}
+	}
+	if totalIn < bindPairs {
+		return folder, 0, errors.New("7z: bad bind pairs")
+	}
+	packed := totalIn - bindPairs
+	folder.packedStreams = int(packed)
+	if packed > 1 {
+		for i := uint64(0); i < packed; i++ {
+			if _, err = readSZNumber(r); err != nil {
+				return folder, 0, err
+			}
+		}
+	}
+	return folder, totalOut, nil
+}
+
+// Reports whether a 7z archive's header is encrypted, so that listing it
+// needs a password.  Only the signature header and the encoded header's
+// coder list are read, so it's cheap enough to call before a full open.
+// Anything that isn't a 7z archive reports false.
+func HeaderEncrypted(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, openError(path, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, openError(path, err)
+	}
+	sig := make([]byte, len(szSignature))
+	if _, err = io.ReadFull(file, sig); err != nil || !bytes.Equal(sig, szSignature) {
+		return false, nil
+	}
+	header, err := readSevenZipHeader(file, info.Size())
+	if err != nil {
+		return false, openError(path, err)
+	}
+	return header.headerEncrypted, nil
+}
@@ -0,0 +1,116 @@
+package archiver
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSevenZipCodecs(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/codecs.7z")
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	want := map[string]string{
+		"copy.txt":    "Copy",
+		"lzma.txt":    "LZMA",
+		"lzma2.txt":   "LZMA2",
+		"bzip2.txt":   "BZip2",
+		"deflate.txt": "Deflate",
+		"ppmd.txt":    "PPMd",
+	}
+	for name, method := range want {
+		af := ar.File(name)
+		if af == nil {
+			t.Fatalf("missing %s", name)
+		}
+		if af.Method() != method {
+			t.Errorf("%s Method() = %q, want %q", name, af.Method(), method)
+		}
+		data, err := af.GetBytes()
+		if method == "PPMd" {
+			if !errors.Is(err, ErrUnsupportedFormat) || !strings.Contains(err.Error(), "PPMd") {
+				t.Errorf("%s GetBytes() error = %v, want ErrUnsupportedFormat naming PPMd", name, err)
+			}
+			continue
+		}
+		if err != nil || !strings.HasPrefix(string(data), "The quick brown fox") {
+			t.Errorf("%s GetBytes() = %.20q, %v", name, data, err)
+		}
+	}
+
+	// 7-Zip itself compresses the header; make sure we get through that too.
+	ar, err = GetArchiveInfo("testassets/sz_test.7z")
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	if method := ar.File("random_text.txt").Method(); method == "" {
+		t.Error("no method read from an encoded 7z header")
+	}
+}
+
+func TestHeaderEncrypted(t *testing.T) {
+	testdata := []struct {
+		filename  string
+		encrypted bool
+	}{{"testassets/encrypted_header.7z", true},
+		{"testassets/sz_test.7z", false}, // Encoded, but only LZMA2
+		{"testassets/codecs.7z", false},  // Plain header
+		{"testassets/test.zip", false},
+	}
+	for _, test := range testdata {
+		got, err := HeaderEncrypted(test.filename)
+		if err != nil || got != test.encrypted {
+			t.Errorf("HeaderEncrypted(%s) = %v, %v, want %v", test.filename, got, err, test.encrypted)
+		}
+	}
+	if _, err := GetArchiveInfo("testassets/encrypted_header.7z"); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("GetArchiveInfo() error = %v, want ErrEncrypted", err)
+	}
+	if _, err := HeaderEncrypted("testassets/missing.7z"); err == nil {
+		t.Error("HeaderEncrypted(missing) error = nil")
+	}
+}
+
+func TestSevenZipPassword(t *testing.T) {
+	plans := strings.Repeat("Meet at the usual place at noon.\n", 4)
+	for _, filename := range []string{"testassets/encrypted_files.7z", "testassets/encrypted_header.7z"} {
+		ar, err := GetArchiveInfo(filename, WithPassword("callooh"))
+		if err != nil {
+			t.Fatalf("%s error = %v", filename, err)
+		}
+		af := ar.File("plans.txt")
+		if !af.Encrypted() {
+			t.Errorf("%s Encrypted() = false", filename)
+		}
+		if data, err := af.GetBytes(); err != nil || string(data) != plans {
+			t.Errorf("%s GetBytes() = %q, %v", filename, data, err)
+		}
+		rc, err := ar.File("codes.txt").Open()
+		if err != nil {
+			t.Fatalf("%s Open() error = %v", filename, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(data) != "alpha bravo charlie\n" {
+			t.Errorf("%s codes.txt = %q, %v", filename, data, err)
+		}
+	}
+
+	// Files-only encryption lists without the password, but can't be read.
+	ar, err := GetArchiveInfo("testassets/encrypted_files.7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ar.File("codes.txt").GetBytes(); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("GetBytes() without password error = %v, want ErrEncrypted", err)
+	}
+	ar, _ = GetArchiveInfo("testassets/encrypted_files.7z", WithPassword("jabberwock"))
+	if _, err = ar.File("plans.txt").GetBytes(); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("GetBytes() with wrong password error = %v, want ErrWrongPassword", err)
+	}
+	if _, err = GetArchiveInfo("testassets/encrypted_header.7z", WithPassword("jabberwock")); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("listing with wrong password error = %v, want ErrWrongPassword", err)
+	}
+}
@@ -0,0 +1,514 @@
+package archiver
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const (
+	szDictCap    = 8 << 20 // LZMA2 dictionary, 7-Zip's for -mx5 and under
+	szDictProp   = 22      // The same as an LZMA2 property byte
+	szAESCycles  = 19      // 2^19 SHA-256 rounds to the key, as 7-Zip uses
+	szFileTime70 = 116444736000000000
+)
+
+// Compress all of a 7z archive's files as one stream, as 7-Zip does by
+// default.  Similar files compress better together, but reading any one of
+// them means decompressing those before it.  Applies to Create7z.
+func Solid() CreateOption {
+	return func(co *createOptions) { co.solid = true }
+}
+
+// Encrypt with AES-256 under password: each file's data, and the header,
+// so that even the names can't be listed without it.  Only 7z archives
+// can be encrypted; the other Create functions, Convert, Add and Replace
+// fail with ErrUnsupportedFormat given a password.
+func WithEncryption(password string) CreateOption {
+	return func(co *createOptions) { co.password = password }
+}
+
+// Fail with ErrUnsupportedFormat if WithEncryption asked for what destPath
+// can't do.
+func (co createOptions) unencrypted(destPath string) error {
+	if co.password != "" {
+		return fmt.Errorf("%s: %w: only 7z archives can be encrypted", destPath, ErrUnsupportedFormat)
+	}
+	return nil
+}
+
+// Write a 7z archive at destPath holding sources, as CreateZip does.
+// Files are compressed with LZMA2, each on its own unless Solid; modes and
+// modification times are kept, as p7zip keeps them.  Symlinks are stored
+// with their target as content.  WithEncryption encrypts the archive;
+// WithCompressionLevel and WithCompression don't apply.  If anything fails,
+// destPath is removed.
+func Create7z(destPath string, sources []string, opts ...CreateOption) (err error) {
+	co, err := buildCreateOptions(opts)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	sw, err := newSZWriter(out, co)
+	defer func() {
+		if err == nil {
+			err = sw.Close()
+		}
+		err = errors.Join(err, out.Close())
+		if err != nil {
+			os.Remove(destPath)
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	return walkSources(sources, destPath, co, func(name, osPath string, info fs.FileInfo) error {
+		if err := add7zEntry(sw, name, osPath, info, co); err != nil {
+			return fmt.Errorf("%s: %w", osPath, err)
+		}
+		return nil
+	})
+}
+
+func add7zEntry(sw *szWriter, name, osPath string, info fs.FileInfo, co createOptions) error {
+	mode, mtime := co.entryMeta(info)
+	switch {
+	case mode.IsDir():
+		return sw.add(name, mode, mtime, nil)
+	case mode&fs.ModeSymlink != 0:
+		target, err := os.Readlink(osPath)
+		if err != nil {
+			return err
+		}
+		return sw.add(name, mode, mtime, strings.NewReader(target))
+	case !mode.IsRegular():
+		return nil
+	}
+	f, err := os.Open(osPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return sw.add(name, mode, mtime, f)
+}
+
+// Writes a 7z archive: a placeholder for the signature header, each
+// folder's packed stream in turn, then the header, packed itself, after
+// them.  The signature header is filled in last.
+type szWriter struct {
+	out     io.WriterAt
+	w       *writeCounter // out, from the end of the signature header
+	solid   bool
+	key     []byte          // AES-256 key; nil to not encrypt
+	folder  *szFolderWriter // Open folder, or nil
+	folders []szFolderOut
+	files   []szFileOut
+}
+
+type szFileOut struct {
+	name   string
+	mode   fs.FileMode
+	mtime  time.Time
+	size   uint64
+	crc    uint32
+	stream bool // Has data; empty files and directories don't
+}
+
+// A finished folder.
+type szFolderOut struct {
+	iv         []byte // 7zAES IV, or nil
+	packSize   uint64
+	lzmaSize   uint64 // LZMA2 stream, under the encryption
+	unpackSize uint64
+	streams    int // Files in it
+}
+
+func newSZWriter(out *os.File, co createOptions) (*szWriter, error) {
+	sw := &szWriter{out: out, w: &writeCounter{w: out}, solid: co.solid}
+	if co.password != "" {
+		sw.key = szKey(co.password)
+	}
+	_, err := out.Write(make([]byte, 32))
+	return sw, err
+}
+
+// Add an entry with content r; nil for a directory.
+func (sw *szWriter) add(name string, mode fs.FileMode, mtime time.Time, r io.Reader) error {
+	file := szFileOut{name: name, mode: mode, mtime: mtime}
+	if r != nil {
+		ew := &szEntryWriter{sw: sw, crc: crc32.NewIEEE()}
+		if _, err := io.Copy(ew, r); err != nil {
+			return err
+		}
+		if ew.size > 0 {
+			file.size, file.crc, file.stream = ew.size, ew.crc.Sum32(), true
+			sw.folder.streams++
+			if !sw.solid {
+				if err := sw.closeFolder(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	sw.files = append(sw.files, file)
+	return nil
+}
+
+// Writes an entry's content to the open folder, opening one at the first
+// byte, so empty files get no stream.
+type szEntryWriter struct {
+	sw   *szWriter
+	size uint64
+	crc  hash.Hash32
+}
+
+func (ew *szEntryWriter) Write(p []byte) (int, error) {
+	if ew.sw.folder == nil {
+		folder, err := ew.sw.openFolder()
+		if err != nil {
+			return 0, err
+		}
+		ew.sw.folder = folder
+	}
+	n, err := ew.sw.folder.Write(p)
+	ew.crc.Write(p[:n])
+	ew.size += uint64(n)
+	return n, err
+}
+
+func (sw *szWriter) closeFolder() error {
+	if sw.folder == nil {
+		return nil
+	}
+	folder, err := sw.folder.close()
+	sw.folder = nil
+	sw.folders = append(sw.folders, folder)
+	return err
+}
+
+// Finish the archive: close the last folder, write the header and fill in
+// the signature header.  out isn't closed.
+func (sw *szWriter) Close() error {
+	if err := sw.closeFolder(); err != nil {
+		return err
+	}
+	header := sw.header()
+	dataSize := uint64(sw.w.n)
+	fw, err := sw.openFolder()
+	if err != nil {
+		return err
+	}
+	if _, err = fw.Write(header); err != nil {
+		return err
+	}
+	folder, err := fw.close()
+	if err != nil {
+		return err
+	}
+	crc := crc32.ChecksumIEEE(header)
+	encoded := appendSZStreams([]byte{szEncodedHeader}, dataSize, []szFolderOut{folder}, &crc)
+	encoded = append(encoded, szEnd)
+	if _, err = sw.w.Write(encoded); err != nil {
+		return err
+	}
+
+	var sig [32]byte
+	copy(sig[:], szSignature)
+	sig[7] = 4 // Version 0.4
+	binary.LittleEndian.PutUint64(sig[12:], dataSize+folder.packSize)
+	binary.LittleEndian.PutUint64(sig[20:], uint64(len(encoded)))
+	binary.LittleEndian.PutUint32(sig[28:], crc32.ChecksumIEEE(encoded))
+	binary.LittleEndian.PutUint32(sig[8:], crc32.ChecksumIEEE(sig[12:]))
+	_, err = sw.out.WriteAt(sig[:], 0)
+	return err
+}
+
+// The plain header: the folders, where each file's data is in them, and
+// the files.
+func (sw *szWriter) header() []byte {
+	b := []byte{szHeader}
+	if len(sw.folders) > 0 {
+		b = append(b, szMainStreamsInfo)
+		b = appendSZStreams(b, 0, sw.folders, nil)
+		b = append(b, szSubStreamsInfo)
+		if slices.ContainsFunc(sw.folders, func(f szFolderOut) bool { return f.streams != 1 }) {
+			b = append(b, szNumUnpackStream)
+			for _, f := range sw.folders {
+				b = appendSZNumber(b, uint64(f.streams))
+			}
+		}
+		// Sizes of all but the last file in each folder, then every CRC.
+		b = append(b, szSize)
+		next := 0
+		for _, f := range sw.folders {
+			for i := 0; i < f.streams; i++ {
+				for !sw.files[next].stream {
+					next++
+				}
+				if i < f.streams-1 {
+					b = appendSZNumber(b, sw.files[next].size)
+				}
+				next++
+			}
+		}
+		b = append(b, szCRC, 1)
+		for _, file := range sw.files {
+			if file.stream {
+				b = binary.LittleEndian.AppendUint32(b, file.crc)
+			}
+		}
+		b = append(b, szEnd, szEnd)
+	}
+	// Written even with no files, as sevenzip can't read a header without.
+	b = append(b, szFilesInfo)
+	b = appendSZNumber(b, uint64(len(sw.files)))
+	var emptyStream, emptyFile []bool
+	for _, file := range sw.files {
+		emptyStream = append(emptyStream, !file.stream)
+		if !file.stream {
+			emptyFile = append(emptyFile, !file.mode.IsDir())
+		}
+	}
+	if len(emptyFile) > 0 {
+		b = appendSZProperty(b, szEmptyStream, appendSZBits(nil, emptyStream))
+	}
+	if slices.Contains(emptyFile, true) {
+		b = appendSZProperty(b, szEmptyFile, appendSZBits(nil, emptyFile))
+	}
+	names, times, attrs := []byte{0}, []byte{1, 0}, []byte{1, 0}
+	for _, file := range sw.files {
+		for _, u := range utf16.Encode([]rune(file.name)) {
+			names = binary.LittleEndian.AppendUint16(names, u)
+		}
+		names = append(names, 0, 0)
+		times = binary.LittleEndian.AppendUint64(times, uint64(file.mtime.UnixNano()/100+szFileTime70))
+		attrs = binary.LittleEndian.AppendUint32(attrs, szAttributes(file.mode))
+	}
+	b = appendSZProperty(b, szName, names)
+	b = appendSZProperty(b, szMTime, times)
+	b = appendSZProperty(b, szWinAttributes, attrs)
+	b = append(b, szEnd)
+	return append(b, szEnd)
+}
+
+// Pack and unpack info for folders whose packed streams start at packPos,
+// with the folders' CRC if there's one folder and crc isn't nil.
+func appendSZStreams(b []byte, packPos uint64, folders []szFolderOut, crc *uint32) []byte {
+	b = append(b, szPackInfo)
+	b = appendSZNumber(b, packPos)
+	b = appendSZNumber(b, uint64(len(folders)))
+	b = append(b, szSize)
+	for _, f := range folders {
+		b = appendSZNumber(b, f.packSize)
+	}
+	b = append(b, szEnd)
+
+	b = append(b, szUnpackInfo, szFolder)
+	b = appendSZNumber(b, uint64(len(folders)))
+	b = append(b, 0) // Not external
+	for _, f := range folders {
+		if f.iv == nil {
+			b = append(b, 1, 0x20|1, 0x21, 1, szDictProp)
+			continue
+		}
+		// 7zAES decrypts the packed stream for LZMA2.
+		b = append(b, 2, 0x20|4, 0x06, 0xf1, 0x07, 0x01)
+		props := append([]byte{szAESCycles | 0x40, aes.BlockSize - 1}, f.iv...)
+		b = appendSZNumber(b, uint64(len(props)))
+		b = append(b, props...)
+		b = append(b, 0x20|1, 0x21, 1, szDictProp)
+		b = append(b, 1, 0) // Bind pair: LZMA2's input 1 from 7zAES's output 0
+	}
+	b = append(b, szCodersUnpackSize)
+	for _, f := range folders {
+		if f.iv != nil {
+			b = appendSZNumber(b, f.lzmaSize)
+		}
+		b = appendSZNumber(b, f.unpackSize)
+	}
+	if crc != nil && len(folders) == 1 {
+		b = append(b, szCRC, 1)
+		b = binary.LittleEndian.AppendUint32(b, *crc)
+	}
+	return append(b, szEnd)
+}
+
+func appendSZProperty(b []byte, id byte, data []byte) []byte {
+	b = append(b, id)
+	b = appendSZNumber(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// A bit vector, first bit highest.
+func appendSZBits(b []byte, bits []bool) []byte {
+	for i, bit := range bits {
+		if i%8 == 0 {
+			b = append(b, 0)
+		}
+		if bit {
+			b[len(b)-1] |= 0x80 >> (i % 8)
+		}
+	}
+	return b
+}
+
+// The inverse of readSZNumber, in the fewest bytes.
+func appendSZNumber(b []byte, v uint64) []byte {
+	for n := 0; n < 8; n++ {
+		if v < 1<<(7*(n+1)) {
+			b = append(b, ^byte(0xff>>n)|byte(v>>(8*n)))
+			for i := 0; i < n; i++ {
+				b = append(b, byte(v>>(8*i)))
+			}
+			return b
+		}
+	}
+	return binary.LittleEndian.AppendUint64(append(b, 0xff), v)
+}
+
+// 7z attributes for mode: the Unix mode in the high 16 bits, flagged by
+// 0x8000, with the DOS directory and read-only bits.
+func szAttributes(mode fs.FileMode) uint32 {
+	unix := uint32(mode.Perm()) | uint32(tarModeBits(mode))
+	attrs := uint32(0x8000)
+	switch {
+	case mode.IsDir():
+		unix |= 0o040000
+		attrs |= 0x10
+	case mode&fs.ModeSymlink != 0:
+		unix |= 0o120000
+	default:
+		unix |= 0o100000
+	}
+	if mode&0o200 == 0 {
+		attrs |= 0x01
+	}
+	return attrs | unix<<16
+}
+
+// 7zAES's key: SHA-256 over 2^szAESCycles rounds of the UTF-16LE password
+// and a round counter.  There's no salt.
+func szKey(password string) []byte {
+	var pw []byte
+	for _, u := range utf16.Encode([]rune(password)) {
+		pw = binary.LittleEndian.AppendUint16(pw, u)
+	}
+	h := sha256.New()
+	round := make([]byte, 8)
+	for i := uint64(0); i < 1<<szAESCycles; i++ {
+		binary.LittleEndian.PutUint64(round, i)
+		h.Write(pw)
+		h.Write(round)
+	}
+	return h.Sum(nil)
+}
+
+// A folder being written: LZMA2, then 7zAES if there's a key.
+type szFolderWriter struct {
+	lz       *lzma.Writer2
+	enc      *cbcWriter    // nil if not encrypting
+	packed   *writeCounter // What goes to the archive
+	lzma     *writeCounter // What LZMA2 writes
+	iv       []byte
+	unpacked uint64
+	streams  int
+}
+
+func (sw *szWriter) openFolder() (*szFolderWriter, error) {
+	fw := &szFolderWriter{packed: &writeCounter{w: sw.w}}
+	fw.lzma = fw.packed
+	if sw.key != nil {
+		fw.iv = make([]byte, aes.BlockSize)
+		if _, err := rand.Read(fw.iv); err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(sw.key)
+		if err != nil {
+			return nil, err
+		}
+		fw.enc = &cbcWriter{w: fw.packed, mode: cipher.NewCBCEncrypter(block, fw.iv)}
+		fw.lzma = &writeCounter{w: fw.enc}
+	}
+	lz, err := lzma.Writer2Config{DictCap: szDictCap}.NewWriter2(fw.lzma)
+	fw.lz = lz
+	return fw, err
+}
+
+func (fw *szFolderWriter) Write(p []byte) (int, error) {
+	n, err := fw.lz.Write(p)
+	fw.unpacked += uint64(n)
+	return n, err
+}
+
+func (fw *szFolderWriter) close() (szFolderOut, error) {
+	err := fw.lz.Close()
+	if err == nil && fw.enc != nil {
+		err = fw.enc.Close()
+	}
+	return szFolderOut{iv: fw.iv, packSize: uint64(fw.packed.n), lzmaSize: uint64(fw.lzma.n),
+		unpackSize: fw.unpacked, streams: fw.streams}, err
+}
+
+// AES-CBC over a stream, zero-padding the last block on Close, as 7zAES
+// expects.
+type cbcWriter struct {
+	w    io.Writer
+	mode cipher.BlockMode
+	buf  []byte
+}
+
+func (cw *cbcWriter) Write(p []byte) (int, error) {
+	cw.buf = append(cw.buf, p...)
+	full := len(cw.buf) - len(cw.buf)%aes.BlockSize
+	if full == 0 {
+		return len(p), nil
+	}
+	cw.mode.CryptBlocks(cw.buf[:full], cw.buf[:full])
+	if _, err := cw.w.Write(cw.buf[:full]); err != nil {
+		return 0, err
+	}
+	cw.buf = append(cw.buf[:0], cw.buf[full:]...)
+	return len(p), nil
+}
+
+func (cw *cbcWriter) Close() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	block := make([]byte, aes.BlockSize)
+	copy(block, cw.buf)
+	cw.buf = cw.buf[:0]
+	cw.mode.CryptBlocks(block, block)
+	_, err := cw.w.Write(block)
+	return err
+}
+
+// Writer that keeps count of the bytes through it.
+type writeCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (wc *writeCounter) Write(p []byte) (int, error) {
+	n, err := wc.w.Write(p)
+	wc.n += int64(n)
+	return n, err
+}
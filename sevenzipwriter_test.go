@@ -0,0 +1,129 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCreate7z(t *testing.T) {
+	dir := t.TempDir()
+	root := writeTestTree(t, dir)
+	if err := os.WriteFile(filepath.Join(root, "src/empty.txt"), nil, 0o444); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"project/", "project/.git/", "project/.git/HEAD", "project/LINK", "project/README.md", "project/empty/",
+		"project/src/", "project/src/empty.txt", "project/src/main.go", "project/src/notes.txt", "project/src/util/",
+		"project/src/util/util.go"}
+
+	for _, c := range []struct {
+		name string
+		opts []CreateOption
+	}{
+		{"plain.7z", nil},
+		{"solid.7z", []CreateOption{Solid()}},
+		{"secret.7z", []CreateOption{Solid(), WithEncryption("hunter2")}},
+	} {
+		dest := filepath.Join(dir, c.name)
+		if err := Create7z(dest, []string{root}, c.opts...); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		encrypted := c.name == "secret.7z"
+		var opts []Option
+		if encrypted {
+			if _, err := GetArchiveInfo(dest); !errors.Is(err, ErrEncrypted) {
+				t.Errorf("%s: listing without the password: %v", c.name, err)
+			}
+			if hidden, err := HeaderEncrypted(dest); err != nil || !hidden {
+				t.Errorf("%s: HeaderEncrypted gives %v, %v", c.name, hidden, err)
+			}
+			opts = append(opts, WithPassword("hunter2"))
+		}
+		ai, err := GetArchiveInfo(dest, opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		names := entryNames(ai)
+		slices.Sort(names)
+		if ai.ArchiveType != ARCHIVE_7Z || !slices.Equal(names, want) {
+			t.Fatalf("%s: type %d with %q", c.name, ai.ArchiveType, names)
+		}
+
+		for _, check := range []struct {
+			name    string
+			mode    fs.FileMode
+			content string
+		}{
+			{"project/README.md", 0o644, "# Project\n"},
+			{"project/src/main.go", 0o755, "package main\n"},
+			{"project/src/empty.txt", 0o444, ""},
+			{"project/empty/", fs.ModeDir | 0o755, ""},
+			{"project/LINK", fs.ModeSymlink | 0o777, "README.md"},
+		} {
+			af := ai.File(check.name)
+			if af.Mode() != check.mode || af.Encrypted() != (encrypted && check.content != "") {
+				t.Errorf("%s: %s is %v, encrypted %v", c.name, check.name, af.Mode(), af.Encrypted())
+			}
+			if af.IsDir {
+				continue
+			}
+			data, err := af.GetBytes()
+			if err != nil || string(data) != check.content {
+				t.Errorf("%s: %s reads %q, %v", c.name, check.name, data, err)
+			}
+			if crc, ok := af.CRC32(); !ok || crc != crc32.ChecksumIEEE(data) {
+				t.Errorf("%s: %s has CRC %08x, %v", c.name, check.name, crc, ok)
+			}
+		}
+		if got := ai.File("project/LINK").Linkname(); got != "README.md" {
+			t.Errorf("%s: LINK points to %q", c.name, got)
+		}
+		if got := ai.File("project/README.md").ModTime(); !got.Equal(time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)) {
+			t.Errorf("%s: README.md modified %v", c.name, got)
+		}
+		// The encrypted header hides the method.
+		if got := ai.File("project/src/main.go").Method(); got != "LZMA2" && !encrypted {
+			t.Errorf("%s: method %q", c.name, got)
+		}
+		// Solid archives have one stream for all the files.
+		if packed := ai.File("project/src/main.go").CompressedSize(); (packed < 0) != (c.opts != nil) {
+			t.Errorf("%s: main.go packed to %d", c.name, packed)
+		}
+	}
+
+	if _, err := GetArchiveInfo(filepath.Join(dir, "secret.7z"), WithPassword("wrong")); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("listing with the wrong password: %v", err)
+	}
+	dest := filepath.Join(dir, "secret.zip")
+	if err := CreateZip(dest, []string{root}, WithEncryption("hunter2")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("CreateZip with a password: %v", err)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		t.Error("CreateZip with a password left a file")
+	}
+
+	// Empty sources make an empty archive.
+	dest = filepath.Join(dir, "empty.7z")
+	if err := Create7z(dest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ai, err := GetArchiveInfo(dest); err != nil || len(ai.Files()) != 0 {
+		t.Errorf("empty archive: %v", err)
+	}
+}
+
+func TestAppendSZNumber(t *testing.T) {
+	for _, v := range []uint64{0, 0x7f, 0x80, 0x3fff, 0x4000, 1<<56 - 1, 1 << 56, 1<<64 - 1} {
+		b := appendSZNumber(nil, v)
+		got, err := readSZNumber(bytes.NewReader(b))
+		if err != nil || got != v {
+			t.Errorf("%#x wrote % x, read back %#x, %v", v, b, got, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// An archive's bytes, open for reading.  Close releases the file, if
+// there is one.
+type source struct {
+	io.ReaderAt
+	io.Closer
+	size int64
+}
+
+// The whole archive as a stream.
+func (s source) stream() *io.SectionReader { return io.NewSectionReader(s, 0, s.size) }
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// Reads fail with ctx.Err() once ctx is done; nil ctx for never.
+func (s source) withContext(ctx context.Context) source {
+	if ctx == nil {
+		return s
+	}
+	return source{&ctxReaderAt{ctx, s.ReaderAt}, s.Closer, s.size}
+}
+
+type ctxReaderAt struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+func (cr *ctxReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.ReadAt(p, off)
+}
+
+// Open the archive: the caller's reader for GetArchiveInfoFromReader,
+// the fs.FS file for GetArchiveInfoFSAt, the shared handle under
+// WithIdleTimeout, otherwise the file, opened afresh.
+func (ai *ArchiveInfo) openSource() (source, error) {
+	if ai.owner != nil {
+		src, err := ai.owner.openSource()
+		return src.withContext(ai.ctx), err
+	}
+	src, err := ai.openRawSource()
+	if timeout := ai.opts.readTimeout; timeout > 0 && err == nil {
+		src = src.withTimeout(timeout)
+	}
+	if ai.listed != nil && err == nil {
+		src.ReaderAt = readTracker{src.ReaderAt, ai.listed}
+	}
+	return src.withContext(ai.ctx), err
+}
+
+func (ai *ArchiveInfo) openRawSource() (source, error) {
+	if ai.reader != nil {
+		return source{ai.reader, nopCloser{}, ai.size}, nil
+	}
+	if ai.fsys != nil {
+		file, err := ai.fsys.Open(ai.fullname)
+		if err != nil {
+			return source{}, err
+		}
+		readerAt, ok := file.(io.ReaderAt)
+		if !ok {
+			file.Close()
+			return source{}, fmt.Errorf("%s: fs.File lost its ReadAt", ai.fullname)
+		}
+		return source{readerAt, file, ai.size}, nil
+	}
+	if ai.volumes != nil {
+		return ai.volumes.open()
+	}
+	if ai.opts.idleTimeout > 0 {
+		file, err := ai.handle.acquire(ai.fullname)
+		if err != nil {
+			return source{}, err
+		}
+		return source{file, &sharedRelease{sf: &ai.handle, timeout: ai.opts.idleTimeout}, ai.size}, nil
+	}
+	file, err := os.Open(ai.fullname)
+	if err != nil {
+		return source{}, err
+	}
+	return source{file, file, ai.size}, nil
+}
+
+// Release the file held open by WithIdleTimeout now rather than when it
+// goes idle.  A later read opens it again.  Without the option there's
+// nothing to release.
+func (ai *ArchiveInfo) Close() error {
+	return ai.handle.close(0)
+}
+
+// An archive file shared by concurrent readers, and closed by a timer once
+// the last of them is done.  Reads go through ReadAt, so one handle serves
+// them all.
+type sharedFile struct {
+	mu    sync.Mutex
+	file  *os.File
+	users int
+	idle  *time.Timer
+	gen   int // Bumped per timer, so a superseded one knows it
+}
+
+func (sf *sharedFile) acquire(path string) (*os.File, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if sf.idle != nil {
+		sf.idle.Stop()
+		sf.idle = nil
+	}
+	if sf.file == nil {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		sf.file = file
+	}
+	sf.users++
+	return sf.file, nil
+}
+
+func (sf *sharedFile) release(timeout time.Duration) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if sf.users--; sf.users > 0 || sf.file == nil {
+		return
+	}
+	sf.gen++
+	gen := sf.gen
+	sf.idle = time.AfterFunc(timeout, func() { sf.close(gen) })
+}
+
+// Close the file if it's unused.  A timer passes its generation, and only
+// closes if it's still the current one; 0 is an explicit Close.
+func (sf *sharedFile) close(gen int) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if sf.file == nil || sf.users > 0 || (gen != 0 && gen != sf.gen) {
+		return nil
+	}
+	if sf.idle != nil {
+		sf.idle.Stop()
+		sf.idle = nil
+	}
+	err := sf.file.Close()
+	sf.file = nil
+	return err
+}
+
+// A source's Closer for the shared file: hands it back rather than
+// closing it.
+type sharedRelease struct {
+	sf      *sharedFile
+	timeout time.Duration
+	once    sync.Once
+}
+
+func (sr *sharedRelease) Close() error {
+	sr.once.Do(func() { sr.sf.release(sr.timeout) })
+	return nil
+}
+
+// The entry's archive, opened.  Hand-built entries only have a path.
+func (af *ArchivedFile) openSource() (source, error) {
+	if af.archive != nil {
+		src, err := af.archive.openSource()
+		return src.withContext(af.ctx), err
+	}
+	file, err := os.Open(af.archivefile)
+	if err != nil {
+		return source{}, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return source{}, err
+	}
+	return source{file, file, info.Size()}.withContext(af.ctx), nil
+}
+
+// Read an archive that isn't a file of its own, such as an upload held in
+// memory or a section of a larger file.  r must stay readable for as long
+// as the ArchiveInfo is in use.  There's no file name to go on, so pass
+// WithNameHint to name the archive; it's used for ClaimedType, to tell a
+// brotli stream, and to name the entry of a single-file gzip stream.
+func GetArchiveInfoFromReader(r io.ReaderAt, size int64, opts ...Option) (*ArchiveInfo, error) {
+	ar := &ArchiveInfo{reader: r, size: size, opts: buildOptions(opts)}
+	ar.name = ar.opts.nameHint
+	ar.fullname = ar.name
+	if ar.fullname == "" {
+		ar.fullname = fmt.Sprintf("reader of %d bytes", size)
+	}
+	return ar, ar.load()
+}
+
+// Read the archive name from fsys.  Files that implement io.ReaderAt, as
+// os.DirFS and embed.FS files do, are read in place and opened afresh for
+// each read, like GetArchiveInfo's; anything else is read into memory once
+// here.
+func GetArchiveInfoFSAt(fsys fs.FS, name string, opts ...Option) (*ArchiveInfo, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, openError(name, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, openError(name, err)
+	}
+	ar := &ArchiveInfo{path: path.Dir(name), name: path.Base(name), fullname: name, size: info.Size(), opts: buildOptions(opts)}
+	if _, ok := file.(io.ReaderAt); ok {
+		ar.fsys = fsys
+	} else {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, openError(name, err)
+		}
+		ar.reader, ar.size = bytes.NewReader(data), int64(len(data))
+	}
+	return ar, ar.load()
+}
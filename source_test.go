@@ -0,0 +1,221 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGetArchiveInfoFromReader(t *testing.T) {
+	for _, test := range []struct {
+		filename string
+		hint     string
+		kind     ArchiveType
+		count    int
+	}{{"testassets/tree.zip", "bundle.zip", ARCHIVE_ZIP, 9},
+		{"testassets/sz_test.7z", "bundle.7z", ARCHIVE_7Z, 3},
+		{"testassets/tgz_test.tgz", "bundle.tgz", ARCHIVE_TGZ, 4},
+	} {
+		data, err := os.ReadFile(test.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ar, err := GetArchiveInfoFromReader(bytes.NewReader(data), int64(len(data)), WithNameHint(test.hint))
+		if err != nil {
+			t.Fatalf("%s error = %v", test.filename, err)
+		}
+		if ar.ArchiveType != test.kind || len(ar.Files()) != test.count || ar.Name() != test.hint || !ar.ExtensionMatchesType() {
+			t.Errorf("%s: type %v, %d entries, name %q", test.filename, ar.ArchiveType, len(ar.Files()), ar.Name())
+		}
+		// Reads go back to the reader; the path is never touched.
+		for _, af := range ar.Files() {
+			if af.mode.IsRegular() {
+				if _, err = af.GetBytes(); err != nil {
+					t.Errorf("%s GetBytes(%s) error = %v", test.filename, af.Name(), err)
+				}
+			}
+		}
+	}
+}
+
+func TestSingleFileGzip(t *testing.T) {
+	gzipped := func(storedName, content string) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		gw.Name = storedName
+		gw.Write([]byte(content))
+		gw.Close()
+		return buf.Bytes()
+	}
+	testdata := []struct {
+		storedName string
+		hint       string
+		want       string
+	}{{"", "report.csv.gz", "report.csv"},
+		{"", "", "data"},
+		{"original.csv", "renamed.csv.gz", "original.csv"},
+		{"../../etc/passwd", "x.gz", "passwd"},
+	}
+	for _, test := range testdata {
+		data := gzipped(test.storedName, "id,total\n1,42\n")
+		ar, err := GetArchiveInfoFromReader(bytes.NewReader(data), int64(len(data)), WithNameHint(test.hint))
+		if err != nil {
+			t.Fatalf("hint %q error = %v", test.hint, err)
+		}
+		if ar.ArchiveType != ARCHIVE_GZ || len(ar.Files()) != 1 {
+			t.Fatalf("hint %q: type %v with %d entries", test.hint, ar.ArchiveType, len(ar.Files()))
+		}
+		af := ar.FileAt(0)
+		if af.Name() != test.want || af.Size() != 14 {
+			t.Errorf("hint %q: entry %q size %d, want %q", test.hint, af.Name(), af.Size(), test.want)
+		}
+		if got, err := af.GetString(); got != "id,total\n1,42\n" || err != nil {
+			t.Errorf("hint %q: GetString() = %q, %v", test.hint, got, err)
+		}
+	}
+}
+
+func TestWithIdleTimeout(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/tree.zip", WithIdleTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	isOpen := func() bool {
+		ar.handle.mu.Lock()
+		defer ar.handle.mu.Unlock()
+		return ar.handle.file != nil
+	}
+	if !isOpen() {
+		t.Fatal("handle not kept open after listing")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for isOpen() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if isOpen() {
+		t.Fatal("handle not released after the idle timeout")
+	}
+
+	// Reopened transparently for the next read, then held again.
+	data, err := ar.File("docs/guide.md").GetBytes()
+	if err != nil || string(data) != "# Guide\n\nStart with the install section.\n" {
+		t.Errorf("GetBytes() = %q, %v", data, err)
+	}
+	if !isOpen() {
+		t.Error("handle not reopened by GetBytes")
+	}
+	if err = ar.Close(); err != nil || isOpen() {
+		t.Errorf("Close() = %v, open %v", err, isOpen())
+	}
+}
+
+// An fs.FS that counts how its files are read.
+type countingFS struct {
+	fs.FS
+	hideReadAt    bool
+	reads, readAt int
+	opens         int
+}
+
+type countedFile struct {
+	fs.File
+	fsys *countingFS
+}
+
+func (cf *countedFile) Read(p []byte) (int, error) {
+	cf.fsys.reads++
+	return cf.File.Read(p)
+}
+
+func (cf *countedFile) ReadAt(p []byte, off int64) (int, error) {
+	cf.fsys.readAt++
+	return cf.File.(io.ReaderAt).ReadAt(p, off)
+}
+
+func (cfs *countingFS) Open(name string) (fs.File, error) {
+	cfs.opens++
+	file, err := cfs.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if cfs.hideReadAt {
+		return struct{ fs.File }{&countedFile{file, cfs}}, nil
+	}
+	return &countedFile{file, cfs}, nil
+}
+
+func TestGetArchiveInfoFSAt(t *testing.T) {
+	for _, hide := range []bool{false, true} {
+		fsys := &countingFS{FS: os.DirFS("testassets"), hideReadAt: hide}
+		ar, err := GetArchiveInfoFSAt(fsys, "tree.zip")
+		if err != nil {
+			t.Fatalf("GetArchiveInfoFSAt() error = %v", err)
+		}
+		if len(ar.Files()) != 9 || ar.Name() != "tree.zip" {
+			t.Fatalf("%d entries, name %q", len(ar.Files()), ar.Name())
+		}
+		data, err := ar.File("docs/guide.md").GetBytes()
+		if err != nil || string(data) != "# Guide\n\nStart with the install section.\n" {
+			t.Errorf("GetBytes() = %q, %v", data, err)
+		}
+		if !hide && (fsys.reads != 0 || fsys.readAt == 0) {
+			t.Errorf("seekable file: %d Reads, %d ReadAts; want it read in place", fsys.reads, fsys.readAt)
+		}
+		// Without ReadAt it's buffered once, and not read again.
+		if hide && fsys.readAt != 0 {
+			t.Errorf("unseekable file: %d ReadAts", fsys.readAt)
+		}
+	}
+}
+
+// Done after n polls.
+func countdown(n int64) *countdownContext {
+	cc := &countdownContext{Context: context.Background()}
+	cc.left.Store(n)
+	return cc
+}
+
+func TestContextCancel(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, filename := range []string{"testassets/tree.zip", "testassets/sz_test.7z", "testassets/tgz_test.tgz", "testassets/test.rar"} {
+		if _, err := GetArchiveInfoContext(cancelled, filename); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: cancelled GetArchiveInfoContext error = %v", filename, err)
+		}
+		// Cancelled part way through the listing, the error is
+		// cancellation, not a corrupt archive.
+		if _, err := GetArchiveInfoContext(countdown(2), filename); !errors.Is(err, context.Canceled) || errors.Is(err, ErrCorruptArchive) {
+			t.Errorf("%s: GetArchiveInfoContext cancelled part way error = %v", filename, err)
+		}
+		ar, err := GetArchiveInfoContext(context.Background(), filename)
+		if err != nil {
+			t.Fatalf("%s: GetArchiveInfoContext error = %v", filename, err)
+		}
+		for _, af := range ar.Files() {
+			if !af.mode.IsRegular() || af.Size() == 0 {
+				continue
+			}
+			if _, err = af.GetBytesContext(cancelled); !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: cancelled GetBytesContext(%s) error = %v", filename, af.Name(), err)
+			}
+			if _, err = af.GetBytesContext(countdown(1)); !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: GetBytesContext(%s) cancelled part way error = %v", filename, af.Name(), err)
+			}
+			// The entry itself is untouched.
+			want, err := af.GetBytes()
+			if err != nil {
+				t.Fatalf("%s: GetBytes(%s) error = %v", filename, af.Name(), err)
+			}
+			got, err := af.GetBytesContext(context.Background())
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("%s: GetBytesContext(%s) = %d bytes, %v; want %d bytes", filename, af.Name(), len(got), err, len(want))
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+//go:build sparse
+
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Android sparse images (as written by img2simg and fastboot tooling) are
+// read as a single entry: the expanded raw image.  Build with -tags sparse.
+
+const (
+	sparseMagic         = 0xED26FF3A
+	sparseHeaderLen     = 28
+	sparseChunkLen      = 12
+	sparseChunkRaw      = 0xCAC1 // Block data follows
+	sparseChunkFill     = 0xCAC2 // Four-byte pattern repeated over the blocks
+	sparseChunkDontCare = 0xCAC3 // Unwritten; reads as zeros
+	sparseChunkCRC32    = 0xCAC4 // Checksum of the data so far; no blocks
+)
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_SPARSE,
+		detect: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte{0x3A, 0xFF, 0x26, 0xED})
+		},
+		load: loadSparseImage,
+		open: openSparseImage,
+	})
+}
+
+type sparseHeader struct {
+	Magic        uint32
+	MajorVersion uint16
+	MinorVersion uint16
+	FileHdrSize  uint16
+	ChunkHdrSize uint16
+	BlockSize    uint32
+	TotalBlocks  uint32
+	TotalChunks  uint32
+	Checksum     uint32
+}
+
+type sparseChunk struct {
+	Type      uint16
+	Reserved  uint16
+	Blocks    uint32 // Output size, in blocks
+	TotalSize uint32 // Input size, header included
+}
+
+func readSparseHeader(r io.ReaderAt) (sparseHeader, error) {
+	var head sparseHeader
+	err := binary.Read(io.NewSectionReader(r, 0, sparseHeaderLen), binary.LittleEndian, &head)
+	switch {
+	case err != nil:
+		return head, err
+	case head.MajorVersion != 1:
+		return head, fmt.Errorf("sparse image version %d.%d", head.MajorVersion, head.MinorVersion)
+	case head.FileHdrSize < sparseHeaderLen, head.ChunkHdrSize < sparseChunkLen:
+		return head, fmt.Errorf("sparse header sizes %d/%d", head.FileHdrSize, head.ChunkHdrSize)
+	case head.BlockSize == 0 || head.BlockSize%4 != 0:
+		return head, fmt.Errorf("sparse block size %d", head.BlockSize)
+	}
+	return head, nil
+}
+
+// The image name without its extension, as ".raw".
+func sparseEntryName(archiveName string) string {
+	return strings.TrimSuffix(archiveName, filepath.Ext(archiveName)) + ".raw"
+}
+
+func loadSparseImage(ar *ArchiveInfo) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	head, err := readSparseHeader(src)
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	// The image records no times of its own, so use the file's.
+	var modTime time.Time
+	if info, err := os.Stat(ar.fullname); err == nil && ar.reader == nil {
+		modTime = info.ModTime()
+	}
+	return ar.addFile(ArchivedFile{archivefile: ar.fullname, archivetype: ARCHIVE_SPARSE, name: sparseEntryName(ar.name),
+		size: int64(head.TotalBlocks) * int64(head.BlockSize), mode: 0o644, modTime: modTime, method: "sparse",
+		packed: ar.size})
+}
+
+// Walk the chunk headers and stitch the output together from pieces, so
+// nothing larger than a fill pattern is held in memory.
+func openSparseImage(af *ArchivedFile) (io.ReadCloser, error) {
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	pieces, err := sparsePieces(src)
+	if err != nil {
+		src.Close()
+		return nil, openError(af.archivefile, err)
+	}
+	return &entryReader{io.MultiReader(pieces...), []io.Closer{src}}, nil
+}
+
+func sparsePieces(r io.ReaderAt) ([]io.Reader, error) {
+	head, err := readSparseHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	var pieces []io.Reader
+	var blocks uint64
+	offset := int64(head.FileHdrSize)
+	for i := uint32(0); i < head.TotalChunks; i++ {
+		var chunk sparseChunk
+		if err = binary.Read(io.NewSectionReader(r, offset, sparseChunkLen), binary.LittleEndian, &chunk); err != nil {
+			return nil, fmt.Errorf("sparse chunk %d: %w", i, err)
+		}
+		dataOffset := offset + int64(head.ChunkHdrSize)
+		dataLen := int64(chunk.TotalSize) - int64(head.ChunkHdrSize)
+		outLen := int64(chunk.Blocks) * int64(head.BlockSize)
+		switch chunk.Type {
+		case sparseChunkRaw:
+			if dataLen != outLen {
+				return nil, fmt.Errorf("sparse chunk %d: %d bytes for %d blocks", i, dataLen, chunk.Blocks)
+			}
+			pieces = append(pieces, io.NewSectionReader(r, dataOffset, dataLen))
+		case sparseChunkFill:
+			pattern := make([]byte, 4)
+			if dataLen != 4 {
+				return nil, fmt.Errorf("sparse chunk %d: fill of %d bytes", i, dataLen)
+			}
+			if _, err = r.ReadAt(pattern, dataOffset); err != nil {
+				return nil, fmt.Errorf("sparse chunk %d: %w", i, err)
+			}
+			pieces = append(pieces, io.LimitReader(&repeatReader{pattern: pattern}, outLen))
+		case sparseChunkDontCare:
+			pieces = append(pieces, io.LimitReader(&repeatReader{pattern: []byte{0}}, outLen))
+		case sparseChunkCRC32:
+			// Nothing to output, and the checksum isn't verified.
+		default:
+			return nil, fmt.Errorf("sparse chunk %d: unknown type %#x", i, chunk.Type)
+		}
+		blocks += uint64(chunk.Blocks)
+		offset += int64(chunk.TotalSize)
+	}
+	if blocks != uint64(head.TotalBlocks) {
+		return nil, fmt.Errorf("sparse chunks cover %d of %d blocks", blocks, head.TotalBlocks)
+	}
+	return pieces, nil
+}
+
+// Endless repetition of a short pattern.
+type repeatReader struct {
+	pattern []byte
+	pos     int
+}
+
+func (rr *repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = rr.pattern[rr.pos]
+		rr.pos = (rr.pos + 1) % len(rr.pattern)
+	}
+	return len(p), nil
+}
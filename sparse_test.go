@@ -0,0 +1,47 @@
+//go:build sparse
+
+package archiver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+func TestSparseImage(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/sparse.simg")
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	if ar.ArchiveType != ARCHIVE_SPARSE || len(ar.Files()) != 1 {
+		t.Fatalf("ArchiveType = %v with %d entries", ar.ArchiveType, len(ar.Files()))
+	}
+	af := ar.File("sparse.raw")
+	if af == nil || af.Size() != 5*4096 {
+		t.Fatalf("File(sparse.raw) = %v", af)
+	}
+	// Raw, fill, fill, don't-care, raw blocks.
+	data, err := af.GetBytes()
+	if err != nil {
+		t.Fatalf("GetBytes() error = %v", err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != "cf5996f40cef94d3a02ecd51714e68781f4c2a542ba7b71094ea1914292dff44" {
+		t.Errorf("image sha256 = %s", got)
+	}
+	if !bytes.Equal(data[4096:4100], []byte{0xEF, 0xBE, 0xAD, 0xDE}) || data[3*4096] != 0 {
+		t.Error("fill or don't-care blocks not expanded")
+	}
+
+	rc, err := ar.OpenAt(0)
+	if err != nil {
+		t.Fatalf("OpenAt(0) error = %v", err)
+	}
+	defer rc.Close()
+	streamed, _ := io.ReadAll(rc)
+	if !bytes.Equal(streamed, data) {
+		t.Error("OpenAt(0) differs from GetBytes()")
+	}
+}
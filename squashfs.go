@@ -0,0 +1,594 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Squashfs 4.0 images, as firmware, snaps and AppImages carry.  Metadata
+// (inodes, directories, the fragment table) is in blocks of up to 8K,
+// compressed separately; a file's data is in blocks of the image's block
+// size, with its tail possibly packed into a fragment block shared with
+// other files' tails.
+
+const (
+	squashMagic        = "hsqs"
+	squashSuperLen     = 96
+	squashMetaSize     = 8192
+	squashMetaStored   = 0x8000  // In a metadata block's header: not compressed
+	squashBlockStored  = 1 << 24 // In a data block's size: not compressed
+	squashNoFragment   = 0xFFFFFFFF
+	squashFragsPerMeta = squashMetaSize / 16
+)
+
+// Compressor ids.
+const (
+	squashZlib = 1 + iota
+	squashLZMA
+	squashLZO
+	squashXZ
+	squashLZ4
+	squashZstd
+)
+
+var squashMethods = map[uint16]string{squashZlib: "Deflate", squashLZMA: "LZMA", squashLZO: "LZO",
+	squashXZ: "LZMA2", squashLZ4: "LZ4", squashZstd: "ZStandard"}
+
+// Inode types, basic then extended.  An extended inode has wider fields
+// and an xattr index, and lists as its basic type.
+const (
+	squashDir = 1 + iota
+	squashFile
+	squashSymlink
+	squashBlockDev
+	squashCharDev
+	squashFIFO
+	squashSocket
+	squashExtended = 7 // Added to a basic type
+)
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_SQUASHFS,
+		detect:      func(header []byte) bool { return bytes.HasPrefix(header, []byte(squashMagic)) },
+		load:        loadSquashfs,
+		open:        openSquashfsEntry,
+	})
+}
+
+// An image open for reading, with the superblock fields in use.
+type squashfs struct {
+	src        source
+	compressor uint16
+	blockSize  int64
+	fragCount  uint32
+	rootInode  uint64
+	inodeTable int64
+	dirTable   int64
+	fragTable  int64
+	metaCache  map[int64]squashMetaBlock
+}
+
+// A decompressed metadata block and where the next one starts.
+type squashMetaBlock struct {
+	data []byte
+	next int64
+}
+
+func openSquashfs(src source) (*squashfs, error) {
+	sb := make([]byte, squashSuperLen)
+	if _, err := src.ReadAt(sb, 0); err != nil {
+		return nil, fmt.Errorf("squashfs superblock: %w", noEOF(err))
+	}
+	if string(sb[:4]) != squashMagic {
+		return nil, fmt.Errorf("%w: bad squashfs magic", ErrCorruptArchive)
+	}
+	le := binary.LittleEndian
+	if major, minor := le.Uint16(sb[28:]), le.Uint16(sb[30:]); major != 4 || minor != 0 {
+		return nil, fmt.Errorf("%w: squashfs version %d.%d", ErrUnsupportedFormat, major, minor)
+	}
+	sq := &squashfs{src: src, compressor: le.Uint16(sb[20:]), blockSize: int64(le.Uint32(sb[12:])),
+		fragCount: le.Uint32(sb[16:]), rootInode: le.Uint64(sb[32:]), inodeTable: int64(le.Uint64(sb[64:])),
+		dirTable: int64(le.Uint64(sb[72:])), fragTable: int64(le.Uint64(sb[80:])),
+		metaCache: make(map[int64]squashMetaBlock)}
+	if sq.blockSize < 4096 || sq.blockSize > 1<<20 || sq.blockSize&(sq.blockSize-1) != 0 ||
+		int64(1)<<le.Uint16(sb[22:]) != sq.blockSize {
+		return nil, fmt.Errorf("%w: bad squashfs block size %d", ErrCorruptArchive, sq.blockSize)
+	}
+	switch sq.compressor {
+	case squashZlib, squashLZMA, squashXZ, squashZstd:
+	case squashLZO, squashLZ4:
+		return nil, fmt.Errorf("%w: squashfs %s compression", ErrUnsupportedFormat, squashMethods[sq.compressor])
+	default:
+		return nil, fmt.Errorf("%w: squashfs compressor %d", ErrUnsupportedFormat, sq.compressor)
+	}
+	return sq, nil
+}
+
+// Decompress a block that holds at most limit bytes.
+func (sq *squashfs) decompress(data []byte, limit int64) ([]byte, error) {
+	in := bytes.NewReader(data)
+	var r io.Reader
+	var err error
+	switch sq.compressor {
+	case squashZlib:
+		var zr io.ReadCloser
+		if zr, err = zlib.NewReader(in); err == nil {
+			defer zr.Close()
+			r = zr
+		}
+	case squashLZMA:
+		r, err = lzma.NewReader(in)
+	case squashXZ:
+		r, err = xz.NewReader(in)
+	case squashZstd:
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(in, zstd.WithDecoderConcurrency(1)); err == nil {
+			defer zr.Close()
+			r = zr
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptArchive, err)
+	}
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptArchive, err)
+	}
+	if int64(len(out)) > limit {
+		return nil, fmt.Errorf("%w: squashfs block over %d bytes", ErrCorruptArchive, limit)
+	}
+	return out, nil
+}
+
+// The metadata block at offset.
+func (sq *squashfs) metaBlock(offset int64) (squashMetaBlock, error) {
+	if b, ok := sq.metaCache[offset]; ok {
+		return b, nil
+	}
+	head := make([]byte, 2)
+	if _, err := sq.src.ReadAt(head, offset); err != nil {
+		return squashMetaBlock{}, fmt.Errorf("squashfs metadata at %d: %w", offset, noEOF(err))
+	}
+	header := binary.LittleEndian.Uint16(head)
+	length := int64(header &^ squashMetaStored)
+	if length == 0 || length > squashMetaSize {
+		return squashMetaBlock{}, fmt.Errorf("%w: bad squashfs metadata block at %d", ErrCorruptArchive, offset)
+	}
+	data := make([]byte, length)
+	if _, err := sq.src.ReadAt(data, offset+2); err != nil {
+		return squashMetaBlock{}, fmt.Errorf("squashfs metadata at %d: %w", offset, noEOF(err))
+	}
+	if header&squashMetaStored == 0 {
+		var err error
+		if data, err = sq.decompress(data, squashMetaSize); err != nil {
+			return squashMetaBlock{}, fmt.Errorf("squashfs metadata at %d: %w", offset, err)
+		}
+	}
+	b := squashMetaBlock{data, offset + 2 + length}
+	sq.metaCache[offset] = b
+	return b, nil
+}
+
+// Reads metadata on from a position, across block boundaries.
+type squashMetaReader struct {
+	sq   *squashfs
+	buf  []byte
+	next int64
+}
+
+// A reader from offset into the decompressed block at block.
+func (sq *squashfs) metaReader(block int64, offset int) (*squashMetaReader, error) {
+	b, err := sq.metaBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	if offset > len(b.data) {
+		return nil, fmt.Errorf("%w: squashfs metadata offset %d past its block", ErrCorruptArchive, offset)
+	}
+	return &squashMetaReader{sq, b.data[offset:], b.next}, nil
+}
+
+func (mr *squashMetaReader) Read(p []byte) (int, error) {
+	for len(mr.buf) == 0 {
+		if mr.next >= mr.sq.src.size {
+			return 0, io.EOF
+		}
+		b, err := mr.sq.metaBlock(mr.next)
+		if err != nil {
+			return 0, err
+		}
+		mr.buf, mr.next = b.data, b.next
+	}
+	n := copy(p, mr.buf)
+	mr.buf = mr.buf[n:]
+	return n, nil
+}
+
+// Read fixed-size little-endian fields into data.
+func (mr *squashMetaReader) read(data any) error {
+	return noEOF(binary.Read(mr, binary.LittleEndian, data))
+}
+
+// The fields of an inode that listing and reading use.
+type squashInode struct {
+	kind   uint16 // Basic type
+	mode   uint32 // Permission bits
+	mtime  uint32
+	number uint32
+	nlink  uint32
+	size   int64
+	// Directories: where the listing is in the directory table.
+	dirBlock  uint32
+	dirOffset uint16
+	// Regular files: the data blocks, then the tail's fragment, if any.
+	blocksStart int64
+	blockSizes  []uint32
+	fragment    uint32
+	fragOffset  uint32
+	target      string // Symlinks
+	rdev        uint32 // Devices
+}
+
+// The inode ref points to: a block's offset in the inode table, shifted
+// up 16 bits, and the offset within it.
+func (sq *squashfs) inode(ref uint64) (*squashInode, error) {
+	mr, err := sq.metaReader(sq.inodeTable+int64(ref>>16), int(ref&0xffff))
+	if err != nil {
+		return nil, err
+	}
+	var common struct {
+		Kind, Mode, UID, GID uint16
+		Mtime, Number        uint32
+	}
+	if err := mr.read(&common); err != nil {
+		return nil, err
+	}
+	ino := &squashInode{kind: common.Kind, mode: uint32(common.Mode & 0o7777), mtime: common.Mtime,
+		number: common.Number, nlink: 1, fragment: squashNoFragment}
+	if ino.kind > squashExtended {
+		ino.kind -= squashExtended
+	}
+	switch common.Kind {
+	case squashDir:
+		var d struct {
+			Block, Nlink uint32
+			Size, Offset uint16
+			Parent       uint32
+		}
+		err = mr.read(&d)
+		ino.dirBlock, ino.nlink, ino.size, ino.dirOffset = d.Block, d.Nlink, int64(d.Size), d.Offset
+	case squashDir + squashExtended:
+		var d struct {
+			Nlink, Size, Block, Parent uint32
+			Indexes, Offset            uint16
+			Xattr                      uint32
+		}
+		err = mr.read(&d)
+		ino.dirBlock, ino.nlink, ino.size, ino.dirOffset = d.Block, d.Nlink, int64(d.Size), d.Offset
+	case squashFile:
+		var f struct{ Start, Fragment, Offset, Size uint32 }
+		err = mr.read(&f)
+		ino.blocksStart, ino.fragment, ino.fragOffset, ino.size = int64(f.Start), f.Fragment, f.Offset, int64(f.Size)
+	case squashFile + squashExtended:
+		var f struct {
+			Start, Size, Sparse            uint64
+			Nlink, Fragment, Offset, Xattr uint32
+		}
+		err = mr.read(&f)
+		ino.blocksStart, ino.size, ino.nlink = int64(f.Start), int64(f.Size), f.Nlink
+		ino.fragment, ino.fragOffset = f.Fragment, f.Offset
+	case squashSymlink, squashSymlink + squashExtended:
+		var s struct{ Nlink, Size uint32 }
+		if err = mr.read(&s); err == nil && s.Size > cpioMaxNameLen {
+			err = fmt.Errorf("%w: squashfs symlink of %d bytes", ErrCorruptArchive, s.Size)
+		}
+		if err == nil {
+			target := make([]byte, s.Size)
+			err = mr.read(target)
+			ino.nlink, ino.target = s.Nlink, string(target)
+		}
+	case squashBlockDev, squashCharDev, squashBlockDev + squashExtended, squashCharDev + squashExtended:
+		var d struct{ Nlink, Rdev uint32 }
+		err = mr.read(&d)
+		ino.nlink, ino.rdev = d.Nlink, d.Rdev
+	case squashFIFO, squashSocket, squashFIFO + squashExtended, squashSocket + squashExtended:
+		err = mr.read(&ino.nlink)
+	default:
+		return nil, fmt.Errorf("%w: squashfs inode type %d", ErrCorruptArchive, common.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ino.kind == squashFile {
+		if ino.size < 0 {
+			return nil, fmt.Errorf("%w: squashfs file of %d bytes", ErrCorruptArchive, ino.size)
+		}
+		// A tail that isn't in a fragment gets a block of its own.
+		blocks := ino.size / sq.blockSize
+		if ino.fragment == squashNoFragment && ino.size%sq.blockSize != 0 {
+			blocks++
+		}
+		// Read in pieces, so a bad count runs out of metadata before it
+		// runs out of memory.
+		for int64(len(ino.blockSizes)) < blocks {
+			chunk := make([]uint32, min(blocks-int64(len(ino.blockSizes)), 1024))
+			if err := mr.read(chunk); err != nil {
+				return nil, err
+			}
+			ino.blockSizes = append(ino.blockSizes, chunk...)
+		}
+	}
+	return ino, nil
+}
+
+// The unix mode of ino, type bits and all.
+func (ino *squashInode) unixMode() uint32 {
+	types := [...]uint32{squashDir: 0o040000, squashFile: 0o100000, squashSymlink: 0o120000,
+		squashBlockDev: 0o060000, squashCharDev: 0o020000, squashFIFO: 0o010000, squashSocket: 0o140000}
+	return types[ino.kind] | ino.mode
+}
+
+// One name in a directory listing.
+type squashDirEntry struct {
+	name string
+	ref  uint64 // Of the inode
+}
+
+// The entries of directory dir.  Its size counts 3 bytes more than the
+// listing, for the "." and ".." it doesn't store.
+func (sq *squashfs) readDir(dir *squashInode) ([]squashDirEntry, error) {
+	if dir.size <= 3 {
+		return nil, nil
+	}
+	mr, err := sq.metaReader(sq.dirTable+int64(dir.dirBlock), int(dir.dirOffset))
+	if err != nil {
+		return nil, err
+	}
+	r := io.LimitReader(mr, dir.size-3)
+	var entries []squashDirEntry
+	for {
+		var head struct{ Count, Start, Number uint32 }
+		if err := binary.Read(r, binary.LittleEndian, &head); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, noEOF(err)
+		}
+		if head.Count >= 256 {
+			return nil, fmt.Errorf("%w: squashfs directory header of %d entries", ErrCorruptArchive, head.Count+1)
+		}
+		for i := uint32(0); i <= head.Count; i++ {
+			var e struct {
+				Offset   uint16
+				Delta    int16
+				Kind     uint16
+				NameSize uint16
+			}
+			if err := binary.Read(r, binary.LittleEndian, &e); err != nil {
+				return nil, noEOF(err)
+			}
+			name := make([]byte, int(e.NameSize)+1)
+			if _, err := io.ReadFull(r, name); err != nil {
+				return nil, noEOF(err)
+			}
+			entries = append(entries, squashDirEntry{string(name), uint64(head.Start)<<16 | uint64(e.Offset)})
+		}
+	}
+}
+
+// Where fragment block i is, and its size as a data block's is given.
+func (sq *squashfs) fragmentEntry(i uint32) (int64, uint32, error) {
+	if i >= sq.fragCount {
+		return 0, 0, fmt.Errorf("%w: squashfs fragment %d of %d", ErrCorruptArchive, i, sq.fragCount)
+	}
+	pointer := make([]byte, 8)
+	if _, err := sq.src.ReadAt(pointer, sq.fragTable+8*int64(i/squashFragsPerMeta)); err != nil {
+		return 0, 0, fmt.Errorf("squashfs fragment table: %w", noEOF(err))
+	}
+	mr, err := sq.metaReader(int64(binary.LittleEndian.Uint64(pointer)), int(i%squashFragsPerMeta)*16)
+	if err != nil {
+		return 0, 0, err
+	}
+	var entry struct {
+		Start        uint64
+		Size, Unused uint32
+	}
+	if err := mr.read(&entry); err != nil {
+		return 0, 0, err
+	}
+	return int64(entry.Start), entry.Size, nil
+}
+
+// The data block of on-disk size field size at offset, decompressed.
+func (sq *squashfs) dataBlock(offset int64, size uint32) ([]byte, error) {
+	length := int64(size &^ squashBlockStored)
+	if length > sq.blockSize {
+		return nil, fmt.Errorf("%w: squashfs block of %d bytes", ErrCorruptArchive, length)
+	}
+	data := make([]byte, length)
+	if _, err := sq.src.ReadAt(data, offset); err != nil {
+		return nil, fmt.Errorf("squashfs block at %d: %w", offset, noEOF(err))
+	}
+	if size&squashBlockStored != 0 {
+		return data, nil
+	}
+	return sq.decompress(data, sq.blockSize)
+}
+
+func loadSquashfs(ar *ArchiveInfo) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	sq, err := openSquashfs(src)
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	root, err := sq.inode(sq.rootInode)
+	if err == nil && root.kind != squashDir {
+		err = fmt.Errorf("%w: squashfs root isn't a directory", ErrCorruptArchive)
+	}
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	w := &squashWalker{ar: ar, sq: sq, visited: map[uint32]bool{root.number: true}, linked: make(map[uint32]string)}
+	return w.walkDir(root, "", 0)
+}
+
+type squashWalker struct {
+	ar      *ArchiveInfo
+	sq      *squashfs
+	count   int
+	visited map[uint32]bool   // Directory inodes walked, against loops
+	linked  map[uint32]string // First name of each file with several
+}
+
+// List the directory under prefix, then each subdirectory in turn, as
+// isoWalker does.
+func (w *squashWalker) walkDir(dir *squashInode, prefix string, depth int) error {
+	entries, err := w.sq.readDir(dir)
+	if err != nil {
+		return openError(w.ar.fullname, fmt.Errorf("%s: %w", prefix, err))
+	}
+	var subdirs []*squashInode
+	var subnames []string
+	for _, e := range entries {
+		name := path.Join(prefix, e.name)
+		ino, err := w.sq.inode(e.ref)
+		if err != nil {
+			return openError(w.ar.fullname, fmt.Errorf("%s: %w", name, err))
+		}
+		af := ArchivedFile{archivefile: w.ar.fullname, archivetype: ARCHIVE_SQUASHFS, name: name,
+			mode: unixFileMode(ino.unixMode()), modTime: time.Unix(int64(ino.mtime), 0).UTC(), packed: -1,
+			inode: e.ref, index: w.count}
+		switch ino.kind {
+		case squashDir:
+			if w.visited[ino.number] || depth >= isoMaxDepth {
+				continue
+			}
+			w.visited[ino.number] = true
+			af.IsDir = true
+			subdirs, subnames = append(subdirs, ino), append(subnames, name)
+		case squashFile:
+			af.size, af.method = ino.size, squashMethods[w.sq.compressor]
+			if first, ok := w.linked[ino.number]; ok {
+				af.size, af.hardlink, af.linkname = 0, true, first
+			} else if ino.nlink > 1 {
+				w.linked[ino.number] = name
+			}
+			if ino.fragment == squashNoFragment && !af.hardlink {
+				af.packed = 0
+				for _, size := range ino.blockSizes {
+					af.packed += int64(size &^ squashBlockStored)
+				}
+			}
+		case squashSymlink:
+			af.linkname = ino.target
+		case squashBlockDev, squashCharDev:
+			af.devMajor, af.devMinor = int64(ino.rdev>>8&0xfff), int64(ino.rdev&0xff|ino.rdev>>12&0xfff00)
+		}
+		w.count++
+		if err := w.ar.addFile(af); err != nil {
+			return err
+		}
+	}
+	for i, sub := range subdirs {
+		if err := w.walkDir(sub, subnames[i], depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func openSquashfsEntry(af *ArchivedFile) (io.ReadCloser, error) {
+	if !af.mode.IsRegular() || af.hardlink {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	sq, err := openSquashfs(src)
+	var ino *squashInode
+	if err == nil {
+		ino, err = sq.inode(af.inode)
+	}
+	if err == nil && ino.kind != squashFile {
+		err = fmt.Errorf("%w: squashfs inode of %s isn't a file", ErrCorruptArchive, af.name)
+	}
+	if err != nil {
+		src.Close()
+		return nil, openError(af.archivefile, err)
+	}
+	return &entryReader{&squashFileReader{sq: sq, ino: ino, offset: ino.blocksStart, left: ino.size}, []io.Closer{src}}, nil
+}
+
+// Reads a file's blocks in turn, then its tail from the fragment block.
+type squashFileReader struct {
+	sq     *squashfs
+	ino    *squashInode
+	block  int   // Next in ino.blockSizes
+	offset int64 // Of that block in the image
+	left   int64 // Unread bytes of the file
+	buf    []byte
+}
+
+func (fr *squashFileReader) Read(p []byte) (int, error) {
+	if len(fr.buf) == 0 {
+		if fr.left == 0 {
+			return 0, io.EOF
+		}
+		if err := fr.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, fr.buf)
+	fr.buf = fr.buf[n:]
+	return n, nil
+}
+
+// Load the next block's worth of the file into buf.
+func (fr *squashFileReader) fill() error {
+	want := min(fr.left, fr.sq.blockSize)
+	var data []byte
+	if fr.block < len(fr.ino.blockSizes) {
+		size := fr.ino.blockSizes[fr.block]
+		fr.block++
+		if size == 0 { // Sparse
+			data = make([]byte, want)
+		} else {
+			var err error
+			if data, err = fr.sq.dataBlock(fr.offset, size); err != nil {
+				return err
+			}
+			fr.offset += int64(size &^ squashBlockStored)
+		}
+	} else {
+		start, size, err := fr.sq.fragmentEntry(fr.ino.fragment)
+		if err != nil {
+			return err
+		}
+		if data, err = fr.sq.dataBlock(start, size); err != nil {
+			return err
+		}
+		if int64(fr.ino.fragOffset) > int64(len(data)) {
+			return fmt.Errorf("%w: squashfs fragment offset %d past its block", ErrCorruptArchive, fr.ino.fragOffset)
+		}
+		data = data[fr.ino.fragOffset:]
+	}
+	if int64(len(data)) < want {
+		return fmt.Errorf("%w: short squashfs block", ErrCorruptArchive)
+	}
+	fr.buf, fr.left = data[:want], fr.left-want
+	return nil
+}
@@ -0,0 +1,184 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func zlibBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// Appends little-endian fields in turn.
+type testLE struct{ b []byte }
+
+func (w *testLE) u16(v ...uint16) *testLE {
+	for _, x := range v {
+		w.b = binary.LittleEndian.AppendUint16(w.b, x)
+	}
+	return w
+}
+
+func (w *testLE) u32(v ...uint32) *testLE {
+	for _, x := range v {
+		w.b = binary.LittleEndian.AppendUint32(w.b, x)
+	}
+	return w
+}
+
+func (w *testLE) u64(v ...uint64) *testLE {
+	for _, x := range v {
+		w.b = binary.LittleEndian.AppendUint64(w.b, x)
+	}
+	return w
+}
+
+const testSquashTime = 1700000000
+
+// A zlib squashfs image with 4K blocks:
+//
+//	hello.txt      in the fragment block, and linked as dir/hard
+//	link           symlink to hello.txt
+//	dir/big.bin    an extended inode: a compressed block, a stored one and a tail in the fragment
+//	dir/sparse     a hole, then a tail block of its own
+//	dir/null       character device 1, 3
+//
+// The inode table is a compressed metadata block, the directory table a
+// stored one.
+func buildTestSquashfs() ([]byte, map[string]string) {
+	hello := "hello\n"
+	big := strings.Repeat("squashfs", 512) + strings.Repeat("0123456789abcdef", 256) + strings.Repeat("t", 100)
+	sparse := string(make([]byte, 4096)) + "sparse end"
+	want := map[string]string{"hello.txt": hello, "dir/big.bin": big, "dir/sparse": sparse, "dir/hard": ""}
+
+	img := make([]byte, squashSuperLen)
+	bigStart := len(img)
+	block0 := zlibBytes([]byte(big[:4096]))
+	img = append(img, block0...)
+	img = append(img, big[4096:8192]...)
+	sparseStart := len(img)
+	img = append(img, sparse[4096:]...)
+	fragStart := len(img)
+	frag := zlibBytes([]byte(hello + big[8192:]))
+	img = append(img, frag...)
+
+	// Inodes, each recording its offset for the directory entries.
+	inodes := &testLE{}
+	refs := make(map[string]uint16)
+	common := func(name string, kind, mode uint16, number uint32) *testLE {
+		refs[name] = uint16(len(inodes.b))
+		return inodes.u16(kind, mode, 0, 0).u32(testSquashTime, number)
+	}
+	// A second name needs an extended inode, for the link count.
+	common("hello.txt", squashFile+squashExtended, 0o644, 1).u64(0, uint64(len(hello)), 0).u32(2, 0, 0, 0xFFFFFFFF)
+	common("dir/big.bin", squashFile+squashExtended, 0o755, 2).u64(uint64(bigStart), uint64(len(big)), 0).
+		u32(1, 0, uint32(len(hello)), 0xFFFFFFFF, uint32(len(block0)), 4096|squashBlockStored)
+	common("dir/sparse", squashFile, 0o600, 3).u32(uint32(sparseStart), squashNoFragment, 0, uint32(len(sparse))).
+		u32(0, 10|squashBlockStored)
+	common("link", squashSymlink, 0o777, 4).u32(1, 9)
+	inodes.b = append(inodes.b, "hello.txt"...)
+	common("dir/null", squashCharDev, 0o666, 5).u32(1, 1<<8|3)
+
+	// Directory listings: one header, then the entries, each a name and
+	// the inode it names.
+	dirs := &testLE{}
+	numbers := map[string]uint32{"hello.txt": 1, "dir/big.bin": 2, "dir/sparse": 3, "link": 4, "dir/null": 5, "dir": 6}
+	kinds := map[string]uint16{"hello.txt": squashFile, "dir/big.bin": squashFile, "dir/sparse": squashFile,
+		"link": squashSymlink, "dir/null": squashCharDev, "dir": squashDir}
+	listing := func(entries ...[2]string) (offset, size uint16) {
+		at := len(dirs.b)
+		dirs.u32(uint32(len(entries)-1), 0, 1)
+		for _, e := range entries {
+			dirs.u16(refs[e[1]], uint16(numbers[e[1]]-1), kinds[e[1]], uint16(len(e[0])-1))
+			dirs.b = append(dirs.b, e[0]...)
+		}
+		return uint16(at), uint16(len(dirs.b) - at + 3)
+	}
+	dirAt, dirSize := listing([2]string{"big.bin", "dir/big.bin"}, [2]string{"hard", "hello.txt"},
+		[2]string{"null", "dir/null"}, [2]string{"sparse", "dir/sparse"})
+	common("dir", squashDir, 0o755, 6).u32(0, 2).u16(dirSize, dirAt).u32(7)
+	rootAt, rootSize := listing([2]string{"dir", "dir"}, [2]string{"hello.txt", "hello.txt"}, [2]string{"link", "link"})
+	common("", squashDir, 0o755, 7).u32(0, 3).u16(rootSize, rootAt).u32(8)
+
+	inodeTable := len(img)
+	packed := zlibBytes(inodes.b)
+	img = binary.LittleEndian.AppendUint16(img, uint16(len(packed)))
+	img = append(img, packed...)
+	dirTable := len(img)
+	img = binary.LittleEndian.AppendUint16(img, uint16(len(dirs.b))|squashMetaStored)
+	img = append(img, dirs.b...)
+	fragEntries := len(img)
+	entry := (&testLE{}).u64(uint64(fragStart)).u32(uint32(len(frag)), 0).b
+	img = binary.LittleEndian.AppendUint16(img, uint16(len(entry))|squashMetaStored)
+	img = append(img, entry...)
+	fragTable := len(img)
+	img = binary.LittleEndian.AppendUint64(img, uint64(fragEntries))
+
+	sb := (&testLE{}).u32(0x73717368, 7, testSquashTime, 4096, 1).u16(squashZlib, 12, 0, 1, 4, 0).
+		u64(uint64(refs[""]), uint64(len(img)), 0, ^uint64(0), uint64(inodeTable), uint64(dirTable),
+			uint64(fragTable), ^uint64(0))
+	copy(img, sb.b)
+	return img, want
+}
+
+func TestSquashfs(t *testing.T) {
+	img, want := buildTestSquashfs()
+	name := filepath.Join(t.TempDir(), "firmware.squashfs")
+	if err := os.WriteFile(name, img, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := GetArchiveInfo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, af := range ai.Files() {
+		names = append(names, af.Name())
+	}
+	if got := strings.Join(names, ","); ai.ArchiveType != ARCHIVE_SQUASHFS ||
+		got != "dir,hello.txt,link,dir/big.bin,dir/hard,dir/null,dir/sparse" {
+		t.Fatalf("type %v, entries %s", ai.ArchiveType, got)
+	}
+	for name, content := range want {
+		af := ai.File(name)
+		if got, err := af.GetBytes(); err != nil || string(got) != content {
+			t.Errorf("%s: %d bytes, %v; want %d", name, len(got), err, len(content))
+		}
+		if !af.ModTime().Equal(time.Unix(testSquashTime, 0)) {
+			t.Errorf("%s: time %v", name, af.ModTime())
+		}
+	}
+	if af := ai.File("dir/big.bin"); af.Mode() != 0o755 || af.Method() != "Deflate" {
+		t.Errorf("big.bin: mode %v, method %q", af.Mode(), af.Method())
+	}
+	if af := ai.File("dir/hard"); !af.hardlink || af.linkname != "hello.txt" {
+		t.Errorf("hard: hardlink %v to %q", af.hardlink, af.linkname)
+	}
+	if af := ai.File("link"); af.Mode()&fs.ModeSymlink == 0 || af.linkname != "hello.txt" {
+		t.Errorf("link: mode %v, target %q", af.Mode(), af.linkname)
+	}
+	if major, minor := ai.File("dir/null").Device(); major != 1 || minor != 3 {
+		t.Errorf("null: device %d, %d", major, minor)
+	}
+	if !ai.File("dir").IsDir {
+		t.Error("dir isn't a directory")
+	}
+
+	lzo := bytes.Clone(img)
+	binary.LittleEndian.PutUint16(lzo[20:], squashLZO)
+	if _, err := GetArchiveInfoFromReader(bytes.NewReader(lzo), int64(len(lzo))); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("lzo image: %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/nwaples/rardecode/v2"
+)
+
+// Stream every listed entry's content to fn, in listing order, holding no
+// more than the one entry open at a time.  tar, RAR, cpio, RPM and CAB
+// archives are read in a single pass, so they're visited in archive order
+// even under WithSortedListing.  The reader is only valid until fn
+// returns.  An error from fn stops the iteration and is returned as-is.
+func (ai *ArchiveInfo) ForEach(fn func(*ArchivedFile, io.Reader) error) error {
+	fn = ai.impliedFirst(fn)
+	switch ai.ArchiveType {
+	case ARCHIVE_ZIP:
+		return ai.forEachZip(fn)
+	case ARCHIVE_7Z:
+		return ai.forEach7Z(fn)
+	case ARCHIVE_TGZ, ARCHIVE_TAR, ARCHIVE_TBZ2, ARCHIVE_TXZ, ARCHIVE_TZST, ARCHIVE_TBR, ARCHIVE_TLZ4,
+		ARCHIVE_TZ, ARCHIVE_TLZ:
+		return ai.forEachTar(fn)
+	case ARCHIVE_RAR:
+		return ai.forEachRar(fn)
+	}
+	if h := optionalFormat(ai.ArchiveType); h != nil && h.each != nil {
+		return h.each(ai, fn)
+	}
+	if isSingleFileType(ai.ArchiveType) || optionalFormat(ai.ArchiveType) != nil {
+		return ai.forEachOpen(fn)
+	}
+	return fmt.Errorf("%s: %w", ai.fullname, ErrUnsupportedFormat)
+}
+
+func (ai *ArchiveInfo) forEachZip(fn func(*ArchivedFile, io.Reader) error) error {
+	src, err := ai.openSource()
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	defer src.Close()
+	zipReader, err := newZipReader(src)
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	for i := range ai.files {
+		af := &ai.files[i]
+		if af.implied {
+			continue
+		}
+		readCloser, err := openZipFile(zipReader.File[af.index], ai.opts.password)
+		if err != nil {
+			return err
+		}
+		err = fn(af, af.wrapReader(readCloser))
+		readCloser.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ai *ArchiveInfo) forEach7Z(fn func(*ArchivedFile, io.Reader) error) error {
+	src, err := ai.openSource()
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	defer src.Close()
+	zipReader, err := sevenzip.NewReaderWithPassword(src, src.size, ai.opts.password)
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	for i := range ai.files {
+		af := &ai.files[i]
+		if codec := unsupported7zCodec(af.method); af.method != "" && codec != "" {
+			return fmt.Errorf("%s: %w: 7z codec %s", af.name, ErrUnsupportedFormat, codec)
+		}
+		readCloser, err := zipReader.File[af.index].Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", af.name, af.passwordError(err))
+		}
+		err = fn(af, af.wrapReader(&passwordErrReader{af, readCloser}))
+		readCloser.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ai *ArchiveInfo) forEachTar(fn func(*ArchivedFile, io.Reader) error) error {
+	src, err := ai.openSource()
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	defer src.Close()
+	content, closer, err := tarStream(ai.ArchiveType, src.stream())
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	defer closer.Close()
+	tarReader := newTarWalker(content, ai.opts.bestEffort, nil)
+
+	order := ai.archiveOrder()
+	next := 0
+	for i := 0; next < len(order); i++ {
+		if _, err = tarReader.Next(); err != nil {
+			return openError(ai.fullname, err)
+		}
+		af := order[next]
+		if af.index != i {
+			continue
+		}
+		next++
+		var body io.Reader = tarReader
+		if !af.mode.IsRegular() {
+			body = bytes.NewReader(nil)
+		}
+		if err = fn(af, af.wrapReader(body)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The listing in archive order, so a single pass can match entries up with
+// one cursor.
+func (ai *ArchiveInfo) archiveOrder() []*ArchivedFile {
+	order := make([]*ArchivedFile, 0, len(ai.files))
+	for i := range ai.files {
+		if !ai.files[i].implied {
+			order = append(order, &ai.files[i])
+		}
+	}
+	slices.SortStableFunc(order, func(a, b *ArchivedFile) int { return a.index - b.index })
+	return order
+}
+
+// Entry at a time through open, for formats without a cheaper pass.
+func (ai *ArchiveInfo) forEachOpen(fn func(*ArchivedFile, io.Reader) error) error {
+	for i := range ai.files {
+		af := &ai.files[i]
+		readCloser, err := af.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(af, readCloser)
+		readCloser.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stream an archive that can only be read front to back, such as an HTTP
+// body or a pipe, calling fn for each entry as ForEach does, without a
+// temp file or a second pass.  tar of any compression, single-file gzip
+// and RAR can be read this way; zip and 7z keep their directory at the
+// end, so they need GetArchiveInfoFromReader.  Options apply as to
+// GetArchiveInfo, with WithNameHint naming the stream.  The entries only
+// carry metadata: their GetBytes and Open can't go back to the stream, so
+// read content from fn's reader.  A single-file gzip's entry has Size -1,
+// since it isn't known until it's been read.  Warnings only reach a
+// WithWarnings channel.
+func ForEachFromReader(r io.Reader, fn func(*ArchivedFile, io.Reader) error, opts ...Option) error {
+	ar := &ArchiveInfo{size: -1, opts: buildOptions(opts)}
+	ar.name = ar.opts.nameHint
+	ar.fullname = ar.name
+	if ar.fullname == "" {
+		ar.fullname = "stream"
+	}
+	if timeout := ar.opts.readTimeout; timeout > 0 {
+		tr := newTimeoutReader(r, timeout)
+		defer tr.stop(nil)
+		r = tr
+	}
+	t, r, err := PeekType(r)
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	if t == ARCHIVE_NA {
+		t = claimedStreamType(ar.name)
+	}
+	ar.ArchiveType = t
+	switch {
+	case isTarType(t):
+		content, closer, err := tarStream(t, r)
+		if err != nil {
+			return openError(ar.fullname, err)
+		}
+		defer closer.Close()
+		if t == ARCHIVE_TAR {
+			return ar.streamTar(content, fn)
+		}
+		return ar.streamCompressed(content, fn)
+	case t == ARCHIVE_RAR:
+		return ar.streamRar(r, fn)
+	case t == ARCHIVE_NA:
+		return fmt.Errorf("%s: %w", ar.fullname, ErrNotAnArchive)
+	}
+	return fmt.Errorf("%s: %w: needs random access", ar.fullname, ErrUnsupportedFormat)
+}
+
+// Add an entry found in a stream and hand it to fn, unless the options
+// filter it out.
+func (ar *ArchiveInfo) streamEntry(af ArchivedFile, body io.Reader, fn func(*ArchivedFile, io.Reader) error) error {
+	listed := len(ar.files)
+	if err := ar.addFile(af); err != nil || len(ar.files) == listed {
+		return err
+	}
+	entry := &ar.files[listed]
+	return fn(entry, entry.wrapReader(body))
+}
+
+// Tell a compressed tarball from a single compressed file, as
+// settleCompressed does, but without reading ahead to size the file.
+func (ar *ArchiveInfo) streamCompressed(content io.Reader, fn func(*ArchivedFile, io.Reader) error) error {
+	block := make([]byte, tarBlockSize)
+	n, err := io.ReadFull(content, block)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return openError(ar.fullname, err)
+	}
+	replay := io.MultiReader(bytes.NewReader(block[:n]), content)
+	if n == tarBlockSize && (isTarHeader(block) || bytes.Count(block, []byte{0}) == tarBlockSize) {
+		return ar.streamTar(replay, fn)
+	}
+	ar.ArchiveType = singleFileTypes[ar.ArchiveType]
+	return ar.streamEntry(ar.singleFileEntry(content, -1), replay, fn)
+}
+
+func (ar *ArchiveInfo) streamTar(content io.Reader, fn func(*ArchivedFile, io.Reader) error) error {
+	tarReader := newTarWalker(content, ar.opts.bestEffort, func(offset int64, err error) {
+		ar.warn(&EntryError{Archive: ar.fullname, Offset: offset, Err: fmt.Errorf("%w: %w", ErrCorruptArchive, err)})
+	})
+	for i := 0; ; i++ {
+		head, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return openError(ar.fullname, err)
+		}
+		af := ar.tarEntry(head, i)
+		var body io.Reader = tarReader
+		if !af.mode.IsRegular() {
+			body = bytes.NewReader(nil)
+		}
+		if err = ar.streamEntry(af, body, fn); err != nil {
+			return err
+		}
+	}
+}
+
+func (ar *ArchiveInfo) streamRar(r io.Reader, fn func(*ArchivedFile, io.Reader) error) error {
+	rarReader, err := rardecode.NewReader(r)
+	if err != nil {
+		return rarError(ar.fullname, err)
+	}
+	for i := 0; ; i++ {
+		head, err := rarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return rarError(ar.fullname, err)
+		}
+		if err = ar.streamEntry(ar.rarEntry(head, i), &rarEntryReader{rarReader, ar.fullname}, fn); err != nil {
+			return err
+		}
+	}
+}
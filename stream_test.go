@@ -0,0 +1,108 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestForEach(t *testing.T) {
+	for _, name := range []string{"testassets/test.zip", "testassets/tgz_test.tgz", "testassets/sz_test.7z", "testassets/tree.zip"} {
+		ar, err := GetArchiveInfo(name, WithoutAppleMetadata())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want, got int64
+		for _, af := range ar.Files() {
+			want += af.Size()
+		}
+		count := 0
+		err = ar.ForEach(func(af *ArchivedFile, r io.Reader) error {
+			if af != &ar.Files()[count] {
+				t.Errorf("%s: entry %d out of order", name, count)
+			}
+			count++
+			n, err := io.Copy(io.Discard, r)
+			got += n
+			return err
+		})
+		if err != nil {
+			t.Errorf("%s ForEach() error = %v", name, err)
+		}
+		if count != len(ar.Files()) || got != want {
+			t.Errorf("%s streamed %d entries, %d bytes; want %d, %d", name, count, got, len(ar.Files()), want)
+		}
+	}
+
+	// The callback's error ends the walk.
+	ar, _ := GetArchiveInfo("testassets/tree.zip")
+	stop := errors.New("stop")
+	seen := 0
+	err := ar.ForEach(func(*ArchivedFile, io.Reader) error {
+		seen++
+		return stop
+	})
+	if err != stop || seen != 1 {
+		t.Errorf("ForEach() after callback error = %v, %d calls", err, seen)
+	}
+}
+
+func TestForEachFromReader(t *testing.T) {
+	for _, name := range []string{"testassets/tgz_test.tgz", "testassets/test.tar", "testassets/test.tar.bz2",
+		"testassets/test.tar.xz", "testassets/test.tar.zst", "testassets/test.rar"} {
+		ar, err := GetArchiveInfo(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		// MultiReader hides ReadAt and Seek: a plain stream.
+		err = ForEachFromReader(io.MultiReader(file), func(af *ArchivedFile, r io.Reader) error {
+			want := ar.Files()[count]
+			count++
+			got, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if af.Name() != want.Name() || af.Size() != want.Size() || int64(len(got)) != want.Size() && want.Mode().IsRegular() {
+				t.Errorf("%s: streamed %s (%d bytes, read %d), want %s (%d bytes)", name, af.Name(), af.Size(), len(got), want.Name(), want.Size())
+			}
+			return nil
+		})
+		file.Close()
+		if err != nil || count != len(ar.Files()) {
+			t.Errorf("%s: ForEachFromReader() saw %d entries, error = %v; want %d", name, count, err, len(ar.Files()))
+		}
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Name = "report.csv"
+	gw.Write([]byte("a,b\n1,2\n"))
+	gw.Close()
+	err := ForEachFromReader(&buf, func(af *ArchivedFile, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if af.Name() != "report.csv" || af.Size() != -1 || string(data) != "a,b\n1,2\n" {
+			t.Errorf("streamed gzip: %s, size %d, content %q", af.Name(), af.Size(), data)
+		}
+		return err
+	})
+	if err != nil {
+		t.Errorf("streamed gzip error = %v", err)
+	}
+
+	file, err := os.Open("testassets/test.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err = ForEachFromReader(file, func(*ArchivedFile, io.Reader) error { return nil }); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("streamed zip error = %v, want ErrUnsupportedFormat", err)
+	}
+}
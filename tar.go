@@ -0,0 +1,91 @@
+package archiver
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// The codec of each tar type's stream, for Method.
+var tarMethods = map[ArchiveType]string{
+	ARCHIVE_TAR: "Store", ARCHIVE_TGZ: "Deflate", ARCHIVE_TBZ2: "BZip2", ARCHIVE_TXZ: "LZMA2", ARCHIVE_TZST: "ZStandard",
+	ARCHIVE_TBR: "Brotli", ARCHIVE_TLZ4: "LZ4", ARCHIVE_TZ: "LZW", ARCHIVE_TLZ: "LZMA",
+}
+
+// The tar stream inside an archive of type t: decompressed for the
+// compressed types, the archive itself for TAR.  Close the returned closer
+// when done; r stays the caller's to close.
+func tarStream(t ArchiveType, r io.Reader) (io.Reader, io.Closer, error) {
+	switch t {
+	case ARCHIVE_TGZ:
+		gzReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gzReader, gzReader, nil
+	case ARCHIVE_TBZ2:
+		return bzip2.NewReader(r), nopCloser{}, nil
+	case ARCHIVE_TXZ:
+		xzReader, err := xz.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return xzReader, nopCloser{}, nil
+	case ARCHIVE_TZST:
+		zstdReader, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		rc := zstdReader.IOReadCloser()
+		return rc, rc, nil
+	case ARCHIVE_TBR:
+		return brotli.NewReader(r), nopCloser{}, nil
+	case ARCHIVE_TLZ4:
+		return lz4.NewReader(r), nopCloser{}, nil
+	case ARCHIVE_TZ:
+		lzwReader, err := newLZWReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return lzwReader, nopCloser{}, nil
+	case ARCHIVE_TLZ:
+		lzipReader, err := newLzipReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return lzipReader, nopCloser{}, nil
+	}
+	return r, nopCloser{}, nil
+}
+
+// Reports whether entries of type t are tar entries.
+func isTarType(t ArchiveType) bool {
+	_, ok := tarMethods[t]
+	return ok
+}
+
+// List a tar archive, or the single file a compressed one turns out to
+// hold.
+func (ar *ArchiveInfo) loadFilesInTarArchive() error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	content, closer, err := tarStream(ar.ArchiveType, src.stream())
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer closer.Close()
+	if ar.ArchiveType != ARCHIVE_TAR {
+		if content, err = ar.settleCompressed(content); err != nil || content == nil {
+			return err
+		}
+	}
+	return ar.listTar(content)
+}
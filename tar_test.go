@@ -0,0 +1,214 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pierrec/lz4/v4"
+)
+
+func TestPlainTar(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/test.tar")
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	if ar.ArchiveType != ARCHIVE_TAR || len(ar.Files()) != 4 || !ar.ExtensionMatchesType() {
+		t.Fatalf("ArchiveType = %v with %d entries", ar.ArchiveType, len(ar.Files()))
+	}
+	if af := ar.File("conf/current.ini"); af == nil || af.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("conf/current.ini = %v, want a symlink", af)
+	}
+	data, err := ar.File("conf/app.ini").GetBytes()
+	if err != nil || string(data) != "[server]\nport = 8080\n" {
+		t.Errorf("GetBytes() = %q, %v", data, err)
+	}
+	rc, err := ar.OpenAt(3)
+	if err != nil {
+		t.Fatalf("OpenAt(3) error = %v", err)
+	}
+	data, _ = io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "1.4.2\n" {
+		t.Errorf("OpenAt(3) = %q", data)
+	}
+	count := 0
+	err = ar.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		count++
+		_, err := io.Copy(io.Discard, r)
+		return err
+	})
+	if err != nil || count != 4 {
+		t.Errorf("ForEach() visited %d, error = %v", count, err)
+	}
+}
+
+func TestTarBzip2(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/test.tar.bz2", WithValidateOnOpen())
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	if ar.ArchiveType != ARCHIVE_TBZ2 || len(ar.Files()) != 3 || !ar.ExtensionMatchesType() {
+		t.Fatalf("ArchiveType = %v with %d entries", ar.ArchiveType, len(ar.Files()))
+	}
+	data, err := ar.File("logs/README").GetBytes()
+	if err != nil || string(data) != "Rotated nightly.\n" {
+		t.Errorf("GetBytes() = %q, %v", data, err)
+	}
+	dir := t.TempDir()
+	if err = ar.ExtractSubtree("logs", dir); err != nil {
+		t.Fatalf("ExtractSubtree() error = %v", err)
+	}
+	if got := listTree(t, dir); len(got) != 2 || got[0] != "README" || got[1] != "app.log" {
+		t.Errorf("extracted %v", got)
+	}
+	if errs := ar.VerifyAll(4); len(errs) != 0 {
+		t.Errorf("VerifyAll() = %v", errs)
+	}
+}
+
+func TestTarXz(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/test.tar.xz", WithValidateOnOpen())
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	if ar.ArchiveType != ARCHIVE_TXZ || len(ar.Files()) != 3 || !ar.ExtensionMatchesType() {
+		t.Fatalf("ArchiveType = %v with %d entries", ar.ArchiveType, len(ar.Files()))
+	}
+	data, err := ar.File("pkg/manifest.json").GetBytes()
+	if err != nil || string(data) != "{\"name\": \"demo\", \"version\": \"0.3.1\"}\n" {
+		t.Errorf("GetBytes() = %q, %v", data, err)
+	}
+	if af := ar.File("pkg/bin/run.sh"); af.Mode().Perm() != 0o755 {
+		t.Errorf("run.sh mode = %v", af.Mode())
+	}
+}
+
+func TestTarZstd(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/test.tar.zst", WithValidateOnOpen())
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	if ar.ArchiveType != ARCHIVE_TZST || len(ar.Files()) != 3 || !ar.ExtensionMatchesType() {
+		t.Fatalf("ArchiveType = %v with %d entries", ar.ArchiveType, len(ar.Files()))
+	}
+	data, err := ar.File("dist/VERSION").GetBytes()
+	if err != nil || string(data) != "2.4.0\n" {
+		t.Errorf("GetBytes() = %q, %v", data, err)
+	}
+	rc, err := ar.OpenAt(2)
+	if err != nil {
+		t.Fatalf("OpenAt() error = %v", err)
+	}
+	defer rc.Close()
+	if data, _ = io.ReadAll(rc); !strings.HasPrefix(string(data), "## 2.4.0") {
+		t.Errorf("OpenAt() read %q", data)
+	}
+}
+
+func TestPAXHeaders(t *testing.T) {
+	longName := strings.Repeat("deep/", 30) + "file.txt"
+	own := time.Unix(1710000000, 123456789)
+	path := writeTestTgz(t, t.TempDir(), "pax.tgz", []testTarEntry{
+		{tar.Header{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader,
+			PAXRecords: map[string]string{"comment": "0123abcd", "mtime": "1700000000.5"}}, ""},
+		{tar.Header{Name: longName, Typeflag: tar.TypeReg, Mode: 0o644, ModTime: time.Unix(1, 0), Format: tar.FormatPAX}, "long"},
+		{tar.Header{Name: "own.txt", Typeflag: tar.TypeReg, Mode: 0o644, ModTime: own, Format: tar.FormatPAX,
+			PAXRecords: map[string]string{"SCHILY.xattr.user.note": "hi"}}, "own"},
+		{tar.Header{Name: strings.Repeat("gnu/", 30) + "x", Typeflag: tar.TypeReg, Mode: 0o644, Format: tar.FormatGNU}, "gnu"},
+	})
+	ar, err := GetArchiveInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ar.Files()) != 3 || ar.File("pax_global_header") != nil {
+		t.Fatalf("listed %d entries, global header included: %v", len(ar.Files()), ar.File("pax_global_header") != nil)
+	}
+	long := ar.File(longName)
+	if long == nil {
+		t.Fatal("PAX long name not listed")
+	}
+	if !long.ModTime().Equal(time.Unix(1700000000, 500000000)) {
+		t.Errorf("global mtime not applied: %v", long.ModTime())
+	}
+	if long.PAXRecords()["comment"] != "0123abcd" {
+		t.Errorf("PAXRecords() = %v, want the global comment", long.PAXRecords())
+	}
+	mine := ar.File("own.txt")
+	if !mine.ModTime().Equal(own) || mine.PAXRecords()["SCHILY.xattr.user.note"] != "hi" {
+		t.Errorf("own.txt: ModTime %v, records %v", mine.ModTime(), mine.PAXRecords())
+	}
+	// Positions skip the global header too.
+	for i, want := range []string{"long", "own", "gnu"} {
+		rc, err := ar.OpenAt(i)
+		if err != nil {
+			t.Fatalf("OpenAt(%d) error = %v", i, err)
+		}
+		got, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(got) != want {
+			t.Errorf("OpenAt(%d) = %q, want %q", i, got, want)
+		}
+	}
+	if got, err := ar.FileAt(2).GetString(); got != "gnu" || err != nil || !strings.HasSuffix(ar.FileAt(2).Name(), "/x") {
+		t.Errorf("GNU long name entry %s = %q, %v", ar.FileAt(2).Name(), got, err)
+	}
+}
+
+// A tarball compressed with brotli, found by its extension, and with LZ4,
+// found by its magic.
+func TestTarBrotliLZ4(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "site/", Typeflag: tar.TypeDir, Mode: 0o755})
+	tw.WriteHeader(&tar.Header{Name: "site/index.html", Typeflag: tar.TypeReg, Mode: 0o644, Size: 15})
+	tw.Write([]byte("<h1>built</h1>\n"))
+	tw.Close()
+	for _, c := range []struct {
+		name   string
+		data   []byte
+		t      ArchiveType
+		method string
+	}{
+		{"site.tar.br", testCompress(brotli.NewWriter, buf.Bytes()), ARCHIVE_TBR, "Brotli"},
+		{"site.tar.lz4", testCompress(lz4.NewWriter, buf.Bytes()), ARCHIVE_TLZ4, "LZ4"},
+	} {
+		path := filepath.Join(t.TempDir(), c.name)
+		if err := os.WriteFile(path, c.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ar, err := GetArchiveInfo(path, WithValidateOnOpen())
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if ar.ArchiveType != c.t || len(ar.Files()) != 2 || !ar.ExtensionMatchesType() {
+			t.Fatalf("%s: ArchiveType = %v with %d entries", c.name, ar.ArchiveType, len(ar.Files()))
+		}
+		af := ar.File("site/index.html")
+		if data, err := af.GetBytes(); err != nil || string(data) != "<h1>built</h1>\n" || af.Method() != c.method {
+			t.Errorf("%s: GetBytes() = %q, %v, method %q", c.name, data, err, af.Method())
+		}
+		count := 0
+		err = ForEachFromReader(bytes.NewReader(c.data), func(af *ArchivedFile, r io.Reader) error {
+			count++
+			return nil
+		}, WithNameHint(c.name))
+		if err != nil || count != 2 {
+			t.Errorf("%s: ForEachFromReader() visited %d, error = %v", c.name, count, err)
+		}
+	}
+
+	// Without its name, brotli is just bytes.
+	data := testCompress(brotli.NewWriter, buf.Bytes())
+	if _, err := GetArchiveInfoFromReader(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrNotAnArchive) {
+		t.Errorf("unnamed brotli: %v", err)
+	}
+}
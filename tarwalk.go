@@ -0,0 +1,179 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const tarBlockSize = 512
+
+// Steps through a tar stream like tar.Reader.  With resync set, a header
+// that fails its checksum is reported to skipped and the walk continues at
+// the next block that looks like a valid header, so one damaged entry
+// doesn't hide the rest.  Every pass over an archive must use the same
+// setting, or entry positions won't agree.
+//
+// tar.Reader already folds per-file PAX records and GNU long names into
+// the header they belong to, but hands back pax_global_header records as
+// an entry of their own.  The walker takes those in instead, and applies
+// them to every later header.
+type tarWalker struct {
+	src     *countingReader
+	tr      *tar.Reader
+	resync  bool
+	skipped func(offset int64, err error)
+	global  map[string]string // pax_global_header records so far
+}
+
+func newTarWalker(r io.Reader, resync bool, skipped func(offset int64, err error)) *tarWalker {
+	src := &countingReader{r: r}
+	return &tarWalker{src: src, tr: tar.NewReader(src), resync: resync, skipped: skipped}
+}
+
+// The next file's header.  Global headers and GNU volume labels describe
+// the archive rather than a file, so they're never returned.
+func (w *tarWalker) Next() (*tar.Header, error) {
+	for {
+		head, err := w.nextHeader()
+		if err != nil {
+			return nil, err
+		}
+		switch head.Typeflag {
+		case tar.TypeXGlobalHeader:
+			if w.global == nil {
+				w.global = make(map[string]string)
+			}
+			for key, value := range head.PAXRecords {
+				if value == "" { // An empty value unsets the key
+					delete(w.global, key)
+				} else {
+					w.global[key] = value
+				}
+			}
+		case tarTypeGNUVolume:
+		default:
+			w.applyGlobal(head)
+			return head, nil
+		}
+	}
+}
+
+// GNU tar's volume label, which archive/tar doesn't name.
+const tarTypeGNUVolume = 'V'
+
+// Fold the global records into head's, its own winning, and take the
+// global times where it has none of its own.
+func (w *tarWalker) applyGlobal(head *tar.Header) {
+	if len(w.global) == 0 {
+		return
+	}
+	records := maps.Clone(w.global)
+	maps.Copy(records, head.PAXRecords)
+	for key, field := range map[string]*time.Time{"mtime": &head.ModTime, "atime": &head.AccessTime, "ctime": &head.ChangeTime} {
+		if _, own := head.PAXRecords[key]; !own {
+			if t, ok := parsePAXTime(w.global[key]); ok {
+				*field = t
+			}
+		}
+	}
+	head.PAXRecords = records
+}
+
+// A PAX time: decimal seconds since the epoch, with any fraction.
+func parsePAXTime(value string) (time.Time, bool) {
+	secs, frac, _ := strings.Cut(value, ".")
+	s, err := strconv.ParseInt(secs, 10, 64)
+	if value == "" || err != nil || strings.Trim(frac, "0123456789") != "" {
+		return time.Time{}, false
+	}
+	frac = (frac + "000000000")[:9]
+	ns, _ := strconv.ParseInt(frac, 10, 64)
+	if strings.HasPrefix(secs, "-") {
+		ns = -ns
+	}
+	return time.Unix(s, ns), true
+}
+
+// The next header from tar.Reader, skipping damage under resync.
+func (w *tarWalker) nextHeader() (*tar.Header, error) {
+	for {
+		head, err := w.tr.Next()
+		if err == nil || !w.resync || !errors.Is(err, tar.ErrHeader) {
+			return head, err
+		}
+		if w.skipped != nil {
+			w.skipped(w.src.n-tarBlockSize, err)
+		}
+		if err = w.findHeader(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (w *tarWalker) Read(p []byte) (int, error) { return w.tr.Read(p) }
+
+// Advance block by block to the next plausible header and restart the tar
+// reader there.  io.EOF if there isn't one.
+func (w *tarWalker) findHeader() error {
+	block := make([]byte, tarBlockSize)
+	for {
+		if _, err := io.ReadFull(w.src, block); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return io.EOF
+			}
+			return err
+		}
+		if isTarHeader(block) {
+			w.tr = tar.NewReader(io.MultiReader(bytes.NewReader(block), w.src))
+			return nil
+		}
+	}
+}
+
+// Reports whether a block carries a correct header checksum, which content
+// blocks essentially never do.  Older writers summed signed bytes, so
+// either sum is accepted.
+func isTarHeader(block []byte) bool {
+	field := strings.Trim(string(block[148:156]), " \x00")
+	want, err := strconv.ParseInt(field, 8, 64)
+	if err != nil || field == "" {
+		return false
+	}
+	var unsigned, signed int64
+	for i, b := range block {
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		unsigned += int64(b)
+		signed += int64(int8(b))
+	}
+	return want == unsigned || want == signed
+}
+
+// Reader that keeps count of the bytes through it, and of the zero bytes
+// they end with, for the end-of-archive marker.
+type countingReader struct {
+	r     io.Reader
+	n     int64
+	zeros int64
+	ended bool // r has given io.EOF
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	trailing := len(p[:n]) - len(bytes.TrimRight(p[:n], "\x00"))
+	if trailing == n {
+		cr.zeros += int64(n)
+	} else {
+		cr.zeros = int64(trailing)
+	}
+	cr.ended = cr.ended || err == io.EOF
+	return n, err
+}
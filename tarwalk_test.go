@@ -0,0 +1,59 @@
+package archiver
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestBestEffortListing(t *testing.T) {
+	if _, err := GetArchiveInfo("testassets/badentry.tgz"); !errors.Is(err, ErrCorruptArchive) {
+		t.Fatalf("GetArchiveInfo() error = %v, want ErrCorruptArchive", err)
+	}
+
+	warnings := make(chan error, 4)
+	ar, err := GetArchiveInfo("testassets/badentry.tgz", WithBestEffort(), WithWarnings(warnings))
+	if err != nil {
+		t.Fatalf("GetArchiveInfo(best effort) error = %v", err)
+	}
+	var names []string
+	for _, af := range ar.Files() {
+		names = append(names, af.Name())
+	}
+	if len(names) != 3 || names[0] != "first.txt" || names[1] != "third.txt" || names[2] != "fourth.txt" {
+		t.Errorf("listed %q, want first, third and fourth", names)
+	}
+
+	var entryErr *EntryError
+	if len(ar.Warnings()) != 1 || !errors.As(ar.Warnings()[0], &entryErr) || !errors.Is(entryErr, ErrCorruptArchive) {
+		t.Fatalf("Warnings() = %v, want one EntryError", ar.Warnings())
+	}
+	if entryErr.Offset != 1024 {
+		t.Errorf("EntryError.Offset = %d, want 1024", entryErr.Offset)
+	}
+	if len(warnings) != 1 || <-warnings != ar.Warnings()[0] {
+		t.Error("warning not sent to the WithWarnings channel")
+	}
+
+	// Entries past the damage read back too.
+	if got, err := ar.File("fourth.txt").GetString(); got != "fourth entry\n" || err != nil {
+		t.Errorf("GetString(fourth.txt) = %q, %v", got, err)
+	}
+	rc, err := ar.OpenAt(1)
+	if err != nil {
+		t.Fatalf("OpenAt(1) error = %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "third entry\n" {
+		t.Errorf("OpenAt(1) = %q", got)
+	}
+	seen := 0
+	err = ar.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		seen++
+		return nil
+	})
+	if err != nil || seen != 3 {
+		t.Errorf("ForEach() saw %d entries, error = %v", seen, err)
+	}
+}
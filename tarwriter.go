@@ -0,0 +1,118 @@
+package archiver
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Write every listed entry into tw, so the caller picks the outer stream
+// and compression.  Names, modes and times carry over, as do symlinks, tar
+// hardlinks and device nodes.  Other special files are left out.  Owners
+// never carry over: every entry is written with uid and gid 0 and no user
+// or group name.  For reproducible output, SetModTime fixes every
+// timestamp (and drops access and change times), and SortEntries writes
+// in name order.  tw is not closed.
+func (ai *ArchiveInfo) ExtractAllToTarWriter(tw *tar.Writer, opts ...ExtractOption) error {
+	eo := buildExtractOptions(opts)
+	write := func(af *ArchivedFile, r io.Reader) error {
+		name, ok := eo.stripped(af.name)
+		if !ok {
+			return nil
+		}
+		if af.mode.IsRegular() && !af.isDir() {
+			r = af.tracked(eo).withTracking(r)
+		}
+		return af.writeTarEntry(tw, name, r, eo)
+	}
+	if !eo.sorted {
+		return ai.ForEach(write)
+	}
+	order := make([]*ArchivedFile, len(ai.files))
+	for i := range ai.files {
+		order[i] = &ai.files[i]
+	}
+	slices.SortStableFunc(order, func(a, b *ArchivedFile) int { return strings.Compare(a.name, b.name) })
+	for _, af := range order {
+		readCloser, err := af.Open()
+		if err != nil {
+			return err
+		}
+		err = write(af, readCloser)
+		readCloser.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the entry into tw as name.  A hardlink whose target is stripped
+// away is left out, as the target is.
+func (af *ArchivedFile) writeTarEntry(tw *tar.Writer, name string, r io.Reader, eo extractOptions) error {
+	head := &tar.Header{Name: name, Mode: int64(af.mode.Perm()), ModTime: af.modTime,
+		AccessTime: af.accessTime, ChangeTime: af.changeTime, Format: tar.FormatPAX}
+	if !eo.modTime.IsZero() {
+		head.ModTime, head.AccessTime, head.ChangeTime = eo.modTime, time.Time{}, time.Time{}
+	}
+	head.Mode |= int64(tarModeBits(af.mode))
+	switch {
+	case af.isDir():
+		head.Typeflag = tar.TypeDir
+		if !strings.HasSuffix(head.Name, "/") {
+			head.Name += "/"
+		}
+	case af.hardlink:
+		link, ok := eo.stripped(af.linkname)
+		if !ok {
+			return nil
+		}
+		head.Typeflag, head.Linkname = tar.TypeLink, link
+	case af.mode&fs.ModeSymlink != 0:
+		head.Typeflag, head.Linkname = tar.TypeSymlink, af.linkname
+		if head.Linkname == "" { // zip and 7z keep the target as the content
+			target, err := io.ReadAll(io.LimitReader(r, 4096))
+			if err != nil {
+				return fmt.Errorf("%s: %w", af.name, err)
+			}
+			head.Linkname = string(target)
+		}
+	case af.mode.IsRegular():
+		head.Typeflag, head.Size = tar.TypeReg, af.size
+	case af.mode&fs.ModeCharDevice != 0:
+		head.Typeflag, head.Devmajor, head.Devminor = tar.TypeChar, af.devMajor, af.devMinor
+	case af.mode&fs.ModeDevice != 0:
+		head.Typeflag, head.Devmajor, head.Devminor = tar.TypeBlock, af.devMajor, af.devMinor
+	default:
+		return nil
+	}
+	if err := tw.WriteHeader(head); err != nil {
+		return fmt.Errorf("%s: %w", af.name, err)
+	}
+	if head.Typeflag != tar.TypeReg {
+		return nil
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("%s: %w", af.name, err)
+	}
+	return nil
+}
+
+// The setuid, setgid and sticky bits in tar's c_ISUID style.
+func tarModeBits(mode fs.FileMode) int {
+	var bits int
+	if mode&fs.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return bits
+}
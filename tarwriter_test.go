@@ -0,0 +1,125 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExtractAllToTarWriter(t *testing.T) {
+	mtime := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	atime := time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)
+	src := writeTestTgz(t, t.TempDir(), "links.tgz", []testTarEntry{
+		{tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: mtime}, ""},
+		{tar.Header{Name: "bin/tool", Typeflag: tar.TypeReg, Mode: 0o4755, ModTime: mtime, AccessTime: atime, Format: tar.FormatPAX}, "#!/bin/sh\necho hi\n"},
+		{tar.Header{Name: "bin/alias", Typeflag: tar.TypeSymlink, Linkname: "tool", Mode: 0o777, ModTime: mtime}, ""},
+		{tar.Header{Name: "bin/copy", Typeflag: tar.TypeLink, Linkname: "bin/tool", Mode: 0o755, ModTime: mtime}, ""},
+	})
+	ar, err := GetArchiveInfo(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err = ar.ExtractAllToTarWriter(tw); err != nil {
+		t.Fatalf("ExtractAllToTarWriter() error = %v", err)
+	}
+	tw.Close()
+
+	want := []struct {
+		name     string
+		typeflag byte
+		mode     int64
+		linkname string
+		body     string
+	}{{"bin/", tar.TypeDir, 0o755, "", ""},
+		{"bin/tool", tar.TypeReg, 0o4755, "", "#!/bin/sh\necho hi\n"},
+		{"bin/alias", tar.TypeSymlink, 0o777, "tool", ""},
+		{"bin/copy", tar.TypeLink, 0o755, "bin/tool", ""},
+	}
+	tr := tar.NewReader(&buf)
+	for _, w := range want {
+		head, err := tr.Next()
+		if err != nil {
+			t.Fatalf("reading back %s: %v", w.name, err)
+		}
+		body, _ := io.ReadAll(tr)
+		if head.Name != w.name || head.Typeflag != w.typeflag || head.Mode != w.mode || head.Linkname != w.linkname || string(body) != w.body {
+			t.Errorf("got %s type %c mode %o -> %q %q, want %+v", head.Name, head.Typeflag, head.Mode, head.Linkname, body, w)
+		}
+		if !head.ModTime.Equal(mtime) {
+			t.Errorf("%s ModTime = %v", head.Name, head.ModTime)
+		}
+		if w.name == "bin/tool" && !head.AccessTime.Equal(atime) {
+			t.Errorf("%s AccessTime = %v, want %v", head.Name, head.AccessTime, atime)
+		}
+	}
+	if _, err = tr.Next(); err != io.EOF {
+		t.Errorf("extra entries after the last, err = %v", err)
+	}
+
+	// zip sources go through the same way.
+	ar, _ = GetArchiveInfo("testassets/tree.zip")
+	buf.Reset()
+	tw = tar.NewWriter(&buf)
+	if err = ar.ExtractAllToTarWriter(tw); err != nil {
+		t.Fatalf("ExtractAllToTarWriter(zip) error = %v", err)
+	}
+	tw.Close()
+	count := 0
+	for tr = tar.NewReader(&buf); ; count++ {
+		if _, err = tr.Next(); err != nil {
+			break
+		}
+	}
+	if count != len(ar.Files()) {
+		t.Errorf("zip repacked %d entries, want %d", count, len(ar.Files()))
+	}
+}
+
+func TestExtractAllToTarWriterReproducible(t *testing.T) {
+	mtime := time.Date(2024, 2, 3, 4, 5, 6, 789, time.Local)
+	src := writeTestTgz(t, t.TempDir(), "host.tgz", []testTarEntry{
+		{tar.Header{Name: "z.txt", Typeflag: tar.TypeReg, Mode: 0o644, ModTime: mtime, Uid: 1000, Gid: 1000,
+			Uname: "builder", Gname: "staff", AccessTime: mtime, ChangeTime: mtime, Format: tar.FormatPAX}, "last"},
+		{tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: mtime, Uid: 1000, Uname: "builder"}, ""},
+		{tar.Header{Name: "a/m.txt", Typeflag: tar.TypeReg, Mode: 0o600, ModTime: mtime, Uid: 1000, Uname: "builder"}, "middle"},
+	})
+	ar, err := GetArchiveInfo(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixed := time.Unix(0, 0).UTC()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err = ar.ExtractAllToTarWriter(tw, SortEntries(), SetModTime(fixed)); err != nil {
+		t.Fatalf("ExtractAllToTarWriter() error = %v", err)
+	}
+	tw.Close()
+
+	var names []string
+	for tr := tar.NewReader(bytes.NewReader(buf.Bytes())); ; {
+		head, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, head.Name)
+		if head.Uid != 0 || head.Gid != 0 || head.Uname != "" || head.Gname != "" {
+			t.Errorf("%s owner = %d:%d %q:%q", head.Name, head.Uid, head.Gid, head.Uname, head.Gname)
+		}
+		if !head.ModTime.Equal(fixed) || !head.AccessTime.IsZero() || !head.ChangeTime.IsZero() || len(head.PAXRecords) != 0 {
+			t.Errorf("%s times = %v %v %v, PAX %v", head.Name, head.ModTime, head.AccessTime, head.ChangeTime, head.PAXRecords)
+		}
+	}
+	if want := []string{"a/", "a/m.txt", "z.txt"}; !slices.Equal(names, want) {
+		t.Errorf("order = %v, want %v", names, want)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("builder")) {
+		t.Error("output mentions the build user")
+	}
+}
@@ -0,0 +1,116 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// The entry's content as a string, for config and other text files.  Same
+// size limits as GetBytes.  A leading UTF-8 byte-order mark is dropped
+// under WithStripBOM and kept otherwise.
+func (af *ArchivedFile) GetString() (string, error) {
+	data, err := af.GetBytes()
+	if err != nil {
+		return "", err
+	}
+	if af.options().stripBOM {
+		data = bytes.TrimPrefix(data, utf8BOM)
+	}
+	return string(data), nil
+}
+
+// How far into an entry to look for a NUL when deciding it's binary, as git does.
+const binarySniffLength = 8000
+
+// Reports whether content starting with data is binary: a NUL byte near the start.
+func looksBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), binarySniffLength)], 0) >= 0
+}
+
+// Ready r for matching text: UTF-16 behind a byte-order mark is decoded to
+// UTF-8, since its NULs would otherwise make it look binary.  ok is false
+// for binary content, which isn't worth searching.
+func textReader(r io.Reader) (text io.Reader, ok bool, err error) {
+	br := bufio.NewReaderSize(r, binarySniffLength)
+	head, err := br.Peek(binarySniffLength)
+	if err != nil && err != io.EOF {
+		return nil, false, err
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}), bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		decoder := unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder()
+		return transform.NewReader(br, decoder), true, nil
+	case looksBinary(head):
+		return nil, false, nil
+	}
+	return br, true, nil
+}
+
+var errStopSearch = errors.New("archiver: search done")
+
+// Reports whether any text entry contains s, and the first that does, in
+// archive order.  Entries are streamed and the search stops at the first
+// match, so later entries aren't read at all.  Entries with a NUL byte near
+// the start are taken to be binary and skipped, unless they open with a
+// UTF-16 byte-order mark, in which case they're decoded first.  An empty s
+// matches nothing.
+func (ai *ArchiveInfo) ContainsText(s string) (bool, *ArchivedFile, error) {
+	if s == "" {
+		return false, nil, nil
+	}
+	var found *ArchivedFile
+	err := ai.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		if af.isDir() {
+			return nil
+		}
+		text, ok, err := textReader(r)
+		var match bool
+		if err == nil && ok {
+			match, err = readerContains(text, []byte(s))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", af.name, err)
+		}
+		if match {
+			found = af
+			return errStopSearch
+		}
+		return nil
+	})
+	if err == errStopSearch {
+		return true, found, nil
+	}
+	return false, nil, err
+}
+
+// Scan r for needle a buffer at a time, carrying the tail of each buffer
+// over so a match can straddle reads.
+func readerContains(r io.Reader, needle []byte) (bool, error) {
+	buf := make([]byte, max(32*1024, 2*len(needle)))
+	carry := 0
+	for {
+		n, err := io.ReadFull(r, buf[carry:])
+		if n > 0 {
+			window := buf[:carry+n]
+			if bytes.Contains(window, needle) {
+				return true, nil
+			}
+			carry = min(len(needle)-1, len(window))
+			copy(buf, window[len(window)-carry:])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package archiver
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGetString(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ar.File("docs/guide.md").GetString()
+	if err != nil || got != "# Guide\n\nStart with the install section.\n" {
+		t.Errorf("GetString() = %q, %v", got, err)
+	}
+
+	path := writeTestZip(t, t.TempDir(), "bom.zip", [][2]string{{"settings.ini", "\xEF\xBB\xBF[main]\nname=bom\n"}})
+	for _, test := range []struct {
+		opts []Option
+		want string
+	}{{nil, "\xEF\xBB\xBF[main]\nname=bom\n"},
+		{[]Option{WithStripBOM()}, "[main]\nname=bom\n"},
+	} {
+		ar, err = GetArchiveInfo(path, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err = ar.File("settings.ini").GetString(); got != test.want || err != nil {
+			t.Errorf("GetString() = %q, %v, want %q", got, err, test.want)
+		}
+	}
+
+	tooBig := ArchivedFile{name: "huge.txt", archivetype: ARCHIVE_ZIP, size: -1}
+	if _, err = tooBig.GetString(); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("GetString() error = %v, want ErrArchiveTooLarge", err)
+	}
+}
+
+func TestContainsText(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, af, err := ar.ContainsText("install section")
+	if !found || err != nil || af.Name() != "docs/guide.md" {
+		t.Errorf("ContainsText() = %v, %v, %v", found, af, err)
+	}
+	if found, _, err = ar.ContainsText("no such phrase"); found || err != nil {
+		t.Errorf("ContainsText(missing) = %v, %v", found, err)
+	}
+
+	// A match across the read buffer boundary, a binary entry that would
+	// match, and a corrupt entry after the match that must never be read.
+	long := strings.Repeat("x", 32*1024-3) + "needle"
+	path := writeTestZip(t, t.TempDir(), "search.zip", [][2]string{
+		{"blob.bin", "\x00\x01needle"}, {"long.txt", long}, {"broken.txt", strings.Repeat("needle ", 100)}})
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, _ := zr.File[2].DataOffset()
+	zr.Close()
+	data, _ := os.ReadFile(path)
+	for i := offset; i < offset+8; i++ {
+		data[i] = 0xFF
+	}
+	os.WriteFile(path, data, 0o644)
+
+	if ar, err = GetArchiveInfo(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ar.File("broken.txt").GetBytes(); err == nil {
+		t.Fatal("broken.txt isn't broken")
+	}
+	found, af, err = ar.ContainsText("needle")
+	if !found || err != nil || af.Name() != "long.txt" {
+		t.Errorf("ContainsText() = %v, %v, %v, want long.txt", found, af, err)
+	}
+}
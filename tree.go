@@ -0,0 +1,79 @@
+package archiver
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// A file or directory in the tree of an archive's entries.  The tree is
+// the fs.FS view's: paths lose any "./" and trailing "/", directories the
+// archive only implies are made up, and unsafe names are left out.
+type TreeNode struct {
+	Name     string        // Last path element; "." for the root
+	Path     string        // Full path, as for Open; "." for the root
+	IsDir    bool          // A directory, listed or implied
+	File     *ArchivedFile // The entry; nil for an implied directory
+	Size     int64         // A file's size, or a directory's files' added up
+	Files    int           // Files under a directory, at any depth
+	Children []*TreeNode   // A directory's contents, sorted by name
+	node     *fsNode
+}
+
+// The tree of ai's entries, from its root directory.  Each call builds a
+// fresh one, which the caller is free to change.
+func (ai *ArchiveInfo) Tree() *TreeNode {
+	return newTreeNode(ai.fsTree()["."])
+}
+
+func newTreeNode(n *fsNode) *TreeNode {
+	tn := &TreeNode{Name: path.Base(n.name), Path: n.name, IsDir: n.dir, File: n.af, node: n}
+	if !n.dir {
+		tn.Size = n.af.size
+		return tn
+	}
+	tn.Children = make([]*TreeNode, len(n.children))
+	for i, child := range n.children {
+		c := newTreeNode(child)
+		tn.Children[i] = c
+		tn.Size += c.Size
+		if c.IsDir {
+			tn.Files += c.Files
+		} else {
+			tn.Files++
+		}
+	}
+	return tn
+}
+
+// The child called name, or nil if there's none.
+func (tn *TreeNode) Child(name string) *TreeNode {
+	i, found := slices.BinarySearchFunc(tn.Children, name, func(c *TreeNode, name string) int {
+		return strings.Compare(c.Name, name)
+	})
+	if !found {
+		return nil
+	}
+	return tn.Children[i]
+}
+
+// The node at name, a slash-separated path relative to tn, or nil if
+// there's none.  "." is tn itself.
+func (tn *TreeNode) Lookup(name string) *TreeNode {
+	if !fs.ValidPath(name) {
+		return nil
+	}
+	if name == "." {
+		return tn
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if tn = tn.Child(elem); tn == nil {
+			return nil
+		}
+	}
+	return tn
+}
+
+// The node's fs.FileInfo, as Stat gives it.
+func (tn *TreeNode) Info() fs.FileInfo { return tn.node.info() }
@@ -0,0 +1,63 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	ai, err := GetArchiveInfo("testassets/tree.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := ai.Tree()
+	if root.Name != "." || !root.IsDir || root.Size != 183 || root.Files != 6 || len(root.Children) != 4 {
+		t.Fatalf("root is %+v", root)
+	}
+	var names []string
+	for _, c := range root.Children {
+		names = append(names, c.Name)
+	}
+	if want := "README.md docs docsextra.txt src"; strings.Join(names, " ") != want {
+		t.Errorf("root holds %q, want %q", names, want)
+	}
+	docs := root.Child("docs")
+	if docs == nil || docs.Path != "docs" || docs.File != ai.File("docs/") || docs.Size != 76 || docs.Files != 2 {
+		t.Fatalf("docs is %+v", docs)
+	}
+	index := root.Lookup("docs/api/index.md")
+	if index == nil || index.IsDir || index.File != ai.File("docs/api/index.md") || index.Size != 35 || index.Info().Name() != "index.md" {
+		t.Errorf("docs/api/index.md is %+v", index)
+	}
+	if docs.Lookup("api/index.md") != index || root.Lookup(".") != root {
+		t.Error("relative lookups went astray")
+	}
+	for _, name := range []string{"docs/missing", "README.md/x", "../docs", "/docs", ""} {
+		if n := root.Lookup(name); n != nil {
+			t.Errorf("Lookup(%q) found %+v", name, n)
+		}
+	}
+
+	// A tar of flat paths gets its directories made up.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range []struct{ name, body string }{{"a/b/c.txt", "ccc"}, {"a/d.txt", "dddd"}, {"./e.txt", "e"}} {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.body))})
+		tw.Write([]byte(f.body))
+	}
+	tw.Close()
+	flat, err := GetArchiveInfoFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = flat.Tree()
+	a := root.Child("a")
+	if a == nil || !a.IsDir || a.File != nil || a.Size != 7 || a.Files != 2 || root.Size != 8 || root.Lookup("e.txt") == nil {
+		t.Errorf("made-up a is %+v under %+v", a, root)
+	}
+	if b := root.Lookup("a/b"); b == nil || len(b.Children) != 1 || b.Children[0].Path != "a/b/c.txt" {
+		t.Errorf("a/b is %+v", b)
+	}
+}
@@ -0,0 +1,523 @@
+package archiver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// UDF (ECMA-167 as profiled by OSTA), the file system of DVDs and of
+// Windows installer images.  Physical and metadata partitions are read;
+// sparable and virtual ones, which only rewritable and write-once discs
+// use, aren't.
+
+// Descriptor tag identifiers.
+const (
+	udfTagAnchor       = 2
+	udfTagPartition    = 5
+	udfTagLogicalVol   = 6
+	udfTagTerminator   = 8
+	udfTagFileSet      = 256
+	udfTagFileID       = 257
+	udfTagAllocExtent  = 258
+	udfTagFileEntry    = 261
+	udfTagExtFileEntry = 266
+)
+
+// ICB file types.
+const (
+	udfFileDir     = 4
+	udfFileBlock   = 6
+	udfFileChar    = 7
+	udfFileFIFO    = 9
+	udfFileSocket  = 10
+	udfFileSymlink = 12
+)
+
+// Reports whether the volume recognition sequence, which follows any ISO
+// 9660 descriptors from sector 16, names a UDF volume, and its anchor is
+// where it should be.
+func hasUDF(r io.ReaderAt) bool {
+	desc := make([]byte, 6)
+	for sector := int64(16); sector < 16+64; sector++ {
+		if _, err := r.ReadAt(desc, sector*isoSectorSize); err != nil {
+			return false
+		}
+		switch string(desc[1:6]) {
+		case "NSR02", "NSR03":
+			tag := make([]byte, 16)
+			if _, err := r.ReadAt(tag, 256*isoSectorSize); err != nil {
+				return false
+			}
+			return checkUDFTag(tag, udfTagAnchor) == nil
+		case "BEA01", "CD001", "CDW02", "BOOT2":
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// Check a descriptor tag's identifier and checksum.
+func checkUDFTag(tag []byte, id uint16) error {
+	if len(tag) < 16 {
+		return fmt.Errorf("%w: short UDF descriptor", ErrCorruptArchive)
+	}
+	var sum byte
+	for i, b := range tag[:16] {
+		if i != 4 {
+			sum += b
+		}
+	}
+	if got := binary.LittleEndian.Uint16(tag); got != id || sum != tag[4] {
+		return fmt.Errorf("%w: UDF descriptor %d where %d was expected", ErrCorruptArchive, got, id)
+	}
+	return nil
+}
+
+// A partition, as a logical volume's partition map refers to it.
+type udfPartition struct {
+	number uint16        // Partition descriptor number the map names
+	start  int64         // Where a physical partition begins
+	meta   []imageExtent // For a metadata partition, its file's data
+	isMeta bool
+}
+
+// A logical block address: block within a partition, by map index.
+type udfAddr struct {
+	block     uint32
+	partition uint16
+}
+
+type udfVolume struct {
+	ar         *ArchiveInfo
+	r          io.ReaderAt
+	size       int64 // Of the image
+	blockSize  int64
+	partitions []udfPartition
+	visited    map[int64]bool // Directory entries walked, against loops
+	count      int            // Entries listed so far
+}
+
+// Read the anchor, the volume descriptors it points to and the file set
+// they lead to, then walk the tree from its root.
+func (ar *ArchiveInfo) loadUDF(r io.ReaderAt, size int64) error {
+	u := &udfVolume{ar: ar, r: r, size: size, blockSize: isoSectorSize, visited: make(map[int64]bool)}
+	root, err := u.readDescriptors()
+	if err == nil {
+		err = u.walkDir(root, "", 0)
+	}
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	return nil
+}
+
+func (u *udfVolume) readDescriptors() (root udfAddr, err error) {
+	anchor := make([]byte, isoSectorSize)
+	if _, err = u.r.ReadAt(anchor, 256*isoSectorSize); err != nil {
+		return root, err
+	}
+	if err = checkUDFTag(anchor, udfTagAnchor); err != nil {
+		return root, err
+	}
+	vdsLength, vdsStart := int64(binary.LittleEndian.Uint32(anchor[16:])), int64(binary.LittleEndian.Uint32(anchor[20:]))
+
+	starts := make(map[uint16]int64) // Physical partitions' sectors, by number
+	var lvd []byte
+	desc := make([]byte, isoSectorSize)
+	for sector := vdsStart; sector < vdsStart+vdsLength/isoSectorSize; sector++ {
+		if _, err = u.r.ReadAt(desc, sector*isoSectorSize); err != nil {
+			return root, err
+		}
+		id := binary.LittleEndian.Uint16(desc)
+		if checkUDFTag(desc, id) != nil || id == udfTagTerminator {
+			break
+		}
+		switch id {
+		case udfTagPartition:
+			starts[binary.LittleEndian.Uint16(desc[22:])] = int64(binary.LittleEndian.Uint32(desc[188:]))
+		case udfTagLogicalVol:
+			lvd = append([]byte(nil), desc...)
+		}
+	}
+	if lvd == nil {
+		return root, fmt.Errorf("%w: no UDF logical volume descriptor", ErrCorruptArchive)
+	}
+	if u.blockSize = int64(binary.LittleEndian.Uint32(lvd[212:])); u.blockSize < 512 || u.blockSize > 64<<10 {
+		return root, fmt.Errorf("%w: UDF block size %d", ErrCorruptArchive, u.blockSize)
+	}
+
+	// The partition maps, in order, then any metadata partition's file,
+	// which can only be read once the physical partitions are known.
+	maps := lvd[440:min(len(lvd), 440+int(binary.LittleEndian.Uint32(lvd[264:])))]
+	var metas []uint32 // Metadata files' blocks, by map index
+	for n := binary.LittleEndian.Uint32(lvd[268:]); n > 0 && len(maps) >= 2 && int(maps[1]) <= len(maps) && maps[1] >= 6; n-- {
+		m := maps[:maps[1]]
+		maps = maps[maps[1]:]
+		switch {
+		case m[0] == 1:
+			number := binary.LittleEndian.Uint16(m[4:])
+			start, ok := starts[number]
+			if !ok {
+				return root, fmt.Errorf("%w: UDF partition %d missing", ErrCorruptArchive, number)
+			}
+			u.partitions = append(u.partitions, udfPartition{number: number, start: start * isoSectorSize})
+			metas = append(metas, 0)
+		case m[0] == 2 && len(m) >= 44 && strings.HasPrefix(string(m[5:28]), "*UDF Metadata Partition"):
+			u.partitions = append(u.partitions, udfPartition{number: binary.LittleEndian.Uint16(m[38:]), isMeta: true})
+			metas = append(metas, binary.LittleEndian.Uint32(m[40:]))
+		default:
+			name := strings.TrimRight(string(m[5:min(len(m), 28)]), "\x00")
+			return root, fmt.Errorf("%w: UDF partition type %q", ErrUnsupportedFormat, name)
+		}
+	}
+	for i, p := range u.partitions {
+		if !p.isMeta {
+			continue
+		}
+		ref := slices.IndexFunc(u.partitions, func(q udfPartition) bool { return !q.isMeta && q.number == p.number })
+		if ref < 0 {
+			return root, fmt.Errorf("%w: UDF metadata partition on missing partition %d", ErrCorruptArchive, p.number)
+		}
+		entry, err := u.fileEntry(udfAddr{metas[i], uint16(ref)})
+		if err != nil {
+			return root, fmt.Errorf("UDF metadata file: %w", err)
+		}
+		u.partitions[i].meta = entry.extents
+	}
+
+	fsd, err := u.block(udfLongAddr(lvd[248:]))
+	if err != nil {
+		return root, err
+	}
+	if err = checkUDFTag(fsd, udfTagFileSet); err != nil {
+		return root, err
+	}
+	return udfLongAddr(fsd[400:]), nil
+}
+
+// The address in a long_ad: length, block, partition reference.
+func udfLongAddr(ad []byte) udfAddr {
+	return udfAddr{binary.LittleEndian.Uint32(ad[4:]), binary.LittleEndian.Uint16(ad[8:])}
+}
+
+// Where a logical block lies in the image.
+func (u *udfVolume) offset(a udfAddr) (int64, error) {
+	if int(a.partition) >= len(u.partitions) {
+		return 0, fmt.Errorf("%w: UDF partition reference %d", ErrCorruptArchive, a.partition)
+	}
+	p := u.partitions[a.partition]
+	at := int64(a.block) * u.blockSize
+	if !p.isMeta {
+		return p.start + at, nil
+	}
+	for _, e := range p.meta {
+		if at < e.length {
+			if e.offset < 0 {
+				break
+			}
+			return e.offset + at, nil
+		}
+		at -= e.length
+	}
+	return 0, fmt.Errorf("%w: UDF block %d past its metadata partition", ErrCorruptArchive, a.block)
+}
+
+func (u *udfVolume) block(a udfAddr) ([]byte, error) {
+	at, err := u.offset(a)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, u.blockSize)
+	if _, err = u.r.ReadAt(buf, at); err != nil {
+		return nil, fmt.Errorf("UDF block %d: %w", a.block, err)
+	}
+	return buf, nil
+}
+
+// What a file entry says.
+type udfEntry struct {
+	fileType   byte
+	mode       fs.FileMode
+	size       int64
+	extents    []imageExtent
+	modTime    time.Time
+	accessTime time.Time
+	createTime time.Time
+	changeTime time.Time
+}
+
+// Read the file entry or extended file entry at a, and where its data is.
+func (u *udfVolume) fileEntry(a udfAddr) (*udfEntry, error) {
+	fe, err := u.block(a)
+	if err != nil {
+		return nil, err
+	}
+	var adStart, eaLenAt int
+	e := &udfEntry{fileType: fe[27], mode: udfPermissions(binary.LittleEndian.Uint32(fe[44:])),
+		size: int64(binary.LittleEndian.Uint64(fe[56:]))}
+	switch binary.LittleEndian.Uint16(fe) {
+	case udfTagFileEntry:
+		e.accessTime, e.modTime, e.changeTime = udfTime(fe[72:]), udfTime(fe[84:]), udfTime(fe[96:])
+		eaLenAt, adStart = 168, 176
+	case udfTagExtFileEntry:
+		e.accessTime, e.modTime, e.createTime, e.changeTime = udfTime(fe[80:]), udfTime(fe[92:]), udfTime(fe[104:]), udfTime(fe[116:])
+		eaLenAt, adStart = 208, 216
+	default:
+		return nil, checkUDFTag(fe, udfTagFileEntry)
+	}
+	if err = checkUDFTag(fe, binary.LittleEndian.Uint16(fe)); err != nil {
+		return nil, err
+	}
+	adStart += int(binary.LittleEndian.Uint32(fe[eaLenAt:]))
+	adEnd := adStart + int(binary.LittleEndian.Uint32(fe[eaLenAt+4:]))
+	if adEnd > len(fe) || adStart > adEnd {
+		return nil, fmt.Errorf("%w: UDF file entry at block %d overflows", ErrCorruptArchive, a.block)
+	}
+	if e.size < 0 || e.size > u.size && e.fileType == udfFileDir {
+		return nil, fmt.Errorf("%w: UDF directory of %d bytes", ErrCorruptArchive, e.size)
+	}
+	switch flags := binary.LittleEndian.Uint16(fe[34:]) & 7; flags {
+	case 3: // The data is in the entry itself
+		at, _ := u.offset(a)
+		e.extents = []imageExtent{{at + int64(adStart), min(e.size, int64(adEnd-adStart))}}
+	case 0, 1:
+		e.extents, err = u.allocations(fe[adStart:adEnd], flags == 1, a.partition)
+	default:
+		err = fmt.Errorf("%w: UDF allocation type %d", ErrUnsupportedFormat, flags)
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.extents = trimExtents(e.extents, e.size)
+	return e, nil
+}
+
+// Follow short_ad or long_ad allocation descriptors, and the allocation
+// extent descriptors they continue in.
+func (u *udfVolume) allocations(ads []byte, long bool, partition uint16) ([]imageExtent, error) {
+	adLen := 8
+	if long {
+		adLen = 16
+	}
+	var extents []imageExtent
+	for hops := 0; len(ads) >= adLen; {
+		length := binary.LittleEndian.Uint32(ads)
+		kind, size := length>>30, int64(length&0x3fffffff)
+		a := udfAddr{binary.LittleEndian.Uint32(ads[4:]), partition}
+		if long {
+			a.partition = binary.LittleEndian.Uint16(ads[8:])
+		}
+		ads = ads[adLen:]
+		if size == 0 {
+			break
+		}
+		switch kind {
+		case 0:
+			at, err := u.offset(a)
+			if err != nil {
+				return nil, err
+			}
+			extents = append(extents, imageExtent{at, size})
+		case 1, 2: // Allocated or not, but never written
+			extents = append(extents, imageExtent{-1, size})
+		case 3:
+			if hops++; hops > 1024 {
+				return nil, fmt.Errorf("%w: UDF allocation extents loop", ErrCorruptArchive)
+			}
+			aed, err := u.block(a)
+			if err != nil {
+				return nil, err
+			}
+			if err = checkUDFTag(aed, udfTagAllocExtent); err != nil {
+				return nil, err
+			}
+			ads = aed[24:min(len(aed), 24+int(binary.LittleEndian.Uint32(aed[20:])))]
+		}
+	}
+	return extents, nil
+}
+
+// Cut extents down to size bytes in all.
+func trimExtents(extents []imageExtent, size int64) []imageExtent {
+	for i := range extents {
+		if extents[i].length >= size {
+			extents[i].length = size
+			return extents[:i+1]
+		}
+		size -= extents[i].length
+	}
+	return extents
+}
+
+// UDF permissions, five bits each for other, group and owner (execute,
+// write, read, change attributes, delete), as Unix ones.
+func udfPermissions(p uint32) fs.FileMode {
+	return fs.FileMode(p&7 | (p>>5&7)<<3 | (p>>10&7)<<6)
+}
+
+// A 12-byte timestamp: type and zone (minutes east of UTC in the low 12
+// bits; -2047 for none), year, month, day, hour, minute, second,
+// centiseconds, and hundreds of microseconds and microseconds.
+func udfTime(b []byte) time.Time {
+	year := int(int16(binary.LittleEndian.Uint16(b[2:])))
+	if year == 0 && b[4] == 0 {
+		return time.Time{}
+	}
+	loc := time.UTC
+	if zone := int16(binary.LittleEndian.Uint16(b)<<4) >> 4; zone != -2047 && binary.LittleEndian.Uint16(b)>>12 == 1 {
+		loc = time.FixedZone("", int(zone)*60)
+	}
+	micro := int(b[9])*10000 + int(b[10])*100 + int(b[11])
+	return time.Date(year, time.Month(b[4]), int(b[5]), int(b[6]), int(b[7]), int(b[8]), micro*1000, loc)
+}
+
+// An OSTA CS0 string: a compression ID of 8 (or 254) for one byte per
+// character, 16 (or 255) for UCS-2 big-endian, then the characters.
+func udfString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	switch b[0] {
+	case 8, 254:
+		runes := make([]rune, len(b)-1)
+		for i, c := range b[1:] {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	case 16, 255:
+		units := make([]uint16, (len(b)-1)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(b[1+2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+	return ""
+}
+
+// The data of a small file, such as a symlink's path or a directory.
+func (u *udfVolume) readAll(e *udfEntry) ([]byte, error) {
+	data := make([]byte, 0, e.size)
+	for _, x := range e.extents {
+		if x.offset < 0 {
+			data = append(data, make([]byte, x.length)...)
+			continue
+		}
+		chunk := make([]byte, x.length)
+		if _, err := u.r.ReadAt(chunk, x.offset); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+	return data, nil
+}
+
+// A symlink's path components: type, identifier length, version, then the
+// identifier.  Types 1 and 2 are the root, 3 the parent, 4 the current
+// directory and 5 a name.
+func udfLinkTarget(data []byte) string {
+	var parts []string
+	for len(data) >= 4 && 4+int(data[1]) <= len(data) {
+		kind, ident := data[0], data[4:4+int(data[1])]
+		data = data[4+int(data[1]):]
+		switch kind {
+		case 1, 2:
+			parts = []string{""}
+		case 3:
+			parts = append(parts, "..")
+		case 4:
+			parts = append(parts, ".")
+		case 5:
+			parts = append(parts, udfString(ident))
+		}
+	}
+	if len(parts) == 1 && parts[0] == "" {
+		return "/"
+	}
+	return strings.Join(parts, "/")
+}
+
+// List the directory whose file entry is at a under prefix, then each
+// subdirectory in turn.
+func (u *udfVolume) walkDir(a udfAddr, prefix string, depth int) error {
+	dir, err := u.fileEntry(a)
+	if err != nil {
+		return err
+	}
+	data, err := u.readAll(dir)
+	if err != nil {
+		return err
+	}
+	var subdirs []udfAddr
+	var subnames []string
+	for len(data) >= 38 {
+		if err = checkUDFTag(data, udfTagFileID); err != nil {
+			return err
+		}
+		chars, nameLen, iuLen := data[18], int(data[19]), int(binary.LittleEndian.Uint16(data[36:]))
+		recLen := (38 + iuLen + nameLen + 3) &^ 3
+		if 38+iuLen+nameLen > len(data) {
+			return fmt.Errorf("%w: UDF file identifier overflows its directory", ErrCorruptArchive)
+		}
+		icb := udfLongAddr(data[20:])
+		name := udfString(data[38+iuLen : 38+iuLen+nameLen])
+		data = data[min(recLen, len(data)):]
+		if chars&0x0c != 0 || name == "" { // Deleted, or the parent
+			continue
+		}
+		e, err := u.fileEntry(icb)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path.Join(prefix, name), err)
+		}
+		if e.fileType == udfFileDir {
+			// Files may be linked from several directories, but a
+			// directory seen before, or too deep, is a loop.
+			at, _ := u.offset(icb)
+			if u.visited[at] || depth >= isoMaxDepth {
+				continue
+			}
+			u.visited[at] = true
+		}
+		af := ArchivedFile{archivefile: u.ar.fullname, archivetype: ARCHIVE_ISO, name: path.Join(prefix, name),
+			mode: e.mode, modTime: e.modTime, accessTime: e.accessTime, createTime: e.createTime, changeTime: e.changeTime}
+		switch e.fileType {
+		case udfFileDir:
+			af.IsDir, af.mode = true, af.mode|fs.ModeDir
+			subdirs, subnames = append(subdirs, icb), append(subnames, af.name)
+		case udfFileSymlink:
+			target, err := u.readAll(e)
+			if err != nil || e.size > 4096 {
+				return fmt.Errorf("%s: %w: bad symlink", af.name, ErrCorruptArchive)
+			}
+			af.mode, af.linkname = af.mode|fs.ModeSymlink, udfLinkTarget(target)
+		case udfFileBlock:
+			af.mode |= fs.ModeDevice
+		case udfFileChar:
+			af.mode |= fs.ModeDevice | fs.ModeCharDevice
+		case udfFileFIFO:
+			af.mode |= fs.ModeNamedPipe
+		case udfFileSocket:
+			af.mode |= fs.ModeSocket
+		default:
+			af.size, af.packed, af.extents = e.size, e.size, e.extents
+		}
+		af.index = u.count
+		u.count++
+		if err = u.ar.addFile(af); err != nil {
+			return err
+		}
+	}
+	for i, sub := range subdirs {
+		if err = u.walkDir(sub, subnames[i], depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
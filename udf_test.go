@@ -0,0 +1,201 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// A UDF-only image.  The partition starts at sector 64 and holds, by
+// block: the file set descriptor, the root's entry and FIDs, readme.txt's
+// entry and data, sub's entry and FIDs, an inline file linked under sub
+// by a Latin-1 and a UCS-2 name, a symlink to readme.txt, and an extended
+// entry for hole.bin, whose 4K hole comes before 10 bytes in block 10.
+func buildTestUDF(t *testing.T) []byte {
+	t.Helper()
+	const partStart = 64
+	img := make([]byte, 257*isoSectorSize)
+	sector := func(n int) []byte { return img[n*isoSectorSize : (n+1)*isoSectorSize] }
+	block := func(n int) []byte { return sector(partStart + n) }
+	tag := func(d []byte, id uint16, location int) {
+		binary.LittleEndian.PutUint16(d, id)
+		binary.LittleEndian.PutUint16(d[2:], 2)
+		binary.LittleEndian.PutUint32(d[12:], uint32(location))
+		var sum byte
+		for i, b := range d[:16] {
+			if i != 4 {
+				sum += b
+			}
+		}
+		d[4] = sum
+	}
+	longAD := func(d []byte, length, lbn int) {
+		binary.LittleEndian.PutUint32(d, uint32(length))
+		binary.LittleEndian.PutUint32(d[4:], uint32(lbn))
+	}
+	stamp := func(d []byte) { // 2023-04-05 06:07:08.09 +01:00
+		binary.LittleEndian.PutUint16(d, 1<<12|60)
+		binary.LittleEndian.PutUint16(d[2:], 2023)
+		copy(d[4:], []byte{4, 5, 6, 7, 8, 9, 0, 0})
+	}
+	cs0 := func(s string) []byte {
+		for _, r := range s {
+			if r > 0xff {
+				b := []byte{16}
+				for _, u := range utf16.Encode([]rune(s)) {
+					b = binary.BigEndian.AppendUint16(b, u)
+				}
+				return b
+			}
+		}
+		b := []byte{8}
+		for _, r := range s {
+			b = append(b, byte(r))
+		}
+		return b
+	}
+	// A file entry; ads are short_ads, or with inline the data itself.
+	entry := func(n int, fileType byte, size int, inline bool, ads []byte) {
+		d := block(n)
+		d[27] = fileType
+		if inline {
+			d[34] = 3
+		}
+		binary.LittleEndian.PutUint32(d[44:], 4<<10|2<<10|4<<5|4) // rw-r--r--
+		binary.LittleEndian.PutUint64(d[56:], uint64(size))
+		stamp(d[84:])
+		binary.LittleEndian.PutUint32(d[172:], uint32(len(ads)))
+		copy(d[176:], ads)
+		tag(d, udfTagFileEntry, n)
+	}
+	shortAD := func(kind uint32, length, lbn int) []byte {
+		ad := binary.LittleEndian.AppendUint32(nil, kind<<30|uint32(length))
+		return binary.LittleEndian.AppendUint32(ad, uint32(lbn))
+	}
+	fids := func(n int, entries ...[]byte) int {
+		var dir []byte
+		for _, e := range entries {
+			dir = append(dir, e...)
+		}
+		copy(block(n), dir)
+		return len(dir)
+	}
+	fid := func(at int, chars byte, name string, icb int) []byte {
+		ident := cs0(name)
+		if name == "" {
+			ident = nil
+		}
+		d := make([]byte, (38+len(ident)+3)&^3)
+		binary.LittleEndian.PutUint16(d[16:], 1)
+		d[18], d[19] = chars, byte(len(ident))
+		longAD(d[20:], isoSectorSize, icb)
+		copy(d[38:], ident)
+		tag(d, udfTagFileID, at)
+		return d
+	}
+
+	for i, id := range []string{"BEA01", "NSR02", "TEA01"} {
+		d := sector(16 + i)
+		copy(d[1:], id)
+		d[6] = 1
+	}
+	anchor := sector(256)
+	binary.LittleEndian.PutUint32(anchor[16:], 3*isoSectorSize)
+	binary.LittleEndian.PutUint32(anchor[20:], 32)
+	tag(anchor, udfTagAnchor, 256)
+	pd := sector(32)
+	binary.LittleEndian.PutUint32(pd[188:], partStart)
+	binary.LittleEndian.PutUint32(pd[192:], 16)
+	tag(pd, udfTagPartition, 32)
+	lvd := sector(33)
+	binary.LittleEndian.PutUint32(lvd[212:], isoSectorSize)
+	longAD(lvd[248:], isoSectorSize, 0)
+	binary.LittleEndian.PutUint32(lvd[264:], 6)
+	binary.LittleEndian.PutUint32(lvd[268:], 1)
+	copy(lvd[440:], []byte{1, 6, 1, 0, 0, 0})
+	tag(lvd, udfTagLogicalVol, 33)
+	tag(sector(34), udfTagTerminator, 34)
+
+	fsd := block(0)
+	longAD(fsd[400:], isoSectorSize, 1)
+	tag(fsd, udfTagFileSet, 0)
+
+	readme := "hello from the DVD\n"
+	rootLen := fids(2, fid(2, 0x0a, "", 1), fid(2, 0, "readme.txt", 3), fid(2, 0x02, "sub", 5),
+		fid(2, 0, "link", 8), fid(2, 0, "hole.bin", 9))
+	entry(1, udfFileDir, rootLen, false, shortAD(0, rootLen, 2))
+	entry(3, 5, len(readme), false, shortAD(0, len(readme), 4))
+	copy(block(4), readme)
+	subLen := fids(6, fid(6, 0x0a, "", 1), fid(6, 0, "Déjà vu.txt", 7), fid(6, 0, "Ĉu ĝi?", 7))
+	entry(5, udfFileDir, subLen, false, shortAD(0, subLen, 6))
+	entry(7, 5, 5, true, []byte("deep\n"))
+	target := append([]byte{5, byte(len(cs0("readme.txt"))), 0, 0}, cs0("readme.txt")...)
+	entry(8, udfFileSymlink, len(target), true, target)
+
+	hole := block(9)
+	hole[27] = 5
+	binary.LittleEndian.PutUint32(hole[44:], 4<<10|2<<10)
+	binary.LittleEndian.PutUint64(hole[56:], 4096+10)
+	stamp(hole[104:])
+	ads := append(shortAD(1, 4096, 0), shortAD(0, 10, 10)...)
+	binary.LittleEndian.PutUint32(hole[212:], uint32(len(ads)))
+	copy(hole[216:], ads)
+	tag(hole, udfTagExtFileEntry, 9)
+	copy(block(10), "0123456789")
+	return img
+}
+
+func TestUDF(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dvd.iso")
+	if err := os.WriteFile(name, buildTestUDF(t), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := GetArchiveInfo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, af := range ai.Files() {
+		names = append(names, af.Name())
+	}
+	want := "readme.txt,sub,link,hole.bin,sub/Déjà vu.txt,sub/Ĉu ĝi?"
+	if got := strings.Join(names, ","); ai.ArchiveType != ARCHIVE_ISO || got != want {
+		t.Fatalf("type %v, entries %s; want %s", ai.ArchiveType, got, want)
+	}
+
+	readme := ai.File("readme.txt")
+	if data, err := readme.GetBytes(); err != nil || string(data) != "hello from the DVD\n" {
+		t.Errorf("readme.txt: %q, %v", data, err)
+	}
+	when := time.Date(2023, 4, 5, 6, 7, 8, 90000000, time.FixedZone("", 3600))
+	if readme.Mode() != 0o644 || !readme.ModTime().Equal(when) {
+		t.Errorf("readme.txt: mode %v, time %v", readme.Mode(), readme.ModTime())
+	}
+	if offset, err := readme.DataOffset(); err != nil || offset != (64+4)*isoSectorSize {
+		t.Errorf("readme.txt: offset %d, %v", offset, err)
+	}
+	for _, name := range []string{"sub/Déjà vu.txt", "sub/Ĉu ĝi?"} {
+		if data, err := ai.ReadFile(name); err != nil || string(data) != "deep\n" {
+			t.Errorf("%s: %q, %v", name, data, err)
+		}
+	}
+	if sub := ai.File("sub"); !sub.IsDir {
+		t.Error("sub isn't a directory")
+	}
+	if link := ai.File("link"); !link.IsSymlink() || link.Linkname() != "readme.txt" {
+		t.Errorf("link: mode %v, target %q", link.Mode(), link.Linkname())
+	}
+	hole := ai.File("hole.bin")
+	data, err := hole.GetBytes()
+	if err != nil || len(data) != 4106 || !bytes.Equal(data[:4096], make([]byte, 4096)) || string(data[4096:]) != "0123456789" {
+		t.Errorf("hole.bin: %d bytes, %v", len(data), err)
+	}
+	if hole.CreationTime().IsZero() || hole.Mode() != 0o600 {
+		t.Errorf("hole.bin: created %v, mode %v", hole.CreationTime(), hole.Mode())
+	}
+}
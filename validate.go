@@ -0,0 +1,112 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bodgit/sevenzip"
+)
+
+// Cheap structural checks for WithValidateOnOpen.  Failures are reported as
+// ErrCorruptArchive.
+func (ar *ArchiveInfo) validate() error {
+	var err error
+	switch ar.ArchiveType {
+	case ARCHIVE_ZIP:
+		err = ar.validateZip()
+	case ARCHIVE_7Z:
+		err = ar.validate7Z()
+	case ARCHIVE_ISO:
+		err = ar.validateImage()
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", ar.fullname, ErrCorruptArchive, err)
+	}
+	return nil
+}
+
+// The central directory has already been read; make sure each local header
+// it points at is really there and the data fits in the file.
+func (ar *ArchiveInfo) validateZip() error {
+	src, err := ar.openSource()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	zipReader, err := newZipReader(src)
+	if err != nil {
+		return err
+	}
+	for _, f := range zipReader.File {
+		offset, err := f.DataOffset()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if uint64(offset)+f.CompressedSize64 > uint64(ar.size) {
+			return fmt.Errorf("%s: data runs past end of archive", f.Name)
+		}
+	}
+	return nil
+}
+
+// The listing has found each entry's extents; make sure they lie within
+// the image, as they won't in one that was cut short.
+func (ar *ArchiveInfo) validateImage() error {
+	for _, af := range ar.files {
+		for _, e := range af.extents {
+			if e.offset >= 0 && e.offset+e.length > ar.size {
+				return fmt.Errorf("%s: data runs past end of image", af.name)
+			}
+		}
+	}
+	return nil
+}
+
+// sevenzip has checked the header CRCs; decode the start of the first stream
+// to prove the packed data is reachable.
+func (ar *ArchiveInfo) validate7Z() error {
+	src, err := ar.openSource()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	zipReader, err := sevenzip.NewReaderWithPassword(src, src.size, ar.opts.password)
+	if err != nil {
+		return err
+	}
+	for _, f := range zipReader.File {
+		if f.UncompressedSize == 0 {
+			continue
+		}
+		readCloser, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		defer readCloser.Close()
+		if _, err = io.ReadFull(readCloser, make([]byte, 1)); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		break
+	}
+	return nil
+}
+
+// Listing has walked every tar header, so tar is checked as it finishes,
+// without a second pass: the end-of-archive marker must be there, as it
+// isn't in a tar cut short between entries, and the little left of a
+// compressed stream is read so its checksum gets checked, unless it's
+// ended already; not every decompressor takes a read after that kindly.
+func (ar *ArchiveInfo) validateTarEnd(w *tarWalker) error {
+	var err error
+	switch {
+	case w.src.zeros < 2*tarBlockSize:
+		err = errors.New("no end-of-archive marker")
+	case !w.src.ended:
+		_, err = io.Copy(io.Discard, w.src)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", ar.fullname, ErrCorruptArchive, err)
+	}
+	return nil
+}
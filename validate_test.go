@@ -0,0 +1,106 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateOnOpen(t *testing.T) {
+	for _, good := range []string{"testassets/test.zip", "testassets/tgz_test.tgz", "testassets/test.tar", "testassets/test.tar.xz", "testassets/test.tar.zst", "testassets/sz_test.7z", "testassets/codecs.7z"} {
+		if _, err := GetArchiveInfo(good, WithValidateOnOpen()); err != nil {
+			t.Errorf("%s failed validation: %v", good, err)
+		}
+	}
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// Second local header smashed; the central directory still lists fine.
+	zipBytes, _ := os.ReadFile("testassets/test.zip")
+	second := bytes.Index(zipBytes[4:], []byte("PK\x03\x04")) + 4
+	badZip := bytes.Clone(zipBytes)
+	copy(badZip[second:], "XXXX")
+	path := write("badlocal.zip", badZip)
+	if _, err := GetArchiveInfo(path); err != nil {
+		t.Errorf("unvalidated open of %s failed early: %v", path, err)
+	}
+	if _, err := GetArchiveInfo(path, WithValidateOnOpen()); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("validated open of bad local header = %v, want ErrCorruptArchive", err)
+	}
+
+	// Damaged gzip CRC trailer: tar headers are intact.
+	tgzBytes, _ := os.ReadFile("testassets/tgz_test.tgz")
+	badTgz := bytes.Clone(tgzBytes)
+	badTgz[len(badTgz)-8] ^= 0xFF
+	path = write("badcrc.tgz", badTgz)
+	if _, err := GetArchiveInfo(path); err != nil {
+		t.Errorf("unvalidated open of %s failed early: %v", path, err)
+	}
+	if _, err := GetArchiveInfo(path, WithValidateOnOpen()); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("validated open of bad gzip trailer = %v, want ErrCorruptArchive", err)
+	}
+
+	// Truncated archives fail either way.
+	path = write("truncated.tgz", tgzBytes[:len(tgzBytes)/2])
+	if _, err := GetArchiveInfo(path, WithValidateOnOpen()); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("truncated tgz = %v, want ErrCorruptArchive", err)
+	}
+	szBytes, _ := os.ReadFile("testassets/sz_test.7z")
+	path = write("truncated.7z", szBytes[:len(szBytes)/2])
+	if _, err := GetArchiveInfo(path, WithValidateOnOpen()); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("truncated 7z = %v, want ErrCorruptArchive", err)
+	}
+}
+
+func TestValidateTarEnd(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: 5})
+		tw.Write([]byte("hello"))
+	}
+	tw.Close()
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.tar")
+	if err := os.WriteFile(good, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetArchiveInfo(good, WithValidateOnOpen()); err != nil {
+		t.Errorf("%s failed validation: %v", good, err)
+	}
+
+	// Cut after the first entry: it lists cleanly, but the marker's gone.
+	cut := filepath.Join(dir, "cut.tar")
+	if err := os.WriteFile(cut, buf.Bytes()[:2*tarBlockSize], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetArchiveInfo(cut); err != nil {
+		t.Errorf("unvalidated open of %s failed: %v", cut, err)
+	}
+	if _, err := GetArchiveInfo(cut, WithValidateOnOpen()); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("validated open of cut tar = %v, want ErrCorruptArchive", err)
+	}
+
+	// The listing pass does the checking; the stream isn't read twice.
+	data, err := os.ReadFile("testassets/tgz_test.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := &countingReaderAt{r: bytes.NewReader(data)}
+	if _, err := GetArchiveInfoFromReader(counter, int64(len(data)), WithValidateOnOpen()); err != nil {
+		t.Fatal(err)
+	}
+	if counter.n > int64(len(data))*3/2 {
+		t.Errorf("validated listing read %d of %d bytes", counter.n, len(data))
+	}
+}
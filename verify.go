@@ -0,0 +1,97 @@
+package archiver
+
+import (
+	"io"
+	"sync"
+)
+
+// Read every entry through to the end, so each is decompressed and its
+// checksum checked where the format keeps one (the CRC in zip and 7z),
+// with up to workers entries in flight at once.  tar, RAR and compressed
+// file streams can only be read front to back, so they're checked sequentially whatever
+// workers says.  Each damaged entry gives one *EntryError, in archive
+// order; a clean archive gives none.
+func (ai *ArchiveInfo) VerifyAll(workers int) []error {
+	if isTarType(ai.ArchiveType) || isSingleFileType(ai.ArchiveType) || ai.ArchiveType == ARCHIVE_RAR {
+		return ai.verifySequential()
+	}
+	workers = max(1, min(workers, len(ai.files)))
+	results := make([]error, len(ai.files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = ai.files[i].verify()
+			}
+		}()
+	}
+	for i := range ai.files {
+		if !ai.files[i].isDir() {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var errs []error
+	for i, err := range results {
+		if err != nil {
+			errs = append(errs, ai.files[i].verifyError(err))
+		}
+	}
+	return errs
+}
+
+// One pass through the stream.  A fault that stops the stream is reported
+// against the entry it was found in.
+func (ai *ArchiveInfo) verifySequential() []error {
+	var errs []error
+	err := ai.ForEach(func(af *ArchivedFile, r io.Reader) error {
+		if err := af.verifyContent(r); err != nil {
+			errs = append(errs, af.verifyError(err))
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, &EntryError{Archive: ai.fullname, Offset: -1, Err: err})
+	}
+	return errs
+}
+
+// Read the entry through to the end, as VerifyAll does, checking its CRC
+// where the archive stores one and that it holds as much as the listing
+// says.  A damaged entry gives an *EntryError; a directory is always fine.
+func (af *ArchivedFile) Verify() error {
+	if af.isDir() {
+		return nil
+	}
+	if err := af.verify(); err != nil {
+		return af.verifyError(err)
+	}
+	return nil
+}
+
+func (af *ArchivedFile) verify() error {
+	readCloser, err := af.Open()
+	if err != nil {
+		return err
+	}
+	defer readCloser.Close()
+	return af.verifyContent(readCloser)
+}
+
+// Drain r, and check it held as much as the listing said.
+func (af *ArchivedFile) verifyContent(r io.Reader) error {
+	n, err := io.Copy(io.Discard, r)
+	if err == nil && n != af.size && af.mode.IsRegular() {
+		err = ErrSizeMismatch
+	}
+	return err
+}
+
+func (af *ArchivedFile) verifyError(err error) error {
+	return &EntryError{Archive: af.archivefile, Name: af.name, Offset: -1, Err: err}
+}
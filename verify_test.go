@@ -0,0 +1,78 @@
+package archiver
+
+import (
+	"archive/zip"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+func TestVerifyAll(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/corrupt_entry.zip")
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	for _, workers := range []int{0, 1, 4} {
+		errs := ar.VerifyAll(workers)
+		if len(errs) != 1 {
+			t.Fatalf("VerifyAll(%d) = %v, want one error", workers, errs)
+		}
+		var entryErr *EntryError
+		if !errors.As(errs[0], &entryErr) || entryErr.Name != "second.txt" || !errors.Is(errs[0], zip.ErrChecksum) {
+			t.Errorf("VerifyAll(%d) = %v, want a checksum error for second.txt", workers, errs[0])
+		}
+	}
+
+	for _, filename := range []string{"testassets/tree.zip", "testassets/sz_test.7z", "testassets/tgz_test.tgz"} {
+		ar, err = GetArchiveInfo(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := ar.VerifyAll(4); len(errs) != 0 {
+			t.Errorf("%s VerifyAll() = %v", filename, errs)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/corrupt_entry.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entryErr *EntryError
+	if err = ar.File("second.txt").Verify(); !errors.As(err, &entryErr) || !errors.Is(err, zip.ErrChecksum) {
+		t.Errorf("Verify(second.txt) = %v, want a checksum *EntryError", err)
+	}
+	if err = ar.File("first.txt").Verify(); err != nil {
+		t.Errorf("Verify(first.txt) = %v", err)
+	}
+
+	testdata := []struct {
+		filename string
+		name     string
+		ok       bool
+	}{{"testassets/corrupt_entry.zip", "first.txt", true},
+		{"testassets/aes.zip", "public.txt", true},
+		{"testassets/aes.zip", "note.txt", true},    // AE-1
+		{"testassets/aes.zip", "secret.txt", false}, // AE-2
+		{"testassets/codecs.7z", "lzma.txt", true},
+		{"testassets/tgz_test.tgz", "random_text.txt", false},
+	}
+	for _, test := range testdata {
+		ar, err := GetArchiveInfo(test.filename, WithPassword("hunter2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		af := ar.File(test.name)
+		crc, ok := af.CRC32()
+		if ok != test.ok || ok && crc == 0 {
+			t.Errorf("%s CRC32() = %#x, %v", test.name, crc, ok)
+		}
+		if ok {
+			data, _ := af.GetBytes()
+			if want := crc32.ChecksumIEEE(data); crc != want {
+				t.Errorf("%s CRC32() = %#x, content has %#x", test.name, crc, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Split archives come two ways.  7-Zip (and HJSplit, and split(1) with
+// numeric suffixes) cut one archive into name.001, name.002, ..., which
+// read as one once joined.  Zip's spanned archives, name.z01, name.z02,
+// ..., name.zip, count every offset in the central directory from the
+// start of the piece it lands in, so joining them takes a rewritten
+// directory as well.
+
+// The volumes of the split archive path belongs to, in order, given any
+// of them; nil if it isn't part of one.
+func findVolumes(path string) []string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	var paths []string
+	switch {
+	case len(ext) >= 4 && isDigits(ext[1:]):
+		paths = volumeRun(func(i int) string { return fmt.Sprintf("%s.%0*d", base, len(ext)-1, i) }, "")
+	case len(ext) >= 4 && (ext[1] == 'z' || ext[1] == 'Z') && isDigits(ext[2:]):
+		last := ".zip"
+		if ext[1] == 'Z' {
+			last = ".ZIP"
+		}
+		paths = volumeRun(func(i int) string { return fmt.Sprintf("%s.%c%0*d", base, ext[1], len(ext)-2, i) }, base+last)
+	case ext == ".zip" || ext == ".ZIP":
+		paths = volumeRun(func(i int) string { return fmt.Sprintf("%s.%c%02d", base, ext[1], i) }, path)
+	}
+	for _, p := range paths {
+		if p == path {
+			return paths
+		}
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// The files name(1), name(2), ... as far as they go, then last if it's
+// given; nil unless that makes two or more.
+func volumeRun(name func(i int) string, last string) []string {
+	var paths []string
+	for i := 1; ; i++ {
+		p := name(i)
+		if _, err := os.Stat(p); err != nil {
+			break
+		}
+		paths = append(paths, p)
+	}
+	if last != "" && len(paths) > 0 {
+		if _, err := os.Stat(last); err != nil {
+			return nil
+		}
+		paths = append(paths, last)
+	}
+	if len(paths) < 2 {
+		return nil
+	}
+	return paths
+}
+
+// A split archive's volumes, read as one file.
+type volumeSet struct {
+	paths []string
+	sizes []int64
+	skip  int64  // Split-zip marker at the start of the first volume, left out
+	cut   int64  // Where tail takes over from the volumes; -1 for no tail
+	tail  []byte // For zip, the central directory rewritten for the joined volumes
+}
+
+// Take the archive's bytes from the volumes at paths.
+func (ar *ArchiveInfo) openVolumes(paths []string) error {
+	vs := &volumeSet{paths: paths, cut: -1}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		vs.sizes = append(vs.sizes, info.Size())
+	}
+	if last := paths[len(paths)-1]; strings.EqualFold(filepath.Ext(last), ".zip") {
+		if err := vs.joinZip(); err != nil {
+			return openError(ar.fullname, err)
+		}
+	}
+	ar.volumes = vs
+	ar.size = vs.size()
+	return nil
+}
+
+func (vs *volumeSet) size() int64 {
+	if vs.cut < 0 {
+		var total int64
+		for _, size := range vs.sizes {
+			total += size
+		}
+		return total - vs.skip
+	}
+	return vs.cut - vs.skip + int64(len(vs.tail))
+}
+
+// Open the volumes, joined.
+func (vs *volumeSet) open() (source, error) {
+	var files closers
+	var parts []io.ReaderAt
+	var sizes []int64
+	var at int64
+	for i, p := range vs.paths {
+		start, end := at, at+vs.sizes[i]
+		at = end
+		from, to := max(start, vs.skip), end
+		if vs.cut >= 0 {
+			to = min(to, vs.cut)
+		}
+		if to <= from {
+			continue
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			files.Close()
+			return source{}, err
+		}
+		files = append(files, file)
+		parts = append(parts, io.NewSectionReader(file, from-start, to-from))
+		sizes = append(sizes, to-from)
+	}
+	if vs.tail != nil {
+		parts = append(parts, bytes.NewReader(vs.tail))
+		sizes = append(sizes, int64(len(vs.tail)))
+	}
+	joined := newMultiReaderAt(parts, sizes)
+	return source{joined, files, joined.size()}, nil
+}
+
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	var errs []error
+	for _, c := range cs {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// ReaderAts laid end to end.
+type multiReaderAt struct {
+	parts  []io.ReaderAt
+	starts []int64 // Where each part begins, and then the end
+}
+
+func newMultiReaderAt(parts []io.ReaderAt, sizes []int64) *multiReaderAt {
+	m := &multiReaderAt{parts: parts, starts: make([]int64, len(parts)+1)}
+	for i, size := range sizes {
+		m.starts[i+1] = m.starts[i] + size
+	}
+	return m
+}
+
+func (m *multiReaderAt) size() int64 { return m.starts[len(m.parts)] }
+
+func (m *multiReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("multiReaderAt: negative offset")
+	}
+	i := sort.Search(len(m.parts), func(i int) bool { return m.starts[i+1] > off })
+	for ; n < len(p) && i < len(m.parts); i++ {
+		want := int(min(int64(len(p)-n), m.starts[i+1]-off))
+		got, err := m.parts[i].ReadAt(p[n:n+want], off-m.starts[i])
+		n += got
+		off += int64(got)
+		if got < want {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+const (
+	zipSpanMarker    = 0x08074b50 // Starts the first volume of a spanned zip
+	zipCentralSig    = 0x02014b50
+	zipEndSig        = 0x06054b50
+	zip64EndSig      = 0x06064b50
+	zip64LocatorSig  = 0x07064b50
+	zipCentralLen    = 46
+	zipEndLen        = 22
+	zip64EndLen      = 56
+	zip64LocatorLen  = 20
+	zipMaxUint16     = 0xffff
+	zipMaxUint32     = 0xffffffff
+	zipMaxCommentLen = 0xffff
+)
+
+// Read the spanned zip's central directory and rewrite it with offsets
+// into the joined volumes, less the marker, so archive/zip can read the
+// whole as one file.
+func (vs *volumeSet) joinZip() error {
+	raw, err := vs.open()
+	if err != nil {
+		return err
+	}
+	defer raw.Close()
+	starts := make([]int64, len(vs.sizes))
+	for i := 1; i < len(starts); i++ {
+		starts[i] = starts[i-1] + vs.sizes[i-1]
+	}
+	var marker [4]byte
+	if _, err = raw.ReadAt(marker[:], 0); err != nil {
+		return err
+	}
+	var skip int64
+	if binary.LittleEndian.Uint32(marker[:]) == zipSpanMarker {
+		skip = 4
+	}
+
+	// The end record is in the last volume, behind at most a comment.
+	lastSize := vs.sizes[len(vs.sizes)-1]
+	window := min(lastSize, zipEndLen+zipMaxCommentLen)
+	buf := make([]byte, window)
+	if _, err = raw.ReadAt(buf, starts[len(starts)-1]+lastSize-window); err != nil {
+		return err
+	}
+	i := bytes.LastIndex(buf, binary.LittleEndian.AppendUint32(nil, zipEndSig))
+	if i < 0 || len(buf)-i < zipEndLen {
+		return fmt.Errorf("%w: no end of central directory", ErrCorruptArchive)
+	}
+	end := buf[i:]
+	cdDisk := uint64(binary.LittleEndian.Uint16(end[6:]))
+	count := uint64(binary.LittleEndian.Uint16(end[10:]))
+	cdSize := uint64(binary.LittleEndian.Uint32(end[12:]))
+	cdOffset := uint64(binary.LittleEndian.Uint32(end[16:]))
+	comment := end[zipEndLen:min(len(end), zipEndLen+int(binary.LittleEndian.Uint16(end[20:])))]
+	if cdDisk == zipMaxUint16 || count == zipMaxUint16 || cdSize == zipMaxUint32 || cdOffset == zipMaxUint32 {
+		if i < zip64LocatorLen || binary.LittleEndian.Uint32(buf[i-zip64LocatorLen:]) != zip64LocatorSig {
+			return fmt.Errorf("%w: no zip64 end locator", ErrCorruptArchive)
+		}
+		locator := buf[i-zip64LocatorLen:]
+		disk, offset := binary.LittleEndian.Uint32(locator[4:]), binary.LittleEndian.Uint64(locator[8:])
+		if int(disk) >= len(starts) {
+			return fmt.Errorf("%w: zip64 end on missing volume %d", ErrCorruptArchive, disk+1)
+		}
+		rec := make([]byte, zip64EndLen)
+		if _, err = raw.ReadAt(rec, starts[disk]+int64(offset)); err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(rec) != zip64EndSig {
+			return fmt.Errorf("%w: bad zip64 end record", ErrCorruptArchive)
+		}
+		cdDisk = uint64(binary.LittleEndian.Uint32(rec[20:]))
+		count = binary.LittleEndian.Uint64(rec[32:])
+		cdSize = binary.LittleEndian.Uint64(rec[40:])
+		cdOffset = binary.LittleEndian.Uint64(rec[48:])
+	}
+	if cdDisk >= uint64(len(starts)) || cdSize > uint64(raw.size) {
+		return fmt.Errorf("%w: central directory on missing volume %d", ErrCorruptArchive, cdDisk+1)
+	}
+	cdAt := starts[cdDisk] + int64(cdOffset)
+	cd := make([]byte, cdSize)
+	if _, err = raw.ReadAt(cd, cdAt); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	for n := uint64(0); n < count; n++ {
+		used, err := joinZipHeader(&out, cd, starts, skip)
+		if err != nil {
+			return err
+		}
+		cd = cd[used:]
+	}
+	writeZipEnd(&out, count, cdAt-skip, comment)
+	vs.skip, vs.cut, vs.tail = skip, cdAt, out.Bytes()
+	return nil
+}
+
+// Write the central directory header at the start of cd to out with its
+// local header offset made global, returning the bytes it took in cd.
+func joinZipHeader(out *bytes.Buffer, cd []byte, starts []int64, skip int64) (int, error) {
+	if len(cd) < zipCentralLen || binary.LittleEndian.Uint32(cd) != zipCentralSig {
+		return 0, fmt.Errorf("%w: bad central directory header", ErrCorruptArchive)
+	}
+	nameLen := int(binary.LittleEndian.Uint16(cd[28:]))
+	extraLen := int(binary.LittleEndian.Uint16(cd[30:]))
+	commentLen := int(binary.LittleEndian.Uint16(cd[32:]))
+	total := zipCentralLen + nameLen + extraLen + commentLen
+	if len(cd) < total {
+		return 0, fmt.Errorf("%w: truncated central directory", ErrCorruptArchive)
+	}
+	name := cd[zipCentralLen : zipCentralLen+nameLen]
+	extra := cd[zipCentralLen+nameLen : zipCentralLen+nameLen+extraLen]
+	comment := cd[zipCentralLen+nameLen+extraLen : total]
+
+	// Sizes, offset and disk, in that order, move to the zip64 extra
+	// field when they don't fit.
+	usize32, csize32 := binary.LittleEndian.Uint32(cd[24:]), binary.LittleEndian.Uint32(cd[20:])
+	offset := uint64(binary.LittleEndian.Uint32(cd[42:]))
+	disk := uint64(binary.LittleEndian.Uint16(cd[34:]))
+	var usize, csize uint64
+	var others []byte
+	walkZipExtra(extra, func(id uint16, body []byte) {
+		if id != zipExtraZip64 {
+			others = binary.LittleEndian.AppendUint16(others, id)
+			others = binary.LittleEndian.AppendUint16(others, uint16(len(body)))
+			others = append(others, body...)
+			return
+		}
+		for _, field := range []struct {
+			present bool
+			value   *uint64
+			size    int
+		}{{usize32 == zipMaxUint32, &usize, 8}, {csize32 == zipMaxUint32, &csize, 8},
+			{offset == zipMaxUint32, &offset, 8}, {disk == zipMaxUint16, &disk, 4}} {
+			if !field.present || len(body) < field.size {
+				continue
+			}
+			if field.size == 8 {
+				*field.value = binary.LittleEndian.Uint64(body)
+			} else {
+				*field.value = uint64(binary.LittleEndian.Uint32(body))
+			}
+			body = body[field.size:]
+		}
+	})
+	if disk >= uint64(len(starts)) {
+		return 0, fmt.Errorf("%w: %s on missing volume %d", ErrCorruptArchive, name, disk+1)
+	}
+	global := uint64(starts[disk]) + offset - uint64(skip)
+
+	var zip64 []byte
+	if usize32 == zipMaxUint32 {
+		zip64 = binary.LittleEndian.AppendUint64(zip64, usize)
+	}
+	if csize32 == zipMaxUint32 {
+		zip64 = binary.LittleEndian.AppendUint64(zip64, csize)
+	}
+	header := bytes.Clone(cd[:zipCentralLen])
+	if global >= zipMaxUint32 {
+		zip64 = binary.LittleEndian.AppendUint64(zip64, global)
+		binary.LittleEndian.PutUint32(header[42:], zipMaxUint32)
+	} else {
+		binary.LittleEndian.PutUint32(header[42:], uint32(global))
+	}
+	binary.LittleEndian.PutUint16(header[34:], 0)
+	newExtra := others
+	if len(zip64) > 0 {
+		newExtra = binary.LittleEndian.AppendUint16(nil, zipExtraZip64)
+		newExtra = binary.LittleEndian.AppendUint16(newExtra, uint16(len(zip64)))
+		newExtra = append(append(newExtra, zip64...), others...)
+	}
+	if len(newExtra) > zipMaxUint16 {
+		return 0, fmt.Errorf("%w: %s: extra field too long", ErrCorruptArchive, name)
+	}
+	binary.LittleEndian.PutUint16(header[30:], uint16(len(newExtra)))
+	out.Write(header)
+	out.Write(name)
+	out.Write(newExtra)
+	out.Write(comment)
+	return total, nil
+}
+
+// Close a single-volume central directory, of count headers starting at
+// cdOffset and filling out, with zip64 records if it needs them.
+func writeZipEnd(out *bytes.Buffer, count uint64, cdOffset int64, comment []byte) {
+	cdSize := uint64(out.Len())
+	le := binary.LittleEndian
+	if count >= zipMaxUint16 || cdSize >= zipMaxUint32 || uint64(cdOffset) >= zipMaxUint32 {
+		endAt := uint64(cdOffset) + cdSize
+		rec := le.AppendUint32(nil, zip64EndSig)
+		rec = le.AppendUint64(rec, zip64EndLen-12)
+		rec = le.AppendUint16(rec, 45)
+		rec = le.AppendUint16(rec, 45)
+		rec = le.AppendUint32(rec, 0)
+		rec = le.AppendUint32(rec, 0)
+		rec = le.AppendUint64(rec, count)
+		rec = le.AppendUint64(rec, count)
+		rec = le.AppendUint64(rec, cdSize)
+		rec = le.AppendUint64(rec, uint64(cdOffset))
+		rec = le.AppendUint32(rec, zip64LocatorSig)
+		rec = le.AppendUint32(rec, 0)
+		rec = le.AppendUint64(rec, endAt)
+		rec = le.AppendUint32(rec, 1)
+		out.Write(rec)
+		count, cdSize, cdOffset = zipMaxUint16, zipMaxUint32, zipMaxUint32
+	}
+	rec := le.AppendUint32(nil, zipEndSig)
+	rec = le.AppendUint16(rec, 0)
+	rec = le.AppendUint16(rec, 0)
+	rec = le.AppendUint16(rec, uint16(count))
+	rec = le.AppendUint16(rec, uint16(count))
+	rec = le.AppendUint32(rec, uint32(cdSize))
+	rec = le.AppendUint32(rec, uint32(cdOffset))
+	rec = le.AppendUint16(rec, uint16(len(comment)))
+	out.Write(append(rec, comment...))
+}
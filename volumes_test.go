@@ -0,0 +1,93 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitZip(t *testing.T) {
+	for _, name := range []string{"testassets/split.zip", "testassets/split.z01", "testassets/split.z02"} {
+		ai, err := GetArchiveInfo(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if ai.ArchiveType != ARCHIVE_ZIP || len(ai.files) != 3 {
+			t.Fatalf("%s: type %v, %d entries", name, ai.ArchiveType, len(ai.files))
+		}
+		sizes := map[string]int64{"a.bin": 100000, "notes.txt": 20, "b.bin": 50000}
+		for i := range ai.files {
+			af := &ai.files[i]
+			if sizes[af.Name()] != af.Size() {
+				t.Errorf("%s: %s is %d bytes", name, af.Name(), af.Size())
+			}
+		}
+		if errs := ai.VerifyAll(2); len(errs) > 0 {
+			t.Errorf("%s: %v", name, errs)
+		}
+		data, err := ai.File("notes.txt").GetBytes()
+		if err != nil || string(data) != "split archive notes\n" {
+			t.Errorf("%s: notes.txt = %q, %v", name, data, err)
+		}
+	}
+}
+
+// Split sz_test.7z into sz.7z.001 to .003 in dir.
+func writeSZVolumes(t *testing.T, dir string) {
+	t.Helper()
+	whole, err := os.ReadFile("testassets/sz_test.7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	piece := len(whole)/3 + 1
+	for i := 0; i*piece < len(whole); i++ {
+		part := whole[i*piece : min((i+1)*piece, len(whole))]
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("sz.7z.%03d", i+1)), part, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNumberedVolumes(t *testing.T) {
+	dir := t.TempDir()
+	writeSZVolumes(t, dir)
+	want, err := GetArchiveInfo("testassets/sz_test.7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"sz.7z.001", "sz.7z.002"} {
+		ai, err := GetArchiveInfo(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if ai.ArchiveType != ARCHIVE_7Z || len(ai.files) != len(want.files) {
+			t.Fatalf("%s: type %v, %d entries", name, ai.ArchiveType, len(ai.files))
+		}
+		for i := range ai.files {
+			if ai.files[i].IsDir {
+				continue
+			}
+			got, err := ai.files[i].GetBytes()
+			if err != nil {
+				t.Fatalf("%s: %s: %v", name, ai.files[i].Name(), err)
+			}
+			expected, _ := want.files[i].GetBytes()
+			if string(got) != string(expected) {
+				t.Errorf("%s: %s differs", name, ai.files[i].Name())
+			}
+		}
+	}
+}
+
+func TestFindVolumes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"one.zip", "a.001", "b.z01", "b.zip"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0o644)
+	}
+	for name, want := range map[string]int{"one.zip": 0, "a.001": 0, "b.z01": 2, "b.zip": 2, "c.001": 0} {
+		if got := findVolumes(filepath.Join(dir, name)); len(got) != want {
+			t.Errorf("%s: %d volumes, want %d", name, len(got), want)
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/bits"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Windows Imaging Format (.wim, .esd): a header, then resources, each
+// stored or compressed in chunks: the files' data, deduplicated by SHA-1,
+// a lookup table from hash to resource, and for each image a metadata
+// resource holding its directory tree.  A WIM of several images lists
+// each under its number, as 7-Zip does.
+
+const (
+	wimMagic       = "MSWIM\x00\x00\x00"
+	wimHeaderLen   = 208
+	wimLookupLen   = 50 // A lookup table entry
+	wimDentryLen   = 106
+	wimStreamLen   = 38 // An extra stream entry, before its name
+	wimMaxTable    = 256 << 20
+	wimMaxReparse  = 16 << 10
+	wimDefaultSize = 32768 // Chunk size, where the header gives none
+)
+
+// Header flags.
+const (
+	wimFlagCompressed = 0x00000002
+	wimFlagXPRESS     = 0x00020000
+	wimFlagLZX        = 0x00040000
+	wimFlagLZMS       = 0x00080000
+)
+
+// Resource flags.
+const (
+	wimResMetadata   = 0x02
+	wimResCompressed = 0x04
+	wimResSolid      = 0x10
+)
+
+// Dentry attributes, and the reparse tags listed as links.
+const (
+	wimAttrReadOnly  = 0x01
+	wimAttrDirectory = 0x10
+	wimAttrReparse   = 0x400
+	wimTagSymlink    = 0xA000000C
+	wimTagJunction   = 0xA0000003
+)
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_WIM,
+		detect:      func(header []byte) bool { return bytes.HasPrefix(header, []byte(wimMagic)) },
+		load:        loadWim,
+		open:        openWimEntry,
+	})
+}
+
+// Where a resource is, and how big it is stored and whole.
+type wimResource struct {
+	offset int64
+	packed int64
+	size   int64
+	flags  byte
+}
+
+func wimResourceAt(b []byte) wimResource {
+	v := binary.LittleEndian.Uint64(b)
+	return wimResource{packed: int64(v & (1<<56 - 1)), flags: byte(v >> 56),
+		offset: int64(binary.LittleEndian.Uint64(b[8:])), size: int64(binary.LittleEndian.Uint64(b[16:]))}
+}
+
+// An image open for reading.
+type wimFile struct {
+	src       source
+	flags     uint32
+	chunkSize int
+	lookup    wimResource
+	images    []wimResource // Metadata, in image order
+	blobs     map[[20]byte]wimResource
+}
+
+// Read the header, leaving the lookup table for readLookup.
+func readWimHeader(src source) (*wimFile, error) {
+	head := make([]byte, wimHeaderLen)
+	if _, err := src.ReadAt(head, 0); err != nil {
+		return nil, fmt.Errorf("WIM header: %w", noEOF(err))
+	}
+	le := binary.LittleEndian
+	if string(head[:8]) != wimMagic || le.Uint32(head[8:]) < wimHeaderLen {
+		return nil, fmt.Errorf("%w: bad WIM header", ErrCorruptArchive)
+	}
+	wf := &wimFile{src: src, flags: le.Uint32(head[16:]), chunkSize: int(le.Uint32(head[20:])),
+		lookup: wimResourceAt(head[48:])}
+	if parts := le.Uint16(head[42:]); parts > 1 {
+		return nil, fmt.Errorf("%w: WIM split into %d parts", ErrUnsupportedFormat, parts)
+	}
+	if wf.chunkSize == 0 {
+		wf.chunkSize = wimDefaultSize
+	}
+	if wf.flags&wimFlagCompressed != 0 && (bits.OnesCount(uint(wf.chunkSize)) != 1 || wf.chunkSize < 1<<15 ||
+		wf.chunkSize > 1<<21) {
+		return nil, fmt.Errorf("%w: WIM chunks of %d bytes", ErrUnsupportedFormat, wf.chunkSize)
+	}
+	return wf, nil
+}
+
+// Read the lookup table: the data resources by hash, and the images'
+// metadata in turn.
+func (wf *wimFile) readLookup() error {
+	if wf.lookup.size > wimMaxTable {
+		return fmt.Errorf("%w: WIM lookup table of %d bytes", ErrCorruptArchive, wf.lookup.size)
+	}
+	table, err := wf.readAll(wf.lookup)
+	if err != nil {
+		return fmt.Errorf("WIM lookup table: %w", err)
+	}
+	wf.blobs = make(map[[20]byte]wimResource)
+	for ; len(table) >= wimLookupLen; table = table[wimLookupLen:] {
+		res := wimResourceAt(table)
+		if res.flags&wimResMetadata != 0 {
+			wf.images = append(wf.images, res)
+			continue
+		}
+		wf.blobs[[20]byte(table[30:50])] = res
+	}
+	return nil
+}
+
+// The codec's name, for Method.
+func (wf *wimFile) method() string {
+	switch {
+	case wf.flags&wimFlagLZX != 0:
+		return "LZX"
+	case wf.flags&wimFlagXPRESS != 0:
+		return "XPRESS"
+	case wf.flags&wimFlagLZMS != 0:
+		return "LZMS"
+	}
+	return "Store"
+}
+
+// A resource's content.
+func (wf *wimFile) open(res wimResource) (io.Reader, error) {
+	if res.offset < 0 || res.packed > wf.src.size-res.offset || res.size < 0 {
+		return nil, fmt.Errorf("%w: WIM resource outside the file", ErrCorruptArchive)
+	}
+	data := io.NewSectionReader(wf.src, res.offset, res.packed)
+	switch {
+	case res.flags&wimResSolid != 0:
+		return nil, fmt.Errorf("%w: WIM solid resources", ErrUnsupportedFormat)
+	case res.flags&wimResCompressed == 0:
+		if res.packed != res.size {
+			return nil, fmt.Errorf("%w: stored WIM resource of %d bytes holds %d", ErrCorruptArchive, res.size, res.packed)
+		}
+		return data, nil
+	}
+	var decode func(in []byte, size int) ([]byte, error)
+	switch wf.method() {
+	case "LZX":
+		windowBits := bits.Len(uint(wf.chunkSize)) - 1
+		decode = func(in []byte, size int) ([]byte, error) {
+			d, err := newWIMLZXDecoder(windowBits)
+			if err != nil {
+				return nil, err
+			}
+			return d.decodeFrame(in, size)
+		}
+	case "XPRESS":
+		decode = xpressDecode
+	default:
+		return nil, fmt.Errorf("%w: WIM %s compression", ErrUnsupportedFormat, wf.method())
+	}
+	// A table of where each chunk but the first starts, after the table.
+	chunks := (res.size + int64(wf.chunkSize) - 1) / int64(wf.chunkSize)
+	entryLen := int64(4)
+	if res.size > 1<<32-1 {
+		entryLen = 8
+	}
+	tableLen := max(chunks-1, 0) * entryLen
+	if tableLen > res.packed {
+		return nil, fmt.Errorf("%w: WIM chunk table", ErrCorruptArchive)
+	}
+	table := make([]byte, tableLen)
+	if _, err := data.ReadAt(table, 0); err != nil {
+		return nil, fmt.Errorf("WIM chunk table: %w", noEOF(err))
+	}
+	starts := make([]int64, chunks+1)
+	for i := int64(1); i < chunks; i++ {
+		if entryLen == 4 {
+			starts[i] = int64(binary.LittleEndian.Uint32(table[(i-1)*4:]))
+		} else {
+			starts[i] = int64(binary.LittleEndian.Uint64(table[(i-1)*8:]))
+		}
+	}
+	starts[chunks] = res.packed - tableLen
+	for i := int64(1); i <= chunks; i++ {
+		if starts[i] < starts[i-1] {
+			return nil, fmt.Errorf("%w: WIM chunk table", ErrCorruptArchive)
+		}
+	}
+	return &wimChunkReader{data: io.NewSectionReader(data, tableLen, res.packed-tableLen), starts: starts,
+		size: res.size, chunkSize: wf.chunkSize, decode: decode}, nil
+}
+
+// A whole resource, as the tables are read.
+func (wf *wimFile) readAll(res wimResource) ([]byte, error) {
+	r, err := wf.open(res)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, res.size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, noEOF(err)
+	}
+	return data, nil
+}
+
+// Decompresses a resource's chunks in turn; one whose stored size is its
+// whole size was stored as it is.
+type wimChunkReader struct {
+	data      *io.SectionReader
+	starts    []int64 // Of each chunk, and the end
+	size      int64
+	chunkSize int
+	decode    func(in []byte, size int) ([]byte, error)
+	next      int
+	buf       []byte
+}
+
+func (cr *wimChunkReader) Read(p []byte) (int, error) {
+	for len(cr.buf) == 0 {
+		if cr.next == len(cr.starts)-1 {
+			return 0, io.EOF
+		}
+		size := int(min(int64(cr.chunkSize), cr.size-int64(cr.next)*int64(cr.chunkSize)))
+		packed := cr.starts[cr.next+1] - cr.starts[cr.next]
+		if packed > int64(size) {
+			return 0, fmt.Errorf("%w: WIM chunk %d of %d bytes holds %d", ErrCorruptArchive, cr.next, packed, size)
+		}
+		in := make([]byte, packed)
+		if _, err := cr.data.ReadAt(in, cr.starts[cr.next]); err != nil {
+			return 0, fmt.Errorf("WIM chunk %d: %w", cr.next, noEOF(err))
+		}
+		cr.buf = in
+		if len(in) != size {
+			var err error
+			if cr.buf, err = cr.decode(in, size); err != nil {
+				return 0, fmt.Errorf("WIM chunk %d: %w", cr.next, err)
+			}
+		}
+		cr.next++
+	}
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+func loadWim(ar *ArchiveInfo) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	wf, err := readWimHeader(src)
+	if err == nil {
+		err = wf.readLookup()
+	}
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	w := &wimWalker{ar: ar, wf: wf}
+	for i, res := range wf.images {
+		if res.size > wimMaxTable {
+			return openError(ar.fullname, fmt.Errorf("%w: WIM metadata of %d bytes", ErrCorruptArchive, res.size))
+		}
+		meta, err := wf.readAll(res)
+		if err != nil {
+			return openError(ar.fullname, fmt.Errorf("WIM image %d: %w", i+1, err))
+		}
+		w.meta, w.links = meta, make(map[uint64]string)
+		if err := w.walkImage(i, len(wf.images)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lists an image's tree from its metadata resource.
+type wimWalker struct {
+	ar    *ArchiveInfo
+	wf    *wimFile
+	meta  []byte
+	links map[uint64]string // Names by hard link group, within the image
+	count int
+}
+
+// A directory entry, as much of it as is listed.
+type wimDentry struct {
+	attr     uint32
+	subdir   int64
+	af       ArchivedFile
+	hash     [20]byte
+	tag      uint32 // Reparse tag
+	linkID   uint64 // Hard link group
+	fileName string
+}
+
+// The image's security data comes first, its root's dentry after it.
+func (w *wimWalker) walkImage(image, images int) error {
+	if len(w.meta) < 8 {
+		return openError(w.ar.fullname, fmt.Errorf("%w: WIM metadata", ErrCorruptArchive))
+	}
+	rootAt := max(int64(binary.LittleEndian.Uint32(w.meta)+7)&^7, 8)
+	root, _, err := w.dentry(rootAt)
+	if err == nil && root == nil {
+		err = fmt.Errorf("%w: WIM image without a root", ErrCorruptArchive)
+	}
+	if err != nil {
+		return openError(w.ar.fullname, err)
+	}
+	prefix := ""
+	if images > 1 {
+		prefix = strconv.Itoa(image + 1)
+		root.af.name, root.af.IsDir, root.af.mode = prefix, true, fs.ModeDir|0o755
+		if err := w.add(root); err != nil {
+			return err
+		}
+	}
+	return w.walk(root.subdir, prefix, 0)
+}
+
+// List the directory whose entries start at offset, each followed by its
+// own contents.
+func (w *wimWalker) walk(offset int64, dir string, depth int) error {
+	if depth > isoMaxDepth {
+		return nil
+	}
+	for offset != 0 {
+		d, next, err := w.dentry(offset)
+		if err != nil {
+			return openError(w.ar.fullname, err)
+		}
+		if d == nil {
+			return nil
+		}
+		d.af.name = path.Join(dir, d.fileName)
+		if err := w.describe(d); err != nil {
+			return openError(w.ar.fullname, fmt.Errorf("%s: %w", d.af.name, err))
+		}
+		if err := w.add(d); err != nil {
+			return err
+		}
+		if d.af.IsDir {
+			if err := w.walk(d.subdir, d.af.name, depth+1); err != nil {
+				return err
+			}
+		}
+		offset = next
+	}
+	return nil
+}
+
+func (w *wimWalker) add(d *wimDentry) error {
+	d.af.archivefile, d.af.archivetype, d.af.index = w.ar.fullname, ARCHIVE_WIM, w.count
+	w.count++
+	return w.ar.addFile(d.af)
+}
+
+// Fill in the entry's type and data from its attributes and streams.
+func (w *wimWalker) describe(d *wimDentry) error {
+	af := &d.af
+	switch {
+	case d.attr&wimAttrDirectory != 0 && d.attr&wimAttrReparse == 0:
+		af.IsDir, af.mode = true, fs.ModeDir|0o755
+		return nil
+	case d.attr&wimAttrReadOnly != 0:
+		af.mode = 0o444
+	default:
+		af.mode = 0o644
+	}
+	if d.linkID != 0 {
+		if target, ok := w.links[d.linkID]; ok {
+			af.hardlink, af.linkname = true, target
+			return nil
+		}
+		w.links[d.linkID] = af.name
+	}
+	if d.hash == [20]byte{} {
+		return nil
+	}
+	res, ok := w.wf.blobs[d.hash]
+	if !ok {
+		return fmt.Errorf("%w: WIM stream %x missing", ErrCorruptArchive, d.hash)
+	}
+	if d.attr&wimAttrReparse != 0 {
+		// The stream is the reparse data; a link's target is in it.
+		if d.tag != wimTagSymlink && d.tag != wimTagJunction {
+			return nil
+		}
+		if res.size > wimMaxReparse {
+			return fmt.Errorf("%w: WIM reparse data of %d bytes", ErrCorruptArchive, res.size)
+		}
+		data, err := w.wf.readAll(res)
+		if err != nil {
+			return err
+		}
+		af.mode, af.linkname = fs.ModeSymlink|0o777, wimLinkTarget(data, d.tag)
+		return nil
+	}
+	af.size, af.packed = res.size, res.packed
+	af.method = "Store"
+	if res.flags&wimResCompressed != 0 {
+		af.method = w.wf.method()
+	}
+	if res.flags&wimResSolid == 0 {
+		af.extents = []imageExtent{{res.offset, res.packed}}
+	}
+	return nil
+}
+
+// The dentry at offset, and where its next sibling is; nil at the end of
+// a directory.
+func (w *wimWalker) dentry(offset int64) (*wimDentry, int64, error) {
+	meta := w.meta
+	if offset < 0 || offset > int64(len(meta))-8 {
+		return nil, 0, fmt.Errorf("%w: WIM dentry at %d outside the metadata", ErrCorruptArchive, offset)
+	}
+	le := binary.LittleEndian
+	length := int64(le.Uint64(meta[offset:]))
+	if length == 0 {
+		return nil, 0, nil
+	}
+	if length < wimDentryLen || length > int64(len(meta))-offset {
+		return nil, 0, fmt.Errorf("%w: WIM dentry at %d", ErrCorruptArchive, offset)
+	}
+	b := meta[offset : offset+length]
+	d := &wimDentry{attr: le.Uint32(b[8:]), subdir: int64(le.Uint64(b[16:])), hash: [20]byte(b[64:84]),
+		tag: le.Uint32(b[88:]), linkID: le.Uint64(b[92:])}
+	d.af.createTime, d.af.accessTime = fileTimeToTime(le.Uint64(b[40:])), fileTimeToTime(le.Uint64(b[48:]))
+	d.af.modTime = fileTimeToTime(le.Uint64(b[56:]))
+	if d.attr&wimAttrReparse != 0 {
+		d.linkID = 0 // The field is the tag's then
+	}
+	nameLen := int64(le.Uint16(b[104:]))
+	if wimDentryLen+nameLen > length {
+		return nil, 0, fmt.Errorf("%w: WIM dentry at %d", ErrCorruptArchive, offset)
+	}
+	d.fileName = strings.ReplaceAll(wimString(b[wimDentryLen:wimDentryLen+nameLen]), "/", "_")
+	// Then the extra streams: named ones, and the unnamed one too where
+	// there are named ones.
+	next := (offset + length + 7) &^ 7
+	for i := le.Uint16(b[100:]); i > 0; i-- {
+		if next > int64(len(meta))-wimStreamLen {
+			return nil, 0, fmt.Errorf("%w: WIM stream entry at %d", ErrCorruptArchive, next)
+		}
+		s := meta[next:]
+		sLen := int64(le.Uint64(s))
+		if sLen < wimStreamLen || sLen > int64(len(s)) {
+			return nil, 0, fmt.Errorf("%w: WIM stream entry at %d", ErrCorruptArchive, next)
+		}
+		if le.Uint16(s[36:]) == 0 && d.hash == [20]byte{} {
+			d.hash = [20]byte(s[16:36])
+		}
+		next = (next + sLen + 7) &^ 7
+	}
+	return d, next, nil
+}
+
+// UTF-16LE text.
+func wimString(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// A symlink or junction's target, from its reparse data: the name to
+// print, or failing that the one to substitute, with slashes.
+func wimLinkTarget(data []byte, tag uint32) string {
+	if len(data) < 8 {
+		return ""
+	}
+	le := binary.LittleEndian
+	names := data[8:]
+	if tag == wimTagSymlink {
+		if len(data) < 12 {
+			return ""
+		}
+		names = data[12:]
+	}
+	name := func(at, n uint16) string {
+		if int(at)+int(n) > len(names) {
+			return ""
+		}
+		return wimString(names[at : at+n])
+	}
+	target := name(le.Uint16(data[4:]), le.Uint16(data[6:]))
+	if target == "" {
+		target = strings.TrimPrefix(name(le.Uint16(data), le.Uint16(data[2:])), `\??\`)
+	}
+	return strings.ReplaceAll(target, `\`, "/")
+}
+
+func openWimEntry(af *ArchivedFile) (io.ReadCloser, error) {
+	if len(af.extents) == 0 {
+		if af.size > 0 {
+			return nil, fmt.Errorf("%s: %w: WIM solid resources", af.name, ErrUnsupportedFormat)
+		}
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	wf, err := readWimHeader(src)
+	var r io.Reader
+	if err == nil {
+		res := wimResource{offset: af.extents[0].offset, packed: af.extents[0].length, size: af.size}
+		if af.method != "Store" {
+			res.flags = wimResCompressed
+		}
+		r, err = wf.open(res)
+	}
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("%s: %w", af.name, err)
+	}
+	return &entryReader{r, []io.Closer{src}}, nil
+}
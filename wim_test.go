@@ -0,0 +1,212 @@
+package archiver
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// A dentry to lay out, with its children if it's a directory.
+type testWimDentry struct {
+	name     string
+	attr     uint32
+	data     []byte // Hashed into the dentry; nil for none
+	tag      uint32
+	linkID   uint64
+	children []testWimDentry
+}
+
+const testWimTime = 133000000000000000 // A FILETIME in 2022
+
+// Lay out an image's metadata: empty security data, the root, then each
+// directory's entries, with each subdirectory's after its parent's.
+func buildTestWimMetadata(root testWimDentry) []byte {
+	meta := (&testLE{}).u32(8, 0).b
+	var list func(entries []testWimDentry) int
+	dentry := func(d testWimDentry) (subdirAt int) {
+		name := utf16.Encode([]rune(d.name))
+		b := (&testLE{}).u64(0).u32(d.attr, 0xFFFFFFFF).u64(0, 0, 0).u64(testWimTime, testWimTime, testWimTime).b
+		if d.data != nil {
+			sum := sha1.Sum(d.data)
+			b = append(b, sum[:]...)
+		} else {
+			b = append(b, make([]byte, 20)...)
+		}
+		b = (&testLE{b: b}).u32(0, d.tag).u64(d.linkID).u16(0, 0, uint16(2*len(name))).b
+		if d.tag != 0 {
+			binary.LittleEndian.PutUint32(b[92:], 0)
+		}
+		for _, u := range name {
+			b = binary.LittleEndian.AppendUint16(b, u)
+		}
+		if len(name) > 0 {
+			b = append(b, 0, 0)
+		}
+		binary.LittleEndian.PutUint64(b, uint64(len(b)))
+		for len(b)%8 != 0 {
+			b = append(b, 0)
+		}
+		subdirAt = len(meta) + 16
+		meta = append(meta, b...)
+		return subdirAt
+	}
+	list = func(entries []testWimDentry) int {
+		at := len(meta)
+		var patches []int
+		for _, d := range entries {
+			patches = append(patches, dentry(d))
+		}
+		meta = append(meta, make([]byte, 8)...)
+		for i, d := range entries {
+			if d.attr&wimAttrDirectory != 0 {
+				subdir := list(d.children)
+				binary.LittleEndian.PutUint64(meta[patches[i]:], uint64(subdir))
+			}
+		}
+		return at
+	}
+	rootPatch := dentry(root)
+	meta = append(meta, make([]byte, 8)...)
+	subdir := list(root.children)
+	binary.LittleEndian.PutUint64(meta[rootPatch:], uint64(subdir))
+	return meta
+}
+
+// A resource compressed chunk by chunk, each stored as it is where encode
+// doesn't shrink it.
+func wimCompress(data []byte, chunkSize int, encode func([]byte) []byte) []byte {
+	var table, chunks []byte
+	for at := 0; at < len(data); at += chunkSize {
+		if at > 0 {
+			table = binary.LittleEndian.AppendUint32(table, uint32(len(chunks)))
+		}
+		chunk := data[at:min(at+chunkSize, len(data))]
+		if packed := encode(chunk); len(packed) < len(chunk) {
+			chunk = packed
+		}
+		chunks = append(chunks, chunk...)
+	}
+	return append(table, chunks...)
+}
+
+// A WIM of the given images, compressed by encode under flag, with the
+// blobs compressed but for one stored.
+func buildTestWim(flag uint32, encode func([]byte) []byte, blobs [][]byte, images []testWimDentry) []byte {
+	wim := make([]byte, wimHeaderLen)
+	var lookup []byte
+	addResource := func(data []byte, flags byte, hash [20]byte) {
+		res := data
+		if flags&wimResCompressed != 0 {
+			res = wimCompress(data, wimDefaultSize, encode)
+		}
+		lookup = (&testLE{b: lookup}).u64(uint64(len(res))|uint64(flags)<<56, uint64(len(wim)), uint64(len(data))).
+			u16(1).u32(1).b
+		lookup = append(lookup, hash[:]...)
+		wim = append(wim, res...)
+	}
+	for i, blob := range blobs {
+		var flags byte = wimResCompressed
+		if i == 0 {
+			flags = 0
+		}
+		addResource(blob, flags, sha1.Sum(blob))
+	}
+	for i, root := range images {
+		addResource(buildTestWimMetadata(root), wimResMetadata|wimResCompressed, [20]byte{byte(i)})
+	}
+	lookupAt := len(wim)
+	wim = append(wim, lookup...)
+	head := (&testLE{b: []byte(wimMagic)}).u32(wimHeaderLen, 0x10d00, wimFlagCompressed|flag, wimDefaultSize).b
+	head = append(head, make([]byte, 16)...)
+	head = (&testLE{b: head}).u16(1, 1).u32(uint32(len(images))).
+		u64(uint64(len(lookup)), uint64(lookupAt), uint64(len(lookup))).b
+	copy(wim, head)
+	return wim
+}
+
+// A symlink's reparse data, without the header NTFS gives it.
+func testWimSymlink(target string) []byte {
+	name := utf16.Encode([]rune(target))
+	b := (&testLE{}).u16(0, uint16(2*len(name)), uint16(2*len(name)), uint16(2*len(name))).u32(1).b
+	for i := 0; i < 2; i++ {
+		for _, u := range name {
+			b = binary.LittleEndian.AppendUint16(b, u)
+		}
+	}
+	return b
+}
+
+func TestWim(t *testing.T) {
+	hello := []byte("hello\n")
+	big := bytes.Repeat([]byte("Windows imaging format, "), 2000)
+	link := testWimSymlink(`Windows\notepad.exe`)
+	blobs := [][]byte{hello, big, link}
+	image1 := testWimDentry{attr: wimAttrDirectory, children: []testWimDentry{
+		{name: "Windows", attr: wimAttrDirectory, children: []testWimDentry{
+			{name: "notepad.exe", attr: 0x20, data: big},
+		}},
+		{name: "readme.txt", attr: wimAttrReadOnly, data: hello, linkID: 7},
+		{name: "hard.txt", attr: wimAttrReadOnly, data: hello, linkID: 7},
+		{name: "empty.txt", attr: 0x20},
+		{name: "link", attr: wimAttrReparse, data: link, tag: wimTagSymlink},
+	}}
+	image2 := testWimDentry{attr: wimAttrDirectory, children: []testWimDentry{
+		{name: "ünïcode.txt", attr: 0x20, data: big},
+	}}
+	for _, codec := range []struct {
+		flag   uint32
+		encode func([]byte) []byte
+		method string
+	}{{wimFlagXPRESS, xpressEncode, "XPRESS"}, {wimFlagLZX, lzxWIMEncode, "LZX"}} {
+		wim := buildTestWim(codec.flag, codec.encode, blobs, []testWimDentry{image1, image2})
+		name := filepath.Join(t.TempDir(), "install.wim")
+		if err := os.WriteFile(name, wim, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ai, err := GetArchiveInfo(name)
+		if err != nil {
+			t.Fatalf("%s: %v", codec.method, err)
+		}
+		var names []string
+		for _, af := range ai.Files() {
+			names = append(names, af.Name())
+		}
+		if got := strings.Join(names, ","); ai.ArchiveType != ARCHIVE_WIM || got !=
+			"1,1/Windows,1/Windows/notepad.exe,1/readme.txt,1/hard.txt,1/empty.txt,1/link,2,2/ünïcode.txt" {
+			t.Fatalf("%s: type %v, entries %s", codec.method, ai.ArchiveType, got)
+		}
+		for name, content := range map[string][]byte{"1/Windows/notepad.exe": big, "1/readme.txt": hello,
+			"1/empty.txt": nil, "2/ünïcode.txt": big} {
+			if got, err := ai.File(name).GetBytes(); err != nil || !bytes.Equal(got, content) {
+				t.Errorf("%s: %s: %d bytes, %v; want %d", codec.method, name, len(got), err, len(content))
+			}
+		}
+		notepad := ai.File("1/Windows/notepad.exe")
+		if notepad.Method() != codec.method || notepad.Mode() != 0o644 ||
+			!notepad.ModTime().Equal(fileTimeToTime(testWimTime)) {
+			t.Errorf("%s: notepad.exe: method %q, mode %v, time %v", codec.method, notepad.Method(), notepad.Mode(),
+				notepad.ModTime())
+		}
+		if af := ai.File("1/readme.txt"); af.Mode() != 0o444 || af.Method() != "Store" {
+			t.Errorf("%s: readme.txt: mode %v, method %q", codec.method, af.Mode(), af.Method())
+		}
+		if af := ai.File("1/hard.txt"); !af.hardlink || af.linkname != "1/readme.txt" {
+			t.Errorf("%s: hard.txt: hardlink %v to %q", codec.method, af.hardlink, af.linkname)
+		}
+		if af := ai.File("1/link"); af.Mode()&fs.ModeSymlink == 0 || af.linkname != "Windows/notepad.exe" {
+			t.Errorf("%s: link: mode %v, target %q", codec.method, af.Mode(), af.linkname)
+		}
+	}
+
+	lzms := buildTestWim(wimFlagLZMS, func(b []byte) []byte { return b[:1] }, blobs, []testWimDentry{image1})
+	if _, err := GetArchiveInfoFromReader(bytes.NewReader(lzms), int64(len(lzms))); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("LZMS: %v", err)
+	}
+}
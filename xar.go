@@ -0,0 +1,244 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// XAR archives, as macOS flat installer packages (.pkg) and .xip files
+// are: a header, a zlib-compressed XML table of contents, then the heap
+// that the entries' data lies in, each compressed on its own.
+
+const (
+	xarMagic     = "xar!"
+	xarHeaderLen = 28
+	xarMaxTOC    = 64 << 20 // Uncompressed; a bigger one is taken as corrupt
+)
+
+// The codec of each data encoding, for Method.  x-gzip is zlib, despite
+// the name.
+var xarMethods = map[string]string{"application/octet-stream": "Store", "application/x-gzip": "Deflate",
+	"application/x-bzip2": "BZip2", "application/x-lzma": "LZMA", "application/x-xz": "LZMA2"}
+
+func init() {
+	registerFormat(formatHandler{
+		archiveType: ARCHIVE_XAR,
+		detect:      func(header []byte) bool { return bytes.HasPrefix(header, []byte(xarMagic)) },
+		load:        loadXar,
+		open:        openXarEntry,
+	})
+}
+
+// The table of contents, as much of it as is listed.
+type xarTOC struct {
+	Files []xarFile `xml:"toc>file"`
+}
+
+type xarFile struct {
+	ID    string  `xml:"id,attr"`
+	Name  xarName `xml:"name"`
+	Type  string  `xml:"type"`
+	Mode  string  `xml:"mode"`
+	Mtime string  `xml:"mtime"`
+	Atime string  `xml:"atime"`
+	Ctime string  `xml:"ctime"`
+	Link  string  `xml:"link"`
+	Major int64   `xml:"device>major"`
+	Minor int64   `xml:"device>minor"`
+	Data  *struct {
+		Length   int64 `xml:"length"` // Archived
+		Offset   int64 `xml:"offset"` // In the heap
+		Size     int64 `xml:"size"`   // Extracted
+		Encoding struct {
+			Style string `xml:"style,attr"`
+		} `xml:"encoding"`
+	} `xml:"data"`
+	Files []xarFile `xml:"file"` // A directory's
+}
+
+// A name, which may be base64 where it isn't valid XML text.
+type xarName struct {
+	Enctype string `xml:"enctype,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (n xarName) String() string {
+	if n.Enctype == "base64" {
+		if name, err := base64.StdEncoding.DecodeString(strings.TrimSpace(n.Text)); err == nil {
+			return string(name)
+		}
+	}
+	return n.Text
+}
+
+// Read the table of contents, returning it and where the heap starts.
+func readXarTOC(src source) (*xarTOC, int64, error) {
+	head := make([]byte, xarHeaderLen)
+	if _, err := src.ReadAt(head, 0); err != nil {
+		return nil, 0, fmt.Errorf("xar header: %w", noEOF(err))
+	}
+	if string(head[:4]) != xarMagic {
+		return nil, 0, fmt.Errorf("%w: bad xar magic", ErrCorruptArchive)
+	}
+	headerLen := int64(binary.BigEndian.Uint16(head[4:]))
+	packed, size := binary.BigEndian.Uint64(head[8:]), binary.BigEndian.Uint64(head[16:])
+	if headerLen < xarHeaderLen || packed > uint64(src.size) || size > xarMaxTOC {
+		return nil, 0, fmt.Errorf("%w: bad xar header", ErrCorruptArchive)
+	}
+	zr, err := zlib.NewReader(io.NewSectionReader(src, headerLen, int64(packed)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: xar table of contents: %w", ErrCorruptArchive, err)
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(io.LimitReader(zr, int64(size)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: xar table of contents: %w", ErrCorruptArchive, err)
+	}
+	var toc xarTOC
+	if err := xml.Unmarshal(data, &toc); err != nil {
+		return nil, 0, fmt.Errorf("%w: xar table of contents: %w", ErrCorruptArchive, err)
+	}
+	return &toc, headerLen + int64(packed), nil
+}
+
+func loadXar(ar *ArchiveInfo) error {
+	src, err := ar.openSource()
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	defer src.Close()
+	toc, heap, err := readXarTOC(src)
+	if err != nil {
+		return openError(ar.fullname, err)
+	}
+	w := &xarWalker{ar: ar, heap: heap, names: make(map[string]string)}
+	return w.walk(toc.Files, "", 0)
+}
+
+type xarWalker struct {
+	ar    *ArchiveInfo
+	heap  int64
+	count int
+	names map[string]string // By file id, for hardlinks
+}
+
+// List files under prefix, each directory followed by its contents, as
+// the table of contents has them.
+func (w *xarWalker) walk(files []xarFile, prefix string, depth int) error {
+	if depth > isoMaxDepth {
+		return nil
+	}
+	for _, f := range files {
+		name := path.Join(prefix, f.Name.String())
+		w.names[f.ID] = name
+		af := ArchivedFile{archivefile: w.ar.fullname, archivetype: ARCHIVE_XAR, name: name, packed: -1,
+			modTime: xarTime(f.Mtime), accessTime: xarTime(f.Atime), changeTime: xarTime(f.Ctime), index: w.count}
+		mode, _ := strconv.ParseUint(f.Mode, 8, 32)
+		af.mode = fs.FileMode(mode) & 0o777
+		switch f.Type {
+		case "directory":
+			af.IsDir, af.mode = true, af.mode|fs.ModeDir
+		case "symlink":
+			af.mode, af.linkname = af.mode|fs.ModeSymlink, f.Link
+		case "hardlink":
+			// The first name has the data and links "original"; the
+			// others link the first's id.
+			if target, ok := w.names[f.Link]; ok && f.Link != "original" {
+				af.hardlink, af.linkname = true, target
+			}
+		case "fifo":
+			af.mode |= fs.ModeNamedPipe
+		case "socket":
+			af.mode |= fs.ModeSocket
+		case "character special":
+			af.mode |= fs.ModeDevice | fs.ModeCharDevice
+			af.devMajor, af.devMinor = f.Major, f.Minor
+		case "block special":
+			af.mode |= fs.ModeDevice
+			af.devMajor, af.devMinor = f.Major, f.Minor
+		}
+		if d := f.Data; af.mode.IsRegular() && !af.hardlink && d != nil {
+			if d.Offset < 0 || d.Length < 0 || d.Size < 0 || w.heap+d.Offset+d.Length > w.ar.size {
+				return openError(w.ar.fullname, fmt.Errorf("%s: %w: data outside the heap", name, ErrCorruptArchive))
+			}
+			af.size, af.packed = d.Size, d.Length
+			af.extents = []imageExtent{{w.heap + d.Offset, d.Length}}
+			af.method = xarMethods[d.Encoding.Style]
+			if af.method == "" {
+				af.method = d.Encoding.Style
+			}
+		}
+		w.count++
+		if err := w.ar.addFile(af); err != nil {
+			return err
+		}
+		if err := w.walk(f.Files, name, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A time as the table of contents gives it; zero if there's none.
+func xarTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Decompress the entry's extent as its method says.
+func openXarEntry(af *ArchivedFile) (io.ReadCloser, error) {
+	if len(af.extents) == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	src, err := af.openSource()
+	if err != nil {
+		return nil, openError(af.archivefile, err)
+	}
+	data := io.NewSectionReader(src, af.extents[0].offset, af.extents[0].length)
+	var r io.Reader
+	closers := []io.Closer{src}
+	switch af.method {
+	case "Store":
+		r = data
+	case "Deflate":
+		var zr io.ReadCloser
+		if zr, err = zlib.NewReader(data); err == nil {
+			r, closers = zr, append([]io.Closer{zr}, closers...)
+		}
+	case "BZip2":
+		r = bzip2.NewReader(data)
+	case "LZMA", "LZMA2":
+		// Either container, as xar decodes with liblzma's auto decoder.
+		buffered := bufio.NewReader(data)
+		if magic, _ := buffered.Peek(6); DetectType(magic) == ARCHIVE_TXZ {
+			r, err = xz.NewReader(buffered)
+		} else {
+			r, err = lzma.NewReader(buffered)
+		}
+	default:
+		err = fmt.Errorf("%w: xar encoding %s", ErrUnsupportedFormat, af.method)
+	}
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("%s: %w", af.name, err)
+	}
+	return &entryReader{r, closers}, nil
+}
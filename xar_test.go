@@ -0,0 +1,102 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A xar archive, as a flat package lays one out: Distribution stored,
+// the component's Payload and Bom zlib-compressed in a directory, a
+// symlink, a hardlink pair and a base64 name.
+func buildTestXar() ([]byte, map[string]string) {
+	want := map[string]string{"Distribution": "<installer-gui-script/>\n",
+		"tool.pkg/Payload": strings.Repeat("payload ", 500), "tool.pkg/Bom": "BOMStore",
+		"tool.pkg/PackageInfo": "<pkg-info/>", "tool.pkg/info": "", "odd\x01name": "odd"}
+	var heap []byte
+	data := func(content, style string) string {
+		stored := []byte(content)
+		if style == "application/x-gzip" {
+			stored = zlibBytes(stored)
+		}
+		offset := len(heap)
+		heap = append(heap, stored...)
+		return fmt.Sprintf("<data><length>%d</length><offset>%d</offset><size>%d</size><encoding style=%q/></data>",
+			len(stored), offset, len(content), style)
+	}
+	const times = "<mtime>2023-11-14T22:13:20Z</mtime>"
+	toc := `<?xml version="1.0" encoding="UTF-8"?><xar><toc><creation-time>2023-11-14T22:13:20</creation-time>` +
+		`<file id="1"><name>Distribution</name><type>file</type><mode>0644</mode>` + times +
+		data(want["Distribution"], "application/octet-stream") + `</file>` +
+		`<file id="2"><name>tool.pkg</name><type>directory</type><mode>0755</mode>` + times +
+		`<file id="3"><name>Payload</name><type>file</type><mode>0644</mode>` + times +
+		data(want["tool.pkg/Payload"], "application/x-gzip") + `</file>` +
+		`<file id="4"><name>Bom</name><type>file</type><mode>0644</mode>` + times +
+		data(want["tool.pkg/Bom"], "application/x-gzip") + `</file>` +
+		`<file id="5"><name>PackageInfo</name><type>hardlink</type><link>original</link><mode>0644</mode>` + times +
+		data(want["tool.pkg/PackageInfo"], "application/octet-stream") + `</file>` +
+		`<file id="6"><name>info</name><type>hardlink</type><link>5</link><mode>0644</mode>` + times + `</file>` +
+		`<file id="7"><name>Scripts</name><type>symlink</type><link type="file">../Scripts</link><mode>0755</mode></file>` +
+		`</file>` +
+		`<file id="8"><name enctype="base64">b2RkAW5hbWU=</name><type>file</type><mode>0600</mode>` +
+		data(want["odd\x01name"], "application/octet-stream") + `</file>` +
+		`</toc></xar>`
+	packed := zlibBytes([]byte(toc))
+	head := []byte(xarMagic)
+	head = binary.BigEndian.AppendUint16(head, xarHeaderLen)
+	head = binary.BigEndian.AppendUint16(head, 1)
+	head = binary.BigEndian.AppendUint64(head, uint64(len(packed)))
+	head = binary.BigEndian.AppendUint64(head, uint64(len(toc)))
+	head = binary.BigEndian.AppendUint32(head, 0)
+	return append(append(head, packed...), heap...), want
+}
+
+func TestXar(t *testing.T) {
+	img, want := buildTestXar()
+	name := filepath.Join(t.TempDir(), "tool.pkg")
+	if err := os.WriteFile(name, img, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := GetArchiveInfo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, af := range ai.Files() {
+		names = append(names, af.Name())
+	}
+	if got := strings.Join(names, ","); ai.ArchiveType != ARCHIVE_XAR || !ai.ExtensionMatchesType() ||
+		got != "Distribution,tool.pkg,tool.pkg/Payload,tool.pkg/Bom,tool.pkg/PackageInfo,tool.pkg/info,tool.pkg/Scripts,odd\x01name" {
+		t.Fatalf("type %v, entries %q", ai.ArchiveType, got)
+	}
+	for name, content := range want {
+		if got, err := ai.File(name).GetBytes(); err != nil || string(got) != content {
+			t.Errorf("%s: %q, %v", name, got, err)
+		}
+	}
+	if af := ai.File("tool.pkg/Payload"); af.Method() != "Deflate" || af.packed >= af.Size() ||
+		!af.ModTime().Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Payload: method %q, packed %d, time %v", af.Method(), af.packed, af.ModTime())
+	}
+	if af := ai.File("tool.pkg/info"); !af.hardlink || af.linkname != "tool.pkg/PackageInfo" {
+		t.Errorf("info: hardlink %v to %q", af.hardlink, af.linkname)
+	}
+	if af := ai.File("tool.pkg/Scripts"); af.Mode() != fs.ModeSymlink|0o755 || af.linkname != "../Scripts" {
+		t.Errorf("Scripts: mode %v, target %q", af.Mode(), af.linkname)
+	}
+	if af := ai.File("tool.pkg"); !af.IsDir || af.Mode() != fs.ModeDir|0o755 {
+		t.Errorf("tool.pkg: mode %v", af.Mode())
+	}
+
+	bad := bytes.Clone(img)
+	binary.BigEndian.PutUint64(bad[8:], uint64(len(img)+1))
+	if _, err := GetArchiveInfoFromReader(bytes.NewReader(bad), int64(len(bad))); err == nil {
+		t.Error("TOC past the end: no error")
+	}
+}
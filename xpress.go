@@ -0,0 +1,122 @@
+package archiver
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// XPRESS with Huffman coding, as WIM chunks use it: a table of 512 4-bit
+// code lengths, then symbols read from 16-bit little-endian words, each a
+// literal or a match's length and offset size.  Long lengths follow as
+// bytes, interleaved with the words at wherever the reader has got to.
+
+const (
+	xpressSymbols  = 512
+	xpressTableLen = xpressSymbols / 2
+	xpressMinMatch = 3
+)
+
+func xpressCorrupt(what string) error {
+	return fmt.Errorf("%w: XPRESS %s", ErrCorruptArchive, what)
+}
+
+// Decompress one chunk, of size bytes.
+func xpressDecode(in []byte, size int) ([]byte, error) {
+	if len(in) < xpressTableLen {
+		return nil, xpressCorrupt("chunk without its code")
+	}
+	lens := make([]byte, xpressSymbols)
+	for i, b := range in[:xpressTableLen] {
+		lens[2*i], lens[2*i+1] = b&0xF, b>>4
+	}
+	var code huffTable
+	if err := code.build(lens); err != nil {
+		return nil, err
+	}
+	if code.bits == 0 {
+		return nil, xpressCorrupt("empty Huffman tree")
+	}
+	b := xpressBits{in: in, pos: xpressTableLen}
+	b.bits = uint32(b.word())<<16 | uint32(b.word())
+	b.extra = 16
+	out := make([]byte, 0, size)
+	for len(out) < size {
+		e := code.table[b.bits>>(32-code.bits)]
+		n := uint(e & 31)
+		if n == 0 {
+			return nil, xpressCorrupt("bad Huffman code")
+		}
+		b.consume(n)
+		sym := int(e >> 5)
+		if sym < 256 {
+			out = append(out, byte(sym))
+			continue
+		}
+		sym -= 256
+		length, offsetBits := sym&15, uint(sym>>4)
+		if length == 15 {
+			length += int(b.byte())
+			if length == 15+255 {
+				if length = int(b.word()); length < 15 {
+					return nil, xpressCorrupt("match length")
+				}
+			}
+		}
+		length += xpressMinMatch
+		offset := 1 << offsetBits
+		if offsetBits > 0 {
+			offset += int(b.bits >> (32 - offsetBits))
+			b.consume(offsetBits)
+		}
+		if offset > len(out) {
+			return nil, xpressCorrupt("match before the start of the chunk")
+		}
+		if len(out)+length > size {
+			return nil, xpressCorrupt("match past the end of the chunk")
+		}
+		for from := len(out) - offset; length > 0; length-- {
+			out = append(out, out[from])
+			from++
+		}
+	}
+	if b.pos > len(in)+4 {
+		return nil, xpressCorrupt("chunk runs past its input")
+	}
+	return out, nil
+}
+
+// XPRESS's bit stream: 32 bits held from the top, with 16 + extra of them
+// still to read, and a word more loaded once there are under 16.  Past
+// the end of the input it reads zeros, leaving the caller to notice.
+type xpressBits struct {
+	in    []byte
+	pos   int
+	bits  uint32
+	extra int
+}
+
+func (b *xpressBits) consume(n uint) {
+	b.bits <<= n
+	if b.extra -= int(n); b.extra < 0 {
+		b.bits |= uint32(b.word()) << -b.extra
+		b.extra += 16
+	}
+}
+
+func (b *xpressBits) byte() byte {
+	var v byte
+	if b.pos < len(b.in) {
+		v = b.in[b.pos]
+	}
+	b.pos++
+	return v
+}
+
+func (b *xpressBits) word() uint16 {
+	var v uint16
+	if b.pos+2 <= len(b.in) {
+		v = binary.LittleEndian.Uint16(b.in[b.pos:])
+	}
+	b.pos += 2
+	return v
+}
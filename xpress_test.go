@@ -0,0 +1,74 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+// Writes XPRESS's bit stream: bits into 16-bit words, each given its place
+// in the output when the decoder would load it, and bytes wherever the
+// decoder has got to.
+type xpressWriter struct {
+	out   []byte
+	words []int // Where each word is
+	n     int   // Bits written
+}
+
+func (w *xpressWriter) bits(v uint32, n uint) {
+	for i := n; i > 0; i-- {
+		at := w.words[w.n/16]
+		word := uint16(w.out[at]) | uint16(w.out[at+1])<<8
+		word |= uint16(v>>(i-1)&1) << (15 - w.n%16)
+		w.out[at], w.out[at+1] = byte(word), byte(word>>8)
+		w.n++
+	}
+	if 16*len(w.words)-w.n < 16 {
+		w.reserve()
+	}
+}
+
+func (w *xpressWriter) reserve() {
+	w.words = append(w.words, len(w.out))
+	w.out = append(w.out, 0, 0)
+}
+
+// A chunk with a fixed code: every symbol 9 bits, so each code is the
+// symbol itself.
+func xpressEncode(data []byte) []byte {
+	w := &xpressWriter{out: bytes.Repeat([]byte{0x99}, xpressTableLen)}
+	w.reserve()
+	w.reserve()
+	for _, t := range lzTokens(data, 1<<15, 400) {
+		if t.length == 0 {
+			w.bits(uint32(t.lit), 9)
+			continue
+		}
+		offset := t.dist + 1
+		offsetBits := uint(bits.Len(uint(offset)) - 1)
+		length := t.length - xpressMinMatch
+		w.bits(uint32(256+offsetBits<<4+uint(min(length, 15))), 9)
+		if length >= 15 {
+			if length-15 < 255 {
+				w.out = append(w.out, byte(length-15))
+			} else {
+				w.out = append(w.out, 255, byte(length), byte(length>>8))
+			}
+		}
+		w.bits(uint32(offset-1<<offsetBits), offsetBits)
+	}
+	return w.out
+}
+
+func TestXpress(t *testing.T) {
+	data := []byte(strings.Repeat("xpress huffman, ", 30) + strings.Repeat("-", 600) + "end")
+	got, err := xpressDecode(xpressEncode(data), len(data))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("%d bytes, %v", len(got), err)
+	}
+	if _, err := xpressDecode(xpressEncode(data)[:xpressTableLen+20], len(data)); !errors.Is(err, ErrCorruptArchive) {
+		t.Errorf("truncated: %v", err)
+	}
+}
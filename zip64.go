@@ -0,0 +1,57 @@
+package archiver
+
+import (
+	"fmt"
+)
+
+// Zip64 entries, those of 4 GiB or more or starting 4 GiB or more into
+// the archive, keep their sizes and offset in an extra field rather than
+// the headers' 32-bit fields, and archives of 65535 or more entries keep
+// the count in a zip64 end record.  archive/zip reads both, so all that
+// needs doing here is to keep to 64-bit sizes and offsets throughout.
+
+// Reports whether a zip central directory extra field carries zip64
+// sizes or an offset.
+func hasZip64Extra(extra []byte) (found bool) {
+	walkZipExtra(extra, func(id uint16, body []byte) {
+		if id == zipExtraZip64 && len(body) >= 8 {
+			found = true
+		}
+	})
+	return
+}
+
+// Reports whether the zip entry's sizes or offset are held in a zip64
+// record, as they must be from 4 GiB up.  false for other formats.
+func (af *ArchivedFile) IsZip64() bool { return af.zip64 }
+
+// Where the entry's data starts in the archive, for a zip entry: past its
+// local header, which this reads.  For a split zip the offset is into the
+// volumes taken as one.  A disc image or ar entry's is where its first
+// extent starts, from the listing.  Other formats fail with
+// ErrUnsupportedFormat, as do image entries with no data.
+func (af *ArchivedFile) DataOffset() (int64, error) {
+	if len(af.extents) > 0 && af.extents[0].offset >= 0 {
+		return af.extents[0].offset, nil
+	}
+	if af.archivetype != ARCHIVE_ZIP {
+		return -1, fmt.Errorf("%s: %w", af.name, ErrUnsupportedFormat)
+	}
+	src, err := af.openSource()
+	if err != nil {
+		return -1, openError(af.archivefile, err)
+	}
+	defer src.Close()
+	zipReader, err := newZipReader(src)
+	if err != nil {
+		return -1, openError(af.archivefile, err)
+	}
+	if af.index >= len(zipReader.File) {
+		return -1, fmt.Errorf("%s: entry %d: %w", af.archivefile, af.index, ErrCorruptArchive)
+	}
+	offset, err := zipReader.File[af.index].DataOffset()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %w", af.name, err)
+	}
+	return offset, nil
+}
@@ -0,0 +1,136 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes runs of zeros as holes, so a multi-gigabyte stored entry costs
+// next to nothing on disk.
+type holeWriter struct{ f *os.File }
+
+var zeros = make([]byte, 1<<20)
+
+func (w holeWriter) Write(p []byte) (int, error) {
+	if len(p) >= 4096 && len(p) <= len(zeros) && bytes.Equal(p, zeros[:len(p)]) {
+		_, err := w.f.Seek(int64(len(p)), io.SeekCurrent)
+		return len(p), err
+	}
+	return w.f.Write(p)
+}
+
+func TestZip64Large(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes a 5 GiB sparse file")
+	}
+	const bigSize = 5 << 30
+	name := filepath.Join(t.TempDir(), "big.zip")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(holeWriter{f})
+	w, err := zw.CreateRaw(&zip.FileHeader{Name: "big.bin", Method: zip.Store, CRC32: 0x12345678,
+		CompressedSize64: bigSize, UncompressedSize64: bigSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for left := int64(bigSize); left > 0; left -= int64(len(zeros)) {
+		if _, err := w.Write(zeros[:min(left, int64(len(zeros)))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err = zw.Create("after.txt")
+	if err == nil {
+		_, err = io.WriteString(w, "past the 4 GiB line")
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err = errors.Join(err, f.Close()); err != nil {
+		t.Fatal(err)
+	}
+
+	ai, err := GetArchiveInfo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big, after := ai.File("big.bin"), ai.File("after.txt")
+	if big == nil || after == nil {
+		t.Fatalf("listing %v", ai.files)
+	}
+	if big.Size() != bigSize || big.CompressedSize() != bigSize || !big.IsZip64() {
+		t.Errorf("big.bin: size %d, packed %d, zip64 %v", big.Size(), big.CompressedSize(), big.IsZip64())
+	}
+	if crc, ok := big.CRC32(); !ok || crc != 0x12345678 {
+		t.Errorf("big.bin: CRC %08x %v", crc, ok)
+	}
+	if !after.IsZip64() {
+		t.Error("after.txt: offset past 4 GiB not flagged zip64")
+	}
+	if offset, err := after.DataOffset(); err != nil || offset <= bigSize {
+		t.Errorf("after.txt: data offset %d, %v", offset, err)
+	}
+	if data, err := after.GetBytes(); err != nil || string(data) != "past the 4 GiB line" {
+		t.Errorf("after.txt: %q, %v", data, err)
+	}
+	if data, err := big.ReadRange(bigSize-4, 10); err != nil || !bytes.Equal(data, make([]byte, 4)) {
+		t.Errorf("big.bin tail: %v, %v", data, err)
+	}
+}
+
+func TestZip64ManyEntries(t *testing.T) {
+	const count = 70000
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < count; i++ {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("f%05d", i), Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(w, i)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "many.zip")
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := GetArchiveInfo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ai.files) != count {
+		t.Fatalf("%d entries, want %d", len(ai.files), count)
+	}
+	last := ai.File(fmt.Sprintf("f%05d", count-1))
+	if last == nil || last.IsZip64() {
+		t.Fatalf("last entry %v", last)
+	}
+	if data, err := last.GetBytes(); err != nil || string(data) != fmt.Sprint(count-1) {
+		t.Errorf("last entry: %q, %v", data, err)
+	}
+	if offset, err := last.DataOffset(); err != nil || offset <= 0 || offset >= int64(buf.Len()) {
+		t.Errorf("last entry: data offset %d, %v", offset, err)
+	}
+	if _, err := ai.File("f00000").DataOffset(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDataOffsetOtherFormats(t *testing.T) {
+	ai, err := GetArchiveInfo("testassets/test.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ai.files[0].DataOffset(); err == nil {
+		t.Error("tar entry gave a data offset")
+	}
+}
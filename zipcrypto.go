@@ -0,0 +1,274 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Zip encryption: traditional PKWARE "ZipCrypto" and WinZip AES (method 99,
+// AE-1 and AE-2).  archive/zip reads neither, so encrypted entries are
+// opened raw, decrypted here and then decompressed.
+
+const (
+	zipMethodAES = 99
+	zipAESExtra  = 0x9901
+)
+
+// Open an encrypted entry's data with password.
+func openEncryptedZip(f *zip.File, password string) (io.ReadCloser, error) {
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	if f.Method == zipMethodAES {
+		return openZipAES(f, raw, password)
+	}
+	plain, err := openZipCrypto(f, raw, password)
+	if err != nil {
+		return nil, err
+	}
+	return decompressZip(f, f.Method, plain, true)
+}
+
+// Decompress an entry's decrypted data, checking the CRC at the end when
+// checkCRC is set.  AE-2 entries record no CRC; their MAC stands in.
+func decompressZip(f *zip.File, method uint16, r io.Reader, checkCRC bool) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	switch method {
+	case zip.Store:
+		rc = io.NopCloser(r)
+	case zip.Deflate:
+		rc = flate.NewReader(r)
+	case zipMethodBZip2:
+		rc = io.NopCloser(bzip2.NewReader(r))
+	case zipMethodZstd:
+		rc = newZstdReader(r)
+	default:
+		return nil, fmt.Errorf("%s: %w: zip method %d", f.Name, ErrUnsupportedFormat, method)
+	}
+	if !checkCRC {
+		return rc, nil
+	}
+	return &crcReader{ReadCloser: rc, crc: crc32.NewIEEE(), want: f.CRC32}, nil
+}
+
+// Fails with zip.ErrChecksum at EOF if the data doesn't match want.
+type crcReader struct {
+	io.ReadCloser
+	crc  hash.Hash32
+	want uint32
+}
+
+func (cr *crcReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	cr.crc.Write(p[:n])
+	if err == io.EOF && cr.crc.Sum32() != cr.want {
+		err = zip.ErrChecksum
+	}
+	return n, err
+}
+
+// The PKWARE traditional cipher's three keys.
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	keys := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		keys.update(password[i])
+	}
+	return keys
+}
+
+func crc32Byte(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Byte(k[0], b)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32Byte(k[2], byte(k[1]>>24))
+}
+
+func (k *zipCryptoKeys) decrypt(buf []byte) {
+	for i, c := range buf {
+		temp := uint16(k[2]) | 2
+		buf[i] = c ^ byte(temp*(temp^1)>>8)
+		k.update(buf[i])
+	}
+}
+
+type zipCryptoReader struct {
+	r    io.Reader
+	keys *zipCryptoKeys
+}
+
+func (zr *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := zr.r.Read(p)
+	zr.keys.decrypt(p[:n])
+	return n, err
+}
+
+// Check password against the 12-byte encryption header and return the
+// decrypted data that follows.  The header only holds one check byte, so
+// about one wrong password in 256 gets through and fails the CRC instead.
+func openZipCrypto(f *zip.File, raw io.Reader, password string) (io.Reader, error) {
+	keys := newZipCryptoKeys(password)
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", f.Name, ErrCorruptArchive, err)
+	}
+	keys.decrypt(header)
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&0x8 != 0 { // Sizes and CRC follow the data, so the time stands in
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if header[11] != check {
+		return nil, fmt.Errorf("%s: %w", f.Name, ErrWrongPassword)
+	}
+	return &zipCryptoReader{io.LimitReader(raw, int64(f.CompressedSize64)-12), keys}, nil
+}
+
+// Reports whether the entry's CRC field holds its CRC.  WinZip AE-2
+// entries leave it zero and rely on the MAC instead.
+func zipHasCRC(f *zip.File) bool {
+	if f.Method != zipMethodAES {
+		return true
+	}
+	version, _, _, ok := parseZipAESExtra(f.Extra)
+	return ok && version == 1
+}
+
+// The WinZip AES extra field: vendor version (1 for AE-1, 2 for AE-2), key
+// strength and the real compression method.
+func parseZipAESExtra(extra []byte) (version uint16, strength byte, method uint16, ok bool) {
+	for len(extra) >= 4 {
+		id, size := binary.LittleEndian.Uint16(extra), int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if id == zipAESExtra && size >= 7 {
+			field := extra[:size]
+			return binary.LittleEndian.Uint16(field), field[4], binary.LittleEndian.Uint16(field[5:]), true
+		}
+		extra = extra[size:]
+	}
+	return 0, 0, 0, false
+}
+
+func openZipAES(f *zip.File, raw io.Reader, password string) (io.ReadCloser, error) {
+	version, strength, method, ok := parseZipAESExtra(f.Extra)
+	if !ok || strength < 1 || strength > 3 {
+		return nil, fmt.Errorf("%s: %w: bad AES extra field", f.Name, ErrCorruptArchive)
+	}
+	keyLen := 8 + 8*int(strength) // 16, 24 or 32 bytes
+	saltLen := keyLen / 2
+	dataLen := int64(f.CompressedSize64) - int64(saltLen) - 2 - 10
+	if dataLen < 0 {
+		return nil, fmt.Errorf("%s: %w: AES entry too short", f.Name, ErrCorruptArchive)
+	}
+	header := make([]byte, saltLen+2)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", f.Name, ErrCorruptArchive, err)
+	}
+	keys := pbkdf2SHA1([]byte(password), header[:saltLen], 1000, 2*keyLen+2)
+	if !bytes.Equal(keys[2*keyLen:], header[saltLen:]) {
+		return nil, fmt.Errorf("%s: %w", f.Name, ErrWrongPassword)
+	}
+	block, err := aes.NewCipher(keys[:keyLen])
+	if err != nil {
+		return nil, err
+	}
+	ar := &zipAESReader{name: f.Name, r: io.LimitReader(raw, dataLen), raw: raw,
+		mac: hmac.New(sha1.New, keys[keyLen:2*keyLen]), ctr: newWinZipCTR(block)}
+	return decompressZip(f, method, ar, version == 1)
+}
+
+// Decrypts AES entry data, checking its HMAC-SHA1 at the end.
+type zipAESReader struct {
+	name string
+	r    io.Reader // The encrypted data
+	raw  io.Reader // The rest of the entry, for the MAC
+	mac  hash.Hash
+	ctr  *winZipCTR
+}
+
+func (zr *zipAESReader) Read(p []byte) (int, error) {
+	n, err := zr.r.Read(p)
+	zr.mac.Write(p[:n])
+	zr.ctr.XORKeyStream(p[:n], p[:n])
+	if err == io.EOF {
+		stored := make([]byte, 10)
+		if _, readErr := io.ReadFull(zr.raw, stored); readErr != nil {
+			return n, fmt.Errorf("%s: %w: %w", zr.name, ErrCorruptArchive, readErr)
+		}
+		if !hmac.Equal(stored, zr.mac.Sum(nil)[:10]) {
+			return n, fmt.Errorf("%s: %w", zr.name, zip.ErrChecksum)
+		}
+	}
+	return n, err
+}
+
+// AES in counter mode as WinZip has it: a little-endian counter starting
+// at 1, which crypto/cipher's big-endian CTR can't produce.
+type winZipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func newWinZipCTR(block cipher.Block) *winZipCTR {
+	return &winZipCTR{block: block, used: aes.BlockSize}
+}
+
+func (c *winZipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.used == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.used = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.used]
+		c.used++
+	}
+}
+
+// PBKDF2 (RFC 8018) with HMAC-SHA1, as WinZip derives its keys.
+func pbkdf2SHA1(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := bytes.Clone(u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
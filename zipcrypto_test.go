@@ -0,0 +1,61 @@
+package archiver
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedZip(t *testing.T) {
+	testdata := []struct {
+		filename string
+		contents map[string]string
+	}{
+		{"testassets/zipcrypto.zip", map[string]string{
+			"secret.txt": "The launch codes are in the other drawer.\n"}},
+		{"testassets/aes.zip", map[string]string{
+			"secret.txt": strings.Repeat("The launch codes are in the other drawer.\n", 20),
+			"note.txt":   "AE-1, stored, 128-bit.\n"}},
+	}
+	for _, test := range testdata {
+		ar, err := GetArchiveInfo(test.filename)
+		if err != nil {
+			t.Fatalf("%s error = %v", test.filename, err)
+		}
+		for _, af := range ar.Files() {
+			if _, secret := test.contents[af.Name()]; af.Encrypted() != secret {
+				t.Errorf("%s %s Encrypted() = %v", test.filename, af.Name(), af.Encrypted())
+			}
+		}
+		if _, err = ar.File("secret.txt").GetBytes(); !errors.Is(err, ErrEncrypted) {
+			t.Errorf("%s GetBytes() without password error = %v, want ErrEncrypted", test.filename, err)
+		}
+		if data, err := ar.File("public.txt").GetBytes(); err != nil || string(data) != "Nothing to see here.\n" {
+			t.Errorf("%s public.txt = %q, %v", test.filename, data, err)
+		}
+
+		ar, _ = GetArchiveInfo(test.filename, WithPassword("letmein"))
+		if _, err = ar.File("secret.txt").GetBytes(); !errors.Is(err, ErrWrongPassword) {
+			t.Errorf("%s GetBytes() with wrong password error = %v, want ErrWrongPassword", test.filename, err)
+		}
+
+		ar, _ = GetArchiveInfo(test.filename, WithPassword("hunter2"))
+		for name, want := range test.contents {
+			if data, err := ar.File(name).GetBytes(); err != nil || string(data) != want {
+				t.Errorf("%s %s = %q, %v", test.filename, name, data, err)
+			}
+		}
+	}
+}
+
+func TestPBKDF2SHA1(t *testing.T) {
+	// RFC 6070 test vectors.
+	if got := hex.EncodeToString(pbkdf2SHA1([]byte("password"), []byte("salt"), 2, 20)); got != "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957" {
+		t.Errorf("2 iterations = %s", got)
+	}
+	got := pbkdf2SHA1([]byte("passwordPASSWORDpassword"), []byte("saltSALTsaltSALTsaltSALTsaltSALTsalt"), 4096, 25)
+	if hex.EncodeToString(got) != "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038" {
+		t.Errorf("4096 iterations, 25 bytes = %x", got)
+	}
+}
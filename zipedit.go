@@ -0,0 +1,336 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Changing a zip on disk.  An added entry is written over the central
+// directory, which is written again after it, so the entries already there
+// aren't touched.  Anything else writes a new zip beside the old one,
+// copying the entries it keeps without decompressing them, and renames it
+// over the old one; whatever came before the zip, such as a
+// self-extractor's stub, is dropped.  Either way the archive is listed
+// again afterwards.  Don't change an archive while its entries are being
+// read.
+
+// Add an entry called name holding what r reads, deflated at the level
+// WithCompressionLevel gives, or stored if WithCompression says to, and
+// modified now.  fs.ErrExist if there's an
+// entry called name already; Replace it instead.
+func (ai *ArchiveInfo) Add(name string, r io.Reader, opts ...CreateOption) error {
+	co, err := buildCreateOptions(opts)
+	if err == nil {
+		err = co.unencrypted(ai.fullname)
+	}
+	if err != nil {
+		return err
+	}
+	if err := ai.checkEditable(ARCHIVE_ZIP); err != nil {
+		return err
+	}
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "add", Path: name, Err: fs.ErrInvalid}
+	}
+	if found, err := ai.hasZipEntry(name); err != nil || found {
+		if found {
+			err = fmt.Errorf("%s: %s: %w", ai.fullname, name, fs.ErrExist)
+		}
+		return err
+	}
+	head := &zip.FileHeader{Name: name, Method: co.zipMethod(name), Modified: time.Now()}
+	head.SetMode(0o644)
+	appended, err := ai.appendZip(head, r, co)
+	if err != nil {
+		return err
+	}
+	if appended {
+		return ai.relist()
+	}
+	return ai.rewriteZip(co, func(zw *zip.Writer, zr *zip.Reader) error {
+		for _, f := range zr.File {
+			if err := copyZipEntry(zw, f); err != nil {
+				return err
+			}
+		}
+		return writeZipEntry(zw, head, r)
+	})
+}
+
+// Replace the content of the entry called name with what r reads.  It
+// keeps its place, mode and comment, and is stored if it was stored and
+// deflated at the level WithCompressionLevel gives otherwise, so an EPUB's
+// or OpenDocument's mimetype stays as it must be.  It's modified now.
+// fs.ErrNotExist if there's no such entry.
+func (ai *ArchiveInfo) Replace(name string, r io.Reader, opts ...CreateOption) error {
+	co, err := buildCreateOptions(opts)
+	if err == nil {
+		err = co.unencrypted(ai.fullname)
+	}
+	if err != nil {
+		return err
+	}
+	if err := ai.checkEditable(ARCHIVE_ZIP); err != nil {
+		return err
+	}
+	return ai.rewriteZip(co, func(zw *zip.Writer, zr *zip.Reader) error {
+		found := false
+		for _, f := range zr.File {
+			if found || zipName(f, ai.opts.nameEncoding) != name {
+				if err := copyZipEntry(zw, f); err != nil {
+					return err
+				}
+				continue
+			}
+			found = true
+			head := &zip.FileHeader{Name: f.Name, Comment: f.Comment, NonUTF8: f.NonUTF8,
+				CreatorVersion: f.CreatorVersion, ExternalAttrs: f.ExternalAttrs, Method: zip.Deflate, Modified: time.Now()}
+			if f.Method == zip.Store {
+				head.Method = zip.Store
+			}
+			if err := writeZipEntry(zw, head, r); err != nil {
+				return err
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %s: %w", ai.fullname, name, fs.ErrNotExist)
+		}
+		return nil
+	})
+}
+
+// Only an archive that's a file of its own, of one of types, can be
+// changed.
+func (ai *ArchiveInfo) checkEditable(types ...ArchiveType) error {
+	if !slices.Contains(types, ai.ArchiveType) || ai.reader != nil || ai.fsys != nil || ai.volumes != nil {
+		return fmt.Errorf("%s: %w: can't change this archive in place", ai.fullname, ErrUnsupportedFormat)
+	}
+	return nil
+}
+
+// Whether the zip on disk has an entry called name, whatever the listing
+// holds.
+func (ai *ArchiveInfo) hasZipEntry(name string) (bool, error) {
+	src, err := ai.openSource()
+	if err != nil {
+		return false, openError(ai.fullname, err)
+	}
+	defer src.Close()
+	zr, err := newZipReader(src)
+	if err != nil {
+		return false, openError(ai.fullname, err)
+	}
+	for _, f := range zr.File {
+		if zipName(f, ai.opts.nameEncoding) == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Copy f across as it is.  zip.Writer won't take a directory's raw data,
+// which some zips deflate from nothing to two bytes, so a directory's
+// header is written afresh.
+func copyZipEntry(zw *zip.Writer, f *zip.File) error {
+	if !strings.HasSuffix(f.Name, "/") {
+		return zw.Copy(f)
+	}
+	head := f.FileHeader
+	head.Method = zip.Store
+	_, err := zw.CreateHeader(&head)
+	return err
+}
+
+func writeZipEntry(zw *zip.Writer, head *zip.FileHeader, r io.Reader) error {
+	w, err := zw.CreateHeader(head)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// Write the entry where the central directory starts, then the directory
+// with the entry's header on the end.  false, having written nothing, if
+// the zip isn't laid out for that: with data before it, or between the
+// directory and the end records.  If writing fails the zip is put back as
+// it was.
+func (ai *ArchiveInfo) appendZip(head *zip.FileHeader, r io.Reader, co createOptions) (appended bool, err error) {
+	f, err := os.OpenFile(ai.fullname, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer func() { err = errors.Join(err, f.Close()) }()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	end, err := readZipEnd(source{f, f, info.Size()})
+	if err != nil {
+		return false, openError(ai.fullname, err)
+	}
+	if end.cdAt+end.cdSize != end.at {
+		return false, nil
+	}
+	tail := make([]byte, info.Size()-end.cdAt)
+	if _, err := f.ReadAt(tail, end.cdAt); err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			_, restoreErr := f.WriteAt(tail, end.cdAt)
+			err = errors.Join(err, restoreErr, f.Truncate(info.Size()))
+		}
+	}()
+
+	// Let a zip.Writer write the entry and a directory of just it, then
+	// put the old directory in front of its header.
+	out := io.NewOffsetWriter(f, end.cdAt)
+	zw := newZipWriter(out, co.level)
+	zw.SetOffset(end.cdAt)
+	if err := writeZipEntry(zw, head, r); err != nil {
+		return false, err
+	}
+	if err := zw.Close(); err != nil {
+		return false, err
+	}
+	written, _ := out.Seek(0, io.SeekCurrent)
+	added, err := readZipEnd(source{f, f, end.cdAt + written})
+	if err != nil {
+		return false, err
+	}
+	header := make([]byte, added.cdSize)
+	if _, err := f.ReadAt(header, added.cdAt); err != nil {
+		return false, err
+	}
+	var dir bytes.Buffer
+	dir.Write(tail[:end.cdSize])
+	dir.Write(header)
+	writeZipEnd(&dir, end.count+1, added.cdAt, end.comment)
+	if _, err := f.WriteAt(dir.Bytes(), added.cdAt); err != nil {
+		return false, err
+	}
+	return true, f.Truncate(added.cdAt + int64(dir.Len()))
+}
+
+// Write a new zip beside the old one with rewrite, which copies or writes
+// each entry from zr to zw, and rename it over the old one.  The new zip
+// keeps the old one's comment.
+func (ai *ArchiveInfo) rewriteZip(co createOptions, rewrite func(zw *zip.Writer, zr *zip.Reader) error) error {
+	return ai.replaceArchive(func(w io.Writer, src source) error {
+		zr, err := newZipReader(src)
+		if err != nil {
+			return openError(ai.fullname, err)
+		}
+		zw := newZipWriter(w, co.level)
+		if err := zw.SetComment(zr.Comment); err != nil {
+			return err
+		}
+		if err := rewrite(zw, zr); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+}
+
+// Write a new copy of the archive, read from src, to a temp file beside it
+// and rename that over it, keeping its permissions.  If write fails the
+// archive is left alone.
+func (ai *ArchiveInfo) replaceArchive(write func(w io.Writer, src source) error) error {
+	info, err := os.Stat(ai.fullname)
+	if err != nil {
+		return err
+	}
+	src, err := ai.openSource()
+	if err != nil {
+		return openError(ai.fullname, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(ai.fullname), "."+filepath.Base(ai.fullname)+".*")
+	if err != nil {
+		src.Close()
+		return err
+	}
+	err = write(tmp, src)
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	err = errors.Join(err, tmp.Close(), src.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), ai.fullname)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return ai.relist()
+}
+
+// List the archive again after changing it on disk, dropping everything
+// worked out from the old listing.
+func (ai *ArchiveInfo) relist() error {
+	ai.handle.close(0)
+	info, err := os.Stat(ai.fullname)
+	if err != nil {
+		return err
+	}
+	ai.size = info.Size()
+	ai.files, ai.warnings, ai.unpacked = nil, nil, 0
+	ai.index, ai.indexOnce = nil, sync.Once{}
+	ai.tree, ai.treeOnce = nil, sync.Once{}
+	ai.kind, ai.kindOnce = containerInfo{}, sync.Once{}
+	return ai.load()
+}
+
+// What a zip's end records say.
+type zipEnd struct {
+	count   uint64
+	cdAt    int64 // As recorded, from the start of the zip
+	cdSize  int64
+	comment []byte
+	at      int64 // Where the end records start: the zip64 one if there is one
+}
+
+// Read the end record from the end of src, and the zip64 one if it defers
+// to that.
+func readZipEnd(src source) (zipEnd, error) {
+	le := binary.LittleEndian
+	window := min(src.size, zipEndLen+zipMaxCommentLen)
+	buf := make([]byte, window)
+	if _, err := src.ReadAt(buf, src.size-window); err != nil {
+		return zipEnd{}, err
+	}
+	i := bytes.LastIndex(buf, le.AppendUint32(nil, zipEndSig))
+	if i < 0 || len(buf)-i < zipEndLen {
+		return zipEnd{}, fmt.Errorf("no end of central directory")
+	}
+	rec := buf[i:]
+	end := zipEnd{count: uint64(le.Uint16(rec[10:])), cdSize: int64(le.Uint32(rec[12:])), cdAt: int64(le.Uint32(rec[16:])),
+		comment: bytes.Clone(rec[zipEndLen:min(len(rec), zipEndLen+int(le.Uint16(rec[20:])))]), at: src.size - window + int64(i)}
+	if end.count != zipMaxUint16 && end.cdSize != zipMaxUint32 && end.cdAt != zipMaxUint32 {
+		return end, nil
+	}
+	if i < zip64LocatorLen || le.Uint32(buf[i-zip64LocatorLen:]) != zip64LocatorSig {
+		return zipEnd{}, fmt.Errorf("no zip64 end locator")
+	}
+	end.at = int64(le.Uint64(buf[i-zip64LocatorLen+8:]))
+	rec = make([]byte, zip64EndLen)
+	if _, err := src.ReadAt(rec, end.at); err != nil {
+		return zipEnd{}, err
+	}
+	if le.Uint32(rec) != zip64EndSig {
+		return zipEnd{}, fmt.Errorf("bad zip64 end record")
+	}
+	end.count, end.cdSize, end.cdAt = le.Uint64(rec[32:]), int64(le.Uint64(rec[40:])), int64(le.Uint64(rec[48:]))
+	return end, nil
+}
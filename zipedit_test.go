@@ -0,0 +1,146 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// Copy a test asset, or write data, to a temp file and list it.
+func editableZip(t *testing.T, data []byte) *ArchiveInfo {
+	path := filepath.Join(t.TempDir(), "edit.zip")
+	if err := os.WriteFile(path, data, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := GetArchiveInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ai
+}
+
+// Check archive/zip reads every entry of the zip, CRCs and all, and return
+// their content.
+func readBackZip(t *testing.T, path string) map[string]string {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	got := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		got[f.Name] = string(data)
+	}
+	return got
+}
+
+func TestZipAddReplace(t *testing.T) {
+	original, err := os.ReadFile("testassets/test.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ai := editableZip(t, original)
+	count := len(ai.Files())
+	if err := ai.Add("conf/app.properties", strings.NewReader("debug=false\n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(ai.Files()) != count+1 {
+		t.Fatalf("%d entries after Add, want %d", len(ai.Files()), count+1)
+	}
+	// Appended: the entries already there weren't rewritten.
+	end, err := readZipEnd(source{bytes.NewReader(original), nil, int64(len(original))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appended, _ := os.ReadFile(ai.fullname); !bytes.HasPrefix(appended, original[:end.cdAt]) {
+		t.Error("Add rewrote the existing entries")
+	}
+	if got, err := ai.File("conf/app.properties").GetBytes(); err != nil || string(got) != "debug=false\n" {
+		t.Errorf("added entry: %q, %v", got, err)
+	}
+	if err := ai.Replace("conf/app.properties", strings.NewReader("debug=true\n"), WithCompressionLevel(9)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ai.Replace("dirhelp.txt", strings.NewReader("help")); err != nil {
+		t.Fatal(err)
+	}
+	contents := readBackZip(t, ai.fullname)
+	if len(contents) != count+1 || contents["conf/app.properties"] != "debug=true\n" || contents["dirhelp.txt"] != "help" {
+		t.Errorf("after Replace: %d entries, %q, %q", len(contents), contents["conf/app.properties"], contents["dirhelp.txt"])
+	}
+	if got, err := ai.File("dirhelp.txt").GetBytes(); err != nil || string(got) != "help" {
+		t.Errorf("replaced entry: %q, %v", got, err)
+	}
+	if ai.Files()[0].Name() != "dirhelp.txt" {
+		t.Errorf("replaced entry moved: first is %s", ai.Files()[0].Name())
+	}
+	if info, err := os.Stat(ai.fullname); err != nil || info.Mode().Perm() != 0o640 || info.Size() != ai.Size() {
+		t.Errorf("stat after Replace: %v, %v; listed size %d", info, err, ai.Size())
+	}
+
+	if err := ai.Add("dirhelp.txt", strings.NewReader("again")); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Add of an existing name: %v", err)
+	}
+	if err := ai.Replace("missing.txt", strings.NewReader("")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Replace of a missing name: %v", err)
+	}
+	// A failed Add leaves the zip as it was.
+	before, _ := os.ReadFile(ai.fullname)
+	if err := ai.Add("broken", io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(io.ErrUnexpectedEOF))); err == nil {
+		t.Error("Add from a failing reader succeeded")
+	}
+	if after, _ := os.ReadFile(ai.fullname); !bytes.Equal(before, after) {
+		t.Error("failed Add changed the zip")
+	}
+	if err := ai.Add("../escape", strings.NewReader("")); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Add of a bad name: %v", err)
+	}
+
+	// Comments survive, and stored entries stay stored.
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	w.Write([]byte("application/epub+zip"))
+	zw.SetComment("kept")
+	zw.Close()
+	ai = editableZip(t, buf.Bytes())
+	if err := ai.Add("OEBPS/extra.xhtml", strings.NewReader("<html/>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ai.Replace("mimetype", strings.NewReader("application/epub+zip")); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(ai.fullname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if zr.Comment != "kept" || len(zr.File) != 2 || zr.File[0].Method != zip.Store {
+		t.Errorf("comment %q, %d entries, mimetype method %d", zr.Comment, len(zr.File), zr.File[0].Method)
+	}
+
+	data := testZipBytes(t, map[string]string{"a": "b"})
+	mem, err := GetArchiveInfoFromReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Add("c", strings.NewReader("d")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Add to a zip in memory: %v", err)
+	}
+}
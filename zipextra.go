@@ -0,0 +1,146 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// Zip extra field header IDs we know how to read.
+const (
+	zipExtraZip64   = 0x0001 // Zip64: sizes, header offset and disk too big for their fields
+	zipExtraNTFS    = 0x000a // NTFS: mtime, atime, ctime as Windows FILETIMEs
+	zipExtraExtTime = 0x5455 // Info-ZIP "UT": mtime, atime, ctime as Unix seconds
+	zipExtraUniPath = 0x7075 // Info-ZIP "up": UTF-8 name, with the CRC-32 of the stored one
+)
+
+// Walk the id/size records of a zip extra field, calling fn with each body.
+// Truncated records end the walk.
+func walkZipExtra(extra []byte, fn func(id uint16, body []byte)) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		extra = extra[4:]
+		if size > len(extra) {
+			return
+		}
+		fn(id, extra[:size])
+		extra = extra[size:]
+	}
+}
+
+// Windows FILETIME (100ns ticks since 1601-01-01 UTC) to time.Time.  Zero stays zero.
+func fileTimeToTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+	const ticksTo1970 = 116444736000000000
+	ticks := int64(ft) - ticksTo1970
+	return time.Unix(ticks/1e7, (ticks%1e7)*100).UTC()
+}
+
+// Pull the NTFS timestamps out of a zip extra field.  Returns ok=false if
+// there isn't an NTFS record with the timestamp attribute (tag 1).
+func parseNTFSExtra(extra []byte) (mtime, atime, ctime time.Time, ok bool) {
+	walkZipExtra(extra, func(id uint16, body []byte) {
+		if id != zipExtraNTFS || len(body) < 4 {
+			return
+		}
+		body = body[4:] // Reserved
+		for len(body) >= 4 {
+			tag := binary.LittleEndian.Uint16(body[0:2])
+			size := int(binary.LittleEndian.Uint16(body[2:4]))
+			body = body[4:]
+			if size > len(body) {
+				return
+			}
+			if tag == 1 && size >= 24 {
+				mtime = fileTimeToTime(binary.LittleEndian.Uint64(body[0:8]))
+				atime = fileTimeToTime(binary.LittleEndian.Uint64(body[8:16]))
+				ctime = fileTimeToTime(binary.LittleEndian.Uint64(body[16:24]))
+				ok = true
+			}
+			body = body[size:]
+		}
+	})
+	return
+}
+
+// Pull the Info-ZIP extended timestamps out of a zip extra field.  A flag
+// byte says which of mtime, atime and ctime were recorded, but the central
+// directory copy carries only mtime, so times past the end of the record
+// are left zero.  ok=false if there's no such record.
+func parseExtTimeExtra(extra []byte) (mtime, atime, ctime time.Time, ok bool) {
+	walkZipExtra(extra, func(id uint16, body []byte) {
+		if id != zipExtraExtTime || len(body) < 1 {
+			return
+		}
+		flags, body := body[0], body[1:]
+		ok = true
+		for bit, t := range []*time.Time{&mtime, &atime, &ctime} {
+			if flags&(1<<bit) == 0 {
+				continue
+			}
+			if len(body) < 4 {
+				return
+			}
+			*t = time.Unix(int64(int32(binary.LittleEndian.Uint32(body))), 0).UTC()
+			body = body[4:]
+		}
+	})
+	return
+}
+
+// Reports whether an extended timestamp record flags any of the mask bits
+// (1 mtime, 2 atime, 4 ctime) as recorded.
+func hasExtTimeFlags(extra []byte, mask byte) (found bool) {
+	walkZipExtra(extra, func(id uint16, body []byte) {
+		if id == zipExtraExtTime && len(body) >= 1 && body[0]&mask != 0 {
+			found = true
+		}
+	})
+	return
+}
+
+// The extra field from an entry's local header, which archive/zip doesn't
+// expose and which is the only place Info-ZIP puts atime.  The local header
+// ends where the data begins, so step back over the name and each possible
+// extra length until the header fields agree.  Extras are nearly always
+// short, so a small window is tried before the 64K worst case.  nil if it
+// can't be found.
+func readZipLocalExtra(r io.ReaderAt, f *zip.File) []byte {
+	dataOffset, err := f.DataOffset()
+	if err != nil {
+		return nil
+	}
+	for _, maxExtra := range []int{1024, 0xffff} {
+		if extra, found := findZipLocalExtra(r, dataOffset, f.Name, maxExtra); found {
+			return extra
+		}
+	}
+	return nil
+}
+
+func findZipLocalExtra(r io.ReaderAt, dataOffset int64, name string, maxExtra int) ([]byte, bool) {
+	const localHeaderLen = 30
+	window := min(dataOffset, int64(localHeaderLen+len(name)+maxExtra))
+	buf := make([]byte, window)
+	if _, err := r.ReadAt(buf, dataOffset-window); err != nil {
+		return nil, false
+	}
+	for extraLen := 0; extraLen <= maxExtra; extraLen++ {
+		start := len(buf) - extraLen - len(name) - localHeaderLen
+		if start < 0 {
+			break
+		}
+		hdr := buf[start:]
+		if bytes.HasPrefix(hdr, []byte("PK\x03\x04")) &&
+			int(binary.LittleEndian.Uint16(hdr[26:28])) == len(name) &&
+			int(binary.LittleEndian.Uint16(hdr[28:30])) == extraLen {
+			return hdr[localHeaderLen+len(name):], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,62 @@
+package archiver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNTFSTimestamps(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/ntfs_times.zip")
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	af := ar.File("report.txt")
+	if af == nil {
+		t.Fatal("missing report.txt")
+	}
+	// DOS time would have stopped at the even second.
+	wantM := time.Date(2023, 7, 4, 15, 30, 12, 345678900, time.UTC)
+	if !af.ModTime().Equal(wantM) {
+		t.Errorf("ModTime() = %v, want %v", af.ModTime(), wantM)
+	}
+	wantA := time.Date(2023, 7, 5, 8, 0, 0, 500000000, time.UTC)
+	if !af.AccessTime().Equal(wantA) {
+		t.Errorf("AccessTime() = %v, want %v", af.AccessTime(), wantA)
+	}
+	wantC := time.Date(2023, 1, 2, 3, 4, 5, 100, time.UTC)
+	if !af.CreationTime().Equal(wantC) {
+		t.Errorf("CreationTime() = %v, want %v", af.CreationTime(), wantC)
+	}
+
+	// Archives without the field leave the extra times zero.
+	ar, _ = GetArchiveInfo("testassets/test.zip")
+	if !ar.File("dirhelp.txt").AccessTime().IsZero() {
+		t.Error("AccessTime() set without an NTFS field")
+	}
+}
+
+func TestAccessAndChangeTimes(t *testing.T) {
+	testdata := []struct {
+		filename string
+		atime    time.Time
+		ctime    time.Time
+	}{{"testassets/ut_times.zip", time.Date(2024, 3, 9, 18, 30, 0, 0, time.UTC), time.Time{}},
+		{"testassets/pax_times.tgz", time.Unix(1709994600, 250000000), time.Unix(1710000000, 500000000)},
+	}
+	for _, test := range testdata {
+		ar, err := GetArchiveInfo(test.filename)
+		if err != nil {
+			t.Fatalf("%s error = %v", test.filename, err)
+		}
+		af := ar.File("log.txt")
+		if !af.ModTime().Equal(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s ModTime() = %v", test.filename, af.ModTime())
+		}
+		if !af.AccessTime().Equal(test.atime) {
+			t.Errorf("%s AccessTime() = %v, want %v", test.filename, af.AccessTime(), test.atime)
+		}
+		if !af.ChangeTime().Equal(test.ctime) {
+			t.Errorf("%s ChangeTime() = %v, want %v", test.filename, af.ChangeTime(), test.ctime)
+		}
+	}
+}
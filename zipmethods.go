@@ -0,0 +1,83 @@
+package archiver
+
+import (
+	"archive/zip"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression methods beyond archive/zip's store and deflate.
+const (
+	zipMethodBZip2 = 12
+	zipMethodZstd  = 93
+)
+
+// Method names as 7z has them, where it has them.
+var zipMethods = map[uint16]string{
+	zip.Store: "Store", zip.Deflate: "Deflate", 9: "Deflate64", zipMethodBZip2: "BZip2", 14: "LZMA",
+	zipMethodZstd: "ZStandard", 95: "XZ", 98: "PPMd",
+}
+
+// The entry's compression method, looking behind WinZip AES to the real one.
+func zipMethodName(f *zip.File) string {
+	method := f.Method
+	if method == zipMethodAES {
+		if _, _, real, ok := parseZipAESExtra(f.Extra); ok {
+			method = real
+		}
+	}
+	if name, ok := zipMethods[method]; ok {
+		return name
+	}
+	return fmt.Sprintf("method %d", method)
+}
+
+// zip.NewReader with our extra decompressors registered.
+func newZipReader(src source) (*zip.Reader, error) {
+	zipReader, err := zip.NewReader(src, src.size)
+	if err != nil {
+		return nil, err
+	}
+	zipReader.RegisterDecompressor(zipMethodBZip2, func(r io.Reader) io.ReadCloser {
+		return io.NopCloser(bzip2.NewReader(r))
+	})
+	zipReader.RegisterDecompressor(zipMethodZstd, newZstdReader)
+	return zipReader, nil
+}
+
+func newZstdReader(r io.Reader) io.ReadCloser {
+	// Single-threaded keeps it to one goroutine per open entry.
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return io.NopCloser(&errReader{err})
+	}
+	return dec.IOReadCloser()
+}
+
+// Open an entry's data, turning the flags and methods we can't handle into
+// the package errors.  Encrypted entries need password; see WithPassword.
+func openZipFile(f *zip.File, password string) (io.ReadCloser, error) {
+	if f.Flags&0x1 != 0 {
+		if password == "" {
+			return nil, fmt.Errorf("%s: %w", f.Name, ErrEncrypted)
+		}
+		return openEncryptedZip(f, password)
+	}
+	readCloser, err := f.Open()
+	if errors.Is(err, zip.ErrAlgorithm) {
+		return nil, fmt.Errorf("%s: %w: zip method %d", f.Name, ErrUnsupportedFormat, f.Method)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	return readCloser, nil
+}
+
+// Reader that only fails.
+type errReader struct{ err error }
+
+func (er *errReader) Read([]byte) (int, error) { return 0, er.err }
@@ -0,0 +1,25 @@
+package archiver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestZipMethods(t *testing.T) {
+	ar, err := GetArchiveInfo("testassets/methods.zip")
+	if err != nil {
+		t.Fatalf("GetArchiveInfo() error = %v", err)
+	}
+	want := strings.Repeat("Pack my box with five dozen liquor jugs.\n", 8)
+	for _, name := range []string{"bzip2.txt", "zstd.txt", "deflate.txt"} {
+		got, err := ar.File(name).GetString()
+		if err != nil || got != want {
+			t.Errorf("GetString(%s) = %q, %v", name, got, err)
+		}
+	}
+	_, err = ar.File("unknown.txt").GetBytes()
+	if !errors.Is(err, ErrUnsupportedFormat) || !strings.Contains(err.Error(), "zip method 97") {
+		t.Errorf("GetBytes(unknown.txt) error = %v, want ErrUnsupportedFormat naming the method", err)
+	}
+}
@@ -0,0 +1,65 @@
+package archiver
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"hash/crc32"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Decode zip and CAB entry names that aren't flagged as UTF-8, and LHA
+// and ARJ names, from enc, such as japanese.ShiftJIS for archives made on
+// Japanese Windows or charmap.CodePage866 for Russian ones.  Without this
+// option such names are kept if they're valid UTF-8, as from tools that
+// write UTF-8 without setting the flag, and otherwise taken as CP437, the
+// zip and ARJ default, or for CAB as Windows-1252 and for LHA as
+// Shift-JIS.  Either way a zip entry's Info-ZIP Unicode Path extra field
+// wins where it has one.
+func WithNameEncoding(enc encoding.Encoding) Option {
+	return func(o *options) { o.nameEncoding = enc }
+}
+
+// The zip entry's name as UTF-8, with enc from WithNameEncoding.
+func zipName(f *zip.File, enc encoding.Encoding) string {
+	if name, ok := zipUnicodePath(f); ok {
+		return name
+	}
+	if !f.NonUTF8 {
+		return f.Name
+	}
+	return legacyName(f.Name, enc, charmap.CodePage437)
+}
+
+// A name in a legacy code page: enc where it's given, and otherwise name
+// itself if it's valid UTF-8, or else fallback.
+func legacyName(name string, enc, fallback encoding.Encoding) string {
+	if enc == nil {
+		if utf8.ValidString(name) {
+			return name
+		}
+		enc = fallback
+	}
+	decoded, err := enc.NewDecoder().String(name)
+	if err != nil {
+		return name
+	}
+	return decoded
+}
+
+// The UTF-8 name from an Info-ZIP Unicode Path extra field (version 1),
+// if there's one that still matches the stored name: a tool that renamed
+// the entry without knowing the field leaves its CRC stale.
+func zipUnicodePath(f *zip.File) (name string, ok bool) {
+	walkZipExtra(f.Extra, func(id uint16, body []byte) {
+		if id != zipExtraUniPath || len(body) < 5 || body[0] != 1 {
+			return
+		}
+		if binary.LittleEndian.Uint32(body[1:5]) == crc32.ChecksumIEEE([]byte(f.Name)) && utf8.Valid(body[5:]) {
+			name, ok = string(body[5:]), true
+		}
+	})
+	return name, ok
+}
@@ -0,0 +1,68 @@
+package archiver
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestZipNameEncoding(t *testing.T) {
+	sjis, _ := japanese.ShiftJIS.NewEncoder().String("日本語.txt")
+	// "Ü" is 0x9a in CP437; the extra field gives the name as UTF-8.
+	upExtra := binary.LittleEndian.AppendUint16(nil, zipExtraUniPath)
+	upExtra = binary.LittleEndian.AppendUint16(upExtra, uint16(5+len("ünïcode.txt")))
+	upExtra = append(upExtra, 1)
+	upExtra = binary.LittleEndian.AppendUint32(upExtra, crc32.ChecksumIEEE([]byte("\x81n\x8bcode.txt")))
+	upExtra = append(upExtra, "ünïcode.txt"...)
+
+	path := filepath.Join(t.TempDir(), "names.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	for _, head := range []*zip.FileHeader{
+		{Name: sjis, NonUTF8: true},
+		{Name: "\x9a.txt", NonUTF8: true},
+		{Name: "\x81n\x8bcode.txt", NonUTF8: true, Extra: upExtra},
+		{Name: "flagged-ü.txt"},
+	} {
+		w, err := zw.CreateHeader(head)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("data"))
+	}
+	zw.Close()
+	out.Close()
+
+	ar, err := GetArchiveInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Ü.txt", "ünïcode.txt", "flagged-ü.txt"} {
+		if af := ar.File(name); af == nil {
+			t.Errorf("%q not listed", name)
+		} else if got, err := af.GetString(); got != "data" || err != nil {
+			t.Errorf("%s GetString() = %q, %v", name, got, err)
+		}
+	}
+
+	ar, err = GetArchiveInfo(path, WithNameEncoding(japanese.ShiftJIS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if af := ar.File("日本語.txt"); af == nil {
+		t.Errorf("Shift JIS name listed as %q", ar.FileAt(0).Name())
+	} else if got, err := af.GetString(); got != "data" || err != nil {
+		t.Errorf("GetString() = %q, %v", got, err)
+	}
+	if af := ar.File("ünïcode.txt"); af == nil {
+		t.Error("Unicode Path extra field ignored under WithNameEncoding")
+	}
+}